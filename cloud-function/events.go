@@ -0,0 +1,233 @@
+package cloudfunction
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Formats a GCS notification can arrive in
+const (
+	// formatGCSObject is the object itself: 1st-gen triggers, and Eventarc's
+	// binary-mode CloudEvents, which carry the envelope in Ce-* headers
+	formatGCSObject = "gcs_object"
+	// formatCloudEvent is a structured-mode CloudEvent with the object in data
+	formatCloudEvent = "cloudevent"
+	// formatPubSubPush is a Pub/Sub push with the object base64 in message.data
+	formatPubSubPush = "pubsub_push"
+)
+
+// errUnknownFormat is returned for bodies that aren't a GCS notification in
+// any format the function accepts
+var errUnknownFormat = errors.New("unknown event format")
+
+// storageEvent is a GCS notification, whatever format it arrived in
+type storageEvent struct {
+	Format string
+	ID     string // The CloudEvent or Pub/Sub message ID; empty for a bare object
+	Type   string // The CloudEvent type or Pub/Sub eventType, when given
+	Object GCSObject
+	Trace  traceContext // The trace the event was delivered under, if any
+	// OverwrittenBy is the generation that replaced a deleted object, which
+	// only Pub/Sub notifications report
+	OverwrittenBy string
+}
+
+// traceContext is the W3C trace context an event was delivered under, which
+// the webhook passes on so the API's spans join the same trace
+type traceContext struct {
+	Parent string // traceparent
+	State  string // tracestate
+}
+
+// traceParentPattern matches a version 00 traceparent
+var traceParentPattern = regexp.MustCompile(`^00-[0-9a-f]{32}-[0-9a-f]{16}-[0-9a-f]{2}$`)
+
+// valid reports whether Parent is a version 00 traceparent whose trace and
+// parent IDs aren't all zeros, which the spec says to ignore
+func (t traceContext) valid() bool {
+	return traceParentPattern.MatchString(t.Parent) &&
+		t.Parent[3:35] != strings.Repeat("0", 32) &&
+		t.Parent[36:52] != strings.Repeat("0", 16)
+}
+
+// traceID is the trace's ID, or empty if the context isn't valid
+func (t traceContext) traceID() string {
+	if !t.valid() {
+		return ""
+	}
+	return t.Parent[3:35]
+}
+
+// firstValidTrace returns the first valid context, or none
+func firstValidTrace(candidates ...traceContext) traceContext {
+	for _, candidate := range candidates {
+		if candidate.valid() {
+			return candidate
+		}
+	}
+	return traceContext{}
+}
+
+// Kinds of change an event reports
+const (
+	kindFinalize = "finalize"
+	kindDelete   = "delete"
+)
+
+// eventKinds maps the event types of each delivery path to their kind
+var eventKinds = map[string]string{
+	// 1st-gen triggers and bare objects carry no type, and are all finalizes
+	"": kindFinalize,
+
+	"google.cloud.storage.object.v1.finalized": kindFinalize,
+	"google.storage.object.finalize":           kindFinalize,
+	"OBJECT_FINALIZE":                          kindFinalize,
+	"google.cloud.storage.object.v1.deleted":   kindDelete,
+	"google.storage.object.delete":             kindDelete,
+	"OBJECT_DELETE":                            kindDelete,
+}
+
+// kind is the change the event reports, or empty for one the function
+// doesn't act on, such as an archive or metadata update
+func (e storageEvent) kind() string {
+	return eventKinds[e.Type]
+}
+
+// cloudEvent is a structured-mode CloudEvent
+type cloudEvent struct {
+	SpecVersion string          `json:"specversion"`
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Data        json.RawMessage `json:"data"`
+	DataBase64  string          `json:"data_base64"`
+	// The distributed tracing extension
+	TraceParent string `json:"traceparent"`
+	TraceState  string `json:"tracestate"`
+}
+
+// pubSubPush is the body of a Pub/Sub push subscription
+type pubSubPush struct {
+	Message struct {
+		Data       []byte            `json:"data"` // base64 in the JSON
+		Attributes map[string]string `json:"attributes"`
+		MessageID  string            `json:"messageId"`
+	} `json:"message"`
+	Subscription string `json:"subscription"`
+}
+
+// parseStorageEvent reads a GCS notification from a request body in any of
+// the accepted formats. A structured CloudEvent's data may itself be a
+// Pub/Sub push, as Eventarc sends for Pub/Sub triggers. Bodies in no known
+// format, or without a bucket and object name, are errUnknownFormat.
+func parseStorageEvent(header http.Header, body []byte) (storageEvent, error) {
+	event, err := decodeStorageEvent(body, true)
+	if err != nil {
+		return storageEvent{}, err
+	}
+	// Binary-mode CloudEvents describe the body in headers
+	if event.ID == "" {
+		event.ID = header.Get("Ce-Id")
+	}
+	if event.Type == "" {
+		event.Type = header.Get("Ce-Type")
+	}
+	// A trace in the event itself, which the upload came with, wins over the
+	// one it was delivered in
+	event.Trace = firstValidTrace(event.Trace,
+		traceContext{Parent: header.Get("Ce-Traceparent"), State: header.Get("Ce-Tracestate")},
+		traceContext{Parent: header.Get("Traceparent"), State: header.Get("Tracestate")},
+	)
+	if event.Object.Bucket == "" || event.Object.Name == "" {
+		return storageEvent{}, fmt.Errorf("%w: no bucket and object name in %s", errUnknownFormat, event.Format)
+	}
+	return event, nil
+}
+
+// decodeStorageEvent tells the formats apart by their top-level fields.
+// nested allows a CloudEvent, whose data can hold another format.
+func decodeStorageEvent(body []byte, nested bool) (storageEvent, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return storageEvent{}, fmt.Errorf("%w: %v", errUnknownFormat, err)
+	}
+
+	switch {
+	case fields["specversion"] != nil && nested:
+		var ce cloudEvent
+		if err := json.Unmarshal(body, &ce); err != nil {
+			return storageEvent{}, fmt.Errorf("%w: %v", errUnknownFormat, err)
+		}
+		data := []byte(ce.Data)
+		if ce.DataBase64 != "" {
+			decoded, err := base64.StdEncoding.DecodeString(ce.DataBase64)
+			if err != nil {
+				return storageEvent{}, fmt.Errorf("%w: CloudEvent data_base64: %v", errUnknownFormat, err)
+			}
+			data = decoded
+		}
+		inner, err := decodeStorageEvent(data, false)
+		if err != nil {
+			return storageEvent{}, err
+		}
+		if inner.Format == formatGCSObject {
+			inner.Format = formatCloudEvent
+		}
+		inner.ID, inner.Type = ce.ID, firstNonEmpty(inner.Type, ce.Type)
+		inner.Trace = firstValidTrace(inner.Trace, traceContext{Parent: ce.TraceParent, State: ce.TraceState})
+		return inner, nil
+
+	case fields["message"] != nil:
+		var push pubSubPush
+		if err := json.Unmarshal(body, &push); err != nil {
+			return storageEvent{}, fmt.Errorf("%w: %v", errUnknownFormat, err)
+		}
+		event := storageEvent{
+			Format:        formatPubSubPush,
+			ID:            push.Message.MessageID,
+			Type:          push.Message.Attributes["eventType"],
+			OverwrittenBy: push.Message.Attributes["overwrittenByGeneration"],
+			// Set by Pub/Sub clients publishing with OpenTelemetry
+			Trace: firstValidTrace(traceContext{
+				Parent: push.Message.Attributes["googclient_traceparent"],
+				State:  push.Message.Attributes["googclient_tracestate"],
+			}),
+		}
+		if len(push.Message.Data) > 0 {
+			if err := json.Unmarshal(push.Message.Data, &event.Object); err != nil {
+				return storageEvent{}, fmt.Errorf("%w: Pub/Sub message data: %v", errUnknownFormat, err)
+			}
+		}
+		// Notifications with payload format NONE name the object in attributes only
+		if event.Object.Bucket == "" {
+			event.Object.Bucket = push.Message.Attributes["bucketId"]
+		}
+		if event.Object.Name == "" {
+			event.Object.Name = push.Message.Attributes["objectId"]
+		}
+		return event, nil
+
+	case fields["bucket"] != nil && fields["name"] != nil:
+		event := storageEvent{Format: formatGCSObject}
+		if err := json.Unmarshal(body, &event.Object); err != nil {
+			return storageEvent{}, fmt.Errorf("%w: %v", errUnknownFormat, err)
+		}
+		return event, nil
+
+	default:
+		return storageEvent{}, errUnknownFormat
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
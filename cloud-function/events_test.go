@@ -0,0 +1,357 @@
+package cloudfunction
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	testBucket  = "wavlake-audio"
+	testObject  = "tracks/original/0b6f8a6e-6c1d-4c1e-9f3a-2d5e8f7a9b10.mp3"
+	testTrackID = "0b6f8a6e-6c1d-4c1e-9f3a-2d5e8f7a9b10"
+)
+
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+// Payloads captured from each delivery path. Eventarc's direct GCS trigger
+// sends binary mode: the object as the body, the envelope in Ce-* headers.
+var eventPayloads = []struct {
+	name       string
+	file       string
+	header     http.Header
+	wantFormat string
+	wantID     string
+	wantType   string
+}{
+	{
+		name:       "1st gen object",
+		file:       "gcs_object.json",
+		wantFormat: formatGCSObject,
+	},
+	{
+		name: "binary CloudEvent",
+		file: "gcs_object.json",
+		header: http.Header{
+			"Ce-Id":          {"11353063462298988"},
+			"Ce-Type":        {"google.cloud.storage.object.v1.finalized"},
+			"Ce-Specversion": {"1.0"},
+		},
+		wantFormat: formatGCSObject,
+		wantID:     "11353063462298988",
+		wantType:   "google.cloud.storage.object.v1.finalized",
+	},
+	{
+		name:       "structured CloudEvent",
+		file:       "cloudevent_structured.json",
+		header:     http.Header{"Content-Type": {"application/cloudevents+json; charset=UTF-8"}},
+		wantFormat: formatCloudEvent,
+		wantID:     "11353063462298988",
+		wantType:   "google.cloud.storage.object.v1.finalized",
+	},
+	{
+		name:       "Pub/Sub push",
+		file:       "pubsub_push.json",
+		wantFormat: formatPubSubPush,
+		wantID:     "11353063462298991",
+		wantType:   "OBJECT_FINALIZE",
+	},
+	{
+		name:       "Pub/Sub push without payload",
+		file:       "pubsub_push_no_payload.json",
+		wantFormat: formatPubSubPush,
+		wantID:     "11353063462298995",
+		wantType:   "OBJECT_FINALIZE",
+	},
+	{
+		name:       "Eventarc Pub/Sub CloudEvent",
+		file:       "eventarc_pubsub.json",
+		header:     http.Header{"Content-Type": {"application/cloudevents+json"}},
+		wantFormat: formatPubSubPush,
+		wantID:     "11353063462298991",
+		wantType:   "OBJECT_FINALIZE",
+	},
+}
+
+func TestParseStorageEvent(t *testing.T) {
+	for _, tt := range eventPayloads {
+		t.Run(tt.name, func(t *testing.T) {
+			header := tt.header
+			if header == nil {
+				header = http.Header{}
+			}
+			event, err := parseStorageEvent(header, readTestdata(t, tt.file))
+			if err != nil {
+				t.Fatalf("parseStorageEvent() error = %v", err)
+			}
+			if event.Object.Bucket != testBucket || event.Object.Name != testObject {
+				t.Errorf("object = %s/%s, want %s/%s", event.Object.Bucket, event.Object.Name, testBucket, testObject)
+			}
+			if event.Format != tt.wantFormat {
+				t.Errorf("Format = %q, want %q", event.Format, tt.wantFormat)
+			}
+			if event.ID != tt.wantID {
+				t.Errorf("ID = %q, want %q", event.ID, tt.wantID)
+			}
+			if event.Type != tt.wantType {
+				t.Errorf("Type = %q, want %q", event.Type, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestParseStorageEvent_Base64CloudEventData(t *testing.T) {
+	body := `{"specversion":"1.0","id":"evt-1","type":"google.cloud.storage.object.v1.finalized",` +
+		`"data_base64":"eyJidWNrZXQiOiJ3YXZsYWtlLWF1ZGlvIiwibmFtZSI6InRyYWNrcy9vcmlnaW5hbC9hLm1wMyJ9"}`
+	event, err := parseStorageEvent(http.Header{}, []byte(body))
+	if err != nil {
+		t.Fatalf("parseStorageEvent() error = %v", err)
+	}
+	if event.Object.Name != "tracks/original/a.mp3" || event.ID != "evt-1" {
+		t.Errorf("event = %+v, want tracks/original/a.mp3 from evt-1", event)
+	}
+}
+
+func TestParseStorageEvent_UnknownFormat(t *testing.T) {
+	for name, body := range map[string]string{
+		"not JSON":            "bucket=wavlake-audio",
+		"array":               `[{"bucket":"wavlake-audio"}]`,
+		"other JSON":          `{"hello":"world"}`,
+		"CloudEvent no data":  `{"specversion":"1.0","id":"evt-1","type":"google.cloud.audit.log.v1.written"}`,
+		"Pub/Sub no object":   `{"message":{"messageId":"1","attributes":{"eventType":"OBJECT_FINALIZE"}}}`,
+		"Pub/Sub bad data":    `{"message":{"messageId":"1","data":"bm90IGpzb24="}}`,
+		"object without name": `{"bucket":"wavlake-audio","name":""}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseStorageEvent(http.Header{}, []byte(body))
+			if !errors.Is(err, errUnknownFormat) {
+				t.Errorf("parseStorageEvent() error = %v, want errUnknownFormat", err)
+			}
+		})
+	}
+}
+
+func TestParseStorageEvent_TraceContext(t *testing.T) {
+	const (
+		upload   = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+		delivery = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	)
+	object := `{"bucket":"wavlake-audio","name":"` + testObject + `"}`
+	for _, tt := range []struct {
+		name   string
+		body   string
+		header http.Header
+		want   traceContext
+	}{
+		{
+			name:   "binary CloudEvent",
+			body:   object,
+			header: http.Header{"Ce-Id": {"1"}, "Ce-Traceparent": {upload}, "Ce-Tracestate": {"gcs=1"}, "Traceparent": {delivery}},
+			want:   traceContext{Parent: upload, State: "gcs=1"},
+		},
+		{
+			name:   "structured CloudEvent",
+			body:   `{"specversion":"1.0","id":"1","type":"google.cloud.storage.object.v1.finalized","traceparent":"` + upload + `","data":` + object + `}`,
+			header: http.Header{"Traceparent": {delivery}},
+			want:   traceContext{Parent: upload},
+		},
+		{
+			name: "Pub/Sub attributes",
+			body: `{"message":{"messageId":"1","attributes":{"eventType":"OBJECT_FINALIZE","bucketId":"wavlake-audio","objectId":"` + testObject + `","googclient_traceparent":"` + upload + `"}}}`,
+			want: traceContext{Parent: upload},
+		},
+		{
+			name:   "request header only",
+			body:   object,
+			header: http.Header{"Traceparent": {delivery}},
+			want:   traceContext{Parent: delivery},
+		},
+		{
+			name:   "invalid traceparent skipped",
+			body:   object,
+			header: http.Header{"Ce-Traceparent": {"00-00000000000000000000000000000000-00f067aa0ba902b7-01"}, "Traceparent": {delivery}},
+			want:   traceContext{Parent: delivery},
+		},
+		{
+			name:   "malformed traceparent",
+			body:   object,
+			header: http.Header{"Traceparent": {"not-a-trace"}},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := parseStorageEvent(tt.header, []byte(tt.body))
+			if err != nil {
+				t.Fatalf("parseStorageEvent() error = %v", err)
+			}
+			if event.Trace != tt.want {
+				t.Errorf("Trace = %+v, want %+v", event.Trace, tt.want)
+			}
+		})
+	}
+}
+
+// webhookPayload is the part of a processing webhook the tests check
+type webhookPayload struct {
+	TrackID   string `json:"track_id"`
+	Status    string `json:"status"`
+	Size      int64  `json:"size"`
+	VersionID string `json:"version_id"`
+}
+
+// fakeAPI records the processing webhooks it receives
+func fakeAPI(t *testing.T) *[]webhookPayload {
+	t.Helper()
+	var payloads []webhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var payload webhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("webhook body %s: %v", body, err)
+		}
+		payloads = append(payloads, payload)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("API_BASE_URL", server.URL)
+	t.Setenv("WEBHOOK_SECRET", "")
+	return &payloads
+}
+
+func TestProcessAudioUpload_EveryFormat(t *testing.T) {
+	for _, tt := range eventPayloads {
+		t.Run(tt.name, func(t *testing.T) {
+			payloads := fakeAPI(t)
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(readTestdata(t, tt.file))))
+			for key, values := range tt.header {
+				r.Header[key] = values
+			}
+			w := httptest.NewRecorder()
+
+			ProcessAudioUpload(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("status = %d, want 200", w.Code)
+			}
+			want := webhookPayload{TrackID: testTrackID, Status: "uploaded"}
+			if len(*payloads) != 1 || (*payloads)[0] != want {
+				t.Errorf("webhooks sent %+v, want [%+v]", *payloads, want)
+			}
+		})
+	}
+}
+
+func TestProcessAudioUpload_UnknownFormatAcknowledged(t *testing.T) {
+	payloads := fakeAPI(t)
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"hello":"world"}`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	ProcessAudioUpload(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200 so the event isn't retried", w.Code)
+	}
+	if len(*payloads) != 0 {
+		t.Errorf("webhooks sent %+v, want none", *payloads)
+	}
+}
+
+func TestProcessAudioUpload_DeletesAndCompressedFiles(t *testing.T) {
+	versionID := "5c2e7d1a-3b4f-4a6e-8d9c-1f2a3b4c5d6e"
+	compressed := "tracks/compressed/" + testTrackID + "_" + versionID + ".mp3"
+	for _, tt := range []struct {
+		name   string
+		body   string
+		header http.Header
+		want   webhookPayload
+	}{
+		{
+			name: "Pub/Sub delete without payload",
+			body: `{"message":{"messageId":"1","attributes":{"eventType":"OBJECT_DELETE","bucketId":"wavlake-audio","objectId":"` + testObject + `"}}}`,
+			want: webhookPayload{TrackID: testTrackID, Status: "original_deleted"},
+		},
+		{
+			name:   "binary CloudEvent delete",
+			body:   `{"bucket":"wavlake-audio","name":"` + testObject + `","contentType":"audio/mpeg","size":"5242880"}`,
+			header: http.Header{"Ce-Id": {"2"}, "Ce-Type": {"google.cloud.storage.object.v1.deleted"}},
+			want:   webhookPayload{TrackID: testTrackID, Status: "original_deleted"},
+		},
+		{
+			name:   "compression version finalized",
+			body:   `{"bucket":"wavlake-audio","name":"` + compressed + `","contentType":"audio/mpeg","size":"2048"}`,
+			header: http.Header{"Ce-Id": {"3"}, "Ce-Type": {"google.cloud.storage.object.v1.finalized"}},
+			want:   webhookPayload{TrackID: testTrackID, Status: "processed", Size: 2048, VersionID: versionID},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			payloads := fakeAPI(t)
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			for key, values := range tt.header {
+				r.Header[key] = values
+			}
+			w := httptest.NewRecorder()
+
+			ProcessAudioUpload(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("status = %d, want 200", w.Code)
+			}
+			if len(*payloads) != 1 || (*payloads)[0] != tt.want {
+				t.Errorf("webhooks sent %+v, want [%+v]", *payloads, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessAudioUpload_ForwardsTraceContext(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	for _, tt := range []struct {
+		name   string
+		header http.Header
+	}{
+		{"delivered with a trace", http.Header{"Traceparent": {traceparent}, "Tracestate": {"gcs=1"}}},
+		{"delivered without one", nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var got http.Header
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Clone()
+				w.WriteHeader(http.StatusOK)
+			}))
+			t.Cleanup(server.Close)
+			t.Setenv("API_BASE_URL", server.URL)
+			t.Setenv("WEBHOOK_SECRET", "")
+
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(readTestdata(t, "gcs_object.json"))))
+			for key, values := range tt.header {
+				r.Header[key] = values
+			}
+			ProcessAudioUpload(httptest.NewRecorder(), r)
+
+			sent := traceContext{Parent: got.Get("Traceparent"), State: got.Get("Tracestate")}
+			if tt.header != nil {
+				if want := (traceContext{Parent: traceparent, State: "gcs=1"}); sent != want {
+					t.Errorf("webhook trace = %+v, want %+v", sent, want)
+				}
+				return
+			}
+			// A new sampled trace is started
+			if !sent.valid() || !strings.HasSuffix(sent.Parent, "-01") {
+				t.Errorf("webhook traceparent = %q, want a new sampled trace", sent.Parent)
+			}
+		})
+	}
+}
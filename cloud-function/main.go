@@ -2,12 +2,21 @@ package cloudfunction
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	mathrand "math/rand/v2"
+	"mime"
 	"net/http"
 	"os"
+	"path"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -32,7 +41,44 @@ type GCSObject struct {
 	Etag           string    `json:"etag"`
 }
 
-// ProcessAudioUpload is triggered when a file is uploaded to GCS
+// audioContentTypes are the Content-Types an original may be stored with:
+// those upload URLs are signed for (uploadContentTypes in
+// internal/services/upload_url.go), their common aliases, and the
+// octet-stream of imports and unlisted extensions
+var audioContentTypes = map[string]bool{
+	"audio/mpeg":               true,
+	"audio/mp3":                true,
+	"audio/wav":                true,
+	"audio/wave":               true,
+	"audio/x-wav":              true,
+	"audio/flac":               true,
+	"audio/x-flac":             true,
+	"audio/aac":                true,
+	"audio/ogg":                true,
+	"audio/opus":               true,
+	"audio/mp4":                true,
+	"audio/x-m4a":              true,
+	"audio/x-ms-wma":           true,
+	"audio/aiff":               true,
+	"audio/x-aiff":             true,
+	"audio/basic":              true,
+	"application/octet-stream": true,
+}
+
+// isAudioContentType reports whether an object's Content-Type is on the
+// allowlist. GCS stores objects uploaded without one as octet-stream.
+func isAudioContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return audioContentTypes[mediaType]
+}
+
+// ProcessAudioUpload is triggered when a file is uploaded to or deleted from GCS
 func ProcessAudioUpload(w http.ResponseWriter, r *http.Request) {
 	// Read the raw body for debugging
 	body, err := io.ReadAll(r.Body)
@@ -45,47 +91,132 @@ func ProcessAudioUpload(w http.ResponseWriter, r *http.Request) {
 	// Log raw event for debugging
 	log.Printf("Raw event body: %s", string(body))
 
-	// Parse the event
-	var gcsObject GCSObject
-	if err := json.Unmarshal(body, &gcsObject); err != nil {
-		log.Printf("Failed to decode event: %v", err)
-		http.Error(w, "Bad Request", http.StatusBadRequest)
+	// Parse the event. Anything unparseable is acknowledged, since a retry
+	// would fail the same way.
+	event, err := parseStorageEvent(r.Header, body)
+	if err != nil {
+		log.Printf("Ignoring event (content type %q): %v", r.Header.Get("Content-Type"), err)
+		w.WriteHeader(http.StatusOK)
 		return
 	}
+	gcsObject := event.Object
 
 	// Log the full event for debugging
-	log.Printf("Received GCS event - Bucket: %s, Name: %s", gcsObject.Bucket, gcsObject.Name)
+	log.Printf("Received GCS event - Format: %s, Type: %s, Bucket: %s, Name: %s", event.Format, event.Type, gcsObject.Bucket, gcsObject.Name)
 
-	// Only process files in the tracks/original/ path
-	if !strings.HasPrefix(gcsObject.Name, "tracks/original/") {
-		log.Printf("Ignoring file outside tracks/original/: '%s'", gcsObject.Name)
+	update, skip := trackUpdateFor(event)
+	if skip != "" {
+		log.Printf("Ignoring %s: %s", gcsObject.Name, skip)
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	// Extract track ID from filename
-	// Format: tracks/original/uuid.extension
-	parts := strings.Split(gcsObject.Name, "/")
-	if len(parts) != 3 {
-		log.Printf("Invalid file path format: %s", gcsObject.Name)
-		w.WriteHeader(http.StatusOK)
+	requestID := eventRequestID(r, event.ID)
+	trace := eventTrace(event)
+	log.Printf("Sending %s webhook for track %s (file: %s, request_id: %s, trace_id: %s)", update.Status, update.TrackID, gcsObject.Name, requestID, trace.traceID())
+
+	// Call the API with the update. Responses a redelivery would get too are
+	// acknowledged; anything else is left for the platform to retry.
+	if err := triggerProcessing(update, requestID, trace); err != nil {
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			log.Printf("API rejected %s webhook for track %s (request_id: %s), not retrying: %v", update.Status, update.TrackID, requestID, err)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		log.Printf("Failed to send %s webhook for track %s (request_id: %s): %v", update.Status, update.TrackID, requestID, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	filename := parts[2]
-	trackID := strings.TrimSuffix(filename, "."+getFileExtension(filename))
+	log.Printf("Successfully sent %s webhook for track %s (request_id: %s)", update.Status, update.TrackID, requestID)
+	w.WriteHeader(http.StatusOK)
+}
 
-	log.Printf("Processing track upload: %s (file: %s)", trackID, gcsObject.Name)
+// Storage prefixes the function watches, as in utils.StoragePathConfig
+const (
+	originalPrefix   = "tracks/original/"
+	compressedPrefix = "tracks/compressed/"
+)
 
-	// Call the API to trigger processing
-	if err := triggerProcessing(trackID); err != nil {
-		log.Printf("Failed to trigger processing for track %s: %v", trackID, err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
+// trackUpdate is the processing webhook a storage event is sent as
+type trackUpdate struct {
+	TrackID   string
+	Status    string // "uploaded", "processed" or "original_deleted"
+	Size      int64  // For "processed", the compressed file's size
+	VersionID string // For "processed", the compression version
+}
+
+// trackUpdateFor returns the webhook to send for an event, or why the event
+// is skipped:
+//   - an original finalized is "uploaded", to start processing
+//   - an original deleted is "original_deleted", so the API can flag the
+//     track, unless Pub/Sub reports it was overwritten by a new upload
+//   - a compression version's file finalized is "processed" for that version.
+//     The track's default compressed file is written by the API itself.
+func trackUpdateFor(event storageEvent) (trackUpdate, string) {
+	object := event.Object
+	kind := event.kind()
+	if kind == "" {
+		return trackUpdate{}, fmt.Sprintf("event type %q isn't a finalize or delete", event.Type)
 	}
 
-	log.Printf("Successfully triggered processing for track %s", trackID)
-	w.WriteHeader(http.StatusOK)
+	// Objects are named <prefix><filename>, with no further directories
+	dir, filename := path.Split(object.Name)
+	var update trackUpdate
+	switch dir {
+	case originalPrefix:
+		// Format: tracks/original/uuid.extension
+		update.TrackID = strings.TrimSuffix(filename, "."+getFileExtension(filename))
+		update.Status = "uploaded"
+		if kind == kindDelete {
+			if event.OverwrittenBy != "" {
+				return trackUpdate{}, fmt.Sprintf("original overwritten by generation %s", event.OverwrittenBy)
+			}
+			update.Status = "original_deleted"
+		}
+
+	case compressedPrefix:
+		if kind != kindFinalize {
+			return trackUpdate{}, "compressed file deleted"
+		}
+		// Format: tracks/compressed/uuid_versionid.extension
+		update.TrackID, update.VersionID = parseCompressedName(filename)
+		if update.VersionID == "" {
+			return trackUpdate{}, "not a compression version's file"
+		}
+		update.Status = "processed"
+		// Notifications without a payload have no size, and the API keeps the
+		// version's own
+		update.Size, _ = strconv.ParseInt(object.Size, 10, 64)
+
+	default:
+		return trackUpdate{}, "outside tracks/original/ and tracks/compressed/"
+	}
+
+	if !isUUID(update.TrackID) {
+		return trackUpdate{}, "file name isn't a track ID"
+	}
+	if !isAudioContentType(object.ContentType) {
+		return trackUpdate{}, fmt.Sprintf("non-audio content type %q", object.ContentType)
+	}
+	return update, ""
+}
+
+// parseCompressedName splits a compressed file's name into its track and
+// compression version IDs, as utils.StoragePathConfig.GetTrackIDFromPath
+// does: the track ID runs to the first underscore or dot, and the version ID
+// from that underscore to the extension. The version ID is empty for the
+// track's default compressed file.
+func parseCompressedName(filename string) (trackID, versionID string) {
+	name := strings.TrimSuffix(filename, "."+getFileExtension(filename))
+	if i := strings.IndexAny(name, "_."); i >= 0 {
+		if name[i] == '_' {
+			versionID = name[i+1:]
+		}
+		return name[:i], versionID
+	}
+	return name, ""
 }
 
 // getFileExtension extracts file extension from filename
@@ -97,8 +228,79 @@ func getFileExtension(filename string) string {
 	return parts[len(parts)-1]
 }
 
-// triggerProcessing calls the API to start track processing
-func triggerProcessing(trackID string) error {
+// isUUID reports whether s is a UUID in its 36 character text form, as the
+// API names originals
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// eventRequestID returns the ID the API logs this upload's processing under:
+// the caller's X-Request-ID, else the CloudEvent or Pub/Sub message ID, which
+// stays the same when the event is redelivered, else a new random ID
+func eventRequestID(r *http.Request, eventID string) string {
+	if requestID := r.Header.Get("X-Request-ID"); requestID != "" {
+		return requestID
+	}
+	if eventID != "" {
+		return eventID
+	}
+	requestID, err := generateNonce()
+	if err != nil {
+		return ""
+	}
+	return requestID
+}
+
+// eventTrace returns the trace the API records the event's handling under:
+// the one the event came with, else a new sampled one, so the webhook and the
+// processing it starts are always a single trace
+func eventTrace(event storageEvent) traceContext {
+	if event.Trace.valid() {
+		return event.Trace
+	}
+	ids := make([]byte, 24)
+	if _, err := rand.Read(ids); err != nil {
+		return traceContext{}
+	}
+	return traceContext{Parent: fmt.Sprintf("00-%x-%x-01", ids[:16], ids[16:])}
+}
+
+// Webhook delivery settings, vars so tests can shorten them. Four attempts
+// at 30s each, and the backoff between them, fit in the function's 540s.
+var (
+	webhookAttempts   = 4
+	webhookRetryDelay = time.Second // Doubled after each retry, with jitter
+	webhookTimeout    = 30 * time.Second
+)
+
+// permanentError is an API response retrying won't change: a 4xx other than
+// 429, or a redirect
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// triggerProcessing sends the API a track update, retrying timeouts,
+// connection errors, 429s and 5xx with exponential backoff. A response that
+// won't change is returned as *permanentError at once.
+func triggerProcessing(update trackUpdate, requestID string, trace traceContext) error {
 	apiURL := os.Getenv("API_BASE_URL")
 	if apiURL == "" {
 		return fmt.Errorf("API_BASE_URL environment variable not set")
@@ -106,10 +308,54 @@ func triggerProcessing(trackID string) error {
 
 	webhookURL := fmt.Sprintf("%s/v1/tracks/webhook/process", apiURL)
 
+	var err error
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(retryDelay(attempt - 1))
+		}
+		err = sendProcessingWebhook(webhookURL, update, requestID, trace)
+		var permanent *permanentError
+		if err == nil || errors.As(err, &permanent) {
+			return err
+		}
+		log.Printf("Processing webhook attempt %d/%d for track %s failed (request_id: %s): %v", attempt, webhookAttempts, update.TrackID, requestID, err)
+	}
+	return fmt.Errorf("gave up after %d attempts: %w", webhookAttempts, err)
+}
+
+// retryDelay is the wait before the given retry: webhookRetryDelay doubled
+// for each earlier retry, between half and all of it so functions retrying
+// together spread out
+func retryDelay(retry int) time.Duration {
+	delay := webhookRetryDelay << (retry - 1)
+	return delay/2 + mathrand.N(delay/2+1)
+}
+
+// sendProcessingWebhook makes one delivery of a track update. Each attempt
+// gets its own timestamp and nonce, so a retry isn't a replay. The API
+// answers with the traceparent of its span, which is logged to tie the trace
+// to this function's logs.
+func sendProcessingWebhook(webhookURL string, update trackUpdate, requestID string, trace traceContext) error {
+
+	// Timestamp and nonce let the API reject stale or replayed deliveries
+	nonce, err := generateNonce()
+	if err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	timestamp := time.Now().Unix()
 	payload := map[string]interface{}{
-		"track_id": trackID,
-		"status":   "uploaded",
-		"source":   "gcs_trigger",
+		"track_id":  update.TrackID,
+		"status":    update.Status,
+		"source":    "gcs_trigger",
+		"timestamp": timestamp,
+		"nonce":     nonce,
+	}
+	if update.Size > 0 {
+		payload["size"] = update.Size
+	}
+	if update.VersionID != "" {
+		payload["version_id"] = update.VersionID
 	}
 
 	payloadBytes, err := json.Marshal(payload)
@@ -123,22 +369,57 @@ func triggerProcessing(trackID string) error {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	if requestID != "" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
+	if trace.Parent != "" {
+		req.Header.Set("Traceparent", trace.Parent)
+		if trace.State != "" {
+			req.Header.Set("Tracestate", trace.State)
+		}
+	}
 
-	// Add webhook authentication if configured
+	// Sign the delivery if a secret is configured; the secret itself is never sent
 	if webhookSecret := os.Getenv("WEBHOOK_SECRET"); webhookSecret != "" {
-		req.Header.Set("X-Webhook-Secret", webhookSecret)
+		signedAt := strconv.FormatInt(timestamp, 10)
+		req.Header.Set("X-Webhook-Timestamp", signedAt)
+		req.Header.Set("X-Webhook-Signature", signWebhook(webhookSecret, signedAt, payloadBytes))
 	}
 
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := &http.Client{Timeout: webhookTimeout}
 	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to call webhook: %w", err)
 	}
 	defer resp.Body.Close()
+	if apiTrace := (traceContext{Parent: resp.Header.Get("Traceparent")}); apiTrace.valid() {
+		log.Printf("API traced %s webhook for track %s as %s", update.Status, update.TrackID, apiTrace.Parent)
+	}
 
-	if resp.StatusCode != http.StatusOK {
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError:
 		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	default:
+		return &permanentError{err: fmt.Errorf("webhook returned status %d", resp.StatusCode)}
 	}
+}
+
+// signWebhook returns the hex HMAC-SHA256 of "<timestamp>.<body>", which the
+// API checks against X-Webhook-Signature
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
 
-	return nil
+// generateNonce returns a random hex string unique to a single webhook delivery
+func generateNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
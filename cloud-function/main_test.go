@@ -0,0 +1,213 @@
+package cloudfunction
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Known vector shared with internal/handlers/webhook_signature_test.go, so the
+// function and the API agree on what is signed
+func TestSignWebhook_KnownKey(t *testing.T) {
+	got := signWebhook("test-webhook-secret", "1700000000", []byte(`{"track_id":"track-123","status":"uploaded"}`))
+	want := "eddb164739fbcee455096ec353d277ca6c47f3be4974ad99ad389114f8fb7f21"
+	if got != want {
+		t.Errorf("signWebhook() = %s, want %s", got, want)
+	}
+}
+
+func TestEventRequestID(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", nil)
+	if got := eventRequestID(r, "event-123"); got != "event-123" {
+		t.Errorf("eventRequestID() = %q, want the event ID", got)
+	}
+
+	r.Header.Set("X-Request-ID", "req-456")
+	if got := eventRequestID(r, "event-123"); got != "req-456" {
+		t.Errorf("eventRequestID() = %q, want the caller's request ID", got)
+	}
+
+	if got := eventRequestID(httptest.NewRequest("POST", "/", nil), ""); got == "" {
+		t.Error("eventRequestID() returned no ID for a request without one")
+	}
+}
+
+func TestIsUUID(t *testing.T) {
+	for s, want := range map[string]bool{
+		"0b6f8a6e-6c1d-4c1e-9f3a-2d5e8f7a9b10": true,
+		"0B6F8A6E-6C1D-4C1E-9F3A-2D5E8F7A9B10": true,
+		"0b6f8a6e6c1d4c1e9f3a2d5e8f7a9b10":     false,
+		"0b6f8a6e-6c1d-4c1e-9f3a-2d5e8f7a9b1g": false,
+		"0b6f8a6e-6c1d-4c1e-9f3a_2d5e8f7a9b10": false,
+		"cover":                                false,
+		"":                                     false,
+	} {
+		if got := isUUID(s); got != want {
+			t.Errorf("isUUID(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestIsAudioContentType(t *testing.T) {
+	for contentType, want := range map[string]bool{
+		"audio/mpeg":               true,
+		"audio/flac; charset=x":    true,
+		"application/octet-stream": true,
+		"":                         true,
+		"image/png":                false,
+		"text/plain":               false,
+		"audio/":                   false,
+		"not a type;;":             false,
+	} {
+		if got := isAudioContentType(contentType); got != want {
+			t.Errorf("isAudioContentType(%q) = %v, want %v", contentType, got, want)
+		}
+	}
+}
+
+// scriptedAPI answers the nth processing webhook with statuses[n], repeating
+// the last, and counts the calls. Retries are shortened for the test.
+func scriptedAPI(t *testing.T, statuses ...int) *int {
+	t.Helper()
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := statuses[min(calls, len(statuses)-1)]
+		calls++
+		if status == 0 {
+			time.Sleep(50 * time.Millisecond) // Past webhookTimeout
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("API_BASE_URL", server.URL)
+	t.Setenv("WEBHOOK_SECRET", "")
+
+	attempts, delay, timeout := webhookAttempts, webhookRetryDelay, webhookTimeout
+	webhookAttempts, webhookRetryDelay, webhookTimeout = 3, time.Millisecond, 20*time.Millisecond
+	t.Cleanup(func() { webhookAttempts, webhookRetryDelay, webhookTimeout = attempts, delay, timeout })
+	return &calls
+}
+
+// upload runs ProcessAudioUpload for a bare object notification
+func upload(t *testing.T, name, contentType string) int {
+	t.Helper()
+	body := fmt.Sprintf(`{"bucket":"wavlake-audio","name":%q,"contentType":%q}`, name, contentType)
+	w := httptest.NewRecorder()
+	ProcessAudioUpload(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+	return w.Code
+}
+
+func TestProcessAudioUpload_Skips(t *testing.T) {
+	for name, object := range map[string]struct{ name, contentType string }{
+		"outside tracks":          {"images/" + testTrackID + ".png", "image/png"},
+		"default compressed file": {"tracks/compressed/" + testTrackID + ".mp3", "audio/mpeg"},
+		"nested directory":        {"tracks/original/old/" + testTrackID + ".mp3", "audio/mpeg"},
+		"name not a UUID":         {"tracks/original/cover.mp3", "audio/mpeg"},
+		"image":                   {"tracks/original/" + testTrackID + ".png", "image/png"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			calls := scriptedAPI(t, http.StatusOK)
+			if status := upload(t, object.name, object.contentType); status != http.StatusOK {
+				t.Errorf("status = %d, want 200", status)
+			}
+			if *calls != 0 {
+				t.Errorf("API called %d times, want none", *calls)
+			}
+		})
+	}
+}
+
+func TestProcessAudioUpload_Retries(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		statuses   []int
+		wantStatus int
+		wantCalls  int
+	}{
+		{"accepted", []int{http.StatusOK}, http.StatusOK, 1},
+		{"5xx then accepted", []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK}, http.StatusOK, 3},
+		{"timeout then accepted", []int{0, http.StatusOK}, http.StatusOK, 2},
+		{"rate limited then accepted", []int{http.StatusTooManyRequests, http.StatusOK}, http.StatusOK, 2},
+		{"5xx every attempt", []int{http.StatusInternalServerError}, http.StatusInternalServerError, 3},
+		{"timeout every attempt", []int{0}, http.StatusInternalServerError, 3},
+		{"not found", []int{http.StatusNotFound}, http.StatusOK, 1},
+		{"conflict", []int{http.StatusConflict}, http.StatusOK, 1},
+		{"unauthorized after 5xx", []int{http.StatusBadGateway, http.StatusUnauthorized}, http.StatusOK, 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := scriptedAPI(t, tt.statuses...)
+			if status := upload(t, testObject, "audio/mpeg"); status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if *calls != tt.wantCalls {
+				t.Errorf("API called %d times, want %d", *calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	delay := webhookRetryDelay
+	t.Cleanup(func() { webhookRetryDelay = delay })
+	webhookRetryDelay = time.Second
+
+	for retry, longest := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second} {
+		for i := 0; i < 20; i++ {
+			if got := retryDelay(retry); got < longest/2 || got > longest {
+				t.Fatalf("retryDelay(%d) = %v, want between %v and %v", retry, got, longest/2, longest)
+			}
+		}
+	}
+}
+
+func TestTrackUpdateFor(t *testing.T) {
+	original := GCSObject{Bucket: testBucket, Name: testObject, ContentType: "audio/mpeg"}
+	compressed := GCSObject{Bucket: testBucket, Name: "tracks/compressed/" + testTrackID + "_mp3-128.mp3", ContentType: "audio/mpeg", Size: "2048"}
+	image := GCSObject{Bucket: testBucket, Name: "tracks/original/" + testTrackID + ".png", ContentType: "image/png"}
+
+	for _, tt := range []struct {
+		name     string
+		event    storageEvent
+		want     trackUpdate
+		wantSkip bool
+	}{
+		{"original finalized", storageEvent{Object: original}, trackUpdate{TrackID: testTrackID, Status: "uploaded"}, false},
+		{"original deleted", storageEvent{Type: "google.cloud.storage.object.v1.deleted", Object: original}, trackUpdate{TrackID: testTrackID, Status: "original_deleted"}, false},
+		{"original overwritten", storageEvent{Type: "OBJECT_DELETE", Object: original, OverwrittenBy: "1718035200123457"}, trackUpdate{}, true},
+		{"original archived", storageEvent{Type: "google.cloud.storage.object.v1.archived", Object: original}, trackUpdate{}, true},
+		{"original metadata updated", storageEvent{Type: "OBJECT_METADATA_UPDATE", Object: original}, trackUpdate{}, true},
+		{"image deleted", storageEvent{Type: "OBJECT_DELETE", Object: image}, trackUpdate{}, true},
+		{"version finalized", storageEvent{Type: "OBJECT_FINALIZE", Object: compressed}, trackUpdate{TrackID: testTrackID, Status: "processed", Size: 2048, VersionID: "mp3-128"}, false},
+		{"version finalized without payload", storageEvent{Type: "OBJECT_FINALIZE", Object: GCSObject{Bucket: testBucket, Name: compressed.Name}}, trackUpdate{TrackID: testTrackID, Status: "processed", VersionID: "mp3-128"}, false},
+		{"version deleted", storageEvent{Type: "OBJECT_DELETE", Object: compressed}, trackUpdate{}, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, skip := trackUpdateFor(tt.event)
+			if (skip != "") != tt.wantSkip {
+				t.Fatalf("trackUpdateFor() skip = %q, want skipped %v", skip, tt.wantSkip)
+			}
+			if got != tt.want {
+				t.Errorf("trackUpdateFor() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCompressedName(t *testing.T) {
+	for filename, want := range map[string][2]string{
+		testTrackID + "_mp3-128.mp3":  {testTrackID, "mp3-128"},
+		testTrackID + "_opus-64.opus": {testTrackID, "opus-64"},
+		testTrackID + ".mp3":          {testTrackID, ""},
+		testTrackID:                   {testTrackID, ""},
+		testTrackID + "_":             {testTrackID, ""},
+	} {
+		trackID, versionID := parseCompressedName(filename)
+		if trackID != want[0] || versionID != want[1] {
+			t.Errorf("parseCompressedName(%q) = %q, %q, want %q, %q", filename, trackID, versionID, want[0], want[1])
+		}
+	}
+}
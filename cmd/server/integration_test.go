@@ -0,0 +1,540 @@
+//go:build integration
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/bodylimit"
+	"github.com/wavlake/api/internal/config"
+	"github.com/wavlake/api/internal/handlers"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/utils"
+)
+
+func TestIntegrationUploadLifecycle(t *testing.T) {
+	h := newIntegrationHarness(t)
+	audio := h.audio.fixture(t)
+
+	created := h.createTrack("wav")
+	assert.True(t, created.IsProcessing)
+	assert.Equal(t, models.TrackStatusPendingUpload, created.Status)
+	assert.Equal(t, h.pubkey, created.Pubkey)
+	assert.Equal(t, h.firebaseUID, created.FirebaseUID)
+
+	// The URL only takes the declared type, up to the size limit
+	assert.Equal(t, map[string]string{"Content-Type": "audio/wav", "X-Goog-Content-Length-Range": "0,1048576"}, created.UploadHeaders)
+	assert.Equal(t, int64(integrationMaxUploadBytes), created.MaxUploadBytes)
+	assert.Equal(t, http.StatusForbidden, h.put(created.PresignedURL, map[string]string{"Content-Type": "video/mp4"}, audio))
+	assert.Equal(t, http.StatusBadRequest, h.put(created.PresignedURL, created.UploadHeaders, make([]byte, integrationMaxUploadBytes+1)))
+
+	h.upload(created.PresignedURL, created.UploadHeaders, audio)
+	assert.Equal(t, audio, h.fetch(created.OriginalURL))
+
+	resp := h.webhook(map[string]interface{}{
+		"track_id": created.ID,
+		"status":   "uploaded",
+		"source":   "gcs_trigger",
+	})
+	require.Equal(t, http.StatusOK, resp.Status, resp.Error)
+
+	processed := h.waitForProcessing(created.ID)
+	assert.Empty(t, processed.Error)
+	assert.Equal(t, models.TrackStatusReady, processed.Status)
+	for _, status := range []string{models.TrackStatusPendingUpload, models.TrackStatusUploaded, models.TrackStatusProcessing, models.TrackStatusReady} {
+		assert.Contains(t, processed.StatusTimestamps, status)
+	}
+	assert.True(t, processed.IsCompressed)
+	assert.Greater(t, processed.Duration, 0)
+	require.NotEmpty(t, processed.CompressedURL)
+	require.Len(t, processed.CompressionVersions, 1)
+	assert.True(t, processed.CompressionVersions[0].IsPublic)
+	assert.Len(t, processed.CompressionVersions[0].Hash, 64)
+	assert.Len(t, processed.OriginalHash, 64)
+	assert.NotEmpty(t, h.fetch(processed.CompressedURL))
+	require.NotEmpty(t, processed.WaveformURL)
+	var waveform utils.Waveform
+	require.NoError(t, json.Unmarshal(h.fetch(processed.WaveformURL), &waveform))
+	assert.Equal(t, 2*waveform.Length, len(waveform.Data))
+	require.NotEmpty(t, processed.PreviewURL)
+	assert.NotEmpty(t, h.fetch(processed.PreviewURL))
+
+	// The owner can download their original through a signed URL
+	resp = h.request(http.MethodGet, "/v1/tracks/"+created.ID+"/original-download?expires_in=60", h.secretKey, nil)
+	require.Equal(t, http.StatusOK, resp.Status, resp.Error)
+	var download models.OriginalDownload
+	require.NoError(t, json.Unmarshal(resp.Data, &download))
+	assert.Equal(t, 60, download.ExpiresIn)
+	assert.Equal(t, audio, h.fetch(download.URL))
+
+	// Public view
+	resp = h.request(http.MethodGet, "/v1/tracks/"+created.ID, "", nil)
+	require.Equal(t, http.StatusOK, resp.Status, resp.Error)
+	assert.Equal(t, processed.CompressedURL, h.track(resp).CompressedURL)
+	assert.Equal(t, models.TrackStatusReady, h.track(resp).Status)
+
+	// Owner listing
+	resp = h.request(http.MethodGet, "/v1/tracks/my", h.secretKey, nil)
+	require.Equal(t, http.StatusOK, resp.Status, resp.Error)
+	var mine []*models.NostrTrack
+	require.NoError(t, json.Unmarshal(resp.Data, &mine))
+	require.Len(t, mine, 1)
+	assert.Equal(t, created.ID, mine[0].ID)
+
+	resp = h.request(http.MethodGet, "/v1/tracks/my?status=processing", h.secretKey, nil)
+	require.Equal(t, http.StatusOK, resp.Status, resp.Error)
+	var stillProcessing []*models.NostrTrack
+	if len(resp.Data) > 0 {
+		require.NoError(t, json.Unmarshal(resp.Data, &stillProcessing))
+	}
+	assert.Empty(t, stillProcessing)
+
+	// The owner is notified asynchronously
+	h.eventually(func() bool {
+		return h.hasNotification(created.ID, models.NotificationTypeProcessingComplete)
+	})
+
+	// The account overview resolves the NIP-98 pubkey to the linked account
+	resp = h.request(http.MethodGet, "/v1/users/me", h.secretKey, nil)
+	require.Equal(t, http.StatusOK, resp.Status, resp.Error)
+	var profile models.UserProfile
+	require.NoError(t, json.Unmarshal(resp.Data, &profile))
+	assert.Equal(t, h.firebaseUID, profile.FirebaseUID)
+	require.Len(t, profile.Pubkeys, 1)
+	assert.True(t, profile.Pubkeys[0].Primary)
+	require.NotNil(t, profile.Tracks)
+	assert.Equal(t, 1, profile.Tracks.Total)
+	assert.Equal(t, int64(len(audio)), profile.Storage.OriginalBytes)
+	// No legacy database in the harness
+	assert.Nil(t, profile.Legacy)
+	assert.Contains(t, profile.Warnings, "legacy unavailable")
+}
+
+func TestIntegrationRenewUploadURL(t *testing.T) {
+	h := newIntegrationHarness(t)
+	audio := h.audio.fixture(t)
+	created := h.createTrack("wav")
+	path := "/v1/tracks/" + created.ID + "/upload-url"
+
+	// A stalled upload gets a new URL for the same object
+	resp := h.request(http.MethodPost, path, h.secretKey, nil)
+	require.Equal(t, http.StatusOK, resp.Status, resp.Error)
+	var upload models.UploadURL
+	require.NoError(t, json.Unmarshal(resp.Data, &upload))
+	assert.Equal(t, http.MethodPut, upload.Method)
+	assert.Equal(t, "audio/wav", upload.Headers["Content-Type"])
+	assert.Equal(t, 3600, upload.ExpiresIn)
+
+	h.upload(upload.URL, upload.Headers, audio)
+	resp = h.webhook(map[string]interface{}{"track_id": created.ID, "status": "uploaded", "source": "gcs_trigger"})
+	require.Equal(t, http.StatusOK, resp.Status, resp.Error)
+	h.waitForProcessing(created.ID)
+
+	// A processed track's file can only be replaced deliberately
+	resp = h.request(http.MethodPost, path, h.secretKey, nil)
+	assert.Equal(t, http.StatusConflict, resp.Status)
+
+	resp = h.request(http.MethodPost, path+"?replace=true", h.secretKey, nil)
+	require.Equal(t, http.StatusOK, resp.Status, resp.Error)
+
+	resp = h.request(http.MethodGet, "/v1/tracks/"+created.ID+"/status", h.secretKey, nil)
+	require.Equal(t, http.StatusOK, resp.Status, resp.Error)
+	reset := h.track(resp)
+	assert.Equal(t, models.TrackStatusPendingUpload, reset.Status)
+	assert.False(t, reset.IsCompressed)
+	assert.Empty(t, reset.CompressedURL)
+
+	// Someone else can't get a URL for the track
+	otherKey, otherPubkey := h.newKey()
+	h.linkPubkey(otherPubkey, "uid-"+otherPubkey[:16])
+	resp = h.request(http.MethodPost, path, otherKey, nil)
+	assert.Equal(t, http.StatusForbidden, resp.Status)
+}
+
+func TestIntegrationCompressionDeduplicated(t *testing.T) {
+	h := newIntegrationHarness(t)
+	created := h.createTrack("wav")
+	h.upload(created.PresignedURL, created.UploadHeaders, h.audio.fixture(t))
+	resp := h.webhook(map[string]interface{}{"track_id": created.ID, "status": "uploaded", "source": "gcs_trigger"})
+	require.Equal(t, http.StatusOK, resp.Status, resp.Error)
+	h.waitForProcessing(created.ID)
+
+	// Processing made the 128k MP3; the OGG is asked for twice
+	path := "/v1/tracks/" + created.ID + "/compress"
+	ogg := models.CompressionOption{Format: "ogg", Bitrate: 96, Quality: "low"}
+	resp = h.request(http.MethodPost, path, h.secretKey, map[string]interface{}{
+		"compressions": []models.CompressionOption{{Format: "mp3", Bitrate: 128, Quality: "medium"}, ogg, ogg},
+	})
+	require.Equal(t, http.StatusOK, resp.Status, resp.Error)
+	var result models.CompressionRequestResult
+	require.NoError(t, json.Unmarshal(resp.Data, &result))
+	require.Len(t, result.Queued, 1)
+	assert.Len(t, result.Duplicates, 1)
+	require.Len(t, result.Existing, 1)
+	assert.Equal(t, "default-128k-mp3", result.Existing[0].VersionID)
+
+	h.eventually(func() bool {
+		resp := h.request(http.MethodGet, "/v1/tracks/"+created.ID+"/status", h.secretKey, nil)
+		return resp.Status == http.StatusOK && !h.track(resp).HasPendingCompression
+	})
+
+	resp = h.request(http.MethodPost, path, h.secretKey, map[string]interface{}{"compressions": []models.CompressionOption{ogg}})
+	require.Equal(t, http.StatusOK, resp.Status, resp.Error)
+	require.NoError(t, json.Unmarshal(resp.Data, &result))
+	assert.Empty(t, result.Queued)
+	assert.Len(t, result.Existing, 1)
+}
+
+func TestIntegrationPurgeTrack(t *testing.T) {
+	h := newIntegrationHarness(t)
+	audio := h.audio.fixture(t)
+
+	created := h.createTrack("wav")
+	h.upload(created.PresignedURL, created.UploadHeaders, audio)
+	resp := h.webhook(map[string]interface{}{"track_id": created.ID, "status": "uploaded"})
+	require.Equal(t, http.StatusOK, resp.Status, resp.Error)
+	h.waitForProcessing(created.ID)
+
+	// A dry run lists the files without deleting anything
+	resp = h.request(http.MethodDelete, "/v1/tracks/"+created.ID+"?purge=true&dry_run=true", h.secretKey, nil)
+	require.Equal(t, http.StatusOK, resp.Status, resp.Error)
+	var purge models.TrackPurge
+	require.NoError(t, json.Unmarshal(resp.Data, &purge))
+	assert.True(t, purge.DryRun)
+	assert.Contains(t, purge.Objects, "tracks/original/"+created.ID+".wav")
+	_, ok := h.storage.get("tracks/original/" + created.ID + ".wav")
+	assert.True(t, ok)
+
+	resp = h.request(http.MethodDelete, "/v1/tracks/"+created.ID+"?purge=true", h.secretKey, nil)
+	require.Equal(t, http.StatusOK, resp.Status, resp.Error)
+	purge = models.TrackPurge{}
+	require.NoError(t, json.Unmarshal(resp.Data, &purge))
+	assert.Empty(t, purge.Failed)
+	for _, objectName := range purge.Objects {
+		_, ok := h.storage.get(objectName)
+		assert.False(t, ok, objectName)
+	}
+
+	resp = h.request(http.MethodPost, "/v1/tracks/"+created.ID+"/restore", h.secretKey, nil)
+	assert.Equal(t, http.StatusConflict, resp.Status)
+}
+
+func TestIntegrationProcessingFailureAndRetry(t *testing.T) {
+	h := newIntegrationHarness(t)
+
+	created := h.createTrack("wav")
+	h.upload(created.PresignedURL, created.UploadHeaders, []byte("this is not audio"))
+
+	resp := h.webhook(map[string]interface{}{"track_id": created.ID, "status": "uploaded"})
+	require.Equal(t, http.StatusOK, resp.Status, resp.Error)
+
+	failed := h.waitForProcessing(created.ID)
+	assert.Contains(t, failed.Error, "file does not appear to be WAV")
+	assert.Equal(t, models.ProcessingErrorFormat, failed.ErrorCode)
+	assert.Equal(t, models.TrackStatusFailed, failed.Status)
+	assert.False(t, failed.IsCompressed)
+	assert.Empty(t, failed.CompressedURL)
+
+	h.eventually(func() bool {
+		return h.hasNotification(created.ID, models.NotificationTypeProcessingFailed)
+	})
+
+	// Re-upload a valid file and retry through the manual trigger
+	h.upload(created.PresignedURL, created.UploadHeaders, h.audio.fixture(t))
+	resp = h.request(http.MethodPost, "/v1/tracks/"+created.ID+"/process", h.secretKey, nil)
+	require.Equal(t, http.StatusOK, resp.Status, resp.Error)
+
+	retried := h.waitForProcessing(created.ID)
+	assert.Empty(t, retried.Error)
+	assert.Empty(t, retried.ErrorCode)
+	assert.True(t, retried.IsCompressed)
+	assert.NotEmpty(t, retried.CompressedURL)
+
+	// Both attempts are in the history, newest first; the retry is recorded as
+	// finished just after the track becomes ready
+	var history []models.ProcessingAttempt
+	h.eventually(func() bool {
+		resp := h.request(http.MethodGet, "/v1/tracks/"+created.ID+"/history", h.secretKey, nil)
+		history = nil
+		if resp.Status != http.StatusOK || json.Unmarshal(resp.Data, &history) != nil {
+			return false
+		}
+		return len(history) == 2 && history[0].FinishedAt != nil
+	})
+	assert.Equal(t, models.ProcessingTriggerRetry, history[0].TriggeredBy)
+	assert.Equal(t, models.ProcessingOutcomeSucceeded, history[0].Outcome)
+	assert.NotEmpty(t, history[0].Versions)
+	assert.Equal(t, models.ProcessingTriggerWebhook, history[1].TriggeredBy)
+	assert.Equal(t, models.ProcessingOutcomeFailed, history[1].Outcome)
+	assert.Equal(t, models.ProcessingErrorFormat, history[1].ErrorClass)
+	assert.Equal(t, models.ProcessingStageValidating, history[1].Phase)
+
+	// A processed track can't be triggered again, and a repeated upload
+	// trigger is acknowledged as a duplicate
+	resp = h.request(http.MethodPost, "/v1/tracks/"+created.ID+"/process", h.secretKey, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.Status)
+
+	resp = h.webhook(map[string]interface{}{"track_id": created.ID, "status": "uploaded"})
+	assert.Equal(t, http.StatusOK, resp.Status)
+	assert.True(t, resp.Duplicate)
+}
+
+func TestIntegrationDuplicateIdempotencyKey(t *testing.T) {
+	h := newIntegrationHarness(t)
+	created := h.createTrack("flac")
+
+	payload := map[string]interface{}{
+		"track_id":        created.ID,
+		"status":          "failed",
+		"error":           "download failed",
+		"idempotency_key": "delivery-" + created.ID,
+	}
+	resp := h.webhook(payload)
+	require.Equal(t, http.StatusOK, resp.Status, resp.Error)
+	assert.False(t, resp.Duplicate)
+
+	// A redelivery carries a new nonce but the same key
+	delete(payload, "nonce")
+	resp = h.webhook(payload)
+	assert.Equal(t, http.StatusOK, resp.Status)
+	assert.True(t, resp.Duplicate)
+}
+
+func TestIntegrationFailedWebhook(t *testing.T) {
+	h := newIntegrationHarness(t)
+	created := h.createTrack("flac")
+
+	resp := h.webhook(map[string]interface{}{
+		"track_id": created.ID,
+		"status":   "failed",
+		"error":    "compression failed: encoder crashed",
+	})
+	require.Equal(t, http.StatusOK, resp.Status, resp.Error)
+
+	track := h.waitForProcessing(created.ID)
+	assert.Equal(t, "compression failed: encoder crashed", track.Error)
+}
+
+func TestIntegrationWebhookReplayRejected(t *testing.T) {
+	h := newIntegrationHarness(t)
+	created := h.createTrack("wav")
+
+	payload := map[string]interface{}{
+		"track_id": created.ID,
+		"status":   "failed",
+		"error":    "download failed",
+		"nonce":    randomHex(16),
+	}
+	resp := h.webhook(payload)
+	require.Equal(t, http.StatusOK, resp.Status, resp.Error)
+
+	resp = h.webhook(payload)
+	assert.Equal(t, http.StatusConflict, resp.Status)
+	assert.Equal(t, handlers.WebhookErrorCodeReplay, resp.Code)
+
+	resp = h.webhook(map[string]interface{}{
+		"track_id":  created.ID,
+		"status":    "failed",
+		"timestamp": time.Now().Add(-time.Hour).Unix(),
+	})
+	assert.Equal(t, http.StatusUnauthorized, resp.Status)
+	assert.Equal(t, handlers.WebhookErrorCodeExpired, resp.Code)
+}
+
+func TestIntegrationAuthorization(t *testing.T) {
+	h := newIntegrationHarness(t)
+	created := h.createTrack("wav")
+
+	// Unsigned requests never reach the handlers
+	resp := h.request(http.MethodPost, "/v1/tracks/nostr", "", map[string]string{"extension": "wav"})
+	assert.Equal(t, http.StatusUnauthorized, resp.Status)
+
+	// A valid signature from a pubkey that isn't linked to an account
+	unlinkedKey, _ := h.newKey()
+	resp = h.request(http.MethodPost, "/v1/tracks/nostr", unlinkedKey, map[string]string{"extension": "wav"})
+	assert.Equal(t, http.StatusUnauthorized, resp.Status)
+
+	// Another linked user can't see or process the track
+	otherKey, otherPubkey := h.newKey()
+	h.linkPubkey(otherPubkey, "uid-"+otherPubkey[:16])
+
+	resp = h.request(http.MethodGet, "/v1/tracks/"+created.ID+"/status", otherKey, nil)
+	assert.Equal(t, http.StatusForbidden, resp.Status)
+
+	resp = h.request(http.MethodPost, "/v1/tracks/"+created.ID+"/process", otherKey, nil)
+	assert.Equal(t, http.StatusForbidden, resp.Status)
+
+	resp = h.request(http.MethodGet, "/v1/tracks/"+created.ID+"/original-download", otherKey, nil)
+	assert.Equal(t, http.StatusForbidden, resp.Status)
+
+	resp = h.request(http.MethodDelete, "/v1/tracks/"+created.ID, otherKey, nil)
+	assert.Equal(t, http.StatusForbidden, resp.Status)
+
+	resp = h.request(http.MethodPost, "/v1/tracks/"+created.ID+"/restore", otherKey, nil)
+	assert.Equal(t, http.StatusForbidden, resp.Status)
+
+	// The owner can delete it, after which it drops out of their listing
+	resp = h.request(http.MethodDelete, "/v1/tracks/"+created.ID, h.secretKey, nil)
+	require.Equal(t, http.StatusOK, resp.Status, resp.Error)
+
+	resp = h.request(http.MethodGet, "/v1/tracks/my", h.secretKey, nil)
+	require.Equal(t, http.StatusOK, resp.Status, resp.Error)
+	var remaining []*models.NostrTrack
+	if len(resp.Data) > 0 {
+		require.NoError(t, json.Unmarshal(resp.Data, &remaining))
+	}
+	assert.Empty(t, remaining)
+
+	// Deleting cancelled the never-uploaded track; restoring waits for the upload again
+	resp = h.request(http.MethodGet, "/v1/tracks/"+created.ID+"/status", h.secretKey, nil)
+	require.Equal(t, http.StatusOK, resp.Status, resp.Error)
+	assert.Equal(t, models.TrackStatusCancelled, h.track(resp).Status)
+
+	resp = h.request(http.MethodPost, "/v1/tracks/"+created.ID+"/restore", h.secretKey, nil)
+	require.Equal(t, http.StatusOK, resp.Status, resp.Error)
+	assert.Equal(t, models.TrackStatusPendingUpload, h.track(resp).Status)
+	assert.False(t, h.track(resp).Deleted)
+}
+
+func TestIntegrationCheckPubkeyLink(t *testing.T) {
+	h := newIntegrationHarness(t)
+	check := func(secretKey, pubkey string) handlers.CheckPubkeyLinkResponse {
+		t.Helper()
+		resp := h.request(http.MethodPost, "/v1/auth/check-pubkey-link", secretKey, map[string]string{"pubkey": pubkey})
+		require.Equal(t, http.StatusOK, resp.Status, resp.Error)
+		assert.NotContains(t, string(resp.Body), h.firebaseUID)
+		var status handlers.CheckPubkeyLinkResponse
+		require.NoError(t, json.Unmarshal(resp.Body, &status))
+		return status
+	}
+
+	status := check(h.secretKey, h.pubkey)
+	assert.True(t, status.IsLinked)
+	assert.True(t, status.IsActive)
+	assert.NotNil(t, status.LinkedAt)
+
+	// Signed by a key that was never linked
+	unlinkedKey, unlinkedPubkey := h.newKey()
+	status = check(unlinkedKey, unlinkedPubkey)
+	assert.False(t, status.IsLinked)
+	assert.False(t, status.IsActive)
+	assert.Nil(t, status.LinkedAt)
+
+	// A link that's been deactivated is reported as inactive
+	_, err := h.firestore.Collection("nostr_auth").Doc(h.pubkey).Update(h.ctx, []firestore.Update{{Path: "active", Value: false}})
+	require.NoError(t, err)
+	status = check(h.secretKey, h.pubkey)
+	assert.True(t, status.IsLinked)
+	assert.False(t, status.IsActive)
+
+	// Only the pubkey's own signature can check it, and only for itself
+	resp := h.request(http.MethodPost, "/v1/auth/check-pubkey-link", "", map[string]string{"pubkey": h.pubkey})
+	assert.Equal(t, http.StatusUnauthorized, resp.Status)
+	resp = h.request(http.MethodPost, "/v1/auth/check-pubkey-link", unlinkedKey, map[string]string{"pubkey": h.pubkey})
+	assert.Equal(t, http.StatusForbidden, resp.Status)
+}
+
+func TestIntegrationRateLimit(t *testing.T) {
+	h := newIntegrationHarness(t)
+	created := h.createTrack("wav")
+	path := "/v1/tracks/" + created.ID + "/process"
+
+	// Every attempt counts, whatever the handler makes of it
+	for i := 0; i < config.DefaultProcessingRateLimit.Requests; i++ {
+		resp := h.request(http.MethodPost, path, h.secretKey, nil)
+		require.NotEqual(t, http.StatusTooManyRequests, resp.Status, "request %d", i+1)
+	}
+	resp := h.request(http.MethodPost, path, h.secretKey, nil)
+	assert.Equal(t, http.StatusTooManyRequests, resp.Status)
+	assert.Equal(t, apierror.CodeRateLimited, resp.Code)
+
+	// Limits are per pubkey and per route group
+	otherKey, otherPubkey := h.newKey()
+	h.linkPubkey(otherPubkey, "uid-"+otherPubkey[:16])
+	resp = h.request(http.MethodPost, path, otherKey, nil)
+	assert.Equal(t, http.StatusForbidden, resp.Status)
+
+	resp = h.request(http.MethodGet, "/v1/tracks/"+created.ID+"/status", h.secretKey, nil)
+	assert.Equal(t, http.StatusOK, resp.Status)
+	h.createTrack("wav")
+}
+
+func TestIntegrationRequestBodies(t *testing.T) {
+	h := newIntegrationHarness(t)
+	created := h.createTrack("wav")
+	path := "/v1/tracks/" + created.ID + "/compress"
+
+	// A misspelled field is rejected rather than read as an empty request
+	resp := h.request(http.MethodPost, path, h.secretKey, map[string]interface{}{
+		"compresions": []models.CompressionOption{{Format: "ogg", Bitrate: 96}},
+	})
+	assert.Equal(t, http.StatusBadRequest, resp.Status)
+	assert.Equal(t, handlers.ErrorCodeUnknownField, resp.Code)
+
+	ids := make([]string, 5000)
+	for i := range ids {
+		ids[i] = created.ID
+	}
+	resp = h.request(http.MethodPost, "/v1/tracks/bulk-compress", h.secretKey, map[string]interface{}{"track_ids": ids})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Status)
+	assert.Equal(t, bodylimit.ErrorCodeBodyTooLarge, resp.Code)
+
+	// Webhooks get more room
+	resp = h.webhook(map[string]interface{}{"track_id": created.ID, "status": "failed", "error": strings.Repeat("x", 100<<10)})
+	assert.Equal(t, http.StatusOK, resp.Status, resp.Error)
+}
+
+// eventually polls cond for a few seconds
+func (h *integrationHarness) eventually(cond func() bool) {
+	h.t.Helper()
+	require.Eventually(h.t, cond, 10*time.Second, 200*time.Millisecond)
+}
+
+// hasNotification checks the owner's feed for an event on a track
+func (h *integrationHarness) hasNotification(trackID, notificationType string) bool {
+	resp := h.request(http.MethodGet, "/v1/notifications", h.secretKey, nil)
+	if resp.Status != http.StatusOK {
+		return false
+	}
+	var notifications []models.Notification
+	if err := json.Unmarshal(resp.Data, &notifications); err != nil {
+		return false
+	}
+	for _, notification := range notifications {
+		if notification.TrackID == trackID && notification.Type == notificationType {
+			return true
+		}
+	}
+	return false
+}
+
+func TestIntegrationReadiness(t *testing.T) {
+	h := newIntegrationHarness(t)
+
+	resp, err := http.Get(h.server.URL + "/readyz")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var readiness handlers.ReadinessResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&readiness))
+	assert.Equal(t, "ok", readiness.Status)
+	assert.Equal(t, map[string]handlers.DependencyHealth{
+		"firestore": {Status: handlers.HealthStatusOK},
+		"storage":   {Status: handlers.HealthStatusOK},
+		"postgres":  {Status: handlers.HealthStatusSkipped},
+	}, readiness.Checks)
+
+	live, err := http.Get(h.server.URL + "/livez")
+	require.NoError(t, err)
+	live.Body.Close()
+	assert.Equal(t, http.StatusOK, live.StatusCode)
+}
@@ -4,25 +4,41 @@ import (
 	"context"
 	"database/sql"
 	"log"
-	"net/http"
+	"log/slog"
 	"os"
 	"os/signal"
+	"runtime"
 	"strconv"
 	"syscall"
 	"time"
 
 	"cloud.google.com/go/firestore"
 	firebase "firebase.google.com/go/v4"
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	_ "github.com/lib/pq" // PostgreSQL driver
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/wavlake/api/internal/auth"
+	"github.com/wavlake/api/internal/config"
+	"github.com/wavlake/api/internal/feeds"
 	"github.com/wavlake/api/internal/handlers"
+	"github.com/wavlake/api/internal/logging"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/ratelimit"
+	"github.com/wavlake/api/internal/recovery"
 	"github.com/wavlake/api/internal/services"
+	"github.com/wavlake/api/internal/telemetry"
 	"github.com/wavlake/api/internal/utils"
+	"github.com/wavlake/api/pkg/nostr"
 	"google.golang.org/api/option"
 )
 
+// Set at build time with -ldflags "-X main.version=... -X main.commitSHA=..."
+var (
+	version   = "dev"
+	commitSHA string
+)
+
 // getEnvAsInt returns an environment variable as an integer with a default value
 func getEnvAsInt(key string, defaultValue int) int {
 	if value := os.Getenv(key); value != "" {
@@ -34,6 +50,18 @@ func getEnvAsInt(key string, defaultValue int) int {
 }
 
 func main() {
+	startedAt := time.Now()
+
+	// JSON logs with request IDs, including lines from the log package
+	logging.Setup()
+	// Nostr verification failures are logged at debug level (LOG_LEVEL=debug)
+	nostr.SetLogger(slog.Default())
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
@@ -46,13 +74,6 @@ func main() {
 		projectID = "default-project" // Or handle this appropriately
 	}
 
-	// Storage configuration - GCS only
-	bucketName := os.Getenv("GCS_BUCKET_NAME")
-	if bucketName == "" {
-		log.Println("Warning: GCS_BUCKET_NAME environment variable not set")
-		bucketName = "default-bucket"
-	}
-
 	tempDir := os.Getenv("TEMP_DIR")
 	if tempDir == "" {
 		tempDir = "/tmp"
@@ -60,9 +81,17 @@ func main() {
 
 	ctx := context.Background()
 
+	// Set up tracing first so the Firestore and GCS clients pick it up
+	shutdownTracing, err := telemetry.Setup(ctx, version)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	if telemetry.Enabled() {
+		log.Println("Tracing enabled: exporting spans over OTLP")
+	}
+
 	// Initialize Firebase
 	var firebaseApp *firebase.App
-	var err error
 
 	// Try to use service account key if available, otherwise use default credentials
 	if keyPath := os.Getenv("FIREBASE_SERVICE_ACCOUNT_KEY"); keyPath != "" {
@@ -89,6 +118,12 @@ func main() {
 	}
 	defer firestoreClient.Close()
 
+	// Readiness checks for /readyz
+	healthHandler := handlers.NewHealthHandler(handlers.DefaultHealthCheckTimeout)
+	healthHandler.Register("firestore", func(ctx context.Context) error {
+		return services.CheckFirestore(ctx, firestoreClient)
+	})
+
 	// Initialize PostgreSQL connection (optional)
 	var postgresService services.PostgresServiceInterface
 	pgConnStr := os.Getenv("PROD_POSTGRES_CONNECTION_STRING_RO")
@@ -107,45 +142,147 @@ func main() {
 		db.SetMaxIdleConns(maxIdleConns)
 		db.SetConnMaxLifetime(time.Hour)
 
+		// Checked even if the first ping fails, so the instance reports it
+		healthHandler.Register("postgres", db.PingContext)
+
 		// Test connection
 		if err := db.PingContext(ctx); err != nil {
 			log.Printf("PostgreSQL connection test failed: %v", err)
 		} else {
-			postgresService = services.NewPostgresService(db)
+			postgresService = services.NewPostgresService(db,
+				services.WithPostgresQueryTimeout(time.Duration(getEnvAsInt("POSTGRES_QUERY_TIMEOUT_MS", int(services.DefaultPostgresQueryTimeout/time.Millisecond)))*time.Millisecond),
+				services.WithPostgresSlowQueryThreshold(time.Duration(getEnvAsInt("POSTGRES_SLOW_QUERY_MS", int(services.DefaultPostgresSlowQueryThreshold/time.Millisecond)))*time.Millisecond),
+			)
+			if err := services.RegisterPostgresMetrics(prometheus.DefaultRegisterer); err != nil {
+				log.Fatalf("Failed to register PostgreSQL metrics: %v", err)
+			}
 			log.Println("PostgreSQL connection established successfully")
 		}
 	} else {
 		log.Println("PostgreSQL connection string not provided, skipping PostgreSQL setup")
+		healthHandler.Skip("postgres")
 	}
 
 	// Initialize services
-	userService := services.NewUserService(firestoreClient, firebaseAuth)
+	userService := services.NewUserService(firestoreClient, firebaseAuth,
+		services.WithMaxActivePubkeys(getEnvAsInt("MAX_PUBKEYS_PER_USER", services.DefaultMaxActivePubkeys)),
+	)
 
-	// Initialize GCS storage service
-	log.Printf("Initializing GCS storage service with bucket: %s", bucketName)
-	storageService, err := services.NewStorageService(ctx, bucketName)
+	// Initialize the storage backend selected by STORAGE_PROVIDER
+	storageService, err := services.NewStorageFromEnv(ctx)
 	if err != nil {
-		log.Fatalf("Failed to initialize GCS storage service: %v", err)
+		log.Fatalf("Failed to initialize storage service: %v", err)
 	}
 	defer storageService.Close()
+	healthHandler.Register("storage", storageService.CheckBucket)
 
-	nostrTrackService := services.NewNostrTrackService(firestoreClient, storageService)
-	audioProcessor := utils.NewAudioProcessor(tempDir)
-	processingService := services.NewProcessingService(storageService, nostrTrackService, audioProcessor, tempDir)
+	storageRegions, err := services.NewStorageRegionsFromEnv(storageService)
+	if err != nil {
+		log.Fatalf("Failed to configure storage regions: %v", err)
+	}
+	log.Printf("Storage regions: %v (primary: %s)", storageRegions.Names(), storageRegions.Primary())
+
+	// Base URLs for externally visible links; already validated with the storage regions
+	publicURLs, err := utils.GetPublicURLConfig()
+	if err != nil {
+		log.Fatalf("Failed to configure public URLs: %v", err)
+	}
+	if publicURLs.MediaBaseURL != "" || publicURLs.APIBaseURL != "" {
+		log.Printf("Public URLs: media %q, api %q", publicURLs.MediaBaseURL, publicURLs.APIBaseURL)
+	}
+
+	trackQuota, err := services.TrackQuotaFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure track quotas: %v", err)
+	}
+	if trackQuota != (models.TrackQuota{}) {
+		log.Printf("Track quotas: %d tracks, %d bytes per user (0 = unlimited)", trackQuota.MaxTracks, trackQuota.MaxBytes)
+	}
+
+	trackOptions := []services.NostrTrackOption{
+		services.WithTrackQuota(trackQuota),
+		services.WithPresignedURLExpiry(cfg.PresignedURLExpiry),
+		services.WithMaxCompressionVersions(getEnvAsInt("MAX_COMPRESSION_VERSIONS", services.DefaultMaxCompressionVersions)),
+		services.WithMaxUploadBytes(int64(getEnvAsInt("MAX_UPLOAD_BYTES", services.DefaultMaxUploadBytes))),
+	}
+	if len(cfg.PublishRelays) > 0 {
+		relayClient, err := nostr.NewRelayClient(cfg.PublishRelays, nostr.WithRelayTimeout(cfg.RelayPublishTimeout))
+		if err != nil {
+			log.Fatalf("Failed to configure publish relays: %v", err)
+		}
+		trackOptions = append(trackOptions, services.WithRelayPublisher(relayClient))
+		log.Printf("Publishing track events to relays: %v", cfg.PublishRelays)
+	}
+	nostrTrackService := services.NewNostrTrackService(firestoreClient, storageRegions, trackOptions...)
+	webhookService := services.NewWebhookService(firestoreClient)
+	notificationService := services.NewNotificationService(firestoreClient, webhookService)
+	failureEmailNotifier := services.NewFailureEmailNotifier(firestoreClient, userService, services.NewMailerFromEnv())
+	audioProcessor := utils.NewAudioProcessor(tempDir, utils.WithSupportedFormats(cfg.AudioFormats))
+	// Panics in requests and processing are alerted, at most once per interval
+	var panicAlerter recovery.Alerter
+	if cfg.PanicAlertWebhookURL != "" {
+		panicAlerter = recovery.RateLimited(recovery.NewWebhookAlerter(cfg.PanicAlertWebhookURL), cfg.PanicAlertInterval)
+		log.Printf("Panic alerts enabled, at most one per %s", cfg.PanicAlertInterval)
+	}
+
+	processingService := services.NewProcessingService(nostrTrackService, audioProcessor, notificationService, failureEmailNotifier, tempDir,
+		services.WithProcessingMaxAttempts(getEnvAsInt("PROCESSING_MAX_ATTEMPTS", services.DefaultProcessingMaxAttempts)),
+		services.WithProcessingWorkers(getEnvAsInt("PROCESSING_WORKERS", services.DefaultProcessingWorkers)),
+		services.WithProcessingTimeout(cfg.ProcessingTimeout),
+		services.WithPreviewLength(cfg.PreviewLength),
+		services.WithMaxTrackDuration(cfg.MaxTrackDuration),
+		services.WithStuckProcessingThreshold(cfg.StuckProcessingAfter),
+		services.WithStuckReconcileInterval(cfg.StuckReconcileInterval),
+		services.WithTempSpaceFactor(getEnvAsInt("TEMP_SPACE_FACTOR", services.DefaultTempSpaceFactor)),
+		services.WithCompressionWorkers(getEnvAsInt("COMPRESSION_WORKERS", services.DefaultCompressionWorkers)),
+		services.WithOriginalStorageClass(os.Getenv("ORIGINAL_STORAGE_CLASS")),
+		services.WithPanicAlerter(panicAlerter),
+	)
+	// Clear files left by a crashed instance before workers add new ones
+	if _, err := processingService.SweepTempDir(cfg.TempFileMaxAge); err != nil {
+		log.Printf("Warning: failed to sweep temp dir %s: %v", tempDir, err)
+	}
+	processingService.StartJobWorkers()
+	defer processingService.Close()
+	searchIndex := services.NewFirestoreSearchIndex(nostrTrackService)
+	bulkCompressionService := services.NewBulkCompressionService(firestoreClient, nostrTrackService, processingService)
+	exportService := services.NewExportService(firestoreClient, nostrTrackService, storageService)
+	trackImportService := services.NewTrackImportService(nostrTrackService, audioProcessor)
+	profileService := services.NewProfileService(firestoreClient, userService, postgresService)
+	accountDeletionService := services.NewAccountDeletionService(firestoreClient, nostrTrackService, userService)
 
 	// Initialize middleware
 	firebaseMiddleware := auth.NewFirebaseMiddleware(firebaseAuth)
-	dualAuthMiddleware := auth.NewDualAuthMiddleware(firebaseAuth)
+	dualAuthMiddleware := auth.NewDualAuthMiddleware(firebaseAuth, cfg.NIP98TimestampTolerance)
 	firebaseLinkGuard := auth.NewFirebaseLinkGuard(firestoreClient)
-	nip98Middleware, err := auth.NewNIP98Middleware(ctx, projectID)
-	if err != nil {
-		log.Fatalf("Failed to create NIP-98 middleware: %v", err)
-	}
-	flexibleAuthMiddleware := auth.NewFlexibleAuthMiddleware(firebaseAuth, firestoreClient)
+	nip98Middleware := auth.NewNIP98Middleware(auth.NewFirestoreNostrAuthLookup(firestoreClient),
+		auth.WithAuthCacheTTL(time.Duration(getEnvAsInt("NIP98_AUTH_CACHE_TTL_SECONDS", int(auth.DefaultAuthCacheTTL/time.Second)))*time.Second),
+		auth.WithLastUsedFlushInterval(time.Duration(getEnvAsInt("NIP98_LAST_USED_FLUSH_SECONDS", int(auth.DefaultLastUsedFlushInterval/time.Second)))*time.Second),
+		auth.WithTimestampTolerance(cfg.NIP98TimestampTolerance),
+	)
+	defer nip98Middleware.Close()
+	userService.OnPubkeyUnlinked(nip98Middleware.InvalidatePubkey)
+	flexibleAuthMiddleware := auth.NewFlexibleAuthMiddleware(firebaseAuth, firestoreClient, cfg.NIP98TimestampTolerance)
 
 	// Initialize handlers
 	authHandlers := handlers.NewAuthHandlers(userService)
-	tracksHandler := handlers.NewTracksHandler(nostrTrackService, processingService, audioProcessor)
+	tracksHandler := handlers.NewTracksHandler(nostrTrackService, processingService, audioProcessor, notificationService, cfg.WebhookSecret, cfg.WebhookAcceptLegacySecret)
+	bulkCompressionHandler := handlers.NewBulkCompressionHandler(bulkCompressionService, publicURLs)
+	notificationsHandler := handlers.NewNotificationsHandler(notificationService)
+	searchHandler := handlers.NewSearchHandler(searchIndex)
+	feedsHandler := handlers.NewFeedsHandler(feeds.NewGenerator(nostrTrackService, userService, publicURLs))
+	exportHandler := handlers.NewExportHandler(exportService, publicURLs)
+	accountDeletionHandler := handlers.NewAccountDeletionHandler(accountDeletionService)
+	trackImportHandler := handlers.NewTrackImportHandler(trackImportService)
+	usersHandler := handlers.NewUsersHandler(profileService, nostrTrackService, userService)
+	adminHandler := handlers.NewAdminHandler(nostrTrackService, processingService)
+	userWebhooksHandler := handlers.NewUserWebhooksHandler(webhookService)
+
+	// Serve local storage through the API when there's no bucket
+	var devFilesHandler *handlers.DevFilesHandler
+	if localStorage, ok := services.UnwrapStorage(storageService).(*services.LocalStorageService); ok {
+		devFilesHandler = handlers.NewDevFilesHandler(localStorage)
+	}
 
 	// Initialize legacy handler if PostgreSQL is available
 	var legacyHandler *handlers.LegacyHandler
@@ -153,238 +290,140 @@ func main() {
 		legacyHandler = handlers.NewLegacyHandler(postgresService)
 	}
 
+	// Reported by /heartbeat. Deploys without ldflags pass the commit in COMMIT_SHA.
+	buildInfo := handlers.BuildInfo{
+		Version:         version,
+		CommitSHA:       commitSHA,
+		GoVersion:       runtime.Version(),
+		StartedAt:       startedAt,
+		StorageProvider: services.StorageProviderFromEnv(),
+		PostgresEnabled: pgConnStr != "",
+		LegacyEndpoints: legacyHandler != nil,
+		FFmpegAvailable: utils.FFmpegAvailable(),
+	}
+	if buildInfo.CommitSHA == "" {
+		buildInfo.CommitSHA = os.Getenv("COMMIT_SHA")
+	}
+	if buildInfo.CommitSHA == "" {
+		buildInfo.CommitSHA = "unknown"
+	}
+	if !buildInfo.FFmpegAvailable {
+		log.Println("Warning: ffmpeg or ffprobe not found on PATH; track processing will fail")
+	}
+	log.Printf("Build: version %s, commit %s, %s", buildInfo.Version, buildInfo.CommitSHA, buildInfo.GoVersion)
+
 	// Set up Gin router
 	if os.Getenv("GIN_MODE") == "" {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	router := gin.New()
-	router.Use(gin.Logger())
-	router.Use(gin.Recovery())
-
-	// Configure CORS
-	config := cors.DefaultConfig()
-	config.AllowOrigins = []string{
-		"http://localhost:8080",                           // Development
-		"http://localhost:3000",                           // Alternative dev port
-		"http://localhost:8083",                           // Another dev port
-		"https://wavlake.com",                             // Production
-		"https://*.wavlake.com",                           // Subdomains
-		"https://web-wavlake.vercel.app",                  // Vercel main deployment
-		"https://web-git-auth-updates-wavlake.vercel.app", // Vercel auth-updates branch
-		"https://*.vercel.app",                            // All Vercel preview deployments
-	}
-	config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{
-		"Origin",
-		"Content-Type",
-		"Accept",
-		"Authorization",
-		"X-Nostr-Authorization",
-		"X-Requested-With",
-		"x-firebase-token",
-		"X-Firebase-Token",
-	}
-	config.AllowCredentials = true
-	router.Use(cors.New(config))
-
-	// Heartbeat endpoint (no auth required)
-	router.GET("/heartbeat", func(c *gin.Context) {
-		handlers.Heartbeat(c.Writer, c.Request)
+	router := newRouter(routerDeps{
+		corsOrigins:            cfg.CORSOrigins,
+		buildInfo:              buildInfo,
+		docsUI:                 gin.Mode() != gin.ReleaseMode,
+		legacyErrorEnvelope:    cfg.LegacyErrorEnvelope,
+		panicAlerter:           panicAlerter,
+		rateLimiter:            ratelimit.NewMemoryLimiter(),
+		trackCreateLimit:       cfg.TrackCreateRateLimit,
+		compressionLimit:       cfg.CompressionRateLimit,
+		processingLimit:        cfg.ProcessingRateLimit,
+		pubkeyLookupLimit:      cfg.PubkeyLookupRateLimit,
+		authHandlers:           authHandlers,
+		tracksHandler:          tracksHandler,
+		bulkCompressionHandler: bulkCompressionHandler,
+		notificationsHandler:   notificationsHandler,
+		searchHandler:          searchHandler,
+		feedsHandler:           feedsHandler,
+		exportHandler:          exportHandler,
+		accountDeletionHandler: accountDeletionHandler,
+		trackImportHandler:     trackImportHandler,
+		usersHandler:           usersHandler,
+		userWebhooksHandler:    userWebhooksHandler,
+		legacyHandler:          legacyHandler,
+		adminHandler:           adminHandler,
+		healthHandler:          healthHandler,
+		devFilesHandler:        devFilesHandler,
+		metricsHandler:         promhttp.Handler(),
+		metricsToken:           cfg.MetricsToken,
+		firebaseMiddleware:     firebaseMiddleware,
+		dualAuthMiddleware:     dualAuthMiddleware,
+		firebaseLinkGuard:      firebaseLinkGuard,
+		nip98Middleware:        nip98Middleware,
+		flexibleAuthMiddleware: flexibleAuthMiddleware,
 	})
 
-	// Auth endpoints
-	v1 := router.Group("/v1")
-	authGroup := v1.Group("/auth")
-	{
-		// Firebase auth only endpoints
-		authGroup.GET("/get-linked-pubkeys", firebaseMiddleware.Middleware(), authHandlers.GetLinkedPubkeys)
-		authGroup.POST("/unlink-pubkey", firebaseMiddleware.Middleware(), authHandlers.UnlinkPubkey)
-
-		// Dual auth required endpoint
-		authGroup.POST("/link-pubkey", dualAuthMiddleware.Middleware(), authHandlers.LinkPubkey)
-
-		// NIP-98 signature validation only endpoint (no database lookup required)
-		authGroup.POST("/check-pubkey-link", gin.WrapH(nip98Middleware.SignatureValidationMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			c, _ := gin.CreateTestContext(w)
-			c.Request = r
-			if pubkey := r.Context().Value("pubkey"); pubkey != nil {
-				c.Set("pubkey", pubkey)
-			}
-			authHandlers.CheckPubkeyLink(c)
-		}))))
-	}
-
-	// Protected endpoints that require NIP-98 auth
-	protectedGroup := v1.Group("/protected")
-	protectedGroup.Use(gin.WrapH(nip98Middleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Convert back to Gin context
-		c, _ := gin.CreateTestContext(w)
-		c.Request = r
-		c.Next()
-	}))))
-	{
-		// Add NIP-98 protected endpoints here in the future
-	}
-
-	// Tracks endpoints
-	tracksGroup := v1.Group("/tracks")
-	{
-		// Public endpoints
-		tracksGroup.GET("/:id", tracksHandler.GetTrack)
-
-		// Webhook endpoint for processing notifications
-		tracksGroup.POST("/webhook/process", tracksHandler.ProcessTrackWebhook)
-
-		// NIP-98 authenticated endpoints with Firebase link guard
-		tracksGroup.POST("/nostr", gin.WrapH(nip98Middleware.SignatureValidationMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Convert to Gin and call handler
-			c, _ := gin.CreateTestContext(w)
-			c.Request = r
-			// Copy context values from NIP-98 middleware
-			if pubkey := r.Context().Value("pubkey"); pubkey != nil {
-				c.Set("pubkey", pubkey)
-			}
-			// Apply Firebase link guard
-			firebaseLinkGuard.Middleware()(c)
-			if c.IsAborted() {
-				return
-			}
-			tracksHandler.CreateTrackNostr(c)
-		}))))
-
-		tracksGroup.GET("/my", gin.WrapH(nip98Middleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			c, _ := gin.CreateTestContext(w)
-			c.Request = r
-			if pubkey := r.Context().Value("pubkey"); pubkey != nil {
-				c.Set("pubkey", pubkey)
-			}
-			if firebaseUID := r.Context().Value("firebase_uid"); firebaseUID != nil {
-				c.Set("firebase_uid", firebaseUID)
-			}
-			tracksHandler.GetMyTracks(c)
-		}))))
-
-		tracksGroup.DELETE("/:id", gin.WrapH(nip98Middleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			c, _ := gin.CreateTestContext(w)
-			c.Request = r
-			if pubkey := r.Context().Value("pubkey"); pubkey != nil {
-				c.Set("pubkey", pubkey)
-			}
-			if firebaseUID := r.Context().Value("firebase_uid"); firebaseUID != nil {
-				c.Set("firebase_uid", firebaseUID)
-			}
-			tracksHandler.DeleteTrack(c)
-		}))))
-
-		// Track status endpoint
-		tracksGroup.GET("/:id/status", gin.WrapH(nip98Middleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			c, _ := gin.CreateTestContext(w)
-			c.Request = r
-			if pubkey := r.Context().Value("pubkey"); pubkey != nil {
-				c.Set("pubkey", pubkey)
-			}
-			if firebaseUID := r.Context().Value("firebase_uid"); firebaseUID != nil {
-				c.Set("firebase_uid", firebaseUID)
-			}
-			tracksHandler.GetTrackStatus(c)
-		}))))
-
-		// Manual processing trigger
-		tracksGroup.POST("/:id/process", gin.WrapH(nip98Middleware.SignatureValidationMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			c, _ := gin.CreateTestContext(w)
-			c.Request = r
-			if pubkey := r.Context().Value("pubkey"); pubkey != nil {
-				c.Set("pubkey", pubkey)
-			}
-			// Apply Firebase link guard
-			firebaseLinkGuard.Middleware()(c)
-			if c.IsAborted() {
-				return
-			}
-			tracksHandler.TriggerProcessing(c)
-		}))))
-
-		// Compression management endpoints
-		tracksGroup.POST("/:id/compress", gin.WrapH(nip98Middleware.SignatureValidationMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			c, _ := gin.CreateTestContext(w)
-			c.Request = r
-			if pubkey := r.Context().Value("pubkey"); pubkey != nil {
-				c.Set("pubkey", pubkey)
-			}
-			// Apply Firebase link guard
-			firebaseLinkGuard.Middleware()(c)
-			if c.IsAborted() {
-				return
-			}
-			tracksHandler.RequestCompression(c)
-		}))))
-
-		tracksGroup.PUT("/:id/compression-visibility", gin.WrapH(nip98Middleware.SignatureValidationMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			c, _ := gin.CreateTestContext(w)
-			c.Request = r
-			if pubkey := r.Context().Value("pubkey"); pubkey != nil {
-				c.Set("pubkey", pubkey)
-			}
-			// Apply Firebase link guard
-			firebaseLinkGuard.Middleware()(c)
-			if c.IsAborted() {
-				return
-			}
-			tracksHandler.UpdateCompressionVisibility(c)
-		}))))
-
-		tracksGroup.GET("/:id/public-versions", gin.WrapH(nip98Middleware.SignatureValidationMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			c, _ := gin.CreateTestContext(w)
-			c.Request = r
-			if pubkey := r.Context().Value("pubkey"); pubkey != nil {
-				c.Set("pubkey", pubkey)
-			}
-			// Apply Firebase link guard
-			firebaseLinkGuard.Middleware()(c)
-			if c.IsAborted() {
-				return
-			}
-			tracksHandler.GetPublicVersions(c)
-		}))))
-	}
-
-	// Legacy endpoints (NIP-98 auth required, PostgreSQL-backed)
-	if legacyHandler != nil {
-		legacyGroup := v1.Group("/legacy")
-		{
-			legacyGroup.GET("/metadata", flexibleAuthMiddleware.Middleware(), legacyHandler.GetUserMetadata)
-
-			legacyGroup.GET("/tracks", flexibleAuthMiddleware.Middleware(), legacyHandler.GetUserTracks)
-
-			legacyGroup.GET("/artists", flexibleAuthMiddleware.Middleware(), legacyHandler.GetUserArtists)
-
-			legacyGroup.GET("/albums", flexibleAuthMiddleware.Middleware(), legacyHandler.GetUserAlbums)
-
-			legacyGroup.GET("/artists/:artist_id/tracks", flexibleAuthMiddleware.Middleware(), legacyHandler.GetTracksByArtist)
-
-			legacyGroup.GET("/albums/:album_id/tracks", flexibleAuthMiddleware.Middleware(), legacyHandler.GetTracksByAlbum)
-		}
-	}
-
 	// Start server
 	log.Printf("Starting server on port %s", port)
 	log.Printf("Endpoints available:")
-	log.Printf("  GET  /heartbeat")
+	log.Printf("  GET  /heartbeat (Build info and configuration)")
+	log.Printf("  GET  /livez (Liveness)")
+	log.Printf("  GET  /readyz (Readiness: Firestore, storage and PostgreSQL)")
+	if cfg.MetricsToken != "" {
+		log.Printf("  GET  /metrics (Prometheus metrics, METRICS_TOKEN bearer auth)")
+	}
+	log.Printf("  GET  /v1/openapi.json (OpenAPI spec of every endpoint)")
+	if gin.Mode() != gin.ReleaseMode {
+		log.Printf("  GET  /v1/docs (Swagger UI)")
+	}
 	log.Printf("  GET  /v1/auth/get-linked-pubkeys (Firebase auth)")
 	log.Printf("  POST /v1/auth/unlink-pubkey (Firebase auth)")
+	log.Printf("  GET  /v1/auth/pubkey-history (Firebase auth: Pubkey link/unlink history)")
 	log.Printf("  POST /v1/auth/link-pubkey (Dual auth: Firebase + NIP-98)")
 	log.Printf("  POST /v1/auth/check-pubkey-link (NIP-98 signature-only: Check own pubkey link status)")
+	log.Printf("  POST /v1/auth/check-pubkeys (Public, rate limited: Check which pubkeys are linked)")
 	log.Printf("  GET  /v1/tracks/:id (Public track info)")
 	log.Printf("  POST /v1/tracks/webhook/process (Processing webhook)")
+	if cfg.WebhookSecret == "" {
+		log.Printf("WARNING: WEBHOOK_SECRET is not set; processing webhooks are not authenticated")
+	} else if cfg.WebhookAcceptLegacySecret {
+		log.Printf("WARNING: WEBHOOK_ACCEPT_LEGACY_SECRET is set; unsigned webhooks carrying X-Webhook-Secret are accepted")
+	}
 	log.Printf("  POST /v1/tracks/nostr (NIP-98 auth: Create track)")
+	log.Printf("  POST /v1/tracks/import (NIP-98 auth: Import track from external URL)")
 	log.Printf("  GET  /v1/tracks/my (NIP-98 auth: Get my tracks)")
 	log.Printf("  DELETE /v1/tracks/:id (NIP-98 auth: Delete track)")
+	log.Printf("  POST /v1/tracks/:id/restore (NIP-98 auth: Restore deleted track)")
 	log.Printf("  GET  /v1/tracks/:id/status (NIP-98 auth: Get track status)")
+	log.Printf("  GET  /v1/tracks/:id/history (NIP-98 auth: Get track processing history)")
+	log.Printf("  GET  /v1/tracks/:id/events (NIP-98 auth: Stream track status events)")
+	log.Printf("  POST /v1/tracks/:id/share-links (NIP-98 auth: Create share link)")
+	log.Printf("  GET  /v1/tracks/:id/share-links (NIP-98 auth: List share links)")
+	log.Printf("  DELETE /v1/tracks/:id/share-links/:link_id (NIP-98 auth: Revoke share link)")
+	log.Printf("  GET  /v1/shared/:token (Share link: Get shared track with signed stream URLs)")
+	log.Printf("  GET  /v1/tracks/:id/original-download (NIP-98 auth: Get signed URL for the original upload)")
+	log.Printf("  POST /v1/tracks/:id/upload-url (NIP-98 auth: Renew the upload URL)")
 	log.Printf("  POST /v1/tracks/:id/process (NIP-98 auth: Trigger processing)")
+	log.Printf("  POST /v1/tracks/bulk-compress (NIP-98 auth: Request compression versions for many tracks)")
+	log.Printf("  GET  /v1/tracks/bulk-compress/:job_id (NIP-98 auth: Get bulk compression job status)")
 	log.Printf("  POST /v1/tracks/:id/compress (NIP-98 auth: Request compression versions)")
 	log.Printf("  PUT  /v1/tracks/:id/compression-visibility (NIP-98 auth: Update version visibility)")
 	log.Printf("  GET  /v1/tracks/:id/public-versions (NIP-98 auth: Get public versions for Nostr)")
+	log.Printf("  POST /v1/tracks/:id/published (NIP-98 auth: Record published Nostr event)")
+	log.Printf("  PUT /v1/tracks/:id/nostr-ref (NIP-98 auth: Record published Nostr event reference)")
+	log.Printf("  POST /v1/tracks/:id/publish (NIP-98 auth: Publish a signed Nostr event to the configured relays)")
+	log.Printf("  GET  /v1/search/tracks (Public track search by title or artist)")
+	log.Printf("  GET  /v1/feeds/pubkey/:pubkey.xml (Public RSS feed of a pubkey's tracks)")
+	log.Printf("  GET  /v1/notifications (Flexible auth: Get notification feed)")
+	log.Printf("  POST /v1/notifications/:id/read (Flexible auth: Mark notification read)")
+	log.Printf("  GET  /v1/users/me (Flexible auth: Get account overview)")
+	log.Printf("  PATCH /v1/users/me (Firebase auth: Update profile fields)")
+	log.Printf("  DELETE /v1/users/me (Firebase auth: Delete account, confirmed with a code)")
+	log.Printf("  GET  /v1/users/me/usage (Flexible auth: Get track and storage usage)")
+	log.Printf("  GET  /v1/users/me/export (Flexible auth: Export all track data)")
+	log.Printf("  GET  /v1/users/me/export/:job_id (Flexible auth: Get export job status)")
+	log.Printf("  POST /v1/webhooks (NIP-98 auth: Register webhook)")
+	log.Printf("  GET  /v1/webhooks (NIP-98 auth: List webhooks)")
+	log.Printf("  DELETE /v1/webhooks/:id (NIP-98 auth: Delete webhook)")
+	log.Printf("  POST /v1/webhooks/:id/test (NIP-98 auth: Send test event)")
+	log.Printf("  GET  /v1/admin/tracks?pubkey= (Firebase admin claim: List a user's tracks, deleted included)")
+	log.Printf("  POST /v1/admin/tracks/:id/reprocess (Firebase admin claim: Force processing)")
+	log.Printf("  POST /v1/admin/processing/reconcile (Firebase admin claim: Repair tracks stuck processing)")
+	log.Printf("  GET  /v1/admin/pubkey-history (Firebase admin claim: Link/unlink history of a pubkey)")
+
+	if devFilesHandler != nil {
+		log.Printf("  GET  /v1/dev/files/*path (Local storage: Read an object)")
+		log.Printf("  PUT  /v1/dev/files/*path (Local storage: Upload to a signed URL)")
+	}
 
 	if legacyHandler != nil {
 		log.Printf("  GET  /v1/legacy/metadata (Flexible auth: Get all user metadata from legacy system)")
@@ -393,6 +432,8 @@ func main() {
 		log.Printf("  GET  /v1/legacy/albums (Flexible auth: Get user albums from legacy system)")
 		log.Printf("  GET  /v1/legacy/artists/:artist_id/tracks (Flexible auth: Get tracks by artist)")
 		log.Printf("  GET  /v1/legacy/albums/:album_id/tracks (Flexible auth: Get tracks by album)")
+		log.Printf("  GET  /v1/legacy/search (Flexible auth: Search user catalog in legacy system)")
+		log.Printf("  GET  /v1/legacy/earnings (Flexible auth: Get earnings totals from legacy system)")
 	}
 
 	go func() {
@@ -412,5 +453,10 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	// Flush spans that haven't been exported yet
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
+
 	log.Println("Server shutdown complete")
 }
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/auth"
+	"github.com/wavlake/api/internal/bodylimit"
+	"github.com/wavlake/api/internal/handlers"
+	"github.com/wavlake/api/internal/logging"
+	"github.com/wavlake/api/internal/ratelimit"
+	"github.com/wavlake/api/internal/recovery"
+	"github.com/wavlake/api/internal/telemetry"
+)
+
+// routerDeps holds the handlers and middleware the HTTP routes are wired to.
+// legacyHandler is nil when PostgreSQL isn't configured, devFilesHandler is
+// nil unless STORAGE_PROVIDER=local, metricsHandler nil or an empty
+// metricsToken leaves out /metrics, and a nil rateLimiter leaves every route
+// unthrottled.
+type routerDeps struct {
+	corsOrigins []string
+
+	// buildInfo is reported by /heartbeat
+	buildInfo handlers.BuildInfo
+
+	// docsUI serves Swagger UI at /v1/docs; the spec is always served
+	docsUI bool
+
+	// legacyErrorEnvelope renders errors in the envelope from before
+	// apierror, see config.Config.LegacyErrorEnvelope
+	legacyErrorEnvelope bool
+
+	// panicAlerter is told of panics recovered in handlers; nil only logs them
+	panicAlerter recovery.Alerter
+
+	rateLimiter       ratelimit.Limiter
+	trackCreateLimit  ratelimit.Limit
+	compressionLimit  ratelimit.Limit
+	processingLimit   ratelimit.Limit
+	pubkeyLookupLimit ratelimit.Limit
+
+	authHandlers           *handlers.AuthHandlers
+	tracksHandler          *handlers.TracksHandler
+	bulkCompressionHandler *handlers.BulkCompressionHandler
+	notificationsHandler   *handlers.NotificationsHandler
+	searchHandler          *handlers.SearchHandler
+	feedsHandler           *handlers.FeedsHandler
+	exportHandler          *handlers.ExportHandler
+	accountDeletionHandler *handlers.AccountDeletionHandler
+	trackImportHandler     *handlers.TrackImportHandler
+	usersHandler           *handlers.UsersHandler
+	userWebhooksHandler    *handlers.UserWebhooksHandler
+	legacyHandler          *handlers.LegacyHandler
+	adminHandler           *handlers.AdminHandler
+	healthHandler          *handlers.HealthHandler
+	devFilesHandler        *handlers.DevFilesHandler
+	metricsHandler         http.Handler
+
+	// metricsToken is the bearer token /metrics requires
+	metricsToken string
+
+	firebaseMiddleware     *auth.FirebaseMiddleware
+	dualAuthMiddleware     *auth.DualAuthMiddleware
+	firebaseLinkGuard      *auth.FirebaseLinkGuard
+	nip98Middleware        *auth.NIP98Middleware
+	flexibleAuthMiddleware *auth.FlexibleAuthMiddleware
+}
+
+// Request body limits. Auth bodies are at most a list of pubkeys; the rest
+// carry signed Nostr events or, for bulk compression, up to 500 track IDs.
+// Processing webhooks get room for version reports and error messages.
+const (
+	authBodyLimit    = 16 << 10
+	jsonBodyLimit    = 64 << 10
+	webhookBodyLimit = 1 << 20
+)
+
+// newRouter builds the Gin engine with every API route
+func newRouter(deps routerDeps) *gin.Engine {
+	router := gin.New()
+	router.Use(logging.Middleware())
+	router.Use(apierror.Middleware(deps.legacyErrorEnvelope))
+	router.Use(recovery.Middleware(deps.panicAlerter))
+	router.NoRoute(func(c *gin.Context) {
+		apierror.Respond(c, apierror.NotFound("route not found"))
+	})
+
+	// Configure CORS; origins were validated by config.Load
+	config := cors.DefaultConfig()
+	config.AllowOrigins = deps.corsOrigins
+	config.AllowWildcard = true
+	config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	config.AllowHeaders = []string{
+		"Origin",
+		"Content-Type",
+		"Accept",
+		"Authorization",
+		"X-Nostr-Authorization",
+		"X-Requested-With",
+		"x-firebase-token",
+		"X-Firebase-Token",
+		logging.RequestIDHeader,
+	}
+	config.ExposeHeaders = []string{logging.RequestIDHeader}
+	config.AllowCredentials = true
+	router.Use(cors.New(config))
+
+	// Heartbeat endpoint (no auth required)
+	router.GET("/heartbeat", gin.WrapF(handlers.Heartbeat(deps.buildInfo)))
+
+	// Liveness and readiness probes (no auth required)
+	router.GET("/livez", deps.healthHandler.Livez)
+	router.GET("/readyz", deps.healthHandler.Readyz)
+
+	// Prometheus metrics, for scrapers holding the metrics token
+	if deps.metricsHandler != nil && deps.metricsToken != "" {
+		router.GET("/metrics", auth.RequireStaticToken(deps.metricsToken), gin.WrapH(deps.metricsHandler))
+	}
+
+	// Every API route is traced; probes and metrics would only be noise
+	v1 := router.Group("/v1", telemetry.Middleware())
+
+	// OpenAPI spec of every route, built once they're all registered below
+	var openAPI *handlers.OpenAPIHandler
+	v1.GET("/openapi.json", func(c *gin.Context) { openAPI.Spec(c) })
+	if deps.docsUI {
+		v1.GET("/docs", func(c *gin.Context) { openAPI.SwaggerUI(c) })
+	}
+
+	// Auth endpoints
+	authGroup := v1.Group("/auth", bodylimit.Middleware(authBodyLimit))
+	{
+		// Firebase auth only endpoints
+		authGroup.GET("/get-linked-pubkeys", deps.firebaseMiddleware.Middleware(), deps.authHandlers.GetLinkedPubkeys)
+		authGroup.POST("/unlink-pubkey", deps.firebaseMiddleware.Middleware(), deps.authHandlers.UnlinkPubkey)
+		authGroup.GET("/pubkey-history", deps.firebaseMiddleware.Middleware(), deps.authHandlers.GetPubkeyHistory)
+
+		// Dual auth required endpoint
+		authGroup.POST("/link-pubkey", deps.dualAuthMiddleware.Middleware(), deps.authHandlers.LinkPubkey)
+
+		// NIP-98 signature validation only endpoint (no database lookup required)
+		authGroup.POST("/check-pubkey-link", deps.nip98Middleware.GinSignatureMiddleware(), deps.authHandlers.CheckPubkeyLink)
+
+		// Public, limited per IP; answers only whether each pubkey is linked
+		authGroup.POST("/check-pubkeys", ratelimit.Middleware(deps.rateLimiter, "pubkey_lookup", deps.pubkeyLookupLimit), deps.authHandlers.CheckPubkeys)
+	}
+
+	// nip98Auth runs full NIP-98 authentication (signature + linked account).
+	// nip98Linked runs a handler after signature validation and the Firebase
+	// link guard, for routes that change data. nip98Limited does the same
+	// with a rate limit checked before the link guard's Firestore lookup.
+	nip98Auth := deps.nip98Middleware.GinMiddleware()
+	nip98Signature := deps.nip98Middleware.GinSignatureMiddleware()
+	linkGuard := deps.firebaseLinkGuard.Middleware()
+	nip98Linked := func(handler gin.HandlerFunc) []gin.HandlerFunc {
+		return []gin.HandlerFunc{nip98Signature, linkGuard, handler}
+	}
+	nip98Limited := func(name string, limit ratelimit.Limit, handler gin.HandlerFunc) []gin.HandlerFunc {
+		return []gin.HandlerFunc{nip98Signature, ratelimit.Middleware(deps.rateLimiter, name, limit), linkGuard, handler}
+	}
+	createLimited := func(handler gin.HandlerFunc) []gin.HandlerFunc {
+		return nip98Limited("track_create", deps.trackCreateLimit, handler)
+	}
+	compressionLimited := func(handler gin.HandlerFunc) []gin.HandlerFunc {
+		return nip98Limited("compression", deps.compressionLimit, handler)
+	}
+
+	// Protected endpoints that require NIP-98 auth
+	protectedGroup := v1.Group("/protected")
+	protectedGroup.Use(nip98Auth)
+	{
+		// Add NIP-98 protected endpoints here in the future
+	}
+
+	// Tracks endpoints
+	jsonLimit := bodylimit.Middleware(jsonBodyLimit)
+	tracksGroup := v1.Group("/tracks", jsonLimit)
+	{
+		// Public endpoints
+		tracksGroup.GET("/:id", deps.tracksHandler.GetTrack)
+
+		// Webhook endpoint for processing notifications
+		tracksGroup.POST("/webhook/process", bodylimit.Middleware(webhookBodyLimit), deps.tracksHandler.ProcessTrackWebhook)
+
+		// NIP-98 authenticated endpoints with Firebase link guard
+		tracksGroup.POST("/nostr", createLimited(deps.tracksHandler.CreateTrackNostr)...)
+		tracksGroup.POST("/import", createLimited(deps.trackImportHandler.ImportTrack)...)
+
+		tracksGroup.GET("/my", nip98Auth, deps.tracksHandler.GetMyTracks)
+		tracksGroup.DELETE("/:id", nip98Auth, deps.tracksHandler.DeleteTrack)
+		tracksGroup.POST("/:id/restore", nip98Auth, deps.tracksHandler.RestoreTrack)
+
+		// Track status endpoint
+		tracksGroup.GET("/:id/status", nip98Auth, deps.tracksHandler.GetTrackStatus)
+
+		// Processing history
+		tracksGroup.GET("/:id/history", nip98Auth, deps.tracksHandler.GetTrackHistory)
+
+		// Live status stream (Server-Sent Events)
+		tracksGroup.GET("/:id/events", nip98Auth, deps.tracksHandler.StreamTrackEvents)
+
+		// Unlisted share links
+		tracksGroup.POST("/:id/share-links", nip98Linked(deps.tracksHandler.CreateShareLink)...)
+		tracksGroup.GET("/:id/share-links", nip98Auth, deps.tracksHandler.ListShareLinks)
+		tracksGroup.DELETE("/:id/share-links/:link_id", nip98Auth, deps.tracksHandler.RevokeShareLink)
+
+		// Signed download of the original upload
+		tracksGroup.GET("/:id/original-download", nip98Auth, deps.tracksHandler.GetOriginalDownload)
+
+		// Manual processing trigger
+		tracksGroup.POST("/:id/upload-url", nip98Linked(deps.tracksHandler.RenewUploadURL)...)
+		tracksGroup.POST("/:id/process", nip98Limited("processing", deps.processingLimit, deps.tracksHandler.TriggerProcessing)...)
+
+		// Compression management endpoints
+		tracksGroup.POST("/bulk-compress", compressionLimited(deps.bulkCompressionHandler.BulkCompress)...)
+		tracksGroup.GET("/bulk-compress/:job_id", nip98Auth, deps.bulkCompressionHandler.GetBulkCompressionJob)
+		tracksGroup.POST("/:id/compress", compressionLimited(deps.tracksHandler.RequestCompression)...)
+		tracksGroup.PUT("/:id/compression-visibility", nip98Linked(deps.tracksHandler.UpdateCompressionVisibility)...)
+		tracksGroup.GET("/:id/public-versions", nip98Linked(deps.tracksHandler.GetPublicVersions)...)
+		tracksGroup.GET("/:id/nostr-event", nip98Linked(deps.tracksHandler.GetNostrEvent)...)
+		tracksGroup.POST("/:id/published", nip98Linked(deps.tracksHandler.RecordPublication)...)
+		tracksGroup.PUT("/:id/nostr-ref", nip98Linked(deps.tracksHandler.UpdateNostrRef)...)
+		tracksGroup.POST("/:id/publish", nip98Linked(deps.tracksHandler.PublishTrack)...)
+	}
+
+	// Share link access (the token is the credential)
+	v1.GET("/shared/:token", deps.tracksHandler.GetSharedTrack)
+
+	// Listener search (no auth)
+	searchGroup := v1.Group("/search")
+	{
+		searchGroup.GET("/tracks", deps.searchHandler.SearchTracks)
+	}
+
+	// RSS feeds for podcast apps (no auth); :file is <pubkey>.xml
+	feedsGroup := v1.Group("/feeds")
+	{
+		feedsGroup.GET("/pubkey/:file", deps.feedsHandler.GetPubkeyFeed)
+	}
+
+	// Notification feed (Firebase or NIP-98 auth)
+	notificationsGroup := v1.Group("/notifications", jsonLimit)
+	{
+		notificationsGroup.GET("", deps.flexibleAuthMiddleware.Middleware(), deps.notificationsHandler.GetNotifications)
+		notificationsGroup.POST("/:id/read", deps.flexibleAuthMiddleware.Middleware(), deps.notificationsHandler.MarkNotificationRead)
+	}
+
+	// User account endpoints (Firebase or NIP-98 auth)
+	usersGroup := v1.Group("/users", jsonLimit)
+	{
+		usersGroup.GET("/me", deps.flexibleAuthMiddleware.Middleware(), deps.usersHandler.GetMe)
+		// Profile changes need the Firebase account itself
+		usersGroup.PATCH("/me", deps.firebaseMiddleware.Middleware(), deps.usersHandler.UpdateMe)
+		usersGroup.DELETE("/me", deps.firebaseMiddleware.Middleware(), deps.accountDeletionHandler.DeleteAccount)
+		usersGroup.GET("/me/usage", deps.flexibleAuthMiddleware.Middleware(), deps.usersHandler.GetUsage)
+		usersGroup.GET("/me/export", deps.flexibleAuthMiddleware.Middleware(), deps.exportHandler.ExportUserData)
+		usersGroup.GET("/me/export/:job_id", deps.flexibleAuthMiddleware.Middleware(), deps.exportHandler.GetExportJob)
+	}
+
+	// User-configured webhooks (NIP-98 auth)
+	webhooksGroup := v1.Group("/webhooks", jsonLimit)
+	webhooksGroup.Use(nip98Auth)
+	{
+		webhooksGroup.POST("", deps.userWebhooksHandler.CreateWebhook)
+		webhooksGroup.GET("", deps.userWebhooksHandler.ListWebhooks)
+		webhooksGroup.DELETE("/:id", deps.userWebhooksHandler.DeleteWebhook)
+		webhooksGroup.POST("/:id/test", deps.userWebhooksHandler.TestWebhook)
+	}
+
+	// Internal tooling (Firebase auth with the admin custom claim)
+	adminGroup := v1.Group("/admin", jsonLimit)
+	adminGroup.Use(deps.firebaseMiddleware.Middleware(), auth.RequireAdmin())
+	{
+		adminGroup.GET("/tracks", deps.adminHandler.ListTracks)
+		adminGroup.POST("/tracks/:id/reprocess", deps.adminHandler.ReprocessTrack)
+		adminGroup.POST("/processing/reconcile", deps.adminHandler.ReconcileProcessing)
+		adminGroup.GET("/pubkey-history", deps.authHandlers.GetPubkeyHistoryByPubkey)
+	}
+
+	// Local storage objects and uploads (signed URLs are the credential)
+	if deps.devFilesHandler != nil {
+		devGroup := v1.Group("/dev")
+		{
+			devGroup.GET("/files/*path", deps.devFilesHandler.GetFile)
+			devGroup.HEAD("/files/*path", deps.devFilesHandler.GetFile)
+			devGroup.PUT("/files/*path", deps.devFilesHandler.PutFile)
+		}
+	}
+
+	// Legacy endpoints (NIP-98 auth required, PostgreSQL-backed)
+	if deps.legacyHandler != nil {
+		legacyGroup := v1.Group("/legacy")
+		{
+			legacyGroup.GET("/metadata", deps.flexibleAuthMiddleware.Middleware(), deps.legacyHandler.GetUserMetadata)
+
+			legacyGroup.GET("/tracks", deps.flexibleAuthMiddleware.Middleware(), deps.legacyHandler.GetUserTracks)
+
+			legacyGroup.GET("/artists", deps.flexibleAuthMiddleware.Middleware(), deps.legacyHandler.GetUserArtists)
+
+			legacyGroup.GET("/albums", deps.flexibleAuthMiddleware.Middleware(), deps.legacyHandler.GetUserAlbums)
+
+			legacyGroup.GET("/artists/:artist_id/tracks", deps.flexibleAuthMiddleware.Middleware(), deps.legacyHandler.GetTracksByArtist)
+
+			legacyGroup.GET("/albums/:album_id/tracks", deps.flexibleAuthMiddleware.Middleware(), deps.legacyHandler.GetTracksByAlbum)
+
+			legacyGroup.GET("/search", deps.flexibleAuthMiddleware.Middleware(), deps.legacyHandler.SearchCatalog)
+
+			legacyGroup.GET("/earnings", deps.flexibleAuthMiddleware.Middleware(), deps.legacyHandler.GetUserEarnings)
+		}
+	}
+
+	registry := handlers.NewOpenAPIRegistry()
+	handlers.RegisterOperations(registry)
+	openAPI = handlers.NewOpenAPIHandler(registry, router.Routes())
+
+	return router
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/config"
+	"github.com/wavlake/api/internal/handlers"
+	"github.com/wavlake/api/internal/logging"
+	"github.com/wavlake/api/internal/recovery"
+)
+
+// everyRoute is a router with every optional group enabled. Handlers are
+// never called, so they can be nil.
+func everyRoute(t *testing.T, docsUI bool) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	return newRouter(routerDeps{
+		corsOrigins:     config.DefaultCORSOrigins,
+		docsUI:          docsUI,
+		legacyHandler:   &handlers.LegacyHandler{},
+		devFilesHandler: &handlers.DevFilesHandler{},
+		metricsHandler:  http.NotFoundHandler(),
+		metricsToken:    "test-metrics-token",
+	})
+}
+
+func TestRoutesRegistered(t *testing.T) {
+	registry := handlers.NewOpenAPIRegistry()
+	handlers.RegisterOperations(registry)
+
+	routes := map[string]bool{}
+	for _, route := range everyRoute(t, true).Routes() {
+		routes[route.Method+" "+route.Path] = true
+		assert.True(t, registry.Has(route.Method, route.Path),
+			"%s %s is missing from handlers.RegisterOperations", route.Method, route.Path)
+	}
+	for _, route := range registry.Routes() {
+		assert.True(t, routes[route], "%s is registered but not routed", route)
+	}
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	router := everyRoute(t, false)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/openapi.json", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var spec struct {
+		Paths map[string]map[string]interface{} `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &spec))
+	assert.Contains(t, spec.Paths["/v1/tracks/{id}"], "get")
+	assert.NotContains(t, spec.Paths, "/v1/docs", "routes left out aren't documented")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/docs", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code, "the UI is off in release mode")
+
+	w = httptest.NewRecorder()
+	everyRoute(t, true).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/docs", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "/v1/openapi.json")
+}
+
+// alertRecorder hands each panic alert to the test
+type alertRecorder chan recovery.Report
+
+func (a alertRecorder) Alert(ctx context.Context, report recovery.Report) error {
+	a <- report
+	return nil
+}
+
+func TestRouterRecoversPanics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	alerts := make(alertRecorder, 1)
+	// Without a tracks handler, GET /v1/tracks/:id dereferences nil
+	router := newRouter(routerDeps{corsOrigins: config.DefaultCORSOrigins, panicAlerter: alerts})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/tracks/track-123", nil)
+	req.Header.Set(logging.RequestIDHeader, "req-panic")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"success":false,"error":{"code":"internal_error","message":"internal error"},"request_id":"req-panic"}`, w.Body.String())
+	select {
+	case report := <-alerts:
+		assert.Equal(t, "GET /v1/tracks/:id", report.Route)
+		assert.Equal(t, "req-panic", report.RequestID)
+	case <-time.After(time.Second):
+		t.Fatal("panic wasn't alerted")
+	}
+}
@@ -0,0 +1,229 @@
+// Package apierror defines the errors the API responds with and renders them
+// in one JSON envelope:
+//
+//	{"success": false, "error": {"code": "track.not_found", "message": "track not found"}, "request_id": "..."}
+//
+// Codes are stable and meant for clients to branch on; messages may change.
+package apierror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/logging"
+)
+
+// Codes for errors that don't have a more specific one
+const (
+	CodeValidation   = "invalid_request"
+	CodeUnauthorized = "unauthorized"
+	CodeForbidden    = "forbidden"
+	CodeNotFound     = "not_found"
+	CodeConflict     = "conflict"
+	CodeRateLimited  = "rate_limited"
+	CodeInternal     = "internal_error"
+)
+
+// Error is an error with the status, code and message it's rendered with.
+// Details, if set, is rendered alongside them; Err is the cause, which is
+// logged but never sent.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Details interface{}
+	Err     error
+}
+
+// Kinds of error. errors.Is matches any *Error against the kind with its
+// status, so errors.Is(err, apierror.ErrNotFound) holds for every 404.
+var (
+	ErrValidation   = &Error{Status: http.StatusBadRequest, Code: CodeValidation, Message: "invalid request"}
+	ErrUnauthorized = &Error{Status: http.StatusUnauthorized, Code: CodeUnauthorized, Message: "authentication required"}
+	ErrForbidden    = &Error{Status: http.StatusForbidden, Code: CodeForbidden, Message: "forbidden"}
+	ErrNotFound     = &Error{Status: http.StatusNotFound, Code: CodeNotFound, Message: "not found"}
+	ErrConflict     = &Error{Status: http.StatusConflict, Code: CodeConflict, Message: "conflict"}
+	ErrInternal     = &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "internal error"}
+)
+
+var kinds = []*Error{ErrValidation, ErrUnauthorized, ErrForbidden, ErrNotFound, ErrConflict, ErrInternal}
+
+// New returns an error rendered with status, code and message
+func New(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// Validation is a 400 for a request that's malformed or fails validation
+func Validation(message string) *Error {
+	return New(http.StatusBadRequest, CodeValidation, message)
+}
+
+// Unauthorized is a 401 for a request without valid credentials
+func Unauthorized(message string) *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized, message)
+}
+
+// Forbidden is a 403 for a caller who may not do what they asked
+func Forbidden(message string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, message)
+}
+
+// NotFound is a 404
+func NotFound(message string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, message)
+}
+
+// Conflict is a 409 for a request the resource's current state rules out
+func Conflict(message string) *Error {
+	return New(http.StatusConflict, CodeConflict, message)
+}
+
+// Internal is a 500. Its message is sent, so it shouldn't say more than what
+// failed.
+func Internal(message string) *Error {
+	return New(http.StatusInternalServerError, CodeInternal, message)
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the kind with e's status, and any *Error with e's status and
+// code, so a copy made by the With methods still matches what it was made from
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok || t.Status != e.Status {
+		return false
+	}
+	for _, kind := range kinds {
+		if t == kind {
+			return true
+		}
+	}
+	return t.Code == e.Code
+}
+
+// WithCode returns a copy of e with code
+func (e *Error) WithCode(code string) *Error {
+	copied := *e
+	copied.Code = code
+	return &copied
+}
+
+// WithMessage returns a copy of e with message, keeping its code
+func (e *Error) WithMessage(message string) *Error {
+	copied := *e
+	copied.Message = message
+	return &copied
+}
+
+// WithDetails returns a copy of e rendered with details
+func (e *Error) WithDetails(details interface{}) *Error {
+	copied := *e
+	copied.Details = details
+	return &copied
+}
+
+// WithCause returns a copy of e wrapping err; errors.Is and errors.As see
+// both
+func (e *Error) WithCause(err error) *Error {
+	copied := *e
+	copied.Err = err
+	return &copied
+}
+
+// From returns the *Error in err's chain. Anything else is a 500 whose text
+// is kept out of the response.
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return ErrInternal.WithCause(err)
+}
+
+// body is the envelope for err
+type body struct {
+	Success   bool       `json:"success"`
+	Error     errorField `json:"error"`
+	RequestID string     `json:"request_id,omitempty"`
+}
+
+type errorField struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// legacyBody is the envelope for clients written before codes existed: the
+// message is the error field itself
+type legacyBody struct {
+	Success   bool        `json:"success"`
+	Error     string      `json:"error"`
+	Code      string      `json:"code"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+func render(ctx context.Context, e *Error) interface{} {
+	requestID := logging.RequestIDFromContext(ctx)
+	if legacyFromContext(ctx) {
+		return legacyBody{Error: e.Message, Code: e.Code, Details: e.Details, RequestID: requestID}
+	}
+	return body{
+		Error:     errorField{Code: e.Code, Message: e.Message, Details: e.Details},
+		RequestID: requestID,
+	}
+}
+
+// Respond writes err and aborts the handler chain. Errors that aren't an
+// *Error are logged and rendered as ErrInternal.
+func Respond(c *gin.Context, err error) {
+	apiErr := From(err)
+	if apiErr.Status >= http.StatusInternalServerError && apiErr.Err != nil {
+		log.Printf("%s %s: %v", c.Request.Method, c.Request.URL.Path, apiErr.Err)
+	}
+	c.AbortWithStatusJSON(apiErr.Status, render(c.Request.Context(), apiErr))
+}
+
+// Write is Respond for plain net/http handlers
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr := From(err)
+	if apiErr.Status >= http.StatusInternalServerError && apiErr.Err != nil {
+		log.Printf("%s %s: %v", r.Method, r.URL.Path, apiErr.Err)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(apiErr.Status)
+	json.NewEncoder(w).Encode(render(r.Context(), apiErr))
+}
+
+type legacyContextKey struct{}
+
+func legacyFromContext(ctx context.Context) bool {
+	legacy, _ := ctx.Value(legacyContextKey{}).(bool)
+	return legacy
+}
+
+// Middleware sets the envelope errors are rendered in for the rest of the
+// chain. legacy renders {"success": false, "error": "<message>", "code":
+// "<code>"} for clients that read error as a string.
+func Middleware(legacy bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if legacy {
+			c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), legacyContextKey{}, true))
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,120 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/logging"
+)
+
+var errTrackNotFound = New(http.StatusNotFound, "track.not_found", "track not found")
+
+func TestIs(t *testing.T) {
+	withMessage := errTrackNotFound.WithMessage("track abc not found")
+	wrapped := fmt.Errorf("lookup: %w", withMessage)
+
+	assert.True(t, errors.Is(wrapped, errTrackNotFound))
+	assert.True(t, errors.Is(wrapped, ErrNotFound), "every 404 is ErrNotFound")
+	assert.False(t, errors.Is(wrapped, ErrConflict))
+	assert.False(t, errors.Is(wrapped, NotFound("other")), "a different code doesn't match")
+	assert.False(t, errors.Is(NotFound("other"), errTrackNotFound))
+
+	cause := errors.New("rpc error: NotFound")
+	assert.True(t, errors.Is(errTrackNotFound.WithCause(cause), cause))
+	assert.True(t, errors.Is(errTrackNotFound.WithCause(cause), errTrackNotFound))
+}
+
+func TestFrom(t *testing.T) {
+	assert.Same(t, errTrackNotFound, From(fmt.Errorf("wrapped: %w", errTrackNotFound)))
+
+	cause := errors.New("connection refused")
+	internal := From(cause)
+	assert.Equal(t, http.StatusInternalServerError, internal.Status)
+	assert.Equal(t, CodeInternal, internal.Code)
+	assert.Equal(t, ErrInternal.Message, internal.Message)
+	assert.Same(t, cause, internal.Err)
+}
+
+func TestWithLeavesOriginal(t *testing.T) {
+	_ = errTrackNotFound.WithMessage("changed").WithCode("changed").WithDetails("changed")
+	assert.Equal(t, "track not found", errTrackNotFound.Message)
+	assert.Equal(t, "track.not_found", errTrackNotFound.Code)
+	assert.Nil(t, errTrackNotFound.Details)
+}
+
+// respond runs err through Respond behind Middleware(legacy) and decodes the body
+func respond(t *testing.T, legacy bool, err error) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), "req-1"))
+	}, Middleware(legacy))
+	router.GET("/", func(c *gin.Context) {
+		Respond(c, err)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return w, body
+}
+
+func TestRespond(t *testing.T) {
+	w, body := respond(t, false, errTrackNotFound.WithDetails(map[string]string{"id": "abc"}))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, map[string]interface{}{
+		"success": false,
+		"error": map[string]interface{}{
+			"code":    "track.not_found",
+			"message": "track not found",
+			"details": map[string]interface{}{"id": "abc"},
+		},
+		"request_id": "req-1",
+	}, body)
+}
+
+func TestRespondLegacy(t *testing.T) {
+	w, body := respond(t, true, errTrackNotFound)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, map[string]interface{}{
+		"success":    false,
+		"error":      "track not found",
+		"code":       "track.not_found",
+		"request_id": "req-1",
+	}, body)
+}
+
+func TestRespondHidesCause(t *testing.T) {
+	w, body := respond(t, false, errors.New("pq: password authentication failed"))
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NotContains(t, w.Body.String(), "password")
+	assert.Equal(t, map[string]interface{}{"code": CodeInternal, "message": ErrInternal.Message}, body["error"])
+
+	w, _ = respond(t, false, Internal("failed to save track").WithCause(errors.New("deadline exceeded")))
+	assert.Contains(t, w.Body.String(), "failed to save track")
+	assert.NotContains(t, w.Body.String(), "deadline")
+}
+
+func TestWrite(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/heartbeat", nil)
+	req = req.WithContext(logging.WithRequestID(req.Context(), "req-2"))
+	w := httptest.NewRecorder()
+
+	Write(w, req, New(http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed"))
+
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"success":false,"error":{"code":"method_not_allowed","message":"method not allowed"},"request_id":"req-2"}`, w.Body.String())
+}
@@ -2,32 +2,40 @@ package auth
 
 import (
 	"context"
-	"encoding/base64"
-	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"strings"
 	"time"
 
 	"firebase.google.com/go/v4/auth"
 	"github.com/gin-gonic/gin"
-	gonostr "github.com/nbd-wtf/go-nostr"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/logging"
 	"github.com/wavlake/api/pkg/nostr"
 )
 
 type DualAuthMiddleware struct {
-	firebaseAuth *auth.Client
+	firebaseAuth       *auth.Client
+	timestampTolerance time.Duration
 }
 
-func NewDualAuthMiddleware(firebaseAuth *auth.Client) *DualAuthMiddleware {
+// NewDualAuthMiddleware creates the middleware. timestampTolerance is how far
+// a NIP-98 event's created_at may be from the server's clock; zero uses
+// DefaultTimestampTolerance.
+func NewDualAuthMiddleware(firebaseAuth *auth.Client, timestampTolerance time.Duration) *DualAuthMiddleware {
 	return &DualAuthMiddleware{
-		firebaseAuth: firebaseAuth,
+		firebaseAuth:       firebaseAuth,
+		timestampTolerance: timestampTolerance,
 	}
 }
 
 func (m *DualAuthMiddleware) Middleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if err := readPayload(c.Request); err != nil {
+			apierror.Respond(c, err)
+			return
+		}
+
 		// 1. Validate Firebase token
 		firebaseToken := extractBearerToken(c.GetHeader("Authorization"))
 		if firebaseToken == "" {
@@ -35,23 +43,20 @@ func (m *DualAuthMiddleware) Middleware() gin.HandlerFunc {
 			firebaseToken = c.GetHeader("X-Firebase-Token")
 		}
 		if firebaseToken == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing Firebase authorization token"})
-			c.Abort()
+			apierror.Respond(c, apierror.Unauthorized("Missing Firebase authorization token"))
 			return
 		}
 
 		firebaseUser, err := m.firebaseAuth.VerifyIDToken(context.Background(), firebaseToken)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Firebase token"})
-			c.Abort()
+			apierror.Respond(c, apierror.Unauthorized("Invalid Firebase token"))
 			return
 		}
 
 		// 2. Validate NIP-98 signature
 		nip98Event, err := m.validateNIP98(c.Request)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("Invalid NIP-98 signature: %v", err)})
-			c.Abort()
+			apierror.Respond(c, apierror.Unauthorized(fmt.Sprintf("Invalid NIP-98 signature: %v", err)))
 			return
 		}
 
@@ -83,41 +88,23 @@ func (m *DualAuthMiddleware) validateNIP98(r *http.Request) (*nostr.Event, error
 		return nil, fmt.Errorf("invalid Nostr authorization scheme")
 	}
 
-	encodedEvent := strings.TrimPrefix(nostrHeader, "Nostr ")
-	eventData, err := base64.StdEncoding.DecodeString(encodedEvent)
+	event, err := decodeNIP98Event(strings.TrimPrefix(nostrHeader, "Nostr "))
 	if err != nil {
-		return nil, fmt.Errorf("invalid base64 encoding: %w", err)
-	}
-
-	var gonostrEvent gonostr.Event
-	if err := json.Unmarshal(eventData, &gonostrEvent); err != nil {
-		return nil, fmt.Errorf("invalid event JSON: %w", err)
+		return nil, err
 	}
 
-	event := &nostr.Event{Event: &gonostrEvent}
-
 	// Validate NIP-98 requirements
-	if event.Kind != 27235 {
+	if event.Kind != nostr.KindHTTPAuth {
 		return nil, fmt.Errorf("invalid event kind: expected 27235, got %d", event.Kind)
 	}
 
-	now := time.Now().Unix()
-	createdAt := int64(event.CreatedAt)
-	if now-createdAt > 60 || createdAt > now+60 {
+	if !withinTolerance(int64(event.CreatedAt), time.Now(), m.timestampTolerance) {
 		return nil, fmt.Errorf("event timestamp out of range")
 	}
 
-	var urlTag, methodTag string
-	for _, tag := range event.Tags {
-		if len(tag) >= 2 {
-			switch tag[0] {
-			case "u":
-				urlTag = tag[1]
-			case "method":
-				methodTag = tag[1]
-			}
-		}
-	}
+	urlTag, _ := event.GetTagValue("u")
+	methodTag, _ := event.GetTagValue("method")
+	payloadTag, _ := event.GetTagValue("payload")
 
 	scheme := "http"
 	if r.TLS != nil {
@@ -129,20 +116,21 @@ func (m *DualAuthMiddleware) validateNIP98(r *http.Request) (*nostr.Event, error
 	}
 	fullURL := fmt.Sprintf("%s://%s%s", scheme, r.Host, r.RequestURI)
 
-	log.Printf("NIP-98 Debug - URL check: fullURL='%s', urlTag='%s'", fullURL, urlTag)
 	if urlTag != fullURL {
 		return nil, fmt.Errorf("URL mismatch: expected %s, got %s", fullURL, urlTag)
 	}
 
-	log.Printf("NIP-98 Debug - Method check: method='%s', methodTag='%s'", r.Method, methodTag)
 	if methodTag != r.Method {
 		return nil, fmt.Errorf("method mismatch: expected %s, got %s", r.Method, methodTag)
 	}
 
-	log.Printf("NIP-98 Debug - About to verify signature for event ID: %s", event.ID)
-	if !event.Verify() {
-		log.Printf("NIP-98 Debug - Signature verification failed for event: %+v", event)
-		return nil, fmt.Errorf("invalid event signature")
+	if err := event.VerifyWithReason(); err != nil {
+		logging.FromContext(r.Context()).Debug("NIP-98 signature rejected", "pubkey", event.PubKey, "error", err)
+		return nil, fmt.Errorf("invalid event signature: %w", err)
+	}
+
+	if err := verifyPayload(r, payloadTag); err != nil {
+		return nil, err
 	}
 
 	return event, nil
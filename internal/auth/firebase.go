@@ -2,18 +2,28 @@ package auth
 
 import (
 	"context"
-	"net/http"
 	"strings"
 
 	"firebase.google.com/go/v4/auth"
 	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/apierror"
 )
 
+// IDTokenVerifier verifies Firebase ID tokens; *auth.Client implements it
+type IDTokenVerifier interface {
+	VerifyIDToken(ctx context.Context, idToken string) (*auth.Token, error)
+}
+
+// AdminClaim is the Firebase custom claim that grants admin access when true
+const AdminClaim = "admin"
+
+var _ IDTokenVerifier = (*auth.Client)(nil)
+
 type FirebaseMiddleware struct {
-	authClient *auth.Client
+	authClient IDTokenVerifier
 }
 
-func NewFirebaseMiddleware(authClient *auth.Client) *FirebaseMiddleware {
+func NewFirebaseMiddleware(authClient IDTokenVerifier) *FirebaseMiddleware {
 	return &FirebaseMiddleware{
 		authClient: authClient,
 	}
@@ -23,15 +33,13 @@ func (m *FirebaseMiddleware) Middleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		token := extractBearerToken(c.GetHeader("Authorization"))
 		if token == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing authorization token"})
-			c.Abort()
+			apierror.Respond(c, apierror.Unauthorized("Missing authorization token"))
 			return
 		}
 
 		firebaseToken, err := m.authClient.VerifyIDToken(context.Background(), token)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Firebase token"})
-			c.Abort()
+			apierror.Respond(c, apierror.Unauthorized("Invalid Firebase token"))
 			return
 		}
 
@@ -40,6 +48,24 @@ func (m *FirebaseMiddleware) Middleware() gin.HandlerFunc {
 		if email, ok := firebaseToken.Claims["email"].(string); ok {
 			c.Set("firebase_email", email)
 		}
+		isAdmin, _ := firebaseToken.Claims[AdminClaim].(bool)
+		c.Set("is_admin", isAdmin)
+		c.Next()
+	}
+}
+
+// RequireAdmin rejects requests whose Firebase token lacks the admin claim.
+// It must run after FirebaseMiddleware.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("firebase_uid") == "" {
+			apierror.Respond(c, apierror.Unauthorized("Missing authorization token"))
+			return
+		}
+		if !c.GetBool("is_admin") {
+			apierror.Respond(c, apierror.Forbidden("Admin access required"))
+			return
+		}
 		c.Next()
 	}
 }
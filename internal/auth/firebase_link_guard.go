@@ -4,10 +4,10 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"net/http"
 
 	"cloud.google.com/go/firestore"
 	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/apierror"
 	"github.com/wavlake/api/internal/models"
 	"google.golang.org/api/iterator"
 )
@@ -31,15 +31,13 @@ func (g *FirebaseLinkGuard) Middleware() gin.HandlerFunc {
 		// Get the pubkey from context (should be set by NIP-98 middleware)
 		pubkey, exists := c.Get("pubkey")
 		if !exists || pubkey == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing pubkey in context"})
-			c.Abort()
+			apierror.Respond(c, unauthorized(ErrorCodeMissingPubkey, "Missing pubkey in context"))
 			return
 		}
 
 		pubkeyStr, ok := pubkey.(string)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid pubkey format"})
-			c.Abort()
+			apierror.Respond(c, apierror.Unauthorized("Invalid pubkey format"))
 			return
 		}
 
@@ -48,18 +46,12 @@ func (g *FirebaseLinkGuard) Middleware() gin.HandlerFunc {
 		auth, err := g.getNostrAuth(ctx, pubkeyStr)
 		if err != nil {
 			log.Printf("Firebase link check failed for pubkey %s: %v", pubkeyStr, err)
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "User is not authorized. Please link your Nostr identity to your Firebase account to access this feature.",
-			})
-			c.Abort()
+			apierror.Respond(c, unauthorized(ErrorCodePubkeyNotLinked, "User is not authorized. Please link your Nostr identity to your Firebase account to access this feature."))
 			return
 		}
 
 		if !auth.Active {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "User is not authorized. Account is inactive.",
-			})
-			c.Abort()
+			apierror.Respond(c, unauthorized(ErrorCodeAccountInactive, "User is not authorized. Account is inactive."))
 			return
 		}
 
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -158,6 +159,67 @@ func (suite *FirebaseMiddlewareTestSuite) TestMiddleware_EmptyBearerToken() {
 	assert.Contains(suite.T(), w.Body.String(), "Missing authorization token")
 }
 
+// adminRouter serves GET /admin behind the real middleware and RequireAdmin
+func (suite *FirebaseMiddlewareTestSuite) adminRouter() *gin.Engine {
+	router := gin.New()
+	router.GET("/admin", NewFirebaseMiddleware(suite.mockAuthClient).Middleware(), RequireAdmin(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"firebase_uid": c.GetString("firebase_uid")})
+	})
+	return router
+}
+
+func (suite *FirebaseMiddlewareTestSuite) requestAdmin(router *gin.Engine, token string, claims map[string]interface{}) *httptest.ResponseRecorder {
+	suite.mockAuthClient.On("VerifyIDToken", mock.Anything, token).Return(&auth.Token{UID: "uid-" + token, Claims: claims}, nil).Once()
+
+	req, _ := http.NewRequest("GET", "/admin", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *FirebaseMiddlewareTestSuite) TestRequireAdmin_AdminClaim() {
+	w := suite.requestAdmin(suite.adminRouter(), "admin-token", map[string]interface{}{"admin": true, "email": "ops@wavlake.com"})
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "uid-admin-token")
+}
+
+func (suite *FirebaseMiddlewareTestSuite) TestRequireAdmin_NonAdminTokens() {
+	router := suite.adminRouter()
+	for token, claims := range map[string]map[string]interface{}{
+		"no-claims":    nil,
+		"admin-false":  {"admin": false},
+		"admin-string": {"admin": "true"},
+	} {
+		w := suite.requestAdmin(router, token, claims)
+		assert.Equal(suite.T(), http.StatusForbidden, w.Code, token)
+		assert.Contains(suite.T(), w.Body.String(), "Admin access required")
+	}
+}
+
+func (suite *FirebaseMiddlewareTestSuite) TestRequireAdmin_InvalidToken() {
+	suite.mockAuthClient.On("VerifyIDToken", mock.Anything, "expired-token").Return(nil, errors.New("token expired")).Once()
+
+	req, _ := http.NewRequest("GET", "/admin", nil)
+	req.Header.Set("Authorization", "Bearer expired-token")
+	w := httptest.NewRecorder()
+	suite.adminRouter().ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *FirebaseMiddlewareTestSuite) TestRequireAdmin_WithoutFirebaseAuth() {
+	router := gin.New()
+	router.GET("/admin", RequireAdmin(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req, _ := http.NewRequest("GET", "/admin", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
 func TestFirebaseMiddlewareTestSuite(t *testing.T) {
 	suite.Run(t, new(FirebaseMiddlewareTestSuite))
 }
@@ -2,8 +2,7 @@ package auth
 
 import (
 	"context"
-	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -13,7 +12,8 @@ import (
 	"cloud.google.com/go/firestore"
 	"firebase.google.com/go/v4/auth"
 	"github.com/gin-gonic/gin"
-	gonostr "github.com/nbd-wtf/go-nostr"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/logging"
 	"github.com/wavlake/api/internal/models"
 	"github.com/wavlake/api/pkg/nostr"
 	"google.golang.org/api/iterator"
@@ -23,22 +23,26 @@ import (
 type NIP98AuthResult struct {
 	Success     bool
 	FirebaseUID string
-	ErrorType   string
+	ErrorCode   string // One of the ErrorCode constants
 	ErrorMsg    string
 }
 
 // FlexibleAuthMiddleware provides authentication via Firebase Bearer token or NIP-98 signature
 // with graceful fallback between the two methods
 type FlexibleAuthMiddleware struct {
-	firebaseAuth    *auth.Client
-	firestoreClient *firestore.Client
+	firebaseAuth       *auth.Client
+	firestoreClient    *firestore.Client
+	timestampTolerance time.Duration
 }
 
-// NewFlexibleAuthMiddleware creates a new flexible authentication middleware
-func NewFlexibleAuthMiddleware(firebaseAuth *auth.Client, firestoreClient *firestore.Client) *FlexibleAuthMiddleware {
+// NewFlexibleAuthMiddleware creates a new flexible authentication middleware.
+// timestampTolerance is how far a NIP-98 event's created_at may be from the
+// server's clock; zero uses DefaultTimestampTolerance.
+func NewFlexibleAuthMiddleware(firebaseAuth *auth.Client, firestoreClient *firestore.Client, timestampTolerance time.Duration) *FlexibleAuthMiddleware {
 	return &FlexibleAuthMiddleware{
-		firebaseAuth:    firebaseAuth,
-		firestoreClient: firestoreClient,
+		firebaseAuth:       firebaseAuth,
+		firestoreClient:    firestoreClient,
+		timestampTolerance: timestampTolerance,
 	}
 }
 
@@ -51,6 +55,11 @@ func (m *FlexibleAuthMiddleware) Middleware() gin.HandlerFunc {
 			return
 		}
 
+		if err := readPayload(c.Request); err != nil {
+			apierror.Respond(c, err)
+			return
+		}
+
 		// First try Firebase Bearer token authentication
 		if firebaseUID := m.tryFirebaseAuth(c); firebaseUID != "" {
 			// Firebase auth successful
@@ -71,10 +80,7 @@ func (m *FlexibleAuthMiddleware) Middleware() gin.HandlerFunc {
 		}
 
 		// Both authentication methods failed - provide specific error message
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": nip98Result.ErrorMsg,
-		})
-		c.Abort()
+		apierror.Respond(c, apierror.Unauthorized(nip98Result.ErrorMsg).WithCode(nip98Result.ErrorCode))
 	}
 }
 
@@ -114,7 +120,7 @@ func (m *FlexibleAuthMiddleware) tryNIP98Auth(c *gin.Context) NIP98AuthResult {
 	if pubkey == "" {
 		return NIP98AuthResult{
 			Success:   false,
-			ErrorType: "invalid_signature",
+			ErrorCode: ErrorCodeInvalidSignature,
 			ErrorMsg:  "Invalid or missing NIP-98 signature",
 		}
 	}
@@ -124,16 +130,16 @@ func (m *FlexibleAuthMiddleware) tryNIP98Auth(c *gin.Context) NIP98AuthResult {
 	auth, err := m.getNostrAuth(ctx, pubkey)
 	if err != nil {
 		log.Printf("Failed to get auth for pubkey %s: %v", pubkey, err)
-		if err.Error() == "pubkey not found" {
+		if errors.Is(err, ErrPubkeyNotLinked) {
 			return NIP98AuthResult{
 				Success:   false,
-				ErrorType: "pubkey_not_linked",
+				ErrorCode: ErrorCodePubkeyNotLinked,
 				ErrorMsg:  "Nostr pubkey not linked to Firebase account. Please link your pubkey first.",
 			}
 		}
 		return NIP98AuthResult{
 			Success:   false,
-			ErrorType: "database_error",
+			ErrorCode: ErrorCodeLookupFailed,
 			ErrorMsg:  "Failed to verify account linking",
 		}
 	}
@@ -142,7 +148,7 @@ func (m *FlexibleAuthMiddleware) tryNIP98Auth(c *gin.Context) NIP98AuthResult {
 		log.Printf("Account inactive for pubkey %s", pubkey)
 		return NIP98AuthResult{
 			Success:   false,
-			ErrorType: "account_inactive",
+			ErrorCode: ErrorCodeAccountInactive,
 			ErrorMsg:  "Account is inactive",
 		}
 	}
@@ -174,48 +180,28 @@ func (m *FlexibleAuthMiddleware) validateNIP98Signature(r *http.Request) string
 	}
 
 	// Decode the base64 event
-	encodedEvent := strings.TrimPrefix(authHeader, "Nostr ")
-	eventData, err := base64.StdEncoding.DecodeString(encodedEvent)
+	event, err := decodeNIP98Event(strings.TrimPrefix(authHeader, "Nostr "))
 	if err != nil {
-		log.Printf("Invalid base64 encoding in NIP-98 auth: %v", err)
+		log.Printf("Invalid event in NIP-98 auth: %v", err)
 		return ""
 	}
 
-	// Parse the event
-	var gonostrEvent gonostr.Event
-	if err := json.Unmarshal(eventData, &gonostrEvent); err != nil {
-		log.Printf("Invalid event JSON in NIP-98 auth: %v", err)
-		return ""
-	}
-
-	event := &nostr.Event{Event: &gonostrEvent}
-
 	// Validate NIP-98 requirements
-	if event.Kind != 27235 {
+	if event.Kind != nostr.KindHTTPAuth {
 		log.Printf("Invalid event kind in NIP-98 auth: expected 27235, got %d", event.Kind)
 		return ""
 	}
 
-	// Check timestamp (must be within 60 seconds)
-	now := time.Now().Unix()
-	createdAt := int64(event.CreatedAt)
-	if now-createdAt > 60 || createdAt > now+60 {
-		log.Printf("Event timestamp out of range in NIP-98 auth: now=%d, created_at=%d", now, createdAt)
+	// Check timestamp against the configured tolerance
+	if !withinTolerance(int64(event.CreatedAt), time.Now(), m.timestampTolerance) {
+		log.Printf("Event timestamp out of range in NIP-98 auth: now=%d, created_at=%d", time.Now().Unix(), event.CreatedAt)
 		return ""
 	}
 
 	// Validate URL and method tags
-	var urlTag, methodTag string
-	for _, tag := range event.Tags {
-		if len(tag) >= 2 {
-			switch tag[0] {
-			case "u":
-				urlTag = tag[1]
-			case "method":
-				methodTag = tag[1]
-			}
-		}
-	}
+	urlTag, _ := event.GetTagValue("u")
+	methodTag, _ := event.GetTagValue("method")
+	payloadTag, _ := event.GetTagValue("payload")
 
 	// Construct the expected URL
 	scheme := "http"
@@ -239,8 +225,13 @@ func (m *FlexibleAuthMiddleware) validateNIP98Signature(r *http.Request) string
 	}
 
 	// Verify the signature
-	if !event.Verify() {
-		log.Printf("Invalid event signature in NIP-98 auth")
+	if err := event.VerifyWithReason(); err != nil {
+		logging.FromContext(r.Context()).Debug("NIP-98 signature rejected", "pubkey", event.PubKey, "error", err)
+		return ""
+	}
+
+	if err := verifyPayload(r, payloadTag); err != nil {
+		log.Printf("Payload check failed in NIP-98 auth: %v", err)
 		return ""
 	}
 
@@ -255,7 +246,7 @@ func (m *FlexibleAuthMiddleware) getNostrAuth(ctx context.Context, pubkey string
 
 	doc, err := iter.Next()
 	if err == iterator.Done {
-		return nil, fmt.Errorf("pubkey not found")
+		return nil, ErrPubkeyNotLinked
 	}
 	if err != nil {
 		return nil, err
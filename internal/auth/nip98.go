@@ -1,127 +1,302 @@
 package auth
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
-	"encoding/json"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strings"
 	"time"
 
-	"cloud.google.com/go/firestore"
-	gonostr "github.com/nbd-wtf/go-nostr"
-	"github.com/wavlake/api/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/bodylimit"
+	"github.com/wavlake/api/internal/logging"
 	"github.com/wavlake/api/pkg/nostr"
-	"google.golang.org/api/iterator"
 )
 
-type NIP98Middleware struct {
-	firestoreClient *firestore.Client
+// DefaultTimestampTolerance is how far a NIP-98 event's created_at may be from
+// the server's clock when no tolerance is configured
+const DefaultTimestampTolerance = 60 * time.Second
+
+// withinTolerance reports whether a NIP-98 created_at (unix seconds) is
+// within tolerance of now, either way. A zero tolerance uses
+// DefaultTimestampTolerance.
+func withinTolerance(createdAt int64, now time.Time, tolerance time.Duration) bool {
+	if tolerance <= 0 {
+		tolerance = DefaultTimestampTolerance
+	}
+	skew := now.Sub(time.Unix(createdAt, 0))
+	return skew <= tolerance && skew >= -tolerance
 }
 
-func NewNIP98Middleware(ctx context.Context, projectID string) (*NIP98Middleware, error) {
-	client, err := firestore.NewClient(ctx, projectID)
+// maxNIP98PayloadBytes caps how much of a request body is read to check the
+// event's payload tag
+const maxNIP98PayloadBytes = 1 << 20
+
+var (
+	// errPayloadMismatch is returned when the payload tag is missing for a
+	// request with a body, or doesn't match the body's hash
+	errPayloadMismatch = errors.New("payload mismatch")
+	// errInvalidEncoding is returned for an event that isn't valid base64
+	errInvalidEncoding = errors.New("invalid base64 encoding")
+)
+
+// nip98ParseOptions bounds the events accepted in Authorization headers. An
+// auth event is a few tags and no content; the limit on bytes leaves room for
+// long request URLs.
+var nip98ParseOptions = nostr.ParseOptions{MaxBytes: 16 << 10, MaxTags: 32, MaxContentBytes: 4 << 10}
+
+// decodeNIP98Event decodes the base64 event from a "Nostr " Authorization
+// header, rejecting one over nip98ParseOptions before decoding it
+func decodeNIP98Event(encoded string) (*nostr.Event, error) {
+	if len(encoded) > base64.StdEncoding.EncodedLen(nip98ParseOptions.MaxBytes) {
+		return nil, fmt.Errorf("%w: %d bytes of base64", nostr.ErrEventTooLarge, len(encoded))
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create firestore client: %w", err)
+		return nil, fmt.Errorf("%w: %v", errInvalidEncoding, err)
 	}
-
-	return &NIP98Middleware{
-		firestoreClient: client,
-	}, nil
+	return nostr.ParseEvent(data, nip98ParseOptions)
 }
 
-func (m *NIP98Middleware) Close() error {
-	return m.firestoreClient.Close()
+// Error codes of NIP-98 rejections, rendered by apierror; the codes are
+// stable, the messages may change.
+const (
+	ErrorCodeMissingHeader    = "auth.missing_header"    // No Authorization header
+	ErrorCodeInvalidScheme    = "auth.invalid_scheme"    // Header doesn't start with "Nostr "
+	ErrorCodeInvalidEncoding  = "auth.invalid_encoding"  // Event isn't valid base64
+	ErrorCodeInvalidEvent     = "auth.invalid_event"     // Event isn't valid JSON
+	ErrorCodeEventTooLarge    = "auth.event_too_large"   // Event over the size, tag count or content limits
+	ErrorCodeMalformedEvent   = "auth.malformed_event"   // id, pubkey or sig isn't lowercase hex of the right length
+	ErrorCodeInvalidKind      = "auth.invalid_kind"      // Event kind isn't 27235
+	ErrorCodeExpired          = "auth.expired"           // created_at is outside the allowed window
+	ErrorCodeURLMismatch      = "auth.url_mismatch"      // u tag isn't the request URL
+	ErrorCodeMethodMismatch   = "auth.method_mismatch"   // method tag isn't the request method
+	ErrorCodeInvalidSignature = "auth.invalid_signature" // Event ID or signature doesn't verify
+	ErrorCodePayloadMismatch  = "auth.payload_mismatch"  // payload tag missing or not the body's hash
+	ErrorCodePayloadTooLarge  = "auth.payload_too_large" // Body over 1 MB (413)
+	ErrorCodePubkeyNotLinked  = "auth.pubkey_not_linked" // No active account has the pubkey
+	ErrorCodeAccountInactive  = "auth.account_inactive"  // The pubkey's link is inactive
+	ErrorCodeLookupFailed     = "auth.lookup_failed"     // The account lookup failed
+	ErrorCodeMissingPubkey    = "auth.missing_pubkey"    // DatabaseLookupMiddleware ran without a signature check
+)
+
+// readPayload buffers the request body for the payload check. Every NIP-98
+// middleware calls it before checking anything else, so a body over the
+// route's bodylimit, or over maxNIP98PayloadBytes on a route without one, is
+// a 413 rather than an auth failure. The body is replaced so it can be read
+// again.
+func readPayload(r *http.Request) *apierror.Error {
+	if r.ContentLength > maxNIP98PayloadBytes {
+		return apierror.New(http.StatusRequestEntityTooLarge, ErrorCodePayloadTooLarge, "Request body too large")
+	}
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxNIP98PayloadBytes+1))
+	r.Body.Close()
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		// Over the route's limit, which is under maxNIP98PayloadBytes
+		return bodylimit.TooLarge(tooLarge.Limit)
+	case err != nil:
+		return apierror.Validation("failed to read request body")
+	case len(body) > maxNIP98PayloadBytes:
+		return apierror.New(http.StatusRequestEntityTooLarge, ErrorCodePayloadTooLarge, "Request body too large")
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return nil
 }
 
-// SignatureValidationMiddleware validates NIP-98 signatures without database lookup
-func (m *NIP98Middleware) SignatureValidationMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path == "/heartbeat" {
-			next.ServeHTTP(w, r)
-			return
+// verifyPayload checks a NIP-98 payload tag against the body readPayload
+// buffered. A request with a body must carry the SHA-256 hex of it; one
+// without a body needs no tag.
+func verifyPayload(r *http.Request, payloadTag string) error {
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(r.Body); err != nil {
+			return fmt.Errorf("failed to read request body: %w", err)
 		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
 
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Missing Authorization header", http.StatusUnauthorized)
-			return
-		}
+	if len(body) == 0 && payloadTag == "" {
+		return nil
+	}
 
-		if !strings.HasPrefix(authHeader, "Nostr ") {
-			http.Error(w, "Invalid Authorization scheme", http.StatusUnauthorized)
-			return
-		}
+	sum := sha256.Sum256(body)
+	if !strings.EqualFold(payloadTag, hex.EncodeToString(sum[:])) {
+		return errPayloadMismatch
+	}
+	return nil
+}
 
-		encodedEvent := strings.TrimPrefix(authHeader, "Nostr ")
-		eventData, err := base64.StdEncoding.DecodeString(encodedEvent)
-		if err != nil {
-			http.Error(w, "Invalid base64 encoding", http.StatusUnauthorized)
-			return
-		}
+type NIP98Middleware struct {
+	lookup             NostrAuthLookup
+	authCache          *authCache
+	lastUsed           *lastUsedBatch
+	timestampTolerance time.Duration
+}
 
-		var gonostrEvent gonostr.Event
-		if err := json.Unmarshal(eventData, &gonostrEvent); err != nil {
-			http.Error(w, "Invalid event JSON", http.StatusUnauthorized)
-			return
-		}
+// NewNIP98Middleware creates the middleware, checking pubkeys against lookup.
+// Pubkey lookups are cached for DefaultAuthCacheTTL and last_used_at is
+// written every DefaultLastUsedFlushInterval unless options say otherwise.
+func NewNIP98Middleware(lookup NostrAuthLookup, opts ...NIP98Option) *NIP98Middleware {
+	m := &NIP98Middleware{
+		lookup:             lookup,
+		authCache:          newAuthCache(DefaultAuthCacheTTL),
+		lastUsed:           newLastUsedBatch(DefaultLastUsedFlushInterval),
+		timestampTolerance: DefaultTimestampTolerance,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.lastUsed != nil {
+		go m.lastUsed.run(m.updateLastUsed)
+	}
 
-		event := &nostr.Event{Event: &gonostrEvent}
+	return m
+}
 
-		if event.Kind != 27235 {
-			http.Error(w, "Invalid event kind", http.StatusUnauthorized)
-			return
-		}
+// Close writes pending last_used_at updates. The lookup is left open.
+func (m *NIP98Middleware) Close() {
+	if m.lastUsed != nil {
+		m.lastUsed.close()
+	}
+}
 
-		now := time.Now().Unix()
-		createdAt := int64(event.CreatedAt)
-		if now-createdAt > 60 || createdAt > now+60 {
-			http.Error(w, "Event timestamp out of range", http.StatusUnauthorized)
-			return
-		}
+func unauthorized(code, message string) *apierror.Error {
+	return apierror.Unauthorized(message).WithCode(code)
+}
 
-		var urlTag, methodTag string
-		for _, tag := range event.Tags {
-			if len(tag) >= 2 {
-				switch tag[0] {
-				case "u":
-					urlTag = tag[1]
-				case "method":
-					methodTag = tag[1]
-				}
-			}
-		}
+// validateSignature runs the NIP-98 checks on a request and returns the pubkey
+// that signed it
+func (m *NIP98Middleware) validateSignature(r *http.Request) (string, *apierror.Error) {
+	if err := readPayload(r); err != nil {
+		return "", err
+	}
+
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return "", unauthorized(ErrorCodeMissingHeader, "Missing Authorization header")
+	}
+
+	if !strings.HasPrefix(authHeader, "Nostr ") {
+		return "", unauthorized(ErrorCodeInvalidScheme, "Invalid Authorization scheme")
+	}
+
+	event, err := decodeNIP98Event(strings.TrimPrefix(authHeader, "Nostr "))
+	switch {
+	case errors.Is(err, errInvalidEncoding):
+		return "", unauthorized(ErrorCodeInvalidEncoding, "Invalid base64 encoding")
+	case errors.Is(err, nostr.ErrEventTooLarge):
+		return "", unauthorized(ErrorCodeEventTooLarge, "Event too large")
+	case errors.Is(err, nostr.ErrMalformedEvent):
+		return "", unauthorized(ErrorCodeMalformedEvent, "Malformed event: "+err.Error())
+	case err != nil:
+		return "", unauthorized(ErrorCodeInvalidEvent, "Invalid event JSON")
+	}
 
-		scheme := "http"
-		if r.TLS != nil {
-			scheme = "https"
+	if event.Kind != nostr.KindHTTPAuth {
+		return "", unauthorized(ErrorCodeInvalidKind, "Invalid event kind")
+	}
+
+	if !withinTolerance(int64(event.CreatedAt), time.Now(), m.timestampTolerance) {
+		return "", unauthorized(ErrorCodeExpired, "Event timestamp out of range")
+	}
+
+	urlTag, _ := event.GetTagValue("u")
+	methodTag, _ := event.GetTagValue("method")
+	payloadTag, _ := event.GetTagValue("payload")
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	// Check X-Forwarded-Proto header for proxy/load balancer setups (like Cloud Run)
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "https" {
+		scheme = "https"
+	}
+	fullURL := fmt.Sprintf("%s://%s%s", scheme, r.Host, r.RequestURI)
+
+	if urlTag != fullURL {
+		log.Printf("URL mismatch: expected %s, got %s", fullURL, urlTag)
+		return "", unauthorized(ErrorCodeURLMismatch, "URL mismatch")
+	}
+
+	if methodTag != r.Method {
+		return "", unauthorized(ErrorCodeMethodMismatch, "Method mismatch")
+	}
+
+	if err := event.VerifyWithReason(); err != nil {
+		logging.FromContext(r.Context()).Debug("NIP-98 signature rejected", "pubkey", event.PubKey, "error", err)
+		return "", unauthorized(ErrorCodeInvalidSignature, "Invalid event signature: "+err.Error())
+	}
+
+	if err := verifyPayload(r, payloadTag); err != nil {
+		log.Printf("Payload check failed for %s %s: %v", r.Method, r.URL.Path, err)
+		return "", unauthorized(ErrorCodePayloadMismatch, "Payload mismatch")
+	}
+
+	return event.PubKey, nil
+}
+
+// lookupFirebaseUID returns the Firebase UID an authenticated pubkey is linked to
+func (m *NIP98Middleware) lookupFirebaseUID(pubkey string) (string, *apierror.Error) {
+	auth, cached := m.authCache.get(pubkey)
+	if !cached {
+		var err error
+		auth, err = m.lookup.GetActiveAuthByPubkey(context.Background(), pubkey)
+		if errors.Is(err, ErrPubkeyNotLinked) {
+			return "", unauthorized(ErrorCodePubkeyNotLinked, "Pubkey is not linked to an account")
 		}
-		// Check X-Forwarded-Proto header for proxy/load balancer setups (like Cloud Run)
-		if proto := r.Header.Get("X-Forwarded-Proto"); proto == "https" {
-			scheme = "https"
+		if err != nil {
+			log.Printf("Failed to get auth: %v", err)
+			return "", unauthorized(ErrorCodeLookupFailed, "Authentication failed")
 		}
-		fullURL := fmt.Sprintf("%s://%s%s", scheme, r.Host, r.RequestURI)
+	}
 
-		if urlTag != fullURL {
-			log.Printf("URL mismatch: expected %s, got %s", fullURL, urlTag)
-			http.Error(w, "URL mismatch", http.StatusUnauthorized)
-			return
-		}
+	if !auth.Active {
+		return "", unauthorized(ErrorCodeAccountInactive, "Account inactive")
+	}
+	if !cached {
+		m.authCache.set(pubkey, auth)
+	}
+
+	if m.lastUsed != nil {
+		m.lastUsed.record(pubkey, time.Now())
+	} else {
+		go m.updateLastUsed(context.Background(), pubkey, time.Now())
+	}
+	return auth.FirebaseUID, nil
+}
 
-		if methodTag != r.Method {
-			http.Error(w, "Method mismatch", http.StatusUnauthorized)
+// SignatureValidationMiddleware validates NIP-98 signatures without database lookup
+func (m *NIP98Middleware) SignatureValidationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/heartbeat" {
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		if !event.Verify() {
-			http.Error(w, "Invalid event signature", http.StatusUnauthorized)
+		pubkey, authErr := m.validateSignature(r)
+		if authErr != nil {
+			apierror.Write(w, r, authErr)
 			return
 		}
 
 		// Only set the pubkey in context, no database lookup
-		ctx := context.WithValue(r.Context(), "pubkey", event.PubKey)
+		ctx := context.WithValue(r.Context(), "pubkey", pubkey)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -132,27 +307,18 @@ func (m *NIP98Middleware) DatabaseLookupMiddleware(next http.Handler) http.Handl
 		// Get the pubkey from context (should be set by SignatureValidationMiddleware)
 		pubkey, exists := r.Context().Value("pubkey").(string)
 		if !exists || pubkey == "" {
-			http.Error(w, "Missing pubkey in context", http.StatusUnauthorized)
-			return
-		}
-
-		ctx := context.Background()
-		auth, err := m.getNostrAuth(ctx, pubkey)
-		if err != nil {
-			log.Printf("Failed to get auth: %v", err)
-			http.Error(w, "Authentication failed", http.StatusUnauthorized)
+			apierror.Write(w, r, unauthorized(ErrorCodeMissingPubkey, "Missing pubkey in context"))
 			return
 		}
 
-		if !auth.Active {
-			http.Error(w, "Account inactive", http.StatusUnauthorized)
+		firebaseUID, authErr := m.lookupFirebaseUID(pubkey)
+		if authErr != nil {
+			apierror.Write(w, r, authErr)
 			return
 		}
 
-		go m.updateLastUsed(context.Background(), pubkey)
-
 		// Add firebase_uid to context
-		ctx = context.WithValue(r.Context(), "firebase_uid", auth.FirebaseUID)
+		ctx := context.WithValue(r.Context(), "firebase_uid", firebaseUID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -162,41 +328,45 @@ func (m *NIP98Middleware) Middleware(next http.Handler) http.Handler {
 	return m.SignatureValidationMiddleware(m.DatabaseLookupMiddleware(next))
 }
 
-func (m *NIP98Middleware) getNostrAuth(ctx context.Context, pubkey string) (*models.NostrAuth, error) {
-	query := m.firestoreClient.Collection("nostr_auth").Where("pubkey", "==", pubkey).Where("active", "==", true).Limit(1)
-	iter := query.Documents(ctx)
-	defer iter.Stop()
-
-	doc, err := iter.Next()
-	if err == iterator.Done {
-		return nil, fmt.Errorf("pubkey not found")
-	}
-	if err != nil {
-		return nil, err
-	}
+// GinSignatureMiddleware is SignatureValidationMiddleware for Gin routes. It
+// sets "pubkey" on the context.
+func (m *NIP98Middleware) GinSignatureMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pubkey, authErr := m.validateSignature(c.Request)
+		if authErr != nil {
+			apierror.Respond(c, authErr)
+			return
+		}
 
-	var auth models.NostrAuth
-	if err := doc.DataTo(&auth); err != nil {
-		return nil, err
+		c.Set("pubkey", pubkey)
+		c.Next()
 	}
-
-	return &auth, nil
 }
 
-func (m *NIP98Middleware) updateLastUsed(ctx context.Context, pubkey string) {
-	query := m.firestoreClient.Collection("nostr_auth").Where("pubkey", "==", pubkey).Limit(1)
-	iter := query.Documents(ctx)
-	defer iter.Stop()
+// GinMiddleware is Middleware for Gin routes. It sets "pubkey" and
+// "firebase_uid" on the context.
+func (m *NIP98Middleware) GinMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pubkey, authErr := m.validateSignature(c.Request)
+		if authErr != nil {
+			apierror.Respond(c, authErr)
+			return
+		}
 
-	doc, err := iter.Next()
-	if err != nil {
-		return
+		firebaseUID, authErr := m.lookupFirebaseUID(pubkey)
+		if authErr != nil {
+			apierror.Respond(c, authErr)
+			return
+		}
+
+		c.Set("pubkey", pubkey)
+		c.Set("firebase_uid", firebaseUID)
+		c.Next()
 	}
+}
 
-	_, err = doc.Ref.Update(ctx, []firestore.Update{
-		{Path: "last_used_at", Value: time.Now()},
-	})
-	if err != nil {
+func (m *NIP98Middleware) updateLastUsed(ctx context.Context, pubkey string, at time.Time) {
+	if err := m.lookup.TouchLastUsed(ctx, pubkey, at); err != nil {
 		log.Printf("Failed to update last_used_at: %v", err)
 	}
 }
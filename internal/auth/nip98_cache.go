@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/wavlake/api/internal/models"
+)
+
+const (
+	// DefaultAuthCacheTTL is how long a resolved pubkey is trusted before
+	// Firestore is asked again
+	DefaultAuthCacheTTL = 60 * time.Second
+
+	// DefaultLastUsedFlushInterval is how often pending last_used_at updates
+	// are written, at most once per pubkey
+	DefaultLastUsedFlushInterval = 60 * time.Second
+)
+
+// NIP98Option configures a NIP98Middleware
+type NIP98Option func(*NIP98Middleware)
+
+// WithAuthCacheTTL sets how long pubkey lookups are cached. Zero disables the
+// cache, so every request reads Firestore.
+func WithAuthCacheTTL(ttl time.Duration) NIP98Option {
+	return func(m *NIP98Middleware) {
+		m.authCache = newAuthCache(ttl)
+	}
+}
+
+// WithLastUsedFlushInterval sets how often last_used_at updates are written.
+// Zero writes one update per request.
+func WithLastUsedFlushInterval(interval time.Duration) NIP98Option {
+	return func(m *NIP98Middleware) {
+		m.lastUsed = newLastUsedBatch(interval)
+	}
+}
+
+// WithTimestampTolerance sets how far an event's created_at may be from the
+// server's clock. Zero uses DefaultTimestampTolerance.
+func WithTimestampTolerance(tolerance time.Duration) NIP98Option {
+	return func(m *NIP98Middleware) {
+		m.timestampTolerance = tolerance
+	}
+}
+
+// authCache holds active NostrAuth records by pubkey for a fixed TTL. Misses
+// aren't cached, so a newly linked pubkey works on its next request. A nil
+// cache stores nothing.
+type authCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cachedAuth
+}
+
+type cachedAuth struct {
+	auth      models.NostrAuth
+	expiresAt time.Time
+}
+
+func newAuthCache(ttl time.Duration) *authCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &authCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[string]cachedAuth{},
+	}
+}
+
+func (c *authCache) get(pubkey string) (*models.NostrAuth, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[pubkey]
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(entry.expiresAt) {
+		delete(c.entries, pubkey)
+		return nil, false
+	}
+
+	auth := entry.auth
+	return &auth, true
+}
+
+func (c *authCache) set(pubkey string, auth *models.NostrAuth) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	// Drop expired entries while we hold the lock so the map can't grow
+	// without bound from one-off pubkeys
+	for key, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+	c.entries[pubkey] = cachedAuth{auth: *auth, expiresAt: now.Add(c.ttl)}
+}
+
+func (c *authCache) invalidate(pubkey string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, pubkey)
+}
+
+// lastUsedBatch collects last_used_at updates so each pubkey is written at
+// most once per interval. A nil batch writes nothing and leaves the caller to
+// write directly.
+type lastUsedBatch struct {
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[string]time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newLastUsedBatch(interval time.Duration) *lastUsedBatch {
+	if interval <= 0 {
+		return nil
+	}
+	return &lastUsedBatch{
+		interval: interval,
+		pending:  map[string]time.Time{},
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// record notes a use of pubkey; later uses in the same interval overwrite it
+func (b *lastUsedBatch) record(pubkey string, at time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending[pubkey] = at
+}
+
+// drain returns the pending updates and clears them
+func (b *lastUsedBatch) drain() map[string]time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	pending := b.pending
+	b.pending = map[string]time.Time{}
+	return pending
+}
+
+// run calls flush with the pending updates every interval until close, then
+// once more so nothing recorded is lost
+func (b *lastUsedBatch) run(flush func(ctx context.Context, pubkey string, at time.Time)) {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	flushAll := func() {
+		for pubkey, at := range b.drain() {
+			flush(context.Background(), pubkey, at)
+		}
+	}
+
+	for {
+		select {
+		case <-ticker.C:
+			flushAll()
+		case <-b.stop:
+			flushAll()
+			return
+		}
+	}
+}
+
+func (b *lastUsedBatch) close() {
+	close(b.stop)
+	<-b.done
+}
+
+// InvalidatePubkey drops a pubkey's cached lookup so its next request reads
+// Firestore. Register it with UserService.OnPubkeyUnlinked; other instances
+// keep their entry until it expires.
+func (m *NIP98Middleware) InvalidatePubkey(pubkey string) {
+	m.authCache.invalidate(pubkey)
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/models"
+)
+
+func TestAuthCache(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cache := newAuthCache(time.Minute)
+	cache.now = func() time.Time { return now }
+
+	_, ok := cache.get("pk1")
+	assert.False(t, ok)
+
+	cache.set("pk1", &models.NostrAuth{Pubkey: "pk1", FirebaseUID: "uid-1", Active: true})
+	auth, ok := cache.get("pk1")
+	require.True(t, ok)
+	assert.Equal(t, "uid-1", auth.FirebaseUID)
+
+	// Callers get a copy
+	auth.FirebaseUID = "changed"
+	auth, _ = cache.get("pk1")
+	assert.Equal(t, "uid-1", auth.FirebaseUID)
+
+	now = now.Add(time.Minute)
+	_, ok = cache.get("pk1")
+	assert.False(t, ok, "entries expire after the TTL")
+
+	cache.set("pk1", &models.NostrAuth{Pubkey: "pk1", FirebaseUID: "uid-1", Active: true})
+	cache.invalidate("pk1")
+	_, ok = cache.get("pk1")
+	assert.False(t, ok)
+}
+
+func TestAuthCacheDisabled(t *testing.T) {
+	cache := newAuthCache(0)
+	assert.Nil(t, cache)
+
+	cache.set("pk1", &models.NostrAuth{Pubkey: "pk1"})
+	_, ok := cache.get("pk1")
+	assert.False(t, ok)
+	cache.invalidate("pk1")
+
+	m := &NIP98Middleware{}
+	WithAuthCacheTTL(0)(m)
+	m.InvalidatePubkey("pk1")
+}
+
+func TestAuthCacheSetDropsExpired(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cache := newAuthCache(time.Minute)
+	cache.now = func() time.Time { return now }
+
+	cache.set("pk1", &models.NostrAuth{Pubkey: "pk1"})
+	now = now.Add(2 * time.Minute)
+	cache.set("pk2", &models.NostrAuth{Pubkey: "pk2"})
+
+	assert.Len(t, cache.entries, 1)
+}
+
+func TestLastUsedBatchCoalesces(t *testing.T) {
+	batch := newLastUsedBatch(time.Hour)
+	first := time.Unix(1700000000, 0)
+
+	batch.record("pk1", first)
+	batch.record("pk1", first.Add(time.Second))
+	batch.record("pk2", first)
+
+	pending := batch.drain()
+	assert.Equal(t, map[string]time.Time{"pk1": first.Add(time.Second), "pk2": first}, pending)
+	assert.Empty(t, batch.drain())
+}
+
+func TestLastUsedBatchFlushesOnClose(t *testing.T) {
+	batch := newLastUsedBatch(time.Hour)
+
+	var mu sync.Mutex
+	flushed := map[string]time.Time{}
+	go batch.run(func(ctx context.Context, pubkey string, at time.Time) {
+		mu.Lock()
+		defer mu.Unlock()
+		flushed[pubkey] = at
+	})
+
+	at := time.Unix(1700000000, 0)
+	batch.record("pk1", at)
+	batch.close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, map[string]time.Time{"pk1": at}, flushed)
+}
+
+func TestLastUsedBatchDisabled(t *testing.T) {
+	assert.Nil(t, newLastUsedBatch(0))
+}
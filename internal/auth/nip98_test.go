@@ -0,0 +1,344 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	gonostr "github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/bodylimit"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/pkg/nostr"
+)
+
+const nip98TestURL = "http://api.example.com/v1/tracks/nostr"
+
+// serveSigned sends a request through SignatureValidationMiddleware, signed
+// for signedBody, and returns the response and the body the handler read
+func serveSigned(t *testing.T, method, body string, signedBody []byte) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+
+	header, err := nostr.NIP98AuthorizationHeader(gonostr.GeneratePrivateKey(), method, nip98TestURL, signedBody)
+	require.NoError(t, err)
+
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, nip98TestURL, reader)
+	req.RequestURI = "/v1/tracks/nostr" // as a server sees it
+	req.Header.Set("Authorization", header)
+
+	var handlerBody string
+	handler := (&NIP98Middleware{}).SignatureValidationMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		handlerBody = string(data)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w, handlerBody
+}
+
+func TestSignatureValidationPayload(t *testing.T) {
+	body := `{"extension":"mp3"}`
+
+	t.Run("matching payload", func(t *testing.T) {
+		w, handlerBody := serveSigned(t, "POST", body, []byte(body))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, body, handlerBody, "handlers must still be able to read the body")
+	})
+
+	t.Run("different body", func(t *testing.T) {
+		w, _ := serveSigned(t, "POST", `{"extension":"wav"}`, []byte(body))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "Payload mismatch")
+	})
+
+	t.Run("body without payload tag", func(t *testing.T) {
+		w, _ := serveSigned(t, "POST", body, nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("no body and no payload tag", func(t *testing.T) {
+		w, _ := serveSigned(t, "DELETE", "", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("payload tag without body", func(t *testing.T) {
+		w, _ := serveSigned(t, "POST", "", []byte(body))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("body too large", func(t *testing.T) {
+		large := strings.Repeat("a", maxNIP98PayloadBytes+1)
+		w, _ := serveSigned(t, "PUT", large, []byte(large))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	})
+}
+
+func TestGinSignatureMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	sk := gonostr.GeneratePrivateKey()
+	pk, err := gonostr.GetPublicKey(sk)
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.DELETE("/v1/tracks/:id", (&NIP98Middleware{}).GinSignatureMiddleware(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"pubkey": c.GetString("pubkey"), "id": c.Param("id")})
+	})
+
+	t.Run("valid signature", func(t *testing.T) {
+		url := "http://api.example.com/v1/tracks/track-123"
+		header, err := nostr.NIP98AuthorizationHeader(sk, "DELETE", url, nil)
+		require.NoError(t, err)
+
+		req := httptest.NewRequest("DELETE", url, nil)
+		req.RequestURI = "/v1/tracks/track-123"
+		req.Header.Set("Authorization", header)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"pubkey":"`+pk+`","id":"track-123"}`, w.Body.String(), "route params must reach the handler")
+	})
+
+	t.Run("wrong method", func(t *testing.T) {
+		url := "http://api.example.com/v1/tracks/track-123"
+		header, err := nostr.NIP98AuthorizationHeader(sk, "GET", url, nil)
+		require.NoError(t, err)
+
+		req := httptest.NewRequest("DELETE", url, nil)
+		req.RequestURI = "/v1/tracks/track-123"
+		req.Header.Set("Authorization", header)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assertAuthError(t, w, http.StatusUnauthorized, ErrorCodeMethodMismatch)
+	})
+
+	t.Run("tampered event", func(t *testing.T) {
+		url := "http://api.example.com/v1/tracks/track-123"
+		header, err := nostr.NIP98AuthorizationHeader(sk, "DELETE", url, nil)
+		require.NoError(t, err)
+
+		var event gonostr.Event
+		data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, "Nostr "))
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &event))
+		event.Content = "changed after signing"
+		data, err = json.Marshal(event)
+		require.NoError(t, err)
+
+		req := httptest.NewRequest("DELETE", url, nil)
+		req.RequestURI = "/v1/tracks/track-123"
+		req.Header.Set("Authorization", "Nostr "+base64.StdEncoding.EncodeToString(data))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		authErr := assertAuthError(t, w, http.StatusUnauthorized, ErrorCodeInvalidSignature)
+		assert.Equal(t, "Invalid event signature: event ID does not match its contents", authErr["message"])
+		assert.NotContains(t, w.Body.String(), "changed after signing")
+	})
+
+	t.Run("missing header", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("DELETE", "http://api.example.com/v1/tracks/track-123", nil))
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
+// assertAuthError checks a rejection is a JSON error with the given status
+// and code, and returns its error object
+func assertAuthError(t *testing.T, w *httptest.ResponseRecorder, status int, code string) map[string]interface{} {
+	t.Helper()
+	assert.Equal(t, status, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+
+	var body struct {
+		Success bool                   `json:"success"`
+		Error   map[string]interface{} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body), w.Body.String())
+	assert.False(t, body.Success)
+	assert.Equal(t, code, body.Error["code"])
+	assert.NotEmpty(t, body.Error["message"])
+	return body.Error
+}
+
+// encodeAuthEvent signs an event built from a valid NIP-98 event for url and
+// changed by mutate, and returns its Authorization header
+func encodeAuthEvent(t *testing.T, url string, mutate func(event *gonostr.Event)) string {
+	t.Helper()
+	event := &gonostr.Event{
+		Kind:      nostr.KindHTTPAuth,
+		CreatedAt: gonostr.Now(),
+		Tags:      gonostr.Tags{{"u", url}, {"method", "POST"}},
+	}
+	mutate(event)
+	require.NoError(t, event.Sign(gonostr.GeneratePrivateKey()))
+	data, err := json.Marshal(event)
+	require.NoError(t, err)
+	return "Nostr " + base64.StdEncoding.EncodeToString(data)
+}
+
+func TestNIP98RejectionCodes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const path = "/v1/tracks/nostr"
+	url := "http://api.example.com" + path
+	unchanged := func(*gonostr.Event) {}
+
+	tests := []struct {
+		name   string
+		header string
+		body   string
+		status int
+		code   string
+	}{
+		{"missing header", "", "", http.StatusUnauthorized, ErrorCodeMissingHeader},
+		{"wrong scheme", "Bearer token", "", http.StatusUnauthorized, ErrorCodeInvalidScheme},
+		{"not base64", "Nostr %%%", "", http.StatusUnauthorized, ErrorCodeInvalidEncoding},
+		{"not JSON", "Nostr " + base64.StdEncoding.EncodeToString([]byte("not json")), "", http.StatusUnauthorized, ErrorCodeInvalidEvent},
+		{"huge header", "Nostr " + strings.Repeat("A", 1<<20), "", http.StatusUnauthorized, ErrorCodeEventTooLarge},
+		{"too many tags", encodeAuthEvent(t, url, func(e *gonostr.Event) {
+			for i := 0; i < 100; i++ {
+				e.Tags = append(e.Tags, gonostr.Tag{"t", "x"})
+			}
+		}), "", http.StatusUnauthorized, ErrorCodeEventTooLarge},
+		{"long content", encodeAuthEvent(t, url, func(e *gonostr.Event) { e.Content = strings.Repeat("x", 5000) }), "", http.StatusUnauthorized, ErrorCodeEventTooLarge},
+		{"malformed ID", "Nostr " + base64.StdEncoding.EncodeToString([]byte(`{"id":"abc","pubkey":"def","sig":"123","kind":27235}`)), "", http.StatusUnauthorized, ErrorCodeMalformedEvent},
+		{"wrong kind", encodeAuthEvent(t, url, func(e *gonostr.Event) { e.Kind = 1 }), "", http.StatusUnauthorized, ErrorCodeInvalidKind},
+		{"expired", encodeAuthEvent(t, url, func(e *gonostr.Event) { e.CreatedAt -= 3600 }), "", http.StatusUnauthorized, ErrorCodeExpired},
+		{"wrong URL", encodeAuthEvent(t, "http://api.example.com/other", unchanged), "", http.StatusUnauthorized, ErrorCodeURLMismatch},
+		{"wrong method", encodeAuthEvent(t, url, func(e *gonostr.Event) { e.Tags[1] = gonostr.Tag{"method", "GET"} }), "", http.StatusUnauthorized, ErrorCodeMethodMismatch},
+		{"missing payload", encodeAuthEvent(t, url, unchanged), `{"extension":"mp3"}`, http.StatusUnauthorized, ErrorCodePayloadMismatch},
+		{"body too large", encodeAuthEvent(t, url, unchanged), strings.Repeat("a", maxNIP98PayloadBytes+1), http.StatusRequestEntityTooLarge, ErrorCodePayloadTooLarge},
+	}
+
+	router := gin.New()
+	router.POST(path, (&NIP98Middleware{}).GinSignatureMiddleware(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	handler := (&NIP98Middleware{}).SignatureValidationMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, tt := range tests {
+		newRequest := func() *http.Request {
+			req := httptest.NewRequest("POST", url, strings.NewReader(tt.body))
+			req.RequestURI = path
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			return req
+		}
+
+		t.Run(tt.name+" (gin)", func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, newRequest())
+			assertAuthError(t, w, tt.status, tt.code)
+		})
+		t.Run(tt.name+" (net/http)", func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, newRequest())
+			assertAuthError(t, w, tt.status, tt.code)
+		})
+	}
+
+	t.Run("invalid signature", func(t *testing.T) {
+		header := encodeAuthEvent(t, url, unchanged)
+		data, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, "Nostr "))
+		var event gonostr.Event
+		require.NoError(t, json.Unmarshal(data, &event))
+		event.Sig = strings.Repeat("0", 128)
+		data, _ = json.Marshal(event)
+
+		req := httptest.NewRequest("POST", url, nil)
+		req.RequestURI = path
+		req.Header.Set("Authorization", "Nostr "+base64.StdEncoding.EncodeToString(data))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assertAuthError(t, w, http.StatusUnauthorized, ErrorCodeInvalidSignature)
+	})
+
+	t.Run("body over the route limit", func(t *testing.T) {
+		limited := gin.New()
+		limited.POST(path, bodylimit.Middleware(1<<10), (&NIP98Middleware{}).GinSignatureMiddleware(), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		body := strings.Repeat("a", 2<<10)
+		header, err := nostr.NIP98AuthorizationHeader(gonostr.GeneratePrivateKey(), "POST", url, []byte(body))
+		require.NoError(t, err)
+
+		// Sent without a Content-Length, so the limit is hit while hashing
+		req := httptest.NewRequest("POST", url, io.NopCloser(strings.NewReader(body)))
+		req.RequestURI = path
+		req.Header.Set("Authorization", header)
+		w := httptest.NewRecorder()
+		limited.ServeHTTP(w, req)
+		assertAuthError(t, w, http.StatusRequestEntityTooLarge, bodylimit.ErrorCodeBodyTooLarge)
+	})
+
+	t.Run("body over the route limit is checked before auth", func(t *testing.T) {
+		for name, middleware := range map[string]gin.HandlerFunc{
+			"nip98":    (&NIP98Middleware{}).GinSignatureMiddleware(),
+			"flexible": (&FlexibleAuthMiddleware{}).Middleware(),
+			"dual":     (&DualAuthMiddleware{}).Middleware(),
+		} {
+			limited := gin.New()
+			limited.POST(path, bodylimit.Middleware(1<<10), middleware, func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest("POST", url, io.NopCloser(strings.NewReader(strings.Repeat("a", 2<<10))))
+			req.RequestURI = path
+			req.Header.Set("Authorization", "Nostr not-an-event")
+			w := httptest.NewRecorder()
+			limited.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, name)
+		}
+	})
+
+	t.Run("inactive account", func(t *testing.T) {
+		m := &NIP98Middleware{authCache: newAuthCache(time.Minute)}
+		m.authCache.set("inactive-pubkey", &models.NostrAuth{Pubkey: "inactive-pubkey", Active: false})
+
+		ctx := context.WithValue(context.Background(), "pubkey", "inactive-pubkey")
+		lookup := m.DatabaseLookupMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		w := httptest.NewRecorder()
+		lookup.ServeHTTP(w, httptest.NewRequest("GET", url, nil).WithContext(ctx))
+		assertAuthError(t, w, http.StatusUnauthorized, ErrorCodeAccountInactive)
+	})
+
+	t.Run("lookup without a signature check", func(t *testing.T) {
+		lookup := (&NIP98Middleware{}).DatabaseLookupMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		w := httptest.NewRecorder()
+		lookup.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		assertAuthError(t, w, http.StatusUnauthorized, ErrorCodeMissingPubkey)
+	})
+}
+
+func TestWithinTolerance(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	assert.True(t, withinTolerance(now.Unix()-60, now, 0), "zero uses the default")
+	assert.False(t, withinTolerance(now.Unix()-61, now, 0))
+	assert.False(t, withinTolerance(now.Unix()+61, now, 0))
+
+	assert.True(t, withinTolerance(now.Unix()-90, now, 2*time.Minute))
+	assert.True(t, withinTolerance(now.Unix()+120, now, 2*time.Minute))
+	assert.False(t, withinTolerance(now.Unix()+121, now, 2*time.Minute))
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/wavlake/api/internal/models"
+	"google.golang.org/api/iterator"
+)
+
+// ErrPubkeyNotLinked is returned by NostrAuthLookup when no active account has
+// the pubkey
+var ErrPubkeyNotLinked = errors.New("pubkey not found")
+
+// NostrAuthLookup reads the nostr_auth links NIP-98 requests are checked
+// against; FirestoreNostrAuthLookup implements it
+type NostrAuthLookup interface {
+	// GetActiveAuthByPubkey returns the pubkey's active link, or
+	// ErrPubkeyNotLinked
+	GetActiveAuthByPubkey(ctx context.Context, pubkey string) (*models.NostrAuth, error)
+	// TouchLastUsed records that the pubkey authenticated at the given time
+	TouchLastUsed(ctx context.Context, pubkey string, at time.Time) error
+}
+
+var _ NostrAuthLookup = (*FirestoreNostrAuthLookup)(nil)
+
+// FirestoreNostrAuthLookup is a NostrAuthLookup over the nostr_auth collection
+type FirestoreNostrAuthLookup struct {
+	firestoreClient *firestore.Client
+}
+
+// NewFirestoreNostrAuthLookup creates a lookup on a shared client, which the
+// caller closes
+func NewFirestoreNostrAuthLookup(client *firestore.Client) *FirestoreNostrAuthLookup {
+	return &FirestoreNostrAuthLookup{firestoreClient: client}
+}
+
+func (l *FirestoreNostrAuthLookup) GetActiveAuthByPubkey(ctx context.Context, pubkey string) (*models.NostrAuth, error) {
+	query := l.firestoreClient.Collection("nostr_auth").Where("pubkey", "==", pubkey).Where("active", "==", true).Limit(1)
+	iter := query.Documents(ctx)
+	defer iter.Stop()
+
+	doc, err := iter.Next()
+	if err == iterator.Done {
+		return nil, ErrPubkeyNotLinked
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var auth models.NostrAuth
+	if err := doc.DataTo(&auth); err != nil {
+		return nil, err
+	}
+
+	return &auth, nil
+}
+
+// TouchLastUsed sets last_used_at; a pubkey with no record is left alone
+func (l *FirestoreNostrAuthLookup) TouchLastUsed(ctx context.Context, pubkey string, at time.Time) error {
+	query := l.firestoreClient.Collection("nostr_auth").Where("pubkey", "==", pubkey).Limit(1)
+	iter := query.Documents(ctx)
+	defer iter.Stop()
+
+	doc, err := iter.Next()
+	if err == iterator.Done {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = doc.Ref.Update(ctx, []firestore.Update{
+		{Path: "last_used_at", Value: at},
+	})
+	return err
+}
@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	gonostr "github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/pkg/nostr"
+)
+
+// mockNostrAuthLookup is a NostrAuthLookup; internal/mocks can't be imported
+// here without a cycle
+type mockNostrAuthLookup struct {
+	mock.Mock
+}
+
+func (m *mockNostrAuthLookup) GetActiveAuthByPubkey(ctx context.Context, pubkey string) (*models.NostrAuth, error) {
+	args := m.Called(ctx, pubkey)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.NostrAuth), args.Error(1)
+}
+
+func (m *mockNostrAuthLookup) TouchLastUsed(ctx context.Context, pubkey string, at time.Time) error {
+	return m.Called(ctx, pubkey, at).Error(0)
+}
+
+func TestLookupFirebaseUID(t *testing.T) {
+	tests := []struct {
+		name    string
+		auth    *models.NostrAuth
+		err     error
+		uid     string
+		code    string
+		touched bool
+	}{
+		{name: "active", auth: &models.NostrAuth{Pubkey: "pk", FirebaseUID: "uid-1", Active: true}, uid: "uid-1", touched: true},
+		{name: "inactive", auth: &models.NostrAuth{Pubkey: "pk", FirebaseUID: "uid-1", Active: false}, code: ErrorCodeAccountInactive},
+		{name: "missing", err: ErrPubkeyNotLinked, code: ErrorCodePubkeyNotLinked},
+		{name: "lookup failure", err: errors.New("firestore down"), code: ErrorCodeLookupFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookup := &mockNostrAuthLookup{}
+			if tt.auth != nil {
+				lookup.On("GetActiveAuthByPubkey", mock.Anything, "pk").Return(tt.auth, nil).Once()
+			} else {
+				lookup.On("GetActiveAuthByPubkey", mock.Anything, "pk").Return(nil, tt.err).Once()
+			}
+			if tt.touched {
+				lookup.On("TouchLastUsed", mock.Anything, "pk", mock.AnythingOfType("time.Time")).Return(nil).Once()
+			}
+			m := NewNIP98Middleware(lookup, WithLastUsedFlushInterval(time.Hour))
+
+			uid, authErr := m.lookupFirebaseUID("pk")
+			if tt.code != "" {
+				require.NotNil(t, authErr)
+				assert.Equal(t, tt.code, authErr.Code)
+				assert.Equal(t, http.StatusUnauthorized, authErr.Status)
+			} else {
+				require.Nil(t, authErr)
+				assert.Equal(t, tt.uid, uid)
+
+				// The second request is served from the cache
+				uid, authErr = m.lookupFirebaseUID("pk")
+				require.Nil(t, authErr)
+				assert.Equal(t, tt.uid, uid)
+			}
+
+			// Closing flushes last_used_at for the pubkeys that authenticated
+			m.Close()
+			lookup.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGinMiddlewareLooksUpPubkey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	sk := gonostr.GeneratePrivateKey()
+	pk, err := gonostr.GetPublicKey(sk)
+	require.NoError(t, err)
+
+	lookup := &mockNostrAuthLookup{}
+	lookup.On("GetActiveAuthByPubkey", mock.Anything, pk).Return(&models.NostrAuth{Pubkey: pk, FirebaseUID: "uid-1", Active: true}, nil)
+	lookup.On("TouchLastUsed", mock.Anything, pk, mock.AnythingOfType("time.Time")).Return(nil)
+	m := NewNIP98Middleware(lookup)
+
+	router := gin.New()
+	router.GET("/v1/tracks/my", m.GinMiddleware(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"pubkey": c.GetString("pubkey"), "firebase_uid": c.GetString("firebase_uid")})
+	})
+
+	url := "http://api.example.com/v1/tracks/my"
+	header, err := nostr.NIP98AuthorizationHeader(sk, "GET", url, nil)
+	require.NoError(t, err)
+	req := httptest.NewRequest("GET", url, nil)
+	req.RequestURI = "/v1/tracks/my"
+	req.Header.Set("Authorization", header)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"pubkey":"`+pk+`","firebase_uid":"uid-1"}`, w.Body.String())
+
+	m.Close()
+	lookup.AssertExpectations(t)
+}
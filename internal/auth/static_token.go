@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"crypto/subtle"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/apierror"
+)
+
+// RequireStaticToken rejects requests whose bearer token isn't token, for
+// endpoints read by infrastructure such as a metrics scraper rather than
+// users. An empty token rejects every request.
+func RequireStaticToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		presented := extractBearerToken(c.GetHeader("Authorization"))
+		if presented == "" {
+			apierror.Respond(c, apierror.Unauthorized("Missing authorization token"))
+			return
+		}
+		if token == "" || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			apierror.Respond(c, apierror.Unauthorized("Invalid authorization token"))
+			return
+		}
+		c.Next()
+	}
+}
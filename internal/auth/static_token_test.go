@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireStaticToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	serve := func(token, header string) int {
+		router := gin.New()
+		router.GET("/metrics", RequireStaticToken(token), func(c *gin.Context) { c.Status(http.StatusOK) })
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve("scrape-secret", "Bearer scrape-secret"))
+	assert.Equal(t, http.StatusUnauthorized, serve("scrape-secret", ""))
+	assert.Equal(t, http.StatusUnauthorized, serve("scrape-secret", "Bearer wrong"))
+	assert.Equal(t, http.StatusUnauthorized, serve("", "Bearer "), "an unset token admits no one")
+}
@@ -0,0 +1,97 @@
+// Package bodylimit caps the size of request bodies
+package bodylimit
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"runtime"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/apierror"
+)
+
+// ErrorCodeBodyTooLarge is returned with 413 responses
+const ErrorCodeBodyTooLarge = "request.body_too_large"
+
+// originalBodyKey holds the body before the first Middleware wrapped it
+const originalBodyKey = "bodylimit.original_body"
+
+// passedKey counts the Middlewares a request has been through
+const passedKey = "bodylimit.passed"
+
+// middlewareName is the handler name gin reports for every Middleware
+var middlewareName string
+
+func init() {
+	middlewareName = handlerName(Middleware(0))
+}
+
+// TooLargeDetails is the details of a 413
+type TooLargeDetails struct {
+	LimitBytes int64 `json:"limit_bytes"`
+}
+
+// TooLarge is the 413 for a body over limit bytes
+func TooLarge(limit int64) *apierror.Error {
+	return apierror.New(http.StatusRequestEntityTooLarge, ErrorCodeBodyTooLarge,
+		fmt.Sprintf("request body is over the %s limit", formatBytes(limit))).
+		WithDetails(TooLargeDetails{LimitBytes: limit})
+}
+
+// Middleware limits request bodies to limit bytes. A body whose
+// Content-Length is over it is rejected with TooLarge before the handlers
+// run; a longer body sent without one fails with *http.MaxBytesError when
+// read. A later Middleware on the same route replaces the limit rather than
+// adding to it, so a route can allow more than its group: only the innermost
+// one checks Content-Length.
+func Middleware(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		passed := c.GetInt(passedKey) + 1
+		c.Set(passedKey, passed)
+		if passed == countMiddlewares(c) && c.Request.ContentLength > limit {
+			apierror.Respond(c, TooLarge(limit))
+			return
+		}
+		if c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+
+		body, ok := c.Get(originalBodyKey)
+		if !ok {
+			body = c.Request.Body
+			c.Set(originalBodyKey, body)
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, body.(io.ReadCloser), limit)
+		c.Next()
+	}
+}
+
+// countMiddlewares counts the Middlewares in the request's handler chain
+func countMiddlewares(c *gin.Context) int {
+	count := 0
+	for _, name := range c.HandlerNames() {
+		if name == middlewareName {
+			count++
+		}
+	}
+	return count
+}
+
+func handlerName(handler gin.HandlerFunc) string {
+	return runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+}
+
+// formatBytes writes n in the largest of B, KB and MB that divides it
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%d MB", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%d KB", n>>10)
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
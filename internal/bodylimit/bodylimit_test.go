@@ -0,0 +1,99 @@
+package bodylimit
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serve sends body to a route behind limits and returns the response and
+// what reading the body in the handler returned
+func serve(t *testing.T, body io.Reader, limits ...int64) (*httptest.ResponseRecorder, error) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	var readErr error
+	handlers := []gin.HandlerFunc{}
+	for _, limit := range limits {
+		handlers = append(handlers, Middleware(limit))
+	}
+	handlers = append(handlers, func(c *gin.Context) {
+		_, readErr = io.ReadAll(c.Request.Body)
+		c.Status(http.StatusOK)
+	})
+	router := gin.New()
+	router.POST("/", handlers...)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", body))
+	return w, readErr
+}
+
+func TestMiddlewareRejectsContentLength(t *testing.T) {
+	w, _ := serve(t, strings.NewReader(strings.Repeat("a", 2048)), 1024)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, map[string]interface{}{
+		"code":    ErrorCodeBodyTooLarge,
+		"message": "request body is over the 1 KB limit",
+		"details": map[string]interface{}{"limit_bytes": float64(1024)},
+	}, body["error"])
+}
+
+func TestMiddlewareLimitsReads(t *testing.T) {
+	// No Content-Length, so the handler's read fails instead
+	_, err := serve(t, io.NopCloser(strings.NewReader(strings.Repeat("a", 2048))), 1024)
+	var tooLarge *http.MaxBytesError
+	require.True(t, errors.As(err, &tooLarge))
+	assert.Equal(t, int64(1024), tooLarge.Limit)
+
+	w, err := serve(t, strings.NewReader(strings.Repeat("a", 1024)), 1024)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w, err = serve(t, nil, 1024)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestMiddlewareReplacesLimit(t *testing.T) {
+	body := strings.Repeat("a", 2048)
+
+	w, err := serve(t, io.NopCloser(strings.NewReader(body)), 1024, 4096)
+	assert.NoError(t, err, "the route's limit replaces the group's")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	_, err = serve(t, io.NopCloser(strings.NewReader(body)), 4096, 1024)
+	assert.Error(t, err)
+}
+
+func TestMiddlewareReplacesLimitWithContentLength(t *testing.T) {
+	body := strings.Repeat("a", 2048)
+
+	w, err := serve(t, strings.NewReader(body), 1024, 4096)
+	assert.NoError(t, err, "the route's limit replaces the group's")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w, _ = serve(t, strings.NewReader(body), 4096, 1024)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	w, _ = serve(t, strings.NewReader(strings.Repeat("a", 8192)), 1024, 4096)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "16 KB", formatBytes(16<<10))
+	assert.Equal(t, "1 MB", formatBytes(1<<20))
+	assert.Equal(t, "1536 KB", formatBytes(1536<<10))
+	assert.Equal(t, "1000 B", formatBytes(1000))
+}
@@ -0,0 +1,396 @@
+// Package config loads the settings read from the environment at startup.
+// Load validates every value so a bad deploy fails before serving traffic.
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wavlake/api/internal/auth"
+	"github.com/wavlake/api/internal/ratelimit"
+	"github.com/wavlake/api/internal/services"
+	"github.com/wavlake/api/internal/utils"
+	"github.com/wavlake/api/pkg/nostr"
+)
+
+// Defaults used when the corresponding variable is unset, taken from the
+// packages that apply them
+const (
+	DefaultNIP98TimestampTolerance = auth.DefaultTimestampTolerance
+	DefaultPresignedURLExpiry      = services.DefaultPresignedURLExpiry
+	DefaultProcessingTimeout       = services.DefaultProcessingTimeout
+	DefaultPreviewLength           = services.DefaultPreviewLength
+	DefaultMaxTrackDuration        = services.DefaultMaxTrackDuration
+	DefaultStuckProcessingAfter    = services.DefaultStuckProcessingThreshold
+	DefaultTempFileMaxAge          = services.DefaultTempFileMaxAge
+	DefaultRelayPublishTimeout     = nostr.DefaultRelayTimeout
+	DefaultPanicAlertInterval      = 5 * time.Minute
+)
+
+// Limits on configured values
+const (
+	MaxNIP98TimestampTolerance = 10 * time.Minute
+	MaxPresignedURLExpiry      = 7 * 24 * time.Hour // Longest a GCS V4 signed URL may last
+	MaxProcessingTimeout       = 6 * time.Hour
+	MaxPreviewLength           = 5 * time.Minute
+	MaxMaxTrackDuration        = 24 * time.Hour
+	MaxStuckProcessingAfter    = 7 * 24 * time.Hour
+	MaxStuckReconcileInterval  = 24 * time.Hour
+	MaxTempFileMaxAge          = 7 * 24 * time.Hour
+	MaxRelayPublishTimeout     = time.Minute
+	MaxPublishRelays           = 20
+	MaxPanicAlertInterval      = 24 * time.Hour
+)
+
+// Default per-caller rate limits, each a burst refilled over the period
+var (
+	DefaultTrackCreateRateLimit = ratelimit.Limit{Requests: 30, Per: time.Minute}
+	DefaultCompressionRateLimit = ratelimit.Limit{Requests: 10, Per: time.Minute}
+	DefaultProcessingRateLimit  = ratelimit.Limit{Requests: 10, Per: time.Minute}
+	// Bulk pubkey link checks are unauthenticated, so they're limited per IP
+	DefaultPubkeyLookupRateLimit = ratelimit.Limit{Requests: 30, Per: time.Minute}
+)
+
+// DefaultCORSOrigins are the browser origins allowed when CORS_ALLOWED_ORIGINS
+// is unset
+var DefaultCORSOrigins = []string{
+	"http://localhost:8080",                           // Development
+	"http://localhost:3000",                           // Alternative dev port
+	"http://localhost:8083",                           // Another dev port
+	"https://wavlake.com",                             // Production
+	"https://*.wavlake.com",                           // Subdomains
+	"https://web-wavlake.vercel.app",                  // Vercel main deployment
+	"https://web-git-auth-updates-wavlake.vercel.app", // Vercel auth-updates branch
+	"https://*.vercel.app",                            // All Vercel preview deployments
+}
+
+// Config holds the validated startup settings
+type Config struct {
+	// CORSOrigins are the allowed browser origins. An origin may start its
+	// host with "*." to allow every subdomain.
+	CORSOrigins []string
+
+	// NIP98TimestampTolerance is how far a NIP-98 event's created_at may be
+	// from the server's clock, either way
+	NIP98TimestampTolerance time.Duration
+
+	// PresignedURLExpiry is how long upload URLs from track creation work
+	PresignedURLExpiry time.Duration
+
+	// ProcessingTimeout bounds one processing or compression attempt
+	ProcessingTimeout time.Duration
+
+	// PreviewLength is how long the preview clips made during processing run
+	PreviewLength time.Duration
+
+	// MaxTrackDuration is the longest original processing accepts
+	MaxTrackDuration time.Duration
+
+	// StuckProcessingAfter is how long a track may stay processing before the
+	// stuck-track reconciler repairs, requeues or fails it. It must outlast
+	// ProcessingTimeout so running attempts aren't taken over.
+	StuckProcessingAfter time.Duration
+
+	// StuckReconcileInterval is how often the reconciler runs on its own; zero
+	// leaves it to the admin endpoint
+	StuckReconcileInterval time.Duration
+
+	// TempFileMaxAge is how old a processing temp file must be before the
+	// startup sweep removes it as left behind by a crash
+	TempFileMaxAge time.Duration
+
+	// Per-pubkey (or per-IP) limits on track creation and import, compression
+	// requests, and manual processing triggers
+	TrackCreateRateLimit ratelimit.Limit
+	CompressionRateLimit ratelimit.Limit
+	ProcessingRateLimit  ratelimit.Limit
+
+	// PubkeyLookupRateLimit is the per-IP limit on bulk pubkey link checks
+	PubkeyLookupRateLimit ratelimit.Limit
+
+	// AudioFormats are the extensions new tracks and imports may use, a
+	// subset of utils.AudioFormats
+	AudioFormats []string
+
+	// PublishRelays are the relays POST /v1/tracks/:id/publish sends events
+	// to; empty turns server-side publishing off
+	PublishRelays []string
+
+	// RelayPublishTimeout bounds publishing to one relay
+	RelayPublishTimeout time.Duration
+
+	// LegacyErrorEnvelope renders errors with the message as the "error"
+	// string, for clients not yet reading error.code and error.message
+	LegacyErrorEnvelope bool
+
+	// PanicAlertWebhookURL receives an alert when a request or background
+	// job panics, such as a Slack incoming webhook; empty only logs panics
+	PanicAlertWebhookURL string
+
+	// PanicAlertInterval is the least time between two panic alerts
+	PanicAlertInterval time.Duration
+
+	// MetricsToken is the bearer token GET /metrics requires; empty leaves
+	// the endpoint out
+	MetricsToken string
+
+	// WebhookSecret signs processing webhooks; empty leaves them
+	// unauthenticated
+	WebhookSecret string
+
+	// WebhookAcceptLegacySecret also accepts unsigned processing webhooks
+	// carrying WebhookSecret in X-Webhook-Secret, while senders move to
+	// signatures
+	WebhookAcceptLegacySecret bool
+}
+
+// Load reads and validates:
+//
+//	CORS_ALLOWED_ORIGINS       comma-separated origins (default DefaultCORSOrigins)
+//	NIP98_TIMESTAMP_TOLERANCE  duration such as "90s", or whole seconds (default 60s)
+//	PRESIGNED_URL_EXPIRY       duration or seconds (default 1h)
+//	PROCESSING_TIMEOUT         duration or seconds (default 10m)
+//	PREVIEW_LENGTH             duration or seconds (default 30s)
+//	MAX_TRACK_DURATION         duration or seconds (default 2h)
+//	STUCK_PROCESSING_AFTER     duration or seconds, longer than PROCESSING_TIMEOUT (default 30m)
+//	STUCK_RECONCILE_INTERVAL   duration or seconds (default unset, no periodic runs)
+//	TEMP_FILE_MAX_AGE          duration or seconds (default 6h)
+//	RATE_LIMIT_TRACK_CREATE    requests/period such as "30/1m", or "off"
+//	RATE_LIMIT_COMPRESSION     (default 10/1m)
+//	RATE_LIMIT_PROCESSING      (default 10/1m)
+//	RATE_LIMIT_PUBKEY_LOOKUP   (default 30/1m)
+//	ALLOWED_AUDIO_FORMATS      comma-separated extensions (default utils.AudioFormats)
+//	PUBLISH_RELAYS             comma-separated ws:// or wss:// URLs (default unset, no server-side publishing)
+//	RELAY_PUBLISH_TIMEOUT      duration or seconds (default 10s)
+//	LEGACY_ERROR_ENVELOPE      true or false (default false)
+//	PANIC_ALERT_WEBHOOK_URL    http:// or https:// URL (default unset, no alerts)
+//	PANIC_ALERT_INTERVAL       duration or seconds (default 5m)
+//	METRICS_TOKEN              bearer token for /metrics (default unset, no /metrics)
+//	WEBHOOK_SECRET             processing webhook signing secret (default unset, unauthenticated)
+//	WEBHOOK_ACCEPT_LEGACY_SECRET true or false (default false)
+func Load() (*Config, error) {
+	cfg := &Config{}
+
+	var err error
+	if cfg.CORSOrigins, err = corsOriginsFromEnv("CORS_ALLOWED_ORIGINS"); err != nil {
+		return nil, err
+	}
+	if cfg.NIP98TimestampTolerance, err = durationFromEnv("NIP98_TIMESTAMP_TOLERANCE", DefaultNIP98TimestampTolerance, MaxNIP98TimestampTolerance); err != nil {
+		return nil, err
+	}
+	if cfg.PresignedURLExpiry, err = durationFromEnv("PRESIGNED_URL_EXPIRY", DefaultPresignedURLExpiry, MaxPresignedURLExpiry); err != nil {
+		return nil, err
+	}
+	if cfg.ProcessingTimeout, err = durationFromEnv("PROCESSING_TIMEOUT", DefaultProcessingTimeout, MaxProcessingTimeout); err != nil {
+		return nil, err
+	}
+	if cfg.PreviewLength, err = durationFromEnv("PREVIEW_LENGTH", DefaultPreviewLength, MaxPreviewLength); err != nil {
+		return nil, err
+	}
+	if cfg.MaxTrackDuration, err = durationFromEnv("MAX_TRACK_DURATION", DefaultMaxTrackDuration, MaxMaxTrackDuration); err != nil {
+		return nil, err
+	}
+	if cfg.StuckProcessingAfter, err = durationFromEnv("STUCK_PROCESSING_AFTER", DefaultStuckProcessingAfter, MaxStuckProcessingAfter); err != nil {
+		return nil, err
+	}
+	if cfg.StuckProcessingAfter <= cfg.ProcessingTimeout {
+		return nil, fmt.Errorf("STUCK_PROCESSING_AFTER: %s must be longer than PROCESSING_TIMEOUT (%s)", cfg.StuckProcessingAfter, cfg.ProcessingTimeout)
+	}
+	if cfg.StuckReconcileInterval, err = durationFromEnv("STUCK_RECONCILE_INTERVAL", 0, MaxStuckReconcileInterval); err != nil {
+		return nil, err
+	}
+	if cfg.TempFileMaxAge, err = durationFromEnv("TEMP_FILE_MAX_AGE", DefaultTempFileMaxAge, MaxTempFileMaxAge); err != nil {
+		return nil, err
+	}
+	if cfg.TrackCreateRateLimit, err = rateLimitFromEnv("RATE_LIMIT_TRACK_CREATE", DefaultTrackCreateRateLimit); err != nil {
+		return nil, err
+	}
+	if cfg.CompressionRateLimit, err = rateLimitFromEnv("RATE_LIMIT_COMPRESSION", DefaultCompressionRateLimit); err != nil {
+		return nil, err
+	}
+	if cfg.ProcessingRateLimit, err = rateLimitFromEnv("RATE_LIMIT_PROCESSING", DefaultProcessingRateLimit); err != nil {
+		return nil, err
+	}
+	if cfg.PubkeyLookupRateLimit, err = rateLimitFromEnv("RATE_LIMIT_PUBKEY_LOOKUP", DefaultPubkeyLookupRateLimit); err != nil {
+		return nil, err
+	}
+	if cfg.AudioFormats, err = audioFormatsFromEnv("ALLOWED_AUDIO_FORMATS"); err != nil {
+		return nil, err
+	}
+	if cfg.PublishRelays, err = relaysFromEnv("PUBLISH_RELAYS"); err != nil {
+		return nil, err
+	}
+	if cfg.RelayPublishTimeout, err = durationFromEnv("RELAY_PUBLISH_TIMEOUT", DefaultRelayPublishTimeout, MaxRelayPublishTimeout); err != nil {
+		return nil, err
+	}
+	if cfg.LegacyErrorEnvelope, err = boolFromEnv("LEGACY_ERROR_ENVELOPE"); err != nil {
+		return nil, err
+	}
+	if cfg.PanicAlertWebhookURL, err = webhookURLFromEnv("PANIC_ALERT_WEBHOOK_URL"); err != nil {
+		return nil, err
+	}
+	if cfg.PanicAlertInterval, err = durationFromEnv("PANIC_ALERT_INTERVAL", DefaultPanicAlertInterval, MaxPanicAlertInterval); err != nil {
+		return nil, err
+	}
+	cfg.MetricsToken = strings.TrimSpace(os.Getenv("METRICS_TOKEN"))
+	cfg.WebhookSecret = os.Getenv("WEBHOOK_SECRET")
+	if cfg.WebhookAcceptLegacySecret, err = boolFromEnv("WEBHOOK_ACCEPT_LEGACY_SECRET"); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// relaysFromEnv parses key as a comma-separated list of relay URLs, up to
+// MaxPublishRelays
+func relaysFromEnv(key string) ([]string, error) {
+	var relays []string
+	for _, relay := range strings.Split(os.Getenv(key), ",") {
+		relay = strings.TrimSuffix(strings.TrimSpace(relay), "/")
+		if relay == "" || slices.Contains(relays, relay) {
+			continue
+		}
+		if err := nostr.ValidateRelayURL(relay); err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		relays = append(relays, relay)
+	}
+	if len(relays) > MaxPublishRelays {
+		return nil, fmt.Errorf("%s: at most %d relays, got %d", key, MaxPublishRelays, len(relays))
+	}
+	return relays, nil
+}
+
+// audioFormatsFromEnv parses key as a comma-separated list of extensions,
+// each one of utils.AudioFormats
+func audioFormatsFromEnv(key string) ([]string, error) {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return utils.AudioFormats, nil
+	}
+
+	var formats []string
+	for _, format := range strings.Split(raw, ",") {
+		format = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(format), "."))
+		if format == "" || slices.Contains(formats, format) {
+			continue
+		}
+		if !slices.Contains(utils.AudioFormats, format) {
+			return nil, fmt.Errorf("%s: %q is not a known audio format (known: %s)", key, format, strings.Join(utils.AudioFormats, ", "))
+		}
+		formats = append(formats, format)
+	}
+	if len(formats) == 0 {
+		return nil, fmt.Errorf("%s: no formats given", key)
+	}
+	return formats, nil
+}
+
+// rateLimitFromEnv parses key with ratelimit.ParseLimit
+func rateLimitFromEnv(key string, defaultValue ratelimit.Limit) (ratelimit.Limit, error) {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return defaultValue, nil
+	}
+	limit, err := ratelimit.ParseLimit(raw)
+	if err != nil {
+		return ratelimit.Limit{}, fmt.Errorf("%s: %w", key, err)
+	}
+	return limit, nil
+}
+
+// durationFromEnv parses key as a Go duration or a whole number of seconds,
+// between one second and max
+func durationFromEnv(key string, defaultValue, max time.Duration) (time.Duration, error) {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return defaultValue, nil
+	}
+
+	var value time.Duration
+	if seconds, err := strconv.Atoi(raw); err == nil {
+		value = time.Duration(seconds) * time.Second
+	} else if value, err = time.ParseDuration(raw); err != nil {
+		return 0, fmt.Errorf("%s: %q is not a duration (use e.g. \"90s\" or \"90\")", key, raw)
+	}
+
+	if value < time.Second || value > max {
+		return 0, fmt.Errorf("%s: %s must be between 1s and %s", key, value, max)
+	}
+	return value, nil
+}
+
+// boolFromEnv parses key as a boolean, false when unset
+func boolFromEnv(key string) (bool, error) {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return false, nil
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("%s: %q must be true or false", key, raw)
+	}
+	return value, nil
+}
+
+// webhookURLFromEnv parses key as an optional http:// or https:// URL
+func webhookURLFromEnv(key string) (string, error) {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return "", nil
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", fmt.Errorf("%s: must be an http:// or https:// URL", key)
+	}
+	return raw, nil
+}
+
+// corsOriginsFromEnv parses key as a comma-separated list of origins
+func corsOriginsFromEnv(key string) ([]string, error) {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return DefaultCORSOrigins, nil
+	}
+
+	var origins []string
+	for _, origin := range strings.Split(raw, ",") {
+		origin = strings.TrimSpace(origin)
+		if origin == "" {
+			continue
+		}
+		if err := validateOrigin(origin); err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		origins = append(origins, strings.TrimSuffix(origin, "/"))
+	}
+	if len(origins) == 0 {
+		return nil, fmt.Errorf("%s: no origins given", key)
+	}
+	return origins, nil
+}
+
+// validateOrigin accepts scheme://host[:port], where host may start with "*."
+// to match any subdomain. A bare "*" isn't allowed because requests carry
+// credentials.
+func validateOrigin(origin string) error {
+	scheme, host, ok := strings.Cut(origin, "://")
+	if !ok || (scheme != "http" && scheme != "https") {
+		return fmt.Errorf("origin %q must start with http:// or https://", origin)
+	}
+	host = strings.TrimSuffix(host, "/")
+	if host == "" || strings.ContainsAny(host, "/?# ") {
+		return fmt.Errorf("origin %q must be a scheme and host with no path", origin)
+	}
+	if strings.Contains(host, "*") {
+		rest, wildcard := strings.CutPrefix(host, "*.")
+		if !wildcard || rest == "" || strings.Contains(rest, "*") {
+			return fmt.Errorf("origin %q may only use * as its first label, as in https://*.example.com", origin)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/ratelimit"
+	"github.com/wavlake/api/internal/utils"
+)
+
+func clearEnv(t *testing.T) {
+	for _, key := range []string{"CORS_ALLOWED_ORIGINS", "NIP98_TIMESTAMP_TOLERANCE", "PRESIGNED_URL_EXPIRY", "PROCESSING_TIMEOUT", "PREVIEW_LENGTH", "MAX_TRACK_DURATION",
+		"STUCK_PROCESSING_AFTER", "STUCK_RECONCILE_INTERVAL", "TEMP_FILE_MAX_AGE",
+		"RATE_LIMIT_TRACK_CREATE", "RATE_LIMIT_COMPRESSION", "RATE_LIMIT_PROCESSING", "RATE_LIMIT_PUBKEY_LOOKUP",
+		"ALLOWED_AUDIO_FORMATS", "PUBLISH_RELAYS", "RELAY_PUBLISH_TIMEOUT", "LEGACY_ERROR_ENVELOPE",
+		"PANIC_ALERT_WEBHOOK_URL", "PANIC_ALERT_INTERVAL", "WEBHOOK_SECRET", "WEBHOOK_ACCEPT_LEGACY_SECRET"} {
+		t.Setenv(key, "")
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	clearEnv(t)
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultCORSOrigins, cfg.CORSOrigins)
+	assert.Equal(t, DefaultNIP98TimestampTolerance, cfg.NIP98TimestampTolerance)
+	assert.Equal(t, DefaultPresignedURLExpiry, cfg.PresignedURLExpiry)
+	assert.Equal(t, DefaultProcessingTimeout, cfg.ProcessingTimeout)
+	assert.Equal(t, DefaultPreviewLength, cfg.PreviewLength)
+	assert.Equal(t, DefaultMaxTrackDuration, cfg.MaxTrackDuration)
+	assert.Equal(t, DefaultStuckProcessingAfter, cfg.StuckProcessingAfter)
+	assert.Zero(t, cfg.StuckReconcileInterval)
+	assert.Equal(t, DefaultTempFileMaxAge, cfg.TempFileMaxAge)
+	assert.Equal(t, DefaultTrackCreateRateLimit, cfg.TrackCreateRateLimit)
+	assert.Equal(t, DefaultCompressionRateLimit, cfg.CompressionRateLimit)
+	assert.Equal(t, DefaultProcessingRateLimit, cfg.ProcessingRateLimit)
+	assert.Equal(t, DefaultPubkeyLookupRateLimit, cfg.PubkeyLookupRateLimit)
+	assert.Equal(t, utils.AudioFormats, cfg.AudioFormats)
+	assert.Empty(t, cfg.PublishRelays)
+	assert.Equal(t, DefaultRelayPublishTimeout, cfg.RelayPublishTimeout)
+	assert.False(t, cfg.LegacyErrorEnvelope)
+	assert.Empty(t, cfg.PanicAlertWebhookURL)
+	assert.Equal(t, DefaultPanicAlertInterval, cfg.PanicAlertInterval)
+	assert.Empty(t, cfg.WebhookSecret)
+	assert.False(t, cfg.WebhookAcceptLegacySecret)
+}
+
+func TestLoadValues(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("CORS_ALLOWED_ORIGINS", " https://wavlake.com/, https://*.example.com ,http://localhost:3000,")
+	t.Setenv("NIP98_TIMESTAMP_TOLERANCE", "90s")
+	t.Setenv("PRESIGNED_URL_EXPIRY", "7200")
+	t.Setenv("PROCESSING_TIMEOUT", "30m")
+	t.Setenv("PREVIEW_LENGTH", "45")
+	t.Setenv("MAX_TRACK_DURATION", "5400")
+	t.Setenv("STUCK_PROCESSING_AFTER", "2h")
+	t.Setenv("STUCK_RECONCILE_INTERVAL", "15m")
+	t.Setenv("TEMP_FILE_MAX_AGE", "24h")
+	t.Setenv("RATE_LIMIT_TRACK_CREATE", "100/1h")
+	t.Setenv("RATE_LIMIT_COMPRESSION", "off")
+	t.Setenv("RATE_LIMIT_PUBKEY_LOOKUP", "5/10s")
+	t.Setenv("ALLOWED_AUDIO_FORMATS", "MP3, .flac,wav,mp3,")
+	t.Setenv("PUBLISH_RELAYS", "wss://relay.wavlake.com/, wss://nos.lol,,wss://relay.wavlake.com")
+	t.Setenv("RELAY_PUBLISH_TIMEOUT", "5")
+	t.Setenv("LEGACY_ERROR_ENVELOPE", "true")
+	t.Setenv("PANIC_ALERT_WEBHOOK_URL", " https://hooks.slack.com/services/T000/B000/XXXX ")
+	t.Setenv("PANIC_ALERT_INTERVAL", "1m")
+	t.Setenv("WEBHOOK_SECRET", "webhook-secret")
+	t.Setenv("WEBHOOK_ACCEPT_LEGACY_SECRET", "1")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://wavlake.com", "https://*.example.com", "http://localhost:3000"}, cfg.CORSOrigins)
+	assert.Equal(t, 90*time.Second, cfg.NIP98TimestampTolerance)
+	assert.Equal(t, 2*time.Hour, cfg.PresignedURLExpiry)
+	assert.Equal(t, 30*time.Minute, cfg.ProcessingTimeout)
+	assert.Equal(t, 45*time.Second, cfg.PreviewLength)
+	assert.Equal(t, 90*time.Minute, cfg.MaxTrackDuration)
+	assert.Equal(t, 2*time.Hour, cfg.StuckProcessingAfter)
+	assert.Equal(t, 15*time.Minute, cfg.StuckReconcileInterval)
+	assert.Equal(t, 24*time.Hour, cfg.TempFileMaxAge)
+	assert.Equal(t, ratelimit.Limit{Requests: 100, Per: time.Hour}, cfg.TrackCreateRateLimit)
+	assert.False(t, cfg.CompressionRateLimit.Enabled())
+	assert.Equal(t, ratelimit.Limit{Requests: 5, Per: 10 * time.Second}, cfg.PubkeyLookupRateLimit)
+	assert.Equal(t, []string{"mp3", "flac", "wav"}, cfg.AudioFormats)
+	assert.Equal(t, []string{"wss://relay.wavlake.com", "wss://nos.lol"}, cfg.PublishRelays)
+	assert.Equal(t, 5*time.Second, cfg.RelayPublishTimeout)
+	assert.True(t, cfg.LegacyErrorEnvelope)
+	assert.Equal(t, "https://hooks.slack.com/services/T000/B000/XXXX", cfg.PanicAlertWebhookURL)
+	assert.Equal(t, time.Minute, cfg.PanicAlertInterval)
+	assert.Equal(t, "webhook-secret", cfg.WebhookSecret)
+	assert.True(t, cfg.WebhookAcceptLegacySecret)
+}
+
+// manyRelays returns n distinct relay URLs, comma-separated
+func manyRelays(n int) string {
+	relays := make([]string, n)
+	for i := range relays {
+		relays[i] = fmt.Sprintf("wss://relay%d.example.com", i)
+	}
+	return strings.Join(relays, ",")
+}
+
+func TestLoadRejectsMalformedValues(t *testing.T) {
+	tests := []struct {
+		key, value string
+	}{
+		{"NIP98_TIMESTAMP_TOLERANCE", "a minute"},
+		{"NIP98_TIMESTAMP_TOLERANCE", "0"},
+		{"NIP98_TIMESTAMP_TOLERANCE", "-30s"},
+		{"NIP98_TIMESTAMP_TOLERANCE", "1h"},
+		{"PRESIGNED_URL_EXPIRY", "500ms"},
+		{"PRESIGNED_URL_EXPIRY", "8d"},
+		{"PRESIGNED_URL_EXPIRY", "200h"},
+		{"PROCESSING_TIMEOUT", "12h"},
+		{"PREVIEW_LENGTH", "10m"},
+		{"MAX_TRACK_DURATION", "48h"},
+		{"STUCK_PROCESSING_AFTER", "5m"},
+		{"STUCK_RECONCILE_INTERVAL", "48h"},
+		{"TEMP_FILE_MAX_AGE", "30d"},
+		{"CORS_ALLOWED_ORIGINS", "*"},
+		{"CORS_ALLOWED_ORIGINS", ","},
+		{"CORS_ALLOWED_ORIGINS", "wavlake.com"},
+		{"CORS_ALLOWED_ORIGINS", "ftp://wavlake.com"},
+		{"CORS_ALLOWED_ORIGINS", "https://wavlake.com/app"},
+		{"CORS_ALLOWED_ORIGINS", "https://app.*.wavlake.com"},
+		{"CORS_ALLOWED_ORIGINS", "https://*"},
+		{"RATE_LIMIT_PROCESSING", "10"},
+		{"RATE_LIMIT_COMPRESSION", "0/1m"},
+		{"RATE_LIMIT_PUBKEY_LOOKUP", "lots"},
+		{"ALLOWED_AUDIO_FORMATS", "mp3,exe"},
+		{"ALLOWED_AUDIO_FORMATS", " , "},
+		{"PUBLISH_RELAYS", "https://relay.wavlake.com"},
+		{"PUBLISH_RELAYS", "wss://"},
+		{"PUBLISH_RELAYS", manyRelays(MaxPublishRelays + 1)},
+		{"RELAY_PUBLISH_TIMEOUT", "5m"},
+		{"LEGACY_ERROR_ENVELOPE", "sometimes"},
+		{"PANIC_ALERT_WEBHOOK_URL", "hooks.slack.com/services/T000"},
+		{"PANIC_ALERT_WEBHOOK_URL", "https://"},
+		{"PANIC_ALERT_INTERVAL", "48h"},
+		{"WEBHOOK_ACCEPT_LEGACY_SECRET", "yes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key+"="+tt.value, func(t *testing.T) {
+			clearEnv(t)
+			t.Setenv(tt.key, tt.value)
+
+			_, err := Load()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.key)
+		})
+	}
+}
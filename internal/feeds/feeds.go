@@ -0,0 +1,315 @@
+// Package feeds renders a pubkey's public tracks as an RSS feed with
+// Podcasting 2.0 tags, so podcast apps can follow an artist. Renders are
+// cached per pubkey and reused until the tracks or profile behind them change.
+package feeds
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/utils"
+	"github.com/wavlake/api/pkg/nostr"
+)
+
+// ContentType is the media type of a rendered feed
+const ContentType = "application/rss+xml; charset=utf-8"
+
+// maxCachedFeeds bounds how many renders the cache holds; beyond it an
+// arbitrary entry is evicted
+const maxCachedFeeds = 1000
+
+var (
+	// ErrInvalidPubkey is returned for a pubkey that isn't hex or an npub
+	ErrInvalidPubkey = errors.New("invalid pubkey")
+	// ErrFeedNotFound is returned for a pubkey with no tracks and no linked account
+	ErrFeedNotFound = errors.New("feed not found")
+)
+
+// TrackLister lists a pubkey's non-deleted tracks, newest first, with their
+// compression versions
+type TrackLister interface {
+	GetTracksByPubkey(ctx context.Context, pubkey string) ([]*models.NostrTrack, error)
+}
+
+// UserLookup finds the account linked to a pubkey and its profile
+type UserLookup interface {
+	GetFirebaseUIDByPubkey(ctx context.Context, pubkey string) (string, error)
+	GetOrCreateUser(ctx context.Context, firebaseUID string) (*models.User, error)
+}
+
+// Feed is a rendered feed and its ETag
+type Feed struct {
+	ETag string
+	Body []byte
+}
+
+// Generator renders feeds
+type Generator struct {
+	tracks     TrackLister
+	users      UserLookup
+	publicURLs *utils.PublicURLConfig
+
+	mu    sync.Mutex
+	cache map[string]*Feed // By pubkey
+}
+
+// NewGenerator creates a feed generator. publicURLs may be nil, in which case
+// the feed's self link is relative.
+func NewGenerator(tracks TrackLister, users UserLookup, publicURLs *utils.PublicURLConfig) *Generator {
+	return &Generator{
+		tracks:     tracks,
+		users:      users,
+		publicURLs: publicURLs,
+		cache:      make(map[string]*Feed),
+	}
+}
+
+// NormalizePubkey returns the lowercase hex form of a pubkey given as hex or
+// npub, or ErrInvalidPubkey
+func NormalizePubkey(pubkey string) (string, error) {
+	pubkey, err := nostr.NormalizePubkey(strings.TrimSpace(pubkey))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidPubkey, err)
+	}
+	pubkey = strings.ToLower(pubkey)
+	if _, err := nostr.EncodeNpub(pubkey); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidPubkey, err)
+	}
+	return pubkey, nil
+}
+
+// Path returns the API path of a pubkey's feed
+func Path(pubkey string) string {
+	return "/v1/feeds/pubkey/" + pubkey + ".xml"
+}
+
+// Feed returns the feed for a hex pubkey. The tracks and profile are read on
+// every call, but the XML is only rebuilt when they produce a new ETag: a
+// hash of the latest track change, the number of tracks in the feed and the
+// profile fields it shows.
+func (g *Generator) Feed(ctx context.Context, pubkey string) (*Feed, error) {
+	tracks, err := g.tracks.GetTracksByPubkey(ctx, pubkey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tracks: %w", err)
+	}
+	user := g.lookupUser(ctx, pubkey)
+	if len(tracks) == 0 && user == nil {
+		return nil, ErrFeedNotFound
+	}
+
+	var entries []entry
+	for _, track := range tracks {
+		if e, ok := feedEntry(track); ok {
+			entries = append(entries, e)
+		}
+	}
+	if user == nil {
+		user = &models.User{}
+	}
+
+	etag := feedETag(pubkey, entries, user)
+	g.mu.Lock()
+	cached := g.cache[pubkey]
+	g.mu.Unlock()
+	if cached != nil && cached.ETag == etag {
+		return cached, nil
+	}
+
+	body, err := g.render(pubkey, entries, user, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	feed := &Feed{ETag: etag, Body: body}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.cache[pubkey]; !ok && len(g.cache) >= maxCachedFeeds {
+		for evict := range g.cache {
+			delete(g.cache, evict)
+			break
+		}
+	}
+	g.cache[pubkey] = feed
+	return feed, nil
+}
+
+// lookupUser returns the profile of the account linked to pubkey, or nil if
+// there is none. A lookup that fails renders the feed without the profile;
+// the ETag changes once it succeeds again.
+func (g *Generator) lookupUser(ctx context.Context, pubkey string) *models.User {
+	firebaseUID, err := g.users.GetFirebaseUIDByPubkey(ctx, pubkey)
+	if err != nil {
+		return nil
+	}
+	user, err := g.users.GetOrCreateUser(ctx, firebaseUID)
+	if err != nil {
+		log.Printf("Failed to load profile for feed of %s: %v", pubkey, err)
+		return nil
+	}
+	return user
+}
+
+// entry is a track in the feed with the version its enclosure points at
+type entry struct {
+	track   *models.NostrTrack
+	version models.CompressionVersion
+}
+
+// feedEntry returns a track's feed entry. Only ready tracks with a public MP3
+// version are listed, enclosing the one with the highest bitrate.
+func feedEntry(track *models.NostrTrack) (entry, bool) {
+	if track.Status != models.TrackStatusReady || track.Deleted {
+		return entry{}, false
+	}
+	var best *models.CompressionVersion
+	for i, version := range track.CompressionVersions {
+		if !version.Available() || !strings.EqualFold(version.Format, "mp3") {
+			continue
+		}
+		if best == nil || version.Bitrate > best.Bitrate {
+			best = &track.CompressionVersions[i]
+		}
+	}
+	if best == nil {
+		return entry{}, false
+	}
+	return entry{track: track, version: *best}, true
+}
+
+func feedETag(pubkey string, entries []entry, user *models.User) string {
+	var latest time.Time
+	for _, e := range entries {
+		if e.track.UpdatedAt.After(latest) {
+			latest = e.track.UpdatedAt
+		}
+	}
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		pubkey,
+		latest.UTC().Format(time.RFC3339Nano),
+		fmt.Sprint(len(entries)),
+		user.DisplayName,
+		user.LightningAddress,
+		user.AvatarURL,
+	}, "\x00")))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+func (g *Generator) render(pubkey string, entries []entry, user *models.User, now time.Time) ([]byte, error) {
+	selfURL := g.publicURLs.APIURL(Path(pubkey))
+	name := user.DisplayName
+	if name == "" {
+		name = nostr.DisplayPubkey(pubkey)
+	}
+
+	ch := channel{
+		Title:          name,
+		Link:           selfURL,
+		Description:    "Music by " + name + " on Wavlake",
+		AtomLink:       atomLink{Href: selfURL, Rel: "self", Type: "application/rss+xml"},
+		ItunesAuthor:   name,
+		ItunesExplicit: "false",
+		Medium:         "music",
+		GUID:           podcastGUID(selfURL),
+	}
+	if len(entries) > 0 {
+		ch.LastBuildDate = now.UTC().Format(time.RFC1123Z)
+	}
+	if user.AvatarURL != "" {
+		ch.Image = &image{URL: user.AvatarURL, Title: name, Link: selfURL}
+		ch.ItunesImage = &itunesImage{Href: user.AvatarURL}
+	}
+	if user.LightningAddress != "" {
+		ch.Value = &podcastValue{
+			Type:   "lightning",
+			Method: "lnaddress",
+			Recipients: []valueRecipient{{
+				Name:    name,
+				Type:    "lnaddress",
+				Address: user.LightningAddress,
+				Split:   100,
+			}},
+		}
+	}
+	for _, e := range entries {
+		ch.Items = append(ch.Items, feedItem(e))
+	}
+
+	body, err := xml.MarshalIndent(rss{
+		Version:   "2.0",
+		ItunesNS:  itunesNamespace,
+		PodcastNS: podcastNamespace,
+		AtomNS:    atomNamespace,
+		Channel:   ch,
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to render feed: %w", err)
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+func feedItem(e entry) item {
+	track := e.track
+	title := track.Title
+	if title == "" {
+		title = "Untitled"
+	}
+	published := track.CreatedAt
+	if track.PublishedAt != nil {
+		published = *track.PublishedAt
+	}
+
+	it := item{
+		Title:          title,
+		GUID:           guid{Value: track.ID},
+		PubDate:        published.UTC().Format(time.RFC1123Z),
+		Description:    trackDescription(track),
+		Enclosure:      enclosure{URL: e.version.URL, Length: e.version.Size, Type: "audio/mpeg"},
+		ItunesAuthor:   track.Artist,
+		ItunesDuration: track.Duration,
+	}
+	if track.ArtworkURL != "" {
+		it.ItunesImage = &itunesImage{Href: track.ArtworkURL}
+	}
+	return it
+}
+
+// trackDescription describes a track by its album and genre, when known
+func trackDescription(track *models.NostrTrack) string {
+	var parts []string
+	if track.Album != "" {
+		parts = append(parts, "From "+track.Album)
+	}
+	if track.Genre != "" {
+		parts = append(parts, track.Genre)
+	}
+	return strings.Join(parts, " · ")
+}
+
+// podcastGUID derives the feed's podcast:guid from its URL without the scheme
+// or trailing slashes, as the Podcasting 2.0 spec describes
+func podcastGUID(feedURL string) string {
+	_, rest, ok := strings.Cut(feedURL, "://")
+	if !ok {
+		rest = feedURL
+	}
+	return uuid.NewSHA1(uuid.MustParse(podcastGUIDNamespace), []byte(strings.TrimRight(rest, "/"))).String()
+}
+
+// ErrorBody is the XML body for a failed feed request
+func ErrorBody(message string) []byte {
+	body, err := xml.Marshal(feedError{Message: message})
+	if err != nil {
+		return []byte(xml.Header + "<error></error>")
+	}
+	return append([]byte(xml.Header), body...)
+}
@@ -0,0 +1,197 @@
+package feeds
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/utils"
+)
+
+const testPubkey = "7e7e9c42a91bfef19fa929e5fda1b72e0ebc1a4c1141673e2794234d86addf4e"
+
+type fakeTracks struct {
+	tracks []*models.NostrTrack
+	err    error
+}
+
+func (f *fakeTracks) GetTracksByPubkey(ctx context.Context, pubkey string) ([]*models.NostrTrack, error) {
+	return f.tracks, f.err
+}
+
+type fakeUsers struct {
+	users map[string]*models.User // By pubkey
+}
+
+func (f *fakeUsers) GetFirebaseUIDByPubkey(ctx context.Context, pubkey string) (string, error) {
+	if f.users[pubkey] == nil {
+		return "", errors.New("pubkey not found")
+	}
+	return "uid-" + pubkey, nil
+}
+
+func (f *fakeUsers) GetOrCreateUser(ctx context.Context, firebaseUID string) (*models.User, error) {
+	return f.users[strings.TrimPrefix(firebaseUID, "uid-")], nil
+}
+
+func readyTrack(id string, updatedAt time.Time, versions ...models.CompressionVersion) *models.NostrTrack {
+	return &models.NostrTrack{
+		ID:                  id,
+		Pubkey:              testPubkey,
+		Status:              models.TrackStatusReady,
+		Title:               "Song " + id,
+		Artist:              "The Band",
+		Album:               "First",
+		Duration:            215,
+		ArtworkURL:          "https://media.example.com/art/" + id + ".jpg",
+		CompressionVersions: versions,
+		CreatedAt:           time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+		UpdatedAt:           updatedAt,
+	}
+}
+
+func mp3(id string, bitrate int, public bool) models.CompressionVersion {
+	return models.CompressionVersion{
+		ID: id, URL: "https://media.example.com/" + id + ".mp3", Format: "mp3",
+		Bitrate: bitrate, Size: int64(bitrate) * 1000, IsPublic: public,
+	}
+}
+
+func TestNormalizePubkey(t *testing.T) {
+	pubkey, err := NormalizePubkey(strings.ToUpper(testPubkey))
+	require.NoError(t, err)
+	assert.Equal(t, testPubkey, pubkey)
+
+	pubkey, err = NormalizePubkey("npub10elfcs4fr0l0r8af98jlmgdh9c8tcxjvz9qkw038js35mp4dma8qzvjptg")
+	require.NoError(t, err)
+	assert.Equal(t, testPubkey, pubkey)
+
+	for _, invalid := range []string{"", "abc", strings.Repeat("z", 64), "npub1bogus"} {
+		_, err := NormalizePubkey(invalid)
+		assert.ErrorIs(t, err, ErrInvalidPubkey, invalid)
+	}
+}
+
+func TestFeedRendersPublicMP3Tracks(t *testing.T) {
+	updated := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	published := time.Date(2026, 3, 5, 9, 30, 0, 0, time.UTC)
+	best := readyTrack("a", updated, mp3("a-128", 128, true), mp3("a-320", 320, true), mp3("a-private", 999, false))
+	best.PublishedAt = &published
+	tracks := &fakeTracks{tracks: []*models.NostrTrack{
+		best,
+		readyTrack("no-public", updated, mp3("b-128", 128, false)),
+		readyTrack("ogg-only", updated, models.CompressionVersion{ID: "c", URL: "https://x/c.ogg", Format: "ogg", IsPublic: true}),
+		{ID: "processing", Status: models.TrackStatusProcessing},
+	}}
+	users := &fakeUsers{users: map[string]*models.User{testPubkey: {
+		DisplayName:      "Band & Friends",
+		LightningAddress: "band@getalby.com",
+		AvatarURL:        "https://media.example.com/avatar.png",
+	}}}
+	g := NewGenerator(tracks, users, &utils.PublicURLConfig{APIBaseURL: "https://api.wavlake.com"})
+
+	feed, err := g.Feed(context.Background(), testPubkey)
+	require.NoError(t, err)
+	body := string(feed.Body)
+
+	assert.True(t, strings.HasPrefix(body, xml.Header))
+	assert.Contains(t, body, `xmlns:podcast="https://podcastindex.org/namespace/1.0"`)
+	assert.Contains(t, body, "<title>Band &amp; Friends</title>")
+	assert.Contains(t, body, `<atom:link href="https://api.wavlake.com/v1/feeds/pubkey/`+testPubkey+`.xml" rel="self" type="application/rss+xml"></atom:link>`)
+	assert.Contains(t, body, "<podcast:medium>music</podcast:medium>")
+	assert.Contains(t, body, `<itunes:image href="https://media.example.com/avatar.png"></itunes:image>`)
+	assert.Contains(t, body, `<podcast:value type="lightning" method="lnaddress">`)
+	assert.Contains(t, body, `address="band@getalby.com" split="100"`)
+
+	// Only the ready track with a public MP3 is listed, enclosing its best version
+	assert.Equal(t, 1, strings.Count(body, "<item>"))
+	assert.Contains(t, body, `<enclosure url="https://media.example.com/a-320.mp3" length="320000" type="audio/mpeg"></enclosure>`)
+	assert.Contains(t, body, "<itunes:duration>215</itunes:duration>")
+	assert.Contains(t, body, `<guid isPermaLink="false">a</guid>`)
+	assert.Contains(t, body, "<pubDate>Thu, 05 Mar 2026 09:30:00 +0000</pubDate>")
+	assert.Contains(t, body, `<itunes:image href="https://media.example.com/art/a.jpg"></itunes:image>`)
+
+	// The feed is well-formed
+	var parsed struct {
+		Channel struct {
+			Items []struct {
+				Title string `xml:"title"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	require.NoError(t, xml.Unmarshal(feed.Body, &parsed))
+	require.Len(t, parsed.Channel.Items, 1)
+	assert.Equal(t, "Song a", parsed.Channel.Items[0].Title)
+}
+
+func TestFeedWithoutProfile(t *testing.T) {
+	tracks := &fakeTracks{tracks: []*models.NostrTrack{readyTrack("a", time.Now(), mp3("a-128", 128, true))}}
+	g := NewGenerator(tracks, &fakeUsers{}, nil)
+
+	feed, err := g.Feed(context.Background(), testPubkey)
+	require.NoError(t, err)
+	body := string(feed.Body)
+	assert.Contains(t, body, "<title>npub10elfcs4f…jptg</title>")
+	assert.Contains(t, body, `<atom:link href="/v1/feeds/pubkey/`+testPubkey+`.xml"`)
+	assert.NotContains(t, body, "podcast:value")
+}
+
+func TestFeedNotFound(t *testing.T) {
+	g := NewGenerator(&fakeTracks{}, &fakeUsers{}, nil)
+	_, err := g.Feed(context.Background(), testPubkey)
+	assert.ErrorIs(t, err, ErrFeedNotFound)
+
+	// A linked account with nothing public yet has an empty feed
+	g = NewGenerator(&fakeTracks{}, &fakeUsers{users: map[string]*models.User{testPubkey: {DisplayName: "New"}}}, nil)
+	feed, err := g.Feed(context.Background(), testPubkey)
+	require.NoError(t, err)
+	assert.NotContains(t, string(feed.Body), "<item>")
+
+	g = NewGenerator(&fakeTracks{err: errors.New("firestore down")}, &fakeUsers{}, nil)
+	_, err = g.Feed(context.Background(), testPubkey)
+	assert.ErrorContains(t, err, "firestore down")
+	assert.NotErrorIs(t, err, ErrFeedNotFound)
+}
+
+func TestFeedCachesRenderUntilTracksChange(t *testing.T) {
+	updated := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	tracks := &fakeTracks{tracks: []*models.NostrTrack{readyTrack("a", updated, mp3("a-128", 128, true))}}
+	users := &fakeUsers{users: map[string]*models.User{testPubkey: {DisplayName: "Band"}}}
+	g := NewGenerator(tracks, users, nil)
+
+	first, err := g.Feed(context.Background(), testPubkey)
+	require.NoError(t, err)
+	second, err := g.Feed(context.Background(), testPubkey)
+	require.NoError(t, err)
+	assert.Same(t, first, second, "an unchanged feed reuses the render")
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, first.ETag)
+
+	tracks.tracks[0] = readyTrack("a", updated.Add(time.Minute), mp3("a-128", 128, true))
+	third, err := g.Feed(context.Background(), testPubkey)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ETag, third.ETag)
+
+	// Profile changes show up too
+	users.users[testPubkey] = &models.User{DisplayName: "Band", LightningAddress: "band@getalby.com"}
+	fourth, err := g.Feed(context.Background(), testPubkey)
+	require.NoError(t, err)
+	assert.NotEqual(t, third.ETag, fourth.ETag)
+	assert.Contains(t, string(fourth.Body), "band@getalby.com")
+}
+
+func TestPodcastGUID(t *testing.T) {
+	assert.Equal(t, podcastGUID("https://api.wavlake.com/v1/feeds/pubkey/x.xml"), podcastGUID("http://api.wavlake.com/v1/feeds/pubkey/x.xml/"))
+	// The example from the Podcasting 2.0 spec
+	assert.Equal(t, "917393e3-1b1e-5cef-ace4-edaa54e1f810", podcastGUID("https://mp3s.nashownotes.com/pc20rss.xml"))
+}
+
+func TestErrorBody(t *testing.T) {
+	body := string(ErrorBody(`pubkey <"x"> not found`))
+	assert.Equal(t, xml.Header+"<error><message>pubkey &lt;&#34;x&#34;&gt; not found</message></error>", body)
+}
@@ -0,0 +1,97 @@
+package feeds
+
+import "encoding/xml"
+
+// XML namespaces used by the feed
+const (
+	itunesNamespace  = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+	podcastNamespace = "https://podcastindex.org/namespace/1.0"
+	atomNamespace    = "http://www.w3.org/2005/Atom"
+)
+
+// podcastGUIDNamespace is the UUIDv5 namespace podcast:guid values are made
+// in, from the Podcasting 2.0 spec
+const podcastGUIDNamespace = "ead4c236-bf58-58c6-a2c6-a6b28d128cb6"
+
+type rss struct {
+	XMLName   xml.Name `xml:"rss"`
+	Version   string   `xml:"version,attr"`
+	ItunesNS  string   `xml:"xmlns:itunes,attr"`
+	PodcastNS string   `xml:"xmlns:podcast,attr"`
+	AtomNS    string   `xml:"xmlns:atom,attr"`
+	Channel   channel  `xml:"channel"`
+}
+
+type channel struct {
+	Title          string        `xml:"title"`
+	Link           string        `xml:"link"`
+	Description    string        `xml:"description"`
+	AtomLink       atomLink      `xml:"atom:link"`
+	LastBuildDate  string        `xml:"lastBuildDate,omitempty"`
+	Image          *image        `xml:"image,omitempty"`
+	ItunesAuthor   string        `xml:"itunes:author"`
+	ItunesImage    *itunesImage  `xml:"itunes:image,omitempty"`
+	ItunesExplicit string        `xml:"itunes:explicit"`
+	Medium         string        `xml:"podcast:medium"`
+	GUID           string        `xml:"podcast:guid"`
+	Value          *podcastValue `xml:"podcast:value,omitempty"`
+	Items          []item        `xml:"item"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type image struct {
+	URL   string `xml:"url"`
+	Title string `xml:"title"`
+	Link  string `xml:"link"`
+}
+
+type itunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+// podcastValue is a podcast:value block paying one lightning address
+type podcastValue struct {
+	Type       string           `xml:"type,attr"`
+	Method     string           `xml:"method,attr"`
+	Recipients []valueRecipient `xml:"podcast:valueRecipient"`
+}
+
+type valueRecipient struct {
+	Name    string `xml:"name,attr,omitempty"`
+	Type    string `xml:"type,attr"`
+	Address string `xml:"address,attr"`
+	Split   int    `xml:"split,attr"`
+}
+
+type item struct {
+	Title          string       `xml:"title"`
+	GUID           guid         `xml:"guid"`
+	PubDate        string       `xml:"pubDate"`
+	Description    string       `xml:"description,omitempty"`
+	Enclosure      enclosure    `xml:"enclosure"`
+	ItunesAuthor   string       `xml:"itunes:author,omitempty"`
+	ItunesDuration int          `xml:"itunes:duration,omitempty"`
+	ItunesImage    *itunesImage `xml:"itunes:image,omitempty"`
+}
+
+type guid struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type enclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// feedError is the body of a failed feed request, so feed readers get XML
+type feedError struct {
+	XMLName xml.Name `xml:"error"`
+	Message string   `xml:"message"`
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/services"
+)
+
+type AccountDeletionHandler struct {
+	accountDeletionService services.AccountDeletionServiceInterface
+}
+
+// NewAccountDeletionHandler creates a new account deletion handler
+func NewAccountDeletionHandler(accountDeletionService services.AccountDeletionServiceInterface) *AccountDeletionHandler {
+	return &AccountDeletionHandler{
+		accountDeletionService: accountDeletionService,
+	}
+}
+
+// DeleteAccount handles DELETE /v1/users/me
+// Without ?confirmation_code it returns a 202 with a code that expires after a
+// few minutes; ?disable_firebase_account=true also disables the Firebase
+// account. Repeating the request with the code deletes the account and returns
+// what was removed. A deletion that fails partway resumes when retried with
+// the same code.
+func (h *AccountDeletionHandler) DeleteAccount(c *gin.Context) {
+	firebaseUID := c.GetString("firebase_uid")
+	if firebaseUID == "" {
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	code := c.Query("confirmation_code")
+	if code == "" {
+		disableFirebaseAccount := false
+		if param := c.Query("disable_firebase_account"); param != "" {
+			disable, err := strconv.ParseBool(param)
+			if err != nil {
+				apierror.Respond(c, apierror.Validation("disable_firebase_account must be true or false"))
+				return
+			}
+			disableFirebaseAccount = disable
+		}
+
+		confirmation, err := h.accountDeletionService.RequestAccountDeletion(c.Request.Context(), firebaseUID, disableFirebaseAccount)
+		if err != nil {
+			if errors.Is(err, services.ErrAccountDeletionInProgress) {
+				apierror.Respond(c, apierror.Conflict(err.Error()))
+				return
+			}
+			log.Printf("Failed to request account deletion for user %s: %v", firebaseUID, err)
+			apierror.Respond(c, apierror.Internal("failed to request account deletion"))
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{"success": true, "data": confirmation})
+		return
+	}
+
+	// Audit events for the pubkeys deactivated record this request
+	ctx := services.WithRequestOrigin(c.Request.Context(), services.RequestOrigin{IP: c.ClientIP(), AuthMethod: services.AuditAuthFirebase})
+	deletion, err := h.accountDeletionService.ConfirmAccountDeletion(ctx, firebaseUID, code)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrAccountDeletionNotRequested),
+			errors.Is(err, services.ErrDeletionCodeExpired):
+			apierror.Respond(c, apierror.Validation(err.Error()))
+		case errors.Is(err, services.ErrInvalidDeletionCode):
+			apierror.Respond(c, apierror.Forbidden(err.Error()))
+		case errors.Is(err, services.ErrAccountDeletionInProgress):
+			apierror.Respond(c, apierror.Conflict(err.Error()))
+		case deletion != nil:
+			// The service has logged the failed step; report what was removed
+			apierror.Respond(c, apierror.Internal("account deletion did not finish; retry with the same confirmation code").WithDetails(deletion))
+		default:
+			log.Printf("Failed to delete account of user %s: %v", firebaseUID, err)
+			apierror.Respond(c, apierror.Internal("failed to delete account"))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": deletion})
+}
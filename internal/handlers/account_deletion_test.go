@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/wavlake/api/internal/mocks"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+type AccountDeletionHandlerTestSuite struct {
+	suite.Suite
+	router                 *gin.Engine
+	accountDeletionService *mocks.MockAccountDeletionService
+	handlers               *AccountDeletionHandler
+}
+
+func (suite *AccountDeletionHandlerTestSuite) SetupTest() {
+	gin.SetMode(gin.TestMode)
+
+	suite.accountDeletionService = &mocks.MockAccountDeletionService{}
+	suite.handlers = NewAccountDeletionHandler(suite.accountDeletionService)
+
+	suite.router = gin.New()
+	suite.router.DELETE("/v1/users/me", func(c *gin.Context) {
+		c.Set("firebase_uid", "test-firebase-uid")
+		c.Next()
+	}, suite.handlers.DeleteAccount)
+	suite.router.DELETE("/v1/anonymous/me", suite.handlers.DeleteAccount)
+}
+
+func (suite *AccountDeletionHandlerTestSuite) TearDownTest() {
+	suite.accountDeletionService.AssertExpectations(suite.T())
+}
+
+func (suite *AccountDeletionHandlerTestSuite) deleteMe(path string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("DELETE", path, nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *AccountDeletionHandlerTestSuite) TestDeleteAccount_IssuesConfirmationCode() {
+	confirmation := &models.AccountDeletionConfirmation{ConfirmationCode: "ABCD2345", ExpiresAt: time.Now().Add(10 * time.Minute)}
+	suite.accountDeletionService.On("RequestAccountDeletion", mock.Anything, "test-firebase-uid", true).Return(confirmation, nil)
+
+	w := suite.deleteMe("/v1/users/me?disable_firebase_account=true")
+
+	assert.Equal(suite.T(), http.StatusAccepted, w.Code)
+	var response struct {
+		Success bool                               `json:"success"`
+		Data    models.AccountDeletionConfirmation `json:"data"`
+	}
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(suite.T(), response.Success)
+	assert.Equal(suite.T(), "ABCD2345", response.Data.ConfirmationCode)
+}
+
+func (suite *AccountDeletionHandlerTestSuite) TestDeleteAccount_InvalidDisableFlag() {
+	w := suite.deleteMe("/v1/users/me?disable_firebase_account=maybe")
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *AccountDeletionHandlerTestSuite) TestDeleteAccount_ReturnsSummary() {
+	deletion := &models.AccountDeletion{
+		Status:             models.AccountDeletionStatusCompleted,
+		CompletedSteps:     []string{models.AccountDeletionStepTracks, models.AccountDeletionStepPubkeys, models.AccountDeletionStepUser},
+		TracksDeleted:      2,
+		ObjectsPurged:      5,
+		PubkeysDeactivated: 1,
+		UserDeleted:        true,
+		CodeHash:           "secret",
+	}
+	suite.accountDeletionService.On("ConfirmAccountDeletion", mock.Anything, "test-firebase-uid", "ABCD2345").Return(deletion, nil)
+
+	w := suite.deleteMe("/v1/users/me?confirmation_code=ABCD2345")
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var response struct {
+		Success bool                   `json:"success"`
+		Data    map[string]interface{} `json:"data"`
+	}
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(suite.T(), response.Success)
+	assert.Equal(suite.T(), float64(2), response.Data["tracks_deleted"])
+	assert.Equal(suite.T(), float64(5), response.Data["objects_purged"])
+	assert.NotContains(suite.T(), response.Data, "code_hash")
+}
+
+func (suite *AccountDeletionHandlerTestSuite) TestDeleteAccount_ConfirmationErrors() {
+	for err, want := range map[error]int{
+		services.ErrAccountDeletionNotRequested: http.StatusBadRequest,
+		services.ErrDeletionCodeExpired:         http.StatusBadRequest,
+		services.ErrInvalidDeletionCode:         http.StatusForbidden,
+		services.ErrAccountDeletionInProgress:   http.StatusConflict,
+		errors.New("boom"):                      http.StatusInternalServerError,
+	} {
+		code := fmt.Sprintf("code-%d", want)
+		suite.accountDeletionService.On("ConfirmAccountDeletion", mock.Anything, "test-firebase-uid", code).Return(nil, err).Once()
+
+		w := suite.deleteMe("/v1/users/me?confirmation_code=" + code)
+
+		assert.Equal(suite.T(), want, w.Code, err.Error())
+	}
+}
+
+func (suite *AccountDeletionHandlerTestSuite) TestDeleteAccount_PartialDeletion() {
+	deletion := &models.AccountDeletion{
+		Status:         models.AccountDeletionStatusFailed,
+		CompletedSteps: []string{models.AccountDeletionStepTracks},
+		TracksDeleted:  3,
+		Error:          "pubkeys step failed: unavailable",
+	}
+	suite.accountDeletionService.On("ConfirmAccountDeletion", mock.Anything, "test-firebase-uid", "ABCD2345").
+		Return(deletion, errors.New("pubkeys step failed: unavailable"))
+
+	w := suite.deleteMe("/v1/users/me?confirmation_code=ABCD2345")
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+	var response struct {
+		Success bool `json:"success"`
+		Error   struct {
+			Message string                 `json:"message"`
+			Details models.AccountDeletion `json:"details"`
+		} `json:"error"`
+	}
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &response))
+	assert.False(suite.T(), response.Success)
+	assert.Contains(suite.T(), response.Error.Message, "retry")
+	assert.Equal(suite.T(), 3, response.Error.Details.TracksDeleted)
+}
+
+func (suite *AccountDeletionHandlerTestSuite) TestDeleteAccount_RequiresAuth() {
+	w := suite.deleteMe("/v1/anonymous/me")
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func TestAccountDeletionHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(AccountDeletionHandlerTestSuite))
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/logging"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+	"github.com/wavlake/api/pkg/nostr"
+)
+
+// AdminHandler serves internal tooling routes. They ignore track ownership,
+// so they must sit behind auth.RequireAdmin.
+type AdminHandler struct {
+	nostrTrackService services.NostrTrackServiceInterface
+	processingService services.ProcessingServiceInterface
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(nostrTrackService services.NostrTrackServiceInterface, processingService services.ProcessingServiceInterface) *AdminHandler {
+	return &AdminHandler{
+		nostrTrackService: nostrTrackService,
+		processingService: processingService,
+	}
+}
+
+// ListTracks handles GET /v1/admin/tracks?pubkey=, returning every track for
+// a hex or npub pubkey, deleted ones included
+func (h *AdminHandler) ListTracks(c *gin.Context) {
+	pubkey := c.Query("pubkey")
+	if pubkey == "" {
+		apierror.Respond(c, apierror.Validation("pubkey is required"))
+		return
+	}
+	pubkey, err := nostr.NormalizePubkey(pubkey)
+	if err != nil {
+		apierror.Respond(c, apierror.Validation("invalid npub: "+err.Error()))
+		return
+	}
+
+	tracks, err := h.nostrTrackService.ListAllTracksByPubkey(c.Request.Context(), pubkey)
+	if err != nil {
+		logging.FromContext(c.Request.Context()).Error("admin track listing failed", "pubkey", pubkey, "error", err)
+		apierror.Respond(c, apierror.Internal("failed to retrieve tracks"))
+		return
+	}
+	tracks = nonNil(tracks)
+
+	c.JSON(http.StatusOK, GetTracksResponse{
+		Success: true,
+		Data:    tracks,
+	})
+}
+
+// ReprocessTrack handles POST /v1/admin/tracks/:id/reprocess. Tracks stuck
+// processing are taken over from the stuck run, and ready tracks are
+// processed again.
+func (h *AdminHandler) ReprocessTrack(c *gin.Context) {
+	ctx := c.Request.Context()
+	trackID := c.Param("id")
+
+	track, err := h.nostrTrackService.GetTrack(ctx, trackID)
+	if err != nil {
+		if errors.Is(err, services.ErrTrackNotFound) {
+			apierror.Respond(c, apierror.NotFound("track not found"))
+			return
+		}
+		logging.FromContext(ctx).Error("admin reprocess lookup failed", "track_id", trackID, "error", err)
+		apierror.Respond(c, apierror.Internal("failed to load track"))
+		return
+	}
+
+	// A stuck run still going on this instance is stopped before its track is
+	// reclaimed, so it can't upload results over the new run's
+	if track.CurrentStatus() == models.TrackStatusProcessing {
+		h.processingService.CancelProcessing(trackID)
+	}
+
+	if err := h.processingService.ReprocessTrackAsync(ctx, trackID); err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidStatusTransition):
+			apierror.Respond(c, services.ErrInvalidStatusTransition.WithMessage("track can't be processed in its current status"))
+		case errors.Is(err, services.ErrTrackUpdateConflict):
+			apierror.Respond(c, apierror.Conflict("track was modified concurrently, please retry"))
+		default:
+			logging.FromContext(ctx).Error("admin reprocess failed", "track_id", trackID, "error", err)
+			apierror.Respond(c, apierror.Internal("failed to start processing"))
+		}
+		return
+	}
+
+	logging.FromContext(ctx).Info("admin reprocess queued", "track_id", trackID, "admin_uid", c.GetString("firebase_uid"))
+	c.JSON(http.StatusOK, CreateTrackResponse{
+		Success: true,
+		Message: "processing queued",
+	})
+}
+
+// ReconcileResponse reports a stuck-track reconciliation pass
+type ReconcileResponse struct {
+	Success bool                    `json:"success"`
+	Data    *models.ReconcileResult `json:"data,omitempty"`
+}
+
+// ReconcileProcessing handles POST /v1/admin/processing/reconcile, repairing,
+// requeueing or failing tracks stuck processing
+func (h *AdminHandler) ReconcileProcessing(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	result, err := h.processingService.ReconcileStuckTracks(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Error("admin reconcile failed", "error", err)
+		apierror.Respond(c, apierror.Internal("failed to reconcile processing tracks"))
+		return
+	}
+
+	logging.FromContext(ctx).Info("admin reconcile finished", "admin_uid", c.GetString("firebase_uid"),
+		"repaired", result.Repaired, "requeued", result.Requeued, "failed", result.Failed)
+	c.JSON(http.StatusOK, ReconcileResponse{
+		Success: true,
+		Data:    result,
+	})
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	firebaseauth "firebase.google.com/go/v4/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/wavlake/api/internal/auth"
+	"github.com/wavlake/api/internal/mocks"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+const (
+	testAdminToken = "admin-token"
+	testUserToken  = "user-token"
+)
+
+type AdminHandlerTestSuite struct {
+	suite.Suite
+	router            *gin.Engine
+	verifier          *mocks.MockIDTokenVerifier
+	nostrTrackService *mocks.MockNostrTrackService
+	processingService *mocks.MockProcessingService
+}
+
+func (suite *AdminHandlerTestSuite) SetupTest() {
+	gin.SetMode(gin.TestMode)
+
+	suite.verifier = &mocks.MockIDTokenVerifier{}
+	suite.verifier.On("VerifyIDToken", mock.Anything, testAdminToken).
+		Return(&firebaseauth.Token{UID: "admin-uid", Claims: map[string]interface{}{auth.AdminClaim: true}}, nil).Maybe()
+	suite.verifier.On("VerifyIDToken", mock.Anything, testUserToken).
+		Return(&firebaseauth.Token{UID: "user-uid", Claims: map[string]interface{}{"email": "artist@example.com"}}, nil).Maybe()
+	suite.nostrTrackService = &mocks.MockNostrTrackService{}
+	suite.processingService = &mocks.MockProcessingService{}
+	handler := NewAdminHandler(suite.nostrTrackService, suite.processingService)
+
+	suite.router = gin.New()
+	admin := suite.router.Group("/v1/admin", auth.NewFirebaseMiddleware(suite.verifier).Middleware(), auth.RequireAdmin())
+	admin.GET("/tracks", handler.ListTracks)
+	admin.POST("/tracks/:id/reprocess", handler.ReprocessTrack)
+	admin.POST("/processing/reconcile", handler.ReconcileProcessing)
+}
+
+func (suite *AdminHandlerTestSuite) TearDownTest() {
+	suite.nostrTrackService.AssertExpectations(suite.T())
+	suite.processingService.AssertExpectations(suite.T())
+}
+
+func (suite *AdminHandlerTestSuite) request(method, path, token string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *AdminHandlerTestSuite) TestNonAdminTokensAreForbidden() {
+	for _, route := range [][2]string{
+		{"GET", "/v1/admin/tracks?pubkey=" + testOwnerPubkey},
+		{"POST", "/v1/admin/tracks/track-1/reprocess"},
+		{"POST", "/v1/admin/processing/reconcile"},
+	} {
+		w := suite.request(route[0], route[1], testUserToken)
+		assert.Equal(suite.T(), http.StatusForbidden, w.Code, route[1])
+	}
+
+	// Service mocks have no expectations, so any call would fail the test
+	suite.nostrTrackService.AssertNotCalled(suite.T(), "ListAllTracksByPubkey", mock.Anything, mock.Anything)
+	suite.processingService.AssertNotCalled(suite.T(), "ReprocessTrackAsync", mock.Anything, mock.Anything)
+}
+
+func (suite *AdminHandlerTestSuite) TestListTracksIncludesDeleted() {
+	tracks := []*models.NostrTrack{
+		{ID: "track-2", Pubkey: testOwnerPubkey, Deleted: true},
+		{ID: "track-1", Pubkey: testOwnerPubkey},
+	}
+	suite.nostrTrackService.On("ListAllTracksByPubkey", mock.Anything, testOwnerPubkey).Return(tracks, nil)
+
+	w := suite.request("GET", "/v1/admin/tracks?pubkey="+testOwnerPubkey, testAdminToken)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var response GetTracksResponse
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(suite.T(), response.Success)
+	assert.Len(suite.T(), response.Data, 2)
+	assert.True(suite.T(), response.Data[0].Deleted)
+}
+
+func (suite *AdminHandlerTestSuite) TestListTracksAcceptsNpub() {
+	const npub = "npub10elfcs4fr0l0r8af98jlmgdh9c8tcxjvz9qkw038js35mp4dma8qzvjptg"
+	const hex = "7e7e9c42a91bfef19fa929e5fda1b72e0ebc1a4c1141673e2794234d86addf4e"
+	suite.nostrTrackService.On("ListAllTracksByPubkey", mock.Anything, hex).Return([]*models.NostrTrack(nil), nil)
+
+	w := suite.request("GET", "/v1/admin/tracks?pubkey="+npub, testAdminToken)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.JSONEq(suite.T(), `{"success":true,"data":[]}`, w.Body.String())
+}
+
+func (suite *AdminHandlerTestSuite) TestListTracksValidatesPubkey() {
+	w := suite.request("GET", "/v1/admin/tracks", testAdminToken)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	w = suite.request("GET", "/v1/admin/tracks?pubkey=npub1invalid", testAdminToken)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *AdminHandlerTestSuite) TestReprocessIgnoresOwnership() {
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-1").Return(&models.NostrTrack{ID: "track-1", Pubkey: testOtherPubkey, Status: models.TrackStatusProcessing}, nil)
+	suite.processingService.On("CancelProcessing", "track-1").Return(1)
+	suite.processingService.On("ReprocessTrackAsync", mock.Anything, "track-1").Return(nil)
+
+	w := suite.request("POST", "/v1/admin/tracks/track-1/reprocess", testAdminToken)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "processing queued")
+}
+
+func (suite *AdminHandlerTestSuite) TestReprocessReadyTrack() {
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-1").Return(&models.NostrTrack{ID: "track-1", Pubkey: testOtherPubkey, Status: models.TrackStatusReady}, nil)
+	suite.processingService.On("ReprocessTrackAsync", mock.Anything, "track-1").Return(nil)
+
+	w := suite.request("POST", "/v1/admin/tracks/track-1/reprocess", testAdminToken)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "processing queued")
+	// Nothing is running on a ready track
+	suite.processingService.AssertNotCalled(suite.T(), "CancelProcessing", mock.Anything)
+}
+
+func (suite *AdminHandlerTestSuite) TestReprocessErrors() {
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "missing").Return(nil, services.ErrTrackNotFound)
+	w := suite.request("POST", "/v1/admin/tracks/missing/reprocess", testAdminToken)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "unreadable").Return(nil, errors.New("firestore unavailable"))
+	w = suite.request("POST", "/v1/admin/tracks/unreadable/reprocess", testAdminToken)
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+
+	tests := []struct {
+		trackID string
+		err     error
+		status  int
+	}{
+		{"cancelled", services.ErrInvalidStatusTransition, http.StatusConflict},
+		{"raced", services.ErrTrackUpdateConflict, http.StatusConflict},
+		{"broken", errors.New("firestore unavailable"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		suite.nostrTrackService.On("GetTrack", mock.Anything, tt.trackID).Return(&models.NostrTrack{ID: tt.trackID}, nil)
+		suite.processingService.On("ReprocessTrackAsync", mock.Anything, tt.trackID).Return(tt.err)
+
+		w := suite.request("POST", "/v1/admin/tracks/"+tt.trackID+"/reprocess", testAdminToken)
+		assert.Equal(suite.T(), tt.status, w.Code, tt.trackID)
+	}
+}
+
+func (suite *AdminHandlerTestSuite) TestReconcileProcessingReportsCounts() {
+	suite.processingService.On("ReconcileStuckTracks", mock.Anything).
+		Return(&models.ReconcileResult{Checked: 4, Repaired: 1, Requeued: 2, Failed: 1}, nil)
+
+	w := suite.request("POST", "/v1/admin/processing/reconcile", testAdminToken)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.JSONEq(suite.T(), `{"success":true,"data":{"checked":4,"repaired":1,"requeued":2,"failed":1}}`, w.Body.String())
+}
+
+func (suite *AdminHandlerTestSuite) TestReconcileProcessingError() {
+	suite.processingService.On("ReconcileStuckTracks", mock.Anything).Return(nil, errors.New("firestore unavailable"))
+
+	w := suite.request("POST", "/v1/admin/processing/reconcile", testAdminToken)
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
+
+func TestAdminHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(AdminHandlerTestSuite))
+}
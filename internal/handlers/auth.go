@@ -1,12 +1,19 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/models"
 	"github.com/wavlake/api/internal/services"
+	"github.com/wavlake/api/pkg/nostr"
 )
 
 type AuthHandlers struct {
@@ -19,6 +26,30 @@ func NewAuthHandlers(userService services.UserServiceInterface) *AuthHandlers {
 	}
 }
 
+// normalizeRequestPubkey converts a request body pubkey given as an npub to
+// lowercase hex, responding 400 when it doesn't decode
+func normalizeRequestPubkey(c *gin.Context, pubkey string) (string, bool) {
+	normalized, err := nostr.NormalizePubkey(pubkey)
+	if err != nil {
+		apierror.Respond(c, apierror.Validation("Invalid npub: "+err.Error()))
+		return "", false
+	}
+	return strings.ToLower(normalized), true
+}
+
+// linkPubkeyError responds to a failed link with the service error, in the
+// words the account screens expect for the limit and a bad pubkey
+func linkPubkeyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrPubkeyLimitReached):
+		apierror.Respond(c, services.ErrPubkeyLimitReached.WithMessage("Account already has the maximum number of linked pubkeys; unlink one first"))
+	case errors.Is(err, services.ErrInvalidPubkey):
+		apierror.Respond(c, services.ErrInvalidPubkey.WithMessage("Invalid pubkey: "+err.Error()))
+	default:
+		apierror.Respond(c, err)
+	}
+}
+
 // LinkPubkeyRequest represents the request body for linking a pubkey
 type LinkPubkeyRequest struct {
 	PubKey string `json:"pubkey,omitempty"`
@@ -31,6 +62,8 @@ type LinkPubkeyResponse struct {
 	FirebaseUID string `json:"firebase_uid"`
 	PubKey      string `json:"pubkey"`
 	LinkedAt    string `json:"linked_at"`
+	// AlreadyLinked is set when the pubkey was already linked to this account
+	AlreadyLinked bool `json:"already_linked"`
 }
 
 // LinkPubkey handles POST /v1/auth/link-pubkey
@@ -39,13 +72,13 @@ func (h *AuthHandlers) LinkPubkey(c *gin.Context) {
 	// Get auth info from context (set by DualAuthMiddleware)
 	firebaseUID, exists := c.Get("firebase_uid")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing Firebase authentication"})
+		apierror.Respond(c, apierror.Unauthorized("Missing Firebase authentication"))
 		return
 	}
 
 	nostrPubkey, exists := c.Get("nostr_pubkey")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing Nostr authentication"})
+		apierror.Respond(c, apierror.Unauthorized("Missing Nostr authentication"))
 		return
 	}
 
@@ -59,26 +92,40 @@ func (h *AuthHandlers) LinkPubkey(c *gin.Context) {
 
 	// Optional: validate request body pubkey matches auth pubkey
 	var req LinkPubkeyRequest
-	if err := c.ShouldBindJSON(&req); err == nil && req.PubKey != "" {
-		if req.PubKey != pubkey {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Request pubkey does not match authenticated pubkey"})
+	if err := bindJSON(c, &req); err != nil && !errors.Is(err, io.EOF) {
+		apierror.Respond(c, bindError(err, "Invalid request body"))
+		return
+	}
+	if req.PubKey != "" {
+		requested, ok := normalizeRequestPubkey(c, req.PubKey)
+		if !ok {
+			return
+		}
+		if requested != strings.ToLower(pubkey) {
+			apierror.Respond(c, apierror.Validation("Request pubkey does not match authenticated pubkey"))
 			return
 		}
 	}
 
 	// Link the pubkey to the Firebase user
-	err := h.userService.LinkPubkeyToUser(c.Request.Context(), pubkey, uid)
+	ctx := services.WithRequestOrigin(c.Request.Context(), services.RequestOrigin{IP: c.ClientIP(), AuthMethod: services.AuditAuthDual})
+	linked, alreadyLinked, err := h.userService.LinkPubkeyToUser(ctx, pubkey, uid)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		linkPubkeyError(c, err)
 		return
 	}
 
+	message := "Pubkey linked successfully to Firebase account"
+	if alreadyLinked {
+		message = "Pubkey is already linked to this Firebase account"
+	}
 	response := LinkPubkeyResponse{
-		Success:     true,
-		Message:     "Pubkey linked successfully to Firebase account",
-		FirebaseUID: uid,
-		PubKey:      pubkey,
-		LinkedAt:    time.Now().Format(time.RFC3339),
+		Success:       true,
+		Message:       message,
+		FirebaseUID:   uid,
+		PubKey:        linked.Pubkey,
+		LinkedAt:      linked.LinkedAt.Format(time.RFC3339),
+		AlreadyLinked: alreadyLinked,
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -102,29 +149,35 @@ func (h *AuthHandlers) UnlinkPubkey(c *gin.Context) {
 	// Get Firebase UID from context (set by FirebaseMiddleware)
 	firebaseUID, exists := c.Get("firebase_uid")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing Firebase authentication"})
+		apierror.Respond(c, apierror.Unauthorized("Missing Firebase authentication"))
 		return
 	}
 
 	var req UnlinkPubkeyRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+	if err := bindJSON(c, &req); err != nil {
+		apierror.Respond(c, bindError(err, "Invalid request body"))
+		return
+	}
+
+	pubkey, ok := normalizeRequestPubkey(c, req.PubKey)
+	if !ok {
 		return
 	}
 
 	uid := firebaseUID.(string)
 
 	// Unlink the pubkey from the Firebase user
-	err := h.userService.UnlinkPubkeyFromUser(c.Request.Context(), req.PubKey, uid)
+	ctx := services.WithRequestOrigin(c.Request.Context(), services.RequestOrigin{IP: c.ClientIP(), AuthMethod: services.AuditAuthFirebase})
+	err := h.userService.UnlinkPubkeyFromUser(ctx, pubkey, uid)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.Respond(c, err)
 		return
 	}
 
 	response := UnlinkPubkeyResponse{
 		Success: true,
 		Message: "Pubkey unlinked successfully from Firebase account",
-		PubKey:  req.PubKey,
+		PubKey:  pubkey,
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -132,9 +185,10 @@ func (h *AuthHandlers) UnlinkPubkey(c *gin.Context) {
 
 // LinkedPubkeyInfo represents pubkey information in the response
 type LinkedPubkeyInfo struct {
-	PubKey     string `json:"pubkey"`
-	LinkedAt   string `json:"linked_at"`
-	LastUsedAt string `json:"last_used_at,omitempty"`
+	PubKey        string `json:"pubkey"`
+	DisplayPubkey string `json:"display_pubkey"` // Shortened npub, derived from PubKey
+	LinkedAt      string `json:"linked_at"`
+	LastUsedAt    string `json:"last_used_at,omitempty"`
 }
 
 // GetLinkedPubkeysResponse represents the response for getting linked pubkeys
@@ -150,7 +204,7 @@ func (h *AuthHandlers) GetLinkedPubkeys(c *gin.Context) {
 	// Get Firebase UID from context (set by FirebaseMiddleware)
 	firebaseUID, exists := c.Get("firebase_uid")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing Firebase authentication"})
+		apierror.Respond(c, apierror.Unauthorized("Missing Firebase authentication"))
 		return
 	}
 
@@ -161,10 +215,7 @@ func (h *AuthHandlers) GetLinkedPubkeys(c *gin.Context) {
 	if err != nil {
 		// Log the actual error for debugging
 		c.Header("X-Debug-Error", err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to retrieve linked pubkeys",
-			"debug": err.Error(),
-		})
+		apierror.Respond(c, apierror.Internal("Failed to retrieve linked pubkeys").WithCause(err))
 		return
 	}
 
@@ -172,8 +223,9 @@ func (h *AuthHandlers) GetLinkedPubkeys(c *gin.Context) {
 	var linkedPubkeys []LinkedPubkeyInfo
 	for _, p := range pubkeys {
 		info := LinkedPubkeyInfo{
-			PubKey:   p.Pubkey,
-			LinkedAt: p.LinkedAt.Format(time.RFC3339),
+			PubKey:        p.Pubkey,
+			DisplayPubkey: nostr.DisplayPubkey(p.Pubkey),
+			LinkedAt:      p.LinkedAt.Format(time.RFC3339),
 		}
 
 		if !p.LastUsedAt.IsZero() {
@@ -184,9 +236,7 @@ func (h *AuthHandlers) GetLinkedPubkeys(c *gin.Context) {
 	}
 
 	// Ensure we always return an empty array instead of null
-	if linkedPubkeys == nil {
-		linkedPubkeys = []LinkedPubkeyInfo{}
-	}
+	linkedPubkeys = nonNil(linkedPubkeys)
 
 	response := GetLinkedPubkeysResponse{
 		Success:       true,
@@ -197,18 +247,85 @@ func (h *AuthHandlers) GetLinkedPubkeys(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// PubkeyHistoryResponse represents the response for pubkey audit history
+type PubkeyHistoryResponse struct {
+	Success     bool                    `json:"success"`
+	FirebaseUID string                  `json:"firebase_uid,omitempty"`
+	PubKey      string                  `json:"pubkey,omitempty"`
+	Events      []models.NostrAuthEvent `json:"events"`
+}
+
+// GetPubkeyHistory handles GET /v1/auth/pubkey-history
+// Requires Firebase authentication only. Returns the links, unlinks and
+// transfers of the caller's pubkeys, newest first.
+func (h *AuthHandlers) GetPubkeyHistory(c *gin.Context) {
+	firebaseUID, exists := c.Get("firebase_uid")
+	if !exists {
+		apierror.Respond(c, apierror.Unauthorized("Missing Firebase authentication"))
+		return
+	}
+
+	uid := firebaseUID.(string)
+	events, err := h.userService.GetPubkeyHistory(c.Request.Context(), uid)
+	if err != nil {
+		log.Printf("Failed to get pubkey history for user %s: %v", uid, err)
+		apierror.Respond(c, apierror.Internal("Failed to retrieve pubkey history"))
+		return
+	}
+	events = nonNil(events)
+
+	c.JSON(http.StatusOK, PubkeyHistoryResponse{
+		Success:     true,
+		FirebaseUID: uid,
+		Events:      events,
+	})
+}
+
+// GetPubkeyHistoryByPubkey handles GET /v1/admin/pubkey-history?pubkey=...
+// Requires the admin claim. Returns every audit event for the pubkey, hex or
+// npub, including the accounts and IPs on both sides of transfers.
+func (h *AuthHandlers) GetPubkeyHistoryByPubkey(c *gin.Context) {
+	param := c.Query("pubkey")
+	if param == "" {
+		apierror.Respond(c, apierror.Validation("pubkey is required"))
+		return
+	}
+	pubkey, ok := normalizeRequestPubkey(c, param)
+	if !ok {
+		return
+	}
+
+	events, err := h.userService.GetPubkeyHistoryByPubkey(c.Request.Context(), pubkey)
+	if err != nil {
+		log.Printf("Failed to get history for pubkey %s: %v", pubkey, err)
+		apierror.Respond(c, apierror.Internal("Failed to retrieve pubkey history"))
+		return
+	}
+	events = nonNil(events)
+
+	c.JSON(http.StatusOK, PubkeyHistoryResponse{
+		Success: true,
+		PubKey:  pubkey,
+		Events:  events,
+	})
+}
+
 // CheckPubkeyLinkRequest represents the request body for checking pubkey link status
 type CheckPubkeyLinkRequest struct {
 	PubKey string `json:"pubkey" binding:"required"`
 }
 
-// CheckPubkeyLinkResponse represents the response for checking pubkey link status
+// CheckPubkeyLinkResponse represents the response for checking pubkey link
+// status. IsLinked is set for any pubkey that has been linked to an account;
+// IsActive is whether that link is still in use. The account's UID isn't
+// returned.
 type CheckPubkeyLinkResponse struct {
-	Success     bool   `json:"success"`
-	IsLinked    bool   `json:"is_linked"`
-	FirebaseUID string `json:"firebase_uid,omitempty"`
-	PubKey      string `json:"pubkey"`
-	Email       string `json:"email,omitempty"`
+	Success  bool       `json:"success"`
+	PubKey   string     `json:"pubkey"`
+	IsLinked bool       `json:"is_linked"`
+	IsActive bool       `json:"is_active"`
+	LinkedAt *time.Time `json:"linked_at,omitempty"`
+	Email    string     `json:"email,omitempty"`
 }
 
 // CheckPubkeyLink handles POST /v1/auth/check-pubkey-link
@@ -217,52 +334,125 @@ func (h *AuthHandlers) CheckPubkeyLink(c *gin.Context) {
 	// Get authenticated pubkey from NIP-98 middleware
 	authPubkey, exists := c.Get("pubkey")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing Nostr authentication"})
+		apierror.Respond(c, apierror.Unauthorized("Missing Nostr authentication"))
 		return
 	}
 
 	var req CheckPubkeyLinkRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body - pubkey is required"})
+	if err := bindJSON(c, &req); err != nil {
+		apierror.Respond(c, bindError(err, "Invalid request body - pubkey is required"))
+		return
+	}
+
+	pubkey, ok := normalizeRequestPubkey(c, req.PubKey)
+	if !ok {
 		return
 	}
 
 	// Verify that the authenticated pubkey matches the requested pubkey
-	if authPubkey.(string) != req.PubKey {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You can only check linking status for your own pubkey"})
+	if authPubkey.(string) != pubkey {
+		apierror.Respond(c, apierror.Forbidden("You can only check linking status for your own pubkey"))
 		return
 	}
 
-	// Check if the pubkey is linked to any Firebase account
-	firebaseUID, err := h.userService.GetFirebaseUIDByPubkey(c.Request.Context(), req.PubKey)
+	response := CheckPubkeyLinkResponse{
+		Success: true,
+		PubKey:  pubkey,
+	}
+
+	link, err := h.userService.GetPubkeyLink(c.Request.Context(), pubkey)
+	if errors.Is(err, services.ErrPubkeyNotLinked) {
+		c.JSON(http.StatusOK, response)
+		return
+	}
 	if err != nil {
-		// If error is "not found", it means pubkey is not linked
-		response := CheckPubkeyLinkResponse{
-			Success:     true,
-			IsLinked:    false,
-			FirebaseUID: "",
-			PubKey:      req.PubKey,
-			Email:       "",
-		}
+		log.Printf("Failed to check link for pubkey %s: %v", pubkey, err)
+		apierror.Respond(c, apierror.Internal("Failed to check pubkey link"))
+		return
+	}
+
+	response.IsLinked = true
+	response.IsActive = link.Active
+	if !link.LinkedAt.IsZero() {
+		linkedAt := link.LinkedAt
+		response.LinkedAt = &linkedAt
+	}
+	if !link.Active {
 		c.JSON(http.StatusOK, response)
 		return
 	}
 
 	// Pubkey is linked - get the user's email address
-	email, err := h.userService.GetUserEmail(c.Request.Context(), firebaseUID)
+	email, err := h.userService.GetUserEmail(c.Request.Context(), link.FirebaseUID)
 	if err != nil {
 		// Log the error but continue without email
-		log.Printf("Failed to get email for Firebase UID %s: %v", firebaseUID, err)
+		log.Printf("Failed to get email for pubkey %s: %v", pubkey, err)
 		email = ""
 	}
+	response.Email = email
 
-	response := CheckPubkeyLinkResponse{
-		Success:     true,
-		IsLinked:    true,
-		FirebaseUID: firebaseUID,
-		PubKey:      req.PubKey,
-		Email:       email,
+	c.JSON(http.StatusOK, response)
+}
+
+// CheckPubkeysRequest represents the request body for checking many pubkeys
+type CheckPubkeysRequest struct {
+	PubKeys []string `json:"pubkeys"`
+}
+
+// PubkeyLinkStatus is one pubkey's entry in CheckPubkeysResponse
+type PubkeyLinkStatus struct {
+	PubKey   string `json:"pubkey"`
+	IsLinked bool   `json:"is_linked"`
+}
+
+// CheckPubkeysResponse represents the response for checking many pubkeys
+type CheckPubkeysResponse struct {
+	Success bool               `json:"success"`
+	Results []PubkeyLinkStatus `json:"results"`
+}
+
+// CheckPubkeys handles POST /v1/auth/check-pubkeys
+// Public and rate limited. Reports whether each of up to 100 hex or npub
+// pubkeys is linked to a Wavlake account, in request order. Only the boolean
+// is returned, never which account.
+func (h *AuthHandlers) CheckPubkeys(c *gin.Context) {
+	var req CheckPubkeysRequest
+	if err := bindJSON(c, &req); err != nil {
+		apierror.Respond(c, bindError(err, "Invalid request body"))
+		return
+	}
+	if len(req.PubKeys) == 0 {
+		apierror.Respond(c, apierror.Validation("pubkeys is required"))
+		return
+	}
+	if len(req.PubKeys) > services.MaxCheckPubkeys {
+		apierror.Respond(c, apierror.Validation(fmt.Sprintf("At most %d pubkeys can be checked at once", services.MaxCheckPubkeys)))
+		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	pubkeys := make([]string, len(req.PubKeys))
+	for i, pubkey := range req.PubKeys {
+		normalized, ok := normalizeRequestPubkey(c, pubkey)
+		if !ok {
+			return
+		}
+		pubkeys[i] = normalized
+	}
+
+	linked, err := h.userService.ArePubkeysLinked(c.Request.Context(), pubkeys)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPubkey) {
+			apierror.Respond(c, apierror.Validation("Invalid pubkey: "+err.Error()))
+			return
+		}
+		log.Printf("Failed to check %d pubkeys: %v", len(pubkeys), err)
+		apierror.Respond(c, apierror.Internal("Failed to check pubkeys"))
+		return
+	}
+
+	results := make([]PubkeyLinkStatus, len(pubkeys))
+	for i, pubkey := range pubkeys {
+		results[i] = PubkeyLinkStatus{PubKey: pubkey, IsLinked: linked[pubkey]}
+	}
+	c.JSON(http.StatusOK, CheckPubkeysResponse{Success: true, Results: results})
 }
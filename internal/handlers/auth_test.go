@@ -2,8 +2,10 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -12,9 +14,11 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"github.com/wavlake/api/internal/mocks"
 	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
 )
 
 type AuthHandlerTestSuite struct {
@@ -38,7 +42,10 @@ func (suite *AuthHandlerTestSuite) SetupTest() {
 		auth.GET("/get-linked-pubkeys", suite.mockFirebaseAuth(), suite.handlers.GetLinkedPubkeys)
 		auth.POST("/unlink-pubkey", suite.mockFirebaseAuth(), suite.handlers.UnlinkPubkey)
 		auth.POST("/link-pubkey", suite.mockDualAuth(), suite.handlers.LinkPubkey)
+		auth.GET("/pubkey-history", suite.mockFirebaseAuth(), suite.handlers.GetPubkeyHistory)
 	}
+	suite.router.GET("/v1/admin/pubkey-history", suite.handlers.GetPubkeyHistoryByPubkey)
+	suite.router.POST("/v1/auth/check-pubkeys", suite.handlers.CheckPubkeys)
 }
 
 func (suite *AuthHandlerTestSuite) TearDownTest() {
@@ -100,7 +107,41 @@ func (suite *AuthHandlerTestSuite) TestGetLinkedPubkeys_Success() {
 	assert.Equal(suite.T(), "test-firebase-uid", response.FirebaseUID)
 	assert.Len(suite.T(), response.LinkedPubkeys, 2)
 	assert.Equal(suite.T(), "pubkey1", response.LinkedPubkeys[0].PubKey)
-	// assert.Equal(suite.T(), "pubkey1...123", response.LinkedPubkeys[0].DisplayPubkey) // Field removed
+	assert.Equal(suite.T(), "pubkey1", response.LinkedPubkeys[0].DisplayPubkey)
+}
+
+func (suite *AuthHandlerTestSuite) TestGetLinkedPubkeys_DisplayPubkey() {
+	mockPubkeys := []models.NostrAuth{
+		{Pubkey: "3bf0c63fcb93463407af97a5e5ee64fa883d107ef9e558472c4eb9aaaefa459d", LinkedAt: time.Now()},
+		{Pubkey: "not-a-valid-hex-pubkey", LinkedAt: time.Now()},
+	}
+	suite.userService.On("GetLinkedPubkeys", mock.Anything, "test-firebase-uid").Return(mockPubkeys, nil)
+
+	req, _ := http.NewRequest("GET", "/v1/auth/get-linked-pubkeys", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var response GetLinkedPubkeysResponse
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(suite.T(), response.LinkedPubkeys, 2)
+	assert.Equal(suite.T(), "npub180cvv07t…h6w6", response.LinkedPubkeys[0].DisplayPubkey)
+	assert.Equal(suite.T(), "not-a-va…bkey", response.LinkedPubkeys[1].DisplayPubkey)
+}
+
+func (suite *AuthHandlerTestSuite) TestGetLinkedPubkeys_EmptyIsArray() {
+	suite.userService.On("GetLinkedPubkeys", mock.Anything, "test-firebase-uid").Return([]models.NostrAuth(nil), nil)
+
+	req, _ := http.NewRequest("GET", "/v1/auth/get-linked-pubkeys", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var response map[string]interface{}
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(suite.T(), []interface{}{}, response["linked_pubkeys"])
 }
 
 func (suite *AuthHandlerTestSuite) TestGetLinkedPubkeys_ServiceError() {
@@ -114,7 +155,7 @@ func (suite *AuthHandlerTestSuite) TestGetLinkedPubkeys_ServiceError() {
 
 	var response map[string]interface{}
 	json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Equal(suite.T(), "Failed to retrieve linked pubkeys", response["error"])
+	assert.Equal(suite.T(), "Failed to retrieve linked pubkeys", errorMessage(response))
 }
 
 // Test UnlinkPubkey endpoint
@@ -151,7 +192,7 @@ func (suite *AuthHandlerTestSuite) TestUnlinkPubkey_InvalidRequest() {
 
 	var response map[string]interface{}
 	json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Equal(suite.T(), "Invalid request body", response["error"])
+	assert.Equal(suite.T(), "Invalid request body", errorMessage(response))
 }
 
 func (suite *AuthHandlerTestSuite) TestUnlinkPubkey_ServiceError() {
@@ -159,7 +200,7 @@ func (suite *AuthHandlerTestSuite) TestUnlinkPubkey_ServiceError() {
 		PubKey: "test-pubkey",
 	}
 
-	suite.userService.On("UnlinkPubkeyFromUser", mock.Anything, "test-pubkey", "test-firebase-uid").Return(errors.New("pubkey not found"))
+	suite.userService.On("UnlinkPubkeyFromUser", mock.Anything, "test-pubkey", "test-firebase-uid").Return(services.ErrPubkeyNotOwned)
 
 	jsonBody, _ := json.Marshal(requestBody)
 	req, _ := http.NewRequest("POST", "/v1/auth/unlink-pubkey", bytes.NewBuffer(jsonBody))
@@ -167,16 +208,64 @@ func (suite *AuthHandlerTestSuite) TestUnlinkPubkey_ServiceError() {
 	w := httptest.NewRecorder()
 	suite.router.ServeHTTP(w, req)
 
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(suite.T(), "user.pubkey_not_owned", errorCode(response))
+	assert.Equal(suite.T(), services.ErrPubkeyNotOwned.Message, errorMessage(response))
+}
+
+// NIP-19's example key
+const (
+	testNpubHex = "7e7e9c42a91bfef19fa929e5fda1b72e0ebc1a4c1141673e2794234d86addf4e"
+	testNpub    = "npub10elfcs4fr0l0r8af98jlmgdh9c8tcxjvz9qkw038js35mp4dma8qzvjptg"
+)
+
+func (suite *AuthHandlerTestSuite) TestUnlinkPubkey_Npub() {
+	suite.userService.On("UnlinkPubkeyFromUser", mock.Anything, testNpubHex, "test-firebase-uid").Return(nil)
+
+	jsonBody, _ := json.Marshal(UnlinkPubkeyRequest{PubKey: testNpub})
+	req, _ := http.NewRequest("POST", "/v1/auth/unlink-pubkey", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var response UnlinkPubkeyResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(suite.T(), testNpubHex, response.PubKey)
+}
+
+func (suite *AuthHandlerTestSuite) TestUnlinkPubkey_InvalidNpub() {
+	jsonBody, _ := json.Marshal(UnlinkPubkeyRequest{PubKey: testNpub[:len(testNpub)-1] + "q"})
+	req, _ := http.NewRequest("POST", "/v1/auth/unlink-pubkey", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
 	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
 
 	var response map[string]interface{}
 	json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Equal(suite.T(), "pubkey not found", response["error"])
+	assert.Contains(suite.T(), errorMessage(response), "Invalid npub")
+}
+
+// linkedAuth is the record LinkPubkeyToUser returns in link tests
+func linkedAuth() *models.NostrAuth {
+	return &models.NostrAuth{
+		Pubkey:      "test-pubkey-123",
+		FirebaseUID: "test-firebase-uid",
+		Active:      true,
+		CreatedAt:   time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+		LinkedAt:    time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC),
+	}
 }
 
 // Test LinkPubkey endpoint
 func (suite *AuthHandlerTestSuite) TestLinkPubkey_Success() {
-	suite.userService.On("LinkPubkeyToUser", mock.Anything, "test-pubkey-123", "test-firebase-uid").Return(nil)
+	suite.userService.On("LinkPubkeyToUser", mock.Anything, "test-pubkey-123", "test-firebase-uid").Return(linkedAuth(), false, nil)
 
 	req, _ := http.NewRequest("POST", "/v1/auth/link-pubkey", bytes.NewBuffer([]byte("{}")))
 	req.Header.Set("Content-Type", "application/json")
@@ -192,6 +281,26 @@ func (suite *AuthHandlerTestSuite) TestLinkPubkey_Success() {
 	assert.Equal(suite.T(), "test-firebase-uid", response.FirebaseUID)
 	assert.Equal(suite.T(), "test-pubkey-123", response.PubKey)
 	assert.Contains(suite.T(), response.Message, "linked successfully")
+	assert.Equal(suite.T(), "2026-01-02T15:04:05Z", response.LinkedAt)
+	assert.False(suite.T(), response.AlreadyLinked)
+}
+
+func (suite *AuthHandlerTestSuite) TestLinkPubkey_AlreadyLinked() {
+	suite.userService.On("LinkPubkeyToUser", mock.Anything, "test-pubkey-123", "test-firebase-uid").Return(linkedAuth(), true, nil)
+
+	req, _ := http.NewRequest("POST", "/v1/auth/link-pubkey", bytes.NewBuffer([]byte("{}")))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var response LinkPubkeyResponse
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(suite.T(), response.Success)
+	assert.True(suite.T(), response.AlreadyLinked)
+	assert.Equal(suite.T(), "2026-01-02T15:04:05Z", response.LinkedAt, "the original link time")
+	assert.Contains(suite.T(), response.Message, "already linked")
 }
 
 func (suite *AuthHandlerTestSuite) TestLinkPubkey_WithValidationSuccess() {
@@ -199,7 +308,7 @@ func (suite *AuthHandlerTestSuite) TestLinkPubkey_WithValidationSuccess() {
 		PubKey: "test-pubkey-123", // Should match the one from dual auth middleware
 	}
 
-	suite.userService.On("LinkPubkeyToUser", mock.Anything, "test-pubkey-123", "test-firebase-uid").Return(nil)
+	suite.userService.On("LinkPubkeyToUser", mock.Anything, "test-pubkey-123", "test-firebase-uid").Return(linkedAuth(), false, nil)
 
 	jsonBody, _ := json.Marshal(requestBody)
 	req, _ := http.NewRequest("POST", "/v1/auth/link-pubkey", bytes.NewBuffer(jsonBody))
@@ -230,11 +339,55 @@ func (suite *AuthHandlerTestSuite) TestLinkPubkey_PubkeyMismatch() {
 
 	var response map[string]interface{}
 	json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Equal(suite.T(), "Request pubkey does not match authenticated pubkey", response["error"])
+	assert.Equal(suite.T(), "Request pubkey does not match authenticated pubkey", errorMessage(response))
 }
 
 func (suite *AuthHandlerTestSuite) TestLinkPubkey_ServiceError() {
-	suite.userService.On("LinkPubkeyToUser", mock.Anything, "test-pubkey-123", "test-firebase-uid").Return(errors.New("pubkey already linked to different user"))
+	suite.userService.On("LinkPubkeyToUser", mock.Anything, "test-pubkey-123", "test-firebase-uid").Return(nil, false, services.ErrPubkeyLinkedElsewhere)
+
+	req, _ := http.NewRequest("POST", "/v1/auth/link-pubkey", bytes.NewBuffer([]byte("{}")))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(suite.T(), "user.pubkey_linked_elsewhere", errorCode(response))
+	assert.Equal(suite.T(), services.ErrPubkeyLinkedElsewhere.Message, errorMessage(response))
+}
+
+func (suite *AuthHandlerTestSuite) TestLinkPubkey_UppercaseBodyMatches() {
+	suite.userService.On("LinkPubkeyToUser", mock.Anything, "test-pubkey-123", "test-firebase-uid").Return(linkedAuth(), false, nil)
+
+	req, _ := http.NewRequest("POST", "/v1/auth/link-pubkey", bytes.NewBufferString(`{"pubkey": "TEST-PUBKEY-123"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestLinkPubkey_LimitReached() {
+	suite.userService.On("LinkPubkeyToUser", mock.Anything, "test-pubkey-123", "test-firebase-uid").
+		Return(nil, false, fmt.Errorf("%w (10)", services.ErrPubkeyLimitReached))
+
+	req, _ := http.NewRequest("POST", "/v1/auth/link-pubkey", bytes.NewBuffer([]byte("{}")))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Contains(suite.T(), errorMessage(response), "maximum number of linked pubkeys")
+}
+
+func (suite *AuthHandlerTestSuite) TestLinkPubkey_InvalidPubkey() {
+	suite.userService.On("LinkPubkeyToUser", mock.Anything, "test-pubkey-123", "test-firebase-uid").
+		Return(nil, false, fmt.Errorf("%w, got 15", services.ErrInvalidPubkey))
 
 	req, _ := http.NewRequest("POST", "/v1/auth/link-pubkey", bytes.NewBuffer([]byte("{}")))
 	req.Header.Set("Content-Type", "application/json")
@@ -245,7 +398,165 @@ func (suite *AuthHandlerTestSuite) TestLinkPubkey_ServiceError() {
 
 	var response map[string]interface{}
 	json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Equal(suite.T(), "pubkey already linked to different user", response["error"])
+	assert.Equal(suite.T(), "Invalid pubkey: pubkey must be 64 hex characters, got 15", errorMessage(response))
+}
+
+func (suite *AuthHandlerTestSuite) TestLinkPubkey_RecordsRequestOrigin() {
+	fromRequest := mock.MatchedBy(func(ctx context.Context) bool {
+		origin := services.RequestOriginFromContext(ctx)
+		return origin.IP == "203.0.113.7" && origin.AuthMethod == services.AuditAuthDual
+	})
+	suite.userService.On("LinkPubkeyToUser", fromRequest, "test-pubkey-123", "test-firebase-uid").Return(linkedAuth(), false, nil)
+
+	req, _ := http.NewRequest("POST", "/v1/auth/link-pubkey", bytes.NewBuffer([]byte("{}")))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = "203.0.113.7:5000"
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestGetPubkeyHistory_Success() {
+	events := []models.NostrAuthEvent{
+		{ID: "e2", Type: models.NostrAuthEventUnlink, Pubkey: "pk1", OldFirebaseUID: "test-firebase-uid", CreatedAt: time.Now()},
+		{ID: "e1", Type: models.NostrAuthEventLink, Pubkey: "pk1", NewFirebaseUID: "test-firebase-uid", CreatedAt: time.Now().Add(-time.Hour)},
+	}
+	suite.userService.On("GetPubkeyHistory", mock.Anything, "test-firebase-uid").Return(events, nil)
+
+	req, _ := http.NewRequest("GET", "/v1/auth/pubkey-history", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var response PubkeyHistoryResponse
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(suite.T(), response.Success)
+	assert.Equal(suite.T(), "test-firebase-uid", response.FirebaseUID)
+	assert.Len(suite.T(), response.Events, 2)
+	assert.Equal(suite.T(), models.NostrAuthEventUnlink, response.Events[0].Type)
+}
+
+func (suite *AuthHandlerTestSuite) TestGetPubkeyHistory_EmptyIsArray() {
+	suite.userService.On("GetPubkeyHistory", mock.Anything, "test-firebase-uid").Return(nil, nil)
+
+	req, _ := http.NewRequest("GET", "/v1/auth/pubkey-history", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), `"events":[]`)
+}
+
+func (suite *AuthHandlerTestSuite) TestGetPubkeyHistory_ServiceError() {
+	suite.userService.On("GetPubkeyHistory", mock.Anything, "test-firebase-uid").Return(nil, errors.New("missing index"))
+
+	req, _ := http.NewRequest("GET", "/v1/auth/pubkey-history", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestGetPubkeyHistoryByPubkey_AcceptsNpub() {
+	events := []models.NostrAuthEvent{
+		{ID: "e1", Type: models.NostrAuthEventTransfer, Pubkey: testNpubHex, OldFirebaseUID: "user-a", NewFirebaseUID: "user-b", IP: "203.0.113.7"},
+	}
+	suite.userService.On("GetPubkeyHistoryByPubkey", mock.Anything, testNpubHex).Return(events, nil)
+
+	req, _ := http.NewRequest("GET", "/v1/admin/pubkey-history?pubkey="+testNpub, nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var response PubkeyHistoryResponse
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(suite.T(), testNpubHex, response.PubKey)
+	assert.Equal(suite.T(), "user-a", response.Events[0].OldFirebaseUID)
+	assert.Equal(suite.T(), "203.0.113.7", response.Events[0].IP)
+}
+
+func (suite *AuthHandlerTestSuite) TestGetPubkeyHistoryByPubkey_RequiresPubkey() {
+	req, _ := http.NewRequest("GET", "/v1/admin/pubkey-history", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) checkPubkeys(body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/v1/auth/check-pubkeys", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *AuthHandlerTestSuite) TestCheckPubkeys_Success() {
+	other := "0000000000000000000000000000000000000000000000000000000000000001"
+	suite.userService.On("ArePubkeysLinked", mock.Anything, []string{testNpubHex, other, testNpubHex}).
+		Return(map[string]bool{testNpubHex: true, other: false}, nil)
+
+	w := suite.checkPubkeys(`{"pubkeys": ["` + testNpub + `", "` + other + `", "` + testNpubHex + `"]}`)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var response CheckPubkeysResponse
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(suite.T(), response.Success)
+	assert.Equal(suite.T(), []PubkeyLinkStatus{
+		{PubKey: testNpubHex, IsLinked: true},
+		{PubKey: other, IsLinked: false},
+		{PubKey: testNpubHex, IsLinked: true},
+	}, response.Results)
+	assert.NotContains(suite.T(), w.Body.String(), "firebase_uid")
+}
+
+func (suite *AuthHandlerTestSuite) TestCheckPubkeys_TooMany() {
+	pubkeys := make([]string, services.MaxCheckPubkeys+1)
+	for i := range pubkeys {
+		pubkeys[i] = testNpubHex
+	}
+	body, _ := json.Marshal(CheckPubkeysRequest{PubKeys: pubkeys})
+
+	w := suite.checkPubkeys(string(body))
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "At most 100 pubkeys")
+}
+
+func (suite *AuthHandlerTestSuite) TestCheckPubkeys_Empty() {
+	w := suite.checkPubkeys(`{"pubkeys": []}`)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestCheckPubkeys_InvalidNpub() {
+	w := suite.checkPubkeys(`{"pubkeys": ["npub1invalid"]}`)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "Invalid npub")
+}
+
+func (suite *AuthHandlerTestSuite) TestCheckPubkeys_InvalidHex() {
+	suite.userService.On("ArePubkeysLinked", mock.Anything, []string{"abc"}).
+		Return(nil, fmt.Errorf("%w, got 3", services.ErrInvalidPubkey))
+
+	w := suite.checkPubkeys(`{"pubkeys": ["abc"]}`)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "Invalid pubkey")
+}
+
+func (suite *AuthHandlerTestSuite) TestCheckPubkeys_ServiceError() {
+	suite.userService.On("ArePubkeysLinked", mock.Anything, []string{testNpubHex}).Return(nil, errors.New("unavailable"))
+
+	w := suite.checkPubkeys(`{"pubkeys": ["` + testNpubHex + `"]}`)
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+	assert.NotContains(suite.T(), w.Body.String(), "unavailable")
 }
 
 // Test missing auth context scenarios
@@ -281,13 +592,16 @@ func (suite *AuthHandlerTestSuite) TestEndpoints_MissingAuth() {
 
 		var response map[string]interface{}
 		json.Unmarshal(w.Body.Bytes(), &response)
-		assert.Contains(suite.T(), response["error"].(string), "authentication")
+		assert.Contains(suite.T(), errorMessage(response).(string), "authentication")
 	}
 }
 
 // Test CheckPubkeyLink endpoint
 func (suite *AuthHandlerTestSuite) TestCheckPubkeyLink_Success_Linked() {
-	suite.userService.On("GetFirebaseUIDByPubkey", mock.Anything, "test-pubkey-123").Return("firebase-uid-456", nil)
+	linkedAt := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	suite.userService.On("GetPubkeyLink", mock.Anything, "test-pubkey-123").Return(&models.NostrAuth{
+		Pubkey: "test-pubkey-123", FirebaseUID: "firebase-uid-456", Active: true, LinkedAt: linkedAt,
+	}, nil)
 	suite.userService.On("GetUserEmail", mock.Anything, "firebase-uid-456").Return("user@example.com", nil)
 
 	requestBody := CheckPubkeyLinkRequest{
@@ -315,13 +629,16 @@ func (suite *AuthHandlerTestSuite) TestCheckPubkeyLink_Success_Linked() {
 	assert.NoError(suite.T(), err)
 	assert.True(suite.T(), response.Success)
 	assert.True(suite.T(), response.IsLinked)
-	assert.Equal(suite.T(), "firebase-uid-456", response.FirebaseUID)
+	assert.True(suite.T(), response.IsActive)
+	require.NotNil(suite.T(), response.LinkedAt)
+	assert.True(suite.T(), linkedAt.Equal(*response.LinkedAt))
 	assert.Equal(suite.T(), "test-pubkey-123", response.PubKey)
 	assert.Equal(suite.T(), "user@example.com", response.Email)
+	assert.NotContains(suite.T(), w.Body.String(), "firebase-uid-456")
 }
 
 func (suite *AuthHandlerTestSuite) TestCheckPubkeyLink_Success_NotLinked() {
-	suite.userService.On("GetFirebaseUIDByPubkey", mock.Anything, "unlinked-pubkey").Return("", errors.New("pubkey not found"))
+	suite.userService.On("GetPubkeyLink", mock.Anything, "unlinked-pubkey").Return(nil, services.ErrPubkeyNotLinked)
 
 	requestBody := CheckPubkeyLinkRequest{
 		PubKey: "unlinked-pubkey",
@@ -345,11 +662,55 @@ func (suite *AuthHandlerTestSuite) TestCheckPubkeyLink_Success_NotLinked() {
 	assert.NoError(suite.T(), err)
 	assert.True(suite.T(), response.Success)
 	assert.False(suite.T(), response.IsLinked)
-	assert.Equal(suite.T(), "", response.FirebaseUID)
+	assert.False(suite.T(), response.IsActive)
+	assert.Nil(suite.T(), response.LinkedAt)
 	assert.Equal(suite.T(), "unlinked-pubkey", response.PubKey)
 	assert.Equal(suite.T(), "", response.Email)
 }
 
+func (suite *AuthHandlerTestSuite) TestCheckPubkeyLink_Inactive() {
+	suite.userService.On("GetPubkeyLink", mock.Anything, "old-pubkey").Return(&models.NostrAuth{
+		Pubkey: "old-pubkey", FirebaseUID: "firebase-uid-456", Active: false, LinkedAt: time.Now(),
+	}, nil)
+
+	jsonBody, _ := json.Marshal(CheckPubkeyLinkRequest{PubKey: "old-pubkey"})
+	req, _ := http.NewRequest("POST", "/v1/auth/check-pubkey-link", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+	c.Set("pubkey", "old-pubkey")
+
+	suite.handlers.CheckPubkeyLink(c)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var response CheckPubkeyLinkResponse
+	require.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(suite.T(), response.IsLinked)
+	assert.False(suite.T(), response.IsActive)
+	assert.NotNil(suite.T(), response.LinkedAt)
+	assert.Equal(suite.T(), "", response.Email)
+}
+
+func (suite *AuthHandlerTestSuite) TestCheckPubkeyLink_LookupFailure() {
+	suite.userService.On("GetPubkeyLink", mock.Anything, "test-pubkey").Return(nil, errors.New("firestore down"))
+
+	jsonBody, _ := json.Marshal(CheckPubkeyLinkRequest{PubKey: "test-pubkey"})
+	req, _ := http.NewRequest("POST", "/v1/auth/check-pubkey-link", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+	c.Set("pubkey", "test-pubkey")
+
+	suite.handlers.CheckPubkeyLink(c)
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
+
 func (suite *AuthHandlerTestSuite) TestCheckPubkeyLink_InvalidRequest() {
 	req, _ := http.NewRequest("POST", "/v1/auth/check-pubkey-link", bytes.NewBuffer([]byte("{}")))
 	req.Header.Set("Content-Type", "application/json")
@@ -365,7 +726,7 @@ func (suite *AuthHandlerTestSuite) TestCheckPubkeyLink_InvalidRequest() {
 
 	var response map[string]interface{}
 	json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Contains(suite.T(), response["error"], "pubkey is required")
+	assert.Contains(suite.T(), errorMessage(response), "pubkey is required")
 }
 
 func (suite *AuthHandlerTestSuite) TestCheckPubkeyLink_UnauthorizedNoAuth() {
@@ -388,7 +749,7 @@ func (suite *AuthHandlerTestSuite) TestCheckPubkeyLink_UnauthorizedNoAuth() {
 
 	var response map[string]interface{}
 	json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Equal(suite.T(), "Missing Nostr authentication", response["error"])
+	assert.Equal(suite.T(), "Missing Nostr authentication", errorMessage(response))
 }
 
 func (suite *AuthHandlerTestSuite) TestCheckPubkeyLink_ForbiddenWrongPubkey() {
@@ -411,7 +772,47 @@ func (suite *AuthHandlerTestSuite) TestCheckPubkeyLink_ForbiddenWrongPubkey() {
 
 	var response map[string]interface{}
 	json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Equal(suite.T(), "You can only check linking status for your own pubkey", response["error"])
+	assert.Equal(suite.T(), "You can only check linking status for your own pubkey", errorMessage(response))
+}
+
+func (suite *AuthHandlerTestSuite) TestCheckPubkeyLink_Npub() {
+	suite.userService.On("GetPubkeyLink", mock.Anything, testNpubHex).Return(nil, services.ErrPubkeyNotLinked)
+
+	jsonBody, _ := json.Marshal(CheckPubkeyLinkRequest{PubKey: testNpub})
+	req, _ := http.NewRequest("POST", "/v1/auth/check-pubkey-link", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+	c.Set("pubkey", testNpubHex)
+
+	suite.handlers.CheckPubkeyLink(c)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var response CheckPubkeyLinkResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(suite.T(), testNpubHex, response.PubKey)
+}
+
+func (suite *AuthHandlerTestSuite) TestCheckPubkeyLink_InvalidNpub() {
+	jsonBody, _ := json.Marshal(CheckPubkeyLinkRequest{PubKey: "npub1notbech32"})
+	req, _ := http.NewRequest("POST", "/v1/auth/check-pubkey-link", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+	c.Set("pubkey", testNpubHex)
+
+	suite.handlers.CheckPubkeyLink(c)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Contains(suite.T(), errorMessage(response), "Invalid npub")
 }
 
 func TestAuthHandlerTestSuite(t *testing.T) {
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/bodylimit"
+)
+
+// ErrorCodeUnknownField is returned when a JSON body has a field the endpoint
+// doesn't take
+const ErrorCodeUnknownField = "request.unknown_field"
+
+// UnknownFieldDetails is the details of an ErrorCodeUnknownField error
+type UnknownFieldDetails struct {
+	Field string `json:"field"`
+}
+
+// bindJSON decodes the request body into v like ShouldBindJSON, but rejects
+// fields v doesn't have and anything after the JSON value. Unknown fields and
+// bodies over the route's limit are returned as *apierror.Error; an empty
+// body is io.EOF, and other errors are the decoder's or validator's.
+func bindJSON(c *gin.Context, v interface{}) error {
+	if c.Request.Body == nil {
+		return io.EOF
+	}
+
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return bodyError(err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		if err != nil {
+			return bodyError(err)
+		}
+		return apierror.Validation("request body has data after the JSON value")
+	}
+
+	return binding.Validator.ValidateStruct(v)
+}
+
+// bodyError returns the *apierror.Error for the unknown field and size
+// errors bindJSON reports, and otherwise err
+func bodyError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return bodylimit.TooLarge(tooLarge.Limit).WithCause(err)
+	}
+	// encoding/json has no type for this error, only the message
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		field = strings.Trim(field, `"`)
+		return apierror.Validation(fmt.Sprintf("unknown field %q", field)).
+			WithCode(ErrorCodeUnknownField).
+			WithDetails(UnknownFieldDetails{Field: field})
+	}
+	return err
+}
+
+// bindError is what a handler responds with when bindJSON fails: the
+// *apierror.Error bindJSON returned, or a 400 with message
+func bindError(err error, message string) error {
+	var apiErr *apierror.Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return apierror.Validation(message).WithCause(err)
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+	"github.com/wavlake/api/internal/utils"
+)
+
+type BulkCompressionHandler struct {
+	bulkCompressionService services.BulkCompressionServiceInterface
+	publicURLs             *utils.PublicURLConfig
+}
+
+// NewBulkCompressionHandler creates a new bulk compression handler. publicURLs
+// may be nil, in which case job links are relative.
+func NewBulkCompressionHandler(bulkCompressionService services.BulkCompressionServiceInterface, publicURLs *utils.PublicURLConfig) *BulkCompressionHandler {
+	return &BulkCompressionHandler{
+		bulkCompressionService: bulkCompressionService,
+		publicURLs:             publicURLs,
+	}
+}
+
+// BulkCompressRequest selects tracks by ID or all of the caller's tracks, and
+// the versions to create from explicit options and/or named presets
+type BulkCompressRequest struct {
+	TrackIDs     []string                   `json:"track_ids"`
+	All          bool                       `json:"all"`
+	Compressions []models.CompressionOption `json:"compressions"`
+	Presets      []string                   `json:"presets"`
+}
+
+// BulkCompress handles POST /v1/tracks/bulk-compress
+// Validates the request once, then queues the missing versions of every owned,
+// ready track. Returns 202 with the job; poll GET /v1/tracks/bulk-compress/:job_id.
+func (h *BulkCompressionHandler) BulkCompress(c *gin.Context) {
+	pubkey := c.GetString("pubkey")
+	if pubkey == "" {
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	var req BulkCompressRequest
+	if err := bindJSON(c, &req); err != nil {
+		apierror.Respond(c, bindError(err, "invalid request: "+err.Error()))
+		return
+	}
+
+	if req.All == (len(req.TrackIDs) > 0) {
+		apierror.Respond(c, apierror.Validation("provide either track_ids or all=true"))
+		return
+	}
+	if len(req.TrackIDs) > services.MaxBulkCompressionTracks {
+		apierror.Respond(c, apierror.Validation(services.ErrTooManyBulkTracks.Error()))
+		return
+	}
+
+	options := make([]models.CompressionOption, 0, len(req.Presets)+len(req.Compressions))
+	for _, name := range req.Presets {
+		preset, ok := services.CompressionPresets[name]
+		if !ok {
+			apierror.Respond(c, apierror.Validation("unknown compression preset: "+name))
+			return
+		}
+		options = append(options, preset)
+	}
+	for _, compression := range req.Compressions {
+		if err := validateCompressionOption(compression); err != nil {
+			apierror.Respond(c, apierror.Validation("invalid compression option: "+err.Error()))
+			return
+		}
+		options = append(options, compression)
+	}
+	if len(options) == 0 {
+		apierror.Respond(c, apierror.Validation("at least one compression or preset is required"))
+		return
+	}
+
+	job, err := h.bulkCompressionService.StartBulkCompression(c.Request.Context(), pubkey, req.TrackIDs, req.All, options)
+	if err != nil {
+		if errors.Is(err, services.ErrTooManyBulkTracks) {
+			apierror.Respond(c, apierror.Validation(err.Error()))
+			return
+		}
+		log.Printf("Failed to start bulk compression for %s: %v", pubkey, err)
+		apierror.Respond(c, apierror.Internal("failed to start bulk compression"))
+		return
+	}
+
+	c.Header("Location", h.publicURLs.APIURL("/v1/tracks/bulk-compress/"+job.ID))
+	c.JSON(http.StatusAccepted, gin.H{"success": true, "data": job})
+}
+
+// GetBulkCompressionJob handles GET /v1/tracks/bulk-compress/:job_id
+func (h *BulkCompressionHandler) GetBulkCompressionJob(c *gin.Context) {
+	pubkey := c.GetString("pubkey")
+	if pubkey == "" {
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	job, err := h.bulkCompressionService.GetBulkCompressionJob(c.Request.Context(), pubkey, c.Param("job_id"))
+	if err != nil {
+		if errors.Is(err, services.ErrBulkCompressionJobNotFound) {
+			apierror.Respond(c, apierror.NotFound("bulk compression job not found"))
+			return
+		}
+		log.Printf("Failed to get bulk compression job %s: %v", c.Param("job_id"), err)
+		apierror.Respond(c, apierror.Internal("failed to get bulk compression job"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": job})
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/wavlake/api/internal/mocks"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+	"github.com/wavlake/api/internal/utils"
+)
+
+type BulkCompressionHandlerTestSuite struct {
+	suite.Suite
+	router                 *gin.Engine
+	bulkCompressionService *mocks.MockBulkCompressionService
+	handlers               *BulkCompressionHandler
+}
+
+func (suite *BulkCompressionHandlerTestSuite) SetupTest() {
+	gin.SetMode(gin.TestMode)
+
+	suite.bulkCompressionService = &mocks.MockBulkCompressionService{}
+	suite.handlers = NewBulkCompressionHandler(suite.bulkCompressionService, nil)
+
+	suite.router = gin.New()
+	group := suite.router.Group("/v1/tracks", func(c *gin.Context) {
+		c.Set("pubkey", "test-pubkey")
+		c.Next()
+	})
+	group.POST("/bulk-compress", suite.handlers.BulkCompress)
+	group.GET("/bulk-compress/:job_id", suite.handlers.GetBulkCompressionJob)
+}
+
+func (suite *BulkCompressionHandlerTestSuite) TearDownTest() {
+	suite.bulkCompressionService.AssertExpectations(suite.T())
+}
+
+func (suite *BulkCompressionHandlerTestSuite) post(body interface{}) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	req, _ := http.NewRequest("POST", "/v1/tracks/bulk-compress", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *BulkCompressionHandlerTestSuite) TestBulkCompress_ResolvesPresetsAndOptions() {
+	suite.handlers.publicURLs = &utils.PublicURLConfig{APIBaseURL: "https://api.wavlake.com"}
+	custom := models.CompressionOption{Format: "ogg", Bitrate: 96, Quality: "low"}
+	expected := []models.CompressionOption{services.CompressionPresets["streaming-standard"], services.CompressionPresets["high"], custom}
+	job := &models.BulkCompressionJob{ID: "job-1", Status: models.BulkCompressionJobStatusRunning, Queued: 1, Skipped: 1}
+	suite.bulkCompressionService.On("StartBulkCompression", mock.Anything, "test-pubkey", []string(nil), true, expected).Return(job, nil)
+
+	w := suite.post(BulkCompressRequest{
+		All:          true,
+		Presets:      []string{"streaming-standard", "high"},
+		Compressions: []models.CompressionOption{custom},
+	})
+
+	assert.Equal(suite.T(), http.StatusAccepted, w.Code)
+	assert.Equal(suite.T(), "https://api.wavlake.com/v1/tracks/bulk-compress/job-1", w.Header().Get("Location"))
+
+	var response struct {
+		Success bool                      `json:"success"`
+		Data    models.BulkCompressionJob `json:"data"`
+	}
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(suite.T(), response.Success)
+	assert.Equal(suite.T(), 1, response.Data.Queued)
+	assert.Equal(suite.T(), 1, response.Data.Skipped)
+}
+
+func (suite *BulkCompressionHandlerTestSuite) TestBulkCompress_ValidatesRequest() {
+	tests := []struct {
+		name string
+		body BulkCompressRequest
+	}{
+		{"no tracks", BulkCompressRequest{Presets: []string{"high"}}},
+		{"tracks and all", BulkCompressRequest{TrackIDs: []string{"track-1"}, All: true, Presets: []string{"high"}}},
+		{"no options", BulkCompressRequest{TrackIDs: []string{"track-1"}}},
+		{"unknown preset", BulkCompressRequest{TrackIDs: []string{"track-1"}, Presets: []string{"lossless"}}},
+		{"invalid option", BulkCompressRequest{TrackIDs: []string{"track-1"}, Compressions: []models.CompressionOption{{Format: "flac", Bitrate: 128}}}},
+	}
+
+	for _, tt := range tests {
+		w := suite.post(tt.body)
+		assert.Equal(suite.T(), http.StatusBadRequest, w.Code, tt.name)
+	}
+}
+
+func (suite *BulkCompressionHandlerTestSuite) TestBulkCompress_TooManyTracks() {
+	trackIDs := make([]string, services.MaxBulkCompressionTracks+1)
+	for i := range trackIDs {
+		trackIDs[i] = "track"
+	}
+
+	w := suite.post(BulkCompressRequest{TrackIDs: trackIDs, Presets: []string{"high"}})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	suite.bulkCompressionService.On("StartBulkCompression", mock.Anything, "test-pubkey", []string(nil), true, mock.Anything).
+		Return(nil, services.ErrTooManyBulkTracks)
+	w = suite.post(BulkCompressRequest{All: true, Presets: []string{"high"}})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *BulkCompressionHandlerTestSuite) TestGetBulkCompressionJob() {
+	job := &models.BulkCompressionJob{ID: "job-1", Status: models.BulkCompressionJobStatusCompleted, Queued: 2, Completed: 1, Failed: 1}
+	suite.bulkCompressionService.On("GetBulkCompressionJob", mock.Anything, "test-pubkey", "job-1").Return(job, nil)
+
+	req, _ := http.NewRequest("GET", "/v1/tracks/bulk-compress/job-1", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), `"completed":1`)
+}
+
+func (suite *BulkCompressionHandlerTestSuite) TestGetBulkCompressionJob_NotFound() {
+	suite.bulkCompressionService.On("GetBulkCompressionJob", mock.Anything, "test-pubkey", "missing").Return(nil, services.ErrBulkCompressionJobNotFound)
+	suite.bulkCompressionService.On("GetBulkCompressionJob", mock.Anything, "test-pubkey", "broken").Return(nil, errors.New("firestore unavailable"))
+
+	req, _ := http.NewRequest("GET", "/v1/tracks/bulk-compress/missing", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+
+	req, _ = http.NewRequest("GET", "/v1/tracks/bulk-compress/broken", nil)
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
+
+func TestBulkCompressionHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(BulkCompressionHandlerTestSuite))
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/services"
+)
+
+// DevFilesHandler serves a local storage backend's objects and accepts
+// uploads to its signed URLs, standing in for a bucket during development
+type DevFilesHandler struct {
+	storage *services.LocalStorageService
+}
+
+// NewDevFilesHandler creates a handler for a local storage backend
+func NewDevFilesHandler(storage *services.LocalStorageService) *DevFilesHandler {
+	return &DevFilesHandler{storage: storage}
+}
+
+// GetFile handles GET /v1/dev/files/*path
+// Objects are public, like a bucket's public URLs; a request carrying a
+// signature must be a valid, unexpired download URL.
+func (h *DevFilesHandler) GetFile(c *gin.Context) {
+	objectName := strings.TrimPrefix(c.Param("path"), "/")
+
+	if c.Query("signature") != "" {
+		if _, err := h.storage.VerifySignedURL(http.MethodGet, objectName, c.Request.URL.Query(), ""); err != nil {
+			apierror.Respond(c, apierror.Forbidden(err.Error()))
+			return
+		}
+	}
+
+	file, err := h.storage.OpenObject(objectName)
+	if err != nil {
+		apierror.Respond(c, apierror.NotFound("object not found"))
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		apierror.Respond(c, apierror.NotFound("object not found"))
+		return
+	}
+
+	if contentType := mime.TypeByExtension(path.Ext(objectName)); contentType != "" {
+		c.Header("Content-Type", contentType)
+	}
+	http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), file)
+}
+
+// PutFile handles PUT /v1/dev/files/*path
+// Uploads need a URL from GeneratePresignedURL and its Content-Type; bodies
+// past its size limit are rejected with 400 like GCS does.
+func (h *DevFilesHandler) PutFile(c *gin.Context) {
+	objectName := strings.TrimPrefix(c.Param("path"), "/")
+
+	maxBytes, err := h.storage.VerifySignedURL(http.MethodPut, objectName, c.Request.URL.Query(), c.GetHeader("Content-Type"))
+	if err != nil {
+		apierror.Respond(c, apierror.Forbidden(err.Error()))
+		return
+	}
+
+	body := c.Request.Body
+	if maxBytes > 0 {
+		body = http.MaxBytesReader(c.Writer, body, maxBytes)
+	}
+
+	if err := h.storage.UploadObject(c.Request.Context(), objectName, body, c.GetHeader("Content-Type")); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			apierror.Respond(c, apierror.Validation("EntityTooLarge"))
+			return
+		}
+		apierror.Respond(c, apierror.Internal("failed to store object"))
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/services"
+)
+
+func newDevFilesRouter(t *testing.T) (*gin.Engine, *services.LocalStorageService) {
+	t.Helper()
+	storage, err := services.NewLocalStorageService(t.TempDir(), "http://localhost:8080", []byte("secret"))
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	handler := NewDevFilesHandler(storage)
+	router.GET("/v1/dev/files/*path", handler.GetFile)
+	router.PUT("/v1/dev/files/*path", handler.PutFile)
+	return router, storage
+}
+
+// serveDevFile sends a request to a URL the local storage signed or served
+func serveDevFile(router *gin.Engine, method, rawURL, contentType, body string) *httptest.ResponseRecorder {
+	parsed, _ := url.Parse(rawURL)
+	req, _ := http.NewRequest(method, parsed.RequestURI(), strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestDevFiles_UploadAndReadBack(t *testing.T) {
+	router, storage := newDevFilesRouter(t)
+	constraints := services.UploadConstraints{ContentType: "audio/mpeg", MaxBytes: 64}
+	uploadURL, err := storage.GeneratePresignedURL(context.Background(), "tracks/original/abc.mp3", time.Hour, constraints)
+	require.NoError(t, err)
+
+	w := serveDevFile(router, "PUT", uploadURL, "audio/mpeg", "ID3 audio")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = serveDevFile(router, "GET", storage.GetPublicURL("tracks/original/abc.mp3"), "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ID3 audio", w.Body.String())
+	assert.Equal(t, "audio/mpeg", w.Header().Get("Content-Type"))
+
+	downloadURL, err := storage.GenerateDownloadURL(context.Background(), "tracks/original/abc.mp3", time.Hour)
+	require.NoError(t, err)
+	w = serveDevFile(router, "GET", downloadURL, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ID3 audio", w.Body.String())
+
+	require.NoError(t, storage.DeleteObject(context.Background(), "tracks/original/abc.mp3"))
+	w = serveDevFile(router, "GET", storage.GetPublicURL("tracks/original/abc.mp3"), "", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestDevFiles_RejectsUploadsOutsideTheSignedURL(t *testing.T) {
+	router, storage := newDevFilesRouter(t)
+	constraints := services.UploadConstraints{ContentType: "audio/mpeg", MaxBytes: 8}
+	uploadURL, err := storage.GeneratePresignedURL(context.Background(), "tracks/original/abc.mp3", time.Hour, constraints)
+	require.NoError(t, err)
+
+	// Unsigned, with another content type, and past the size limit
+	assert.Equal(t, http.StatusForbidden, serveDevFile(router, "PUT", storage.GetPublicURL("tracks/original/abc.mp3"), "audio/mpeg", "ID3").Code)
+	assert.Equal(t, http.StatusForbidden, serveDevFile(router, "PUT", uploadURL, "audio/wav", "ID3").Code)
+	w := serveDevFile(router, "PUT", uploadURL, "audio/mpeg", "ID3 much too long")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "EntityTooLarge")
+
+	_, err = storage.GetObjectSize(context.Background(), "tracks/original/abc.mp3")
+	assert.Error(t, err)
+}
+
+func TestDevFiles_ExpiredURLs(t *testing.T) {
+	router, storage := newDevFilesRouter(t)
+	require.NoError(t, storage.UploadObject(context.Background(), "tracks/original/abc.mp3", strings.NewReader("ID3"), "audio/mpeg"))
+
+	uploadURL, err := storage.GeneratePresignedURL(context.Background(), "tracks/original/abc.mp3", -time.Second, services.UploadConstraints{})
+	require.NoError(t, err)
+	w := serveDevFile(router, "PUT", uploadURL, "", "ID3 replaced")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "expired")
+
+	downloadURL, err := storage.GenerateDownloadURL(context.Background(), "tracks/original/abc.mp3", -time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, serveDevFile(router, "GET", downloadURL, "", "").Code)
+}
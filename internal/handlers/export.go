@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/services"
+	"github.com/wavlake/api/internal/utils"
+)
+
+type ExportHandler struct {
+	exportService services.ExportServiceInterface
+	publicURLs    *utils.PublicURLConfig
+}
+
+// NewExportHandler creates a new export handler. publicURLs may be nil, in
+// which case job links are relative.
+func NewExportHandler(exportService services.ExportServiceInterface, publicURLs *utils.PublicURLConfig) *ExportHandler {
+	return &ExportHandler{
+		exportService: exportService,
+		publicURLs:    publicURLs,
+	}
+}
+
+// ExportUserData handles GET /v1/users/me/export
+// Small accounts receive the zip archive directly; large accounts get a 202
+// with a job to poll via GET /v1/users/me/export/:job_id
+func (h *ExportHandler) ExportUserData(c *gin.Context) {
+	firebaseUID := c.GetString("firebase_uid")
+	if firebaseUID == "" {
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	trackCount, err := h.exportService.CountTracks(c.Request.Context(), firebaseUID)
+	if err != nil {
+		log.Printf("Failed to count tracks for export of user %s: %v", firebaseUID, err)
+		apierror.Respond(c, apierror.Internal("failed to start export"))
+		return
+	}
+
+	if h.exportService.RequiresAsyncExport(trackCount) {
+		job, err := h.exportService.StartExportJob(c.Request.Context(), firebaseUID, trackCount)
+		if err != nil {
+			log.Printf("Failed to start export job for user %s: %v", firebaseUID, err)
+			apierror.Respond(c, apierror.Internal("failed to start export"))
+			return
+		}
+
+		c.Header("Location", h.publicURLs.APIURL("/v1/users/me/export/"+job.ID))
+		c.JSON(http.StatusAccepted, gin.H{"success": true, "data": job})
+		return
+	}
+
+	filename := fmt.Sprintf("wavlake-export-%s.zip", time.Now().UTC().Format("20060102"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	// Headers are already sent once streaming starts, so failures can only be
+	// logged; the truncated archive fails to open on the client
+	if err := h.exportService.WriteExport(c.Request.Context(), firebaseUID, c.Writer); err != nil {
+		log.Printf("Failed to stream export for user %s: %v", firebaseUID, err)
+	}
+}
+
+// GetExportJob handles GET /v1/users/me/export/:job_id
+func (h *ExportHandler) GetExportJob(c *gin.Context) {
+	firebaseUID := c.GetString("firebase_uid")
+	if firebaseUID == "" {
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	job, err := h.exportService.GetExportJob(c.Request.Context(), firebaseUID, c.Param("job_id"))
+	if err != nil {
+		if errors.Is(err, services.ErrExportJobNotFound) {
+			apierror.Respond(c, apierror.NotFound("export job not found"))
+			return
+		}
+		log.Printf("Failed to get export job %s: %v", c.Param("job_id"), err)
+		apierror.Respond(c, apierror.Internal("failed to get export job"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": job})
+}
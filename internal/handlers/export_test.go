@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/wavlake/api/internal/mocks"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+	"github.com/wavlake/api/internal/utils"
+)
+
+type ExportHandlerTestSuite struct {
+	suite.Suite
+	router        *gin.Engine
+	exportService *mocks.MockExportService
+	handlers      *ExportHandler
+}
+
+func (suite *ExportHandlerTestSuite) SetupTest() {
+	gin.SetMode(gin.TestMode)
+
+	suite.exportService = &mocks.MockExportService{}
+	suite.handlers = NewExportHandler(suite.exportService, nil)
+
+	suite.router = gin.New()
+	group := suite.router.Group("/v1/users", func(c *gin.Context) {
+		c.Set("firebase_uid", "test-firebase-uid")
+		c.Next()
+	})
+	group.GET("/me/export", suite.handlers.ExportUserData)
+	group.GET("/me/export/:job_id", suite.handlers.GetExportJob)
+}
+
+func (suite *ExportHandlerTestSuite) TearDownTest() {
+	suite.exportService.AssertExpectations(suite.T())
+}
+
+func (suite *ExportHandlerTestSuite) TestExportUserData_StreamsArchive() {
+	suite.exportService.On("CountTracks", mock.Anything, "test-firebase-uid").Return(3, nil)
+	suite.exportService.On("RequiresAsyncExport", 3).Return(false)
+	suite.exportService.On("WriteExport", mock.Anything, "test-firebase-uid", mock.Anything).
+		Run(func(args mock.Arguments) {
+			io.WriteString(args.Get(2).(io.Writer), "PK-archive")
+		}).
+		Return(nil)
+
+	req, _ := http.NewRequest("GET", "/v1/users/me/export", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "application/zip", w.Header().Get("Content-Type"))
+	assert.Contains(suite.T(), w.Header().Get("Content-Disposition"), "attachment")
+	assert.Equal(suite.T(), "PK-archive", w.Body.String())
+}
+
+func (suite *ExportHandlerTestSuite) TestExportUserData_JobLinkUsesPublicAPIBase() {
+	suite.handlers.publicURLs = &utils.PublicURLConfig{APIBaseURL: "https://api.wavlake.com"}
+	job := &models.ExportJob{ID: "job-1", Status: models.ExportJobStatusPending, TrackCount: 500}
+	suite.exportService.On("CountTracks", mock.Anything, "test-firebase-uid").Return(500, nil)
+	suite.exportService.On("RequiresAsyncExport", 500).Return(true)
+	suite.exportService.On("StartExportJob", mock.Anything, "test-firebase-uid", 500).Return(job, nil)
+
+	req, _ := http.NewRequest("GET", "/v1/users/me/export", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusAccepted, w.Code)
+	assert.Equal(suite.T(), "https://api.wavlake.com/v1/users/me/export/job-1", w.Header().Get("Location"))
+}
+
+func (suite *ExportHandlerTestSuite) TestExportUserData_LargeAccountStartsJob() {
+	job := &models.ExportJob{ID: "job-1", Status: models.ExportJobStatusPending, TrackCount: 500}
+	suite.exportService.On("CountTracks", mock.Anything, "test-firebase-uid").Return(500, nil)
+	suite.exportService.On("RequiresAsyncExport", 500).Return(true)
+	suite.exportService.On("StartExportJob", mock.Anything, "test-firebase-uid", 500).Return(job, nil)
+
+	req, _ := http.NewRequest("GET", "/v1/users/me/export", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusAccepted, w.Code)
+	assert.Equal(suite.T(), "/v1/users/me/export/job-1", w.Header().Get("Location"))
+
+	var response map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(suite.T(), err)
+	data := response["data"].(map[string]interface{})
+	assert.Equal(suite.T(), "job-1", data["id"])
+	assert.Equal(suite.T(), models.ExportJobStatusPending, data["status"])
+}
+
+func (suite *ExportHandlerTestSuite) TestExportUserData_CountError() {
+	suite.exportService.On("CountTracks", mock.Anything, "test-firebase-uid").Return(0, errors.New("firestore unavailable"))
+
+	req, _ := http.NewRequest("GET", "/v1/users/me/export", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
+
+func (suite *ExportHandlerTestSuite) TestGetExportJob_Completed() {
+	job := &models.ExportJob{ID: "job-1", Status: models.ExportJobStatusCompleted, DownloadURL: "https://signed.example/job-1.zip"}
+	suite.exportService.On("GetExportJob", mock.Anything, "test-firebase-uid", "job-1").Return(job, nil)
+
+	req, _ := http.NewRequest("GET", "/v1/users/me/export/job-1", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "https://signed.example/job-1.zip")
+}
+
+func (suite *ExportHandlerTestSuite) TestGetExportJob_NotFound() {
+	suite.exportService.On("GetExportJob", mock.Anything, "test-firebase-uid", "other-job").Return(nil, services.ErrExportJobNotFound)
+
+	req, _ := http.NewRequest("GET", "/v1/users/me/export/other-job", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *ExportHandlerTestSuite) TestExportUserData_RequiresAuth() {
+	router := gin.New()
+	router.GET("/v1/users/me/export", suite.handlers.ExportUserData)
+
+	req, _ := http.NewRequest("GET", "/v1/users/me/export", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func TestExportHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(ExportHandlerTestSuite))
+}
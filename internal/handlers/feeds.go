@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/feeds"
+)
+
+// feedCacheControl lets clients and CDNs reuse a feed briefly; after that
+// If-None-Match revalidates it cheaply
+const feedCacheControl = "public, max-age=300"
+
+type FeedsHandler struct {
+	generator *feeds.Generator
+}
+
+func NewFeedsHandler(generator *feeds.Generator) *FeedsHandler {
+	return &FeedsHandler{generator: generator}
+}
+
+// GetPubkeyFeed handles GET /v1/feeds/pubkey/:pubkey.xml
+// Returns the pubkey's RSS feed. The pubkey may be hex or an npub. Responses
+// carry an ETag, and a matching If-None-Match gets 304.
+func (h *FeedsHandler) GetPubkeyFeed(c *gin.Context) {
+	name, ok := strings.CutSuffix(c.Param("file"), ".xml")
+	if !ok {
+		feedError(c, http.StatusNotFound, "feed not found")
+		return
+	}
+	pubkey, err := feeds.NormalizePubkey(name)
+	if err != nil {
+		feedError(c, http.StatusNotFound, "feed not found")
+		return
+	}
+
+	feed, err := h.generator.Feed(c.Request.Context(), pubkey)
+	if errors.Is(err, feeds.ErrFeedNotFound) {
+		feedError(c, http.StatusNotFound, "feed not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to build feed for %s: %v", pubkey, err)
+		feedError(c, http.StatusInternalServerError, "failed to build feed")
+		return
+	}
+
+	c.Header("ETag", feed.ETag)
+	c.Header("Cache-Control", feedCacheControl)
+	if etagMatches(c.GetHeader("If-None-Match"), feed.ETag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, feeds.ContentType, feed.Body)
+}
+
+// etagMatches reports whether an If-None-Match header lists etag or "*"
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func feedError(c *gin.Context, status int, message string) {
+	c.Data(status, "application/xml; charset=utf-8", feeds.ErrorBody(message))
+}
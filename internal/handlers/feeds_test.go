@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/wavlake/api/internal/feeds"
+	"github.com/wavlake/api/internal/mocks"
+	"github.com/wavlake/api/internal/models"
+)
+
+const feedPubkey = "7e7e9c42a91bfef19fa929e5fda1b72e0ebc1a4c1141673e2794234d86addf4e"
+
+type FeedsHandlerTestSuite struct {
+	suite.Suite
+	router      *gin.Engine
+	trackSvc    *mocks.MockNostrTrackService
+	userService *mocks.MockUserService
+}
+
+func (suite *FeedsHandlerTestSuite) SetupTest() {
+	gin.SetMode(gin.TestMode)
+
+	suite.trackSvc = &mocks.MockNostrTrackService{}
+	suite.userService = &mocks.MockUserService{}
+	suite.router = gin.New()
+	handler := NewFeedsHandler(feeds.NewGenerator(suite.trackSvc, suite.userService, nil))
+	suite.router.GET("/v1/feeds/pubkey/:file", handler.GetPubkeyFeed)
+}
+
+func (suite *FeedsHandlerTestSuite) TearDownTest() {
+	suite.trackSvc.AssertExpectations(suite.T())
+	suite.userService.AssertExpectations(suite.T())
+}
+
+func (suite *FeedsHandlerTestSuite) get(path, ifNoneMatch string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", path, nil)
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *FeedsHandlerTestSuite) TestFeedWithETag() {
+	track := &models.NostrTrack{
+		ID:        "track-1",
+		Status:    models.TrackStatusReady,
+		Title:     "Song",
+		UpdatedAt: time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC),
+		CompressionVersions: []models.CompressionVersion{
+			{ID: "v1", URL: "https://media.example.com/v1.mp3", Format: "mp3", Bitrate: 128, IsPublic: true},
+		},
+	}
+	suite.trackSvc.On("GetTracksByPubkey", mock.Anything, feedPubkey).Return([]*models.NostrTrack{track}, nil)
+	suite.userService.On("GetFirebaseUIDByPubkey", mock.Anything, feedPubkey).Return("uid-1", nil)
+	suite.userService.On("GetOrCreateUser", mock.Anything, "uid-1").Return(&models.User{DisplayName: "Band"}, nil)
+
+	w := suite.get("/v1/feeds/pubkey/"+feedPubkey+".xml", "")
+	suite.Equal(http.StatusOK, w.Code)
+	suite.Equal(feeds.ContentType, w.Header().Get("Content-Type"))
+	suite.Contains(w.Body.String(), "<title>Band</title>")
+	etag := w.Header().Get("ETag")
+	suite.NotEmpty(etag)
+	suite.Equal(feedCacheControl, w.Header().Get("Cache-Control"))
+
+	w = suite.get("/v1/feeds/pubkey/"+feedPubkey+".xml", `"stale", W/`+etag)
+	suite.Equal(http.StatusNotModified, w.Code)
+	suite.Empty(w.Body.String())
+}
+
+func (suite *FeedsHandlerTestSuite) TestAcceptsNpub() {
+	suite.trackSvc.On("GetTracksByPubkey", mock.Anything, feedPubkey).Return([]*models.NostrTrack{}, nil)
+	suite.userService.On("GetFirebaseUIDByPubkey", mock.Anything, feedPubkey).Return("", errors.New("pubkey not found"))
+
+	w := suite.get("/v1/feeds/pubkey/npub10elfcs4fr0l0r8af98jlmgdh9c8tcxjvz9qkw038js35mp4dma8qzvjptg.xml", "")
+	suite.Equal(http.StatusNotFound, w.Code)
+	suite.Contains(w.Body.String(), "<error><message>feed not found</message></error>")
+}
+
+func (suite *FeedsHandlerTestSuite) TestInvalidPubkeys() {
+	for _, path := range []string{
+		"/v1/feeds/pubkey/" + feedPubkey,
+		"/v1/feeds/pubkey/not-a-pubkey.xml",
+		"/v1/feeds/pubkey/%3Cscript%3E.xml",
+	} {
+		w := suite.get(path, "")
+		suite.Equal(http.StatusNotFound, w.Code, path)
+		suite.Equal("application/xml; charset=utf-8", w.Header().Get("Content-Type"), path)
+		suite.NotContains(w.Body.String(), "<script>", path)
+	}
+}
+
+func (suite *FeedsHandlerTestSuite) TestListFailure() {
+	suite.trackSvc.On("GetTracksByPubkey", mock.Anything, feedPubkey).Return(nil, errors.New("firestore down"))
+
+	w := suite.get("/v1/feeds/pubkey/"+feedPubkey+".xml", "")
+	suite.Equal(http.StatusInternalServerError, w.Code)
+	suite.Contains(w.Body.String(), "failed to build feed")
+}
+
+func TestFeedsHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(FeedsHandlerTestSuite))
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/logging"
+)
+
+// DefaultHealthCheckTimeout bounds each readiness check
+const DefaultHealthCheckTimeout = 2 * time.Second
+
+// Dependency statuses reported by /readyz
+const (
+	HealthStatusOK      = "ok"
+	HealthStatusDown    = "down"
+	HealthStatusSkipped = "skipped" // The dependency isn't configured
+)
+
+// HealthCheck reports whether a dependency is reachable. It should return
+// promptly once ctx is done.
+type HealthCheck func(ctx context.Context) error
+
+// DependencyHealth is one dependency's result in a readiness report. The
+// probe is unauthenticated, so a failed check's error is logged rather than
+// returned.
+type DependencyHealth struct {
+	Status string `json:"status"`
+}
+
+// ReadinessResponse reports whether the instance should receive traffic
+type ReadinessResponse struct {
+	Status string                      `json:"status"` // "ok" or "unavailable"
+	Checks map[string]DependencyHealth `json:"checks"`
+}
+
+// HealthHandler serves /livez and /readyz. Register a check per dependency;
+// /readyz runs them concurrently, each with its own timeout.
+type HealthHandler struct {
+	timeout time.Duration
+
+	mu      sync.RWMutex
+	checks  map[string]HealthCheck
+	skipped map[string]bool
+}
+
+// NewHealthHandler creates a health handler with no checks. A timeout of zero
+// uses DefaultHealthCheckTimeout.
+func NewHealthHandler(timeout time.Duration) *HealthHandler {
+	if timeout <= 0 {
+		timeout = DefaultHealthCheckTimeout
+	}
+	return &HealthHandler{
+		timeout: timeout,
+		checks:  map[string]HealthCheck{},
+		skipped: map[string]bool{},
+	}
+}
+
+// Register adds or replaces the readiness check for a dependency
+func (h *HealthHandler) Register(name string, check HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.skipped, name)
+	h.checks[name] = check
+}
+
+// Skip reports a dependency that isn't configured as skipped, so it never
+// fails readiness
+func (h *HealthHandler) Skip(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.checks, name)
+	h.skipped[name] = true
+}
+
+// Livez handles GET /livez
+// Confirms the process is serving requests; dependencies aren't checked
+func (h *HealthHandler) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": HealthStatusOK})
+}
+
+// Readyz handles GET /readyz
+// Returns 503 with each dependency's status when any check fails
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	h.mu.RLock()
+	checks := make(map[string]HealthCheck, len(h.checks))
+	for name, check := range h.checks {
+		checks[name] = check
+	}
+	results := make(map[string]DependencyHealth, len(h.checks)+len(h.skipped))
+	for name := range h.skipped {
+		results[name] = DependencyHealth{Status: HealthStatusSkipped}
+	}
+	h.mu.RUnlock()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check HealthCheck) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeout)
+			defer cancel()
+
+			result := DependencyHealth{Status: HealthStatusOK}
+			if err := check(ctx); err != nil {
+				logging.FromContext(ctx).Warn("readiness check failed", "check", name, "error", err)
+				result = DependencyHealth{Status: HealthStatusDown}
+			}
+			mu.Lock()
+			results[name] = result
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	response := ReadinessResponse{Status: HealthStatusOK, Checks: results}
+	code := http.StatusOK
+	for _, result := range results {
+		if result.Status == HealthStatusDown {
+			response.Status = "unavailable"
+			code = http.StatusServiceUnavailable
+			break
+		}
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(code, response)
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveHealth(t *testing.T, handler *HealthHandler, path string) (*httptest.ResponseRecorder, ReadinessResponse) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/livez", handler.Livez)
+	router.GET("/readyz", handler.Readyz)
+
+	req, _ := http.NewRequest("GET", path, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response ReadinessResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w, response
+}
+
+func healthy(ctx context.Context) error { return nil }
+
+func TestReadyz_AllHealthy(t *testing.T) {
+	handler := NewHealthHandler(time.Second)
+	handler.Register("firestore", healthy)
+	handler.Register("storage", healthy)
+	handler.Skip("postgres")
+
+	w, response := serveHealth(t, handler, "/readyz")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", response.Status)
+	assert.Equal(t, map[string]DependencyHealth{
+		"firestore": {Status: HealthStatusOK},
+		"storage":   {Status: HealthStatusOK},
+		"postgres":  {Status: HealthStatusSkipped},
+	}, response.Checks)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+}
+
+func TestReadyz_DependencyDown(t *testing.T) {
+	handler := NewHealthHandler(time.Second)
+	handler.Register("firestore", healthy)
+	handler.Register("postgres", func(ctx context.Context) error { return errors.New("connection refused") })
+
+	w, response := serveHealth(t, handler, "/readyz")
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "unavailable", response.Status)
+	assert.Equal(t, HealthStatusOK, response.Checks["firestore"].Status)
+	assert.Equal(t, DependencyHealth{Status: HealthStatusDown}, response.Checks["postgres"])
+	assert.NotContains(t, w.Body.String(), "connection refused")
+}
+
+func TestReadyz_SlowCheckTimesOut(t *testing.T) {
+	handler := NewHealthHandler(20 * time.Millisecond)
+	handler.Register("storage", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	start := time.Now()
+	w, response := serveHealth(t, handler, "/readyz")
+
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Contains(t, response.Checks, "storage")
+	assert.Equal(t, HealthStatusDown, response.Checks["storage"].Status)
+}
+
+func TestLivez_IgnoresDependencies(t *testing.T) {
+	handler := NewHealthHandler(time.Second)
+	handler.Register("firestore", func(ctx context.Context) error { return errors.New("down") })
+
+	w, _ := serveHealth(t, handler, "/livez")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+}
@@ -3,39 +3,69 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
-	"os"
+	"time"
+
+	"github.com/wavlake/api/internal/apierror"
 )
 
-type HeartbeatResponse struct {
-	Status    string `json:"status"`
-	CommitSHA string `json:"commit_sha"`
+// BuildInfo describes the running binary and how it was configured at
+// startup. main.go fills it in once, so the heartbeat never checks a
+// dependency; that's /readyz.
+type BuildInfo struct {
+	Version         string // Injected with -ldflags "-X main.version=..."
+	CommitSHA       string
+	GoVersion       string
+	StartedAt       time.Time
+	StorageProvider string // The STORAGE_PROVIDER backend, e.g. "gcs"
+	PostgresEnabled bool   // A PostgreSQL connection string is configured
+	LegacyEndpoints bool   // /v1/legacy is served, which needs PostgreSQL reachable at startup
+	FFmpegAvailable bool   // ffmpeg and ffprobe were on the PATH at startup
 }
 
-func Heartbeat(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+type HeartbeatResponse struct {
+	Status          string    `json:"status"`
+	CommitSHA       string    `json:"commit_sha"`
+	Version         string    `json:"version"`
+	GoVersion       string    `json:"go_version"`
+	StartedAt       time.Time `json:"started_at"`
+	UptimeSeconds   int64     `json:"uptime_seconds"`
+	StorageProvider string    `json:"storage_provider"`
+	PostgresEnabled bool      `json:"postgres_enabled"`
+	LegacyEndpoints bool      `json:"legacy_endpoints"`
+	FFmpegAvailable bool      `json:"ffmpeg_available"`
+}
 
-	commitSHA := os.Getenv("COMMIT_SHA")
-	if commitSHA == "" {
-		commitSHA = "unknown"
-	}
+// Heartbeat returns the handler for GET /heartbeat, reporting info
+func Heartbeat(info BuildInfo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			apierror.Write(w, r, apierror.New(http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed"))
+			return
+		}
 
-	response := HeartbeatResponse{
-		Status:    "ok",
-		CommitSHA: commitSHA,
-	}
+		response := HeartbeatResponse{
+			Status:          "ok",
+			CommitSHA:       info.CommitSHA,
+			Version:         info.Version,
+			GoVersion:       info.GoVersion,
+			StartedAt:       info.StartedAt.UTC(),
+			UptimeSeconds:   int64(time.Since(info.StartedAt) / time.Second),
+			StorageProvider: info.StorageProvider,
+			PostgresEnabled: info.PostgresEnabled,
+			LegacyEndpoints: info.LegacyEndpoints,
+			FFmpegAvailable: info.FFmpegAvailable,
+		}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		// Log error but response headers are already sent
-		// In production, this would be logged to your logging system
-		_ = err
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			// Log error but response headers are already sent
+			// In production, this would be logged to your logging system
+			_ = err
+		}
 	}
 }
 
 func NotFound(w http.ResponseWriter, r *http.Request) {
-	http.Error(w, "Not found", http.StatusNotFound)
+	apierror.Write(w, r, apierror.NotFound("Not found"))
 }
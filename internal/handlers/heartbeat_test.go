@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeartbeat(t *testing.T) {
+	startedAt := time.Now().Add(-90 * time.Second)
+	handler := Heartbeat(BuildInfo{
+		Version:         "v1.4.0",
+		CommitSHA:       "abc1234",
+		GoVersion:       "go1.24.2",
+		StartedAt:       startedAt,
+		StorageProvider: "gcs",
+		PostgresEnabled: true,
+		LegacyEndpoints: false,
+		FFmpegAvailable: true,
+	})
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/heartbeat", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	uptime := body["uptime_seconds"].(float64)
+	assert.GreaterOrEqual(t, uptime, float64(90))
+	assert.Less(t, uptime, float64(100))
+	delete(body, "uptime_seconds")
+	assert.Equal(t, map[string]interface{}{
+		"status":           "ok",
+		"commit_sha":       "abc1234",
+		"version":          "v1.4.0",
+		"go_version":       "go1.24.2",
+		"started_at":       startedAt.UTC().Format(time.RFC3339Nano),
+		"storage_provider": "gcs",
+		"postgres_enabled": true,
+		"legacy_endpoints": false,
+		"ffmpeg_available": true,
+	}, body)
+}
+
+func TestHeartbeat_MethodNotAllowed(t *testing.T) {
+	w := httptest.NewRecorder()
+	Heartbeat(BuildInfo{})(w, httptest.NewRequest(http.MethodPost, "/heartbeat", nil))
+
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
@@ -1,169 +1,255 @@
 package handlers
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/apierror"
 	"github.com/wavlake/api/internal/models"
 	"github.com/wavlake/api/internal/services"
+	"golang.org/x/sync/errgroup"
 )
 
+// legacyMetadataTimeout bounds all of GetUserMetadata's queries together
+const legacyMetadataTimeout = 10 * time.Second
+
 type LegacyHandler struct {
 	postgresService services.PostgresServiceInterface
+	metadataTimeout time.Duration
 }
 
 // NewLegacyHandler creates a new legacy handler
 func NewLegacyHandler(postgresService services.PostgresServiceInterface) *LegacyHandler {
 	return &LegacyHandler{
 		postgresService: postgresService,
+		metadataTimeout: legacyMetadataTimeout,
 	}
 }
 
-// isDatabaseError checks if the error is a database/SQL error vs user-not-found
-func isDatabaseError(err error) bool {
-	if err == nil {
-		return false
-	}
+// legacyQueryError names the listing a concurrent metadata query failed on
+type legacyQueryError struct {
+	message string
+	err     error
+}
 
-	// If it's sql.ErrNoRows, it's a legitimate "not found" case
-	if err == sql.ErrNoRows {
-		return false
-	}
+func (e *legacyQueryError) Error() string { return e.message + ": " + e.err.Error() }
+func (e *legacyQueryError) Unwrap() error { return e.err }
 
-	errMsg := err.Error()
-	// Check for common database/SQL errors
-	databaseErrors := []string{
-		"relation", "does not exist",
-		"syntax error", "column", "unknown",
-		"connection", "timeout", "network",
-		"permission denied", "access denied",
-		"invalid", "constraint",
+// legacyDatabaseError writes a 500 for a failed legacy query, or a 504 for
+// one that timed out. Lookups of missing records aren't failures, so callers
+// check for services.ErrLegacyNotFound first.
+func legacyDatabaseError(c *gin.Context, message, firebaseUID string, err error) {
+	log.Printf("PostgreSQL error (%s) for user %s: %v", message, firebaseUID, err)
+	if errors.Is(err, services.ErrLegacyTimeout) {
+		apierror.Respond(c, services.ErrLegacyTimeout.WithMessage(message))
+		return
 	}
+	apierror.Respond(c, services.ErrLegacyDatabase.WithMessage(message))
+}
 
-	for _, dbErr := range databaseErrors {
-		if strings.Contains(strings.ToLower(errMsg), dbErr) {
-			return true
+// parseLegacyTrackFilter reads the paging and filter query params shared by
+// the legacy track listings: limit, offset, is_draft, deleted and
+// published_since (RFC 3339). It returns a message for the first invalid one.
+func parseLegacyTrackFilter(c *gin.Context) (services.LegacyTrackFilter, string) {
+	filter := services.LegacyTrackFilter{Limit: services.DefaultLegacyPageSize}
+
+	if param := c.Query("limit"); param != "" {
+		limit, err := strconv.Atoi(param)
+		if err != nil || limit <= 0 {
+			return filter, "limit must be a positive integer"
+		}
+		filter.Limit = min(limit, services.MaxLegacyPageSize)
+	}
+	if param := c.Query("offset"); param != "" {
+		offset, err := strconv.Atoi(param)
+		if err != nil || offset < 0 {
+			return filter, "offset must be a non-negative integer"
+		}
+		filter.Offset = offset
+	}
+	if param := c.Query("is_draft"); param != "" {
+		isDraft, err := strconv.ParseBool(param)
+		if err != nil {
+			return filter, "is_draft must be true or false"
+		}
+		filter.IsDraft = &isDraft
+	}
+	if param := c.Query("deleted"); param != "" {
+		deleted, err := strconv.ParseBool(param)
+		if err != nil {
+			return filter, "deleted must be true or false"
+		}
+		filter.Deleted = deleted
+	}
+	if param := c.Query("published_since"); param != "" {
+		publishedSince, err := time.Parse(time.RFC3339, param)
+		if err != nil {
+			return filter, "published_since must be an RFC 3339 timestamp"
 		}
+		filter.PublishedSince = &publishedSince
 	}
 
-	return false
+	return filter, ""
+}
+
+// parseUnscopedTrackFilter is parseLegacyTrackFilter for the artist and album
+// listings, which list anyone's tracks. Deleted and draft tracks are only
+// listed among the caller's own, so those filters are rejected there
+// rather than showing them to other callers.
+func parseUnscopedTrackFilter(c *gin.Context) (services.LegacyTrackFilter, string) {
+	for _, param := range []string{"deleted", "is_draft"} {
+		if c.Query(param) != "" {
+			return services.LegacyTrackFilter{}, param + " only applies to your own tracks, at /v1/legacy/tracks"
+		}
+	}
+	return parseLegacyTrackFilter(c)
 }
 
-// UserMetadataResponse represents the complete user metadata response
+// UserMetadataResponse represents the complete user metadata response. Tracks
+// are a page, described by TracksTotal, TracksLimit and TracksOffset.
 type UserMetadataResponse struct {
-	User    *models.LegacyUser    `json:"user"`
-	Artists []models.LegacyArtist `json:"artists"`
-	Albums  []models.LegacyAlbum  `json:"albums"`
-	Tracks  []models.LegacyTrack  `json:"tracks"`
+	User         *models.LegacyUser    `json:"user"`
+	Artists      []models.LegacyArtist `json:"artists"`
+	Albums       []models.LegacyAlbum  `json:"albums"`
+	Tracks       []models.LegacyTrack  `json:"tracks"`
+	TracksTotal  int                   `json:"tracks_total"`
+	TracksLimit  int                   `json:"tracks_limit"`
+	TracksOffset int                   `json:"tracks_offset"`
+}
+
+// LegacyTracksResponse is a page of legacy tracks, with the total matching
+// the request's filters
+type LegacyTracksResponse struct {
+	Tracks []models.LegacyTrack `json:"tracks"`
+	Total  int                  `json:"total"`
+	Limit  int                  `json:"limit"`
+	Offset int                  `json:"offset"`
 }
 
 // GetUserMetadata handles GET /v1/legacy/metadata
-// Returns all user metadata from the legacy PostgreSQL system
+// Returns the user's metadata from the legacy PostgreSQL system, with a page of
+// their tracks. Supports the track listing params of GetUserTracks.
 func (h *LegacyHandler) GetUserMetadata(c *gin.Context) {
 	firebaseUID := c.GetString("firebase_uid")
 
 	if firebaseUID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Failed to find an associated Firebase UID"})
+		apierror.Respond(c, apierror.Unauthorized("Failed to find an associated Firebase UID"))
 		return
 	}
 
-	ctx := c.Request.Context()
+	filter, invalid := parseLegacyTrackFilter(c)
+	if invalid != "" {
+		apierror.Respond(c, apierror.Validation(invalid))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.metadataTimeout)
+	defer cancel()
 
 	// Get user data
 	user, err := h.postgresService.GetUserByFirebaseUID(ctx, firebaseUID)
 	if err != nil {
-		// Check if this is a database error vs user not found
-		if isDatabaseError(err) {
-			log.Printf("PostgreSQL error getting user %s: %v", firebaseUID, err)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "Database error occurred",
-				"details": err.Error(),
-			})
+		if !errors.Is(err, services.ErrLegacyNotFound) {
+			legacyDatabaseError(c, "Database error occurred", firebaseUID, err)
 			return
 		}
 
 		// User not found - return empty response
 		response := UserMetadataResponse{
-			User:    nil,
-			Artists: []models.LegacyArtist{},
-			Albums:  []models.LegacyAlbum{},
-			Tracks:  []models.LegacyTrack{},
+			User:         nil,
+			Artists:      []models.LegacyArtist{},
+			Albums:       []models.LegacyAlbum{},
+			Tracks:       []models.LegacyTrack{},
+			TracksLimit:  filter.Limit,
+			TracksOffset: filter.Offset,
 		}
 		c.JSON(http.StatusOK, response)
 		return
 	}
 
-	// Get associated data (return error for database issues, empty arrays for no data)
-	artists, err := h.postgresService.GetUserArtists(ctx, firebaseUID)
-	if err != nil {
-		if isDatabaseError(err) {
-			log.Printf("PostgreSQL error getting artists for user %s: %v", firebaseUID, err)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "Database error while fetching artists",
-				"details": err.Error(),
-			})
-			return
+	// Get associated data concurrently (return error for database issues, empty
+	// arrays for no data). The first failure cancels the other queries.
+	var artists []models.LegacyArtist
+	var albums []models.LegacyAlbum
+	var tracks []models.LegacyTrack
+	var tracksTotal int
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.Go(func() error {
+		var err error
+		if artists, err = h.postgresService.GetUserArtists(groupCtx, firebaseUID); err != nil {
+			return &legacyQueryError{"Database error while fetching artists", err}
 		}
-		artists = []models.LegacyArtist{}
-	}
-
-	albums, err := h.postgresService.GetUserAlbums(ctx, firebaseUID)
-	if err != nil {
-		if isDatabaseError(err) {
-			log.Printf("PostgreSQL error getting albums for user %s: %v", firebaseUID, err)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "Database error while fetching albums",
-				"details": err.Error(),
-			})
-			return
+		return nil
+	})
+	group.Go(func() error {
+		var err error
+		if albums, err = h.postgresService.GetUserAlbums(groupCtx, firebaseUID); err != nil {
+			return &legacyQueryError{"Database error while fetching albums", err}
 		}
-		albums = []models.LegacyAlbum{}
-	}
-
-	tracks, err := h.postgresService.GetUserTracks(ctx, firebaseUID)
-	if err != nil {
-		if isDatabaseError(err) {
-			log.Printf("PostgreSQL error getting tracks for user %s: %v", firebaseUID, err)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "Database error while fetching tracks",
-				"details": err.Error(),
-			})
-			return
+		return nil
+	})
+	group.Go(func() error {
+		var err error
+		if tracks, tracksTotal, err = h.postgresService.GetUserTracks(groupCtx, firebaseUID, filter); err != nil {
+			return &legacyQueryError{"Database error while fetching tracks", err}
 		}
-		tracks = []models.LegacyTrack{}
+		return nil
+	})
+	if err := group.Wait(); err != nil {
+		var queryErr *legacyQueryError
+		errors.As(err, &queryErr)
+		legacyDatabaseError(c, queryErr.message, firebaseUID, queryErr.err)
+		return
 	}
 
+	// Lists are always arrays, never null
+	artists = nonNil(artists)
+	albums = nonNil(albums)
+	tracks = nonNil(tracks)
+
 	response := UserMetadataResponse{
-		User:    user,
-		Artists: artists,
-		Albums:  albums,
-		Tracks:  tracks,
+		User:         user,
+		Artists:      artists,
+		Albums:       albums,
+		Tracks:       tracks,
+		TracksTotal:  tracksTotal,
+		TracksLimit:  filter.Limit,
+		TracksOffset: filter.Offset,
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
 // GetUserTracks handles GET /v1/legacy/tracks
-// Returns user's tracks from the legacy system
+// Returns a page of the user's tracks from the legacy system, newest first.
+// Supports ?limit= (default 100, at most 500), ?offset=, ?is_draft=,
+// ?deleted=true and ?published_since=.
 func (h *LegacyHandler) GetUserTracks(c *gin.Context) {
 	firebaseUID := c.GetString("firebase_uid")
 	if firebaseUID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Failed to find an associated Firebase UID"})
+		apierror.Respond(c, apierror.Unauthorized("Failed to find an associated Firebase UID"))
 		return
 	}
 
-	ctx := c.Request.Context()
+	filter, invalid := parseLegacyTrackFilter(c)
+	if invalid != "" {
+		apierror.Respond(c, apierror.Validation(invalid))
+		return
+	}
 
-	tracks, err := h.postgresService.GetUserTracks(ctx, firebaseUID)
+	tracks, total, err := h.postgresService.GetUserTracks(c.Request.Context(), firebaseUID, filter)
 	if err != nil {
-		// Return empty array instead of error
-		tracks = []models.LegacyTrack{}
+		legacyDatabaseError(c, "Database error while fetching tracks", firebaseUID, err)
+		return
 	}
-
-	c.JSON(http.StatusOK, gin.H{"tracks": tracks})
+	respondLegacyTracks(c, filter, tracks, total)
 }
 
 // GetUserArtists handles GET /v1/legacy/artists
@@ -171,7 +257,7 @@ func (h *LegacyHandler) GetUserTracks(c *gin.Context) {
 func (h *LegacyHandler) GetUserArtists(c *gin.Context) {
 	firebaseUID := c.GetString("firebase_uid")
 	if firebaseUID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Failed to find an associated Firebase UID"})
+		apierror.Respond(c, apierror.Unauthorized("Failed to find an associated Firebase UID"))
 		return
 	}
 
@@ -179,9 +265,10 @@ func (h *LegacyHandler) GetUserArtists(c *gin.Context) {
 
 	artists, err := h.postgresService.GetUserArtists(ctx, firebaseUID)
 	if err != nil {
-		// Return empty array instead of error
-		artists = []models.LegacyArtist{}
+		legacyDatabaseError(c, "Database error while fetching artists", firebaseUID, err)
+		return
 	}
+	artists = nonNil(artists)
 
 	c.JSON(http.StatusOK, gin.H{"artists": artists})
 }
@@ -191,7 +278,7 @@ func (h *LegacyHandler) GetUserArtists(c *gin.Context) {
 func (h *LegacyHandler) GetUserAlbums(c *gin.Context) {
 	firebaseUID := c.GetString("firebase_uid")
 	if firebaseUID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Failed to find an associated Firebase UID"})
+		apierror.Respond(c, apierror.Unauthorized("Failed to find an associated Firebase UID"))
 		return
 	}
 
@@ -199,49 +286,144 @@ func (h *LegacyHandler) GetUserAlbums(c *gin.Context) {
 
 	albums, err := h.postgresService.GetUserAlbums(ctx, firebaseUID)
 	if err != nil {
-		// Return empty array instead of error
-		albums = []models.LegacyAlbum{}
+		legacyDatabaseError(c, "Database error while fetching albums", firebaseUID, err)
+		return
 	}
+	albums = nonNil(albums)
 
 	c.JSON(http.StatusOK, gin.H{"albums": albums})
 }
 
 // GetTracksByArtist handles GET /v1/legacy/artists/:artist_id/tracks
-// Returns tracks for a specific artist
+// Returns a page of tracks for a specific artist, with GetUserTracks' params
 func (h *LegacyHandler) GetTracksByArtist(c *gin.Context) {
 	artistID := c.Param("artist_id")
 	if artistID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Artist ID is required"})
+		apierror.Respond(c, apierror.Validation("Artist ID is required"))
 		return
 	}
 
-	ctx := c.Request.Context()
+	filter, invalid := parseUnscopedTrackFilter(c)
+	if invalid != "" {
+		apierror.Respond(c, apierror.Validation(invalid))
+		return
+	}
 
-	tracks, err := h.postgresService.GetTracksByArtist(ctx, artistID)
+	tracks, total, err := h.postgresService.GetTracksByArtist(c.Request.Context(), artistID, filter)
 	if err != nil {
-		// Return empty array instead of error
-		tracks = []models.LegacyTrack{}
+		legacyDatabaseError(c, "Database error while fetching tracks", c.GetString("firebase_uid"), err)
+		return
 	}
-
-	c.JSON(http.StatusOK, gin.H{"tracks": tracks})
+	respondLegacyTracks(c, filter, tracks, total)
 }
 
 // GetTracksByAlbum handles GET /v1/legacy/albums/:album_id/tracks
-// Returns tracks for a specific album
+// Returns a page of tracks for a specific album, with GetUserTracks' params
 func (h *LegacyHandler) GetTracksByAlbum(c *gin.Context) {
 	albumID := c.Param("album_id")
 	if albumID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Album ID is required"})
+		apierror.Respond(c, apierror.Validation("Album ID is required"))
 		return
 	}
 
-	ctx := c.Request.Context()
+	filter, invalid := parseUnscopedTrackFilter(c)
+	if invalid != "" {
+		apierror.Respond(c, apierror.Validation(invalid))
+		return
+	}
 
-	tracks, err := h.postgresService.GetTracksByAlbum(ctx, albumID)
+	tracks, total, err := h.postgresService.GetTracksByAlbum(c.Request.Context(), albumID, filter)
 	if err != nil {
-		// Return empty array instead of error
-		tracks = []models.LegacyTrack{}
+		legacyDatabaseError(c, "Database error while fetching tracks", c.GetString("firebase_uid"), err)
+		return
+	}
+	respondLegacyTracks(c, filter, tracks, total)
+}
+
+// respondLegacyTracks writes a page of tracks
+func respondLegacyTracks(c *gin.Context, filter services.LegacyTrackFilter, tracks []models.LegacyTrack, total int) {
+	tracks = nonNil(tracks)
+
+	c.JSON(http.StatusOK, LegacyTracksResponse{
+		Tracks: tracks,
+		Total:  total,
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+	})
+}
+
+// LegacySearchResponse lists the legacy catalog entities matching a search
+type LegacySearchResponse struct {
+	Results []models.LegacySearchResult `json:"results"`
+}
+
+// SearchCatalog handles GET /v1/legacy/search?q=
+// Finds the user's legacy tracks, albums and artists whose title or name
+// contains q (2 to 100 characters), for picking content to import. Supports
+// ?type=track|album|artist and ?limit= (default 20, at most 50).
+func (h *LegacyHandler) SearchCatalog(c *gin.Context) {
+	firebaseUID := c.GetString("firebase_uid")
+	if firebaseUID == "" {
+		apierror.Respond(c, apierror.Unauthorized("Failed to find an associated Firebase UID"))
+		return
+	}
+
+	query := strings.TrimSpace(c.Query("q"))
+	if utf8.RuneCountInString(query) < services.MinLegacySearchQueryLength {
+		apierror.Respond(c, apierror.Validation("q must be at least 2 characters"))
+		return
+	}
+	if utf8.RuneCountInString(query) > services.MaxLegacySearchQueryLength {
+		apierror.Respond(c, apierror.Validation("q is too long"))
+		return
+	}
+
+	searchType := c.Query("type")
+	if searchType != "" && !services.IsValidLegacySearchType(searchType) {
+		apierror.Respond(c, apierror.Validation("type must be track, album or artist"))
+		return
+	}
+
+	limit := services.DefaultLegacySearchLimit
+	if param := c.Query("limit"); param != "" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed <= 0 {
+			apierror.Respond(c, apierror.Validation("limit must be a positive integer"))
+			return
+		}
+		limit = min(parsed, services.MaxLegacySearchLimit)
+	}
+
+	results, err := h.postgresService.SearchUserCatalog(c.Request.Context(), firebaseUID, query, searchType, limit)
+	if err != nil {
+		legacyDatabaseError(c, "Database error while searching catalog", firebaseUID, err)
+		return
+	}
+	results = nonNil(results)
+
+	c.JSON(http.StatusOK, LegacySearchResponse{Results: results})
+}
+
+// GetUserEarnings handles GET /v1/legacy/earnings
+// Returns the user's legacy earnings totalled per artist and album, with a
+// grand total and their current balance. A user without a legacy account
+// gets zero totals.
+func (h *LegacyHandler) GetUserEarnings(c *gin.Context) {
+	firebaseUID := c.GetString("firebase_uid")
+	if firebaseUID == "" {
+		apierror.Respond(c, apierror.Unauthorized("Failed to find an associated Firebase UID"))
+		return
+	}
+
+	earnings, err := h.postgresService.GetUserEarnings(c.Request.Context(), firebaseUID)
+	if err != nil {
+		if !errors.Is(err, services.ErrLegacyNotFound) {
+			legacyDatabaseError(c, "Database error while totalling earnings", firebaseUID, err)
+			return
+		}
+		earnings = &models.LegacyEarnings{}
 	}
+	earnings.Artists = nonNil(earnings.Artists)
 
-	c.JSON(http.StatusOK, gin.H{"tracks": tracks})
+	c.JSON(http.StatusOK, earnings)
 }
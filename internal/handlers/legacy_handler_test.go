@@ -0,0 +1,374 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/wavlake/api/internal/mocks"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+type LegacyHandlerTestSuite struct {
+	suite.Suite
+	router          *gin.Engine
+	postgresService *mocks.MockPostgresService
+	handlers        *LegacyHandler
+}
+
+func (suite *LegacyHandlerTestSuite) SetupTest() {
+	gin.SetMode(gin.TestMode)
+
+	suite.postgresService = &mocks.MockPostgresService{}
+	suite.handlers = NewLegacyHandler(suite.postgresService)
+
+	suite.router = gin.New()
+	legacy := suite.router.Group("/v1/legacy")
+	legacy.Use(func(c *gin.Context) {
+		c.Set("firebase_uid", "test-firebase-uid")
+		c.Next()
+	})
+	legacy.GET("/metadata", suite.handlers.GetUserMetadata)
+	legacy.GET("/tracks", suite.handlers.GetUserTracks)
+	legacy.GET("/artists", suite.handlers.GetUserArtists)
+	legacy.GET("/albums", suite.handlers.GetUserAlbums)
+	legacy.GET("/artists/:artist_id/tracks", suite.handlers.GetTracksByArtist)
+	legacy.GET("/albums/:album_id/tracks", suite.handlers.GetTracksByAlbum)
+	legacy.GET("/search", suite.handlers.SearchCatalog)
+	legacy.GET("/earnings", suite.handlers.GetUserEarnings)
+}
+
+func (suite *LegacyHandlerTestSuite) TearDownTest() {
+	suite.postgresService.AssertExpectations(suite.T())
+}
+
+func (suite *LegacyHandlerTestSuite) get(path string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	req, _ := http.NewRequest("GET", path, nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w, response
+}
+
+func (suite *LegacyHandlerTestSuite) TestGetUserMetadata_EmptyListsAreArrays() {
+	suite.postgresService.On("GetUserByFirebaseUID", mock.Anything, "test-firebase-uid").Return(&models.LegacyUser{ID: "test-firebase-uid"}, nil)
+	suite.postgresService.On("GetUserArtists", mock.Anything, "test-firebase-uid").Return(nil, nil)
+	suite.postgresService.On("GetUserAlbums", mock.Anything, "test-firebase-uid").Return(nil, nil)
+	suite.postgresService.On("GetUserTracks", mock.Anything, "test-firebase-uid", services.LegacyTrackFilter{Limit: services.DefaultLegacyPageSize}).Return(nil, 0, nil)
+
+	w, response := suite.get("/v1/legacy/metadata")
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), []interface{}{}, response["artists"])
+	assert.Equal(suite.T(), []interface{}{}, response["albums"])
+	assert.Equal(suite.T(), []interface{}{}, response["tracks"])
+}
+
+func (suite *LegacyHandlerTestSuite) TestGetUserMetadata_UnknownUser() {
+	suite.postgresService.On("GetUserByFirebaseUID", mock.Anything, "test-firebase-uid").Return(nil, fmt.Errorf("failed to get user: %w", services.ErrLegacyNotFound))
+
+	w, response := suite.get("/v1/legacy/metadata")
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Nil(suite.T(), response["user"])
+	assert.Equal(suite.T(), []interface{}{}, response["artists"])
+	assert.Equal(suite.T(), []interface{}{}, response["albums"])
+	assert.Equal(suite.T(), []interface{}{}, response["tracks"])
+}
+
+func (suite *LegacyHandlerTestSuite) TestListEndpoints_EmptyListsAreArrays() {
+	firstPage := services.LegacyTrackFilter{Limit: services.DefaultLegacyPageSize}
+	suite.postgresService.On("GetUserTracks", mock.Anything, "test-firebase-uid", firstPage).Return(nil, 0, nil)
+	suite.postgresService.On("GetUserArtists", mock.Anything, "test-firebase-uid").Return(nil, nil)
+	suite.postgresService.On("GetUserAlbums", mock.Anything, "test-firebase-uid").Return(nil, nil)
+	suite.postgresService.On("GetTracksByArtist", mock.Anything, "artist-1", firstPage).Return(nil, 0, nil)
+	suite.postgresService.On("GetTracksByAlbum", mock.Anything, "album-1", firstPage).Return(nil, 0, nil)
+
+	for path, field := range map[string]string{
+		"/v1/legacy/tracks":                  "tracks",
+		"/v1/legacy/artists":                 "artists",
+		"/v1/legacy/albums":                  "albums",
+		"/v1/legacy/artists/artist-1/tracks": "tracks",
+		"/v1/legacy/albums/album-1/tracks":   "tracks",
+	} {
+		w, response := suite.get(path)
+
+		assert.Equal(suite.T(), http.StatusOK, w.Code, path)
+		assert.Equal(suite.T(), []interface{}{}, response[field], path)
+		if field == "tracks" {
+			assert.Equal(suite.T(), float64(0), response["total"], path)
+		}
+	}
+}
+
+func (suite *LegacyHandlerTestSuite) TestListEndpoints_DatabaseErrors() {
+	dbErr := fmt.Errorf("%w: failed to query tracks: %w", services.ErrLegacyDatabase, sql.ErrConnDone)
+	firstPage := services.LegacyTrackFilter{Limit: services.DefaultLegacyPageSize}
+	suite.postgresService.On("GetUserTracks", mock.Anything, "test-firebase-uid", firstPage).Return(nil, 0, dbErr)
+	suite.postgresService.On("GetUserArtists", mock.Anything, "test-firebase-uid").Return(nil, dbErr)
+	suite.postgresService.On("GetUserAlbums", mock.Anything, "test-firebase-uid").Return(nil, dbErr)
+	suite.postgresService.On("GetTracksByArtist", mock.Anything, "artist-1", firstPage).Return(nil, 0, dbErr)
+	suite.postgresService.On("GetTracksByAlbum", mock.Anything, "album-1", firstPage).Return(nil, 0, dbErr)
+
+	for path, message := range map[string]string{
+		"/v1/legacy/tracks":                  "Database error while fetching tracks",
+		"/v1/legacy/artists":                 "Database error while fetching artists",
+		"/v1/legacy/albums":                  "Database error while fetching albums",
+		"/v1/legacy/artists/artist-1/tracks": "Database error while fetching tracks",
+		"/v1/legacy/albums/album-1/tracks":   "Database error while fetching tracks",
+	} {
+		w, response := suite.get(path)
+
+		assert.Equal(suite.T(), http.StatusInternalServerError, w.Code, path)
+		assert.Equal(suite.T(), message, errorMessage(response), path)
+		assert.Equal(suite.T(), "legacy.database_error", errorCode(response), path)
+		assert.NotContains(suite.T(), w.Body.String(), "connection is already closed", path)
+	}
+}
+
+func (suite *LegacyHandlerTestSuite) TestListEndpoints_QueryTimeout() {
+	timeoutErr := fmt.Errorf("%w: %w: failed to query artists: %w", services.ErrLegacyTimeout, services.ErrLegacyDatabase, context.DeadlineExceeded)
+	suite.postgresService.On("GetUserArtists", mock.Anything, "test-firebase-uid").Return(nil, timeoutErr)
+
+	w, response := suite.get("/v1/legacy/artists")
+
+	assert.Equal(suite.T(), http.StatusGatewayTimeout, w.Code)
+	assert.Equal(suite.T(), "Database error while fetching artists", errorMessage(response))
+	assert.Equal(suite.T(), "legacy.timeout", errorCode(response))
+}
+
+func (suite *LegacyHandlerTestSuite) TestGetUserMetadata_DatabaseErrors() {
+	dbErr := fmt.Errorf("%w: failed to get user: %w", services.ErrLegacyDatabase, sql.ErrConnDone)
+	suite.postgresService.On("GetUserByFirebaseUID", mock.Anything, "other-uid").Return(nil, dbErr)
+	suite.postgresService.On("GetUserByFirebaseUID", mock.Anything, "test-firebase-uid").Return(&models.LegacyUser{ID: "test-firebase-uid"}, nil)
+	suite.postgresService.On("GetUserArtists", mock.Anything, "test-firebase-uid").Return(nil, nil)
+	suite.postgresService.On("GetUserAlbums", mock.Anything, "test-firebase-uid").Return(nil, dbErr)
+	suite.postgresService.On("GetUserTracks", mock.Anything, "test-firebase-uid", mock.Anything).Return(nil, 0, nil).Maybe()
+
+	w, response := suite.get("/v1/legacy/metadata")
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+	assert.Equal(suite.T(), "Database error while fetching albums", errorMessage(response))
+
+	router := gin.New()
+	router.GET("/v1/legacy/metadata", func(c *gin.Context) {
+		c.Set("firebase_uid", "other-uid")
+		c.Next()
+	}, suite.handlers.GetUserMetadata)
+	req, _ := http.NewRequest("GET", "/v1/legacy/metadata", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "Database error occurred")
+}
+
+func (suite *LegacyHandlerTestSuite) TestGetUserMetadata_QueriesConcurrently() {
+	const delay = 100 * time.Millisecond
+	suite.postgresService.On("GetUserByFirebaseUID", mock.Anything, "test-firebase-uid").Return(&models.LegacyUser{ID: "test-firebase-uid"}, nil)
+	suite.postgresService.On("GetUserArtists", mock.Anything, "test-firebase-uid").After(delay).Return([]models.LegacyArtist{{ID: "artist-1"}}, nil)
+	suite.postgresService.On("GetUserAlbums", mock.Anything, "test-firebase-uid").After(delay).Return([]models.LegacyAlbum{{ID: "album-1"}}, nil)
+	suite.postgresService.On("GetUserTracks", mock.Anything, "test-firebase-uid", mock.Anything).After(delay).Return([]models.LegacyTrack{{ID: "track-1"}}, 1, nil)
+
+	start := time.Now()
+	w, response := suite.get("/v1/legacy/metadata")
+	elapsed := time.Since(start)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Len(suite.T(), response["artists"], 1)
+	assert.Len(suite.T(), response["albums"], 1)
+	assert.Len(suite.T(), response["tracks"], 1)
+	// Sequential queries would take at least 3x delay
+	assert.Less(suite.T(), elapsed, 2*delay)
+}
+
+func (suite *LegacyHandlerTestSuite) TestGetUserMetadata_Timeout() {
+	suite.handlers.metadataTimeout = 20 * time.Millisecond
+	waitForDeadline := func(args mock.Arguments) {
+		<-args.Get(0).(context.Context).Done()
+	}
+	timeoutErr := fmt.Errorf("%w: failed to query artists: %w", services.ErrLegacyDatabase, context.DeadlineExceeded)
+	suite.postgresService.On("GetUserByFirebaseUID", mock.Anything, "test-firebase-uid").Return(&models.LegacyUser{ID: "test-firebase-uid"}, nil)
+	suite.postgresService.On("GetUserArtists", mock.Anything, "test-firebase-uid").Run(waitForDeadline).Return(nil, timeoutErr)
+	suite.postgresService.On("GetUserAlbums", mock.Anything, "test-firebase-uid").Run(waitForDeadline).Return(nil, timeoutErr)
+	suite.postgresService.On("GetUserTracks", mock.Anything, "test-firebase-uid", mock.Anything).Run(waitForDeadline).Return(nil, 0, timeoutErr)
+
+	w, response := suite.get("/v1/legacy/metadata")
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+	assert.Equal(suite.T(), "legacy.database_error", errorCode(response))
+}
+
+func (suite *LegacyHandlerTestSuite) TestTrackListings_PaginationAndFilters() {
+	isDraft := false
+	publishedSince := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	filter := services.LegacyTrackFilter{Limit: 20, Offset: 40, IsDraft: &isDraft, Deleted: true, PublishedSince: &publishedSince}
+	tracks := []models.LegacyTrack{{ID: "track-41"}, {ID: "track-42"}}
+	unscoped := services.LegacyTrackFilter{Limit: 20, Offset: 40, PublishedSince: &publishedSince}
+	suite.postgresService.On("GetUserTracks", mock.Anything, "test-firebase-uid", filter).Return(tracks, 42, nil)
+	suite.postgresService.On("GetTracksByArtist", mock.Anything, "artist-1", unscoped).Return(tracks, 42, nil)
+	suite.postgresService.On("GetTracksByAlbum", mock.Anything, "album-1", unscoped).Return(tracks, 42, nil)
+
+	for path, query := range map[string]string{
+		"/v1/legacy/tracks":                  "?limit=20&offset=40&is_draft=false&deleted=true&published_since=2024-01-01T00:00:00Z",
+		"/v1/legacy/artists/artist-1/tracks": "?limit=20&offset=40&published_since=2024-01-01T00:00:00Z",
+		"/v1/legacy/albums/album-1/tracks":   "?limit=20&offset=40&published_since=2024-01-01T00:00:00Z",
+	} {
+		w, response := suite.get(path + query)
+
+		assert.Equal(suite.T(), http.StatusOK, w.Code, path)
+		assert.Len(suite.T(), response["tracks"], 2, path)
+		assert.Equal(suite.T(), float64(42), response["total"], path)
+		assert.Equal(suite.T(), float64(20), response["limit"], path)
+		assert.Equal(suite.T(), float64(40), response["offset"], path)
+	}
+}
+
+// Anyone's artist or album can be listed, so their deleted and draft tracks
+// can't be asked for
+func (suite *LegacyHandlerTestSuite) TestUnscopedTrackListings_RejectDeletedAndDraftFilters() {
+	for _, query := range []string{"deleted=true", "deleted=false", "is_draft=true", "is_draft=false"} {
+		for _, path := range []string{"/v1/legacy/artists/artist-1/tracks", "/v1/legacy/albums/album-1/tracks"} {
+			w, response := suite.get(path + "?" + query)
+
+			assert.Equal(suite.T(), http.StatusBadRequest, w.Code, path+"?"+query)
+			assert.Contains(suite.T(), errorMessage(response), "/v1/legacy/tracks", path+"?"+query)
+		}
+	}
+	suite.postgresService.AssertNotCalled(suite.T(), "GetTracksByArtist", mock.Anything, mock.Anything, mock.Anything)
+	suite.postgresService.AssertNotCalled(suite.T(), "GetTracksByAlbum", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *LegacyHandlerTestSuite) TestTrackListings_CapsLimit() {
+	suite.postgresService.On("GetUserTracks", mock.Anything, "test-firebase-uid", services.LegacyTrackFilter{Limit: services.MaxLegacyPageSize}).Return(nil, 0, nil)
+
+	w, response := suite.get("/v1/legacy/tracks?limit=100000")
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), float64(services.MaxLegacyPageSize), response["limit"])
+}
+
+func (suite *LegacyHandlerTestSuite) TestTrackListings_InvalidParams() {
+	for _, query := range []string{"limit=0", "limit=ten", "offset=-1", "is_draft=maybe", "deleted=1x", "published_since=yesterday"} {
+		for _, path := range []string{"/v1/legacy/tracks", "/v1/legacy/metadata", "/v1/legacy/albums/album-1/tracks"} {
+			w, response := suite.get(path + "?" + query)
+
+			assert.Equal(suite.T(), http.StatusBadRequest, w.Code, path+"?"+query)
+			assert.NotEmpty(suite.T(), errorMessage(response), path+"?"+query)
+		}
+	}
+}
+
+func (suite *LegacyHandlerTestSuite) TestGetUserMetadata_PagesTracks() {
+	filter := services.LegacyTrackFilter{Limit: 1, Offset: 1}
+	suite.postgresService.On("GetUserByFirebaseUID", mock.Anything, "test-firebase-uid").Return(&models.LegacyUser{ID: "test-firebase-uid"}, nil)
+	suite.postgresService.On("GetUserArtists", mock.Anything, "test-firebase-uid").Return(nil, nil)
+	suite.postgresService.On("GetUserAlbums", mock.Anything, "test-firebase-uid").Return(nil, nil)
+	suite.postgresService.On("GetUserTracks", mock.Anything, "test-firebase-uid", filter).Return([]models.LegacyTrack{{ID: "track-2"}}, 3, nil)
+
+	w, response := suite.get("/v1/legacy/metadata?limit=1&offset=1")
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Len(suite.T(), response["tracks"], 1)
+	assert.Equal(suite.T(), float64(3), response["tracks_total"])
+	assert.Equal(suite.T(), float64(1), response["tracks_limit"])
+	assert.Equal(suite.T(), float64(1), response["tracks_offset"])
+}
+
+func (suite *LegacyHandlerTestSuite) TestSearchCatalog() {
+	results := []models.LegacySearchResult{{Type: "track", ID: "track-1", Title: "Nightfall", ArtistName: "Artist", AlbumName: "Midnight"}}
+	suite.postgresService.On("SearchUserCatalog", mock.Anything, "test-firebase-uid", "night", "track", 5).Return(results, nil)
+
+	w, response := suite.get("/v1/legacy/search?q=+night+&type=track&limit=5")
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), []interface{}{map[string]interface{}{
+		"type": "track", "id": "track-1", "title": "Nightfall", "artist_name": "Artist", "album_name": "Midnight",
+	}}, response["results"])
+}
+
+func (suite *LegacyHandlerTestSuite) TestSearchCatalog_Defaults() {
+	suite.postgresService.On("SearchUserCatalog", mock.Anything, "test-firebase-uid", "ni", "", services.DefaultLegacySearchLimit).Return(nil, nil)
+
+	w, response := suite.get("/v1/legacy/search?q=ni")
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), []interface{}{}, response["results"])
+}
+
+func (suite *LegacyHandlerTestSuite) TestSearchCatalog_InvalidParams() {
+	for _, query := range []string{"", "q=n", "q=+n+", "q=" + strings.Repeat("n", 101), "q=night&type=playlist", "q=night&limit=0"} {
+		w, response := suite.get("/v1/legacy/search?" + query)
+
+		assert.Equal(suite.T(), http.StatusBadRequest, w.Code, query)
+		assert.NotEmpty(suite.T(), errorMessage(response), query)
+	}
+}
+
+func (suite *LegacyHandlerTestSuite) TestSearchCatalog_DatabaseError() {
+	dbErr := fmt.Errorf("%w: failed to search catalog: %w", services.ErrLegacyDatabase, sql.ErrConnDone)
+	suite.postgresService.On("SearchUserCatalog", mock.Anything, "test-firebase-uid", "night", "", services.DefaultLegacySearchLimit).Return(nil, dbErr)
+
+	w, response := suite.get("/v1/legacy/search?q=night")
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+	assert.Equal(suite.T(), "Database error while searching catalog", errorMessage(response))
+}
+
+func (suite *LegacyHandlerTestSuite) TestGetUserEarnings() {
+	suite.postgresService.On("GetUserEarnings", mock.Anything, "test-firebase-uid").Return(&models.LegacyEarnings{
+		MSatBalance: 5000,
+		MSatTotal:   3000,
+		Artists: []models.LegacyArtistEarnings{{
+			ArtistID:  "artist-1",
+			Name:      "Artist",
+			MSatTotal: 3000,
+			Albums:    []models.LegacyAlbumEarnings{{AlbumID: "album-1", Title: "Midnight", MSatTotal: 3000}},
+		}},
+	}, nil)
+
+	w, response := suite.get("/v1/legacy/earnings")
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), float64(5000), response["msat_balance"])
+	assert.Equal(suite.T(), float64(3000), response["msat_total"])
+	artist := response["artists"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(suite.T(), "artist-1", artist["artist_id"])
+	assert.Len(suite.T(), artist["albums"], 1)
+}
+
+func (suite *LegacyHandlerTestSuite) TestGetUserEarnings_UnknownUser() {
+	suite.postgresService.On("GetUserEarnings", mock.Anything, "test-firebase-uid").Return(nil, fmt.Errorf("failed to get balance: %w", services.ErrLegacyNotFound))
+
+	w, response := suite.get("/v1/legacy/earnings")
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), float64(0), response["msat_total"])
+	assert.Equal(suite.T(), float64(0), response["msat_balance"])
+	assert.Equal(suite.T(), []interface{}{}, response["artists"])
+}
+
+func (suite *LegacyHandlerTestSuite) TestGetUserEarnings_DatabaseError() {
+	dbErr := fmt.Errorf("%w: failed to total earnings: %w", services.ErrLegacyDatabase, sql.ErrConnDone)
+	suite.postgresService.On("GetUserEarnings", mock.Anything, "test-firebase-uid").Return(nil, dbErr)
+
+	w, response := suite.get("/v1/legacy/earnings")
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+	assert.Equal(suite.T(), "Database error while totalling earnings", errorMessage(response))
+}
+
+func TestLegacyHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(LegacyHandlerTestSuite))
+}
@@ -0,0 +1,10 @@
+package handlers
+
+// nonNil returns list, or an empty list if it's nil, so a response with
+// nothing in it serializes as [] rather than null
+func nonNil[T any](list []T) []T {
+	if list == nil {
+		return []T{}
+	}
+	return list
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+type NotificationsHandler struct {
+	notificationService services.NotificationServiceInterface
+}
+
+// NewNotificationsHandler creates a new notifications handler
+func NewNotificationsHandler(notificationService services.NotificationServiceInterface) *NotificationsHandler {
+	return &NotificationsHandler{
+		notificationService: notificationService,
+	}
+}
+
+// GetNotificationsResponse represents a page of the user's notification feed
+type GetNotificationsResponse struct {
+	Success    bool                  `json:"success"`
+	Data       []models.Notification `json:"data"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+}
+
+// GetNotifications handles GET /v1/notifications
+// Supports ?limit=, ?cursor= (from next_cursor) and ?unread=true
+func (h *NotificationsHandler) GetNotifications(c *gin.Context) {
+	firebaseUID := c.GetString("firebase_uid")
+	if firebaseUID == "" {
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	limit := services.DefaultNotificationPageSize
+	if limitParam := c.Query("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed <= 0 {
+			apierror.Respond(c, apierror.Validation("limit must be a positive integer"))
+			return
+		}
+		limit = parsed
+	}
+
+	unreadOnly := c.Query("unread") == "true"
+
+	notifications, nextCursor, err := h.notificationService.ListNotifications(c.Request.Context(), firebaseUID, unreadOnly, limit, c.Query("cursor"))
+	if err != nil {
+		log.Printf("Failed to list notifications for user %s: %v", firebaseUID, err)
+		apierror.Respond(c, apierror.Internal("failed to retrieve notifications"))
+		return
+	}
+
+	notifications = nonNil(notifications)
+
+	c.JSON(http.StatusOK, GetNotificationsResponse{
+		Success:    true,
+		Data:       notifications,
+		NextCursor: nextCursor,
+	})
+}
+
+// MarkNotificationRead handles POST /v1/notifications/:id/read
+func (h *NotificationsHandler) MarkNotificationRead(c *gin.Context) {
+	firebaseUID := c.GetString("firebase_uid")
+	if firebaseUID == "" {
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	notificationID := c.Param("id")
+	if notificationID == "" {
+		apierror.Respond(c, apierror.Validation("notification ID is required"))
+		return
+	}
+
+	if err := h.notificationService.MarkNotificationRead(c.Request.Context(), firebaseUID, notificationID); err != nil {
+		if errors.Is(err, services.ErrNotificationNotFound) {
+			apierror.Respond(c, apierror.NotFound("notification not found"))
+			return
+		}
+		log.Printf("Failed to mark notification %s read: %v", notificationID, err)
+		apierror.Respond(c, apierror.Internal("failed to update notification"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
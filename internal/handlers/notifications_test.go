@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/wavlake/api/internal/mocks"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+type NotificationsHandlerTestSuite struct {
+	suite.Suite
+	router              *gin.Engine
+	notificationService *mocks.MockNotificationService
+	handlers            *NotificationsHandler
+}
+
+func (suite *NotificationsHandlerTestSuite) SetupTest() {
+	gin.SetMode(gin.TestMode)
+
+	suite.notificationService = &mocks.MockNotificationService{}
+	suite.handlers = NewNotificationsHandler(suite.notificationService)
+
+	suite.router = gin.New()
+	group := suite.router.Group("/v1/notifications", func(c *gin.Context) {
+		c.Set("firebase_uid", "test-firebase-uid")
+		c.Next()
+	})
+	group.GET("", suite.handlers.GetNotifications)
+	group.POST("/:id/read", suite.handlers.MarkNotificationRead)
+}
+
+func (suite *NotificationsHandlerTestSuite) TearDownTest() {
+	suite.notificationService.AssertExpectations(suite.T())
+}
+
+func (suite *NotificationsHandlerTestSuite) TestGetNotifications_Success() {
+	notifications := []models.Notification{
+		{ID: "n1", TrackID: "track-1", Type: models.NotificationTypeProcessingFailed, Message: "failed", CreatedAt: time.Now()},
+	}
+	suite.notificationService.On("ListNotifications", mock.Anything, "test-firebase-uid", true, 5, "cursor-1").Return(notifications, "n1", nil)
+
+	req, _ := http.NewRequest("GET", "/v1/notifications?unread=true&limit=5&cursor=cursor-1", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var response GetNotificationsResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), response.Success)
+	assert.Len(suite.T(), response.Data, 1)
+	assert.Equal(suite.T(), "n1", response.NextCursor)
+	assert.NotContains(suite.T(), w.Body.String(), "test-firebase-uid")
+}
+
+func (suite *NotificationsHandlerTestSuite) TestGetNotifications_EmptyFeedIsArray() {
+	suite.notificationService.On("ListNotifications", mock.Anything, "test-firebase-uid", false, services.DefaultNotificationPageSize, "").Return([]models.Notification(nil), "", nil)
+
+	req, _ := http.NewRequest("GET", "/v1/notifications", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), `"data":[]`)
+}
+
+func (suite *NotificationsHandlerTestSuite) TestGetNotifications_InvalidLimit() {
+	req, _ := http.NewRequest("GET", "/v1/notifications?limit=abc", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *NotificationsHandlerTestSuite) TestGetNotifications_ServiceError() {
+	suite.notificationService.On("ListNotifications", mock.Anything, "test-firebase-uid", false, services.DefaultNotificationPageSize, "").Return([]models.Notification(nil), "", errors.New("firestore down"))
+
+	req, _ := http.NewRequest("GET", "/v1/notifications", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
+
+func (suite *NotificationsHandlerTestSuite) TestMarkNotificationRead_Success() {
+	suite.notificationService.On("MarkNotificationRead", mock.Anything, "test-firebase-uid", "n1").Return(nil)
+
+	req, _ := http.NewRequest("POST", "/v1/notifications/n1/read", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *NotificationsHandlerTestSuite) TestMarkNotificationRead_NotFound() {
+	suite.notificationService.On("MarkNotificationRead", mock.Anything, "test-firebase-uid", "missing").Return(services.ErrNotificationNotFound)
+
+	req, _ := http.NewRequest("POST", "/v1/notifications/missing/read", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *NotificationsHandlerTestSuite) TestMissingAuth() {
+	router := gin.New()
+	router.GET("/v1/notifications", suite.handlers.GetNotifications)
+
+	req, _ := http.NewRequest("GET", "/v1/notifications", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func TestNotificationsHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(NotificationsHandlerTestSuite))
+}
@@ -0,0 +1,462 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Auth is what a documented route requires of the caller
+type Auth int
+
+const (
+	AuthNone     Auth = iota
+	AuthFirebase      // A Firebase ID token
+	AuthNIP98         // A NIP-98 event
+	AuthDual          // Both, the event in X-Nostr-Authorization
+	AuthEither        // Either one
+)
+
+// Security scheme names in the spec
+const (
+	SecuritySchemeFirebase = "firebase"
+	SecuritySchemeNIP98    = "nip98"
+)
+
+// Param is a documented query parameter
+type Param struct {
+	Name        string
+	Type        string // "string" when unset, or "integer" or "boolean"
+	Description string
+	Required    bool
+}
+
+// Operation documents a route. Request, Response and Data are values of the
+// JSON bodies' types; their schemas are built from the json tags, and fields
+// with a binding:"required" tag are required. Data is for responses in the
+// {"success": true, "data": ...} envelope without a type of their own.
+type Operation struct {
+	Summary      string
+	Description  string
+	Tag          string
+	Auth         Auth
+	Query        []Param
+	Request      interface{}
+	BodyOptional bool // The request body may be left out
+	Response     interface{}
+	Data         interface{}
+	Status       int    // Of the success response; 200 when unset
+	ContentType  string // Of the success response when it isn't JSON
+}
+
+// OpenAPIRegistry holds the operations of the API's routes, by Gin method
+// and path
+type OpenAPIRegistry struct {
+	operations map[string]Operation
+}
+
+// NewOpenAPIRegistry creates an empty registry
+func NewOpenAPIRegistry() *OpenAPIRegistry {
+	return &OpenAPIRegistry{operations: map[string]Operation{}}
+}
+
+func routeKey(method, path string) string {
+	return method + " " + path
+}
+
+// Register documents the route at method and path, written as Gin writes it
+// (/v1/tracks/:id). Registering a route twice panics.
+func (r *OpenAPIRegistry) Register(method, path string, op Operation) {
+	key := routeKey(method, path)
+	if _, ok := r.operations[key]; ok {
+		panic("openapi: " + key + " registered twice")
+	}
+	r.operations[key] = op
+}
+
+// Has reports whether the route is registered
+func (r *OpenAPIRegistry) Has(method, path string) bool {
+	_, ok := r.operations[routeKey(method, path)]
+	return ok
+}
+
+// Routes returns the registered routes as "METHOD path", sorted
+func (r *OpenAPIRegistry) Routes() []string {
+	routes := make([]string, 0, len(r.operations))
+	for key := range r.operations {
+		routes = append(routes, key)
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+// Spec builds an OpenAPI 3 document of the registered operations for the
+// routes given, skipping registered routes that aren't among them
+func (r *OpenAPIRegistry) Spec(routes gin.RoutesInfo) map[string]interface{} {
+	builder := newSchemaBuilder()
+	paths := map[string]map[string]interface{}{}
+
+	for _, route := range routes {
+		op, ok := r.operations[routeKey(route.Method, route.Path)]
+		if !ok {
+			continue
+		}
+		path, params := openAPIPath(route.Path)
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+		paths[path][strings.ToLower(route.Method)] = builder.operation(route.Method, path, params, op)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Wavlake API",
+			"version": "1",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": builder.schemas,
+			"securitySchemes": map[string]interface{}{
+				SecuritySchemeFirebase: map[string]interface{}{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+					"description":  "A Firebase ID token, in Authorization or X-Firebase-Token",
+				},
+				SecuritySchemeNIP98: map[string]interface{}{
+					"type": "apiKey",
+					"in":   "header",
+					"name": "Authorization",
+					"description": "Nostr <base64 kind 27235 event> (NIP-98), signed for the request's URL, method " +
+						"and body. Routes that also take a Firebase token read it from X-Nostr-Authorization.",
+				},
+			},
+		},
+	}
+}
+
+// openAPIPath converts a Gin path to OpenAPI's template syntax and returns
+// its parameter names
+func openAPIPath(path string) (string, []string) {
+	var params []string
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			params = append(params, segment[1:])
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// operationID is the route's method and path in camel case, e.g.
+// postV1TracksIdCompress
+func operationID(method, path string) string {
+	var id strings.Builder
+	id.WriteString(strings.ToLower(method))
+	for _, word := range strings.FieldsFunc(path, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9')
+	}) {
+		id.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return id.String()
+}
+
+func security(auth Auth) []map[string][]string {
+	switch auth {
+	case AuthFirebase:
+		return []map[string][]string{{SecuritySchemeFirebase: {}}}
+	case AuthNIP98:
+		return []map[string][]string{{SecuritySchemeNIP98: {}}}
+	case AuthDual:
+		return []map[string][]string{{SecuritySchemeFirebase: {}, SecuritySchemeNIP98: {}}}
+	case AuthEither:
+		return []map[string][]string{{SecuritySchemeFirebase: {}}, {SecuritySchemeNIP98: {}}}
+	default:
+		return []map[string][]string{}
+	}
+}
+
+// errorSchemaName is the component every error response refers to
+const errorSchemaName = "Error"
+
+func (b *schemaBuilder) operation(method, path string, pathParams []string, op Operation) map[string]interface{} {
+	parameters := []map[string]interface{}{}
+	for _, name := range pathParams {
+		parameters = append(parameters, map[string]interface{}{
+			"name": name, "in": "path", "required": true, "schema": &schema{Type: "string"},
+		})
+	}
+	for _, param := range op.Query {
+		paramType := param.Type
+		if paramType == "" {
+			paramType = "string"
+		}
+		parameters = append(parameters, map[string]interface{}{
+			"name": param.Name, "in": "query", "required": param.Required,
+			"description": param.Description, "schema": &schema{Type: paramType},
+		})
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	var body *schema
+	switch {
+	case op.Response != nil:
+		body = b.schema(reflect.TypeOf(op.Response))
+	case op.Data != nil:
+		body = &schema{Type: "object", Properties: map[string]*schema{
+			"success": {Type: "boolean"},
+			"data":    b.schema(reflect.TypeOf(op.Data)),
+		}}
+	}
+	if body != nil {
+		contentType := op.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		success["content"] = map[string]interface{}{
+			contentType: map[string]interface{}{"schema": body},
+		}
+	}
+
+	operation := map[string]interface{}{
+		"operationId": operationID(method, path),
+		"summary":     op.Summary,
+		"parameters":  parameters,
+		"security":    security(op.Auth),
+		"responses": map[string]interface{}{
+			strconv.Itoa(status): success,
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": b.errorSchema()},
+				},
+			},
+		},
+	}
+	if op.Description != "" {
+		operation["description"] = op.Description
+	}
+	if op.Tag != "" {
+		operation["tags"] = []string{op.Tag}
+	}
+	if op.Request != nil {
+		operation["requestBody"] = map[string]interface{}{
+			"required": !op.BodyOptional,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": b.schema(reflect.TypeOf(op.Request))},
+			},
+		}
+	}
+	return operation
+}
+
+// schema is the subset of the OpenAPI schema object the builder writes
+type schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	AdditionalProperties *schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+}
+
+// schemaBuilder writes schemas for Go types, each named struct once under
+// components/schemas
+type schemaBuilder struct {
+	schemas map[string]*schema
+	names   map[reflect.Type]string
+}
+
+func newSchemaBuilder() *schemaBuilder {
+	return &schemaBuilder{schemas: map[string]*schema{}, names: map[reflect.Type]string{}}
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	rawJSONType = reflect.TypeOf(json.RawMessage{})
+)
+
+func (b *schemaBuilder) schema(t reflect.Type) *schema {
+	switch {
+	case t == timeType:
+		return &schema{Type: "string", Format: "date-time"}
+	case t == rawJSONType:
+		return &schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return b.schema(t.Elem())
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &schema{Type: "number"}
+	case reflect.String:
+		return &schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &schema{Type: "string", Format: "byte"}
+		}
+		return &schema{Type: "array", Items: b.schema(t.Elem())}
+	case reflect.Map:
+		return &schema{Type: "object", AdditionalProperties: b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		return b.ref(t)
+	default:
+		// interface{} and anything else JSON can hold
+		return &schema{}
+	}
+}
+
+// ref returns a reference to the named struct's component, adding it the
+// first time
+func (b *schemaBuilder) ref(t reflect.Type) *schema {
+	name, ok := b.names[t]
+	if !ok {
+		name = t.Name()
+		if _, taken := b.schemas[name]; taken {
+			name = componentPrefix(t.PkgPath()) + name
+		}
+		b.names[t] = name
+		b.schemas[name] = &schema{} // Placeholder for types that refer to themselves
+		b.schemas[name] = b.object(t)
+	}
+	return &schema{Ref: "#/components/schemas/" + name}
+}
+
+// componentPrefix tells apart types from different packages with one name
+func componentPrefix(pkgPath string) string {
+	pkg := pkgPath[strings.LastIndex(pkgPath, "/")+1:]
+	return strings.ToUpper(pkg[:1]) + pkg[1:]
+}
+
+// object writes a struct's fields as encoding/json would marshal them
+func (b *schemaBuilder) object(t reflect.Type) *schema {
+	object := &schema{Type: "object", Properties: map[string]*schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		// Untagged embedded structs are flattened
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				flattened := b.object(embedded)
+				for property, s := range flattened.Properties {
+					object.Properties[property] = s
+				}
+				object.Required = append(object.Required, flattened.Required...)
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := b.schema(field.Type)
+		if field.Type.Kind() == reflect.Ptr && property.Ref == "" {
+			property.Nullable = true
+		}
+		object.Properties[name] = property
+		if strings.Contains(field.Tag.Get("binding"), "required") {
+			object.Required = append(object.Required, name)
+		}
+	}
+	sort.Strings(object.Required)
+	return object
+}
+
+// errorSchema returns the reference to the apierror envelope, adding it the
+// first time
+func (b *schemaBuilder) errorSchema() *schema {
+	if _, ok := b.schemas[errorSchemaName]; !ok {
+		b.schemas[errorSchemaName] = &schema{
+			Type: "object",
+			Properties: map[string]*schema{
+				"success": {Type: "boolean"},
+				"error": {
+					Type: "object",
+					Properties: map[string]*schema{
+						"code":    {Type: "string"},
+						"message": {Type: "string"},
+						"details": {},
+					},
+					Required: []string{"code", "message"},
+				},
+				"request_id": {Type: "string"},
+			},
+			Required: []string{"error", "success"},
+		}
+	}
+	return &schema{Ref: "#/components/schemas/" + errorSchemaName}
+}
+
+// OpenAPIHandler serves the spec and, when enabled, a Swagger UI page for it
+type OpenAPIHandler struct {
+	spec []byte
+}
+
+// NewOpenAPIHandler builds the spec of the routes given once, for every
+// request to share
+func NewOpenAPIHandler(registry *OpenAPIRegistry, routes gin.RoutesInfo) *OpenAPIHandler {
+	spec, err := json.Marshal(registry.Spec(routes))
+	if err != nil {
+		// Schemas are built from Go types, so this can't depend on input
+		panic(fmt.Sprintf("openapi: failed to encode spec: %v", err))
+	}
+	return &OpenAPIHandler{spec: spec}
+}
+
+// Spec handles GET /v1/openapi.json
+func (h *OpenAPIHandler) Spec(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", h.spec)
+}
+
+// swaggerUIPage loads Swagger UI from a CDN and points it at the spec
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Wavlake API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>SwaggerUIBundle({url: "/v1/openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`
+
+// SwaggerUI handles GET /v1/docs
+func (h *OpenAPIHandler) SwaggerUI(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUIPage))
+}
@@ -0,0 +1,393 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/wavlake/api/internal/feeds"
+	"github.com/wavlake/api/internal/models"
+)
+
+// Query parameters several routes share
+var (
+	limitParam  = Param{Name: "limit", Type: "integer", Description: "Page size"}
+	cursorParam = Param{Name: "cursor", Description: "next_cursor of the previous page"}
+)
+
+// legacyTrackParams are the track listing params of the legacy endpoints
+var legacyTrackParams = []Param{
+	{Name: "limit", Type: "integer", Description: "Page size; defaults to 100, at most 500"},
+	{Name: "offset", Type: "integer"},
+	{Name: "is_draft", Type: "boolean"},
+	{Name: "deleted", Type: "boolean", Description: "true lists deleted tracks"},
+	{Name: "published_since", Description: "RFC 3339 time"},
+}
+
+// unscopedTrackParams are the params of the artist and album listings, which
+// leave out deleted and draft filters
+var unscopedTrackParams = []Param{
+	{Name: "limit", Type: "integer", Description: "Page size; defaults to 100, at most 500"},
+	{Name: "offset", Type: "integer"},
+	{Name: "published_since", Description: "RFC 3339 time"},
+}
+
+// NostrEvent is a Nostr event as NIP-01 writes it. go-nostr's Event has its
+// own JSON marshaller, which the schema builder can't see through.
+type NostrEvent struct {
+	ID        string     `json:"id"`
+	PubKey    string     `json:"pubkey"`
+	CreatedAt int64      `json:"created_at"`
+	Kind      int        `json:"kind"`
+	Tags      [][]string `json:"tags"`
+	Content   string     `json:"content"`
+	Sig       string     `json:"sig"`
+}
+
+// RegisterOperations documents every route newRouter can register. Routes
+// added to the router must be registered here too; the router tests fail on
+// either missing.
+func RegisterOperations(r *OpenAPIRegistry) {
+	// Probes and docs
+	r.Register(http.MethodGet, "/heartbeat", Operation{
+		Summary: "Heartbeat", Tag: "health",
+		Response: HeartbeatResponse{},
+	})
+	r.Register(http.MethodGet, "/livez", Operation{
+		Summary: "Liveness probe", Tag: "health",
+		Response: struct {
+			Status string `json:"status"`
+		}{},
+	})
+	r.Register(http.MethodGet, "/readyz", Operation{
+		Summary: "Readiness probe", Tag: "health",
+		Description: "503 with the same body when a dependency is down",
+		Response:    ReadinessResponse{},
+	})
+	r.Register(http.MethodGet, "/metrics", Operation{
+		Summary: "Prometheus metrics", Tag: "health",
+		Description: "Needs METRICS_TOKEN as a bearer token; not served when it's unset",
+		Response:    "", ContentType: "text/plain; version=0.0.4",
+	})
+	r.Register(http.MethodGet, "/v1/openapi.json", Operation{
+		Summary: "This OpenAPI document", Tag: "docs",
+		Response: map[string]interface{}{},
+	})
+	r.Register(http.MethodGet, "/v1/docs", Operation{
+		Summary: "Swagger UI for this document", Tag: "docs",
+		Description: "Served outside release mode only",
+		Response:    "", ContentType: "text/html",
+	})
+
+	// Auth
+	r.Register(http.MethodGet, "/v1/auth/get-linked-pubkeys", Operation{
+		Summary: "List the pubkeys linked to the Firebase account", Tag: "auth", Auth: AuthFirebase,
+		Response: GetLinkedPubkeysResponse{},
+	})
+	r.Register(http.MethodPost, "/v1/auth/unlink-pubkey", Operation{
+		Summary: "Unlink a pubkey from the Firebase account", Tag: "auth", Auth: AuthFirebase,
+		Request: UnlinkPubkeyRequest{}, Response: UnlinkPubkeyResponse{},
+	})
+	r.Register(http.MethodGet, "/v1/auth/pubkey-history", Operation{
+		Summary: "Audit events of the account's pubkeys", Tag: "auth", Auth: AuthFirebase,
+		Response: PubkeyHistoryResponse{},
+	})
+	r.Register(http.MethodPost, "/v1/auth/link-pubkey", Operation{
+		Summary: "Link the signing pubkey to the Firebase account", Tag: "auth", Auth: AuthDual,
+		Request: LinkPubkeyRequest{}, BodyOptional: true, Response: LinkPubkeyResponse{},
+	})
+	r.Register(http.MethodPost, "/v1/auth/check-pubkey-link", Operation{
+		Summary: "Check whether the signing pubkey is linked", Tag: "auth", Auth: AuthNIP98,
+		Request: CheckPubkeyLinkRequest{}, Response: CheckPubkeyLinkResponse{},
+	})
+	r.Register(http.MethodPost, "/v1/auth/check-pubkeys", Operation{
+		Summary: "Check whether each pubkey is linked", Tag: "auth",
+		Description: "Rate limited per IP",
+		Request:     CheckPubkeysRequest{}, Response: CheckPubkeysResponse{},
+	})
+
+	// Tracks
+	r.Register(http.MethodGet, "/v1/tracks/:id", Operation{
+		Summary: "Get a published track", Tag: "tracks",
+		Response: GetTrackResponse{},
+	})
+	r.Register(http.MethodPost, "/v1/tracks/webhook/process", Operation{
+		Summary: "Report processing status or a compression version", Tag: "tracks",
+		Description: "Called by processing workers; data is set for version reports",
+		Request:     WebhookPayload{},
+		Response: struct {
+			Success   bool                       `json:"success"`
+			Message   string                     `json:"message,omitempty"`
+			Duplicate bool                       `json:"duplicate,omitempty"`
+			Data      *models.CompressionVersion `json:"data,omitempty"`
+		}{},
+	})
+	r.Register(http.MethodPost, "/v1/tracks/nostr", Operation{
+		Summary: "Create a track and get its upload URL", Tag: "tracks", Auth: AuthNIP98,
+		Request: CreateTrackRequest{}, Response: CreateTrackResponse{},
+	})
+	r.Register(http.MethodPost, "/v1/tracks/import", Operation{
+		Summary: "Import a track from a URL", Tag: "tracks", Auth: AuthNIP98,
+		Request: ImportTrackRequest{}, Response: CreateTrackResponse{}, Status: http.StatusAccepted,
+	})
+	r.Register(http.MethodGet, "/v1/tracks/my", Operation{
+		Summary: "List the caller's tracks", Tag: "tracks", Auth: AuthNIP98,
+		Query: []Param{
+			{Name: "is_published", Type: "boolean"},
+			{Name: "status", Description: "Processing status to filter by"},
+			limitParam, cursorParam,
+		},
+		Response: GetTracksResponse{},
+	})
+	r.Register(http.MethodDelete, "/v1/tracks/:id", Operation{
+		Summary: "Delete a track", Tag: "tracks", Auth: AuthNIP98,
+		Query: []Param{
+			{Name: "dry_run", Type: "boolean", Description: "true reports what would be deleted"},
+			{Name: "purge", Type: "boolean", Description: "true removes the files as well"},
+		},
+		Response: DeleteTrackResponse{},
+	})
+	r.Register(http.MethodPost, "/v1/tracks/:id/restore", Operation{
+		Summary: "Restore a deleted track", Tag: "tracks", Auth: AuthNIP98,
+		Response: GetTrackResponse{},
+	})
+	r.Register(http.MethodGet, "/v1/tracks/:id/status", Operation{
+		Summary: "Get a track's processing status", Tag: "tracks", Auth: AuthNIP98,
+		Response: GetTrackResponse{},
+	})
+	r.Register(http.MethodGet, "/v1/tracks/:id/history", Operation{
+		Summary: "List a track's processing attempts", Tag: "tracks", Auth: AuthNIP98,
+		Query:    []Param{limitParam, cursorParam},
+		Response: GetTrackHistoryResponse{},
+	})
+	r.Register(http.MethodGet, "/v1/tracks/:id/events", Operation{
+		Summary: "Stream a track's status changes", Tag: "tracks", Auth: AuthNIP98,
+		Description: "Server-Sent Events with TrackEvent data",
+		Response:    "", ContentType: "text/event-stream",
+	})
+	r.Register(http.MethodPost, "/v1/tracks/:id/share-links", Operation{
+		Summary: "Create an unlisted share link", Tag: "tracks", Auth: AuthNIP98,
+		Request: CreateShareLinkRequest{}, BodyOptional: true,
+		Response: ShareLinkResponse{}, Status: http.StatusCreated,
+	})
+	r.Register(http.MethodGet, "/v1/tracks/:id/share-links", Operation{
+		Summary: "List a track's share links", Tag: "tracks", Auth: AuthNIP98,
+		Response: ListShareLinksResponse{},
+	})
+	r.Register(http.MethodDelete, "/v1/tracks/:id/share-links/:link_id", Operation{
+		Summary: "Revoke a share link", Tag: "tracks", Auth: AuthNIP98,
+		Response: ShareLinkResponse{},
+	})
+	r.Register(http.MethodGet, "/v1/tracks/:id/original-download", Operation{
+		Summary: "Get a signed URL for the original upload", Tag: "tracks", Auth: AuthNIP98,
+		Query:    []Param{{Name: "expires_in", Type: "integer", Description: "Seconds the URL works for"}},
+		Response: OriginalDownloadResponse{},
+	})
+	r.Register(http.MethodPost, "/v1/tracks/:id/upload-url", Operation{
+		Summary: "Get a new upload URL", Tag: "tracks", Auth: AuthNIP98,
+		Query:    []Param{{Name: "replace", Type: "boolean", Description: "true replaces a processed upload"}},
+		Response: UploadURLResponse{},
+	})
+	r.Register(http.MethodPost, "/v1/tracks/:id/process", Operation{
+		Summary: "Start processing an uploaded track", Tag: "tracks", Auth: AuthNIP98,
+		Response: CreateTrackResponse{},
+	})
+	r.Register(http.MethodPost, "/v1/tracks/bulk-compress", Operation{
+		Summary: "Start compressing many tracks", Tag: "tracks", Auth: AuthNIP98,
+		Request: BulkCompressRequest{}, Data: models.BulkCompressionJob{}, Status: http.StatusAccepted,
+	})
+	r.Register(http.MethodGet, "/v1/tracks/bulk-compress/:job_id", Operation{
+		Summary: "Get a bulk compression job", Tag: "tracks", Auth: AuthNIP98,
+		Data: models.BulkCompressionJob{},
+	})
+	r.Register(http.MethodPost, "/v1/tracks/:id/compress", Operation{
+		Summary: "Request compressed versions of a track", Tag: "tracks", Auth: AuthNIP98,
+		Request: RequestCompressionRequest{}, Response: RequestCompressionResponse{},
+	})
+	r.Register(http.MethodPut, "/v1/tracks/:id/compression-visibility", Operation{
+		Summary: "Choose which compressed versions are public", Tag: "tracks", Auth: AuthNIP98,
+		Request: UpdateVisibilityRequest{}, Response: CreateTrackResponse{},
+	})
+	r.Register(http.MethodGet, "/v1/tracks/:id/public-versions", Operation{
+		Summary: "List a track's public versions", Tag: "tracks", Auth: AuthNIP98,
+		Data: struct {
+			TrackID        string                      `json:"track_id"`
+			OriginalURL    string                      `json:"original_url"`
+			OriginalHash   string                      `json:"original_hash"`
+			PublicVersions []models.CompressionVersion `json:"public_versions"`
+		}{},
+	})
+	r.Register(http.MethodGet, "/v1/tracks/:id/nostr-event", Operation{
+		Summary: "Get the unsigned Nostr event for a track", Tag: "tracks", Auth: AuthNIP98,
+		Data: NostrEvent{},
+	})
+	r.Register(http.MethodPost, "/v1/tracks/:id/published", Operation{
+		Summary: "Record where a track's event was published", Tag: "tracks", Auth: AuthNIP98,
+		Request: RecordPublicationRequest{}, Response: GetTrackResponse{},
+	})
+	r.Register(http.MethodPut, "/v1/tracks/:id/nostr-ref", Operation{
+		Summary: "Set the Nostr event a track is published as", Tag: "tracks", Auth: AuthNIP98,
+		Request: UpdateNostrRefRequest{}, Response: GetTrackResponse{},
+	})
+	r.Register(http.MethodPost, "/v1/tracks/:id/publish", Operation{
+		Summary: "Publish a signed track event to relays", Tag: "tracks", Auth: AuthNIP98,
+		Request: PublishTrackRequest{}, Response: PublishTrackResponse{},
+	})
+	r.Register(http.MethodGet, "/v1/shared/:token", Operation{
+		Summary: "Open a share link", Tag: "tracks",
+		Response: SharedTrackResponse{},
+	})
+
+	// Listeners
+	r.Register(http.MethodGet, "/v1/search/tracks", Operation{
+		Summary: "Search published tracks", Tag: "search",
+		Query:    []Param{{Name: "q", Required: true}, limitParam, cursorParam},
+		Response: SearchTracksResponse{},
+	})
+	r.Register(http.MethodGet, "/v1/feeds/pubkey/:file", Operation{
+		Summary: "RSS feed of a pubkey's tracks", Tag: "feeds",
+		Description: "file is <pubkey>.xml",
+		Response:    "", ContentType: feeds.ContentType,
+	})
+
+	// Notifications
+	r.Register(http.MethodGet, "/v1/notifications", Operation{
+		Summary: "List the account's notifications", Tag: "notifications", Auth: AuthEither,
+		Query:    []Param{limitParam, {Name: "unread", Type: "boolean"}, cursorParam},
+		Response: GetNotificationsResponse{},
+	})
+	r.Register(http.MethodPost, "/v1/notifications/:id/read", Operation{
+		Summary: "Mark a notification read", Tag: "notifications", Auth: AuthEither,
+		Response: struct {
+			Success bool `json:"success"`
+		}{},
+	})
+
+	// Users
+	r.Register(http.MethodGet, "/v1/users/me", Operation{
+		Summary: "Get the account's profile", Tag: "users", Auth: AuthEither,
+		Data: models.UserProfile{},
+	})
+	r.Register(http.MethodPatch, "/v1/users/me", Operation{
+		Summary: "Update the account's profile", Tag: "users", Auth: AuthFirebase,
+		Request: models.UserProfileUpdate{}, Data: models.User{},
+	})
+	r.Register(http.MethodDelete, "/v1/users/me", Operation{
+		Summary: "Delete the account", Tag: "users", Auth: AuthFirebase,
+		Description: "Without confirmation_code, sends a code and responds 202 with an AccountDeletionConfirmation",
+		Query: []Param{
+			{Name: "confirmation_code"},
+			{Name: "disable_firebase_account", Type: "boolean"},
+		},
+		Data: models.AccountDeletion{},
+	})
+	r.Register(http.MethodGet, "/v1/users/me/usage", Operation{
+		Summary: "Get the account's storage and track usage", Tag: "users", Auth: AuthEither,
+		Response: UsageResponse{},
+	})
+	r.Register(http.MethodGet, "/v1/users/me/export", Operation{
+		Summary: "Export the account's data", Tag: "users", Auth: AuthEither,
+		Description: "Small accounts get the zip archive with 200; large ones a 202 with the job started",
+		Data:        models.ExportJob{}, Status: http.StatusAccepted,
+	})
+	r.Register(http.MethodGet, "/v1/users/me/export/:job_id", Operation{
+		Summary: "Get an export job", Tag: "users", Auth: AuthEither,
+		Data: models.ExportJob{},
+	})
+
+	// Webhooks
+	r.Register(http.MethodPost, "/v1/webhooks", Operation{
+		Summary: "Create a webhook", Tag: "webhooks", Auth: AuthNIP98,
+		Request: CreateWebhookRequest{}, Data: models.UserWebhook{}, Status: http.StatusCreated,
+	})
+	r.Register(http.MethodGet, "/v1/webhooks", Operation{
+		Summary: "List the account's webhooks", Tag: "webhooks", Auth: AuthNIP98,
+		Data: []models.UserWebhook{},
+	})
+	r.Register(http.MethodDelete, "/v1/webhooks/:id", Operation{
+		Summary: "Delete a webhook", Tag: "webhooks", Auth: AuthNIP98,
+		Response: struct {
+			Success bool `json:"success"`
+		}{},
+	})
+	r.Register(http.MethodPost, "/v1/webhooks/:id/test", Operation{
+		Summary: "Send a test delivery", Tag: "webhooks", Auth: AuthNIP98,
+		Data: models.WebhookDelivery{},
+	})
+
+	// Admin
+	r.Register(http.MethodGet, "/v1/admin/tracks", Operation{
+		Summary: "List a pubkey's tracks", Tag: "admin", Auth: AuthFirebase,
+		Query:    []Param{{Name: "pubkey", Required: true}},
+		Response: GetTracksResponse{},
+	})
+	r.Register(http.MethodPost, "/v1/admin/tracks/:id/reprocess", Operation{
+		Summary: "Reprocess a track", Tag: "admin", Auth: AuthFirebase,
+		Response: CreateTrackResponse{},
+	})
+	r.Register(http.MethodPost, "/v1/admin/processing/reconcile", Operation{
+		Summary: "Repair tracks stuck processing", Tag: "admin", Auth: AuthFirebase,
+		Response: ReconcileResponse{},
+	})
+	r.Register(http.MethodGet, "/v1/admin/pubkey-history", Operation{
+		Summary: "Audit events of a pubkey", Tag: "admin", Auth: AuthFirebase,
+		Query:    []Param{{Name: "pubkey", Required: true}},
+		Response: PubkeyHistoryResponse{},
+	})
+
+	// Local storage, with STORAGE_PROVIDER=local
+	signatureParam := []Param{{Name: "signature", Description: "Of the signed URL"}}
+	r.Register(http.MethodGet, "/v1/dev/files/*path", Operation{
+		Summary: "Download a stored object", Tag: "dev",
+		Query: signatureParam, Response: "", ContentType: "application/octet-stream",
+	})
+	r.Register(http.MethodHead, "/v1/dev/files/*path", Operation{
+		Summary: "Check a stored object", Tag: "dev",
+		Query: signatureParam,
+	})
+	r.Register(http.MethodPut, "/v1/dev/files/*path", Operation{
+		Summary: "Upload an object to a signed URL", Tag: "dev",
+		Query: signatureParam,
+	})
+
+	// Legacy catalog, with PostgreSQL configured
+	r.Register(http.MethodGet, "/v1/legacy/metadata", Operation{
+		Summary: "Get the account's legacy catalog", Tag: "legacy", Auth: AuthEither,
+		Query: legacyTrackParams, Response: UserMetadataResponse{},
+	})
+	r.Register(http.MethodGet, "/v1/legacy/tracks", Operation{
+		Summary: "List the account's legacy tracks", Tag: "legacy", Auth: AuthEither,
+		Query: legacyTrackParams, Response: LegacyTracksResponse{},
+	})
+	r.Register(http.MethodGet, "/v1/legacy/artists", Operation{
+		Summary: "List the account's legacy artists", Tag: "legacy", Auth: AuthEither,
+		Response: struct {
+			Artists []models.LegacyArtist `json:"artists"`
+		}{},
+	})
+	r.Register(http.MethodGet, "/v1/legacy/albums", Operation{
+		Summary: "List the account's legacy albums", Tag: "legacy", Auth: AuthEither,
+		Response: struct {
+			Albums []models.LegacyAlbum `json:"albums"`
+		}{},
+	})
+	r.Register(http.MethodGet, "/v1/legacy/artists/:artist_id/tracks", Operation{
+		Summary: "List a legacy artist's tracks", Tag: "legacy", Auth: AuthEither,
+		Query: unscopedTrackParams, Response: LegacyTracksResponse{},
+	})
+	r.Register(http.MethodGet, "/v1/legacy/albums/:album_id/tracks", Operation{
+		Summary: "List a legacy album's tracks", Tag: "legacy", Auth: AuthEither,
+		Query: unscopedTrackParams, Response: LegacyTracksResponse{},
+	})
+	r.Register(http.MethodGet, "/v1/legacy/search", Operation{
+		Summary: "Search the account's legacy catalog", Tag: "legacy", Auth: AuthEither,
+		Query: []Param{
+			{Name: "q", Required: true},
+			{Name: "type", Description: "track, album or artist"},
+			limitParam,
+		},
+		Response: LegacySearchResponse{},
+	})
+	r.Register(http.MethodGet, "/v1/legacy/earnings", Operation{
+		Summary: "Total the account's legacy earnings", Tag: "legacy", Auth: AuthEither,
+		Response: models.LegacyEarnings{},
+	})
+}
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// registeredRoutes are the routes of every registered operation, as the
+// router would report them
+func registeredRoutes(registry *OpenAPIRegistry) gin.RoutesInfo {
+	var routes gin.RoutesInfo
+	for _, route := range registry.Routes() {
+		method, path, _ := strings.Cut(route, " ")
+		routes = append(routes, gin.RouteInfo{Method: method, Path: path})
+	}
+	return routes
+}
+
+// decodedSpec is the spec of every registered operation as a client reads it
+func decodedSpec(t *testing.T) map[string]interface{} {
+	t.Helper()
+	registry := NewOpenAPIRegistry()
+	RegisterOperations(registry)
+
+	raw, err := json.Marshal(registry.Spec(registeredRoutes(registry)))
+	require.NoError(t, err)
+	var spec map[string]interface{}
+	require.NoError(t, json.Unmarshal(raw, &spec))
+	return spec
+}
+
+// refs collects every $ref in v
+func refs(v interface{}, found *[]string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if ref, ok := value.(string); ok && key == "$ref" {
+				*found = append(*found, ref)
+			}
+			refs(value, found)
+		}
+	case []interface{}:
+		for _, value := range v {
+			refs(value, found)
+		}
+	}
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	spec := decodedSpec(t)
+
+	assert.Equal(t, "3.0.3", spec["openapi"])
+	components := spec["components"].(map[string]interface{})
+	schemes := components["securitySchemes"].(map[string]interface{})
+	assert.Equal(t, "bearer", schemes[SecuritySchemeFirebase].(map[string]interface{})["scheme"])
+	assert.Equal(t, "Authorization", schemes[SecuritySchemeNIP98].(map[string]interface{})["name"])
+
+	// Every reference resolves
+	schemas := components["schemas"].(map[string]interface{})
+	var found []string
+	refs(spec, &found)
+	require.NotEmpty(t, found)
+	for _, ref := range found {
+		name, ok := strings.CutPrefix(ref, "#/components/schemas/")
+		require.True(t, ok, ref)
+		assert.Contains(t, schemas, name)
+	}
+
+	// Operations have unique IDs, declare their path parameters and only
+	// use the security schemes defined
+	operationIDs := map[string]string{}
+	for path, item := range spec["paths"].(map[string]interface{}) {
+		for method, raw := range item.(map[string]interface{}) {
+			operation := raw.(map[string]interface{})
+			route := method + " " + path
+
+			id := operation["operationId"].(string)
+			assert.NotContains(t, operationIDs, id, "%s has the operationId of %s", route, operationIDs[id])
+			operationIDs[id] = route
+			assert.NotEmpty(t, operation["summary"], route)
+
+			declared := map[string]bool{}
+			for _, param := range operation["parameters"].([]interface{}) {
+				param := param.(map[string]interface{})
+				if param["in"] == "path" {
+					declared[param["name"].(string)] = true
+				}
+			}
+			var params []string
+			for _, segment := range strings.Split(path, "/") {
+				if name, ok := strings.CutPrefix(segment, "{"); ok {
+					params = append(params, strings.TrimSuffix(name, "}"))
+				}
+			}
+			assert.Len(t, declared, len(params), route)
+			for _, name := range params {
+				assert.True(t, declared[name], "%s doesn't declare %s", route, name)
+			}
+
+			for _, requirement := range operation["security"].([]interface{}) {
+				for scheme := range requirement.(map[string]interface{}) {
+					assert.Contains(t, schemes, scheme, route)
+				}
+			}
+			assert.Contains(t, operation["responses"], "default", route)
+		}
+	}
+}
+
+func TestOpenAPISpecSecurity(t *testing.T) {
+	paths := decodedSpec(t)["paths"].(map[string]interface{})
+	security := func(path, method string) interface{} {
+		return paths[path].(map[string]interface{})[method].(map[string]interface{})["security"]
+	}
+
+	assert.Equal(t, []interface{}{}, security("/v1/tracks/{id}", "get"))
+	assert.Equal(t, []interface{}{map[string]interface{}{"nip98": []interface{}{}}}, security("/v1/tracks/my", "get"))
+	assert.Equal(t, []interface{}{map[string]interface{}{"firebase": []interface{}{}, "nip98": []interface{}{}}},
+		security("/v1/auth/link-pubkey", "post"))
+	assert.Len(t, security("/v1/users/me", "get"), 2, "either scheme is a requirement of its own")
+}
+
+func TestOpenAPISpecSkipsUnroutedOperations(t *testing.T) {
+	registry := NewOpenAPIRegistry()
+	registry.Register(http.MethodGet, "/v1/tracks/:id", Operation{Summary: "Get a track", Response: GetTrackResponse{}})
+	registry.Register(http.MethodGet, "/v1/legacy/tracks", Operation{Summary: "Legacy tracks"})
+
+	spec := registry.Spec(gin.RoutesInfo{
+		{Method: http.MethodGet, Path: "/v1/tracks/:id"},
+		{Method: http.MethodGet, Path: "/v1/unregistered"},
+	})
+
+	paths := spec["paths"].(map[string]map[string]interface{})
+	assert.Len(t, paths, 1)
+	assert.Contains(t, paths, "/v1/tracks/{id}")
+}
+
+func TestRegisterTwicePanics(t *testing.T) {
+	registry := NewOpenAPIRegistry()
+	registry.Register(http.MethodGet, "/heartbeat", Operation{})
+	assert.True(t, registry.Has(http.MethodGet, "/heartbeat"))
+	assert.False(t, registry.Has(http.MethodPost, "/heartbeat"))
+	assert.Panics(t, func() { registry.Register(http.MethodGet, "/heartbeat", Operation{}) })
+}
+
+func TestOpenAPIPath(t *testing.T) {
+	path, params := openAPIPath("/v1/tracks/:id/share-links/:link_id")
+	assert.Equal(t, "/v1/tracks/{id}/share-links/{link_id}", path)
+	assert.Equal(t, []string{"id", "link_id"}, params)
+
+	path, params = openAPIPath("/v1/dev/files/*path")
+	assert.Equal(t, "/v1/dev/files/{path}", path)
+	assert.Equal(t, []string{"path"}, params)
+
+	assert.Equal(t, "postV1TracksIdCompress", operationID(http.MethodPost, "/v1/tracks/{id}/compress"))
+	assert.Equal(t, "getV1OpenapiJson", operationID(http.MethodGet, "/v1/openapi.json"))
+}
+
+func TestSchemaBuilder(t *testing.T) {
+	type inner struct {
+		Name string `json:"name"`
+	}
+	type embedded struct {
+		Embedded string `json:"embedded"`
+	}
+	type outer struct {
+		embedded
+		ID       string            `json:"id" binding:"required"`
+		Count    *int              `json:"count,omitempty"`
+		Inner    *inner            `json:"inner"`
+		Inners   []inner           `json:"inners"`
+		Labels   map[string]string `json:"labels"`
+		Created  time.Time         `json:"created"`
+		Raw      json.RawMessage   `json:"raw"`
+		Skipped  string            `json:"-"`
+		internal string
+	}
+
+	builder := newSchemaBuilder()
+	ref := builder.schema(reflect.TypeOf(outer{}))
+	assert.Equal(t, "#/components/schemas/outer", ref.Ref)
+
+	object := builder.schemas["outer"]
+	assert.Equal(t, []string{"id"}, object.Required)
+	assert.ElementsMatch(t, []string{"embedded", "id", "count", "inner", "inners", "labels", "created", "raw"}, keys(object.Properties))
+	assert.Equal(t, &schema{Type: "integer", Nullable: true}, object.Properties["count"])
+	assert.Equal(t, "#/components/schemas/inner", object.Properties["inner"].Ref)
+	assert.Equal(t, "#/components/schemas/inner", object.Properties["inners"].Items.Ref)
+	assert.Equal(t, "string", object.Properties["labels"].AdditionalProperties.Type)
+	assert.Equal(t, "date-time", object.Properties["created"].Format)
+	assert.Equal(t, &schema{}, object.Properties["raw"])
+}
+
+func keys(m map[string]*schema) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	registry := NewOpenAPIRegistry()
+	registry.Register(http.MethodGet, "/v1/openapi.json", Operation{Summary: "Spec"})
+	routes := gin.RoutesInfo{{Method: http.MethodGet, Path: "/v1/openapi.json"}}
+	handler := NewOpenAPIHandler(registry, routes)
+
+	router := gin.New()
+	router.GET("/v1/openapi.json", handler.Spec)
+	router.GET("/v1/docs", handler.SwaggerUI)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	var spec map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &spec))
+	assert.Contains(t, spec["paths"], "/v1/openapi.json")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/docs", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `url: "/v1/openapi.json"`)
+}
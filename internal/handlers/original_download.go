@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+// OriginalDownloadResponse represents a signed URL for a track's original
+type OriginalDownloadResponse struct {
+	Success bool                     `json:"success"`
+	Data    *models.OriginalDownload `json:"data,omitempty"`
+}
+
+// GetOriginalDownload handles GET /v1/tracks/:id/original-download
+// Returns a signed URL for the owner to download their original upload. The
+// optional expires_in query parameter sets its lifetime in seconds; it
+// defaults to 15 minutes and is at most 24 hours. Originals archived offline
+// get 409 with Retry-After while they're restored.
+func (h *TracksHandler) GetOriginalDownload(c *gin.Context) {
+	trackID := c.Param("id")
+	if trackID == "" {
+		apierror.Respond(c, apierror.Validation("track ID is required"))
+		return
+	}
+
+	expiration := services.DefaultOriginalDownloadExpiration
+	if raw := c.Query("expires_in"); raw != "" {
+		seconds, err := strconv.Atoi(raw)
+		if err != nil || seconds <= 0 || time.Duration(seconds)*time.Second > services.MaxOriginalDownloadExpiration {
+			apierror.Respond(c, apierror.Validation("expires_in must be between 1 second and 24 hours"))
+			return
+		}
+		expiration = time.Duration(seconds) * time.Second
+	}
+
+	track, err := h.nostrTrackService.GetTrack(c.Request.Context(), trackID)
+	if err != nil {
+		apierror.Respond(c, apierror.NotFound("track not found"))
+		return
+	}
+
+	pubkey, exists := c.Get("pubkey")
+	if !exists {
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	pubkeyStr, ok := pubkey.(string)
+	if !ok || track.Pubkey != pubkeyStr {
+		apierror.Respond(c, apierror.Forbidden("not authorized to download this track"))
+		return
+	}
+
+	if track.CurrentStatus() == models.TrackStatusPendingUpload {
+		apierror.Respond(c, apierror.Conflict("original has not been uploaded yet"))
+		return
+	}
+
+	download, err := h.nostrTrackService.SignOriginalDownload(c.Request.Context(), track, expiration)
+	if errors.Is(err, services.ErrOriginalRestoring) {
+		c.Header("Retry-After", strconv.Itoa(int(services.OriginalRestoreRetryAfter/time.Second)))
+		apierror.Respond(c, apierror.Conflict("original is archived; a restore has started, retry later"))
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to sign original download for track %s: %v", trackID, err)
+		apierror.Respond(c, apierror.Internal("failed to prepare download"))
+		return
+	}
+
+	// The signed URL is a credential for the original
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, OriginalDownloadResponse{
+		Success: true,
+		Data:    download,
+	})
+}
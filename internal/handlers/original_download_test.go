@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+func (suite *TracksHandlerTestSuite) TestGetOriginalDownload_Defaults() {
+	track := suite.ownedTrack()
+	download := &models.OriginalDownload{URL: "https://storage.example.com/signed", Filename: "track-123.wav", ExpiresIn: 900}
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+	suite.nostrTrackService.On("SignOriginalDownload", mock.Anything, track, services.DefaultOriginalDownloadExpiration).Return(download, nil)
+
+	w, response := suite.request("GET", "/v1/tracks/track-123/original-download", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "no-store", w.Header().Get("Cache-Control"))
+	data := response["data"].(map[string]interface{})
+	assert.Equal(suite.T(), "https://storage.example.com/signed", data["url"])
+	assert.Equal(suite.T(), float64(900), data["expires_in"])
+}
+
+func (suite *TracksHandlerTestSuite) TestGetOriginalDownload_ExpiresIn() {
+	track := suite.ownedTrack()
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+	suite.nostrTrackService.On("SignOriginalDownload", mock.Anything, track, time.Hour).Return(&models.OriginalDownload{ExpiresIn: 3600}, nil)
+
+	w, _ := suite.request("GET", "/v1/tracks/track-123/original-download?expires_in=3600", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestGetOriginalDownload_InvalidExpiresIn() {
+	for _, expiresIn := range []string{"0", "-1", "soon", "86401"} {
+		w, _ := suite.request("GET", "/v1/tracks/track-123/original-download?expires_in="+expiresIn, nil)
+		assert.Equal(suite.T(), http.StatusBadRequest, w.Code, expiresIn)
+	}
+	suite.nostrTrackService.AssertNotCalled(suite.T(), "SignOriginalDownload", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *TracksHandlerTestSuite) TestGetOriginalDownload_NotOwner() {
+	track := suite.ownedTrack()
+	track.Pubkey = "someone-else"
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+
+	w, _ := suite.request("GET", "/v1/tracks/track-123/original-download", nil)
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	suite.nostrTrackService.AssertNotCalled(suite.T(), "SignOriginalDownload", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *TracksHandlerTestSuite) TestGetOriginalDownload_NotUploaded() {
+	track := suite.ownedTrack()
+	track.Status = models.TrackStatusPendingUpload
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+
+	w, _ := suite.request("GET", "/v1/tracks/track-123/original-download", nil)
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestGetOriginalDownload_SigningFails() {
+	track := suite.ownedTrack()
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+	suite.nostrTrackService.On("SignOriginalDownload", mock.Anything, track, services.DefaultOriginalDownloadExpiration).Return(nil, errors.New("signing failed"))
+
+	w, _ := suite.request("GET", "/v1/tracks/track-123/original-download", nil)
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestGetOriginalDownload_Restoring() {
+	track := suite.ownedTrack()
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+	suite.nostrTrackService.On("SignOriginalDownload", mock.Anything, track, services.DefaultOriginalDownloadExpiration).Return(nil, services.ErrOriginalRestoring)
+
+	w, response := suite.request("GET", "/v1/tracks/track-123/original-download", nil)
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+	assert.Equal(suite.T(), "3600", w.Header().Get("Retry-After"))
+	assert.Contains(suite.T(), errorMessage(response), "restore has started")
+}
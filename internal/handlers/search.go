@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+type SearchHandler struct {
+	searchIndex services.SearchIndex
+}
+
+func NewSearchHandler(searchIndex services.SearchIndex) *SearchHandler {
+	return &SearchHandler{searchIndex: searchIndex}
+}
+
+// SearchTracksResponse represents a page of track search results
+type SearchTracksResponse struct {
+	Success    bool                 `json:"success"`
+	Data       []*models.NostrTrack `json:"data"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+}
+
+// SearchTracks handles GET /v1/search/tracks?q=
+// Matches published, ready tracks whose title or artist starts with q, most
+// relevant first. Supports ?limit= and ?cursor= (from next_cursor).
+func (h *SearchHandler) SearchTracks(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		apierror.Respond(c, apierror.Validation("q is required"))
+		return
+	}
+	if len(query) > services.MaxSearchQueryLength {
+		apierror.Respond(c, apierror.Validation("q is too long"))
+		return
+	}
+
+	limit := services.DefaultSearchPageSize
+	if limitParam := c.Query("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed <= 0 {
+			apierror.Respond(c, apierror.Validation("limit must be a positive integer"))
+			return
+		}
+		limit = parsed
+	}
+
+	tracks, nextCursor, err := h.searchIndex.SearchTracks(c.Request.Context(), query, limit, c.Query("cursor"))
+	if errors.Is(err, services.ErrInvalidSearchCursor) {
+		apierror.Respond(c, apierror.Validation("invalid cursor"))
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to search tracks for %q: %v", query, err)
+		apierror.Respond(c, apierror.Internal("failed to search tracks"))
+		return
+	}
+
+	results := make([]*models.NostrTrack, 0, len(tracks))
+	for _, track := range tracks {
+		results = append(results, publicTrack(track))
+	}
+
+	c.JSON(http.StatusOK, SearchTracksResponse{
+		Success:    true,
+		Data:       results,
+		NextCursor: nextCursor,
+	})
+}
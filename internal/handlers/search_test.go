@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/wavlake/api/internal/mocks"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+type SearchHandlerTestSuite struct {
+	suite.Suite
+	router      *gin.Engine
+	searchIndex *mocks.MockSearchIndex
+}
+
+func (suite *SearchHandlerTestSuite) SetupTest() {
+	gin.SetMode(gin.TestMode)
+
+	suite.searchIndex = &mocks.MockSearchIndex{}
+	suite.router = gin.New()
+	suite.router.GET("/v1/search/tracks", NewSearchHandler(suite.searchIndex).SearchTracks)
+}
+
+func (suite *SearchHandlerTestSuite) TearDownTest() {
+	suite.searchIndex.AssertExpectations(suite.T())
+}
+
+func (suite *SearchHandlerTestSuite) search(query string) (*httptest.ResponseRecorder, SearchTracksResponse) {
+	req, _ := http.NewRequest("GET", "/v1/search/tracks"+query, nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	var response SearchTracksResponse
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	return w, response
+}
+
+func (suite *SearchHandlerTestSuite) TestSearchTracks_ReturnsPublicProjection() {
+	track := &models.NostrTrack{
+		ID:           "track-1",
+		FirebaseUID:  "owner-uid",
+		Pubkey:       "owner-pubkey",
+		Title:        "Midnight City",
+		Artist:       "M83",
+		Status:       models.TrackStatusReady,
+		IsPublished:  true,
+		NostrEventID: "event-1",
+		SourceURL:    "https://example.com/private.wav",
+		CompressionVersions: []models.CompressionVersion{
+			{ID: "public", URL: "https://cdn/public.mp3", IsPublic: true},
+			{ID: "private", URL: "https://cdn/private.mp3", IsPublic: false},
+		},
+	}
+	suite.searchIndex.On("SearchTracks", mock.Anything, "midnight", services.DefaultSearchPageSize, "").Return([]*models.NostrTrack{track}, "track-1", nil)
+
+	w, response := suite.search("?q=midnight")
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.True(suite.T(), response.Success)
+	assert.Equal(suite.T(), "track-1", response.NextCursor)
+	suite.Require().Len(response.Data, 1)
+
+	result := response.Data[0]
+	assert.Equal(suite.T(), "Midnight City", result.Title)
+	assert.Equal(suite.T(), "M83", result.Artist)
+	assert.Equal(suite.T(), "owner-pubkey", result.Pubkey)
+	assert.Equal(suite.T(), "event-1", result.NostrEventID)
+	assert.Empty(suite.T(), result.FirebaseUID)
+	assert.Empty(suite.T(), result.SourceURL)
+	suite.Require().Len(result.CompressionVersions, 1)
+	assert.Equal(suite.T(), "public", result.CompressionVersions[0].ID)
+}
+
+func (suite *SearchHandlerTestSuite) TestSearchTracks_PassesPaging() {
+	suite.searchIndex.On("SearchTracks", mock.Anything, "mid", 5, "track-1").Return([]*models.NostrTrack{}, "", nil)
+
+	w, response := suite.search("?q=mid&limit=5&cursor=track-1")
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.NotNil(suite.T(), response.Data)
+	assert.Empty(suite.T(), response.Data)
+}
+
+func (suite *SearchHandlerTestSuite) TestSearchTracks_ValidatesQuery() {
+	for _, query := range []string{"", "?q=%20%20", "?q=mid&limit=0", "?q=mid&limit=abc"} {
+		w, response := suite.search(query)
+		assert.Equal(suite.T(), http.StatusBadRequest, w.Code, query)
+		assert.False(suite.T(), response.Success, query)
+	}
+
+	long := make([]byte, services.MaxSearchQueryLength+1)
+	for i := range long {
+		long[i] = 'a'
+	}
+	w, _ := suite.search("?q=" + string(long))
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *SearchHandlerTestSuite) TestSearchTracks_Errors() {
+	suite.searchIndex.On("SearchTracks", mock.Anything, "mid", services.DefaultSearchPageSize, "stale").Return(nil, "", services.ErrInvalidSearchCursor)
+	suite.searchIndex.On("SearchTracks", mock.Anything, "mid", services.DefaultSearchPageSize, "").Return(nil, "", errors.New("firestore unavailable"))
+
+	w, _ := suite.search("?q=mid&cursor=stale")
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	w, _ = suite.search("?q=mid")
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
+
+func TestSearchHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(SearchHandlerTestSuite))
+}
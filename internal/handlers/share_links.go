@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+// CreateShareLinkRequest sets how long a share link works and how often it
+// can be opened. Both fields are optional.
+type CreateShareLinkRequest struct {
+	ExpiresIn int `json:"expires_in"` // Seconds; defaults to 7 days, at most 30 days
+	MaxUses   int `json:"max_uses"`   // Zero means unlimited
+}
+
+// ShareLinkResponse represents a single share link
+type ShareLinkResponse struct {
+	Success bool              `json:"success"`
+	Data    *models.ShareLink `json:"data,omitempty"`
+}
+
+// ListShareLinksResponse represents a track's share links
+type ListShareLinksResponse struct {
+	Success bool               `json:"success"`
+	Data    []models.ShareLink `json:"data"`
+}
+
+// SharedTrack is what a share link opens: the public view of the track and
+// signed URLs to stream it
+type SharedTrack struct {
+	Track     *models.NostrTrack    `json:"track"`
+	Streams   []models.SharedStream `json:"streams"`
+	ExpiresAt time.Time             `json:"expires_at"`          // When the share link expires
+	UsesLeft  *int                  `json:"uses_left,omitempty"` // Omitted for unlimited links
+}
+
+// SharedTrackResponse represents an opened share link
+type SharedTrackResponse struct {
+	Success bool         `json:"success"`
+	Data    *SharedTrack `json:"data,omitempty"`
+}
+
+// authorizeTrackOwner checks that the caller owns the track. When they don't,
+// it returns the error to respond with.
+func (h *TracksHandler) authorizeTrackOwner(c *gin.Context, trackID string) error {
+	track, err := h.nostrTrackService.GetTrack(c.Request.Context(), trackID)
+	if err != nil {
+		return err
+	}
+
+	pubkey, exists := c.Get("pubkey")
+	if !exists {
+		return apierror.Unauthorized("authentication required")
+	}
+
+	pubkeyStr, ok := pubkey.(string)
+	if !ok || track.Pubkey != pubkeyStr {
+		return apierror.Forbidden("not authorized to share this track")
+	}
+
+	return nil
+}
+
+// CreateShareLink handles POST /v1/tracks/:id/share-links
+// Creates an unlisted link to the track. The token is only returned here.
+func (h *TracksHandler) CreateShareLink(c *gin.Context) {
+	trackID := c.Param("id")
+	if trackID == "" {
+		apierror.Respond(c, apierror.Validation("track ID is required"))
+		return
+	}
+
+	var req CreateShareLinkRequest
+	if err := bindJSON(c, &req); err != nil && !errors.Is(err, io.EOF) {
+		apierror.Respond(c, bindError(err, "invalid request: "+err.Error()))
+		return
+	}
+
+	ttl := services.DefaultShareLinkTTL
+	if req.ExpiresIn != 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+	}
+	if ttl <= 0 || ttl > services.MaxShareLinkTTL {
+		apierror.Respond(c, apierror.Validation("expires_in must be between 1 second and 30 days"))
+		return
+	}
+	if req.MaxUses < 0 {
+		apierror.Respond(c, apierror.Validation("max_uses must not be negative"))
+		return
+	}
+
+	if err := h.authorizeTrackOwner(c, trackID); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	link, err := h.nostrTrackService.CreateShareLink(c.Request.Context(), trackID, ttl, req.MaxUses)
+	if errors.Is(err, services.ErrTooManyShareLinks) {
+		apierror.Respond(c, err)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to create share link for track %s: %v", trackID, err)
+		apierror.Respond(c, apierror.Internal("failed to create share link"))
+		return
+	}
+
+	c.JSON(http.StatusCreated, ShareLinkResponse{
+		Success: true,
+		Data:    link,
+	})
+}
+
+// ListShareLinks handles GET /v1/tracks/:id/share-links
+func (h *TracksHandler) ListShareLinks(c *gin.Context) {
+	trackID := c.Param("id")
+	if trackID == "" {
+		apierror.Respond(c, apierror.Validation("track ID is required"))
+		return
+	}
+
+	if err := h.authorizeTrackOwner(c, trackID); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	links, err := h.nostrTrackService.ListShareLinks(c.Request.Context(), trackID)
+	if err != nil {
+		log.Printf("Failed to list share links for track %s: %v", trackID, err)
+		apierror.Respond(c, apierror.Internal("failed to list share links"))
+		return
+	}
+
+	links = nonNil(links)
+
+	c.JSON(http.StatusOK, ListShareLinksResponse{
+		Success: true,
+		Data:    links,
+	})
+}
+
+// RevokeShareLink handles DELETE /v1/tracks/:id/share-links/:link_id
+func (h *TracksHandler) RevokeShareLink(c *gin.Context) {
+	trackID := c.Param("id")
+	linkID := c.Param("link_id")
+	if trackID == "" || linkID == "" {
+		apierror.Respond(c, apierror.Validation("track ID and link ID are required"))
+		return
+	}
+
+	if err := h.authorizeTrackOwner(c, trackID); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	err := h.nostrTrackService.RevokeShareLink(c.Request.Context(), trackID, linkID)
+	if errors.Is(err, services.ErrShareLinkNotFound) {
+		apierror.Respond(c, err)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to revoke share link %s for track %s: %v", linkID, trackID, err)
+		apierror.Respond(c, apierror.Internal("failed to revoke share link"))
+		return
+	}
+
+	c.JSON(http.StatusOK, ShareLinkResponse{
+		Success: true,
+	})
+}
+
+// GetSharedTrack handles GET /v1/shared/:token
+// Public endpoint: the token is the credential. Each call counts as a use.
+// Revoked, expired and used-up links return 410.
+func (h *TracksHandler) GetSharedTrack(c *gin.Context) {
+	track, link, err := h.nostrTrackService.OpenShareLink(c.Request.Context(), c.Param("token"))
+	if errors.Is(err, services.ErrShareLinkNotFound) || errors.Is(err, services.ErrShareLinkGone) {
+		apierror.Respond(c, err)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to open share link: %v", err)
+		apierror.Respond(c, apierror.Internal("failed to open share link"))
+		return
+	}
+
+	streams, err := h.nostrTrackService.SignSharedStreams(c.Request.Context(), track)
+	if err != nil {
+		log.Printf("Failed to sign shared streams for track %s: %v", track.ID, err)
+		apierror.Respond(c, apierror.Internal("failed to prepare shared track"))
+		return
+	}
+
+	shared := &SharedTrack{
+		Track:     publicTrack(track),
+		Streams:   streams,
+		ExpiresAt: link.ExpiresAt,
+	}
+	if link.MaxUses > 0 {
+		usesLeft := link.MaxUses - link.Uses
+		shared.UsesLeft = &usesLeft
+	}
+
+	// Signed URLs are short-lived and the response counts against max_uses
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, SharedTrackResponse{
+		Success: true,
+		Data:    shared,
+	})
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+func (suite *TracksHandlerTestSuite) TestCreateShareLink_Defaults() {
+	link := &models.ShareLink{ID: "link-1", TrackID: "track-123", Token: "track-123.secret", Status: models.ShareLinkStatusActive}
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(suite.ownedTrack(), nil)
+	suite.nostrTrackService.On("CreateShareLink", mock.Anything, "track-123", services.DefaultShareLinkTTL, 0).Return(link, nil)
+
+	w, response := suite.request("POST", "/v1/tracks/track-123/share-links", nil)
+
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+	data := response["data"].(map[string]interface{})
+	assert.Equal(suite.T(), "track-123.secret", data["token"])
+	assert.NotContains(suite.T(), data, "token_hash")
+}
+
+func (suite *TracksHandlerTestSuite) TestCreateShareLink_WithLimits() {
+	link := &models.ShareLink{ID: "link-1", TrackID: "track-123", MaxUses: 3}
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(suite.ownedTrack(), nil)
+	suite.nostrTrackService.On("CreateShareLink", mock.Anything, "track-123", time.Hour, 3).Return(link, nil)
+
+	w, _ := suite.request("POST", "/v1/tracks/track-123/share-links", CreateShareLinkRequest{ExpiresIn: 3600, MaxUses: 3})
+
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestCreateShareLink_ValidatesRequest() {
+	for _, req := range []CreateShareLinkRequest{
+		{ExpiresIn: -1},
+		{ExpiresIn: int(services.MaxShareLinkTTL/time.Second) + 1},
+		{MaxUses: -1},
+	} {
+		w, _ := suite.request("POST", "/v1/tracks/track-123/share-links", req)
+		assert.Equal(suite.T(), http.StatusBadRequest, w.Code, fmt.Sprintf("%+v", req))
+	}
+}
+
+func (suite *TracksHandlerTestSuite) TestCreateShareLink_NotOwner() {
+	track := suite.ownedTrack()
+	track.Pubkey = "someone-else"
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+
+	w, _ := suite.request("POST", "/v1/tracks/track-123/share-links", nil)
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestCreateShareLink_TooMany() {
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(suite.ownedTrack(), nil)
+	suite.nostrTrackService.On("CreateShareLink", mock.Anything, "track-123", services.DefaultShareLinkTTL, 0).Return(nil, services.ErrTooManyShareLinks)
+
+	w, _ := suite.request("POST", "/v1/tracks/track-123/share-links", nil)
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestListShareLinks() {
+	links := []models.ShareLink{
+		{ID: "link-2", Status: models.ShareLinkStatusActive},
+		{ID: "link-1", Status: models.ShareLinkStatusRevoked},
+	}
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(suite.ownedTrack(), nil)
+	suite.nostrTrackService.On("ListShareLinks", mock.Anything, "track-123").Return(links, nil)
+
+	w, response := suite.request("GET", "/v1/tracks/track-123/share-links", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	data := response["data"].([]interface{})
+	assert.Len(suite.T(), data, 2)
+	assert.Equal(suite.T(), "revoked", data[1].(map[string]interface{})["status"])
+}
+
+func (suite *TracksHandlerTestSuite) TestRevokeShareLink() {
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(suite.ownedTrack(), nil)
+	suite.nostrTrackService.On("RevokeShareLink", mock.Anything, "track-123", "link-1").Return(nil)
+	suite.nostrTrackService.On("RevokeShareLink", mock.Anything, "track-123", "missing").Return(services.ErrShareLinkNotFound)
+
+	w, _ := suite.request("DELETE", "/v1/tracks/track-123/share-links/link-1", nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	w, _ = suite.request("DELETE", "/v1/tracks/track-123/share-links/missing", nil)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestGetSharedTrack() {
+	track := suite.ownedTrack()
+	track.Title = "Unreleased Demo"
+	link := &models.ShareLink{ID: "link-1", ExpiresAt: time.Now().Add(time.Hour), MaxUses: 3, Uses: 1}
+	streams := []models.SharedStream{{VersionID: "default-128k-mp3", Format: "mp3", Bitrate: 128, URL: "https://signed.example.com/stream"}}
+	suite.nostrTrackService.On("OpenShareLink", mock.Anything, "track-123.secret").Return(track, link, nil)
+	suite.nostrTrackService.On("SignSharedStreams", mock.Anything, track).Return(streams, nil)
+
+	w, response := suite.request("GET", "/v1/shared/track-123.secret", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "no-store", w.Header().Get("Cache-Control"))
+	data := response["data"].(map[string]interface{})
+	assert.Equal(suite.T(), float64(2), data["uses_left"])
+	shared := data["track"].(map[string]interface{})
+	assert.Equal(suite.T(), "Unreleased Demo", shared["title"])
+	assert.Empty(suite.T(), shared["firebase_uid"])
+	assert.Empty(suite.T(), shared["pubkey"])
+	stream := data["streams"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(suite.T(), "https://signed.example.com/stream", stream["url"])
+}
+
+func (suite *TracksHandlerTestSuite) TestGetSharedTrack_Errors() {
+	suite.nostrTrackService.On("OpenShareLink", mock.Anything, "unknown").Return(nil, nil, services.ErrShareLinkNotFound)
+	suite.nostrTrackService.On("OpenShareLink", mock.Anything, "expired").Return(nil, nil, services.ErrShareLinkGone.WithMessage(services.ErrShareLinkGone.Message+": link is expired"))
+	suite.nostrTrackService.On("OpenShareLink", mock.Anything, "broken").Return(nil, nil, errors.New("firestore unavailable"))
+
+	w, _ := suite.request("GET", "/v1/shared/unknown", nil)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+
+	w, response := suite.request("GET", "/v1/shared/expired", nil)
+	assert.Equal(suite.T(), http.StatusGone, w.Code)
+	assert.Contains(suite.T(), errorMessage(response), "expired")
+
+	w, _ = suite.request("GET", "/v1/shared/broken", nil)
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+const (
+	// MaxTrackEventStreamsPerPubkey caps concurrent event streams per pubkey
+	MaxTrackEventStreamsPerPubkey = 5
+
+	// trackEventHeartbeat is how often a stream sends a keep-alive comment and
+	// re-reads the track to catch changes made on other instances
+	trackEventHeartbeat = 15 * time.Second
+
+	// trackEventIdleTimeout closes a stream that has sent no event for this
+	// long; clients reconnect with Last-Event-ID
+	trackEventIdleTimeout = 10 * time.Minute
+
+	// trackEventRetry is the reconnect delay suggested to clients, in ms
+	trackEventRetry = 5000
+)
+
+// streamLimiter counts open streams per key
+type streamLimiter struct {
+	mu    sync.Mutex
+	max   int
+	count map[string]int
+}
+
+func newStreamLimiter(max int) *streamLimiter {
+	return &streamLimiter{max: max, count: make(map[string]int)}
+}
+
+// acquire reserves a stream for key, returning false when key is at the limit
+func (l *streamLimiter) acquire(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.count[key] >= l.max {
+		return false
+	}
+	l.count[key]++
+	return true
+}
+
+func (l *streamLimiter) release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.count[key]--; l.count[key] <= 0 {
+		delete(l.count, key)
+	}
+}
+
+// StreamTrackEvents handles GET /v1/tracks/:id/events
+// Streams status, progress and version events for one of the caller's tracks
+// as Server-Sent Events until the track reaches a terminal status, the stream
+// is idle too long, or the client disconnects. A reconnect gets the current
+// status and the latest progress it hasn't seen, going by Last-Event-ID.
+func (h *TracksHandler) StreamTrackEvents(c *gin.Context) {
+	trackID := c.Param("id")
+	if trackID == "" {
+		apierror.Respond(c, apierror.Validation("track ID is required"))
+		return
+	}
+
+	track, err := h.nostrTrackService.GetTrack(c.Request.Context(), trackID)
+	if err != nil {
+		apierror.Respond(c, apierror.NotFound("track not found"))
+		return
+	}
+
+	pubkey, exists := c.Get("pubkey")
+	if !exists {
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	pubkeyStr, ok := pubkey.(string)
+	if !ok || track.Pubkey != pubkeyStr {
+		apierror.Respond(c, apierror.Forbidden("not authorized to view this track"))
+		return
+	}
+
+	if !h.eventStreams.acquire(pubkeyStr) {
+		apierror.Respond(c, apierror.New(http.StatusTooManyRequests, apierror.CodeRateLimited, "too many open event streams"))
+		return
+	}
+	defer h.eventStreams.release(pubkeyStr)
+
+	// Subscribe before sending the current state so no change is missed
+	hub := h.nostrTrackService.Events()
+	events, unsubscribe := hub.Subscribe(trackID)
+	defer unsubscribe()
+
+	var replay *models.TrackEvent
+	if progress, ok := hub.LatestProgress(trackID); ok && progress.ID > lastEventID(c) {
+		replay = &progress
+	}
+
+	reload := func() (*models.NostrTrack, error) {
+		return h.nostrTrackService.GetTrack(c.Request.Context(), trackID)
+	}
+	streamTrackEvents(c, track, events, reload, trackEventStreamOptions{
+		replay:      replay,
+		heartbeat:   trackEventHeartbeat,
+		idleTimeout: trackEventIdleTimeout,
+	})
+}
+
+// lastEventID returns the Last-Event-ID a reconnecting client sent, or zero.
+// IDs are per instance, so one from another instance may be skipped or
+// replayed; either way the current status is sent.
+func lastEventID(c *gin.Context) uint64 {
+	id, err := strconv.ParseUint(c.GetHeader("Last-Event-ID"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// trackEventStreamOptions configure streamTrackEvents
+type trackEventStreamOptions struct {
+	replay      *models.TrackEvent // Sent after the current status, if set
+	heartbeat   time.Duration
+	idleTimeout time.Duration
+}
+
+// streamTrackEvents writes the SSE stream. The track's current state is sent
+// first; each heartbeat re-reads the track and sends its status if it changed.
+func streamTrackEvents(c *gin.Context, track *models.NostrTrack, events <-chan models.TrackEvent, reload func() (*models.NostrTrack, error), opts trackEventStreamOptions) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Disable proxy buffering
+	c.Status(http.StatusOK)
+
+	if _, err := fmt.Fprintf(c.Writer, "retry: %d\n\n", trackEventRetry); err != nil {
+		return
+	}
+
+	lastStatus, lastError := track.Status, track.Error
+	if !writeTrackEvent(c, statusEvent(track)) || services.IsTerminalTrackStatus(lastStatus) {
+		return
+	}
+
+	// Events already sent, by hub ID; the replayed one may also be queued
+	var sent uint64
+	if opts.replay != nil {
+		if !writeTrackEvent(c, *opts.replay) {
+			return
+		}
+		sent = opts.replay.ID
+	}
+
+	ticker := time.NewTicker(opts.heartbeat)
+	defer ticker.Stop()
+	idle := time.NewTimer(opts.idleTimeout)
+	defer idle.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+
+		case <-idle.C:
+			_, _ = fmt.Fprint(c.Writer, ": idle timeout\n\n") // #nosec G104 -- The stream ends either way
+			c.Writer.Flush()
+			return
+
+		case event := <-events:
+			if event.ID != 0 && event.ID <= sent {
+				continue
+			}
+			if !writeTrackEvent(c, event) {
+				return
+			}
+			sent = event.ID
+			idle.Reset(opts.idleTimeout)
+			if event.Type == models.TrackEventStatus {
+				lastStatus, lastError = event.Status, event.Error
+				if services.IsTerminalTrackStatus(event.Status) {
+					return
+				}
+			}
+
+		case <-ticker.C:
+			if _, err := fmt.Fprint(c.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+
+			current, err := reload()
+			if err != nil {
+				log.Printf("Failed to reload track %s for event stream: %v", track.ID, err)
+				continue
+			}
+			if current.Status == lastStatus && current.Error == lastError {
+				continue
+			}
+			if !writeTrackEvent(c, statusEvent(current)) {
+				return
+			}
+			idle.Reset(opts.idleTimeout)
+			lastStatus, lastError = current.Status, current.Error
+			if services.IsTerminalTrackStatus(lastStatus) {
+				return
+			}
+		}
+	}
+}
+
+// statusEvent describes a track's current status
+func statusEvent(track *models.NostrTrack) models.TrackEvent {
+	return models.TrackEvent{
+		Type:    models.TrackEventStatus,
+		TrackID: track.ID,
+		Status:  track.Status,
+		Error:   track.Error,
+		At:      time.Now(),
+	}
+}
+
+// writeTrackEvent writes one SSE message and flushes it, returning false once
+// the client has gone away. Events from the hub carry their ID.
+func writeTrackEvent(c *gin.Context, event models.TrackEvent) bool {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to encode %s event for track %s: %v", event.Type, event.TrackID, err)
+		return true
+	}
+	id := ""
+	if event.ID != 0 {
+		id = fmt.Sprintf("id: %d\n", event.ID)
+	}
+	if _, err := fmt.Fprintf(c.Writer, "%sevent: %s\ndata: %s\n\n", id, event.Type, data); err != nil {
+		return false
+	}
+	c.Writer.Flush()
+	return true
+}
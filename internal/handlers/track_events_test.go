@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/models"
+)
+
+// runStream drives streamTrackEvents on a recorder until it returns or the test times out
+func runStream(t *testing.T, ctx context.Context, track *models.NostrTrack, events <-chan models.TrackEvent, reload func() (*models.NostrTrack, error), heartbeat time.Duration) string {
+	t.Helper()
+	return runStreamWith(t, ctx, track, events, reload, trackEventStreamOptions{heartbeat: heartbeat, idleTimeout: time.Hour})
+}
+
+// runStreamWith is runStream with every stream option
+func runStreamWith(t *testing.T, ctx context.Context, track *models.NostrTrack, events <-chan models.TrackEvent, reload func() (*models.NostrTrack, error), opts trackEventStreamOptions) string {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/v1/tracks/"+track.ID+"/events", nil).WithContext(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		streamTrackEvents(c, track, events, reload, opts)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream did not end")
+	}
+
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	return w.Body.String()
+}
+
+func TestStreamTrackEventsEndsOnTerminalStatus(t *testing.T) {
+	track := &models.NostrTrack{ID: "track-1", Status: models.TrackStatusUploaded}
+	events := make(chan models.TrackEvent, 3)
+	events <- models.TrackEvent{Type: models.TrackEventProgress, TrackID: "track-1", Stage: models.ProcessingStageCompressing}
+	events <- models.TrackEvent{Type: models.TrackEventVersion, TrackID: "track-1", Version: &models.CompressionVersion{ID: "v1"}}
+	events <- models.TrackEvent{Type: models.TrackEventStatus, TrackID: "track-1", Status: models.TrackStatusReady}
+
+	body := runStream(t, context.Background(), track, events, nil, time.Hour)
+
+	messages := strings.Split(strings.TrimSpace(body), "\n\n")
+	require.Len(t, messages, 5)
+	assert.Equal(t, "retry: 5000", messages[0])
+	assert.True(t, strings.HasPrefix(messages[1], "event: status\ndata: "))
+	assert.Contains(t, messages[1], `"status":"uploaded"`)
+	assert.Contains(t, messages[2], `"stage":"compressing"`)
+	assert.True(t, strings.HasPrefix(messages[3], "event: version\n"))
+	assert.Contains(t, messages[4], `"status":"ready"`)
+}
+
+func TestStreamTrackEventsReplaysLatestProgress(t *testing.T) {
+	track := &models.NostrTrack{ID: "track-1", Status: models.TrackStatusProcessing}
+	replay := models.TrackEvent{ID: 7, Type: models.TrackEventProgress, TrackID: "track-1", Stage: models.ProcessingStageDownloading, Percent: 40}
+	events := make(chan models.TrackEvent, 3)
+	// The replayed event may also be waiting in the subscription
+	events <- replay
+	events <- models.TrackEvent{ID: 8, Type: models.TrackEventProgress, TrackID: "track-1", Stage: models.ProcessingStageDownloading, Percent: 50}
+	events <- models.TrackEvent{ID: 9, Type: models.TrackEventStatus, TrackID: "track-1", Status: models.TrackStatusReady}
+
+	body := runStreamWith(t, context.Background(), track, events, nil, trackEventStreamOptions{
+		replay: &replay, heartbeat: time.Hour, idleTimeout: time.Hour,
+	})
+
+	messages := strings.Split(strings.TrimSpace(body), "\n\n")
+	require.Len(t, messages, 5)
+	assert.True(t, strings.HasPrefix(messages[1], "event: status\n"), "the current status has no id")
+	assert.True(t, strings.HasPrefix(messages[2], "id: 7\nevent: progress\n"))
+	assert.Contains(t, messages[2], `"percent":40`)
+	assert.True(t, strings.HasPrefix(messages[3], "id: 8\n"))
+	assert.True(t, strings.HasPrefix(messages[4], "id: 9\nevent: status\n"))
+}
+
+func TestStreamTrackEventsIdleTimeout(t *testing.T) {
+	track := &models.NostrTrack{ID: "track-1", Status: models.TrackStatusProcessing}
+	events := make(chan models.TrackEvent, 1)
+	events <- models.TrackEvent{ID: 1, Type: models.TrackEventProgress, TrackID: "track-1", Stage: models.ProcessingStageCompressing}
+
+	body := runStreamWith(t, context.Background(), track, events, nil, trackEventStreamOptions{
+		heartbeat: time.Hour, idleTimeout: 20 * time.Millisecond,
+	})
+
+	assert.Contains(t, body, `"stage":"compressing"`)
+	assert.True(t, strings.HasSuffix(body, ": idle timeout\n\n"))
+}
+
+func TestLastEventID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for header, want := range map[string]uint64{"": 0, "12": 12, "abc": 0, "-3": 0} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/v1/tracks/track-1/events", nil)
+		if header != "" {
+			c.Request.Header.Set("Last-Event-ID", header)
+		}
+		assert.Equal(t, want, lastEventID(c), header)
+	}
+}
+
+func TestStreamTrackEventsTerminalTrackSendsStateOnly(t *testing.T) {
+	track := &models.NostrTrack{ID: "track-1", Status: models.TrackStatusFailed, Error: "invalid audio file"}
+
+	body := runStream(t, context.Background(), track, make(chan models.TrackEvent), nil, time.Hour)
+
+	assert.Equal(t, 1, strings.Count(body, "event: "))
+	assert.Contains(t, body, `"error":"invalid audio file"`)
+}
+
+func TestStreamTrackEventsHeartbeatCatchesRemoteChanges(t *testing.T) {
+	track := &models.NostrTrack{ID: "track-1", Status: models.TrackStatusProcessing}
+	reloads := 0
+	reload := func() (*models.NostrTrack, error) {
+		reloads++
+		if reloads < 2 {
+			return track, nil
+		}
+		// Another instance finished processing
+		return &models.NostrTrack{ID: "track-1", Status: models.TrackStatusReady}, nil
+	}
+
+	body := runStream(t, context.Background(), track, make(chan models.TrackEvent), reload, 10*time.Millisecond)
+
+	assert.GreaterOrEqual(t, strings.Count(body, ": heartbeat\n\n"), 2)
+	assert.Equal(t, 2, strings.Count(body, "event: status"))
+	assert.Contains(t, body, `"status":"ready"`)
+}
+
+func TestStreamTrackEventsStopsOnDisconnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	track := &models.NostrTrack{ID: "track-1", Status: models.TrackStatusPendingUpload}
+
+	time.AfterFunc(20*time.Millisecond, cancel)
+	body := runStream(t, ctx, track, make(chan models.TrackEvent), nil, time.Hour)
+
+	assert.Equal(t, 1, strings.Count(body, "event: "))
+}
+
+func TestStreamLimiter(t *testing.T) {
+	limiter := newStreamLimiter(2)
+
+	assert.True(t, limiter.acquire("pk"))
+	assert.True(t, limiter.acquire("pk"))
+	assert.False(t, limiter.acquire("pk"))
+	assert.True(t, limiter.acquire("other"))
+
+	limiter.release("pk")
+	assert.True(t, limiter.acquire("pk"))
+
+	limiter.release("pk")
+	limiter.release("pk")
+	limiter.release("other")
+	assert.Empty(t, limiter.count)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+// GetTrackHistoryResponse represents a page of a track's processing history
+type GetTrackHistoryResponse struct {
+	Success    bool                       `json:"success"`
+	Data       []models.ProcessingAttempt `json:"data"`
+	NextCursor string                     `json:"next_cursor,omitempty"`
+}
+
+// GetTrackHistory handles GET /v1/tracks/:id/history
+// Returns the owner's processing attempts for a track, newest first.
+// Supports ?limit= and ?cursor= (from next_cursor).
+func (h *TracksHandler) GetTrackHistory(c *gin.Context) {
+	trackID := c.Param("id")
+	if trackID == "" {
+		apierror.Respond(c, apierror.Validation("track ID is required"))
+		return
+	}
+
+	limit := services.DefaultHistoryPageSize
+	if limitParam := c.Query("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed <= 0 {
+			apierror.Respond(c, apierror.Validation("limit must be a positive integer"))
+			return
+		}
+		limit = parsed
+	}
+
+	track, err := h.nostrTrackService.GetTrack(c.Request.Context(), trackID)
+	if err != nil {
+		apierror.Respond(c, apierror.NotFound("track not found"))
+		return
+	}
+
+	pubkey, exists := c.Get("pubkey")
+	if !exists {
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	pubkeyStr, ok := pubkey.(string)
+	if !ok || track.Pubkey != pubkeyStr {
+		apierror.Respond(c, apierror.Forbidden("not authorized to view this track history"))
+		return
+	}
+
+	attempts, nextCursor, err := h.nostrTrackService.ListProcessingHistory(c.Request.Context(), trackID, limit, c.Query("cursor"))
+	if errors.Is(err, services.ErrInvalidHistoryCursor) {
+		apierror.Respond(c, apierror.Validation("invalid cursor"))
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to list processing history for track %s: %v", trackID, err)
+		apierror.Respond(c, apierror.Internal("failed to retrieve track history"))
+		return
+	}
+
+	attempts = nonNil(attempts)
+
+	c.JSON(http.StatusOK, GetTrackHistoryResponse{
+		Success:    true,
+		Data:       attempts,
+		NextCursor: nextCursor,
+	})
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/services"
+)
+
+const (
+	maxImportMetadataKeys   = 20
+	maxImportMetadataLength = 1024
+)
+
+type TrackImportHandler struct {
+	importService *services.TrackImportService
+}
+
+// NewTrackImportHandler creates a new track import handler
+func NewTrackImportHandler(importService *services.TrackImportService) *TrackImportHandler {
+	return &TrackImportHandler{
+		importService: importService,
+	}
+}
+
+// ImportTrackRequest represents a request to import a track from an external URL
+type ImportTrackRequest struct {
+	SourceURL string            `json:"source_url" binding:"required"`
+	Extension string            `json:"extension,omitempty"`
+	Region    string            `json:"region,omitempty"` // Optional storage region hint
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+// ImportTrack handles POST /v1/tracks/import
+// The track is created immediately and returned with 202 while the source file
+// downloads; progress is visible through the normal track status endpoints.
+func (h *TrackImportHandler) ImportTrack(c *gin.Context) {
+	var req ImportTrackRequest
+	if err := bindJSON(c, &req); err != nil {
+		apierror.Respond(c, bindError(err, "source_url field is required"))
+		return
+	}
+
+	if len(req.Metadata) > maxImportMetadataKeys {
+		apierror.Respond(c, apierror.Validation("too many metadata fields"))
+		return
+	}
+	for key, value := range req.Metadata {
+		if len(key) > maxImportMetadataLength || len(value) > maxImportMetadataLength {
+			apierror.Respond(c, apierror.Validation("metadata fields are too long"))
+			return
+		}
+	}
+
+	pubkey := c.GetString("pubkey")
+	if pubkey == "" {
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	firebaseUID := c.GetString("firebase_uid")
+	if firebaseUID == "" {
+		apierror.Respond(c, apierror.Unauthorized("user account not found"))
+		return
+	}
+
+	sourceURL, extension, err := h.importService.ValidateSourceURL(req.SourceURL, req.Extension)
+	if err != nil {
+		if errors.Is(err, services.ErrImportHostNotAllowed) {
+			apierror.Respond(c, apierror.Forbidden(err.Error()))
+			return
+		}
+		apierror.Respond(c, apierror.Validation(err.Error()))
+		return
+	}
+
+	region, err := h.importService.ChooseRegion(req.Region, c.GetHeader(clientCountryHeader))
+	if err != nil {
+		apierror.Respond(c, apierror.Validation("unknown storage region"))
+		return
+	}
+
+	track, err := h.importService.ImportTrack(c.Request.Context(), pubkey, firebaseUID, sourceURL, extension, region, req.Metadata)
+	if respondQuotaExceeded(c, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to import track: %v", err)
+		apierror.Respond(c, apierror.Internal("failed to import track"))
+		return
+	}
+
+	c.JSON(http.StatusAccepted, CreateTrackResponse{
+		Success: true,
+		Data:    track,
+		Message: "import started",
+	})
+}
@@ -1,97 +1,109 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
-	"os"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	gonostr "github.com/nbd-wtf/go-nostr"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/logging"
 	"github.com/wavlake/api/internal/models"
 	"github.com/wavlake/api/internal/services"
 	"github.com/wavlake/api/internal/utils"
 )
 
 type TracksHandler struct {
-	nostrTrackService *services.NostrTrackService
-	processingService *services.ProcessingService
-	audioProcessor    *utils.AudioProcessor
+	nostrTrackService   services.NostrTrackServiceInterface
+	processingService   services.ProcessingServiceInterface
+	audioProcessor      services.AudioProcessorInterface
+	notificationService services.NotificationServiceInterface
+	webhookGuard        *webhookReplayGuard
+	webhookVerifier     *webhookVerifier
+	eventStreams        *streamLimiter
 }
 
-func NewTracksHandler(nostrTrackService *services.NostrTrackService, processingService *services.ProcessingService, audioProcessor *utils.AudioProcessor) *TracksHandler {
+// NewTracksHandler returns the tracks handler. Processing webhooks must be
+// signed with webhookSecret, if set; acceptLegacyWebhookSecret also accepts
+// the raw secret in X-Webhook-Secret.
+func NewTracksHandler(nostrTrackService services.NostrTrackServiceInterface, processingService services.ProcessingServiceInterface, audioProcessor services.AudioProcessorInterface, notificationService services.NotificationServiceInterface, webhookSecret string, acceptLegacyWebhookSecret bool) *TracksHandler {
 	return &TracksHandler{
-		nostrTrackService: nostrTrackService,
-		processingService: processingService,
-		audioProcessor:    audioProcessor,
+		nostrTrackService:   nostrTrackService,
+		processingService:   processingService,
+		audioProcessor:      audioProcessor,
+		notificationService: notificationService,
+		webhookGuard:        newWebhookReplayGuard(DefaultWebhookMaxAge),
+		webhookVerifier:     newWebhookVerifier(webhookSecret, acceptLegacyWebhookSecret, DefaultWebhookMaxAge),
+		eventStreams:        newStreamLimiter(MaxTrackEventStreamsPerPubkey),
 	}
 }
 
 type CreateTrackRequest struct {
 	Extension string `json:"extension" binding:"required"`
+	Region    string `json:"region,omitempty"` // Optional storage region hint
+	DTag      string `json:"d_tag,omitempty"`  // Optional Nostr d tag; one is generated if unset
 }
 
+// clientCountryHeader carries the client's country code, set by the load
+// balancer as a custom request header ({client_region})
+const clientCountryHeader = "X-Client-Region"
+
 type CreateTrackResponse struct {
 	Success bool               `json:"success"`
 	Data    *models.NostrTrack `json:"data,omitempty"`
-	Error   string             `json:"error,omitempty"`
 	Message string             `json:"message,omitempty"`
 }
 
 // CreateTrackNostr creates a new track via NIP-98 authentication
 func (h *TracksHandler) CreateTrackNostr(c *gin.Context) {
 	var req CreateTrackRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, CreateTrackResponse{
-			Success: false,
-			Error:   "extension field is required",
-		})
+	if err := bindJSON(c, &req); err != nil {
+		apierror.Respond(c, bindError(err, "extension field is required"))
 		return
 	}
 
 	// Validate file extension
 	if !h.audioProcessor.IsFormatSupported(req.Extension) {
-		c.JSON(http.StatusBadRequest, CreateTrackResponse{
-			Success: false,
-			Error:   "unsupported audio format",
-		})
+		apierror.Respond(c, apierror.Validation("unsupported audio format"))
 		return
 	}
 
 	// Get authenticated user info from NIP-98 middleware context
 	pubkey, exists := c.Get("pubkey")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, CreateTrackResponse{
-			Success: false,
-			Error:   "authentication required",
-		})
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
 		return
 	}
 
 	firebaseUID, exists := c.Get("firebase_uid")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, CreateTrackResponse{
-			Success: false,
-			Error:   "user account not found",
-		})
+		apierror.Respond(c, apierror.Unauthorized("user account not found"))
 		return
 	}
 
 	pubkeyStr, ok := pubkey.(string)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, CreateTrackResponse{
-			Success: false,
-			Error:   "invalid pubkey format",
-		})
+		apierror.Respond(c, apierror.Internal("invalid pubkey format"))
 		return
 	}
 
 	firebaseUIDStr, ok := firebaseUID.(string)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, CreateTrackResponse{
-			Success: false,
-			Error:   "invalid user ID format",
-		})
+		apierror.Respond(c, apierror.Internal("invalid user ID format"))
+		return
+	}
+
+	region, err := h.nostrTrackService.ChooseRegion(req.Region, c.GetHeader(clientCountryHeader))
+	if err != nil {
+		apierror.Respond(c, apierror.Validation("unknown storage region"))
 		return
 	}
 
@@ -101,16 +113,27 @@ func (h *TracksHandler) CreateTrackNostr(c *gin.Context) {
 		pubkeyStr,
 		firebaseUIDStr,
 		strings.TrimPrefix(req.Extension, "."),
+		region,
+		req.DTag,
 	)
+	if respondQuotaExceeded(c, err) {
+		return
+	}
+	if errors.Is(err, services.ErrInvalidNostrDTag) {
+		apierror.Respond(c, err)
+		return
+	}
+	if errors.Is(err, services.ErrNostrDTagInUse) {
+		apierror.Respond(c, err)
+		return
+	}
 	if err != nil {
-		log.Printf("Failed to create track: %v", err)
-		c.JSON(http.StatusInternalServerError, CreateTrackResponse{
-			Success: false,
-			Error:   "failed to create track",
-		})
+		logging.FromContext(c.Request.Context()).Error("failed to create track", "pubkey", pubkeyStr, "error", err)
+		apierror.Respond(c, apierror.Internal("failed to create track"))
 		return
 	}
 
+	logging.FromContext(c.Request.Context()).Info("created track", "track_id", track.ID, "pubkey", pubkeyStr)
 	c.JSON(http.StatusOK, CreateTrackResponse{
 		Success: true,
 		Data:    track,
@@ -118,9 +141,9 @@ func (h *TracksHandler) CreateTrackNostr(c *gin.Context) {
 }
 
 type GetTracksResponse struct {
-	Success bool                 `json:"success"`
-	Data    []*models.NostrTrack `json:"data,omitempty"`
-	Error   string               `json:"error,omitempty"`
+	Success    bool                 `json:"success"`
+	Data       []*models.NostrTrack `json:"data"`
+	NextCursor string               `json:"next_cursor,omitempty"`
 }
 
 // GetMyTracks returns tracks for the authenticated user
@@ -128,63 +151,107 @@ func (h *TracksHandler) GetMyTracks(c *gin.Context) {
 	// Get authenticated user info from NIP-98 middleware context
 	pubkey, exists := c.Get("pubkey")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, GetTracksResponse{
-			Success: false,
-			Error:   "authentication required",
-		})
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
 		return
 	}
 
 	pubkeyStr, ok := pubkey.(string)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, GetTracksResponse{
-			Success: false,
-			Error:   "invalid pubkey format",
-		})
+		apierror.Respond(c, apierror.Internal("invalid pubkey format"))
 		return
 	}
 
+	// Optional ?is_published=true|false filter; applied after paging, so a filtered
+	// page can hold fewer than limit tracks
+	var publishedFilter *bool
+	if param := c.Query("is_published"); param != "" {
+		published, err := strconv.ParseBool(param)
+		if err != nil {
+			apierror.Respond(c, apierror.Validation("is_published must be true or false"))
+			return
+		}
+		publishedFilter = &published
+	}
+
+	// Optional ?status= filter, applied the same way
+	statusFilter := c.Query("status")
+	if statusFilter != "" && !services.IsValidTrackStatus(statusFilter) {
+		apierror.Respond(c, apierror.Validation("unknown status"))
+		return
+	}
+
+	// ?limit= or ?cursor= switch to a paginated listing; without them every
+	// track is returned as before
+	limitParam, cursor := c.Query("limit"), c.Query("cursor")
+	limit := 0
+	if limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed <= 0 {
+			apierror.Respond(c, apierror.Validation("limit must be a positive integer"))
+			return
+		}
+		limit = parsed
+	}
+
 	// Get tracks for this pubkey
-	tracks, err := h.nostrTrackService.GetTracksByPubkey(c.Request.Context(), pubkeyStr)
+	var tracks []*models.NostrTrack
+	var nextCursor string
+	var err error
+	if limitParam != "" || cursor != "" {
+		tracks, nextCursor, err = h.nostrTrackService.ListTracksByPubkey(c.Request.Context(), pubkeyStr, limit, cursor)
+	} else {
+		tracks, err = h.nostrTrackService.GetTracksByPubkey(c.Request.Context(), pubkeyStr)
+	}
+	if errors.Is(err, services.ErrInvalidTrackCursor) {
+		apierror.Respond(c, apierror.Validation("invalid cursor"))
+		return
+	}
 	if err != nil {
 		log.Printf("Failed to get tracks for pubkey %s: %v", pubkeyStr, err)
-		c.JSON(http.StatusInternalServerError, GetTracksResponse{
-			Success: false,
-			Error:   "failed to retrieve tracks",
-		})
+		apierror.Respond(c, apierror.Internal("failed to retrieve tracks"))
 		return
 	}
 
+	if publishedFilter != nil || statusFilter != "" {
+		filtered := make([]*models.NostrTrack, 0, len(tracks))
+		for _, track := range tracks {
+			if publishedFilter != nil && track.IsPublished != *publishedFilter {
+				continue
+			}
+			if statusFilter != "" && track.Status != statusFilter {
+				continue
+			}
+			filtered = append(filtered, track)
+		}
+		tracks = filtered
+	}
+
+	tracks = nonNil(tracks)
+
 	c.JSON(http.StatusOK, GetTracksResponse{
-		Success: true,
-		Data:    tracks,
+		Success:    true,
+		Data:       tracks,
+		NextCursor: nextCursor,
 	})
 }
 
 type GetTrackResponse struct {
 	Success bool               `json:"success"`
 	Data    *models.NostrTrack `json:"data,omitempty"`
-	Error   string             `json:"error,omitempty"`
 }
 
 // GetTrack returns a specific track by ID
 func (h *TracksHandler) GetTrack(c *gin.Context) {
 	trackID := c.Param("id")
 	if trackID == "" {
-		c.JSON(http.StatusBadRequest, GetTrackResponse{
-			Success: false,
-			Error:   "track ID is required",
-		})
+		apierror.Respond(c, apierror.Validation("track ID is required"))
 		return
 	}
 
 	track, err := h.nostrTrackService.GetTrack(c.Request.Context(), trackID)
 	if err != nil {
 		log.Printf("Failed to get track %s: %v", trackID, err)
-		c.JSON(http.StatusNotFound, GetTrackResponse{
-			Success: false,
-			Error:   "track not found",
-		})
+		apierror.Respond(c, err)
 		return
 	}
 
@@ -202,59 +269,105 @@ func (h *TracksHandler) GetTrack(c *gin.Context) {
 		}
 	}
 
-	// Return limited public information
-	publicTrack := &models.NostrTrack{
-		ID:            track.ID,
-		OriginalURL:   track.OriginalURL,
-		CompressedURL: track.CompressedURL,
-		Duration:      track.Duration,
-		IsProcessing:  track.IsProcessing,
-		IsCompressed:  track.IsCompressed,
-		CreatedAt:     track.CreatedAt,
+	// Deleted tracks only exist for their owner, who can restore them
+	if track.Deleted {
+		apierror.Respond(c, services.ErrTrackNotFound)
+		return
 	}
 
+	// Return limited public information
 	c.JSON(http.StatusOK, GetTrackResponse{
 		Success: true,
-		Data:    publicTrack,
+		Data:    publicTrack(track),
 	})
 }
 
-// DeleteTrack soft deletes a track
+// publicTrack is the limited view of a track shown to anyone but its owner,
+// including the compression versions the owner made public and the preview
+// clip, which is shown even when none are. The original and default
+// compressed file URLs are left out; only public versions are streamable.
+func publicTrack(track *models.NostrTrack) *models.NostrTrack {
+	public := &models.NostrTrack{
+		ID:           track.ID,
+		Duration:     track.Duration,
+		Size:         track.Size,
+		Status:       track.Status,
+		IsProcessing: track.IsProcessing,
+		IsCompressed: track.IsCompressed,
+		WaveformURL:  track.WaveformURL,
+		PreviewURL:   track.PreviewURL,
+		ArtworkURL:   track.ArtworkURL,
+		Title:        track.Title,
+		Artist:       track.Artist,
+		Album:        track.Album,
+		Genre:        track.Genre,
+		CreatedAt:    track.CreatedAt,
+	}
+	for _, version := range track.CompressionVersions {
+		if version.Available() {
+			public.CompressionVersions = append(public.CompressionVersions, version)
+		}
+	}
+	// A published track's event is public on Nostr already; its reference
+	// lets other clients resolve it
+	if track.IsPublished {
+		public.Pubkey = track.Pubkey
+		public.IsPublished = true
+		public.NostrKind = track.NostrKind
+		public.NostrDTag = track.NostrDTag
+		public.NostrEventID = track.NostrEventID
+		public.NostrRelays = track.NostrRelays
+	}
+	return public
+}
+
+// DeleteTrackResponse represents a deleted track. Data is only set when the
+// track's files were purged.
+type DeleteTrackResponse struct {
+	Success bool               `json:"success"`
+	Data    *models.TrackPurge `json:"data,omitempty"`
+}
+
+// DeleteTrack soft deletes a track. With ?purge=true its files are removed
+// from storage too, after which it can't be restored; ?dry_run=true lists the
+// files a purge would remove without deleting anything.
 func (h *TracksHandler) DeleteTrack(c *gin.Context) {
 	trackID := c.Param("id")
 	if trackID == "" {
-		c.JSON(http.StatusBadRequest, CreateTrackResponse{
-			Success: false,
-			Error:   "track ID is required",
-		})
+		apierror.Respond(c, apierror.Validation("track ID is required"))
 		return
 	}
 
 	// Get track to verify ownership
 	track, err := h.nostrTrackService.GetTrack(c.Request.Context(), trackID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, CreateTrackResponse{
-			Success: false,
-			Error:   "track not found",
-		})
+		apierror.Respond(c, err)
 		return
 	}
 
 	// Check ownership
 	pubkey, exists := c.Get("pubkey")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, CreateTrackResponse{
-			Success: false,
-			Error:   "authentication required",
-		})
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
 		return
 	}
 
 	pubkeyStr, ok := pubkey.(string)
 	if !ok || track.Pubkey != pubkeyStr {
-		c.JSON(http.StatusForbidden, CreateTrackResponse{
-			Success: false,
-			Error:   "not authorized to delete this track",
+		apierror.Respond(c, apierror.Forbidden("not authorized to delete this track"))
+		return
+	}
+
+	if c.Query("dry_run") == "true" {
+		purge, err := h.nostrTrackService.PurgeTrackFiles(c.Request.Context(), track, true)
+		if err != nil {
+			log.Printf("Failed to list files for track %s: %v", trackID, err)
+			apierror.Respond(c, apierror.Internal("failed to list track files"))
+			return
+		}
+		c.JSON(http.StatusOK, DeleteTrackResponse{
+			Success: true,
+			Data:    purge,
 		})
 		return
 	}
@@ -262,15 +375,100 @@ func (h *TracksHandler) DeleteTrack(c *gin.Context) {
 	// Delete the track
 	if err := h.nostrTrackService.DeleteTrack(c.Request.Context(), trackID); err != nil {
 		log.Printf("Failed to delete track %s: %v", trackID, err)
-		c.JSON(http.StatusInternalServerError, CreateTrackResponse{
-			Success: false,
-			Error:   "failed to delete track",
+		apierror.Respond(c, apierror.Internal("failed to delete track"))
+		return
+	}
+
+	// Stop processing still running here for the track, so it doesn't upload
+	// files nobody can see
+	h.processingService.CancelProcessing(trackID)
+
+	if c.Query("purge") != "true" {
+		c.JSON(http.StatusOK, DeleteTrackResponse{
+			Success: true,
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, CreateTrackResponse{
+	// Objects that couldn't be deleted are reported in the response rather
+	// than failing it; purging again retries them
+	purge, err := h.nostrTrackService.PurgeTrackFiles(c.Request.Context(), track, false)
+	if err != nil {
+		log.Printf("Failed to purge files for track %s: %v", trackID, err)
+		apierror.Respond(c, apierror.Internal("track was deleted but purging its files failed").WithDetails(purge))
+		return
+	}
+
+	c.JSON(http.StatusOK, DeleteTrackResponse{
+		Success: true,
+		Data:    purge,
+	})
+}
+
+// RestoreTrack undoes a soft delete of one of the caller's tracks
+func (h *TracksHandler) RestoreTrack(c *gin.Context) {
+	trackID := c.Param("id")
+	if trackID == "" {
+		apierror.Respond(c, apierror.Validation("track ID is required"))
+		return
+	}
+
+	track, err := h.nostrTrackService.GetTrack(c.Request.Context(), trackID)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	pubkey, exists := c.Get("pubkey")
+	if !exists {
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	pubkeyStr, ok := pubkey.(string)
+	if !ok || track.Pubkey != pubkeyStr {
+		apierror.Respond(c, apierror.Forbidden("not authorized to restore this track"))
+		return
+	}
+
+	if err := h.nostrTrackService.RestoreTrack(c.Request.Context(), trackID); err != nil {
+		if respondQuotaExceeded(c, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, services.ErrTrackNotDeleted):
+			apierror.Respond(c, apierror.Validation("track is not deleted"))
+		case errors.Is(err, services.ErrTrackPurged):
+			apierror.Respond(c, services.ErrTrackPurged.WithMessage("track files were purged and can't be restored"))
+		case errors.Is(err, services.ErrTrackUpdateConflict):
+			apierror.Respond(c, err)
+		default:
+			log.Printf("Failed to restore track %s: %v", trackID, err)
+			apierror.Respond(c, apierror.Internal("failed to restore track"))
+		}
+		return
+	}
+
+	// A track deleted mid-processing comes back uploaded; nothing else will
+	// trigger its processing again
+	restored, err := h.nostrTrackService.GetTrack(c.Request.Context(), trackID)
+	if err == nil && restored.CurrentStatus() == models.TrackStatusUploaded {
+		if err := h.processingService.ProcessTrackAsync(c.Request.Context(), trackID, models.ProcessingTriggerRestore); err != nil {
+			log.Printf("Failed to queue processing for restored track %s: %v", trackID, err)
+		}
+		restored, err = h.nostrTrackService.GetTrack(c.Request.Context(), trackID)
+	}
+	if err != nil {
+		log.Printf("Failed to reload restored track %s: %v", trackID, err)
+		c.JSON(http.StatusOK, GetTrackResponse{
+			Success: true,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, GetTrackResponse{
 		Success: true,
+		Data:    restored,
 	})
 }
 
@@ -278,42 +476,32 @@ func (h *TracksHandler) DeleteTrack(c *gin.Context) {
 func (h *TracksHandler) GetTrackStatus(c *gin.Context) {
 	trackID := c.Param("id")
 	if trackID == "" {
-		c.JSON(http.StatusBadRequest, GetTrackResponse{
-			Success: false,
-			Error:   "track ID is required",
-		})
+		apierror.Respond(c, apierror.Validation("track ID is required"))
 		return
 	}
 
 	track, err := h.nostrTrackService.GetTrack(c.Request.Context(), trackID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, GetTrackResponse{
-			Success: false,
-			Error:   "track not found",
-		})
+		apierror.Respond(c, err)
 		return
 	}
 
 	// Check ownership for detailed status
 	pubkey, exists := c.Get("pubkey")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, GetTrackResponse{
-			Success: false,
-			Error:   "authentication required",
-		})
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
 		return
 	}
 
 	pubkeyStr, ok := pubkey.(string)
 	if !ok || track.Pubkey != pubkeyStr {
-		c.JSON(http.StatusForbidden, GetTrackResponse{
-			Success: false,
-			Error:   "not authorized to view this track status",
-		})
+		apierror.Respond(c, apierror.Forbidden("not authorized to view this track status"))
 		return
 	}
 
-	// Return full track details including processing status
+	// Return full track details, including the status, when each status was
+	// entered and when the latest processing run started and finished
+	track.ProcessingStartedAt, track.ProcessingFinishedAt = track.ProcessingTimes()
 	c.JSON(http.StatusOK, GetTrackResponse{
 		Success: true,
 		Data:    track,
@@ -324,113 +512,196 @@ func (h *TracksHandler) GetTrackStatus(c *gin.Context) {
 func (h *TracksHandler) TriggerProcessing(c *gin.Context) {
 	trackID := c.Param("id")
 	if trackID == "" {
-		c.JSON(http.StatusBadRequest, CreateTrackResponse{
-			Success: false,
-			Error:   "track ID is required",
-		})
+		apierror.Respond(c, apierror.Validation("track ID is required"))
 		return
 	}
 
 	// Get track to verify ownership and status
 	track, err := h.nostrTrackService.GetTrack(c.Request.Context(), trackID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, CreateTrackResponse{
-			Success: false,
-			Error:   "track not found",
-		})
+		apierror.Respond(c, err)
 		return
 	}
 
 	// Check ownership
 	pubkey, exists := c.Get("pubkey")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, CreateTrackResponse{
-			Success: false,
-			Error:   "authentication required",
-		})
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
 		return
 	}
 
 	pubkeyStr, ok := pubkey.(string)
 	if !ok || track.Pubkey != pubkeyStr {
-		c.JSON(http.StatusForbidden, CreateTrackResponse{
-			Success: false,
-			Error:   "not authorized to process this track",
-		})
+		apierror.Respond(c, apierror.Forbidden("not authorized to process this track"))
 		return
 	}
 
 	// Don't re-process already processed tracks
-	if !track.IsProcessing && track.CompressedURL != "" {
-		c.JSON(http.StatusBadRequest, CreateTrackResponse{
-			Success: false,
-			Error:   "track already processed",
-		})
+	if track.Status == models.TrackStatusReady {
+		apierror.Respond(c, apierror.Validation("track already processed"))
+		return
+	}
+	if !services.CanTransitionTrack(track.Status, models.TrackStatusProcessing) {
+		apierror.Respond(c, apierror.Validation("track can't be processed while "+track.Status))
 		return
 	}
 
-	// Mark as processing and start async processing
-	updates := map[string]interface{}{
-		"is_processing": true,
+	// A manual trigger after a failed attempt is recorded as a retry
+	trigger := models.ProcessingTriggerManual
+	if track.Status == models.TrackStatusFailed {
+		trigger = models.ProcessingTriggerRetry
 	}
-	if err := h.nostrTrackService.UpdateTrack(c.Request.Context(), trackID, updates); err != nil {
-		c.JSON(http.StatusInternalServerError, CreateTrackResponse{
-			Success: false,
-			Error:   "failed to update track status",
-		})
+
+	// Claim the track and start processing; the claim clears the previous
+	// attempt's error
+	if err := h.processingService.ProcessTrackAsync(c.Request.Context(), trackID, trigger); err != nil {
+		switch {
+		case errors.Is(err, services.ErrTrackAlreadyProcessed):
+			apierror.Respond(c, apierror.Validation("track already processed"))
+		case errors.Is(err, services.ErrTrackAlreadyProcessing):
+			apierror.Respond(c, err)
+		case errors.Is(err, services.ErrTrackUpdateConflict), errors.Is(err, services.ErrInvalidStatusTransition):
+			apierror.Respond(c, services.ErrTrackUpdateConflict.WithCause(err))
+		default:
+			log.Printf("Failed to start processing for track %s: %v", trackID, err)
+			apierror.Respond(c, apierror.Internal("failed to update track status"))
+		}
 		return
 	}
 
-	// Start processing
-	h.processingService.ProcessTrackAsync(c.Request.Context(), trackID)
-
 	c.JSON(http.StatusOK, CreateTrackResponse{
 		Success: true,
 	})
 }
 
+// WebhookPayload is a processing webhook delivery, from the Cloud Function or
+// an external worker
+type WebhookPayload struct {
+	TrackID       string `json:"track_id"`
+	Status        string `json:"status"` // "uploaded", "processed", "failed", or "original_deleted"
+	Size          int64  `json:"size,omitempty"`
+	Duration      int    `json:"duration,omitempty"`
+	CompressedURL string `json:"compressed_url,omitempty"`
+	Error         string `json:"error,omitempty"`
+	Source        string `json:"source,omitempty"` // "gcs_trigger", "manual", etc.
+	Timestamp     int64  `json:"timestamp"`        // Unix seconds when the webhook was sent
+	Nonce         string `json:"nonce"`            // Random value, unique per delivery
+	// Optional; deliveries repeating a key seen in the last 24 hours are
+	// acknowledged without being handled again
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+	// Optional; with status "processed", the compression version whose file
+	// landed in storage, and size is that file's
+	VersionID string `json:"version_id,omitempty"`
+	// Optional; reports on a single compression version instead of the
+	// track, and status is then ignored
+	Version *WebhookVersionReport `json:"version,omitempty"`
+}
+
 // ProcessTrackWebhook handles file processing webhooks (e.g., from Cloud Functions)
 func (h *TracksHandler) ProcessTrackWebhook(c *gin.Context) {
-	// Optional webhook authentication
-	if expectedSecret := os.Getenv("WEBHOOK_SECRET"); expectedSecret != "" {
-		providedSecret := c.GetHeader("X-Webhook-Secret")
-		if providedSecret != expectedSecret {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"success": false,
-				"error":   "invalid webhook secret",
-			})
-			return
-		}
+	logger := logging.FromContext(c.Request.Context())
+
+	// The signature covers the raw body, so read it before binding
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		apierror.Respond(c, bindError(bodyError(err), "failed to read request body"))
+		return
 	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
 
-	type WebhookPayload struct {
-		TrackID       string `json:"track_id"`
-		Status        string `json:"status"` // "uploaded", "processed", or "failed"
-		Size          int64  `json:"size,omitempty"`
-		Duration      int    `json:"duration,omitempty"`
-		CompressedURL string `json:"compressed_url,omitempty"`
-		Error         string `json:"error,omitempty"`
-		Source        string `json:"source,omitempty"` // "gcs_trigger", "manual", etc.
+	if err := h.webhookVerifier.Verify(c.GetHeader(WebhookSignatureHeader), c.GetHeader(WebhookTimestampHeader), c.GetHeader(WebhookSecretHeader), body); err != nil {
+		code := WebhookErrorCodeSignature
+		if errors.Is(err, errWebhookExpired) {
+			code = WebhookErrorCodeExpired
+		}
+		logger.Warn("rejected unauthenticated webhook", "error", err)
+		apierror.Respond(c, apierror.Unauthorized(err.Error()).WithCode(code))
+		return
 	}
 
 	var payload WebhookPayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "invalid payload",
-		})
+	if err := bindJSON(c, &payload); err != nil {
+		apierror.Respond(c, bindError(err, "invalid payload"))
+		return
+	}
+
+	// Reject stale or replayed deliveries before touching any track state
+	if err := h.webhookGuard.Check(payload.Timestamp, payload.Nonce); err != nil {
+		code := WebhookErrorCodeExpired
+		status := http.StatusUnauthorized
+		if errors.Is(err, errWebhookReplay) {
+			code = WebhookErrorCodeReplay
+			status = http.StatusConflict
+		}
+		logger.Warn("rejected webhook", "track_id", payload.TrackID, "source", payload.Source, "error", err)
+		apierror.Respond(c, apierror.New(status, code, err.Error()))
 		return
 	}
 
 	ctx := c.Request.Context()
+	logger = logger.With("track_id", payload.TrackID, "webhook_status", payload.Status)
+
+	if payload.IdempotencyKey != "" {
+		claimed, err := h.nostrTrackService.ClaimIdempotencyKey(ctx, payload.IdempotencyKey, payload.TrackID)
+		if err != nil {
+			logger.Error("failed to claim idempotency key", "error", err)
+			apierror.Respond(c, apierror.Internal("failed to check idempotency key"))
+			return
+		}
+		if !claimed {
+			logger.Info("ignoring duplicate webhook", "source", payload.Source)
+			c.JSON(http.StatusOK, gin.H{
+				"success":   true,
+				"duplicate": true,
+			})
+			return
+		}
+
+		// Let the sender retry with the same key if this delivery fails
+		defer func() {
+			if c.Writer.Status() < http.StatusMultipleChoices {
+				return
+			}
+			if err := h.nostrTrackService.ReleaseIdempotencyKey(context.Background(), payload.IdempotencyKey); err != nil {
+				logger.Error("failed to release idempotency key", "error", err)
+			}
+		}()
+	}
+
+	if payload.Version != nil {
+		h.recordVersionReport(c, payload.TrackID, *payload.Version)
+		return
+	}
 
 	switch payload.Status {
 	case "uploaded":
 		// File was uploaded to GCS, start processing
-		log.Printf("Starting processing for uploaded track %s (source: %s)", payload.TrackID, payload.Source)
+		logger.Info("starting processing for uploaded track", "source", payload.Source)
+
+		// A track already past uploaded is left to the processing claim, which
+		// tells duplicate triggers apart from real conflicts
+		err := h.nostrTrackService.TransitionTrack(ctx, payload.TrackID, models.TrackStatusUploaded, nil)
+		if err != nil && !errors.Is(err, services.ErrInvalidStatusTransition) {
+			logger.Error("failed to mark track as uploaded", "error", err)
+			h.webhookUpdateFailed(c, err)
+			return
+		}
 
-		// Start async processing
-		h.processingService.ProcessTrackAsync(ctx, payload.TrackID)
+		// Start async processing unless another trigger already did
+		if err := h.processingService.ProcessTrackAsync(ctx, payload.TrackID, models.ProcessingTriggerWebhook); err != nil {
+			if errors.Is(err, services.ErrTrackAlreadyProcessing) || errors.Is(err, services.ErrTrackAlreadyProcessed) {
+				logger.Info("ignoring duplicate upload webhook", "reason", err)
+				c.JSON(http.StatusOK, gin.H{
+					"success":   true,
+					"message":   err.Error(),
+					"duplicate": true,
+				})
+				return
+			}
+			logger.Error("failed to start processing", "error", err)
+			h.webhookUpdateFailed(c, err)
+			return
+		}
 
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
@@ -439,49 +710,170 @@ func (h *TracksHandler) ProcessTrackWebhook(c *gin.Context) {
 		return
 
 	case "processed":
+		// The GCS trigger reports each compression version's file as it lands
+		if payload.VersionID != "" {
+			h.recordCompressedObject(c, payload.TrackID, payload.VersionID, payload.Size)
+			return
+		}
+
 		// Update track as processed
 		if err := h.nostrTrackService.MarkTrackAsProcessed(ctx, payload.TrackID, payload.Size, payload.Duration); err != nil {
-			log.Printf("Failed to mark track as processed: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"success": false,
-				"error":   "failed to update track status",
-			})
+			logger.Error("failed to mark track as processed", "error", err)
+			h.webhookUpdateFailed(c, err)
 			return
 		}
 
 		// If compressed file is available, update that too
 		if payload.CompressedURL != "" {
 			if err := h.nostrTrackService.MarkTrackAsCompressed(ctx, payload.TrackID, payload.CompressedURL); err != nil {
-				log.Printf("Failed to mark track as compressed: %v", err)
+				logger.Error("failed to mark track as compressed", "error", err)
 				// Don't fail the request for this
 			}
 		}
 
+		h.notifyTrackOwner(c, payload.TrackID, models.NotificationTypeProcessingComplete, "Your track has finished processing and is ready to stream")
+
 	case "failed":
 		// Mark track as failed processing
 		updates := map[string]interface{}{
-			"is_processing": false,
-			"error":         payload.Error,
-		}
-		if err := h.nostrTrackService.UpdateTrack(ctx, payload.TrackID, updates); err != nil {
-			log.Printf("Failed to mark track as failed: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"success": false,
-				"error":   "failed to update track status",
+			"error": payload.Error,
+		}
+		if err := h.nostrTrackService.TransitionTrack(ctx, payload.TrackID, models.TrackStatusFailed, updates); err != nil {
+			logger.Error("failed to mark track as failed", "error", err)
+			h.webhookUpdateFailed(c, err)
+			return
+		}
+
+		h.notifyTrackOwner(c, payload.TrackID, models.NotificationTypeProcessingFailed, "Processing failed for your track: "+payload.Error)
+
+	case "original_deleted":
+		// The GCS trigger saw the original go; flag the track if it's really gone
+		flagged, err := h.nostrTrackService.MarkOriginalDeleted(ctx, payload.TrackID)
+		if err != nil {
+			if errors.Is(err, services.ErrTrackNotFound) {
+				apierror.Respond(c, err)
+				return
+			}
+			logger.Error("failed to flag deleted original", "error", err)
+			h.webhookUpdateFailed(c, err)
+			return
+		}
+		if !flagged {
+			logger.Info("ignoring original deletion, the original exists or was purged")
+			c.JSON(http.StatusOK, gin.H{
+				"success": true,
+				"message": "original not flagged",
 			})
 			return
 		}
+		logger.Warn("original deleted outside the API", "source", payload.Source)
 
 	default:
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "invalid status",
-		})
+		apierror.Respond(c, apierror.Validation("invalid status"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+	})
+}
+
+// WebhookVersionReport is an external worker's report on one compression
+// version of a track
+type WebhookVersionReport struct {
+	VersionID  string `json:"version_id"`
+	URL        string `json:"url,omitempty"`
+	Format     string `json:"format,omitempty"`
+	Bitrate    int    `json:"bitrate,omitempty"`
+	SampleRate int    `json:"sample_rate,omitempty"`
+	Size       int64  `json:"size,omitempty"`
+	Status     string `json:"status"` // "pending", "processing", "completed", or "failed"
+	Error      string `json:"error,omitempty"`
+}
+
+// recordVersionReport handles a webhook carrying a version report. A failed
+// version is recorded on its own and leaves the track's other versions alone.
+func (h *TracksHandler) recordVersionReport(c *gin.Context, trackID string, report WebhookVersionReport) {
+	logger := logging.FromContext(c.Request.Context()).With("track_id", trackID, "version_id", report.VersionID, "version_status", report.Status)
+
+	version, err := h.nostrTrackService.AddOrUpdateCompressionVersion(c.Request.Context(), trackID, models.CompressionVersion{
+		ID:         report.VersionID,
+		URL:        report.URL,
+		Format:     report.Format,
+		Bitrate:    report.Bitrate,
+		SampleRate: report.SampleRate,
+		Size:       report.Size,
+		Status:     report.Status,
+		Error:      report.Error,
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidVersionReport) {
+			apierror.Respond(c, err)
+			return
+		}
+		logger.Error("failed to record compression version", "error", err)
+		h.webhookUpdateFailed(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
+		"data":    version,
+	})
+}
+
+// recordCompressedObject handles a processed webhook for one compression
+// version's file, which the GCS trigger sends when the file lands
+func (h *TracksHandler) recordCompressedObject(c *gin.Context, trackID, versionID string, size int64) {
+	logger := logging.FromContext(c.Request.Context()).With("track_id", trackID, "version_id", versionID)
+
+	version, err := h.nostrTrackService.RecordCompressedObject(c.Request.Context(), trackID, versionID, size)
+	if err != nil {
+		if errors.Is(err, services.ErrTrackNotFound) || errors.Is(err, services.ErrVersionNotFound) {
+			apierror.Respond(c, err)
+			return
+		}
+		logger.Error("failed to record compressed object", "error", err)
+		h.webhookUpdateFailed(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    version,
+	})
+}
+
+// webhookUpdateFailed responds to a webhook whose track update failed. Conflicts
+// and updates the track's status doesn't allow are reported as 409.
+func (h *TracksHandler) webhookUpdateFailed(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrTrackUpdateConflict), errors.Is(err, services.ErrInvalidStatusTransition):
+		apierror.Respond(c, err)
+	default:
+		apierror.Respond(c, apierror.Internal("failed to update track status"))
+	}
+}
+
+// notifyTrackOwner records a notification for the owner of a track. Lookup or
+// notification failures are logged and never affect the webhook response.
+func (h *TracksHandler) notifyTrackOwner(c *gin.Context, trackID, notificationType, message string) {
+	if h.notificationService == nil {
+		return
+	}
+
+	track, err := h.nostrTrackService.GetTrack(c.Request.Context(), trackID)
+	if err != nil {
+		log.Printf("Failed to load track %s for %s notification: %v", trackID, notificationType, err)
+		return
+	}
+
+	h.notificationService.Notify(models.Notification{
+		FirebaseUID: track.FirebaseUID,
+		Pubkey:      track.Pubkey,
+		TrackID:     track.ID,
+		Type:        notificationType,
+		Message:     message,
 	})
 }
 
@@ -490,33 +882,31 @@ type RequestCompressionRequest struct {
 	Compressions []models.CompressionOption `json:"compressions" binding:"required,min=1"`
 }
 
+// RequestCompressionResponse reports which requested versions were queued
+type RequestCompressionResponse struct {
+	Success bool                             `json:"success"`
+	Data    *models.CompressionRequestResult `json:"data,omitempty"`
+	Message string                           `json:"message,omitempty"`
+}
+
 // RequestCompression allows users to request specific compression versions
 func (h *TracksHandler) RequestCompression(c *gin.Context) {
 	trackID := c.Param("id")
 	if trackID == "" {
-		c.JSON(http.StatusBadRequest, CreateTrackResponse{
-			Success: false,
-			Error:   "track ID is required",
-		})
+		apierror.Respond(c, apierror.Validation("track ID is required"))
 		return
 	}
 
 	var req RequestCompressionRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, CreateTrackResponse{
-			Success: false,
-			Error:   "invalid request: " + err.Error(),
-		})
+	if err := bindJSON(c, &req); err != nil {
+		apierror.Respond(c, bindError(err, "invalid request: "+err.Error()))
 		return
 	}
 
 	// Validate compression options
 	for _, compression := range req.Compressions {
 		if err := validateCompressionOption(compression); err != nil {
-			c.JSON(http.StatusBadRequest, CreateTrackResponse{
-				Success: false,
-				Error:   "invalid compression option: " + err.Error(),
-			})
+			apierror.Respond(c, apierror.Validation("invalid compression option: "+err.Error()))
 			return
 		}
 	}
@@ -524,106 +914,94 @@ func (h *TracksHandler) RequestCompression(c *gin.Context) {
 	// Get track to verify ownership
 	track, err := h.nostrTrackService.GetTrack(c.Request.Context(), trackID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, CreateTrackResponse{
-			Success: false,
-			Error:   "track not found",
-		})
+		apierror.Respond(c, err)
 		return
 	}
 
 	// Check ownership
 	pubkey, exists := c.Get("pubkey")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, CreateTrackResponse{
-			Success: false,
-			Error:   "authentication required",
-		})
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
 		return
 	}
 
 	pubkeyStr, ok := pubkey.(string)
 	if !ok || track.Pubkey != pubkeyStr {
-		c.JSON(http.StatusForbidden, CreateTrackResponse{
-			Success: false,
-			Error:   "not authorized to modify this track",
-		})
+		apierror.Respond(c, apierror.Forbidden("not authorized to modify this track"))
 		return
 	}
 
 	// Request compression versions
-	if err := h.processingService.RequestCompressionVersions(c.Request.Context(), trackID, req.Compressions); err != nil {
-		c.JSON(http.StatusInternalServerError, CreateTrackResponse{
-			Success: false,
-			Error:   "failed to request compression: " + err.Error(),
-		})
+	result, err := h.processingService.RequestCompressionVersions(c.Request.Context(), trackID, req.Compressions)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrTooManyCompressionVersions):
+			apierror.Respond(c, err)
+		case errors.Is(err, services.ErrTrackUpdateConflict):
+			apierror.Respond(c, err)
+		default:
+			apierror.Respond(c, apierror.Internal("failed to request compression: "+err.Error()))
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, CreateTrackResponse{
+	message := "compression requested"
+	if len(result.Queued) == 0 {
+		message = "all requested versions already exist or are pending"
+	}
+	c.JSON(http.StatusOK, RequestCompressionResponse{
 		Success: true,
-		Message: "compression requested",
+		Data:    result,
+		Message: message,
 	})
 }
 
+// UpdateVisibilityRequest sets which compression versions are public
+type UpdateVisibilityRequest struct {
+	VersionUpdates []models.VersionUpdate `json:"version_updates" binding:"required,min=1"`
+}
+
 // UpdateCompressionVisibility allows users to control which versions are public
 func (h *TracksHandler) UpdateCompressionVisibility(c *gin.Context) {
 	trackID := c.Param("id")
 	if trackID == "" {
-		c.JSON(http.StatusBadRequest, CreateTrackResponse{
-			Success: false,
-			Error:   "track ID is required",
-		})
+		apierror.Respond(c, apierror.Validation("track ID is required"))
 		return
 	}
 
-	type UpdateVisibilityRequest struct {
-		VersionUpdates []models.VersionUpdate `json:"version_updates" binding:"required,min=1"`
-	}
-
 	var req UpdateVisibilityRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, CreateTrackResponse{
-			Success: false,
-			Error:   "invalid request: " + err.Error(),
-		})
+	if err := bindJSON(c, &req); err != nil {
+		apierror.Respond(c, bindError(err, "invalid request: "+err.Error()))
 		return
 	}
 
 	// Get track to verify ownership
 	track, err := h.nostrTrackService.GetTrack(c.Request.Context(), trackID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, CreateTrackResponse{
-			Success: false,
-			Error:   "track not found",
-		})
+		apierror.Respond(c, err)
 		return
 	}
 
 	// Check ownership
 	pubkey, exists := c.Get("pubkey")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, CreateTrackResponse{
-			Success: false,
-			Error:   "authentication required",
-		})
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
 		return
 	}
 
 	pubkeyStr, ok := pubkey.(string)
 	if !ok || track.Pubkey != pubkeyStr {
-		c.JSON(http.StatusForbidden, CreateTrackResponse{
-			Success: false,
-			Error:   "not authorized to modify this track",
-		})
+		apierror.Respond(c, apierror.Forbidden("not authorized to modify this track"))
 		return
 	}
 
 	// Update visibility
 	if err := h.nostrTrackService.UpdateCompressionVisibility(c.Request.Context(), trackID, req.VersionUpdates); err != nil {
-		c.JSON(http.StatusInternalServerError, CreateTrackResponse{
-			Success: false,
-			Error:   "failed to update visibility: " + err.Error(),
-		})
+		if errors.Is(err, services.ErrTrackUpdateConflict) {
+			apierror.Respond(c, err)
+			return
+		}
+		apierror.Respond(c, apierror.Internal("failed to update visibility: "+err.Error()))
 		return
 	}
 
@@ -637,46 +1015,34 @@ func (h *TracksHandler) UpdateCompressionVisibility(c *gin.Context) {
 func (h *TracksHandler) GetPublicVersions(c *gin.Context) {
 	trackID := c.Param("id")
 	if trackID == "" {
-		c.JSON(http.StatusBadRequest, CreateTrackResponse{
-			Success: false,
-			Error:   "track ID is required",
-		})
+		apierror.Respond(c, apierror.Validation("track ID is required"))
 		return
 	}
 
 	// Check ownership
 	pubkey, exists := c.Get("pubkey")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, CreateTrackResponse{
-			Success: false,
-			Error:   "authentication required",
-		})
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
 		return
 	}
 
 	// Get track to verify ownership
 	track, err := h.nostrTrackService.GetTrack(c.Request.Context(), trackID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, CreateTrackResponse{
-			Success: false,
-			Error:   "track not found",
-		})
+		apierror.Respond(c, err)
 		return
 	}
 
 	pubkeyStr, ok := pubkey.(string)
 	if !ok || track.Pubkey != pubkeyStr {
-		c.JSON(http.StatusForbidden, CreateTrackResponse{
-			Success: false,
-			Error:   "not authorized to access this track",
-		})
+		apierror.Respond(c, apierror.Forbidden("not authorized to access this track"))
 		return
 	}
 
 	// Filter for public versions
 	publicVersions := make([]models.CompressionVersion, 0)
 	for _, version := range track.CompressionVersions {
-		if version.IsPublic {
+		if version.Available() {
 			publicVersions = append(publicVersions, version)
 		}
 	}
@@ -686,22 +1052,75 @@ func (h *TracksHandler) GetPublicVersions(c *gin.Context) {
 		"data": gin.H{
 			"track_id":        trackID,
 			"original_url":    track.OriginalURL,
+			"original_hash":   track.OriginalHash,
 			"public_versions": publicVersions,
 		},
 	})
 }
 
+// GetNostrEvent returns an unsigned Nostr event for the track's public
+// versions. The owner signs and publishes it, then reports it to
+// RecordPublication.
+func (h *TracksHandler) GetNostrEvent(c *gin.Context) {
+	trackID := c.Param("id")
+	if trackID == "" {
+		apierror.Respond(c, apierror.Validation("track ID is required"))
+		return
+	}
+
+	pubkey, exists := c.Get("pubkey")
+	if !exists {
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	track, err := h.nostrTrackService.GetTrack(c.Request.Context(), trackID)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+	if track.Deleted {
+		apierror.Respond(c, services.ErrTrackNotFound)
+		return
+	}
+
+	pubkeyStr, ok := pubkey.(string)
+	if !ok || track.Pubkey != pubkeyStr {
+		apierror.Respond(c, apierror.Forbidden("not authorized to access this track"))
+		return
+	}
+
+	event, err := h.nostrTrackService.BuildNostrEventDraft(c.Request.Context(), track)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrNoPublicVersions):
+			apierror.Respond(c, err)
+		case errors.Is(err, services.ErrTrackUpdateConflict):
+			apierror.Respond(c, err)
+		default:
+			log.Printf("Failed to build Nostr event for track %s: %v", trackID, err)
+			apierror.Respond(c, apierror.Internal("failed to build nostr event"))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    event,
+	})
+}
+
 // validateCompressionOption validates user compression choices
 func validateCompressionOption(option models.CompressionOption) error {
 	// Validate format
-	validFormats := map[string]bool{"mp3": true, "aac": true, "ogg": true}
-	if !validFormats[option.Format] {
-		return fmt.Errorf("invalid format: %s (supported: mp3, aac, ogg)", option.Format)
+	format, ok := utils.CompressionFormats[option.Format]
+	if !ok {
+		return fmt.Errorf("invalid format: %s (supported: %s)", option.Format, strings.Join(supportedCompressionFormats(), ", "))
 	}
 
 	// Validate bitrate ranges
-	if option.Bitrate < 32 || option.Bitrate > 320 {
-		return fmt.Errorf("invalid bitrate: %d (range: 32-320 kbps)", option.Bitrate)
+	if option.Bitrate < format.MinBitrate || option.Bitrate > 320 {
+		return fmt.Errorf("invalid bitrate: %d (range for %s: %d-320 kbps)", option.Bitrate, option.Format, format.MinBitrate)
 	}
 
 	// Validate quality
@@ -712,11 +1131,255 @@ func validateCompressionOption(option models.CompressionOption) error {
 
 	// Validate sample rate if provided
 	if option.SampleRate != 0 {
-		validSampleRates := map[int]bool{22050: true, 44100: true, 48000: true, 96000: true}
-		if !validSampleRates[option.SampleRate] {
-			return fmt.Errorf("invalid sample rate: %d (supported: 22050, 44100, 48000, 96000)", option.SampleRate)
+		sampleRates := format.SampleRates
+		if sampleRates == nil {
+			sampleRates = []int{22050, 44100, 48000, 96000}
+		}
+		if !slices.Contains(sampleRates, option.SampleRate) {
+			return fmt.Errorf("invalid sample rate: %d (supported: %s)", option.SampleRate, joinInts(sampleRates))
 		}
 	}
 
 	return nil
 }
+
+// supportedCompressionFormats lists the compression formats in name order
+func supportedCompressionFormats() []string {
+	formats := make([]string, 0, len(utils.CompressionFormats))
+	for format := range utils.CompressionFormats {
+		formats = append(formats, format)
+	}
+	slices.Sort(formats)
+	return formats
+}
+
+// joinInts formats numbers as a comma-separated list
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = strconv.Itoa(value)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// RecordPublicationRequest reports a Nostr event the client published for a track
+type RecordPublicationRequest struct {
+	Event  *gonostr.Event `json:"event" binding:"required"`
+	Relays []string       `json:"relays"`
+}
+
+// RecordPublication records that the owner published a Nostr event for the track
+func (h *TracksHandler) RecordPublication(c *gin.Context) {
+	trackID := c.Param("id")
+	if trackID == "" {
+		apierror.Respond(c, apierror.Validation("track ID is required"))
+		return
+	}
+
+	var req RecordPublicationRequest
+	if err := bindJSON(c, &req); err != nil {
+		apierror.Respond(c, bindError(err, "signed event is required"))
+		return
+	}
+
+	track, err := h.nostrTrackService.GetTrack(c.Request.Context(), trackID)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	pubkey, exists := c.Get("pubkey")
+	if !exists {
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	pubkeyStr, ok := pubkey.(string)
+	if !ok || track.Pubkey != pubkeyStr {
+		apierror.Respond(c, apierror.Forbidden("not authorized to modify this track"))
+		return
+	}
+
+	if err := services.ValidatePublication(track, req.Event, req.Relays); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	updated, err := h.nostrTrackService.RecordPublication(c.Request.Context(), trackID, req.Event, req.Relays)
+	if err != nil {
+		log.Printf("Failed to record publication for track %s: %v", trackID, err)
+		if errors.Is(err, services.ErrTrackUpdateConflict) {
+			apierror.Respond(c, err)
+			return
+		}
+		apierror.Respond(c, apierror.Internal("failed to record publication"))
+		return
+	}
+
+	c.JSON(http.StatusOK, GetTrackResponse{
+		Success: true,
+		Data:    updated,
+	})
+}
+
+// UpdateNostrRefRequest records the event a client published for a track
+type UpdateNostrRefRequest struct {
+	EventID   string   `json:"event_id" binding:"required"`
+	Kind      int      `json:"kind" binding:"required"`
+	DTag      string   `json:"d_tag"`
+	RelayURLs []string `json:"relay_urls"`
+}
+
+// UpdateNostrRef handles PUT /v1/tracks/:id/nostr-ref
+// Records the event ID, kind, d tag and relays of an event the owner
+// published, for clients that don't send the signed event
+func (h *TracksHandler) UpdateNostrRef(c *gin.Context) {
+	trackID := c.Param("id")
+	if trackID == "" {
+		apierror.Respond(c, apierror.Validation("track ID is required"))
+		return
+	}
+
+	var req UpdateNostrRefRequest
+	if err := bindJSON(c, &req); err != nil {
+		apierror.Respond(c, bindError(err, "event_id and kind are required"))
+		return
+	}
+
+	track, err := h.nostrTrackService.GetTrack(c.Request.Context(), trackID)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	pubkey, exists := c.Get("pubkey")
+	if !exists {
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	pubkeyStr, ok := pubkey.(string)
+	if !ok || track.Pubkey != pubkeyStr {
+		apierror.Respond(c, apierror.Forbidden("not authorized to modify this track"))
+		return
+	}
+
+	updated, err := h.nostrTrackService.SetNostrRef(c.Request.Context(), trackID, services.NostrRef{
+		EventID: req.EventID,
+		Kind:    req.Kind,
+		DTag:    req.DTag,
+		Relays:  req.RelayURLs,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidNostrEventID),
+			errors.Is(err, services.ErrInvalidNostrKind),
+			errors.Is(err, services.ErrInvalidNostrDTag),
+			errors.Is(err, services.ErrPublicationInvalidRelayList):
+			apierror.Respond(c, err)
+		case errors.Is(err, services.ErrNostrDTagInUse):
+			apierror.Respond(c, err)
+		case errors.Is(err, services.ErrTrackUpdateConflict):
+			apierror.Respond(c, err)
+		default:
+			log.Printf("Failed to record Nostr reference for track %s: %v", trackID, err)
+			apierror.Respond(c, apierror.Internal("failed to record Nostr reference"))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, GetTrackResponse{
+		Success: true,
+		Data:    updated,
+	})
+}
+
+// PublishTrackRequest carries a signed Nostr event for the server to publish
+type PublishTrackRequest struct {
+	Event *gonostr.Event `json:"event" binding:"required"`
+}
+
+// PublishTrackResponse is the track after publishing and each relay's answer
+type PublishTrackResponse struct {
+	Success bool                        `json:"success"`
+	Data    *models.NostrTrack          `json:"data,omitempty"`
+	Relays  []models.RelayPublishResult `json:"relays,omitempty"`
+}
+
+// RelayPublicationDetails are the error details of a publish the relays or the
+// track update failed: what each relay said, and the track if it was updated
+type RelayPublicationDetails struct {
+	Track  *models.NostrTrack          `json:"track,omitempty"`
+	Relays []models.RelayPublishResult `json:"relays"`
+}
+
+// PublishTrack handles POST /v1/tracks/:id/publish
+// Publishes an event the owner signed to the configured relays, for clients
+// that couldn't publish it themselves. Each relay's answer is returned and
+// stored; the request fails with 502 only if no relay accepted the event.
+func (h *TracksHandler) PublishTrack(c *gin.Context) {
+	trackID := c.Param("id")
+	if trackID == "" {
+		apierror.Respond(c, apierror.Validation("track ID is required"))
+		return
+	}
+
+	var req PublishTrackRequest
+	if err := bindJSON(c, &req); err != nil {
+		apierror.Respond(c, bindError(err, "signed event is required"))
+		return
+	}
+
+	track, err := h.nostrTrackService.GetTrack(c.Request.Context(), trackID)
+	if err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	pubkey, exists := c.Get("pubkey")
+	if !exists {
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	pubkeyStr, ok := pubkey.(string)
+	if !ok || track.Pubkey != pubkeyStr {
+		apierror.Respond(c, apierror.Forbidden("not authorized to modify this track"))
+		return
+	}
+
+	if err := services.ValidateRelayPublication(track, req.Event); err != nil {
+		apierror.Respond(c, err)
+		return
+	}
+
+	// Relays may take a while; finish and record what they said even if the
+	// client gives up waiting
+	ctx := context.WithoutCancel(c.Request.Context())
+	updated, results, err := h.nostrTrackService.PublishToRelays(ctx, trackID, req.Event)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrRelayPublishingDisabled):
+			apierror.Respond(c, err)
+		case errors.Is(err, services.ErrTrackUpdateConflict):
+			apierror.Respond(c, services.ErrTrackUpdateConflict.WithDetails(RelayPublicationDetails{Relays: results}))
+		default:
+			log.Printf("Failed to record relay publication for track %s: %v", trackID, err)
+			apierror.Respond(c, apierror.Internal("failed to record publication").WithDetails(RelayPublicationDetails{Relays: results}))
+		}
+		return
+	}
+
+	for _, result := range results {
+		if result.Accepted {
+			c.JSON(http.StatusOK, PublishTrackResponse{
+				Success: true,
+				Data:    updated,
+				Relays:  results,
+			})
+			return
+		}
+	}
+	apierror.Respond(c, apierror.New(http.StatusBadGateway, "track.relays_rejected", "no relay accepted the event").
+		WithDetails(RelayPublicationDetails{Track: updated, Relays: results}))
+}
@@ -0,0 +1,1635 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	gonostr "github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/wavlake/api/internal/bodylimit"
+	"github.com/wavlake/api/internal/mocks"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+const (
+	testOwnerPubkey = "owner-pubkey"
+	testOtherPubkey = "other-pubkey"
+)
+
+// errorMessage and errorCode read the error of an apierror response body
+func errorMessage(response map[string]interface{}) interface{} {
+	errorField, _ := response["error"].(map[string]interface{})
+	return errorField["message"]
+}
+
+func errorCode(response map[string]interface{}) interface{} {
+	errorField, _ := response["error"].(map[string]interface{})
+	return errorField["code"]
+}
+
+type TracksHandlerTestSuite struct {
+	suite.Suite
+	router            *gin.Engine
+	nostrTrackService *mocks.MockNostrTrackService
+	processingService *mocks.MockProcessingService
+	audioProcessor    *mocks.MockAudioProcessor
+	handlers          *TracksHandler
+}
+
+func (suite *TracksHandlerTestSuite) SetupTest() {
+	gin.SetMode(gin.TestMode)
+
+	suite.nostrTrackService = &mocks.MockNostrTrackService{}
+	suite.processingService = &mocks.MockProcessingService{}
+	suite.audioProcessor = &mocks.MockAudioProcessor{}
+	suite.handlers = NewTracksHandler(suite.nostrTrackService, suite.processingService, suite.audioProcessor, nil, "", false)
+
+	suite.router = gin.New()
+	authed := suite.router.Group("/v1/tracks")
+	authed.Use(func(c *gin.Context) {
+		c.Set("pubkey", testOwnerPubkey)
+		c.Set("firebase_uid", "test-firebase-uid")
+		c.Next()
+	})
+	authed.POST("/nostr", suite.handlers.CreateTrackNostr)
+	authed.GET("/my", suite.handlers.GetMyTracks)
+	authed.GET("/:id", suite.handlers.GetTrack)
+	authed.DELETE("/:id", suite.handlers.DeleteTrack)
+	authed.POST("/:id/restore", suite.handlers.RestoreTrack)
+	authed.GET("/:id/status", suite.handlers.GetTrackStatus)
+	authed.GET("/:id/history", suite.handlers.GetTrackHistory)
+	authed.POST("/:id/process", suite.handlers.TriggerProcessing)
+	authed.POST("/:id/compress", suite.handlers.RequestCompression)
+	authed.PUT("/:id/compression-visibility", suite.handlers.UpdateCompressionVisibility)
+	authed.GET("/:id/public-versions", suite.handlers.GetPublicVersions)
+	authed.GET("/:id/nostr-event", suite.handlers.GetNostrEvent)
+	authed.PUT("/:id/nostr-ref", suite.handlers.UpdateNostrRef)
+	authed.POST("/:id/share-links", suite.handlers.CreateShareLink)
+	authed.GET("/:id/share-links", suite.handlers.ListShareLinks)
+	authed.DELETE("/:id/share-links/:link_id", suite.handlers.RevokeShareLink)
+	authed.GET("/:id/original-download", suite.handlers.GetOriginalDownload)
+	authed.POST("/:id/upload-url", suite.handlers.RenewUploadURL)
+
+	anonymous := suite.router.Group("/v1/anonymous/tracks")
+	anonymous.POST("/nostr", suite.handlers.CreateTrackNostr)
+	anonymous.GET("/:id", suite.handlers.GetTrack)
+	anonymous.GET("/:id/status", suite.handlers.GetTrackStatus)
+
+	suite.router.GET("/v1/shared/:token", suite.handlers.GetSharedTrack)
+	suite.router.POST("/v1/tracks/webhook/process", suite.handlers.ProcessTrackWebhook)
+}
+
+func (suite *TracksHandlerTestSuite) TearDownTest() {
+	suite.nostrTrackService.AssertExpectations(suite.T())
+	suite.processingService.AssertExpectations(suite.T())
+	suite.audioProcessor.AssertExpectations(suite.T())
+}
+
+// request sends a JSON request and decodes the {success, data, error} envelope
+func (suite *TracksHandlerTestSuite) request(method, path string, body interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+	var reader *bytes.Buffer
+	if body != nil {
+		encoded, _ := json.Marshal(body)
+		reader = bytes.NewBuffer(encoded)
+	} else {
+		reader = &bytes.Buffer{}
+	}
+
+	req, _ := http.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w, response
+}
+
+func (suite *TracksHandlerTestSuite) ownedTrack() *models.NostrTrack {
+	return &models.NostrTrack{
+		ID:            "track-123",
+		FirebaseUID:   "test-firebase-uid",
+		Pubkey:        testOwnerPubkey,
+		OriginalURL:   "https://storage.example.com/tracks/original/track-123.wav",
+		CompressedURL: "https://storage.example.com/tracks/compressed/track-123.mp3",
+		Extension:     "wav",
+		Size:          1024,
+		Status:        models.TrackStatusReady,
+		IsCompressed:  true,
+	}
+}
+
+func (suite *TracksHandlerTestSuite) TestCreateTrack_Success() {
+	track := &models.NostrTrack{
+		ID:             "track-123",
+		Pubkey:         testOwnerPubkey,
+		Status:         models.TrackStatusPendingUpload,
+		PresignedURL:   "https://upload.example.com",
+		UploadHeaders:  map[string]string{"Content-Type": "audio/wav", "X-Goog-Content-Length-Range": "0,524288000"},
+		MaxUploadBytes: 524288000,
+	}
+	suite.audioProcessor.On("IsFormatSupported", ".wav").Return(true)
+	suite.nostrTrackService.On("ChooseRegion", "", "").Return("", nil)
+	suite.nostrTrackService.On("CreateTrack", mock.Anything, testOwnerPubkey, "test-firebase-uid", "wav", "", "").Return(track, nil)
+
+	w, response := suite.request("POST", "/v1/tracks/nostr", map[string]string{"extension": ".wav"})
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), true, response["success"])
+	data := response["data"].(map[string]interface{})
+	assert.Equal(suite.T(), "track-123", data["id"])
+	assert.Equal(suite.T(), "https://upload.example.com", data["presigned_url"])
+	assert.Equal(suite.T(), map[string]interface{}{"Content-Type": "audio/wav", "X-Goog-Content-Length-Range": "0,524288000"}, data["upload_headers"])
+	assert.Equal(suite.T(), float64(524288000), data["max_upload_bytes"])
+}
+
+func (suite *TracksHandlerTestSuite) TestCreateTrack_WithDTag() {
+	track := &models.NostrTrack{ID: "track-123", Pubkey: testOwnerPubkey, NostrDTag: "my-song"}
+	suite.audioProcessor.On("IsFormatSupported", ".wav").Return(true)
+	suite.nostrTrackService.On("ChooseRegion", "", "").Return("", nil)
+	suite.nostrTrackService.On("CreateTrack", mock.Anything, testOwnerPubkey, "test-firebase-uid", "wav", "", "my-song").Return(track, nil)
+
+	w, response := suite.request("POST", "/v1/tracks/nostr", map[string]string{"extension": ".wav", "d_tag": "my-song"})
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "my-song", response["data"].(map[string]interface{})["nostr_d_tag"])
+}
+
+func (suite *TracksHandlerTestSuite) TestCreateTrack_DTagInUse() {
+	suite.audioProcessor.On("IsFormatSupported", ".wav").Return(true)
+	suite.nostrTrackService.On("ChooseRegion", "", "").Return("", nil)
+	suite.nostrTrackService.On("CreateTrack", mock.Anything, testOwnerPubkey, "test-firebase-uid", "wav", "", "my-song").Return(nil, services.ErrNostrDTagInUse)
+
+	w, response := suite.request("POST", "/v1/tracks/nostr", map[string]string{"extension": ".wav", "d_tag": "my-song"})
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+	assert.Equal(suite.T(), services.ErrNostrDTagInUse.Error(), errorMessage(response))
+}
+
+func (suite *TracksHandlerTestSuite) TestCreateTrack_InvalidDTag() {
+	suite.audioProcessor.On("IsFormatSupported", ".wav").Return(true)
+	suite.nostrTrackService.On("ChooseRegion", "", "").Return("", nil)
+	suite.nostrTrackService.On("CreateTrack", mock.Anything, testOwnerPubkey, "test-firebase-uid", "wav", "", " ").Return(nil, services.ErrInvalidNostrDTag)
+
+	w, _ := suite.request("POST", "/v1/tracks/nostr", map[string]string{"extension": ".wav", "d_tag": " "})
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestCreateTrack_MissingExtension() {
+	w, response := suite.request("POST", "/v1/tracks/nostr", map[string]string{})
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Equal(suite.T(), "extension field is required", errorMessage(response))
+}
+
+func (suite *TracksHandlerTestSuite) TestCreateTrack_UnsupportedFormat() {
+	suite.audioProcessor.On("IsFormatSupported", "exe").Return(false)
+
+	w, response := suite.request("POST", "/v1/tracks/nostr", map[string]string{"extension": "exe"})
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Equal(suite.T(), "unsupported audio format", errorMessage(response))
+}
+
+func (suite *TracksHandlerTestSuite) TestCreateTrack_RequiresAuth() {
+	suite.audioProcessor.On("IsFormatSupported", "wav").Return(true)
+
+	w, _ := suite.request("POST", "/v1/anonymous/tracks/nostr", map[string]string{"extension": "wav"})
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestCreateTrack_UnknownRegion() {
+	suite.audioProcessor.On("IsFormatSupported", "wav").Return(true)
+	suite.nostrTrackService.On("ChooseRegion", "mars", "").Return("", errors.New("unknown region"))
+
+	w, response := suite.request("POST", "/v1/tracks/nostr", map[string]string{"extension": "wav", "region": "mars"})
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Equal(suite.T(), "unknown storage region", errorMessage(response))
+}
+
+func (suite *TracksHandlerTestSuite) TestCreateTrack_ServiceError() {
+	suite.audioProcessor.On("IsFormatSupported", "wav").Return(true)
+	suite.nostrTrackService.On("ChooseRegion", "", "").Return("", nil)
+	suite.nostrTrackService.On("CreateTrack", mock.Anything, testOwnerPubkey, "test-firebase-uid", "wav", "", "").Return(nil, errors.New("firestore unavailable"))
+
+	w, response := suite.request("POST", "/v1/tracks/nostr", map[string]string{"extension": "wav"})
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+	assert.Equal(suite.T(), "failed to create track", errorMessage(response))
+}
+
+func (suite *TracksHandlerTestSuite) TestCreateTrack_QuotaExceeded() {
+	quotaErr := &services.QuotaExceededError{
+		Limit: "tracks",
+		Usage: models.StorageUsage{Tracks: 5, Bytes: 2048},
+		Quota: models.TrackQuota{MaxTracks: 5},
+	}
+	suite.audioProcessor.On("IsFormatSupported", "wav").Return(true)
+	suite.nostrTrackService.On("ChooseRegion", "", "").Return("", nil)
+	suite.nostrTrackService.On("CreateTrack", mock.Anything, testOwnerPubkey, "test-firebase-uid", "wav", "", "").Return(nil, quotaErr)
+
+	w, response := suite.request("POST", "/v1/tracks/nostr", map[string]string{"extension": "wav"})
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	assert.Equal(suite.T(), "track limit reached", errorMessage(response))
+	assert.Equal(suite.T(), "track.quota_exceeded", errorCode(response))
+	data := response["error"].(map[string]interface{})["details"].(map[string]interface{})
+	assert.Equal(suite.T(), map[string]interface{}{"tracks": float64(5), "bytes": float64(2048)}, data["usage"])
+	assert.Equal(suite.T(), map[string]interface{}{"max_tracks": float64(5), "max_bytes": float64(0)}, data["quota"])
+}
+
+func (suite *TracksHandlerTestSuite) TestGetMyTracks_StatusFilter() {
+	processing := &models.NostrTrack{ID: "track-1", Pubkey: testOwnerPubkey, Status: models.TrackStatusProcessing}
+	ready := &models.NostrTrack{ID: "track-2", Pubkey: testOwnerPubkey, Status: models.TrackStatusReady}
+	suite.nostrTrackService.On("GetTracksByPubkey", mock.Anything, testOwnerPubkey).Return([]*models.NostrTrack{processing, ready}, nil)
+
+	w, response := suite.request("GET", "/v1/tracks/my?status=ready", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	data := response["data"].([]interface{})
+	assert.Len(suite.T(), data, 1)
+	assert.Equal(suite.T(), "track-2", data[0].(map[string]interface{})["id"])
+}
+
+func (suite *TracksHandlerTestSuite) TestGetMyTracks_Paginated() {
+	suite.nostrTrackService.On("ListTracksByPubkey", mock.Anything, testOwnerPubkey, 1, "").Return([]*models.NostrTrack{suite.ownedTrack()}, "next-page", nil)
+
+	w, response := suite.request("GET", "/v1/tracks/my?limit=1", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "next-page", response["next_cursor"])
+}
+
+func (suite *TracksHandlerTestSuite) TestGetMyTracks_InvalidCursor() {
+	suite.nostrTrackService.On("ListTracksByPubkey", mock.Anything, testOwnerPubkey, 0, "garbage").Return(nil, "", services.ErrInvalidTrackCursor)
+
+	w, response := suite.request("GET", "/v1/tracks/my?cursor=garbage", nil)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Equal(suite.T(), "invalid cursor", errorMessage(response))
+}
+
+func (suite *TracksHandlerTestSuite) TestGetMyTracks_EmptyIsArray() {
+	suite.nostrTrackService.On("GetTracksByPubkey", mock.Anything, testOwnerPubkey).Return(nil, nil)
+
+	w, response := suite.request("GET", "/v1/tracks/my", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), []interface{}{}, response["data"])
+	assert.NotContains(suite.T(), response, "next_cursor")
+}
+
+func (suite *TracksHandlerTestSuite) TestGetMyTracks_ErrorHidesCause() {
+	suite.nostrTrackService.On("GetTracksByPubkey", mock.Anything, testOwnerPubkey).Return(nil, errors.New("firestore unavailable"))
+
+	w, response := suite.request("GET", "/v1/tracks/my", nil)
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+	assert.Equal(suite.T(), false, response["success"])
+	assert.Equal(suite.T(), "internal_error", errorCode(response))
+	assert.Equal(suite.T(), "failed to retrieve tracks", errorMessage(response))
+	assert.NotContains(suite.T(), w.Body.String(), "firestore unavailable")
+	assert.NotContains(suite.T(), response, "data")
+}
+
+func (suite *TracksHandlerTestSuite) TestGetMyTracks_UnknownStatus() {
+	w, response := suite.request("GET", "/v1/tracks/my?status=bogus", nil)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Equal(suite.T(), "unknown status", errorMessage(response))
+}
+
+func (suite *TracksHandlerTestSuite) TestGetTrack_Owner() {
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(suite.ownedTrack(), nil)
+
+	w, response := suite.request("GET", "/v1/tracks/track-123", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	data := response["data"].(map[string]interface{})
+	assert.Equal(suite.T(), testOwnerPubkey, data["pubkey"])
+	assert.Equal(suite.T(), "test-firebase-uid", data["firebase_uid"])
+	assert.Equal(suite.T(), float64(1024), data["size"])
+}
+
+func (suite *TracksHandlerTestSuite) TestGetTrack_AnonymousGetsPublicView() {
+	track := suite.ownedTrack()
+	track.Duration = 180
+	track.WaveformURL = "https://storage.example.com/tracks/waveform/track-123.json"
+	track.ArtworkURL = "https://storage.example.com/tracks/artwork/track-123.jpg"
+	track.Album = "Routes"
+	track.EmbeddedTags = []string{"album", "artwork_url"}
+	track.CompressionVersions = []models.CompressionVersion{
+		{ID: "public-mp3", Format: "mp3", Bitrate: 128, IsPublic: true},
+		{ID: "private-aac", Format: "aac", Bitrate: 256},
+	}
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+
+	w, response := suite.request("GET", "/v1/anonymous/tracks/track-123", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	data := response["data"].(map[string]interface{})
+	assert.Empty(suite.T(), data["compressed_url"])
+	assert.Empty(suite.T(), data["original_url"])
+	assert.Equal(suite.T(), models.TrackStatusReady, data["status"])
+	assert.Equal(suite.T(), float64(180), data["duration"])
+	assert.Equal(suite.T(), float64(1024), data["size"])
+	assert.Equal(suite.T(), "https://storage.example.com/tracks/waveform/track-123.json", data["waveform_url"])
+	assert.Equal(suite.T(), "https://storage.example.com/tracks/artwork/track-123.jpg", data["artwork_url"])
+	assert.Equal(suite.T(), "Routes", data["album"])
+	assert.Empty(suite.T(), data["embedded_tags"])
+	assert.Empty(suite.T(), data["pubkey"])
+	assert.Empty(suite.T(), data["firebase_uid"])
+
+	// Only the versions the owner made public
+	versions := data["compression_versions"].([]interface{})
+	require.Len(suite.T(), versions, 1)
+	assert.Equal(suite.T(), "public-mp3", versions[0].(map[string]interface{})["id"])
+}
+
+func (suite *TracksHandlerTestSuite) TestGetTrack_AnonymousGetsNostrRef() {
+	track := suite.ownedTrack()
+	track.IsPublished = true
+	track.NostrEventID = "event-id"
+	track.NostrKind = 31337
+	track.NostrDTag = "d-tag-1"
+	track.NostrRelays = []string{"wss://relay.wavlake.com"}
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+
+	w, response := suite.request("GET", "/v1/anonymous/tracks/track-123", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	data := response["data"].(map[string]interface{})
+	assert.Equal(suite.T(), testOwnerPubkey, data["pubkey"])
+	assert.Equal(suite.T(), "event-id", data["nostr_event_id"])
+	assert.Equal(suite.T(), float64(31337), data["nostr_kind"])
+	assert.Equal(suite.T(), "d-tag-1", data["nostr_d_tag"])
+	assert.Equal(suite.T(), []interface{}{"wss://relay.wavlake.com"}, data["nostr_relays"])
+	assert.Empty(suite.T(), data["firebase_uid"])
+}
+
+func (suite *TracksHandlerTestSuite) TestGetTrack_AnonymousGetsPreviewWithoutPublicVersions() {
+	track := suite.ownedTrack()
+	track.PreviewURL = "https://storage.example.com/tracks/preview/track-123.mp3"
+	track.CompressionVersions = []models.CompressionVersion{
+		{ID: "private-aac", Format: "aac", Bitrate: 256},
+	}
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+
+	w, response := suite.request("GET", "/v1/anonymous/tracks/track-123", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	data := response["data"].(map[string]interface{})
+	assert.Equal(suite.T(), "https://storage.example.com/tracks/preview/track-123.mp3", data["preview_url"])
+	assert.NotContains(suite.T(), data, "compression_versions")
+}
+
+func (suite *TracksHandlerTestSuite) TestGetTrack_OwnerSeesPrivateVersions() {
+	track := suite.ownedTrack()
+	track.CompressionVersions = []models.CompressionVersion{
+		{ID: "public-mp3", Format: "mp3", IsPublic: true},
+		{ID: "private-aac", Format: "aac"},
+	}
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+
+	w, response := suite.request("GET", "/v1/tracks/track-123", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	data := response["data"].(map[string]interface{})
+	assert.Len(suite.T(), data["compression_versions"], 2)
+}
+
+func (suite *TracksHandlerTestSuite) TestGetTrack_DeletedHiddenFromPublic() {
+	track := suite.ownedTrack()
+	track.Deleted = true
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+
+	w, response := suite.request("GET", "/v1/anonymous/tracks/track-123", nil)
+
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+	assert.Equal(suite.T(), "track not found", errorMessage(response))
+	assert.NotContains(suite.T(), response, "data")
+}
+
+func (suite *TracksHandlerTestSuite) TestGetTrack_DeletedVisibleToOwner() {
+	track := suite.ownedTrack()
+	track.Deleted = true
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+
+	w, response := suite.request("GET", "/v1/tracks/track-123", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), true, response["data"].(map[string]interface{})["deleted"])
+}
+
+func (suite *TracksHandlerTestSuite) TestGetTrack_NotFound() {
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "missing").Return(nil, services.ErrTrackNotFound)
+
+	w, response := suite.request("GET", "/v1/tracks/missing", nil)
+
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+	assert.Equal(suite.T(), "track not found", errorMessage(response))
+}
+
+func (suite *TracksHandlerTestSuite) TestDeleteTrack_Success() {
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(suite.ownedTrack(), nil)
+	suite.nostrTrackService.On("DeleteTrack", mock.Anything, "track-123").Return(nil)
+	suite.processingService.On("CancelProcessing", "track-123").Return(0)
+
+	w, response := suite.request("DELETE", "/v1/tracks/track-123", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), true, response["success"])
+}
+
+func (suite *TracksHandlerTestSuite) TestDeleteTrack_NotOwner() {
+	track := suite.ownedTrack()
+	track.Pubkey = testOtherPubkey
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+
+	w, response := suite.request("DELETE", "/v1/tracks/track-123", nil)
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	assert.Equal(suite.T(), "not authorized to delete this track", errorMessage(response))
+}
+
+func (suite *TracksHandlerTestSuite) TestDeleteTrack_NotFound() {
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "missing").Return(nil, services.ErrTrackNotFound)
+
+	w, _ := suite.request("DELETE", "/v1/tracks/missing", nil)
+
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestDeleteTrack_ServiceError() {
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(suite.ownedTrack(), nil)
+	suite.nostrTrackService.On("DeleteTrack", mock.Anything, "track-123").Return(errors.New("firestore unavailable"))
+
+	w, response := suite.request("DELETE", "/v1/tracks/track-123", nil)
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+	assert.Equal(suite.T(), "failed to delete track", errorMessage(response))
+	suite.processingService.AssertNotCalled(suite.T(), "CancelProcessing", mock.Anything)
+}
+
+func (suite *TracksHandlerTestSuite) TestDeleteTrack_Purge() {
+	track := suite.ownedTrack()
+	purge := &models.TrackPurge{Objects: []string{"tracks/compressed/track-123.mp3", "tracks/original/track-123.wav"}}
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+	suite.nostrTrackService.On("DeleteTrack", mock.Anything, "track-123").Return(nil)
+	suite.processingService.On("CancelProcessing", "track-123").Return(0)
+	suite.nostrTrackService.On("PurgeTrackFiles", mock.Anything, track, false).Return(purge, nil)
+
+	w, response := suite.request("DELETE", "/v1/tracks/track-123?purge=true", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	data := response["data"].(map[string]interface{})
+	assert.Len(suite.T(), data["objects"], 2)
+	assert.NotContains(suite.T(), data, "failed")
+}
+
+func (suite *TracksHandlerTestSuite) TestDeleteTrack_PurgeReportsFailures() {
+	track := suite.ownedTrack()
+	purge := &models.TrackPurge{Objects: []string{"tracks/original/track-123.wav"}, Failed: []string{"tracks/original/track-123.wav"}}
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+	suite.nostrTrackService.On("DeleteTrack", mock.Anything, "track-123").Return(nil)
+	suite.processingService.On("CancelProcessing", "track-123").Return(0)
+	suite.nostrTrackService.On("PurgeTrackFiles", mock.Anything, track, false).Return(purge, nil)
+
+	w, response := suite.request("DELETE", "/v1/tracks/track-123?purge=true", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	data := response["data"].(map[string]interface{})
+	assert.Equal(suite.T(), []interface{}{"tracks/original/track-123.wav"}, data["failed"])
+}
+
+func (suite *TracksHandlerTestSuite) TestDeleteTrack_DryRun() {
+	track := suite.ownedTrack()
+	purge := &models.TrackPurge{DryRun: true, Objects: []string{"tracks/original/track-123.wav"}}
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+	suite.nostrTrackService.On("PurgeTrackFiles", mock.Anything, track, true).Return(purge, nil)
+
+	w, response := suite.request("DELETE", "/v1/tracks/track-123?purge=true&dry_run=true", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), true, response["data"].(map[string]interface{})["dry_run"])
+	suite.nostrTrackService.AssertNotCalled(suite.T(), "DeleteTrack", mock.Anything, mock.Anything)
+}
+
+func (suite *TracksHandlerTestSuite) TestGetTrackStatus_Owner() {
+	track := suite.ownedTrack()
+	track.Status = models.TrackStatusProcessing
+	track.IsProcessing = true
+	track.ProcessingAttempts = 2
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+
+	w, response := suite.request("GET", "/v1/tracks/track-123/status", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	data := response["data"].(map[string]interface{})
+	assert.Equal(suite.T(), models.TrackStatusProcessing, data["status"])
+	assert.Equal(suite.T(), true, data["is_processing"])
+	assert.Equal(suite.T(), float64(2), data["processing_attempts"])
+}
+
+func (suite *TracksHandlerTestSuite) TestGetTrackStatus_EmbeddedTags() {
+	track := suite.ownedTrack()
+	track.Title = "Night Drive"
+	track.EmbeddedTags = []string{"title", "artwork_url"}
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+
+	w, response := suite.request("GET", "/v1/tracks/track-123/status", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	data := response["data"].(map[string]interface{})
+	assert.Equal(suite.T(), []interface{}{"title", "artwork_url"}, data["embedded_tags"])
+}
+
+func (suite *TracksHandlerTestSuite) TestGetTrackStatus_LimitExceeded() {
+	track := suite.ownedTrack()
+	track.Status = models.TrackStatusFailed
+	track.Error = "track too long: 6h0m0s, the limit is 2h0m0s"
+	track.ErrorCode = models.ProcessingErrorTooLong
+	track.LimitExceeded = &models.TrackLimitExceeded{Limit: models.TrackLimitDuration, Max: 7200, Actual: 21600}
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+
+	w, response := suite.request("GET", "/v1/tracks/track-123/status", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	data := response["data"].(map[string]interface{})
+	assert.Equal(suite.T(), "too_long", data["error_code"])
+	assert.Equal(suite.T(), map[string]interface{}{"limit": "duration", "max": float64(7200), "actual": float64(21600)}, data["limit_exceeded"])
+}
+
+func (suite *TracksHandlerTestSuite) TestGetTrackStatus_ProcessingTimes() {
+	started := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	finished := started.Add(90 * time.Second)
+	track := suite.ownedTrack()
+	track.StatusTimestamps = map[string]time.Time{
+		models.TrackStatusUploaded:   started.Add(-time.Second),
+		models.TrackStatusProcessing: started,
+		models.TrackStatusReady:      finished,
+	}
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+
+	w, response := suite.request("GET", "/v1/tracks/track-123/status", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	data := response["data"].(map[string]interface{})
+	assert.Equal(suite.T(), "2024-01-01T12:00:00Z", data["processing_started_at"])
+	assert.Equal(suite.T(), "2024-01-01T12:01:30Z", data["processing_finished_at"])
+}
+
+func (suite *TracksHandlerTestSuite) TestGetTrackStatus_RetryNotFinished() {
+	// A retry after a failure restarts processing; the old failure doesn't count as finishing it
+	failed := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	track := suite.ownedTrack()
+	track.Status = models.TrackStatusProcessing
+	track.StatusTimestamps = map[string]time.Time{
+		models.TrackStatusFailed:     failed,
+		models.TrackStatusProcessing: failed.Add(time.Minute),
+	}
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+
+	w, response := suite.request("GET", "/v1/tracks/track-123/status", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	data := response["data"].(map[string]interface{})
+	assert.Equal(suite.T(), "2024-01-01T12:01:00Z", data["processing_started_at"])
+	assert.NotContains(suite.T(), data, "processing_finished_at")
+}
+
+func (suite *TracksHandlerTestSuite) TestGetTrackStatus_NotOwner() {
+	track := suite.ownedTrack()
+	track.Pubkey = testOtherPubkey
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+
+	w, _ := suite.request("GET", "/v1/tracks/track-123/status", nil)
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestGetTrackStatus_RequiresAuth() {
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(suite.ownedTrack(), nil)
+
+	w, _ := suite.request("GET", "/v1/anonymous/tracks/track-123/status", nil)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestGetTrackHistory_Paginated() {
+	finished := time.Now()
+	attempts := []models.ProcessingAttempt{
+		{ID: "attempt-2", TriggeredBy: models.ProcessingTriggerRetry, Outcome: models.ProcessingOutcomeSucceeded, FinishedAt: &finished, Versions: []string{"default-128k-mp3"}},
+		{ID: "attempt-1", TriggeredBy: models.ProcessingTriggerWebhook, Outcome: models.ProcessingOutcomeFailed, Phase: models.ProcessingStageValidating, ErrorClass: models.ProcessingErrorInvalidAudio},
+	}
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(suite.ownedTrack(), nil)
+	suite.nostrTrackService.On("ListProcessingHistory", mock.Anything, "track-123", 2, "attempt-3").Return(attempts, "attempt-1", nil)
+
+	w, response := suite.request("GET", "/v1/tracks/track-123/history?limit=2&cursor=attempt-3", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "attempt-1", response["next_cursor"])
+	data := response["data"].([]interface{})
+	assert.Len(suite.T(), data, 2)
+	assert.Equal(suite.T(), models.ProcessingTriggerRetry, data[0].(map[string]interface{})["triggered_by"])
+	assert.Equal(suite.T(), models.ProcessingErrorInvalidAudio, data[1].(map[string]interface{})["error_class"])
+}
+
+func (suite *TracksHandlerTestSuite) TestGetTrackHistory_EmptyIsArray() {
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(suite.ownedTrack(), nil)
+	suite.nostrTrackService.On("ListProcessingHistory", mock.Anything, "track-123", services.DefaultHistoryPageSize, "").Return(nil, "", nil)
+
+	w, response := suite.request("GET", "/v1/tracks/track-123/history", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), []interface{}{}, response["data"])
+}
+
+func (suite *TracksHandlerTestSuite) TestGetTrackHistory_NotOwner() {
+	track := suite.ownedTrack()
+	track.Pubkey = testOtherPubkey
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+
+	w, _ := suite.request("GET", "/v1/tracks/track-123/history", nil)
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestGetTrackHistory_InvalidCursor() {
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(suite.ownedTrack(), nil)
+	suite.nostrTrackService.On("ListProcessingHistory", mock.Anything, "track-123", services.DefaultHistoryPageSize, "gone").Return(nil, "", services.ErrInvalidHistoryCursor)
+
+	w, response := suite.request("GET", "/v1/tracks/track-123/history?cursor=gone", nil)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Equal(suite.T(), "invalid cursor", errorMessage(response))
+}
+
+func (suite *TracksHandlerTestSuite) TestGetTrackHistory_InvalidLimit() {
+	w, _ := suite.request("GET", "/v1/tracks/track-123/history?limit=0", nil)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestTriggerProcessing_Success() {
+	track := suite.ownedTrack()
+	track.Status = models.TrackStatusFailed
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+	suite.processingService.On("ProcessTrackAsync", mock.Anything, "track-123", models.ProcessingTriggerRetry).Return(nil)
+
+	w, _ := suite.request("POST", "/v1/tracks/track-123/process", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestTriggerProcessing_FirstAttemptIsManual() {
+	track := suite.ownedTrack()
+	track.Status = models.TrackStatusUploaded
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+	suite.processingService.On("ProcessTrackAsync", mock.Anything, "track-123", models.ProcessingTriggerManual).Return(nil)
+
+	w, _ := suite.request("POST", "/v1/tracks/track-123/process", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestTriggerProcessing_AlreadyProcessed() {
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(suite.ownedTrack(), nil)
+
+	w, response := suite.request("POST", "/v1/tracks/track-123/process", nil)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Equal(suite.T(), "track already processed", errorMessage(response))
+}
+
+func (suite *TracksHandlerTestSuite) TestTriggerProcessing_AlreadyProcessing() {
+	track := suite.ownedTrack()
+	track.Status = models.TrackStatusUploaded
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+	suite.processingService.On("ProcessTrackAsync", mock.Anything, "track-123", models.ProcessingTriggerManual).Return(services.ErrTrackAlreadyProcessing)
+
+	w, response := suite.request("POST", "/v1/tracks/track-123/process", nil)
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+	assert.Equal(suite.T(), "track is already processing", errorMessage(response))
+}
+
+func (suite *TracksHandlerTestSuite) TestTriggerProcessing_Conflict() {
+	track := suite.ownedTrack()
+	track.Status = models.TrackStatusUploaded
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+	suite.processingService.On("ProcessTrackAsync", mock.Anything, "track-123", models.ProcessingTriggerManual).Return(services.ErrTrackUpdateConflict)
+
+	w, _ := suite.request("POST", "/v1/tracks/track-123/process", nil)
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+}
+
+// postWebhook sends a fresh processing webhook delivery for track-123
+func (suite *TracksHandlerTestSuite) postWebhook(payload map[string]interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+	payload["track_id"] = "track-123"
+	payload["timestamp"] = time.Now().Unix()
+	payload["nonce"] = uuid.New().String()
+	return suite.request("POST", "/v1/tracks/webhook/process", payload)
+}
+
+func (suite *TracksHandlerTestSuite) TestProcessTrackWebhook_Uploaded() {
+	suite.nostrTrackService.On("TransitionTrack", mock.Anything, "track-123", models.TrackStatusUploaded, map[string]interface{}(nil)).Return(nil)
+	suite.processingService.On("ProcessTrackAsync", mock.Anything, "track-123", models.ProcessingTriggerWebhook).Return(nil)
+
+	w, response := suite.postWebhook(map[string]interface{}{"status": "uploaded"})
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "processing started", response["message"])
+}
+
+func (suite *TracksHandlerTestSuite) TestProcessTrackWebhook_UnknownField() {
+	w, response := suite.postWebhook(map[string]interface{}{"status": "uploaded", "trackid": "track-456"})
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Equal(suite.T(), ErrorCodeUnknownField, errorCode(response))
+	assert.Equal(suite.T(), `unknown field "trackid"`, errorMessage(response))
+}
+
+func (suite *TracksHandlerTestSuite) TestProcessTrackWebhook_BodyTooLarge() {
+	router := gin.New()
+	router.POST("/webhook", bodylimit.Middleware(1<<10), suite.handlers.ProcessTrackWebhook)
+	body, _ := json.Marshal(map[string]interface{}{
+		"track_id": "track-123", "status": "failed", "error": strings.Repeat("x", 2<<10),
+		"timestamp": time.Now().Unix(), "nonce": uuid.New().String(),
+	})
+
+	for name, req := range map[string]*http.Request{
+		"content length": httptest.NewRequest("POST", "/webhook", bytes.NewReader(body)),
+		"chunked":        httptest.NewRequest("POST", "/webhook", io.NopCloser(bytes.NewReader(body))),
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(suite.T(), http.StatusRequestEntityTooLarge, w.Code, name)
+		assert.Equal(suite.T(), "request body is over the 1 KB limit", errorMessage(response), name)
+	}
+}
+
+func (suite *TracksHandlerTestSuite) TestProcessTrackWebhook_ConcurrentUploadsProcessOnce() {
+	// The second trigger finds the track already moved on by the first
+	suite.nostrTrackService.On("TransitionTrack", mock.Anything, "track-123", models.TrackStatusUploaded, map[string]interface{}(nil)).Return(nil).Once()
+	suite.nostrTrackService.On("TransitionTrack", mock.Anything, "track-123", models.TrackStatusUploaded, map[string]interface{}(nil)).Return(services.ErrInvalidStatusTransition).Once()
+	suite.processingService.On("ProcessTrackAsync", mock.Anything, "track-123", models.ProcessingTriggerWebhook).Return(nil).Once()
+	suite.processingService.On("ProcessTrackAsync", mock.Anything, "track-123", models.ProcessingTriggerWebhook).Return(services.ErrTrackAlreadyProcessing).Once()
+
+	responses := make([]map[string]interface{}, 2)
+	var wg sync.WaitGroup
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w, response := suite.postWebhook(map[string]interface{}{"status": "uploaded"})
+			assert.Equal(suite.T(), http.StatusOK, w.Code)
+			responses[i] = response
+		}(i)
+	}
+	wg.Wait()
+
+	started, duplicates := 0, 0
+	for _, response := range responses {
+		if response["duplicate"] == true {
+			duplicates++
+		} else if response["message"] == "processing started" {
+			started++
+		}
+	}
+	assert.Equal(suite.T(), 1, started)
+	assert.Equal(suite.T(), 1, duplicates)
+}
+
+func (suite *TracksHandlerTestSuite) TestProcessTrackWebhook_UploadedAfterReady() {
+	suite.nostrTrackService.On("TransitionTrack", mock.Anything, "track-123", models.TrackStatusUploaded, map[string]interface{}(nil)).Return(services.ErrInvalidStatusTransition)
+	suite.processingService.On("ProcessTrackAsync", mock.Anything, "track-123", models.ProcessingTriggerWebhook).Return(services.ErrTrackAlreadyProcessed)
+
+	w, response := suite.postWebhook(map[string]interface{}{"status": "uploaded"})
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), true, response["duplicate"])
+}
+
+func (suite *TracksHandlerTestSuite) TestProcessTrackWebhook_UploadedWhileCancelled() {
+	err := fmt.Errorf("%w: cancelled to uploaded", services.ErrInvalidStatusTransition)
+	suite.nostrTrackService.On("TransitionTrack", mock.Anything, "track-123", models.TrackStatusUploaded, map[string]interface{}(nil)).Return(err)
+	suite.processingService.On("ProcessTrackAsync", mock.Anything, "track-123", models.ProcessingTriggerWebhook).Return(services.ErrInvalidStatusTransition)
+
+	w, _ := suite.postWebhook(map[string]interface{}{"status": "uploaded"})
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestProcessTrackWebhook_DuplicateIdempotencyKey() {
+	suite.nostrTrackService.On("ClaimIdempotencyKey", mock.Anything, "delivery-1", "track-123").Return(false, nil)
+
+	w, response := suite.postWebhook(map[string]interface{}{"status": "uploaded", "idempotency_key": "delivery-1"})
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), true, response["duplicate"])
+}
+
+func (suite *TracksHandlerTestSuite) TestProcessTrackWebhook_IdempotencyKeyReleasedOnFailure() {
+	suite.nostrTrackService.On("ClaimIdempotencyKey", mock.Anything, "delivery-1", "track-123").Return(true, nil)
+	suite.nostrTrackService.On("TransitionTrack", mock.Anything, "track-123", models.TrackStatusUploaded, map[string]interface{}(nil)).Return(errors.New("firestore unavailable"))
+	suite.nostrTrackService.On("ReleaseIdempotencyKey", mock.Anything, "delivery-1").Return(nil)
+
+	w, _ := suite.postWebhook(map[string]interface{}{"status": "uploaded", "idempotency_key": "delivery-1"})
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestProcessTrackWebhook_IdempotencyKeyKeptOnSuccess() {
+	suite.nostrTrackService.On("ClaimIdempotencyKey", mock.Anything, "delivery-1", "track-123").Return(true, nil)
+	suite.nostrTrackService.On("TransitionTrack", mock.Anything, "track-123", models.TrackStatusUploaded, map[string]interface{}(nil)).Return(nil)
+	suite.processingService.On("ProcessTrackAsync", mock.Anything, "track-123", models.ProcessingTriggerWebhook).Return(nil)
+
+	w, _ := suite.postWebhook(map[string]interface{}{"status": "uploaded", "idempotency_key": "delivery-1"})
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestProcessTrackWebhook_VersionReport() {
+	report := models.CompressionVersion{ID: "mp3-128", URL: "https://storage.example.com/mp3-128.mp3", Format: "mp3", Bitrate: 128, Size: 2048, Status: models.VersionStatusCompleted}
+	stored := report
+	stored.IsPublic = true
+	suite.nostrTrackService.On("AddOrUpdateCompressionVersion", mock.Anything, "track-123", report).Return(&stored, nil)
+
+	// The track status is left alone whatever the top-level status says
+	w, response := suite.postWebhook(map[string]interface{}{
+		"status": "processed",
+		"version": map[string]interface{}{
+			"version_id": "mp3-128",
+			"url":        "https://storage.example.com/mp3-128.mp3",
+			"format":     "mp3",
+			"bitrate":    128,
+			"size":       2048,
+			"status":     "completed",
+		},
+	})
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	data := response["data"].(map[string]interface{})
+	assert.Equal(suite.T(), "completed", data["status"])
+	assert.Equal(suite.T(), true, data["is_public"])
+	suite.nostrTrackService.AssertNotCalled(suite.T(), "MarkTrackAsProcessed", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *TracksHandlerTestSuite) TestProcessTrackWebhook_FailedVersionReport() {
+	report := models.CompressionVersion{ID: "opus-64", Status: models.VersionStatusFailed, Error: "encoder crashed"}
+	suite.nostrTrackService.On("AddOrUpdateCompressionVersion", mock.Anything, "track-123", report).Return(&report, nil)
+
+	w, response := suite.postWebhook(map[string]interface{}{
+		"version": map[string]interface{}{"version_id": "opus-64", "status": "failed", "error": "encoder crashed"},
+	})
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "encoder crashed", response["data"].(map[string]interface{})["error"])
+	suite.nostrTrackService.AssertNotCalled(suite.T(), "TransitionTrack", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *TracksHandlerTestSuite) TestProcessTrackWebhook_InvalidVersionReport() {
+	err := fmt.Errorf("%w: unknown status %q", services.ErrInvalidVersionReport, "done")
+	suite.nostrTrackService.On("AddOrUpdateCompressionVersion", mock.Anything, "track-123", mock.Anything).Return(nil, err)
+
+	w, _ := suite.postWebhook(map[string]interface{}{
+		"version": map[string]interface{}{"version_id": "mp3-128", "status": "done"},
+	})
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestProcessTrackWebhook_VersionReportConflict() {
+	suite.nostrTrackService.On("AddOrUpdateCompressionVersion", mock.Anything, "track-123", mock.Anything).Return(nil, services.ErrTrackUpdateConflict)
+
+	w, _ := suite.postWebhook(map[string]interface{}{
+		"version": map[string]interface{}{"version_id": "mp3-128", "status": "completed"},
+	})
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestProcessTrackWebhook_CompressedObject() {
+	version := models.CompressionVersion{ID: "mp3-128", Size: 2048, Status: models.VersionStatusCompleted}
+	suite.nostrTrackService.On("RecordCompressedObject", mock.Anything, "track-123", "mp3-128", int64(2048)).Return(&version, nil)
+
+	w, response := suite.postWebhook(map[string]interface{}{"status": "processed", "size": 2048, "version_id": "mp3-128"})
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "completed", response["data"].(map[string]interface{})["status"])
+	suite.nostrTrackService.AssertNotCalled(suite.T(), "MarkTrackAsProcessed", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *TracksHandlerTestSuite) TestProcessTrackWebhook_CompressedObjectUnknownVersion() {
+	err := services.ErrVersionNotFound.WithMessage("compression version mp3-999 not found")
+	suite.nostrTrackService.On("RecordCompressedObject", mock.Anything, "track-123", "mp3-999", int64(2048)).Return(nil, err)
+
+	w, response := suite.postWebhook(map[string]interface{}{"status": "processed", "size": 2048, "version_id": "mp3-999"})
+
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+	assert.Equal(suite.T(), "track.version_not_found", errorCode(response))
+}
+
+func (suite *TracksHandlerTestSuite) TestProcessTrackWebhook_CompressedObjectFailure() {
+	suite.nostrTrackService.On("RecordCompressedObject", mock.Anything, "track-123", "mp3-128", int64(2048)).Return(nil, errors.New("firestore unavailable"))
+
+	w, _ := suite.postWebhook(map[string]interface{}{"status": "processed", "size": 2048, "version_id": "mp3-128"})
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestProcessTrackWebhook_OriginalDeleted() {
+	suite.nostrTrackService.On("MarkOriginalDeleted", mock.Anything, "track-123").Return(true, nil)
+
+	w, response := suite.postWebhook(map[string]interface{}{"status": "original_deleted", "source": "gcs_trigger"})
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), true, response["success"])
+	assert.Nil(suite.T(), response["message"])
+	suite.nostrTrackService.AssertNotCalled(suite.T(), "TransitionTrack", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *TracksHandlerTestSuite) TestProcessTrackWebhook_OriginalDeletedNotFlagged() {
+	// The original was replaced, so the object is still there
+	suite.nostrTrackService.On("MarkOriginalDeleted", mock.Anything, "track-123").Return(false, nil)
+
+	w, response := suite.postWebhook(map[string]interface{}{"status": "original_deleted"})
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "original not flagged", response["message"])
+}
+
+func (suite *TracksHandlerTestSuite) TestProcessTrackWebhook_OriginalDeletedUnknownTrack() {
+	suite.nostrTrackService.On("MarkOriginalDeleted", mock.Anything, "track-123").Return(false, services.ErrTrackNotFound)
+
+	w, _ := suite.postWebhook(map[string]interface{}{"status": "original_deleted"})
+
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestRequestCompression_Success() {
+	options := []models.CompressionOption{{Format: "mp3", Bitrate: 128, Quality: "medium"}}
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(suite.ownedTrack(), nil)
+	result := &models.CompressionRequestResult{
+		Queued:     []models.CompressionRequestItem{{CompressionOption: options[0], VersionID: "version-1"}},
+		Duplicates: []models.CompressionRequestItem{},
+		Existing:   []models.CompressionRequestItem{},
+	}
+	suite.processingService.On("RequestCompressionVersions", mock.Anything, "track-123", options).Return(result, nil)
+
+	w, response := suite.request("POST", "/v1/tracks/track-123/compress", map[string]interface{}{"compressions": options})
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "compression requested", response["message"])
+	queued := response["data"].(map[string]interface{})["queued"].([]interface{})
+	suite.Require().Len(queued, 1)
+	assert.Equal(suite.T(), "version-1", queued[0].(map[string]interface{})["version_id"])
+	assert.Equal(suite.T(), "mp3", queued[0].(map[string]interface{})["format"])
+}
+
+func (suite *TracksHandlerTestSuite) TestRequestCompression_NothingQueued() {
+	options := []models.CompressionOption{{Format: "mp3", Bitrate: 128, Quality: "medium"}, {Format: "mp3", Bitrate: 128, Quality: "medium"}}
+	result := &models.CompressionRequestResult{
+		Queued:     []models.CompressionRequestItem{},
+		Duplicates: []models.CompressionRequestItem{{CompressionOption: options[1], VersionID: "version-1"}},
+		Existing:   []models.CompressionRequestItem{{CompressionOption: options[0], VersionID: "version-1"}},
+	}
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(suite.ownedTrack(), nil)
+	suite.processingService.On("RequestCompressionVersions", mock.Anything, "track-123", options).Return(result, nil)
+
+	w, response := suite.request("POST", "/v1/tracks/track-123/compress", map[string]interface{}{"compressions": options})
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "all requested versions already exist or are pending", response["message"])
+	data := response["data"].(map[string]interface{})
+	assert.Len(suite.T(), data["duplicates"], 1)
+	assert.Len(suite.T(), data["existing"], 1)
+}
+
+func (suite *TracksHandlerTestSuite) TestRequestCompression_TooManyVersions() {
+	err := services.ErrTooManyCompressionVersions.WithMessage(services.ErrTooManyCompressionVersions.Message + ": a track can have at most 10 versions and this request would make 11")
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(suite.ownedTrack(), nil)
+	suite.processingService.On("RequestCompressionVersions", mock.Anything, "track-123", mock.Anything).Return(nil, err)
+
+	w, response := suite.request("POST", "/v1/tracks/track-123/compress", map[string]interface{}{
+		"compressions": []models.CompressionOption{{Format: "ogg", Bitrate: 96}},
+	})
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Contains(suite.T(), errorMessage(response), "at most 10 versions")
+}
+
+func (suite *TracksHandlerTestSuite) TestRequestCompression_InvalidOption() {
+	options := []models.CompressionOption{{Format: "wma", Bitrate: 128}}
+
+	w, response := suite.request("POST", "/v1/tracks/track-123/compress", map[string]interface{}{"compressions": options})
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Contains(suite.T(), errorMessage(response), "invalid format: wma")
+}
+
+func (suite *TracksHandlerTestSuite) TestRequestCompression_OpusOptions() {
+	tests := []struct {
+		option models.CompressionOption
+		error  string
+	}{
+		{models.CompressionOption{Format: "opus", Bitrate: 24}, ""},
+		{models.CompressionOption{Format: "opus", Bitrate: 96, SampleRate: 48000}, ""},
+		{models.CompressionOption{Format: "opus", Bitrate: 16}, "invalid bitrate: 16 (range for opus: 24-320 kbps)"},
+		{models.CompressionOption{Format: "opus", Bitrate: 64, SampleRate: 44100}, "invalid sample rate: 44100 (supported: 48000)"},
+		{models.CompressionOption{Format: "mp3", Bitrate: 24}, "invalid bitrate: 24 (range for mp3: 32-320 kbps)"},
+		{models.CompressionOption{Format: "flac", Bitrate: 128}, "invalid format: flac (supported: aac, mp3, ogg, opus)"},
+	}
+
+	for _, tt := range tests {
+		err := validateCompressionOption(tt.option)
+		if tt.error == "" {
+			assert.NoError(suite.T(), err, "%+v", tt.option)
+		} else {
+			assert.EqualError(suite.T(), err, tt.error)
+		}
+	}
+}
+
+func (suite *TracksHandlerTestSuite) TestRequestCompression_EmptyRequest() {
+	w, _ := suite.request("POST", "/v1/tracks/track-123/compress", map[string]interface{}{"compressions": []models.CompressionOption{}})
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestRequestCompression_UnknownField() {
+	w, response := suite.request("POST", "/v1/tracks/track-123/compress", map[string]interface{}{
+		"compresions": []models.CompressionOption{{Format: "mp3", Bitrate: 128}},
+	})
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Equal(suite.T(), ErrorCodeUnknownField, errorCode(response))
+	assert.Equal(suite.T(), `unknown field "compresions"`, errorMessage(response))
+	details := response["error"].(map[string]interface{})["details"]
+	assert.Equal(suite.T(), map[string]interface{}{"field": "compresions"}, details)
+}
+
+func (suite *TracksHandlerTestSuite) TestRequestCompression_UnknownNestedField() {
+	w, response := suite.request("POST", "/v1/tracks/track-123/compress", map[string]interface{}{
+		"compressions": []map[string]interface{}{{"format": "mp3", "bitrate": 128, "bitrat": 96}},
+	})
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Equal(suite.T(), `unknown field "bitrat"`, errorMessage(response))
+}
+
+func (suite *TracksHandlerTestSuite) TestRequestCompression_TrailingData() {
+	req, _ := http.NewRequest("POST", "/v1/tracks/track-123/compress",
+		strings.NewReader(`{"compressions": [{"format": "mp3", "bitrate": 128}]} {"compressions": []}`))
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "data after the JSON value")
+}
+
+func (suite *TracksHandlerTestSuite) TestRequestCompression_BodyTooLarge() {
+	router := gin.New()
+	router.POST("/compress/:id", bodylimit.Middleware(64), suite.handlers.RequestCompression)
+	body := `{"compressions": [{"format": "mp3", "bitrate": 128}, {"format": "ogg", "bitrate": 96}]}`
+
+	// Without a Content-Length the limit is hit while decoding
+	req, _ := http.NewRequest("POST", "/compress/track-123", io.NopCloser(strings.NewReader(body)))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(suite.T(), http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(suite.T(), bodylimit.ErrorCodeBodyTooLarge, errorCode(response))
+	assert.Equal(suite.T(), "request body is over the 64 B limit", errorMessage(response))
+}
+
+func (suite *TracksHandlerTestSuite) TestRequestCompression_NotOwner() {
+	track := suite.ownedTrack()
+	track.Pubkey = testOtherPubkey
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+
+	w, response := suite.request("POST", "/v1/tracks/track-123/compress", map[string]interface{}{
+		"compressions": []models.CompressionOption{{Format: "mp3", Bitrate: 128}},
+	})
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	assert.Equal(suite.T(), "not authorized to modify this track", errorMessage(response))
+}
+
+func (suite *TracksHandlerTestSuite) TestRequestCompression_ServiceError() {
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(suite.ownedTrack(), nil)
+	suite.processingService.On("RequestCompressionVersions", mock.Anything, "track-123", mock.Anything).Return(nil, errors.New("firestore unavailable"))
+
+	w, response := suite.request("POST", "/v1/tracks/track-123/compress", map[string]interface{}{
+		"compressions": []models.CompressionOption{{Format: "ogg", Bitrate: 96}},
+	})
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+	assert.Contains(suite.T(), errorMessage(response), "failed to request compression")
+}
+
+func (suite *TracksHandlerTestSuite) TestGetPublicVersions_Hashes() {
+	track := suite.ownedTrack()
+	track.OriginalHash = "0f1e2d"
+	track.CompressionVersions = []models.CompressionVersion{
+		{ID: "public-mp3", Format: "mp3", IsPublic: true, Hash: "a1b2c3"},
+	}
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+
+	w, response := suite.request("GET", "/v1/tracks/track-123/public-versions", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	data := response["data"].(map[string]interface{})
+	assert.Equal(suite.T(), "0f1e2d", data["original_hash"])
+	versions := data["public_versions"].([]interface{})
+	require.Len(suite.T(), versions, 1)
+	assert.Equal(suite.T(), "a1b2c3", versions[0].(map[string]interface{})["hash"])
+}
+
+func (suite *TracksHandlerTestSuite) TestGetPublicVersions_EmptyIsArray() {
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(suite.ownedTrack(), nil)
+
+	w, response := suite.request("GET", "/v1/tracks/track-123/public-versions", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	data := response["data"].(map[string]interface{})
+	assert.Equal(suite.T(), []interface{}{}, data["public_versions"])
+}
+
+func (suite *TracksHandlerTestSuite) TestGetNostrEvent_Success() {
+	track := suite.ownedTrack()
+	draft := &gonostr.Event{Kind: 31337, Tags: gonostr.Tags{{"d", "d-tag-1"}}}
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+	suite.nostrTrackService.On("BuildNostrEventDraft", mock.Anything, track).Return(draft, nil)
+
+	w, response := suite.request("GET", "/v1/tracks/track-123/nostr-event", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	data := response["data"].(map[string]interface{})
+	assert.Equal(suite.T(), float64(31337), data["kind"])
+	assert.Equal(suite.T(), []interface{}{[]interface{}{"d", "d-tag-1"}}, data["tags"])
+}
+
+func (suite *TracksHandlerTestSuite) TestGetNostrEvent_NotOwner() {
+	track := suite.ownedTrack()
+	track.Pubkey = testOtherPubkey
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+
+	w, _ := suite.request("GET", "/v1/tracks/track-123/nostr-event", nil)
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestGetNostrEvent_NoPublicVersions() {
+	track := suite.ownedTrack()
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+	suite.nostrTrackService.On("BuildNostrEventDraft", mock.Anything, track).Return(nil, services.ErrNoPublicVersions)
+
+	w, response := suite.request("GET", "/v1/tracks/track-123/nostr-event", nil)
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+	assert.Equal(suite.T(), services.ErrNoPublicVersions.Error(), errorMessage(response))
+}
+
+func (suite *TracksHandlerTestSuite) TestUpdateCompressionVisibility_Success() {
+	updates := []models.VersionUpdate{{VersionID: "version-1", IsPublic: true}}
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(suite.ownedTrack(), nil)
+	suite.nostrTrackService.On("UpdateCompressionVisibility", mock.Anything, "track-123", updates).Return(nil)
+
+	w, response := suite.request("PUT", "/v1/tracks/track-123/compression-visibility", map[string]interface{}{"version_updates": updates})
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "visibility updated", response["message"])
+}
+
+func (suite *TracksHandlerTestSuite) TestUpdateCompressionVisibility_InvalidRequest() {
+	w, _ := suite.request("PUT", "/v1/tracks/track-123/compression-visibility", map[string]interface{}{})
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestUpdateCompressionVisibility_NotOwner() {
+	track := suite.ownedTrack()
+	track.Pubkey = testOtherPubkey
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+
+	w, _ := suite.request("PUT", "/v1/tracks/track-123/compression-visibility", map[string]interface{}{
+		"version_updates": []models.VersionUpdate{{VersionID: "version-1", IsPublic: true}},
+	})
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestUpdateCompressionVisibility_Conflict() {
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(suite.ownedTrack(), nil)
+	suite.nostrTrackService.On("UpdateCompressionVisibility", mock.Anything, "track-123", mock.Anything).Return(services.ErrTrackUpdateConflict)
+
+	w, _ := suite.request("PUT", "/v1/tracks/track-123/compression-visibility", map[string]interface{}{
+		"version_updates": []models.VersionUpdate{{VersionID: "version-1", IsPublic: false}},
+	})
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestUpdateCompressionVisibility_ServiceError() {
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(suite.ownedTrack(), nil)
+	suite.nostrTrackService.On("UpdateCompressionVisibility", mock.Anything, "track-123", mock.Anything).Return(errors.New("version not found"))
+
+	w, response := suite.request("PUT", "/v1/tracks/track-123/compression-visibility", map[string]interface{}{
+		"version_updates": []models.VersionUpdate{{VersionID: "missing", IsPublic: true}},
+	})
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+	assert.Contains(suite.T(), errorMessage(response), "version not found")
+}
+
+func (suite *TracksHandlerTestSuite) TestRestoreTrack_QuotaExceeded() {
+	track := suite.ownedTrack()
+	track.Deleted = true
+	quotaErr := &services.QuotaExceededError{
+		Limit: "bytes",
+		Usage: models.StorageUsage{Tracks: 2, Bytes: 1 << 20},
+		Quota: models.TrackQuota{MaxBytes: 1 << 20},
+	}
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+	suite.nostrTrackService.On("RestoreTrack", mock.Anything, "track-123").Return(quotaErr)
+
+	w, response := suite.request("POST", "/v1/tracks/track-123/restore", nil)
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	assert.Equal(suite.T(), "storage limit reached", errorMessage(response))
+}
+
+func (suite *TracksHandlerTestSuite) TestRestoreTrack_Success() {
+	deleted := suite.ownedTrack()
+	deleted.Deleted = true
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(deleted, nil).Once()
+	suite.nostrTrackService.On("RestoreTrack", mock.Anything, "track-123").Return(nil)
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(suite.ownedTrack(), nil).Once()
+
+	w, response := suite.request("POST", "/v1/tracks/track-123/restore", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), true, response["success"])
+	assert.Equal(suite.T(), false, response["data"].(map[string]interface{})["deleted"])
+}
+
+func (suite *TracksHandlerTestSuite) TestRestoreTrack_QueuesUploadedTrack() {
+	deleted := suite.ownedTrack()
+	deleted.Deleted = true
+	deleted.Status = models.TrackStatusCancelled
+	uploaded := suite.ownedTrack()
+	uploaded.Status = models.TrackStatusUploaded
+	processing := suite.ownedTrack()
+	processing.Status = models.TrackStatusProcessing
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(deleted, nil).Once()
+	suite.nostrTrackService.On("RestoreTrack", mock.Anything, "track-123").Return(nil)
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(uploaded, nil).Once()
+	suite.processingService.On("ProcessTrackAsync", mock.Anything, "track-123", models.ProcessingTriggerRestore).Return(nil)
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(processing, nil).Once()
+
+	w, response := suite.request("POST", "/v1/tracks/track-123/restore", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), models.TrackStatusProcessing, response["data"].(map[string]interface{})["status"])
+}
+
+func (suite *TracksHandlerTestSuite) TestRestoreTrack_NotOwner() {
+	track := suite.ownedTrack()
+	track.Deleted = true
+	track.Pubkey = testOtherPubkey
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+
+	w, response := suite.request("POST", "/v1/tracks/track-123/restore", nil)
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	assert.Equal(suite.T(), "not authorized to restore this track", errorMessage(response))
+	suite.nostrTrackService.AssertNotCalled(suite.T(), "RestoreTrack", mock.Anything, mock.Anything)
+}
+
+func (suite *TracksHandlerTestSuite) TestRestoreTrack_Errors() {
+	tests := []struct {
+		err     error
+		status  int
+		message string
+	}{
+		{services.ErrTrackNotDeleted, http.StatusBadRequest, "track is not deleted"},
+		{services.ErrTrackPurged, http.StatusConflict, "track files were purged and can't be restored"},
+		{services.ErrTrackUpdateConflict, http.StatusConflict, "track was modified concurrently, please retry"},
+		{errors.New("firestore unavailable"), http.StatusInternalServerError, "failed to restore track"},
+	}
+
+	for i, tt := range tests {
+		trackID := fmt.Sprintf("track-%d", i)
+		track := suite.ownedTrack()
+		track.ID = trackID
+		suite.nostrTrackService.On("GetTrack", mock.Anything, trackID).Return(track, nil)
+		suite.nostrTrackService.On("RestoreTrack", mock.Anything, trackID).Return(tt.err)
+
+		w, response := suite.request("POST", "/v1/tracks/"+trackID+"/restore", nil)
+
+		assert.Equal(suite.T(), tt.status, w.Code, tt.message)
+		assert.Equal(suite.T(), tt.message, errorMessage(response))
+	}
+}
+
+func (suite *TracksHandlerTestSuite) TestUpdateNostrRef_Success() {
+	track := suite.ownedTrack()
+	ref := services.NostrRef{EventID: "ab12", Kind: 31337, DTag: "d-tag-1", Relays: []string{"wss://relay.wavlake.com"}}
+	updated := suite.ownedTrack()
+	updated.NostrEventID = "ab12"
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+	suite.nostrTrackService.On("SetNostrRef", mock.Anything, "track-123", ref).Return(updated, nil)
+
+	w, response := suite.request("PUT", "/v1/tracks/track-123/nostr-ref", map[string]interface{}{
+		"event_id":   "ab12",
+		"kind":       31337,
+		"d_tag":      "d-tag-1",
+		"relay_urls": []string{"wss://relay.wavlake.com"},
+	})
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "ab12", response["data"].(map[string]interface{})["nostr_event_id"])
+}
+
+func (suite *TracksHandlerTestSuite) TestUpdateNostrRef_MissingFields() {
+	w, _ := suite.request("PUT", "/v1/tracks/track-123/nostr-ref", map[string]interface{}{"d_tag": "d-tag-1"})
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestUpdateNostrRef_Errors() {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{services.ErrInvalidNostrEventID, http.StatusBadRequest},
+		{services.ErrInvalidNostrKind, http.StatusBadRequest},
+		{services.ErrPublicationInvalidRelayList, http.StatusBadRequest},
+		{services.ErrNostrDTagInUse, http.StatusConflict},
+		{services.ErrTrackUpdateConflict, http.StatusConflict},
+		{errors.New("firestore unavailable"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		suite.SetupTest()
+		suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(suite.ownedTrack(), nil)
+		suite.nostrTrackService.On("SetNostrRef", mock.Anything, "track-123", mock.Anything).Return(nil, tt.err)
+
+		w, _ := suite.request("PUT", "/v1/tracks/track-123/nostr-ref", map[string]interface{}{"event_id": "ab12", "kind": 31337})
+
+		assert.Equal(suite.T(), tt.status, w.Code, tt.err.Error())
+	}
+}
+
+func (suite *TracksHandlerTestSuite) TestUpdateNostrRef_NotOwner() {
+	track := suite.ownedTrack()
+	track.Pubkey = testOtherPubkey
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+
+	w, _ := suite.request("PUT", "/v1/tracks/track-123/nostr-ref", map[string]interface{}{"event_id": "ab12", "kind": 31337})
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+}
+
+// publishTrack posts event to the publish route as pubkey, whose track is
+// returned by GetTrack
+func (suite *TracksHandlerTestSuite) publishTrack(pubkey string, event *gonostr.Event) (*httptest.ResponseRecorder, map[string]interface{}) {
+	router := gin.New()
+	router.POST("/v1/tracks/:id/publish", func(c *gin.Context) {
+		c.Set("pubkey", pubkey)
+		c.Next()
+	}, suite.handlers.PublishTrack)
+
+	encoded, _ := json.Marshal(PublishTrackRequest{Event: event})
+	req, _ := http.NewRequest("POST", "/v1/tracks/track-123/publish", bytes.NewBuffer(encoded))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w, response
+}
+
+// publishableTrack returns a track owned by a fresh key with one public
+// version, and an event the key signed referencing it
+func (suite *TracksHandlerTestSuite) publishableTrack(extraTags ...gonostr.Tag) (*models.NostrTrack, *gonostr.Event) {
+	sk := gonostr.GeneratePrivateKey()
+	pk, err := gonostr.GetPublicKey(sk)
+	require.NoError(suite.T(), err)
+
+	track := suite.ownedTrack()
+	track.Pubkey = pk
+	track.CompressionVersions = []models.CompressionVersion{
+		{ID: "v1", URL: "https://cdn.example.com/track-123_v1.mp3", IsPublic: true},
+		{ID: "v2", URL: "https://cdn.example.com/track-123_v2.ogg"},
+	}
+
+	event := &gonostr.Event{
+		Kind:      31337,
+		CreatedAt: gonostr.Now(),
+		Tags:      append(gonostr.Tags{{"d", "track-123"}, {"imeta", "url " + track.CompressionVersions[0].URL}}, extraTags...),
+	}
+	require.NoError(suite.T(), event.Sign(sk))
+	return track, event
+}
+
+func (suite *TracksHandlerTestSuite) TestPublishTrack_Success() {
+	track, event := suite.publishableTrack()
+	results := []models.RelayPublishResult{
+		{Relay: "wss://relay.one", Accepted: true},
+		{Relay: "wss://relay.two", Message: "blocked: not allowed"},
+	}
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+	suite.nostrTrackService.On("PublishToRelays", mock.Anything, "track-123", mock.Anything).Return(track, results, nil)
+
+	w, response := suite.publishTrack(track.Pubkey, event)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), true, response["success"])
+	relays := response["relays"].([]interface{})
+	require.Len(suite.T(), relays, 2)
+	assert.Equal(suite.T(), "wss://relay.two", relays[1].(map[string]interface{})["relay"])
+	assert.Equal(suite.T(), "blocked: not allowed", relays[1].(map[string]interface{})["message"])
+}
+
+func (suite *TracksHandlerTestSuite) TestPublishTrack_NoRelayAccepted() {
+	track, event := suite.publishableTrack()
+	results := []models.RelayPublishResult{{Relay: "wss://relay.one", Message: "timed out waiting for OK"}}
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+	suite.nostrTrackService.On("PublishToRelays", mock.Anything, "track-123", mock.Anything).Return(track, results, nil)
+
+	w, response := suite.publishTrack(track.Pubkey, event)
+
+	assert.Equal(suite.T(), http.StatusBadGateway, w.Code)
+	assert.Equal(suite.T(), "no relay accepted the event", errorMessage(response))
+	details := response["error"].(map[string]interface{})["details"].(map[string]interface{})
+	assert.Len(suite.T(), details["relays"], 1)
+	assert.Equal(suite.T(), "track-123", details["track"].(map[string]interface{})["id"])
+}
+
+func (suite *TracksHandlerTestSuite) TestPublishTrack_Disabled() {
+	track, event := suite.publishableTrack()
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+	suite.nostrTrackService.On("PublishToRelays", mock.Anything, "track-123", mock.Anything).
+		Return(nil, nil, services.ErrRelayPublishingDisabled)
+
+	w, _ := suite.publishTrack(track.Pubkey, event)
+
+	assert.Equal(suite.T(), http.StatusServiceUnavailable, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestPublishTrack_PrivateVersion() {
+	track, event := suite.publishableTrack(gonostr.Tag{"url", "https://cdn.example.com/track-123_v2.ogg"})
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+
+	w, response := suite.publishTrack(track.Pubkey, event)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Contains(suite.T(), errorMessage(response), services.ErrPublicationPrivateURL.Error())
+	suite.nostrTrackService.AssertNotCalled(suite.T(), "PublishToRelays", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *TracksHandlerTestSuite) TestPublishTrack_SignedByAnotherKey() {
+	track, _ := suite.publishableTrack()
+	_, event := suite.publishableTrack()
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+
+	w, _ := suite.publishTrack(track.Pubkey, event)
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestPublishTrack_NotOwner() {
+	track, event := suite.publishableTrack()
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+
+	w, response := suite.publishTrack(testOtherPubkey, event)
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	assert.Equal(suite.T(), "not authorized to modify this track", errorMessage(response))
+}
+
+func TestTracksHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(TracksHandlerTestSuite))
+}
+
+type WebhookReplayTestSuite struct {
+	suite.Suite
+	router   *gin.Engine
+	handlers *TracksHandler
+	now      time.Time
+}
+
+func (suite *WebhookReplayTestSuite) SetupTest() {
+	gin.SetMode(gin.TestMode)
+
+	suite.now = time.Unix(1700000000, 0)
+	suite.handlers = NewTracksHandler(nil, nil, nil, nil, "", false)
+	suite.handlers.webhookGuard.now = func() time.Time { return suite.now }
+
+	suite.router = gin.New()
+	suite.router.POST("/v1/tracks/webhook/process", suite.handlers.ProcessTrackWebhook)
+}
+
+// postWebhook sends a payload with a status the handler rejects after the replay
+// check, so the tests never reach the track services
+func (suite *WebhookReplayTestSuite) postWebhook(timestamp int64, nonce string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"track_id":  "track-123",
+		"status":    "not-a-status",
+		"timestamp": timestamp,
+		"nonce":     nonce,
+	})
+
+	req, _ := http.NewRequest("POST", "/v1/tracks/webhook/process", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w, response
+}
+
+func (suite *WebhookReplayTestSuite) TestFreshDeliveryPassesReplayCheck() {
+	w, response := suite.postWebhook(suite.now.Unix(), "nonce-1")
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Equal(suite.T(), "invalid status", errorMessage(response))
+}
+
+func (suite *WebhookReplayTestSuite) TestExpiredTimestamp() {
+	w, response := suite.postWebhook(suite.now.Add(-10*time.Minute).Unix(), "nonce-1")
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	assert.Equal(suite.T(), WebhookErrorCodeExpired, errorCode(response))
+}
+
+func (suite *WebhookReplayTestSuite) TestFutureTimestamp() {
+	w, response := suite.postWebhook(suite.now.Add(10*time.Minute).Unix(), "nonce-1")
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	assert.Equal(suite.T(), WebhookErrorCodeExpired, errorCode(response))
+}
+
+func (suite *WebhookReplayTestSuite) TestMissingTimestampAndNonce() {
+	w, response := suite.postWebhook(0, "")
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	assert.Equal(suite.T(), WebhookErrorCodeExpired, errorCode(response))
+}
+
+func (suite *WebhookReplayTestSuite) TestDuplicateNonce() {
+	w, _ := suite.postWebhook(suite.now.Unix(), "nonce-1")
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	w, response := suite.postWebhook(suite.now.Unix(), "nonce-1")
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+	assert.Equal(suite.T(), WebhookErrorCodeReplay, errorCode(response))
+
+	// A different nonce is still accepted
+	w, _ = suite.postWebhook(suite.now.Unix(), "nonce-2")
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *WebhookReplayTestSuite) TestNonceForgottenAfterWindow() {
+	w, _ := suite.postWebhook(suite.now.Unix(), "nonce-1")
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	// Once the window has passed the old nonce is pruned; the new delivery
+	// carries a fresh timestamp so it is accepted
+	suite.now = suite.now.Add(3 * DefaultWebhookMaxAge)
+	w, _ = suite.postWebhook(suite.now.Unix(), "nonce-1")
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func TestWebhookReplayTestSuite(t *testing.T) {
+	suite.Run(t, new(WebhookReplayTestSuite))
+}
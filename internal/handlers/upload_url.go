@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+// UploadURLResponse represents a new presigned upload URL for a track
+type UploadURLResponse struct {
+	Success bool              `json:"success"`
+	Data    *models.UploadURL `json:"data,omitempty"`
+}
+
+// RenewUploadURL handles POST /v1/tracks/:id/upload-url
+// Signs a new upload URL for a track still waiting for its original, for
+// uploads that outlived the URL from track creation. Processed tracks are
+// refused with 409 unless ?replace=true, which resets processing so the new
+// file replaces the old one.
+func (h *TracksHandler) RenewUploadURL(c *gin.Context) {
+	trackID := c.Param("id")
+	if trackID == "" {
+		apierror.Respond(c, apierror.Validation("track ID is required"))
+		return
+	}
+
+	replace := false
+	if raw := c.Query("replace"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			apierror.Respond(c, apierror.Validation("replace must be true or false"))
+			return
+		}
+		replace = parsed
+	}
+
+	track, err := h.nostrTrackService.GetTrack(c.Request.Context(), trackID)
+	if err != nil || track.Deleted {
+		apierror.Respond(c, apierror.NotFound("track not found"))
+		return
+	}
+
+	pubkey, exists := c.Get("pubkey")
+	if !exists {
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	pubkeyStr, ok := pubkey.(string)
+	if !ok || track.Pubkey != pubkeyStr {
+		apierror.Respond(c, apierror.Forbidden("not authorized to upload to this track"))
+		return
+	}
+
+	upload, err := h.nostrTrackService.RenewUploadURL(c.Request.Context(), trackID, replace)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrTrackAlreadyProcessed):
+			apierror.Respond(c, services.ErrTrackAlreadyProcessed.WithMessage("track already processed; pass replace=true to upload a new file"))
+		case errors.Is(err, services.ErrTrackAlreadyProcessing):
+			apierror.Respond(c, services.ErrTrackAlreadyProcessing.WithMessage("track is processing"))
+		case errors.Is(err, services.ErrInvalidStatusTransition):
+			apierror.Respond(c, services.ErrInvalidStatusTransition.WithMessage("track can't accept an upload in its current status"))
+		case errors.Is(err, services.ErrTrackUpdateConflict):
+			apierror.Respond(c, apierror.Conflict("track was modified concurrently, please retry"))
+		default:
+			log.Printf("Failed to renew upload URL for track %s: %v", trackID, err)
+			apierror.Respond(c, apierror.Internal("failed to generate upload URL"))
+		}
+		return
+	}
+
+	// The signed URL is a credential for the original
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, UploadURLResponse{
+		Success: true,
+		Data:    upload,
+	})
+}
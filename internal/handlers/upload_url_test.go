@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+func (suite *TracksHandlerTestSuite) TestRenewUploadURL_PendingUpload() {
+	track := suite.ownedTrack()
+	track.Status = models.TrackStatusPendingUpload
+	upload := &models.UploadURL{
+		URL:       "https://storage.example.com/signed-put",
+		Method:    http.MethodPut,
+		Headers:   map[string]string{"Content-Type": "audio/wav"},
+		ExpiresIn: 3600,
+	}
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+	suite.nostrTrackService.On("RenewUploadURL", mock.Anything, "track-123", false).Return(upload, nil)
+
+	w, response := suite.request("POST", "/v1/tracks/track-123/upload-url", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "no-store", w.Header().Get("Cache-Control"))
+	data := response["data"].(map[string]interface{})
+	assert.Equal(suite.T(), "https://storage.example.com/signed-put", data["url"])
+	assert.Equal(suite.T(), "PUT", data["method"])
+	assert.Equal(suite.T(), map[string]interface{}{"Content-Type": "audio/wav"}, data["headers"])
+	assert.Equal(suite.T(), float64(3600), data["expires_in"])
+}
+
+func (suite *TracksHandlerTestSuite) TestRenewUploadURL_ProcessedTrack() {
+	track := suite.ownedTrack()
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+	suite.nostrTrackService.On("RenewUploadURL", mock.Anything, "track-123", false).Return(nil, services.ErrTrackAlreadyProcessed)
+
+	w, response := suite.request("POST", "/v1/tracks/track-123/upload-url", nil)
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+	assert.Contains(suite.T(), errorMessage(response), "replace=true")
+}
+
+func (suite *TracksHandlerTestSuite) TestRenewUploadURL_Replace() {
+	track := suite.ownedTrack()
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(track, nil)
+	suite.nostrTrackService.On("RenewUploadURL", mock.Anything, "track-123", true).Return(&models.UploadURL{URL: "https://storage.example.com/signed-put"}, nil)
+
+	w, _ := suite.request("POST", "/v1/tracks/track-123/upload-url?replace=true", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *TracksHandlerTestSuite) TestRenewUploadURL_Errors() {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{services.ErrTrackAlreadyProcessing, http.StatusConflict},
+		{services.ErrInvalidStatusTransition, http.StatusConflict},
+		{services.ErrTrackUpdateConflict, http.StatusConflict},
+		{errors.New("signing failed"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		suite.SetupTest()
+		suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(suite.ownedTrack(), nil)
+		suite.nostrTrackService.On("RenewUploadURL", mock.Anything, "track-123", false).Return(nil, tt.err)
+
+		w, _ := suite.request("POST", "/v1/tracks/track-123/upload-url", nil)
+		assert.Equal(suite.T(), tt.status, w.Code, tt.err.Error())
+	}
+}
+
+func (suite *TracksHandlerTestSuite) TestRenewUploadURL_Refused() {
+	notOwned := suite.ownedTrack()
+	notOwned.Pubkey = testOtherPubkey
+	deleted := suite.ownedTrack()
+	deleted.ID = "track-deleted"
+	deleted.Deleted = true
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-123").Return(notOwned, nil)
+	suite.nostrTrackService.On("GetTrack", mock.Anything, "track-deleted").Return(deleted, nil)
+
+	w, _ := suite.request("POST", "/v1/tracks/track-123/upload-url", nil)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+
+	w, _ = suite.request("POST", "/v1/tracks/track-deleted/upload-url", nil)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+
+	w, _ = suite.request("POST", "/v1/tracks/track-123/upload-url?replace=maybe", nil)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	suite.nostrTrackService.AssertNotCalled(suite.T(), "RenewUploadURL", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+// UsageResponse carries a user's usage and quota, for GET /v1/users/me/usage
+// and for requests rejected by a quota
+type UsageResponse struct {
+	Success bool                `json:"success"`
+	Data    *models.UsageReport `json:"data,omitempty"`
+}
+
+// respondQuotaExceeded writes a 403 with the user's usage and quota if err is
+// a QuotaExceededError, and reports whether it did
+func respondQuotaExceeded(c *gin.Context, err error) bool {
+	var quotaErr *services.QuotaExceededError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+
+	message := "track limit reached"
+	if quotaErr.Limit == "bytes" {
+		message = "storage limit reached"
+	}
+	apierror.Respond(c, apierror.Forbidden(message).WithCode("track.quota_exceeded").
+		WithDetails(&models.UsageReport{Usage: quotaErr.Usage, Quota: quotaErr.Quota}))
+	return true
+}
+
+// GetUsage handles GET /v1/users/me/usage
+// Returns the caller's track count and bytes used with their quota; zero
+// limits are unlimited
+func (h *UsersHandler) GetUsage(c *gin.Context) {
+	firebaseUID := c.GetString("firebase_uid")
+	if firebaseUID == "" {
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	report, err := h.nostrTrackService.GetUsage(c.Request.Context(), firebaseUID)
+	if err != nil {
+		log.Printf("Failed to load usage for user %s: %v", firebaseUID, err)
+		apierror.Respond(c, apierror.Internal("failed to load usage"))
+		return
+	}
+
+	c.JSON(http.StatusOK, UsageResponse{
+		Success: true,
+		Data:    report,
+	})
+}
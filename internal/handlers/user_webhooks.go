@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/services"
+)
+
+type UserWebhooksHandler struct {
+	webhookService services.WebhookServiceInterface
+}
+
+// NewUserWebhooksHandler creates a new user webhooks handler
+func NewUserWebhooksHandler(webhookService services.WebhookServiceInterface) *UserWebhooksHandler {
+	return &UserWebhooksHandler{
+		webhookService: webhookService,
+	}
+}
+
+// CreateWebhookRequest registers an endpoint for the caller's notifications
+type CreateWebhookRequest struct {
+	URL        string   `json:"url" binding:"required"`
+	Secret     string   `json:"secret" binding:"required"`
+	EventTypes []string `json:"event_types"` // Empty subscribes to every event
+}
+
+// CreateWebhook handles POST /v1/webhooks
+func (h *UserWebhooksHandler) CreateWebhook(c *gin.Context) {
+	firebaseUID := c.GetString("firebase_uid")
+	if firebaseUID == "" {
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	var req CreateWebhookRequest
+	if err := bindJSON(c, &req); err != nil {
+		apierror.Respond(c, bindError(err, "url and secret are required"))
+		return
+	}
+
+	webhook, err := h.webhookService.CreateWebhook(c.Request.Context(), firebaseUID, req.URL, req.Secret, req.EventTypes)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidWebhookURL),
+			errors.Is(err, services.ErrInvalidWebhookEvent),
+			errors.Is(err, services.ErrWebhookSecretTooShort):
+			apierror.Respond(c, apierror.Validation(err.Error()))
+		case errors.Is(err, services.ErrTooManyWebhooks):
+			apierror.Respond(c, apierror.Conflict(err.Error()))
+		default:
+			log.Printf("Failed to create webhook for user %s: %v", firebaseUID, err)
+			apierror.Respond(c, apierror.Internal("failed to create webhook"))
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": webhook})
+}
+
+// ListWebhooks handles GET /v1/webhooks
+func (h *UserWebhooksHandler) ListWebhooks(c *gin.Context) {
+	firebaseUID := c.GetString("firebase_uid")
+	if firebaseUID == "" {
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	webhooks, err := h.webhookService.ListWebhooks(c.Request.Context(), firebaseUID)
+	if err != nil {
+		log.Printf("Failed to list webhooks for user %s: %v", firebaseUID, err)
+		apierror.Respond(c, apierror.Internal("failed to retrieve webhooks"))
+		return
+	}
+	webhooks = nonNil(webhooks)
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": webhooks})
+}
+
+// DeleteWebhook handles DELETE /v1/webhooks/:id
+func (h *UserWebhooksHandler) DeleteWebhook(c *gin.Context) {
+	firebaseUID := c.GetString("firebase_uid")
+	if firebaseUID == "" {
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	if err := h.webhookService.DeleteWebhook(c.Request.Context(), firebaseUID, c.Param("id")); err != nil {
+		if errors.Is(err, services.ErrWebhookNotFound) {
+			apierror.Respond(c, apierror.NotFound("webhook not found"))
+			return
+		}
+		log.Printf("Failed to delete webhook %s: %v", c.Param("id"), err)
+		apierror.Respond(c, apierror.Internal("failed to delete webhook"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// TestWebhook handles POST /v1/webhooks/:id/test
+// Sends a webhook_test event and returns the delivery outcome; a failed
+// delivery is still a 200 with delivered=false
+func (h *UserWebhooksHandler) TestWebhook(c *gin.Context) {
+	firebaseUID := c.GetString("firebase_uid")
+	if firebaseUID == "" {
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	delivery, err := h.webhookService.TestWebhook(c.Request.Context(), firebaseUID, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, services.ErrWebhookNotFound) {
+			apierror.Respond(c, apierror.NotFound("webhook not found"))
+			return
+		}
+		log.Printf("Failed to test webhook %s: %v", c.Param("id"), err)
+		apierror.Respond(c, apierror.Internal("failed to test webhook"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": delivery})
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/wavlake/api/internal/mocks"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+type UserWebhooksHandlerTestSuite struct {
+	suite.Suite
+	router         *gin.Engine
+	webhookService *mocks.MockWebhookService
+	handlers       *UserWebhooksHandler
+}
+
+func (suite *UserWebhooksHandlerTestSuite) SetupTest() {
+	gin.SetMode(gin.TestMode)
+
+	suite.webhookService = &mocks.MockWebhookService{}
+	suite.handlers = NewUserWebhooksHandler(suite.webhookService)
+
+	suite.router = gin.New()
+	group := suite.router.Group("/v1/webhooks", func(c *gin.Context) {
+		c.Set("firebase_uid", "test-firebase-uid")
+		c.Next()
+	})
+	group.POST("", suite.handlers.CreateWebhook)
+	group.GET("", suite.handlers.ListWebhooks)
+	group.DELETE("/:id", suite.handlers.DeleteWebhook)
+	group.POST("/:id/test", suite.handlers.TestWebhook)
+}
+
+func (suite *UserWebhooksHandlerTestSuite) TearDownTest() {
+	suite.webhookService.AssertExpectations(suite.T())
+}
+
+func (suite *UserWebhooksHandlerTestSuite) do(method, path string, body interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+	var encoded []byte
+	if body != nil {
+		encoded, _ = json.Marshal(body)
+	}
+	req, _ := http.NewRequest(method, path, bytes.NewReader(encoded))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w, response
+}
+
+func (suite *UserWebhooksHandlerTestSuite) TestCreateWebhook_Success() {
+	webhook := &models.UserWebhook{
+		ID:         "hook-1",
+		URL:        "https://label.example.com/hook",
+		Secret:     "0123456789abcdef",
+		EventTypes: []string{models.NotificationTypeProcessingComplete},
+		Active:     true,
+		CreatedAt:  time.Now(),
+	}
+	suite.webhookService.On("CreateWebhook", mock.Anything, "test-firebase-uid", webhook.URL, webhook.Secret, webhook.EventTypes).Return(webhook, nil)
+
+	w, response := suite.do("POST", "/v1/webhooks", map[string]interface{}{
+		"url":         webhook.URL,
+		"secret":      webhook.Secret,
+		"event_types": webhook.EventTypes,
+	})
+
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+	data := response["data"].(map[string]interface{})
+	assert.Equal(suite.T(), "hook-1", data["id"])
+	assert.NotContains(suite.T(), data, "secret")
+}
+
+func (suite *UserWebhooksHandlerTestSuite) TestCreateWebhook_InvalidURL() {
+	suite.webhookService.On("CreateWebhook", mock.Anything, "test-firebase-uid", "http://example.com", "0123456789abcdef", []string(nil)).Return(nil, services.ErrInvalidWebhookURL)
+
+	w, response := suite.do("POST", "/v1/webhooks", map[string]interface{}{
+		"url":    "http://example.com",
+		"secret": "0123456789abcdef",
+	})
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Equal(suite.T(), services.ErrInvalidWebhookURL.Error(), errorMessage(response))
+}
+
+func (suite *UserWebhooksHandlerTestSuite) TestCreateWebhook_MissingFields() {
+	w, _ := suite.do("POST", "/v1/webhooks", map[string]interface{}{"url": "https://example.com"})
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *UserWebhooksHandlerTestSuite) TestCreateWebhook_TooMany() {
+	suite.webhookService.On("CreateWebhook", mock.Anything, "test-firebase-uid", "https://example.com", "0123456789abcdef", []string(nil)).Return(nil, services.ErrTooManyWebhooks)
+
+	w, _ := suite.do("POST", "/v1/webhooks", map[string]interface{}{
+		"url":    "https://example.com",
+		"secret": "0123456789abcdef",
+	})
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+}
+
+func (suite *UserWebhooksHandlerTestSuite) TestListWebhooks_Empty() {
+	suite.webhookService.On("ListWebhooks", mock.Anything, "test-firebase-uid").Return(nil, nil)
+
+	w, response := suite.do("GET", "/v1/webhooks", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), []interface{}{}, response["data"])
+}
+
+func (suite *UserWebhooksHandlerTestSuite) TestDeleteWebhook_NotFound() {
+	suite.webhookService.On("DeleteWebhook", mock.Anything, "test-firebase-uid", "hook-1").Return(services.ErrWebhookNotFound)
+
+	w, _ := suite.do("DELETE", "/v1/webhooks/hook-1", nil)
+
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *UserWebhooksHandlerTestSuite) TestTestWebhook_ReportsFailedDelivery() {
+	suite.webhookService.On("TestWebhook", mock.Anything, "test-firebase-uid", "hook-1").Return(&models.WebhookDelivery{
+		Delivered:  false,
+		StatusCode: http.StatusBadGateway,
+		Error:      "endpoint returned HTTP 502",
+	}, nil)
+
+	w, response := suite.do("POST", "/v1/webhooks/hook-1/test", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	data := response["data"].(map[string]interface{})
+	assert.Equal(suite.T(), false, data["delivered"])
+	assert.Equal(suite.T(), float64(http.StatusBadGateway), data["status_code"])
+}
+
+func (suite *UserWebhooksHandlerTestSuite) TestTestWebhook_ServiceError() {
+	suite.webhookService.On("TestWebhook", mock.Anything, "test-firebase-uid", "hook-1").Return(nil, errors.New("firestore unavailable"))
+
+	w, _ := suite.do("POST", "/v1/webhooks/hook-1/test", nil)
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
+
+func TestUserWebhooksHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(UserWebhooksHandlerTestSuite))
+}
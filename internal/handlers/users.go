@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+type UsersHandler struct {
+	profileService    services.ProfileServiceInterface
+	nostrTrackService services.NostrTrackServiceInterface
+	userService       services.UserServiceInterface
+}
+
+// NewUsersHandler creates a new users handler
+func NewUsersHandler(profileService services.ProfileServiceInterface, nostrTrackService services.NostrTrackServiceInterface, userService services.UserServiceInterface) *UsersHandler {
+	return &UsersHandler{
+		profileService:    profileService,
+		nostrTrackService: nostrTrackService,
+		userService:       userService,
+	}
+}
+
+// GetMe handles GET /v1/users/me
+// Returns the account overview, creating the user document on first use;
+// sections that failed to load are null and listed in warnings
+func (h *UsersHandler) GetMe(c *gin.Context) {
+	firebaseUID := c.GetString("firebase_uid")
+	if firebaseUID == "" {
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	profile, err := h.profileService.GetProfile(c.Request.Context(), firebaseUID)
+	if err != nil {
+		log.Printf("Failed to load profile for user %s: %v", firebaseUID, err)
+		apierror.Respond(c, apierror.Internal("failed to load profile"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": profile})
+}
+
+// UpdateMe handles PATCH /v1/users/me
+// Sets display_name, lightning_address and avatar_url; omitted fields are
+// unchanged and empty strings clear them. Returns the updated user document.
+func (h *UsersHandler) UpdateMe(c *gin.Context) {
+	firebaseUID := c.GetString("firebase_uid")
+	if firebaseUID == "" {
+		apierror.Respond(c, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	var update models.UserProfileUpdate
+	if err := bindJSON(c, &update); err != nil {
+		apierror.Respond(c, bindError(err, "invalid request body"))
+		return
+	}
+
+	user, err := h.userService.UpdateUserProfile(c.Request.Context(), firebaseUID, update)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidDisplayName),
+			errors.Is(err, services.ErrInvalidLightningAddress),
+			errors.Is(err, services.ErrInvalidAvatarURL),
+			errors.Is(err, services.ErrEmptyProfileUpdate):
+			apierror.Respond(c, apierror.Validation(err.Error()))
+		default:
+			log.Printf("Failed to update profile for user %s: %v", firebaseUID, err)
+			apierror.Respond(c, apierror.Internal("failed to update profile"))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": user})
+}
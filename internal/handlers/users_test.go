@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/wavlake/api/internal/mocks"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+type UsersHandlerTestSuite struct {
+	suite.Suite
+	router            *gin.Engine
+	profileService    *mocks.MockProfileService
+	nostrTrackService *mocks.MockNostrTrackService
+	userService       *mocks.MockUserService
+	handlers          *UsersHandler
+}
+
+func (suite *UsersHandlerTestSuite) SetupTest() {
+	gin.SetMode(gin.TestMode)
+
+	suite.profileService = &mocks.MockProfileService{}
+	suite.nostrTrackService = &mocks.MockNostrTrackService{}
+	suite.userService = &mocks.MockUserService{}
+	suite.handlers = NewUsersHandler(suite.profileService, suite.nostrTrackService, suite.userService)
+
+	suite.router = gin.New()
+	suite.router.GET("/v1/users/me", func(c *gin.Context) {
+		c.Set("firebase_uid", "test-firebase-uid")
+		c.Next()
+	}, suite.handlers.GetMe)
+	suite.router.GET("/v1/users/me/usage", func(c *gin.Context) {
+		c.Set("firebase_uid", "test-firebase-uid")
+		c.Next()
+	}, suite.handlers.GetUsage)
+	suite.router.PATCH("/v1/users/me", func(c *gin.Context) {
+		c.Set("firebase_uid", "test-firebase-uid")
+		c.Next()
+	}, suite.handlers.UpdateMe)
+	suite.router.GET("/v1/anonymous/me", suite.handlers.GetMe)
+	suite.router.PATCH("/v1/anonymous/me", suite.handlers.UpdateMe)
+	suite.router.GET("/v1/anonymous/me/usage", suite.handlers.GetUsage)
+}
+
+func (suite *UsersHandlerTestSuite) TearDownTest() {
+	suite.profileService.AssertExpectations(suite.T())
+	suite.nostrTrackService.AssertExpectations(suite.T())
+	suite.userService.AssertExpectations(suite.T())
+}
+
+func (suite *UsersHandlerTestSuite) TestGetMe_ReturnsProfile() {
+	profile := &models.UserProfile{
+		FirebaseUID: "test-firebase-uid",
+		User:        &models.User{FirebaseUID: "test-firebase-uid", ActivePubkeys: []string{"pk1"}},
+		Pubkeys:     []models.ProfilePubkey{{Pubkey: "pk1", Label: "laptop", Primary: true}},
+		Tracks:      &models.ProfileTrackSummary{Total: 3, Published: 1},
+		Storage:     &models.ProfileStorageUsage{OriginalBytes: 1024},
+		Legacy:      &models.ProfileLegacy{Exists: true, Name: "Artist"},
+	}
+	suite.profileService.On("GetProfile", mock.Anything, "test-firebase-uid").Return(profile, nil)
+
+	req, _ := http.NewRequest("GET", "/v1/users/me", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var response struct {
+		Success bool               `json:"success"`
+		Data    models.UserProfile `json:"data"`
+	}
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(suite.T(), response.Success)
+	assert.Equal(suite.T(), "laptop", response.Data.Pubkeys[0].Label)
+	assert.True(suite.T(), response.Data.Pubkeys[0].Primary)
+	assert.Equal(suite.T(), 3, response.Data.Tracks.Total)
+	assert.Equal(suite.T(), int64(1024), response.Data.Storage.OriginalBytes)
+	assert.True(suite.T(), response.Data.Legacy.Exists)
+}
+
+func (suite *UsersHandlerTestSuite) TestGetMe_DegradedSectionsAreNull() {
+	profile := &models.UserProfile{
+		FirebaseUID: "test-firebase-uid",
+		Pubkeys:     []models.ProfilePubkey{},
+		Tracks:      &models.ProfileTrackSummary{},
+		Storage:     &models.ProfileStorageUsage{},
+		Warnings:    []string{"legacy unavailable"},
+	}
+	suite.profileService.On("GetProfile", mock.Anything, "test-firebase-uid").Return(profile, nil)
+
+	req, _ := http.NewRequest("GET", "/v1/users/me", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var response struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &response))
+	data := response.Data
+	assert.Contains(suite.T(), data, "legacy")
+	assert.Nil(suite.T(), data["legacy"])
+	assert.Equal(suite.T(), []interface{}{"legacy unavailable"}, data["warnings"])
+}
+
+func (suite *UsersHandlerTestSuite) TestGetMe_ServiceError() {
+	suite.profileService.On("GetProfile", mock.Anything, "test-firebase-uid").Return(nil, errors.New("boom"))
+
+	req, _ := http.NewRequest("GET", "/v1/users/me", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
+
+func (suite *UsersHandlerTestSuite) TestGetMe_RequiresAuth() {
+	req, _ := http.NewRequest("GET", "/v1/anonymous/me", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *UsersHandlerTestSuite) TestGetUsage_ReturnsUsageAndQuota() {
+	report := &models.UsageReport{
+		Usage: models.StorageUsage{Tracks: 3, Bytes: 4096},
+		Quota: models.TrackQuota{MaxTracks: 10},
+	}
+	suite.nostrTrackService.On("GetUsage", mock.Anything, "test-firebase-uid").Return(report, nil)
+
+	req, _ := http.NewRequest("GET", "/v1/users/me/usage", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var response UsageResponse
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(suite.T(), response.Success)
+	assert.Equal(suite.T(), report, response.Data)
+}
+
+func (suite *UsersHandlerTestSuite) TestGetUsage_ServiceError() {
+	suite.nostrTrackService.On("GetUsage", mock.Anything, "test-firebase-uid").Return(nil, errors.New("boom"))
+
+	req, _ := http.NewRequest("GET", "/v1/users/me/usage", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
+
+func (suite *UsersHandlerTestSuite) TestGetUsage_RequiresAuth() {
+	req, _ := http.NewRequest("GET", "/v1/anonymous/me/usage", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *UsersHandlerTestSuite) patchMe(path, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("PATCH", path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *UsersHandlerTestSuite) TestUpdateMe_UpdatesProfile() {
+	name, address := "Night Owl", "owl@getalby.com"
+	update := models.UserProfileUpdate{DisplayName: &name, LightningAddress: &address}
+	user := &models.User{FirebaseUID: "test-firebase-uid", ActivePubkeys: []string{}, DisplayName: name, LightningAddress: address}
+	suite.userService.On("UpdateUserProfile", mock.Anything, "test-firebase-uid", update).Return(user, nil)
+
+	w := suite.patchMe("/v1/users/me", `{"display_name": "Night Owl", "lightning_address": "owl@getalby.com"}`)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var response struct {
+		Success bool        `json:"success"`
+		Data    models.User `json:"data"`
+	}
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(suite.T(), response.Success)
+	assert.Equal(suite.T(), *user, response.Data)
+}
+
+func (suite *UsersHandlerTestSuite) TestUpdateMe_EmailOptOut() {
+	optOut := true
+	update := models.UserProfileUpdate{EmailNotificationsOptOut: &optOut}
+	user := &models.User{FirebaseUID: "test-firebase-uid", ActivePubkeys: []string{}, EmailNotificationsOptOut: true}
+	suite.userService.On("UpdateUserProfile", mock.Anything, "test-firebase-uid", update).Return(user, nil)
+
+	w := suite.patchMe("/v1/users/me", `{"email_notifications_opt_out": true}`)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), `"email_notifications_opt_out":true`)
+}
+
+func (suite *UsersHandlerTestSuite) TestUpdateMe_InvalidFields() {
+	suite.userService.On("UpdateUserProfile", mock.Anything, "test-firebase-uid", mock.Anything).Return(nil, services.ErrInvalidLightningAddress)
+
+	w := suite.patchMe("/v1/users/me", `{"lightning_address": "owl"}`)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "user@domain")
+}
+
+func (suite *UsersHandlerTestSuite) TestUpdateMe_MalformedBody() {
+	w := suite.patchMe("/v1/users/me", `{"display_name": 7}`)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *UsersHandlerTestSuite) TestUpdateMe_ServiceError() {
+	suite.userService.On("UpdateUserProfile", mock.Anything, "test-firebase-uid", mock.Anything).Return(nil, errors.New("boom"))
+
+	w := suite.patchMe("/v1/users/me", `{"display_name": "Night Owl"}`)
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
+
+func (suite *UsersHandlerTestSuite) TestUpdateMe_RequiresAuth() {
+	w := suite.patchMe("/v1/anonymous/me", `{"display_name": "Night Owl"}`)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func TestUsersHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(UsersHandlerTestSuite))
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Webhook replay protection error codes returned to callers so monitoring can
+// distinguish stale or replayed deliveries from other webhook failures
+const (
+	WebhookErrorCodeExpired = "webhook_expired"
+	WebhookErrorCodeReplay  = "webhook_replay"
+)
+
+// DefaultWebhookMaxAge is how old a webhook delivery may be before it is rejected
+const DefaultWebhookMaxAge = 5 * time.Minute
+
+var (
+	errWebhookExpired = errors.New("webhook timestamp missing or outside the allowed window")
+	errWebhookReplay  = errors.New("webhook nonce has already been used")
+)
+
+// webhookReplayGuard rejects webhook deliveries that are too old or whose nonce
+// was already seen within the allowed window. Nonces only need to be remembered
+// for as long as their timestamp would still be accepted.
+type webhookReplayGuard struct {
+	mu     sync.Mutex
+	maxAge time.Duration
+	seen   map[string]time.Time
+	now    func() time.Time
+}
+
+func newWebhookReplayGuard(maxAge time.Duration) *webhookReplayGuard {
+	return &webhookReplayGuard{
+		maxAge: maxAge,
+		seen:   make(map[string]time.Time),
+		now:    time.Now,
+	}
+}
+
+// Check validates the timestamp (unix seconds) and nonce of a webhook delivery
+// and records the nonce if the delivery is accepted
+func (g *webhookReplayGuard) Check(timestamp int64, nonce string) error {
+	if timestamp == 0 || nonce == "" {
+		return errWebhookExpired
+	}
+
+	now := g.now()
+	sentAt := time.Unix(timestamp, 0)
+	if now.Sub(sentAt) > g.maxAge || sentAt.Sub(now) > g.maxAge {
+		return errWebhookExpired
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// Drop nonces whose deliveries would be rejected by the timestamp check anyway
+	for n, seenAt := range g.seen {
+		if now.Sub(seenAt) > 2*g.maxAge {
+			delete(g.seen, n)
+		}
+	}
+
+	if _, exists := g.seen[nonce]; exists {
+		return errWebhookReplay
+	}
+	g.seen[nonce] = now
+
+	return nil
+}
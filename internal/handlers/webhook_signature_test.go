@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// Known vector shared with cloud-function/main_test.go
+const (
+	testWebhookSecret    = "test-webhook-secret"
+	testWebhookTimestamp = "1700000000"
+	testWebhookBody      = `{"track_id":"track-123","status":"uploaded"}`
+	testWebhookSignature = "eddb164739fbcee455096ec353d277ca6c47f3be4974ad99ad389114f8fb7f21"
+)
+
+func TestSignWebhookBody_KnownKey(t *testing.T) {
+	assert.Equal(t, testWebhookSignature, signWebhookBody(testWebhookSecret, testWebhookTimestamp, []byte(testWebhookBody)))
+}
+
+func TestWebhookVerifier(t *testing.T) {
+	sentAt := time.Unix(1700000000, 0)
+	body := []byte(testWebhookBody)
+
+	tests := []struct {
+		name         string
+		secret       string
+		acceptLegacy bool
+		now          time.Time
+		signature    string
+		timestamp    string
+		legacy       string
+		body         []byte
+		want         error
+	}{
+		{"valid", testWebhookSecret, false, sentAt.Add(time.Minute), testWebhookSignature, testWebhookTimestamp, "", body, nil},
+		{"no secret configured", "", false, sentAt, "", "", "", body, nil},
+		{"missing signature", testWebhookSecret, false, sentAt, "", testWebhookTimestamp, "", body, errWebhookSignature},
+		{"tampered body", testWebhookSecret, false, sentAt, testWebhookSignature, testWebhookTimestamp, "", []byte(`{"track_id":"other"}`), errWebhookSignature},
+		{"tampered timestamp", testWebhookSecret, false, sentAt, testWebhookSignature, "1700000001", "", body, errWebhookSignature},
+		{"wrong key", "another-secret", false, sentAt, testWebhookSignature, testWebhookTimestamp, "", body, errWebhookSignature},
+		{"stale timestamp", testWebhookSecret, false, sentAt.Add(10 * time.Minute), testWebhookSignature, testWebhookTimestamp, "", body, errWebhookExpired},
+		{"future timestamp", testWebhookSecret, false, sentAt.Add(-10 * time.Minute), testWebhookSignature, testWebhookTimestamp, "", body, errWebhookExpired},
+		{"legacy secret rejected by default", testWebhookSecret, false, sentAt, "", "", testWebhookSecret, body, errWebhookSignature},
+		{"legacy secret accepted", testWebhookSecret, true, sentAt, "", "", testWebhookSecret, body, nil},
+		{"wrong legacy secret", testWebhookSecret, true, sentAt, "", "", "guess", body, errWebhookSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := newWebhookVerifier(tt.secret, tt.acceptLegacy, DefaultWebhookMaxAge)
+			verifier.now = func() time.Time { return tt.now }
+
+			assert.Equal(t, tt.want, verifier.Verify(tt.signature, tt.timestamp, tt.legacy, tt.body))
+		})
+	}
+}
+
+type WebhookSignatureTestSuite struct {
+	suite.Suite
+	router   *gin.Engine
+	handlers *TracksHandler
+	now      time.Time
+	body     []byte
+}
+
+func (suite *WebhookSignatureTestSuite) SetupTest() {
+	gin.SetMode(gin.TestMode)
+
+	suite.now = time.Unix(1700000000, 0)
+	suite.handlers = NewTracksHandler(nil, nil, nil, nil, "", false)
+	suite.handlers.webhookVerifier = newWebhookVerifier(testWebhookSecret, false, DefaultWebhookMaxAge)
+	suite.handlers.webhookVerifier.now = func() time.Time { return suite.now }
+	suite.handlers.webhookGuard.now = func() time.Time { return suite.now }
+
+	suite.router = gin.New()
+	suite.router.POST("/v1/tracks/webhook/process", suite.handlers.ProcessTrackWebhook)
+
+	// A status the handler rejects after authentication, so the tests never
+	// reach the track services
+	suite.body, _ = json.Marshal(map[string]interface{}{
+		"track_id":  "track-123",
+		"status":    "not-a-status",
+		"timestamp": suite.now.Unix(),
+		"nonce":     "nonce-1",
+	})
+}
+
+func (suite *WebhookSignatureTestSuite) post(headers map[string]string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	req, _ := http.NewRequest("POST", "/v1/tracks/webhook/process", bytes.NewBuffer(suite.body))
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w, response
+}
+
+func (suite *WebhookSignatureTestSuite) signedHeaders() map[string]string {
+	timestamp := strconv.FormatInt(suite.now.Unix(), 10)
+	return map[string]string{
+		WebhookSignatureHeader: signWebhookBody(testWebhookSecret, timestamp, suite.body),
+		WebhookTimestampHeader: timestamp,
+	}
+}
+
+func (suite *WebhookSignatureTestSuite) TestSignedDeliveryIsAccepted() {
+	w, response := suite.post(suite.signedHeaders())
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Equal(suite.T(), "invalid status", errorMessage(response))
+}
+
+func (suite *WebhookSignatureTestSuite) TestUnsignedDeliveryIsRejected() {
+	w, response := suite.post(nil)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	assert.Equal(suite.T(), WebhookErrorCodeSignature, errorCode(response))
+}
+
+func (suite *WebhookSignatureTestSuite) TestStaleSignatureIsRejected() {
+	headers := suite.signedHeaders()
+	suite.now = suite.now.Add(time.Hour)
+
+	w, response := suite.post(headers)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	assert.Equal(suite.T(), WebhookErrorCodeExpired, errorCode(response))
+}
+
+func (suite *WebhookSignatureTestSuite) TestLegacySecretNeedsCompatibilityFlag() {
+	w, _ := suite.post(map[string]string{WebhookSecretHeader: testWebhookSecret})
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+
+	suite.handlers.webhookVerifier.acceptLegacy = true
+	w, response := suite.post(map[string]string{WebhookSecretHeader: testWebhookSecret})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Equal(suite.T(), "invalid status", errorMessage(response))
+}
+
+func TestWebhookSignatureTestSuite(t *testing.T) {
+	suite.Run(t, new(WebhookSignatureTestSuite))
+}
@@ -0,0 +1,95 @@
+// Package logging sets up structured JSON logs and carries a request ID on
+// contexts so a track's lifecycle can be followed across requests and
+// background processing.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// RequestIDKey is the log attribute holding the request ID
+const RequestIDKey = "request_id"
+
+type requestIDContextKey struct{}
+
+// WithRequestID returns a copy of ctx carrying a request ID. An empty ID
+// leaves ctx unchanged.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	if requestID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDContextKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, if any
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(requestIDContextKey{}).(string)
+	return requestID
+}
+
+// FromContext returns the default logger, tagged with ctx's request ID when
+// it has one
+func FromContext(ctx context.Context) *slog.Logger {
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		return slog.Default().With(RequestIDKey, requestID)
+	}
+	return slog.Default()
+}
+
+// NewHandler returns a slog handler writing lines at level and above to w. A
+// nil level means info. format "text" writes human-readable lines for local
+// development; anything else writes JSON with the field names Cloud Logging
+// recognises (severity, message, time).
+func NewHandler(w io.Writer, format string, level slog.Leveler) slog.Handler {
+	if strings.EqualFold(format, "text") {
+		return slog.NewTextHandler(w, &slog.HandlerOptions{Level: level})
+	}
+	return slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level, ReplaceAttr: cloudLoggingAttr})
+}
+
+// ParseLevel reads a LOG_LEVEL value: debug, info, warn or error. Anything
+// else is info.
+func ParseLevel(value string) slog.Level {
+	switch strings.ToLower(value) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// cloudLoggingAttr renames slog's top-level level and msg keys to Cloud
+// Logging's severity and message
+func cloudLoggingAttr(groups []string, attr slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return attr
+	}
+	switch attr.Key {
+	case slog.LevelKey:
+		attr.Key = "severity"
+		if level, ok := attr.Value.Any().(slog.Level); ok && level == slog.LevelWarn {
+			attr.Value = slog.StringValue("WARNING")
+		}
+	case slog.MessageKey:
+		attr.Key = "message"
+	}
+	return attr
+}
+
+// Setup makes structured logging the default, in the format set by
+// LOG_FORMAT and at the level set by LOG_LEVEL. Lines written with the
+// standard log package go through it too.
+func Setup() {
+	slog.SetDefault(slog.New(NewHandler(os.Stderr, os.Getenv("LOG_FORMAT"), ParseLevel(os.Getenv("LOG_LEVEL")))))
+}
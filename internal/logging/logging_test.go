@@ -0,0 +1,69 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureLogs sends the default logger to a buffer of JSON lines for the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(NewHandler(&buf, "json", nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func decodeLine(t *testing.T, buf *bytes.Buffer) map[string]interface{} {
+	t.Helper()
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line), buf.String())
+	return line
+}
+
+func TestRequestIDContext(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, "", RequestIDFromContext(ctx))
+	assert.Equal(t, ctx, WithRequestID(ctx, ""))
+
+	ctx = WithRequestID(ctx, "req-1")
+	assert.Equal(t, "req-1", RequestIDFromContext(ctx))
+}
+
+func TestFromContextTagsRequestID(t *testing.T) {
+	buf := captureLogs(t)
+
+	FromContext(WithRequestID(context.Background(), "req-1")).Warn("processing failed", "track_id", "track-123")
+
+	line := decodeLine(t, buf)
+	assert.Equal(t, "req-1", line[RequestIDKey])
+	assert.Equal(t, "track-123", line["track_id"])
+	assert.Equal(t, "processing failed", line["message"])
+	assert.Equal(t, "WARNING", line["severity"])
+}
+
+func TestParseLevel(t *testing.T) {
+	assert.Equal(t, slog.LevelDebug, ParseLevel("DEBUG"))
+	assert.Equal(t, slog.LevelWarn, ParseLevel("warning"))
+	assert.Equal(t, slog.LevelError, ParseLevel("error"))
+	assert.Equal(t, slog.LevelInfo, ParseLevel(""))
+	assert.Equal(t, slog.LevelInfo, ParseLevel("verbose"))
+}
+
+func TestNewHandlerLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, "json", nil))
+	logger.Debug("hidden")
+	assert.Empty(t, buf.String(), "debug lines are dropped at the default level")
+
+	logger = slog.New(NewHandler(&buf, "json", slog.LevelDebug))
+	logger.Debug("shown")
+	assert.Equal(t, "DEBUG", decodeLine(t, &buf)["severity"])
+}
@@ -0,0 +1,104 @@
+package logging
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Request ID headers. X-Request-ID is echoed on every response.
+const (
+	RequestIDHeader         = "X-Request-ID"
+	CloudTraceContextHeader = "X-Cloud-Trace-Context" // "TRACE_ID/SPAN_ID;o=TRACE_TRUE"
+)
+
+// maxRequestIDLength bounds request IDs accepted from callers
+const maxRequestIDLength = 128
+
+// requestIDFromHeaders returns the caller's X-Request-ID, else the trace ID
+// from X-Cloud-Trace-Context, else a new ID
+func requestIDFromHeaders(requestID, traceContext string) string {
+	if validRequestID(requestID) {
+		return requestID
+	}
+	if traceID := traceIDFrom(traceContext); traceID != "" {
+		return traceID
+	}
+	return uuid.New().String()
+}
+
+// traceIDFrom returns the trace ID of an X-Cloud-Trace-Context value
+func traceIDFrom(traceContext string) string {
+	traceID, _, _ := strings.Cut(traceContext, "/")
+	traceID, _, _ = strings.Cut(traceID, ";")
+	if !validRequestID(traceID) {
+		return ""
+	}
+	return traceID
+}
+
+// validRequestID accepts short IDs of printable ASCII without spaces, so a
+// caller can't inject anything odd into logs or response headers
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range requestID {
+		if r <= ' ' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// Middleware gives each request an ID, stored on the request context and
+// echoed in X-Request-ID, and logs one structured line per request. It
+// replaces gin.Logger.
+func Middleware() gin.HandlerFunc {
+	projectID := os.Getenv("GOOGLE_CLOUD_PROJECT")
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		traceContext := c.GetHeader(CloudTraceContextHeader)
+		requestID := requestIDFromHeaders(c.GetHeader(RequestIDHeader), traceContext)
+
+		c.Request = c.Request.WithContext(WithRequestID(c.Request.Context(), requestID))
+		c.Set(RequestIDKey, requestID)
+		c.Header(RequestIDHeader, requestID)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		attrs := []any{
+			slog.String(RequestIDKey, requestID),
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if pubkey := c.GetString("pubkey"); pubkey != "" {
+			attrs = append(attrs, slog.String("pubkey", pubkey))
+		}
+		// Lets Cloud Logging group the line with the load balancer's trace
+		if traceID := traceIDFrom(traceContext); traceID != "" && projectID != "" {
+			attrs = append(attrs, slog.String("logging.googleapis.com/trace", "projects/"+projectID+"/traces/"+traceID))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		slog.Default().Log(c.Request.Context(), level, "request", attrs...)
+	}
+}
@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestIDFromHeaders(t *testing.T) {
+	assert.Equal(t, "req-1", requestIDFromHeaders("req-1", "105445aa7843bc8bf206b12000100000/1;o=1"))
+	assert.Equal(t, "105445aa7843bc8bf206b12000100000", requestIDFromHeaders("", "105445aa7843bc8bf206b12000100000/1;o=1"))
+	assert.Equal(t, "105445aa7843bc8bf206b12000100000", requestIDFromHeaders("has space", "105445aa7843bc8bf206b12000100000"))
+
+	generated := requestIDFromHeaders("", "")
+	assert.Len(t, generated, 36)
+	assert.NotEqual(t, generated, requestIDFromHeaders("", ""))
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "wavlake-test")
+	buf := captureLogs(t)
+
+	var handlerRequestID string
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/v1/tracks/:id", func(c *gin.Context) {
+		handlerRequestID = RequestIDFromContext(c.Request.Context())
+		c.Set("pubkey", "owner-pubkey")
+		c.Status(http.StatusNotFound)
+	})
+
+	req, _ := http.NewRequest("GET", "/v1/tracks/track-123", nil)
+	req.Header.Set(CloudTraceContextHeader, "105445aa7843bc8bf206b12000100000/1;o=1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, "105445aa7843bc8bf206b12000100000", handlerRequestID)
+	assert.Equal(t, handlerRequestID, w.Header().Get(RequestIDHeader))
+
+	line := decodeLine(t, buf)
+	assert.Equal(t, "request", line["message"])
+	assert.Equal(t, "WARNING", line["severity"])
+	assert.Equal(t, handlerRequestID, line[RequestIDKey])
+	assert.Equal(t, "GET", line["method"])
+	assert.Equal(t, "/v1/tracks/track-123", line["path"])
+	assert.Equal(t, float64(http.StatusNotFound), line["status"])
+	assert.Equal(t, "owner-pubkey", line["pubkey"])
+	assert.Contains(t, line, "latency")
+	assert.Equal(t, "projects/wavlake-test/traces/105445aa7843bc8bf206b12000100000", line["logging.googleapis.com/trace"])
+}
+
+func TestMiddlewarePropagatesRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	captureLogs(t)
+
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/heartbeat", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req, _ := http.NewRequest("GET", "/heartbeat", nil)
+	req.Header.Set(RequestIDHeader, "upload-abc")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, "upload-abc", w.Header().Get(RequestIDHeader))
+}
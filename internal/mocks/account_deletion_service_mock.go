@@ -0,0 +1,32 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+type MockAccountDeletionService struct {
+	mock.Mock
+}
+
+// Ensure MockAccountDeletionService implements AccountDeletionServiceInterface
+var _ services.AccountDeletionServiceInterface = (*MockAccountDeletionService)(nil)
+
+func (m *MockAccountDeletionService) RequestAccountDeletion(ctx context.Context, firebaseUID string, disableFirebaseAccount bool) (*models.AccountDeletionConfirmation, error) {
+	args := m.Called(ctx, firebaseUID, disableFirebaseAccount)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.AccountDeletionConfirmation), args.Error(1)
+}
+
+func (m *MockAccountDeletionService) ConfirmAccountDeletion(ctx context.Context, firebaseUID, code string) (*models.AccountDeletion, error) {
+	args := m.Called(ctx, firebaseUID, code)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.AccountDeletion), args.Error(1)
+}
@@ -0,0 +1,91 @@
+package mocks
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+	"github.com/wavlake/api/internal/utils"
+)
+
+type MockAudioProcessor struct {
+	mock.Mock
+}
+
+// Ensure MockAudioProcessor implements AudioProcessorInterface
+var _ services.AudioProcessorInterface = (*MockAudioProcessor)(nil)
+
+func (m *MockAudioProcessor) ValidateAudioFile(ctx context.Context, filePath string) error {
+	args := m.Called(ctx, filePath)
+	return args.Error(0)
+}
+
+func (m *MockAudioProcessor) CheckFormat(filePath, extension string) error {
+	args := m.Called(filePath, extension)
+	return args.Error(0)
+}
+
+func (m *MockAudioProcessor) GetAudioInfo(ctx context.Context, inputPath string) (*utils.AudioInfo, error) {
+	args := m.Called(ctx, inputPath)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*utils.AudioInfo), args.Error(1)
+}
+
+func (m *MockAudioProcessor) GetAudioTags(ctx context.Context, inputPath string) (*utils.AudioTags, error) {
+	args := m.Called(ctx, inputPath)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*utils.AudioTags), args.Error(1)
+}
+
+func (m *MockAudioProcessor) ExtractArtwork(ctx context.Context, inputPath, outputPath string) error {
+	args := m.Called(ctx, inputPath, outputPath)
+	return args.Error(0)
+}
+
+func (m *MockAudioProcessor) CompressAudio(ctx context.Context, inputPath, outputPath string) error {
+	args := m.Called(ctx, inputPath, outputPath)
+	return args.Error(0)
+}
+
+func (m *MockAudioProcessor) CompressAudioWithOptions(ctx context.Context, inputPath, outputPath string, options models.CompressionOption) error {
+	args := m.Called(ctx, inputPath, outputPath, options)
+	return args.Error(0)
+}
+
+func (m *MockAudioProcessor) CompressStream(ctx context.Context, input io.Reader, inputFormat string, output io.Writer, options models.CompressionOption) error {
+	args := m.Called(ctx, input, inputFormat, output, options)
+	return args.Error(0)
+}
+
+func (m *MockAudioProcessor) ProbeStream(ctx context.Context, input io.Reader, inputFormat string) (*utils.AudioInfo, error) {
+	args := m.Called(ctx, input, inputFormat)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*utils.AudioInfo), args.Error(1)
+}
+
+func (m *MockAudioProcessor) GenerateWaveform(ctx context.Context, inputPath string, buckets int) (*utils.Waveform, error) {
+	args := m.Called(ctx, inputPath, buckets)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*utils.Waveform), args.Error(1)
+}
+
+func (m *MockAudioProcessor) CreatePreview(ctx context.Context, inputPath, outputPath string, start, length time.Duration) error {
+	args := m.Called(ctx, inputPath, outputPath, start, length)
+	return args.Error(0)
+}
+
+func (m *MockAudioProcessor) IsFormatSupported(extension string) bool {
+	args := m.Called(extension)
+	return args.Bool(0)
+}
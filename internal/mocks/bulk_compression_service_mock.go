@@ -0,0 +1,32 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+type MockBulkCompressionService struct {
+	mock.Mock
+}
+
+// Ensure MockBulkCompressionService implements BulkCompressionServiceInterface
+var _ services.BulkCompressionServiceInterface = (*MockBulkCompressionService)(nil)
+
+func (m *MockBulkCompressionService) StartBulkCompression(ctx context.Context, pubkey string, trackIDs []string, all bool, options []models.CompressionOption) (*models.BulkCompressionJob, error) {
+	args := m.Called(ctx, pubkey, trackIDs, all, options)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.BulkCompressionJob), args.Error(1)
+}
+
+func (m *MockBulkCompressionService) GetBulkCompressionJob(ctx context.Context, pubkey, jobID string) (*models.BulkCompressionJob, error) {
+	args := m.Called(ctx, pubkey, jobID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.BulkCompressionJob), args.Error(1)
+}
@@ -0,0 +1,48 @@
+package mocks
+
+import (
+	"context"
+	"io"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+type MockExportService struct {
+	mock.Mock
+}
+
+// Ensure MockExportService implements ExportServiceInterface
+var _ services.ExportServiceInterface = (*MockExportService)(nil)
+
+func (m *MockExportService) CountTracks(ctx context.Context, firebaseUID string) (int, error) {
+	args := m.Called(ctx, firebaseUID)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockExportService) RequiresAsyncExport(trackCount int) bool {
+	args := m.Called(trackCount)
+	return args.Bool(0)
+}
+
+func (m *MockExportService) WriteExport(ctx context.Context, firebaseUID string, w io.Writer) error {
+	args := m.Called(ctx, firebaseUID, w)
+	return args.Error(0)
+}
+
+func (m *MockExportService) StartExportJob(ctx context.Context, firebaseUID string, trackCount int) (*models.ExportJob, error) {
+	args := m.Called(ctx, firebaseUID, trackCount)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ExportJob), args.Error(1)
+}
+
+func (m *MockExportService) GetExportJob(ctx context.Context, firebaseUID, jobID string) (*models.ExportJob, error) {
+	args := m.Called(ctx, firebaseUID, jobID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ExportJob), args.Error(1)
+}
@@ -0,0 +1,24 @@
+package mocks
+
+import (
+	"context"
+
+	firebaseauth "firebase.google.com/go/v4/auth"
+	"github.com/stretchr/testify/mock"
+	"github.com/wavlake/api/internal/auth"
+)
+
+type MockIDTokenVerifier struct {
+	mock.Mock
+}
+
+// Ensure MockIDTokenVerifier implements IDTokenVerifier
+var _ auth.IDTokenVerifier = (*MockIDTokenVerifier)(nil)
+
+func (m *MockIDTokenVerifier) VerifyIDToken(ctx context.Context, idToken string) (*firebaseauth.Token, error) {
+	args := m.Called(ctx, idToken)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*firebaseauth.Token), args.Error(1)
+}
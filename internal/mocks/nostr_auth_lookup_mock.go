@@ -0,0 +1,30 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/wavlake/api/internal/auth"
+	"github.com/wavlake/api/internal/models"
+)
+
+type MockNostrAuthLookup struct {
+	mock.Mock
+}
+
+// Ensure MockNostrAuthLookup implements NostrAuthLookup
+var _ auth.NostrAuthLookup = (*MockNostrAuthLookup)(nil)
+
+func (m *MockNostrAuthLookup) GetActiveAuthByPubkey(ctx context.Context, pubkey string) (*models.NostrAuth, error) {
+	args := m.Called(ctx, pubkey)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.NostrAuth), args.Error(1)
+}
+
+func (m *MockNostrAuthLookup) TouchLastUsed(ctx context.Context, pubkey string, at time.Time) error {
+	args := m.Called(ctx, pubkey, at)
+	return args.Error(0)
+}
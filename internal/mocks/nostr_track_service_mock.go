@@ -0,0 +1,245 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	gonostr "github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/mock"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+type MockNostrTrackService struct {
+	mock.Mock
+}
+
+// Ensure MockNostrTrackService implements NostrTrackServiceInterface
+var _ services.NostrTrackServiceInterface = (*MockNostrTrackService)(nil)
+
+func (m *MockNostrTrackService) Events() *services.TrackEventHub {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).(*services.TrackEventHub)
+}
+
+func (m *MockNostrTrackService) ChooseRegion(hint, country string) (string, error) {
+	args := m.Called(hint, country)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockNostrTrackService) CreateTrack(ctx context.Context, pubkey, firebaseUID, extension, region, dTag string) (*models.NostrTrack, error) {
+	args := m.Called(ctx, pubkey, firebaseUID, extension, region, dTag)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.NostrTrack), args.Error(1)
+}
+
+func (m *MockNostrTrackService) GetTrack(ctx context.Context, trackID string) (*models.NostrTrack, error) {
+	args := m.Called(ctx, trackID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.NostrTrack), args.Error(1)
+}
+
+func (m *MockNostrTrackService) GetTracksByPubkey(ctx context.Context, pubkey string) ([]*models.NostrTrack, error) {
+	args := m.Called(ctx, pubkey)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.NostrTrack), args.Error(1)
+}
+
+func (m *MockNostrTrackService) ListAllTracksByPubkey(ctx context.Context, pubkey string) ([]*models.NostrTrack, error) {
+	args := m.Called(ctx, pubkey)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.NostrTrack), args.Error(1)
+}
+
+func (m *MockNostrTrackService) ListTracksByPubkey(ctx context.Context, pubkey string, limit int, cursor string) ([]*models.NostrTrack, string, error) {
+	args := m.Called(ctx, pubkey, limit, cursor)
+	if args.Get(0) == nil {
+		return nil, args.String(1), args.Error(2)
+	}
+	return args.Get(0).([]*models.NostrTrack), args.String(1), args.Error(2)
+}
+
+func (m *MockNostrTrackService) TransitionTrack(ctx context.Context, trackID, status string, updates map[string]interface{}) error {
+	args := m.Called(ctx, trackID, status, updates)
+	return args.Error(0)
+}
+
+func (m *MockNostrTrackService) ClaimIdempotencyKey(ctx context.Context, key, trackID string) (bool, error) {
+	args := m.Called(ctx, key, trackID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockNostrTrackService) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+func (m *MockNostrTrackService) MarkTrackAsProcessed(ctx context.Context, trackID string, size int64, duration int) error {
+	args := m.Called(ctx, trackID, size, duration)
+	return args.Error(0)
+}
+
+func (m *MockNostrTrackService) MarkTrackAsCompressed(ctx context.Context, trackID, compressedURL string) error {
+	args := m.Called(ctx, trackID, compressedURL)
+	return args.Error(0)
+}
+
+func (m *MockNostrTrackService) MarkOriginalDeleted(ctx context.Context, trackID string) (bool, error) {
+	args := m.Called(ctx, trackID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockNostrTrackService) DeleteTrack(ctx context.Context, trackID string) error {
+	args := m.Called(ctx, trackID)
+	return args.Error(0)
+}
+
+func (m *MockNostrTrackService) RestoreTrack(ctx context.Context, trackID string) error {
+	args := m.Called(ctx, trackID)
+	return args.Error(0)
+}
+
+func (m *MockNostrTrackService) PurgeTrackFiles(ctx context.Context, track *models.NostrTrack, dryRun bool) (*models.TrackPurge, error) {
+	args := m.Called(ctx, track, dryRun)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.TrackPurge), args.Error(1)
+}
+
+func (m *MockNostrTrackService) RecordPublication(ctx context.Context, trackID string, event *gonostr.Event, relays []string) (*models.NostrTrack, error) {
+	args := m.Called(ctx, trackID, event, relays)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.NostrTrack), args.Error(1)
+}
+
+func (m *MockNostrTrackService) SetNostrRef(ctx context.Context, trackID string, ref services.NostrRef) (*models.NostrTrack, error) {
+	args := m.Called(ctx, trackID, ref)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.NostrTrack), args.Error(1)
+}
+
+func (m *MockNostrTrackService) PublishToRelays(ctx context.Context, trackID string, event *gonostr.Event) (*models.NostrTrack, []models.RelayPublishResult, error) {
+	args := m.Called(ctx, trackID, event)
+	var results []models.RelayPublishResult
+	if args.Get(1) != nil {
+		results = args.Get(1).([]models.RelayPublishResult)
+	}
+	if args.Get(0) == nil {
+		return nil, results, args.Error(2)
+	}
+	return args.Get(0).(*models.NostrTrack), results, args.Error(2)
+}
+
+func (m *MockNostrTrackService) BuildNostrEventDraft(ctx context.Context, track *models.NostrTrack) (*gonostr.Event, error) {
+	args := m.Called(ctx, track)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*gonostr.Event), args.Error(1)
+}
+
+func (m *MockNostrTrackService) UpdateCompressionVisibility(ctx context.Context, trackID string, updates []models.VersionUpdate) error {
+	args := m.Called(ctx, trackID, updates)
+	return args.Error(0)
+}
+
+func (m *MockNostrTrackService) AddOrUpdateCompressionVersion(ctx context.Context, trackID string, report models.CompressionVersion) (*models.CompressionVersion, error) {
+	args := m.Called(ctx, trackID, report)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.CompressionVersion), args.Error(1)
+}
+
+func (m *MockNostrTrackService) RecordCompressedObject(ctx context.Context, trackID, versionID string, size int64) (*models.CompressionVersion, error) {
+	args := m.Called(ctx, trackID, versionID, size)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.CompressionVersion), args.Error(1)
+}
+
+func (m *MockNostrTrackService) ListProcessingHistory(ctx context.Context, trackID string, limit int, cursor string) ([]models.ProcessingAttempt, string, error) {
+	args := m.Called(ctx, trackID, limit, cursor)
+	if args.Get(0) == nil {
+		return nil, args.String(1), args.Error(2)
+	}
+	return args.Get(0).([]models.ProcessingAttempt), args.String(1), args.Error(2)
+}
+
+func (m *MockNostrTrackService) CreateShareLink(ctx context.Context, trackID string, ttl time.Duration, maxUses int) (*models.ShareLink, error) {
+	args := m.Called(ctx, trackID, ttl, maxUses)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ShareLink), args.Error(1)
+}
+
+func (m *MockNostrTrackService) ListShareLinks(ctx context.Context, trackID string) ([]models.ShareLink, error) {
+	args := m.Called(ctx, trackID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.ShareLink), args.Error(1)
+}
+
+func (m *MockNostrTrackService) RevokeShareLink(ctx context.Context, trackID, linkID string) error {
+	args := m.Called(ctx, trackID, linkID)
+	return args.Error(0)
+}
+
+func (m *MockNostrTrackService) OpenShareLink(ctx context.Context, token string) (*models.NostrTrack, *models.ShareLink, error) {
+	args := m.Called(ctx, token)
+	if args.Get(0) == nil {
+		return nil, nil, args.Error(2)
+	}
+	return args.Get(0).(*models.NostrTrack), args.Get(1).(*models.ShareLink), args.Error(2)
+}
+
+func (m *MockNostrTrackService) SignSharedStreams(ctx context.Context, track *models.NostrTrack) ([]models.SharedStream, error) {
+	args := m.Called(ctx, track)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.SharedStream), args.Error(1)
+}
+
+func (m *MockNostrTrackService) GetUsage(ctx context.Context, firebaseUID string) (*models.UsageReport, error) {
+	args := m.Called(ctx, firebaseUID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.UsageReport), args.Error(1)
+}
+
+func (m *MockNostrTrackService) SignOriginalDownload(ctx context.Context, track *models.NostrTrack, expiration time.Duration) (*models.OriginalDownload, error) {
+	args := m.Called(ctx, track, expiration)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.OriginalDownload), args.Error(1)
+}
+
+func (m *MockNostrTrackService) RenewUploadURL(ctx context.Context, trackID string, replace bool) (*models.UploadURL, error) {
+	args := m.Called(ctx, trackID, replace)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.UploadURL), args.Error(1)
+}
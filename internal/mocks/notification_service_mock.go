@@ -0,0 +1,35 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+type MockNotificationService struct {
+	mock.Mock
+}
+
+// Ensure MockNotificationService implements NotificationServiceInterface
+var _ services.NotificationServiceInterface = (*MockNotificationService)(nil)
+
+func (m *MockNotificationService) Notify(notification models.Notification) {
+	m.Called(notification)
+}
+
+func (m *MockNotificationService) CreateNotification(ctx context.Context, notification models.Notification) (bool, error) {
+	args := m.Called(ctx, notification)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockNotificationService) ListNotifications(ctx context.Context, firebaseUID string, unreadOnly bool, limit int, cursor string) ([]models.Notification, string, error) {
+	args := m.Called(ctx, firebaseUID, unreadOnly, limit, cursor)
+	return args.Get(0).([]models.Notification), args.String(1), args.Error(2)
+}
+
+func (m *MockNotificationService) MarkNotificationRead(ctx context.Context, firebaseUID, notificationID string) error {
+	args := m.Called(ctx, firebaseUID, notificationID)
+	return args.Error(0)
+}
@@ -0,0 +1,80 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+type MockPostgresService struct {
+	mock.Mock
+}
+
+// Ensure MockPostgresService implements PostgresServiceInterface
+var _ services.PostgresServiceInterface = (*MockPostgresService)(nil)
+
+func (m *MockPostgresService) GetUserByFirebaseUID(ctx context.Context, firebaseUID string) (*models.LegacyUser, error) {
+	args := m.Called(ctx, firebaseUID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.LegacyUser), args.Error(1)
+}
+
+func (m *MockPostgresService) GetUserTracks(ctx context.Context, firebaseUID string, filter services.LegacyTrackFilter) ([]models.LegacyTrack, int, error) {
+	args := m.Called(ctx, firebaseUID, filter)
+	if args.Get(0) == nil {
+		return nil, args.Int(1), args.Error(2)
+	}
+	return args.Get(0).([]models.LegacyTrack), args.Int(1), args.Error(2)
+}
+
+func (m *MockPostgresService) GetUserArtists(ctx context.Context, firebaseUID string) ([]models.LegacyArtist, error) {
+	args := m.Called(ctx, firebaseUID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.LegacyArtist), args.Error(1)
+}
+
+func (m *MockPostgresService) GetUserAlbums(ctx context.Context, firebaseUID string) ([]models.LegacyAlbum, error) {
+	args := m.Called(ctx, firebaseUID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.LegacyAlbum), args.Error(1)
+}
+
+func (m *MockPostgresService) GetTracksByArtist(ctx context.Context, artistID string, filter services.LegacyTrackFilter) ([]models.LegacyTrack, int, error) {
+	args := m.Called(ctx, artistID, filter)
+	if args.Get(0) == nil {
+		return nil, args.Int(1), args.Error(2)
+	}
+	return args.Get(0).([]models.LegacyTrack), args.Int(1), args.Error(2)
+}
+
+func (m *MockPostgresService) GetTracksByAlbum(ctx context.Context, albumID string, filter services.LegacyTrackFilter) ([]models.LegacyTrack, int, error) {
+	args := m.Called(ctx, albumID, filter)
+	if args.Get(0) == nil {
+		return nil, args.Int(1), args.Error(2)
+	}
+	return args.Get(0).([]models.LegacyTrack), args.Int(1), args.Error(2)
+}
+
+func (m *MockPostgresService) SearchUserCatalog(ctx context.Context, firebaseUID, query, searchType string, limit int) ([]models.LegacySearchResult, error) {
+	args := m.Called(ctx, firebaseUID, query, searchType, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.LegacySearchResult), args.Error(1)
+}
+
+func (m *MockPostgresService) GetUserEarnings(ctx context.Context, firebaseUID string) (*models.LegacyEarnings, error) {
+	args := m.Called(ctx, firebaseUID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.LegacyEarnings), args.Error(1)
+}
@@ -0,0 +1,47 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+type MockProcessingService struct {
+	mock.Mock
+}
+
+// Ensure MockProcessingService implements ProcessingServiceInterface
+var _ services.ProcessingServiceInterface = (*MockProcessingService)(nil)
+
+func (m *MockProcessingService) ProcessTrackAsync(ctx context.Context, trackID, triggeredBy string) error {
+	args := m.Called(ctx, trackID, triggeredBy)
+	return args.Error(0)
+}
+
+func (m *MockProcessingService) ReprocessTrackAsync(ctx context.Context, trackID string) error {
+	args := m.Called(ctx, trackID)
+	return args.Error(0)
+}
+
+func (m *MockProcessingService) ReconcileStuckTracks(ctx context.Context) (*models.ReconcileResult, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ReconcileResult), args.Error(1)
+}
+
+func (m *MockProcessingService) CancelProcessing(trackID string) int {
+	args := m.Called(trackID)
+	return args.Int(0)
+}
+
+func (m *MockProcessingService) RequestCompressionVersions(ctx context.Context, trackID string, compressionOptions []models.CompressionOption) (*models.CompressionRequestResult, error) {
+	args := m.Called(ctx, trackID, compressionOptions)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.CompressionRequestResult), args.Error(1)
+}
@@ -0,0 +1,24 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+type MockProfileService struct {
+	mock.Mock
+}
+
+// Ensure MockProfileService implements ProfileServiceInterface
+var _ services.ProfileServiceInterface = (*MockProfileService)(nil)
+
+func (m *MockProfileService) GetProfile(ctx context.Context, firebaseUID string) (*models.UserProfile, error) {
+	args := m.Called(ctx, firebaseUID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.UserProfile), args.Error(1)
+}
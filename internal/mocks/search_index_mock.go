@@ -0,0 +1,24 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+type MockSearchIndex struct {
+	mock.Mock
+}
+
+// Ensure MockSearchIndex implements SearchIndex
+var _ services.SearchIndex = (*MockSearchIndex)(nil)
+
+func (m *MockSearchIndex) SearchTracks(ctx context.Context, query string, limit int, cursor string) ([]*models.NostrTrack, string, error) {
+	args := m.Called(ctx, query, limit, cursor)
+	if args.Get(0) == nil {
+		return nil, args.String(1), args.Error(2)
+	}
+	return args.Get(0).([]*models.NostrTrack), args.String(1), args.Error(2)
+}
@@ -15,9 +15,12 @@ type MockUserService struct {
 // Ensure MockUserService implements UserServiceInterface
 var _ services.UserServiceInterface = (*MockUserService)(nil)
 
-func (m *MockUserService) LinkPubkeyToUser(ctx context.Context, pubkey, firebaseUID string) error {
+func (m *MockUserService) LinkPubkeyToUser(ctx context.Context, pubkey, firebaseUID string) (*models.NostrAuth, bool, error) {
 	args := m.Called(ctx, pubkey, firebaseUID)
-	return args.Error(0)
+	if args.Get(0) == nil {
+		return nil, args.Bool(1), args.Error(2)
+	}
+	return args.Get(0).(*models.NostrAuth), args.Bool(1), args.Error(2)
 }
 
 func (m *MockUserService) UnlinkPubkeyFromUser(ctx context.Context, pubkey, firebaseUID string) error {
@@ -35,7 +38,55 @@ func (m *MockUserService) GetFirebaseUIDByPubkey(ctx context.Context, pubkey str
 	return args.String(0), args.Error(1)
 }
 
+func (m *MockUserService) GetPubkeyLink(ctx context.Context, pubkey string) (*models.NostrAuth, error) {
+	args := m.Called(ctx, pubkey)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.NostrAuth), args.Error(1)
+}
+
+func (m *MockUserService) ArePubkeysLinked(ctx context.Context, pubkeys []string) (map[string]bool, error) {
+	args := m.Called(ctx, pubkeys)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]bool), args.Error(1)
+}
+
 func (m *MockUserService) GetUserEmail(ctx context.Context, firebaseUID string) (string, error) {
 	args := m.Called(ctx, firebaseUID)
 	return args.String(0), args.Error(1)
 }
+
+func (m *MockUserService) GetOrCreateUser(ctx context.Context, firebaseUID string) (*models.User, error) {
+	args := m.Called(ctx, firebaseUID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockUserService) UpdateUserProfile(ctx context.Context, firebaseUID string, update models.UserProfileUpdate) (*models.User, error) {
+	args := m.Called(ctx, firebaseUID, update)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockUserService) GetPubkeyHistory(ctx context.Context, firebaseUID string) ([]models.NostrAuthEvent, error) {
+	args := m.Called(ctx, firebaseUID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.NostrAuthEvent), args.Error(1)
+}
+
+func (m *MockUserService) GetPubkeyHistoryByPubkey(ctx context.Context, pubkey string) ([]models.NostrAuthEvent, error) {
+	args := m.Called(ctx, pubkey)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.NostrAuthEvent), args.Error(1)
+}
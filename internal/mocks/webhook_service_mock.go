@@ -0,0 +1,49 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/services"
+)
+
+type MockWebhookService struct {
+	mock.Mock
+}
+
+// Ensure MockWebhookService implements WebhookServiceInterface
+var _ services.WebhookServiceInterface = (*MockWebhookService)(nil)
+
+func (m *MockWebhookService) CreateWebhook(ctx context.Context, firebaseUID, url, secret string, eventTypes []string) (*models.UserWebhook, error) {
+	args := m.Called(ctx, firebaseUID, url, secret, eventTypes)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.UserWebhook), args.Error(1)
+}
+
+func (m *MockWebhookService) ListWebhooks(ctx context.Context, firebaseUID string) ([]models.UserWebhook, error) {
+	args := m.Called(ctx, firebaseUID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.UserWebhook), args.Error(1)
+}
+
+func (m *MockWebhookService) DeleteWebhook(ctx context.Context, firebaseUID, webhookID string) error {
+	args := m.Called(ctx, firebaseUID, webhookID)
+	return args.Error(0)
+}
+
+func (m *MockWebhookService) TestWebhook(ctx context.Context, firebaseUID, webhookID string) (*models.WebhookDelivery, error) {
+	args := m.Called(ctx, firebaseUID, webhookID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockWebhookService) Dispatch(notification models.Notification) {
+	m.Called(notification)
+}
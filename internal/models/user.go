@@ -3,10 +3,52 @@ package models
 import "time"
 
 type User struct {
-	FirebaseUID   string    `firestore:"firebase_uid"` // Primary key
-	CreatedAt     time.Time `firestore:"created_at"`
-	UpdatedAt     time.Time `firestore:"updated_at"`
-	ActivePubkeys []string  `firestore:"active_pubkeys"` // Denormalized for quick lookup
+	FirebaseUID   string    `firestore:"firebase_uid" json:"firebase_uid"` // Primary key
+	CreatedAt     time.Time `firestore:"created_at" json:"created_at"`
+	UpdatedAt     time.Time `firestore:"updated_at" json:"updated_at"`
+	ActivePubkeys []string  `firestore:"active_pubkeys" json:"active_pubkeys"`                     // Denormalized for quick lookup
+	PrimaryPubkey string    `firestore:"primary_pubkey,omitempty" json:"primary_pubkey,omitempty"` // Defaults to the earliest linked pubkey
+
+	// Profile fields set with PATCH /v1/users/me
+	DisplayName      string `firestore:"display_name,omitempty" json:"display_name,omitempty"`
+	LightningAddress string `firestore:"lightning_address,omitempty" json:"lightning_address,omitempty"`
+	AvatarURL        string `firestore:"avatar_url,omitempty" json:"avatar_url,omitempty"`
+
+	// EmailNotificationsOptOut disables processing failure emails
+	EmailNotificationsOptOut bool `firestore:"email_notifications_opt_out" json:"email_notifications_opt_out"`
+
+	// Usage counts the user's non-deleted tracks for quotas. Unset until the
+	// user's first track change after quotas were introduced.
+	Usage *StorageUsage `firestore:"usage,omitempty" json:"usage,omitempty"`
+}
+
+// UserProfileUpdate changes a user's profile fields. Nil fields are left as
+// they are and empty strings clear them.
+type UserProfileUpdate struct {
+	DisplayName              *string `json:"display_name"`
+	LightningAddress         *string `json:"lightning_address"`
+	AvatarURL                *string `json:"avatar_url"`
+	EmailNotificationsOptOut *bool   `json:"email_notifications_opt_out"`
+}
+
+// StorageUsage counts a user's non-deleted tracks and the bytes of their
+// original uploads
+type StorageUsage struct {
+	Tracks int   `firestore:"tracks" json:"tracks"`
+	Bytes  int64 `firestore:"bytes" json:"bytes"`
+}
+
+// TrackQuota limits a user's StorageUsage. Zero means unlimited.
+type TrackQuota struct {
+	MaxTracks int   `json:"max_tracks"`
+	MaxBytes  int64 `json:"max_bytes"`
+}
+
+// UsageReport is a user's usage alongside their quota, returned by
+// GET /v1/users/me/usage and when a quota is exceeded
+type UsageReport struct {
+	Usage StorageUsage `json:"usage"`
+	Quota TrackQuota   `json:"quota"`
 }
 
 type NostrAuth struct {
@@ -15,7 +57,67 @@ type NostrAuth struct {
 	Active      bool      `firestore:"active"`
 	CreatedAt   time.Time `firestore:"created_at"`
 	LastUsedAt  time.Time `firestore:"last_used_at"`
-	LinkedAt    time.Time `firestore:"linked_at"` // When linked to Firebase user
+	LinkedAt    time.Time `firestore:"linked_at"`       // When linked to Firebase user
+	Label       string    `firestore:"label,omitempty"` // Optional user-facing name for the key
+}
+
+// Pubkey audit event types
+const (
+	NostrAuthEventLink     = "link"
+	NostrAuthEventUnlink   = "unlink"
+	NostrAuthEventTransfer = "transfer" // An inactive pubkey linked to a different account
+)
+
+// NostrAuthEvent is an append-only record of a pubkey changing owner.
+// OldFirebaseUID is empty for a first link and NewFirebaseUID for an unlink.
+type NostrAuthEvent struct {
+	ID             string    `firestore:"-" json:"id"`
+	Type           string    `firestore:"type" json:"type"`
+	Pubkey         string    `firestore:"pubkey" json:"pubkey"`
+	OldFirebaseUID string    `firestore:"old_firebase_uid,omitempty" json:"old_firebase_uid,omitempty"`
+	NewFirebaseUID string    `firestore:"new_firebase_uid,omitempty" json:"new_firebase_uid,omitempty"`
+	IP             string    `firestore:"ip,omitempty" json:"ip,omitempty"`
+	AuthMethod     string    `firestore:"auth_method,omitempty" json:"auth_method,omitempty"`
+	CreatedAt      time.Time `firestore:"created_at" json:"created_at"`
+}
+
+// UserProfile is the account overview returned by GET /v1/users/me. Sections
+// that couldn't be loaded are nil and explained in Warnings.
+type UserProfile struct {
+	FirebaseUID string               `json:"firebase_uid"`
+	User        *User                `json:"user"`
+	Pubkeys     []ProfilePubkey      `json:"pubkeys"`
+	Tracks      *ProfileTrackSummary `json:"tracks"`
+	Storage     *ProfileStorageUsage `json:"storage"`
+	Legacy      *ProfileLegacy       `json:"legacy"`
+	Warnings    []string             `json:"warnings,omitempty"`
+}
+
+// ProfilePubkey is a linked pubkey in the account overview
+type ProfilePubkey struct {
+	Pubkey     string    `json:"pubkey"`
+	Label      string    `json:"label,omitempty"`
+	Primary    bool      `json:"primary"`
+	LinkedAt   time.Time `json:"linked_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+// ProfileTrackSummary counts the user's non-deleted tracks
+type ProfileTrackSummary struct {
+	Total      int `json:"total"`
+	Processing int `json:"processing"`
+	Published  int `json:"published"`
+}
+
+// ProfileStorageUsage totals the size of the user's original uploads
+type ProfileStorageUsage struct {
+	OriginalBytes int64 `json:"original_bytes"`
+}
+
+// ProfileLegacy reports whether the user has an account in the legacy catalog
+type ProfileLegacy struct {
+	Exists bool   `json:"exists"`
+	Name   string `json:"name,omitempty"`
 }
 
 // CompressionOption represents a user's choice for audio compression
@@ -26,35 +128,119 @@ type CompressionOption struct {
 	SampleRate int    `json:"sample_rate,omitempty"` // e.g., 44100, 48000
 }
 
+// CompressionRequestItem is one requested compression option with the version
+// it was queued as or matched to
+type CompressionRequestItem struct {
+	CompressionOption
+	VersionID string `json:"version_id,omitempty"`
+}
+
+// CompressionRequestResult reports what a compression request did with each
+// of its options
+type CompressionRequestResult struct {
+	Queued     []CompressionRequestItem `json:"queued"`     // Now pending as new versions
+	Duplicates []CompressionRequestItem `json:"duplicates"` // Already pending, or repeated in the request
+	Existing   []CompressionRequestItem `json:"existing"`   // Already completed
+}
+
 // CompressionVersion represents a generated compressed version
 type CompressionVersion struct {
-	ID         string            `firestore:"id" json:"id"`                   // Unique ID for this version
-	URL        string            `firestore:"url" json:"url"`                 // GCS URL
-	Bitrate    int               `firestore:"bitrate" json:"bitrate"`         // Actual bitrate
-	Format     string            `firestore:"format" json:"format"`           // File format
-	Quality    string            `firestore:"quality" json:"quality"`         // Quality level
-	SampleRate int               `firestore:"sample_rate" json:"sample_rate"` // Sample rate
-	Size       int64             `firestore:"size" json:"size"`               // File size in bytes
-	IsPublic   bool              `firestore:"is_public" json:"is_public"`     // Whether to include in Nostr event
+	ID         string            `firestore:"id" json:"id"`                             // Unique ID for this version
+	URL        string            `firestore:"url" json:"url"`                           // GCS URL
+	Bitrate    int               `firestore:"bitrate" json:"bitrate"`                   // Actual bitrate
+	Format     string            `firestore:"format" json:"format"`                     // File format
+	Quality    string            `firestore:"quality" json:"quality"`                   // Quality level
+	SampleRate int               `firestore:"sample_rate" json:"sample_rate"`           // Sample rate
+	Size       int64             `firestore:"size" json:"size"`                         // File size in bytes
+	IsPublic   bool              `firestore:"is_public" json:"is_public"`               // Whether to include in Nostr event
+	Hash       string            `firestore:"hash,omitempty" json:"hash,omitempty"`     // SHA-256 hex of the file, once computed
+	Status     string            `firestore:"status,omitempty" json:"status,omitempty"` // One of the VersionStatus constants; empty means completed
+	Error      string            `firestore:"error,omitempty" json:"error,omitempty"`   // Why the version failed
 	CreatedAt  time.Time         `firestore:"created_at" json:"created_at"`
 	Options    CompressionOption `firestore:"options" json:"options"` // Original compression request
 }
 
+// Compression version states reported by external workers. Versions created
+// in-process are only saved once completed and leave Status empty.
+const (
+	VersionStatusPending    = "pending"
+	VersionStatusProcessing = "processing"
+	VersionStatusCompleted  = "completed"
+	VersionStatusFailed     = "failed"
+)
+
+// IsTerminal reports whether the version will not change again
+func (v CompressionVersion) IsTerminal() bool {
+	return v.Status == "" || v.Status == VersionStatusCompleted || v.Status == VersionStatusFailed
+}
+
+// Completed reports whether the version's file has been made
+func (v CompressionVersion) Completed() bool {
+	return v.Status == "" || v.Status == VersionStatusCompleted
+}
+
+// Available reports whether the version is public and its file exists, so it
+// can be streamed and published
+func (v CompressionVersion) Available() bool {
+	return v.IsPublic && v.Completed()
+}
+
+// RelayPublishResult is one relay's answer to an event the server published
+// for a track
+type RelayPublishResult struct {
+	Relay    string `firestore:"relay" json:"relay"`
+	Accepted bool   `firestore:"accepted" json:"accepted"`
+	Message  string `firestore:"message,omitempty" json:"message,omitempty"` // The relay's OK message, or why none arrived
+}
+
 type NostrTrack struct {
 	ID                    string               `firestore:"id" json:"id"`                                                         // UUID
 	FirebaseUID           string               `firestore:"firebase_uid" json:"firebase_uid"`                                     // User who uploaded
 	Pubkey                string               `firestore:"pubkey" json:"pubkey"`                                                 // Nostr pubkey
 	OriginalURL           string               `firestore:"original_url" json:"original_url"`                                     // GCS URL for original file
 	PresignedURL          string               `firestore:"-" json:"presigned_url,omitempty"`                                     // Temporary upload URL (not stored)
+	UploadHeaders         map[string]string    `firestore:"-" json:"upload_headers,omitempty"`                                    // Headers the upload must send to the presigned URL (not stored)
+	MaxUploadBytes        int64                `firestore:"-" json:"max_upload_bytes,omitempty"`                                  // Largest file the presigned URL accepts (not stored)
 	Extension             string               `firestore:"extension" json:"extension"`                                           // File extension
+	Region                string               `firestore:"region,omitempty" json:"region,omitempty"`                             // Storage region; empty means the primary region
 	Size                  int64                `firestore:"size,omitempty" json:"size,omitempty"`                                 // Original file size in bytes
+	OriginalHash          string               `firestore:"original_hash,omitempty" json:"original_hash,omitempty"`               // SHA-256 hex of the original file, set by processing
+	ArchivedAt            *time.Time           `firestore:"archived_at,omitempty" json:"archived_at,omitempty"`                   // When processing moved the original to ORIGINAL_STORAGE_CLASS
 	Duration              int                  `firestore:"duration,omitempty" json:"duration,omitempty"`                         // Duration in seconds
-	IsProcessing          bool                 `firestore:"is_processing" json:"is_processing"`                                   // Processing status
-	CompressionVersions   []CompressionVersion `firestore:"compression_versions,omitempty" json:"compression_versions,omitempty"` // All compressed versions
+	Status                string               `firestore:"status,omitempty" json:"status"`                                       // Lifecycle state, one of the TrackStatus constants
+	StatusTimestamps      map[string]time.Time `firestore:"status_timestamps,omitempty" json:"status_timestamps,omitempty"`       // When the track last entered each status
+	IsProcessing          bool                 `firestore:"is_processing" json:"is_processing"`                                   // Derived from Status; kept for older clients
+	Error                 string               `firestore:"error,omitempty" json:"error,omitempty"`                               // Why the last processing attempt failed
+	ErrorCode             string               `firestore:"error_code,omitempty" json:"error_code,omitempty"`                     // The failure's ProcessingError class, when processing marked it failed
+	LimitExceeded         *TrackLimitExceeded  `firestore:"limit_exceeded,omitempty" json:"limit_exceeded,omitempty"`             // The limit a too_long or too_large original broke
+	ProcessingAttempts    int                  `firestore:"processing_attempts,omitempty" json:"processing_attempts,omitempty"`   // Attempts made by the latest processing job
+	ProcessingStartedAt   *time.Time           `firestore:"-" json:"processing_started_at,omitempty"`                             // Set by the status endpoint; see ProcessingTimes
+	ProcessingFinishedAt  *time.Time           `firestore:"-" json:"processing_finished_at,omitempty"`                            // Set by the status endpoint; see ProcessingTimes
+	CompressionVersions   []CompressionVersion `firestore:"compression_versions,omitempty" json:"compression_versions,omitempty"` // All compressed versions (embedded only until migrated)
+	VersionsMigrated      bool                 `firestore:"versions_migrated" json:"-"`                                           // Versions live in the versions subcollection
 	HasPendingCompression bool                 `firestore:"has_pending_compression" json:"has_pending_compression"`               // Whether compression is queued
 	Deleted               bool                 `firestore:"deleted" json:"deleted"`                                               // Soft delete flag
+	FilesPurgedAt         *time.Time           `firestore:"files_purged_at,omitempty" json:"files_purged_at,omitempty"`           // When a purge removed the track's files
+	OriginalDeletedAt     *time.Time           `firestore:"original_deleted_at,omitempty" json:"original_deleted_at,omitempty"`   // When storage reported the original deleted outside the API
 	NostrKind             int                  `firestore:"nostr_kind,omitempty" json:"nostr_kind,omitempty"`                     // Nostr event kind
 	NostrDTag             string               `firestore:"nostr_d_tag,omitempty" json:"nostr_d_tag,omitempty"`                   // Nostr d tag
+	NostrEventID          string               `firestore:"nostr_event_id,omitempty" json:"nostr_event_id,omitempty"`             // ID of the published Nostr event
+	NostrRelays           []string             `firestore:"nostr_relays,omitempty" json:"nostr_relays,omitempty"`                 // Relays the event was published to
+	RelayResults          []RelayPublishResult `firestore:"relay_results,omitempty" json:"relay_results,omitempty"`               // Each relay's answer the last time the server published the event
+	IsPublished           bool                 `firestore:"is_published" json:"is_published"`                                     // Whether a Nostr event has been published
+	PublishedAt           *time.Time           `firestore:"published_at,omitempty" json:"published_at,omitempty"`                 // When the event was reported
+	SourceURL             string               `firestore:"source_url,omitempty" json:"source_url,omitempty"`                     // External URL the track was imported from
+	Metadata              map[string]string    `firestore:"metadata,omitempty" json:"metadata,omitempty"`                         // Optional metadata supplied on import
+	Title                 string               `firestore:"title,omitempty" json:"title,omitempty"`                               // From import metadata, the published event or embedded tags
+	Artist                string               `firestore:"artist,omitempty" json:"artist,omitempty"`                             // From import metadata, the published event or embedded tags
+	TitleNormalized       string               `firestore:"title_normalized,omitempty" json:"-"`                                  // Lowercased title for search prefix queries
+	ArtistNormalized      string               `firestore:"artist_normalized,omitempty" json:"-"`                                 // Lowercased artist for search prefix queries
+	Album                 string               `firestore:"album,omitempty" json:"album,omitempty"`                               // From the file's embedded tags
+	Genre                 string               `firestore:"genre,omitempty" json:"genre,omitempty"`                               // From the file's embedded tags
+	EmbeddedTags          []string             `firestore:"embedded_tags,omitempty" json:"embedded_tags,omitempty"`               // Fields filled from the file's embedded tags
+	WaveformURL           string               `firestore:"waveform_url,omitempty" json:"waveform_url,omitempty"`                 // Peaks JSON for player waveforms
+	PreviewURL            string               `firestore:"preview_url,omitempty" json:"preview_url,omitempty"`                   // Short MP3 clip for unauthenticated listeners
+	ArtworkURL            string               `firestore:"artwork_url,omitempty" json:"artwork_url,omitempty"`                   // Cover art extracted from the file
 	CreatedAt             time.Time            `firestore:"created_at" json:"created_at"`
 	UpdatedAt             time.Time            `firestore:"updated_at" json:"updated_at"`
 
@@ -63,6 +249,172 @@ type NostrTrack struct {
 	IsCompressed  bool   `firestore:"is_compressed" json:"is_compressed"`                       // Legacy compression status
 }
 
+// Track lifecycle states. A track moves pending_upload → uploaded → processing
+// and ends ready, failed or cancelled; see services.CanTransitionTrack.
+const (
+	TrackStatusPendingUpload = "pending_upload"
+	TrackStatusUploaded      = "uploaded"
+	TrackStatusProcessing    = "processing"
+	TrackStatusReady         = "ready"
+	TrackStatusFailed        = "failed"
+	TrackStatusCancelled     = "cancelled"
+)
+
+// Event types streamed by GET /v1/tracks/:id/events
+const (
+	TrackEventStatus   = "status"
+	TrackEventProgress = "progress"
+	TrackEventVersion  = "version"
+)
+
+// Processing stages reported in progress events
+const (
+	ProcessingStageDownloading = "downloading"
+	ProcessingStageValidating  = "validating"
+	ProcessingStageCompressing = "compressing"
+	ProcessingStageUploading   = "uploading"
+)
+
+// TrackEvent is a change to a track pushed to event stream subscribers
+type TrackEvent struct {
+	ID      uint64              `json:"-"` // Sent as the SSE id; set by the hub, increasing per instance
+	Type    string              `json:"type"`
+	TrackID string              `json:"track_id"`
+	Status  string              `json:"status,omitempty"`
+	Error   string              `json:"error,omitempty"`
+	Stage   string              `json:"stage,omitempty"`   // Set on progress events
+	Percent int                 `json:"percent,omitempty"` // Download progress, on downloading progress events
+	Version *CompressionVersion `json:"version,omitempty"` // Set on version events
+	At      time.Time           `json:"at"`
+}
+
+// What started a processing attempt
+const (
+	ProcessingTriggerWebhook   = "webhook"   // Upload trigger or external pipeline
+	ProcessingTriggerManual    = "manual"    // POST /v1/tracks/:id/process
+	ProcessingTriggerRetry     = "retry"     // Manual trigger after a failed attempt
+	ProcessingTriggerAdmin     = "admin"     // POST /v1/admin/tracks/:id/reprocess
+	ProcessingTriggerReconcile = "reconcile" // Requeued by the stuck-track reconciler
+	ProcessingTriggerRestore   = "restore"   // Restoring a deleted track whose original was uploaded
+)
+
+// How a processing attempt ended
+const (
+	ProcessingOutcomeRunning   = "running"
+	ProcessingOutcomeSucceeded = "succeeded"
+	ProcessingOutcomeFailed    = "failed"
+	ProcessingOutcomeCancelled = "cancelled" // The track was deleted mid-run
+)
+
+// Classes of processing failure recorded in the history
+const (
+	ProcessingErrorDownload     = "download"
+	ProcessingErrorDiskSpace    = "disk_space" // Temp dir too full; retried
+	ProcessingErrorInvalidAudio = "invalid_audio"
+	ProcessingErrorFormat       = "format_mismatch" // The contents aren't in the declared format
+	ProcessingErrorTooLong      = "too_long"        // Longer than the duration limit
+	ProcessingErrorTooLarge     = "too_large"       // Bigger than the upload size limit
+	ProcessingErrorCompression  = "compression"
+	ProcessingErrorUpload       = "upload"
+	ProcessingErrorInternal     = "internal"
+)
+
+// Limits an original can exceed
+const (
+	TrackLimitDuration = "duration"
+	TrackLimitSize     = "size"
+)
+
+// TrackLimitExceeded is the limit an original broke, with what was measured
+type TrackLimitExceeded struct {
+	Limit  string `firestore:"limit" json:"limit"`   // One of the TrackLimit constants
+	Max    int64  `firestore:"max" json:"max"`       // Seconds for duration, bytes for size
+	Actual int64  `firestore:"actual" json:"actual"` // In the same unit as Max
+}
+
+// Processing job states. A job is queued, runs under a lease, and is queued
+// again with backoff after a retryable failure until it runs out of attempts.
+const (
+	ProcessingJobStatusQueued    = "queued"
+	ProcessingJobStatusRunning   = "running"
+	ProcessingJobStatusSucceeded = "succeeded"
+	ProcessingJobStatusFailed    = "failed"
+	ProcessingJobStatusCancelled = "cancelled"
+)
+
+// ReconcileResult reports what a pass over tracks stuck processing did
+type ReconcileResult struct {
+	Checked  int `json:"checked"`  // Tracks processing longer than the threshold
+	Repaired int `json:"repaired"` // Compressed file found, marked ready
+	Requeued int `json:"requeued"` // Queued for processing again
+	Failed   int `json:"failed"`   // Out of attempts, marked failed
+}
+
+// ProcessingJob is a durable request to process a track, stored in the
+// processing_jobs collection under the track's ID. Workers claim queued jobs
+// with a lease; a job whose lease expires is queued again.
+type ProcessingJob struct {
+	TrackID        string            `firestore:"track_id" json:"track_id"`
+	TriggeredBy    string            `firestore:"triggered_by" json:"triggered_by"`                 // One of the ProcessingTrigger constants
+	RequestID      string            `firestore:"request_id,omitempty" json:"request_id,omitempty"` // Request that queued the job, for logs
+	TraceContext   map[string]string `firestore:"trace_context,omitempty" json:"-"`                 // W3C trace context of that request, so processing joins its trace
+	Status         string            `firestore:"status" json:"status"`                             // One of the ProcessingJobStatus constants
+	Attempts       int               `firestore:"attempts" json:"attempts"`
+	MaxAttempts    int               `firestore:"max_attempts" json:"max_attempts"`
+	NextAttemptAt  time.Time         `firestore:"next_attempt_at" json:"next_attempt_at"`
+	LeaseOwner     string            `firestore:"lease_owner,omitempty" json:"lease_owner,omitempty"`
+	LeaseExpiresAt *time.Time        `firestore:"lease_expires_at,omitempty" json:"lease_expires_at,omitempty"`
+	LastError      string            `firestore:"last_error,omitempty" json:"last_error,omitempty"`
+	CreatedAt      time.Time         `firestore:"created_at" json:"created_at"`
+	UpdatedAt      time.Time         `firestore:"updated_at" json:"updated_at"`
+}
+
+// ProcessingAttempt is one run of the processing pipeline for a track, stored
+// in the track's processing_history subcollection
+type ProcessingAttempt struct {
+	ID          string     `firestore:"id" json:"id"`
+	StartedAt   time.Time  `firestore:"started_at" json:"started_at"`
+	FinishedAt  *time.Time `firestore:"finished_at,omitempty" json:"finished_at,omitempty"`
+	TriggeredBy string     `firestore:"triggered_by" json:"triggered_by"`       // One of the ProcessingTrigger constants
+	Outcome     string     `firestore:"outcome" json:"outcome"`                 // One of the ProcessingOutcome constants
+	Phase       string     `firestore:"phase,omitempty" json:"phase,omitempty"` // Last ProcessingStage reached
+	ErrorClass  string     `firestore:"error_class,omitempty" json:"error_class,omitempty"`
+	Error       string     `firestore:"error,omitempty" json:"error,omitempty"`
+	Versions    []string   `firestore:"versions,omitempty" json:"versions,omitempty"` // Compression version IDs produced
+}
+
+// CurrentStatus returns the track's status, deriving it from the legacy
+// fields for tracks written before Status existed
+func (t *NostrTrack) CurrentStatus() string {
+	switch {
+	case t.Status != "":
+		return t.Status
+	case t.IsProcessing:
+		return TrackStatusProcessing
+	case t.Error != "":
+		return TrackStatusFailed
+	default:
+		return TrackStatusReady
+	}
+}
+
+// ProcessingTimes returns when the latest processing run started and, once the
+// track is ready or failed, when it finished. Either is nil if unknown; tracks
+// reported ready by an external pipeline never started processing here.
+func (t *NostrTrack) ProcessingTimes() (started, finished *time.Time) {
+	if at, ok := t.StatusTimestamps[TrackStatusProcessing]; ok {
+		started = &at
+	}
+
+	switch status := t.CurrentStatus(); status {
+	case TrackStatusReady, TrackStatusFailed:
+		if at, ok := t.StatusTimestamps[status]; ok && (started == nil || !at.Before(*started)) {
+			finished = &at
+		}
+	}
+	return started, finished
+}
+
 // VersionUpdate represents a request to update compression version visibility
 type VersionUpdate struct {
 	VersionID string `json:"version_id"`
@@ -86,26 +438,26 @@ type LegacyUser struct {
 }
 
 type LegacyTrack struct {
-	ID              string    `db:"id" json:"id"`
-	ArtistID        string    `db:"artist_id" json:"artist_id"`
-	AlbumID         string    `db:"album_id" json:"album_id"`
-	Title           string    `db:"title" json:"title"`
-	Order           int       `db:"order" json:"order"`
-	PlayCount       int       `db:"play_count" json:"play_count"`
-	MSatTotal       int64     `db:"msat_total" json:"msat_total"`
-	LiveURL         string    `db:"live_url" json:"live_url"`
-	RawURL          string    `db:"raw_url" json:"raw_url"`
-	Size            int       `db:"size" json:"size"`
-	Duration        int       `db:"duration" json:"duration"`
-	IsProcessing    bool      `db:"is_processing" json:"is_processing"`
-	IsDraft         bool      `db:"is_draft" json:"is_draft"`
-	IsExplicit      bool      `db:"is_explicit" json:"is_explicit"`
-	CompressorError bool      `db:"compressor_error" json:"compressor_error"`
-	Deleted         bool      `db:"deleted" json:"deleted"`
-	Lyrics          string    `db:"lyrics" json:"lyrics"`
-	CreatedAt       time.Time `db:"created_at" json:"created_at"`
-	UpdatedAt       time.Time `db:"updated_at" json:"updated_at"`
-	PublishedAt     time.Time `db:"published_at" json:"published_at"`
+	ID              string     `db:"id" json:"id"`
+	ArtistID        string     `db:"artist_id" json:"artist_id"`
+	AlbumID         string     `db:"album_id" json:"album_id"`
+	Title           string     `db:"title" json:"title"`
+	Order           int        `db:"order" json:"order"`
+	PlayCount       int        `db:"play_count" json:"play_count"`
+	MSatTotal       int64      `db:"msat_total" json:"msat_total"`
+	LiveURL         string     `db:"live_url" json:"live_url"`
+	RawURL          string     `db:"raw_url" json:"raw_url"`
+	Size            int        `db:"size" json:"size"`
+	Duration        int        `db:"duration" json:"duration"`
+	IsProcessing    bool       `db:"is_processing" json:"is_processing"`
+	IsDraft         bool       `db:"is_draft" json:"is_draft"`
+	IsExplicit      bool       `db:"is_explicit" json:"is_explicit"`
+	CompressorError bool       `db:"compressor_error" json:"compressor_error"`
+	Deleted         bool       `db:"deleted" json:"deleted"`
+	Lyrics          string     `db:"lyrics" json:"lyrics"`
+	CreatedAt       time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt       time.Time  `db:"updated_at" json:"updated_at"`
+	PublishedAt     *time.Time `db:"published_at" json:"published_at,omitempty"`
 }
 
 type LegacyArtist struct {
@@ -128,19 +480,308 @@ type LegacyArtist struct {
 }
 
 type LegacyAlbum struct {
-	ID              string    `db:"id" json:"id"`
-	ArtistID        string    `db:"artist_id" json:"artist_id"`
-	Title           string    `db:"title" json:"title"`
-	ArtworkURL      string    `db:"artwork_url" json:"artwork_url"`
-	Description     string    `db:"description" json:"description"`
-	GenreID         int       `db:"genre_id" json:"genre_id"`
-	SubgenreID      int       `db:"subgenre_id" json:"subgenre_id"`
-	IsDraft         bool      `db:"is_draft" json:"is_draft"`
-	IsSingle        bool      `db:"is_single" json:"is_single"`
-	Deleted         bool      `db:"deleted" json:"deleted"`
-	MSatTotal       int64     `db:"msat_total" json:"msat_total"`
-	IsFeedPublished bool      `db:"is_feed_published" json:"is_feed_published"`
-	PublishedAt     time.Time `db:"published_at" json:"published_at"`
-	CreatedAt       time.Time `db:"created_at" json:"created_at"`
-	UpdatedAt       time.Time `db:"updated_at" json:"updated_at"`
+	ID              string     `db:"id" json:"id"`
+	ArtistID        string     `db:"artist_id" json:"artist_id"`
+	Title           string     `db:"title" json:"title"`
+	ArtworkURL      string     `db:"artwork_url" json:"artwork_url"`
+	Description     string     `db:"description" json:"description"`
+	GenreID         int        `db:"genre_id" json:"genre_id"`
+	SubgenreID      int        `db:"subgenre_id" json:"subgenre_id"`
+	IsDraft         bool       `db:"is_draft" json:"is_draft"`
+	IsSingle        bool       `db:"is_single" json:"is_single"`
+	Deleted         bool       `db:"deleted" json:"deleted"`
+	MSatTotal       int64      `db:"msat_total" json:"msat_total"`
+	IsFeedPublished bool       `db:"is_feed_published" json:"is_feed_published"`
+	PublishedAt     *time.Time `db:"published_at" json:"published_at,omitempty"`
+	CreatedAt       time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt       time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// LegacySearchResult is a legacy track, album or artist matching a catalog
+// search, with the names of the artist and album it belongs to
+type LegacySearchResult struct {
+	Type       string `json:"type"`
+	ID         string `json:"id"`
+	Title      string `json:"title"`
+	ArtistName string `json:"artist_name,omitempty"`
+	AlbumName  string `json:"album_name,omitempty"`
+}
+
+// LegacyEarnings totals a user's legacy earnings from their non-deleted
+// tracks, by artist and album, with their current balance
+type LegacyEarnings struct {
+	MSatBalance int64                  `json:"msat_balance"`
+	MSatTotal   int64                  `json:"msat_total"`
+	Artists     []LegacyArtistEarnings `json:"artists"`
+}
+
+// LegacyArtistEarnings totals an artist's earnings across its albums
+type LegacyArtistEarnings struct {
+	ArtistID  string                `json:"artist_id"`
+	Name      string                `json:"name"`
+	MSatTotal int64                 `json:"msat_total"`
+	Albums    []LegacyAlbumEarnings `json:"albums"`
+}
+
+// LegacyAlbumEarnings totals an album's earnings across its tracks
+type LegacyAlbumEarnings struct {
+	AlbumID   string `json:"album_id"`
+	Title     string `json:"title"`
+	MSatTotal int64  `json:"msat_total"`
+}
+
+// Notification types written by processing and webhook flows
+const (
+	NotificationTypeProcessingComplete = "processing_complete"
+	NotificationTypeProcessingFailed   = "processing_failed"
+	NotificationTypeCompressionReady   = "compression_ready"
+)
+
+// Notification represents a user-facing event about one of their tracks
+type Notification struct {
+	ID          string     `firestore:"id" json:"id"`
+	FirebaseUID string     `firestore:"firebase_uid" json:"-"`
+	Pubkey      string     `firestore:"pubkey,omitempty" json:"pubkey,omitempty"`
+	TrackID     string     `firestore:"track_id,omitempty" json:"track_id,omitempty"`
+	Type        string     `firestore:"type" json:"type"`
+	Message     string     `firestore:"message" json:"message"`
+	Read        bool       `firestore:"read" json:"read"`
+	CreatedAt   time.Time  `firestore:"created_at" json:"created_at"`
+	ReadAt      *time.Time `firestore:"read_at,omitempty" json:"read_at,omitempty"`
+}
+
+// WebhookEventTest is sent by the test-fire endpoint; the other webhook event
+// types are the notification types
+const WebhookEventTest = "webhook_test"
+
+// UserWebhook is an endpoint a user registered to receive their notifications
+type UserWebhook struct {
+	ID             string     `firestore:"id" json:"id"`
+	FirebaseUID    string     `firestore:"firebase_uid" json:"-"`
+	URL            string     `firestore:"url" json:"url"`
+	Secret         string     `firestore:"secret" json:"-"` // HMAC key for the signature header; never returned
+	EventTypes     []string   `firestore:"event_types" json:"event_types"`
+	Active         bool       `firestore:"active" json:"active"`
+	FailureCount   int        `firestore:"failure_count" json:"failure_count"` // Consecutive failed deliveries
+	LastError      string     `firestore:"last_error,omitempty" json:"last_error,omitempty"`
+	LastDeliveryAt *time.Time `firestore:"last_delivery_at,omitempty" json:"last_delivery_at,omitempty"`
+	DisabledAt     *time.Time `firestore:"disabled_at,omitempty" json:"disabled_at,omitempty"`
+	CreatedAt      time.Time  `firestore:"created_at" json:"created_at"`
+	UpdatedAt      time.Time  `firestore:"updated_at" json:"updated_at"`
+}
+
+// WebhookEvent is the JSON body delivered to a user webhook
+type WebhookEvent struct {
+	ID        string           `json:"id"`
+	Type      string           `json:"type"`
+	CreatedAt time.Time        `json:"created_at"`
+	Data      WebhookEventData `json:"data"`
+}
+
+// WebhookEventData describes the track the event is about
+type WebhookEventData struct {
+	TrackID string `json:"track_id,omitempty"`
+	Pubkey  string `json:"pubkey,omitempty"`
+	Message string `json:"message"`
+}
+
+// WebhookDelivery is the outcome of a test-fire
+type WebhookDelivery struct {
+	Delivered  bool   `json:"delivered"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Export job statuses
+const (
+	ExportJobStatusPending   = "pending"
+	ExportJobStatusRunning   = "running"
+	ExportJobStatusCompleted = "completed"
+	ExportJobStatusFailed    = "failed"
+)
+
+// ExportJob tracks an asynchronous data export for large accounts
+type ExportJob struct {
+	ID          string     `firestore:"id" json:"id"`
+	FirebaseUID string     `firestore:"firebase_uid" json:"-"`
+	Status      string     `firestore:"status" json:"status"`
+	TrackCount  int        `firestore:"track_count" json:"track_count"`
+	ObjectName  string     `firestore:"object_name" json:"-"`
+	DownloadURL string     `firestore:"-" json:"download_url,omitempty"` // Signed on read, never stored
+	ExpiresAt   *time.Time `firestore:"expires_at,omitempty" json:"expires_at,omitempty"`
+	Error       string     `firestore:"error,omitempty" json:"error,omitempty"`
+	CreatedAt   time.Time  `firestore:"created_at" json:"created_at"`
+	CompletedAt *time.Time `firestore:"completed_at,omitempty" json:"completed_at,omitempty"`
+}
+
+// Account deletion statuses
+const (
+	AccountDeletionStatusPending   = "pending_confirmation"
+	AccountDeletionStatusRunning   = "running"
+	AccountDeletionStatusFailed    = "failed"
+	AccountDeletionStatusCompleted = "completed"
+)
+
+// Account deletion steps, run in this order
+const (
+	AccountDeletionStepTracks   = "tracks"
+	AccountDeletionStepWebhooks = "webhooks"
+	AccountDeletionStepExports  = "exports"
+	AccountDeletionStepPubkeys  = "pubkeys"
+	AccountDeletionStepUser     = "user"
+	AccountDeletionStepFirebase = "firebase_account"
+)
+
+// AccountDeletion records a user's account deletion: the pending confirmation,
+// the steps completed so far and what they removed. Steps are idempotent, so a
+// failed deletion resumes where it stopped.
+type AccountDeletion struct {
+	FirebaseUID            string     `firestore:"firebase_uid" json:"-"`
+	Status                 string     `firestore:"status" json:"status"`
+	DisableFirebaseAccount bool       `firestore:"disable_firebase_account" json:"disable_firebase_account"`
+	CodeHash               string     `firestore:"code_hash" json:"-"`
+	CodeExpiresAt          time.Time  `firestore:"code_expires_at" json:"-"`
+	LeaseUntil             *time.Time `firestore:"lease_until,omitempty" json:"-"` // While a run holds the deletion
+	CompletedSteps         []string   `firestore:"completed_steps" json:"completed_steps"`
+
+	TracksDeleted           int  `firestore:"tracks_deleted" json:"tracks_deleted"`
+	ObjectsPurged           int  `firestore:"objects_purged" json:"objects_purged"`
+	WebhooksDeleted         int  `firestore:"webhooks_deleted" json:"webhooks_deleted"`
+	ExportsDeleted          int  `firestore:"exports_deleted" json:"exports_deleted"`
+	PubkeysDeactivated      int  `firestore:"pubkeys_deactivated" json:"pubkeys_deactivated"`
+	UserDeleted             bool `firestore:"user_deleted" json:"user_deleted"`
+	FirebaseAccountDisabled bool `firestore:"firebase_account_disabled" json:"firebase_account_disabled"`
+
+	Error       string     `firestore:"error,omitempty" json:"error,omitempty"`
+	CreatedAt   time.Time  `firestore:"created_at" json:"created_at"`
+	UpdatedAt   time.Time  `firestore:"updated_at" json:"updated_at"`
+	CompletedAt *time.Time `firestore:"completed_at,omitempty" json:"completed_at,omitempty"`
+}
+
+// AccountDeletionConfirmation is the code that confirms a requested account
+// deletion, returned once and stored only as a hash
+type AccountDeletionConfirmation struct {
+	ConfirmationCode string    `json:"confirmation_code"`
+	ExpiresAt        time.Time `json:"expires_at"`
+}
+
+// Bulk compression job statuses
+const (
+	BulkCompressionJobStatusRunning   = "running"
+	BulkCompressionJobStatusCompleted = "completed"
+)
+
+// What a bulk compression request decided for each track
+const (
+	BulkCompressionQueued   = "queued"   // Missing versions were queued
+	BulkCompressionSkipped  = "skipped"  // Nothing to do yet, e.g. versions exist or the track isn't ready
+	BulkCompressionRejected = "rejected" // Track not found, not owned or deleted
+)
+
+// BulkCompressionTrack is the per-track outcome of a bulk compression request
+type BulkCompressionTrack struct {
+	TrackID string              `firestore:"track_id" json:"track_id"`
+	Result  string              `firestore:"result" json:"result"`                     // One of the BulkCompression result constants
+	Reason  string              `firestore:"reason,omitempty" json:"reason,omitempty"` // Why the track was skipped or rejected
+	Options []CompressionOption `firestore:"options,omitempty" json:"options,omitempty"`
+}
+
+// BulkCompressionJob tracks compression requested across many of a user's tracks
+type BulkCompressionJob struct {
+	ID             string                 `firestore:"id" json:"id"`
+	Pubkey         string                 `firestore:"pubkey" json:"-"`
+	Status         string                 `firestore:"status" json:"status"`
+	Options        []CompressionOption    `firestore:"options" json:"options"`
+	Tracks         []BulkCompressionTrack `firestore:"tracks" json:"tracks"`
+	Queued         int                    `firestore:"queued" json:"queued"`
+	Skipped        int                    `firestore:"skipped" json:"skipped"`
+	Rejected       int                    `firestore:"rejected" json:"rejected"`
+	Completed      int                    `firestore:"completed" json:"completed"` // Queued tracks whose versions all finished
+	Failed         int                    `firestore:"failed" json:"failed"`       // Queued tracks with at least one failed version
+	FailedTrackIDs []string               `firestore:"failed_track_ids,omitempty" json:"failed_track_ids,omitempty"`
+	CreatedAt      time.Time              `firestore:"created_at" json:"created_at"`
+	CompletedAt    *time.Time             `firestore:"completed_at,omitempty" json:"completed_at,omitempty"`
+}
+
+// Share link states, derived when a link is read
+const (
+	ShareLinkStatusActive    = "active"
+	ShareLinkStatusExpired   = "expired"
+	ShareLinkStatusExhausted = "exhausted"
+	ShareLinkStatusRevoked   = "revoked"
+)
+
+// ShareLink grants access to an unlisted track through a secret token. Only
+// the token's SHA-256 is stored, in the track's share_links subcollection.
+type ShareLink struct {
+	ID         string     `firestore:"id" json:"id"`
+	TrackID    string     `firestore:"track_id" json:"track_id"`
+	TokenHash  string     `firestore:"token_hash" json:"-"`
+	Token      string     `firestore:"-" json:"token,omitempty"` // Only returned when the link is created
+	Status     string     `firestore:"-" json:"status"`          // One of the ShareLinkStatus constants
+	ExpiresAt  time.Time  `firestore:"expires_at" json:"expires_at"`
+	MaxUses    int        `firestore:"max_uses,omitempty" json:"max_uses,omitempty"` // Zero means unlimited
+	Uses       int        `firestore:"uses" json:"uses"`
+	LastUsedAt *time.Time `firestore:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `firestore:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `firestore:"created_at" json:"created_at"`
+}
+
+// CurrentStatus derives the link's state at the given time
+func (l *ShareLink) CurrentStatus(now time.Time) string {
+	switch {
+	case l.RevokedAt != nil:
+		return ShareLinkStatusRevoked
+	case !now.Before(l.ExpiresAt):
+		return ShareLinkStatusExpired
+	case l.MaxUses > 0 && l.Uses >= l.MaxUses:
+		return ShareLinkStatusExhausted
+	default:
+		return ShareLinkStatusActive
+	}
+}
+
+// SharedStream is a short-lived signed URL for one version of a shared track
+type SharedStream struct {
+	VersionID string    `json:"version_id"`
+	Format    string    `json:"format"`
+	Bitrate   int       `json:"bitrate"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// OriginalDownload is a short-lived signed URL for a track's original upload
+type OriginalDownload struct {
+	URL       string    `json:"url"`
+	Filename  string    `json:"filename"`
+	ExpiresIn int       `json:"expires_in"` // Seconds the URL was signed for
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// UploadURL is a presigned PUT URL for a track's original. The upload must
+// send Headers with the values given.
+type UploadURL struct {
+	URL       string            `json:"url"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers"`
+	MaxBytes  int64             `json:"max_bytes,omitempty"` // Largest file the URL accepts
+	ExpiresIn int               `json:"expires_in"`          // Seconds the URL was signed for
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// TrackPurge lists the storage objects a purge removed, or with DryRun would
+// remove
+type TrackPurge struct {
+	DryRun  bool     `json:"dry_run"`
+	Objects []string `json:"objects"`
+	Failed  []string `json:"failed,omitempty"` // Objects that couldn't be deleted after retries
+}
+
+// WebhookIdempotencyKey records a processing webhook delivery's idempotency
+// key so repeats of it are recognised
+type WebhookIdempotencyKey struct {
+	Key       string    `firestore:"key"`
+	TrackID   string    `firestore:"track_id"`
+	CreatedAt time.Time `firestore:"created_at"`
+	ExpiresAt time.Time `firestore:"expires_at"` // Firestore TTL field
 }
@@ -0,0 +1,45 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/logging"
+)
+
+// Middleware throttles a route group named name: each authenticated pubkey,
+// or client IP for unauthenticated requests, gets its own bucket. It must run
+// after authentication to key by pubkey. A nil limiter or disabled limit lets
+// every request through, as does a limiter error.
+func Middleware(limiter Limiter, name string, limit Limit) gin.HandlerFunc {
+	if limiter == nil || !limit.Enabled() {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	return func(c *gin.Context) {
+		allowed, retryAfter, err := limiter.Allow(c.Request.Context(), requestKey(c, name), limit)
+		if err != nil {
+			logging.FromContext(c.Request.Context()).Error("rate limiter failed; allowing request", "limit", name, "error", err)
+			c.Next()
+			return
+		}
+		if !allowed {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(max(seconds, 1)))
+			apierror.Respond(c, apierror.New(http.StatusTooManyRequests, apierror.CodeRateLimited, "rate limit exceeded, retry later"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// requestKey names the caller's bucket for a route group
+func requestKey(c *gin.Context, name string) string {
+	if pubkey := c.GetString("pubkey"); pubkey != "" {
+		return name + ":pubkey:" + pubkey
+	}
+	return name + ":ip:" + c.ClientIP()
+}
@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/apierror"
+)
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	return false, 0, errors.New("store unavailable")
+}
+
+// newTestRouter serves POST /compress behind the middleware; the X-Pubkey
+// header stands in for NIP-98 authentication
+func newTestRouter(limiter Limiter, limit Limit) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/compress", func(c *gin.Context) {
+		if pubkey := c.GetHeader("X-Pubkey"); pubkey != "" {
+			c.Set("pubkey", pubkey)
+		}
+		c.Next()
+	}, Middleware(limiter, "compress", limit), func(c *gin.Context) {
+		c.Status(http.StatusAccepted)
+	})
+	return router
+}
+
+func post(router *gin.Engine, pubkey, ip string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/compress", nil)
+	req.RemoteAddr = ip + ":1234"
+	if pubkey != "" {
+		req.Header.Set("X-Pubkey", pubkey)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestMiddlewareRejectsPastTheLimit(t *testing.T) {
+	router := newTestRouter(NewMemoryLimiter(), Limit{Requests: 2, Per: time.Minute})
+
+	assert.Equal(t, http.StatusAccepted, post(router, "pubkey-a", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusAccepted, post(router, "pubkey-a", "10.0.0.2").Code)
+
+	w := post(router, "pubkey-a", "10.0.0.3")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+
+	var body struct {
+		Success bool `json:"success"`
+		Error   struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.False(t, body.Success)
+	assert.Equal(t, apierror.CodeRateLimited, body.Error.Code)
+
+	// The pubkey is limited wherever it comes from; other pubkeys aren't
+	assert.Equal(t, http.StatusAccepted, post(router, "pubkey-b", "10.0.0.3").Code)
+}
+
+func TestMiddlewareKeysAnonymousRequestsByIP(t *testing.T) {
+	router := newTestRouter(NewMemoryLimiter(), Limit{Requests: 1, Per: time.Minute})
+
+	assert.Equal(t, http.StatusAccepted, post(router, "", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, post(router, "", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusAccepted, post(router, "", "10.0.0.2").Code)
+
+	// An authenticated caller on the same IP has their own bucket
+	assert.Equal(t, http.StatusAccepted, post(router, "pubkey-a", "10.0.0.1").Code)
+}
+
+func TestMiddlewarePassesThrough(t *testing.T) {
+	for name, router := range map[string]*gin.Engine{
+		"disabled limit": newTestRouter(NewMemoryLimiter(), Limit{}),
+		"nil limiter":    newTestRouter(nil, Limit{Requests: 1, Per: time.Minute}),
+		"limiter error":  newTestRouter(failingLimiter{}, Limit{Requests: 1, Per: time.Minute}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 3; i++ {
+				assert.Equal(t, http.StatusAccepted, post(router, "pubkey-a", "10.0.0.1").Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+// Package ratelimit throttles expensive endpoints with token buckets keyed by
+// caller. MemoryLimiter keeps buckets per instance; a shared store can back
+// the Limiter interface when limits need to hold across instances.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit allows Requests requests in a burst, refilled evenly over Per. A zero
+// Limit doesn't throttle.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// Enabled reports whether the limit throttles anything
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Per > 0
+}
+
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, l.Per)
+}
+
+// ParseLimit reads "<requests>/<duration>", such as "10/1m" or "100/1h".
+// "0" and "off" disable the limit.
+func ParseLimit(value string) (Limit, error) {
+	value = strings.TrimSpace(value)
+	if value == "0" || strings.EqualFold(value, "off") {
+		return Limit{}, nil
+	}
+
+	requestsPart, perPart, ok := strings.Cut(value, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("rate limit %q must look like 10/1m", value)
+	}
+	requests, err := strconv.Atoi(requestsPart)
+	if err != nil || requests <= 0 {
+		return Limit{}, fmt.Errorf("rate limit %q must allow a positive number of requests", value)
+	}
+	per, err := time.ParseDuration(perPart)
+	if err != nil || per <= 0 {
+		return Limit{}, fmt.Errorf("rate limit %q must have a positive duration such as 1m", value)
+	}
+	return Limit{Requests: requests, Per: per}, nil
+}
+
+// Limiter decides whether a caller may make another request
+type Limiter interface {
+	// Allow takes a token from key's bucket. When the bucket is empty it
+	// returns false and how long until a token is available.
+	Allow(ctx context.Context, key string, limit Limit) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// sweepInterval is how often MemoryLimiter drops buckets that have refilled
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	per     time.Duration
+}
+
+// MemoryLimiter is a Limiter holding buckets in memory, so each instance
+// enforces its limits separately
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryLimiter creates an empty in-memory limiter
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+// Allow implements Limiter
+func (l *MemoryLimiter) Allow(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	if !limit.Enabled() {
+		return true, 0, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	capacity := float64(limit.Requests)
+	perToken := limit.Per / time.Duration(limit.Requests)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now}
+		l.buckets[key] = b
+	}
+	b.per = limit.Per
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = math.Min(capacity, b.tokens+float64(elapsed)/float64(perToken))
+		b.updated = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	wait := time.Duration((1 - b.tokens) * float64(perToken))
+	return false, wait, nil
+}
+
+// sweep drops buckets idle long enough to have refilled, which behave the
+// same as a new bucket
+func (l *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= b.per {
+			delete(l.buckets, key)
+		}
+	}
+}
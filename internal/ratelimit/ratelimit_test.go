@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimit(t *testing.T) {
+	limit, err := ParseLimit("10/1m")
+	require.NoError(t, err)
+	assert.Equal(t, Limit{Requests: 10, Per: time.Minute}, limit)
+	assert.Equal(t, "10/1m0s", limit.String())
+
+	for _, off := range []string{"0", "off", " OFF "} {
+		limit, err := ParseLimit(off)
+		require.NoError(t, err)
+		assert.False(t, limit.Enabled())
+	}
+
+	for _, bad := range []string{"", "10", "ten/1m", "-1/1m", "10/soon", "10/0s", "10/-1m"} {
+		_, err := ParseLimit(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestMemoryLimiterBucket(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	limiter := NewMemoryLimiter()
+	limiter.now = func() time.Time { return now }
+	limit := Limit{Requests: 3, Per: 30 * time.Second}
+
+	// The full burst, then a wait of one token's refill
+	for i := 0; i < 3; i++ {
+		allowed, _, err := limiter.Allow(ctx, "a", limit)
+		require.NoError(t, err)
+		assert.True(t, allowed, "request %d", i+1)
+	}
+	allowed, retryAfter, err := limiter.Allow(ctx, "a", limit)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, 10*time.Second, retryAfter)
+
+	// Other keys have their own bucket
+	allowed, _, _ = limiter.Allow(ctx, "b", limit)
+	assert.True(t, allowed)
+
+	now = now.Add(4 * time.Second)
+	_, retryAfter, _ = limiter.Allow(ctx, "a", limit)
+	assert.Equal(t, 6*time.Second, retryAfter)
+
+	now = now.Add(6 * time.Second)
+	allowed, _, _ = limiter.Allow(ctx, "a", limit)
+	assert.True(t, allowed, "one token refilled")
+	allowed, _, _ = limiter.Allow(ctx, "a", limit)
+	assert.False(t, allowed)
+
+	// Refills never exceed the burst size
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		allowed, _, _ = limiter.Allow(ctx, "a", limit)
+		assert.True(t, allowed)
+	}
+	allowed, _, _ = limiter.Allow(ctx, "a", limit)
+	assert.False(t, allowed)
+}
+
+func TestMemoryLimiterSweepsRefilledBuckets(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	limiter := NewMemoryLimiter()
+	limiter.now = func() time.Time { return now }
+	limit := Limit{Requests: 1, Per: time.Second}
+
+	limiter.Allow(ctx, "a", limit)
+	limiter.Allow(ctx, "b", limit)
+	assert.Len(t, limiter.buckets, 2)
+
+	now = now.Add(2 * sweepInterval)
+	limiter.Allow(ctx, "c", limit)
+	assert.Len(t, limiter.buckets, 1)
+}
+
+func TestMemoryLimiterDisabledLimit(t *testing.T) {
+	limiter := NewMemoryLimiter()
+	for i := 0; i < 100; i++ {
+		allowed, _, err := limiter.Allow(context.Background(), "a", Limit{})
+		require.NoError(t, err)
+		assert.True(t, allowed)
+	}
+	assert.Empty(t, limiter.buckets)
+}
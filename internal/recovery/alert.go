@@ -0,0 +1,137 @@
+package recovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxAlertStack is the most of a stack an alert's text quotes; the full
+// stack is in the log and the report
+const maxAlertStack = 2000
+
+// WebhookAlerter posts alerts as JSON to a URL. The body's text is what a
+// Slack incoming webhook posts; the report is alongside it for other
+// receivers.
+type WebhookAlerter struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookAlerter returns an alerter posting to url
+func NewWebhookAlerter(url string) *WebhookAlerter {
+	return &WebhookAlerter{url: url, client: &http.Client{Timeout: alertTimeout}}
+}
+
+// webhookAlert is the body WebhookAlerter posts
+type webhookAlert struct {
+	Text   string            `json:"text"`
+	Report Report            `json:"report"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+func (a *WebhookAlerter) Alert(ctx context.Context, report Report) error {
+	payload, err := json.Marshal(webhookAlert{Text: alertText(report), Report: report, Fields: fieldMap(report.Fields)})
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create alert request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send alert: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("alert webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// alertText summarises report in a few lines, quoting the start of its stack
+func alertText(report Report) string {
+	var text strings.Builder
+	fmt.Fprintf(&text, "Panic in %s: %s", firstSet(report.Route, report.Source), report.Value)
+	for _, detail := range [][2]string{{"request_id", report.RequestID}, {"pubkey", report.Pubkey}} {
+		if detail[1] != "" {
+			fmt.Fprintf(&text, "\n%s: %s", detail[0], detail[1])
+		}
+	}
+	for i := 0; i+1 < len(report.Fields); i += 2 {
+		fmt.Fprintf(&text, "\n%v: %v", report.Fields[i], report.Fields[i+1])
+	}
+	if report.Suppressed > 0 {
+		fmt.Fprintf(&text, "\n(%d more panics since the last alert weren't sent)", report.Suppressed)
+	}
+	stack := report.Stack
+	if len(stack) > maxAlertStack {
+		stack = stack[:maxAlertStack] + "\n..."
+	}
+	fmt.Fprintf(&text, "\n```\n%s\n```", stack)
+	return text.String()
+}
+
+// fieldMap turns slog key/value pairs into a map for the alert
+func fieldMap(fields []any) map[string]string {
+	if len(fields) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(fields)/2)
+	for i := 0; i+1 < len(fields); i += 2 {
+		m[fmt.Sprint(fields[i])] = fmt.Sprint(fields[i+1])
+	}
+	return m
+}
+
+func firstSet(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// rateLimited sends at most one alert per interval
+type rateLimited struct {
+	alerter  Alerter
+	interval time.Duration
+	now      func() time.Time
+
+	mu         sync.Mutex
+	last       time.Time
+	suppressed int
+}
+
+// RateLimited wraps alerter to send at most one alert per interval, so a
+// panic on every request doesn't flood the channel. Alerts in between are
+// dropped and counted in the next one sent.
+func RateLimited(alerter Alerter, interval time.Duration) Alerter {
+	return &rateLimited{alerter: alerter, interval: interval, now: time.Now}
+}
+
+func (r *rateLimited) Alert(ctx context.Context, report Report) error {
+	r.mu.Lock()
+	now := r.now()
+	if !r.last.IsZero() && now.Sub(r.last) < r.interval {
+		r.suppressed++
+		r.mu.Unlock()
+		return nil
+	}
+	r.last = now
+	report.Suppressed = r.suppressed
+	r.suppressed = 0
+	r.mu.Unlock()
+
+	return r.alerter.Alert(ctx, report)
+}
@@ -0,0 +1,151 @@
+// Package recovery turns panics in handlers and background work into logged,
+// alerted failures instead of blank 500s and stuck tracks
+package recovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/logging"
+)
+
+// ErrPanic is wrapped by the error Catch sets for a recovered panic
+var ErrPanic = errors.New("panic")
+
+// alertTimeout bounds sending one alert
+const alertTimeout = 10 * time.Second
+
+// Report describes a recovered panic
+type Report struct {
+	Source    string    `json:"source"` // "http", or the background work that panicked
+	Value     string    `json:"panic"`
+	Stack     string    `json:"stack"`
+	RequestID string    `json:"request_id,omitempty"`
+	Route     string    `json:"route,omitempty"` // Method and matched route, for requests
+	Pubkey    string    `json:"pubkey,omitempty"`
+	Fields    []any     `json:"-"` // slog key/value pairs describing the work, such as a track ID
+	Time      time.Time `json:"time"`
+	// Suppressed is how many alerts the rate limit dropped before this one
+	Suppressed int `json:"suppressed,omitempty"`
+}
+
+// Alerter tells someone about a recovered panic
+type Alerter interface {
+	Alert(ctx context.Context, report Report) error
+}
+
+// Middleware recovers panics in the rest of the chain, replacing
+// gin.Recovery. The panic is logged with its stack, request ID, route and
+// pubkey, the standard error envelope is sent with the request ID so a
+// report of the failure can be matched to the log, and alerter, if not nil,
+// is told in the background. Register it after logging.Middleware and
+// apierror.Middleware.
+func Middleware(alerter Alerter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			value := recover()
+			if value == nil {
+				return
+			}
+			// net/http's way of aborting a response, which it handles itself
+			if value == http.ErrAbortHandler {
+				panic(value)
+			}
+
+			ctx := c.Request.Context()
+			// A client that went away isn't a bug, and can't be answered
+			if err, ok := value.(error); ok && brokenConnection(err) {
+				logging.FromContext(ctx).Warn("client connection closed mid-response", "path", c.Request.URL.Path, "error", err)
+				c.Abort()
+				return
+			}
+
+			route := c.FullPath()
+			if route == "" {
+				route = c.Request.URL.Path
+			}
+			report := newReport("http", value)
+			report.RequestID = logging.RequestIDFromContext(ctx)
+			report.Route = c.Request.Method + " " + route
+			// NIP-98 auth sets pubkey; dual and flexible auth set nostr_pubkey
+			report.Pubkey = c.GetString("pubkey")
+			if report.Pubkey == "" {
+				report.Pubkey = c.GetString("nostr_pubkey")
+			}
+			handle(ctx, alerter, report)
+
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			apierror.Respond(c, apierror.Internal("internal error"))
+		}()
+		c.Next()
+	}
+}
+
+// Catch recovers a panic in the goroutine it's deferred in, so background
+// work fails like any other error rather than taking the server down. The
+// panic is logged and alerted as Middleware does, with fields describing the
+// work, and if err isn't nil *err is set to an error wrapping ErrPanic. It
+// only works deferred directly:
+//
+//	defer recovery.Catch(ctx, alerter, "processing", &err, "track_id", trackID)
+func Catch(ctx context.Context, alerter Alerter, source string, err *error, fields ...any) {
+	value := recover()
+	if value == nil {
+		return
+	}
+	report := newReport(source, value)
+	report.RequestID = logging.RequestIDFromContext(ctx)
+	report.Fields = fields
+	handle(ctx, alerter, report)
+
+	if err != nil {
+		*err = fmt.Errorf("%w: %v", ErrPanic, value)
+	}
+}
+
+func newReport(source string, value any) Report {
+	return Report{
+		Source: source,
+		Value:  fmt.Sprint(value),
+		Stack:  string(debug.Stack()),
+		Time:   time.Now().UTC(),
+	}
+}
+
+// handle logs report and sends it to alerter without waiting
+func handle(ctx context.Context, alerter Alerter, report Report) {
+	attrs := []any{"source", report.Source, "panic", report.Value, "stack", report.Stack}
+	if report.Route != "" {
+		attrs = append(attrs, "route", report.Route)
+	}
+	if report.Pubkey != "" {
+		attrs = append(attrs, "pubkey", report.Pubkey)
+	}
+	logging.FromContext(ctx).Error("panic recovered", append(attrs, report.Fields...)...)
+
+	if alerter == nil {
+		return
+	}
+	go func() {
+		alertCtx, cancel := context.WithTimeout(logging.WithRequestID(context.Background(), report.RequestID), alertTimeout)
+		defer cancel()
+		if err := alerter.Alert(alertCtx, report); err != nil {
+			logging.FromContext(alertCtx).Error("failed to send panic alert", "error", err)
+		}
+	}()
+}
+
+// brokenConnection reports whether err is the client closing the connection
+func brokenConnection(err error) bool {
+	return errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET)
+}
@@ -0,0 +1,202 @@
+package recovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/logging"
+)
+
+// fakeAlerter hands each alert to the test
+type fakeAlerter chan Report
+
+func (a fakeAlerter) Alert(ctx context.Context, report Report) error {
+	a <- report
+	return nil
+}
+
+func (a fakeAlerter) next(t *testing.T) Report {
+	t.Helper()
+	select {
+	case report := <-a:
+		return report
+	case <-time.After(time.Second):
+		t.Fatal("no alert sent")
+		return Report{}
+	}
+}
+
+func panicRouter(alerter Alerter, legacy bool) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(logging.Middleware(), apierror.Middleware(legacy), Middleware(alerter))
+	router.GET("/v1/tracks/:id", func(c *gin.Context) {
+		c.Set("pubkey", "owner-pubkey")
+		panic("nil track")
+	})
+	router.GET("/v1/written", func(c *gin.Context) {
+		c.String(http.StatusOK, "partial")
+		panic(errors.New("after writing"))
+	})
+	router.GET("/v1/hangup", func(c *gin.Context) {
+		panic(&os.SyscallError{Syscall: "write", Err: syscall.EPIPE})
+	})
+	return router
+}
+
+func TestMiddleware(t *testing.T) {
+	alerts := make(fakeAlerter, 1)
+	router := panicRouter(alerts, false)
+
+	req, _ := http.NewRequest("GET", "/v1/tracks/track-123", nil)
+	req.Header.Set(logging.RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"success":false,"error":{"code":"internal_error","message":"internal error"},"request_id":"req-1"}`, w.Body.String())
+
+	report := alerts.next(t)
+	assert.Equal(t, "http", report.Source)
+	assert.Equal(t, "nil track", report.Value)
+	assert.Equal(t, "req-1", report.RequestID)
+	assert.Equal(t, "GET /v1/tracks/:id", report.Route)
+	assert.Equal(t, "owner-pubkey", report.Pubkey)
+	assert.Contains(t, report.Stack, "recovery.panicRouter")
+}
+
+func TestMiddlewareLegacyEnvelope(t *testing.T) {
+	router := panicRouter(nil, true)
+
+	req, _ := http.NewRequest("GET", "/v1/tracks/track-123", nil)
+	req.Header.Set(logging.RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"success":false,"error":"internal error","code":"internal_error","request_id":"req-1"}`, w.Body.String())
+}
+
+func TestMiddlewareAfterResponseStarted(t *testing.T) {
+	alerts := make(fakeAlerter, 1)
+	router := panicRouter(alerts, false)
+
+	req, _ := http.NewRequest("GET", "/v1/written", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// The status and body already sent stand
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "partial", w.Body.String())
+	assert.Equal(t, "after writing", alerts.next(t).Value)
+}
+
+func TestMiddlewareBrokenConnection(t *testing.T) {
+	alerts := make(fakeAlerter, 1)
+	router := panicRouter(alerts, false)
+
+	req, _ := http.NewRequest("GET", "/v1/hangup", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	select {
+	case report := <-alerts:
+		t.Errorf("alerted for a closed connection: %+v", report)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestCatch(t *testing.T) {
+	alerts := make(fakeAlerter, 1)
+	ctx := logging.WithRequestID(context.Background(), "req-2")
+
+	run := func() (err error) {
+		defer Catch(ctx, alerts, "processing", &err, "track_id", "track-1")
+		var track map[string]string
+		track["status"] = "processing"
+		return nil
+	}
+	err := run()
+	require.ErrorIs(t, err, ErrPanic)
+	assert.Contains(t, err.Error(), "assignment to entry in nil map")
+
+	report := alerts.next(t)
+	assert.Equal(t, "processing", report.Source)
+	assert.Equal(t, "req-2", report.RequestID)
+	assert.Equal(t, []any{"track_id", "track-1"}, report.Fields)
+
+	// Without a panic nothing changes
+	err = func() (err error) {
+		defer Catch(ctx, alerts, "processing", &err)
+		return errors.New("ordinary failure")
+	}()
+	assert.EqualError(t, err, "ordinary failure")
+	assert.Empty(t, alerts)
+}
+
+func TestRateLimited(t *testing.T) {
+	alerts := make(fakeAlerter, 10)
+	now := time.Date(2024, 6, 10, 16, 0, 0, 0, time.UTC)
+	limited := RateLimited(alerts, time.Minute).(*rateLimited)
+	limited.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, limited.Alert(context.Background(), Report{Value: fmt.Sprint(i)}))
+	}
+	assert.Len(t, alerts, 1)
+	assert.Equal(t, "0", alerts.next(t).Value)
+
+	now = now.Add(time.Minute)
+	require.NoError(t, limited.Alert(context.Background(), Report{Value: "3"}))
+	report := alerts.next(t)
+	assert.Equal(t, "3", report.Value)
+	assert.Equal(t, 2, report.Suppressed)
+}
+
+func TestWebhookAlerter(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	err := NewWebhookAlerter(server.URL).Alert(context.Background(), Report{
+		Source:     "processing",
+		Value:      "nil track",
+		Stack:      "goroutine 1 [running]:",
+		RequestID:  "req-3",
+		Fields:     []any{"track_id", "track-1"},
+		Suppressed: 4,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "Panic in processing: nil track\nrequest_id: req-3\ntrack_id: track-1\n"+
+		"(4 more panics since the last alert weren't sent)\n```\ngoroutine 1 [running]:\n```", got["text"])
+	assert.Equal(t, map[string]interface{}{"track_id": "track-1"}, got["fields"])
+	report := got["report"].(map[string]interface{})
+	assert.Equal(t, "nil track", report["panic"])
+	assert.Equal(t, "req-3", report["request_id"])
+}
+
+func TestWebhookAlerterRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	err := NewWebhookAlerter(server.URL).Alert(context.Background(), Report{Source: "http"})
+	assert.EqualError(t, err, "alert webhook returned status 403")
+}
@@ -0,0 +1,484 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/v4/auth"
+	"github.com/wavlake/api/internal/models"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	accountDeletionsCollection = "account_deletions"
+
+	// accountDeletionCodeTTL is how long a deletion confirmation code works
+	accountDeletionCodeTTL = 10 * time.Minute
+
+	// accountDeletionTimeout bounds one run of the deletion steps, and is how
+	// long a run holds the deletion against concurrent confirmations
+	accountDeletionTimeout = 10 * time.Minute
+)
+
+var (
+	// ErrAccountDeletionNotRequested is returned when confirming a deletion
+	// that was never requested
+	ErrAccountDeletionNotRequested = errors.New("account deletion has not been requested")
+	// ErrInvalidDeletionCode is returned for a confirmation code that doesn't match
+	ErrInvalidDeletionCode = errors.New("confirmation code is invalid")
+	// ErrDeletionCodeExpired is returned for a code older than accountDeletionCodeTTL
+	ErrDeletionCodeExpired = errors.New("confirmation code has expired, request a new one")
+	// ErrAccountDeletionInProgress is returned while another request is running
+	// the deletion
+	ErrAccountDeletionInProgress = errors.New("account deletion is already running")
+)
+
+// AccountDeletionService deletes a user's account in steps recorded on an
+// account_deletions document, so a deletion that fails partway resumes where it
+// stopped
+type AccountDeletionService struct {
+	firestoreClient   *firestore.Client
+	nostrTrackService *NostrTrackService
+	userService       *UserService
+}
+
+func NewAccountDeletionService(firestoreClient *firestore.Client, nostrTrackService *NostrTrackService, userService *UserService) *AccountDeletionService {
+	return &AccountDeletionService{
+		firestoreClient:   firestoreClient,
+		nostrTrackService: nostrTrackService,
+		userService:       userService,
+	}
+}
+
+// RequestAccountDeletion issues a code that confirms deleting the user's
+// account, replacing any earlier code. A deletion that already started keeps
+// its progress, so confirming it again resumes it.
+func (s *AccountDeletionService) RequestAccountDeletion(ctx context.Context, firebaseUID string, disableFirebaseAccount bool) (*models.AccountDeletionConfirmation, error) {
+	code, err := newDeletionCode()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	confirmation := &models.AccountDeletionConfirmation{
+		ConfirmationCode: code,
+		ExpiresAt:        now.Add(accountDeletionCodeTTL),
+	}
+
+	ref := s.firestoreClient.Collection(accountDeletionsCollection).Doc(firebaseUID)
+	err = s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		deletion, err := getAccountDeletionTx(tx, ref)
+		if err != nil && !errors.Is(err, ErrAccountDeletionNotRequested) {
+			return err
+		}
+
+		if deletion != nil && deletion.Status == models.AccountDeletionStatusRunning && deletion.LeaseUntil != nil && now.Before(*deletion.LeaseUntil) {
+			return ErrAccountDeletionInProgress
+		}
+		if deletion == nil || deletion.Status == models.AccountDeletionStatusPending || deletion.Status == models.AccountDeletionStatusCompleted {
+			deletion = &models.AccountDeletion{
+				FirebaseUID:    firebaseUID,
+				Status:         models.AccountDeletionStatusPending,
+				CompletedSteps: []string{},
+				CreatedAt:      now,
+			}
+		}
+
+		deletion.DisableFirebaseAccount = deletion.DisableFirebaseAccount || disableFirebaseAccount
+		deletion.CodeHash = hashDeletionCode(code)
+		deletion.CodeExpiresAt = confirmation.ExpiresAt
+		deletion.UpdatedAt = now
+		return tx.Set(ref, deletion)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return confirmation, nil
+}
+
+// ConfirmAccountDeletion checks the code from RequestAccountDeletion and runs
+// the deletion's remaining steps: marking the user's tracks deleted and
+// purging their files, deleting their webhooks and export jobs with the
+// exports' archives, deactivating their pubkeys, deleting their users
+// document and, if requested, disabling their Firebase account. A deletion
+// that fails partway is returned with the error and resumes when confirmed
+// again with the same code, even after it expires.
+func (s *AccountDeletionService) ConfirmAccountDeletion(ctx context.Context, firebaseUID, code string) (*models.AccountDeletion, error) {
+	var deletion *models.AccountDeletion
+	ref := s.firestoreClient.Collection(accountDeletionsCollection).Doc(firebaseUID)
+	err := s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		var err error
+		if deletion, err = getAccountDeletionTx(tx, ref); err != nil {
+			return err
+		}
+
+		if subtle.ConstantTimeCompare([]byte(hashDeletionCode(code)), []byte(deletion.CodeHash)) != 1 {
+			return ErrInvalidDeletionCode
+		}
+		now := time.Now()
+		switch deletion.Status {
+		case models.AccountDeletionStatusCompleted:
+			return nil
+		case models.AccountDeletionStatusPending:
+			if now.After(deletion.CodeExpiresAt) {
+				return ErrDeletionCodeExpired
+			}
+		case models.AccountDeletionStatusRunning:
+			if deletion.LeaseUntil != nil && now.Before(*deletion.LeaseUntil) {
+				return ErrAccountDeletionInProgress
+			}
+		}
+
+		leaseUntil := now.Add(accountDeletionTimeout)
+		deletion.Status = models.AccountDeletionStatusRunning
+		deletion.LeaseUntil = &leaseUntil
+		deletion.Error = ""
+		deletion.UpdatedAt = now
+		return tx.Set(ref, deletion)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if deletion.Status == models.AccountDeletionStatusCompleted {
+		return deletion, nil
+	}
+
+	// Finish even if the client disconnects; an interrupted deletion leaves
+	// the account half removed until it is confirmed again
+	runCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), accountDeletionTimeout)
+	defer cancel()
+
+	runErr := s.runSteps(runCtx, ref, deletion)
+
+	now := time.Now()
+	updates := []firestore.Update{
+		{Path: "lease_until", Value: firestore.Delete},
+		{Path: "updated_at", Value: now},
+	}
+	deletion.LeaseUntil = nil
+	deletion.UpdatedAt = now
+	if runErr != nil {
+		deletion.Status = models.AccountDeletionStatusFailed
+		deletion.Error = runErr.Error()
+		updates = append(updates,
+			firestore.Update{Path: "status", Value: deletion.Status},
+			firestore.Update{Path: "error", Value: deletion.Error},
+		)
+	} else {
+		deletion.Status = models.AccountDeletionStatusCompleted
+		deletion.CompletedAt = &now
+		updates = append(updates,
+			firestore.Update{Path: "status", Value: deletion.Status},
+			firestore.Update{Path: "completed_at", Value: now},
+		)
+	}
+	if _, err := ref.Update(runCtx, updates); err != nil {
+		log.Printf("Failed to record account deletion outcome for user %s: %v", firebaseUID, err)
+	}
+
+	if runErr != nil {
+		log.Printf("Account deletion for user %s stopped: %v", firebaseUID, runErr)
+		return deletion, runErr
+	}
+	log.Printf("Deleted account of user %s: %d tracks, %d objects, %d webhooks, %d exports, %d pubkeys", firebaseUID, deletion.TracksDeleted, deletion.ObjectsPurged, deletion.WebhooksDeleted, deletion.ExportsDeleted, deletion.PubkeysDeactivated)
+	return deletion, nil
+}
+
+// runSteps runs the steps the deletion hasn't completed, recording each as it
+// finishes. Tracks go first because deleting them updates usage on the users
+// document, which would otherwise be recreated.
+func (s *AccountDeletionService) runSteps(ctx context.Context, ref *firestore.DocumentRef, deletion *models.AccountDeletion) error {
+	steps := []struct {
+		name string
+		run  func() ([]firestore.Update, error)
+	}{
+		{models.AccountDeletionStepTracks, func() ([]firestore.Update, error) {
+			return nil, s.deleteTracks(ctx, ref, deletion)
+		}},
+		{models.AccountDeletionStepWebhooks, func() ([]firestore.Update, error) {
+			count, err := s.deleteWebhooks(ctx, deletion.FirebaseUID)
+			deletion.WebhooksDeleted += count
+			return []firestore.Update{{Path: "webhooks_deleted", Value: firestore.Increment(count)}}, err
+		}},
+		{models.AccountDeletionStepExports, func() ([]firestore.Update, error) {
+			count, err := s.deleteExports(ctx, deletion.FirebaseUID)
+			deletion.ExportsDeleted += count
+			return []firestore.Update{{Path: "exports_deleted", Value: firestore.Increment(count)}}, err
+		}},
+		{models.AccountDeletionStepPubkeys, func() ([]firestore.Update, error) {
+			count, err := s.userService.DeactivatePubkeys(ctx, deletion.FirebaseUID)
+			deletion.PubkeysDeactivated += count
+			return []firestore.Update{{Path: "pubkeys_deactivated", Value: firestore.Increment(count)}}, err
+		}},
+		{models.AccountDeletionStepUser, func() ([]firestore.Update, error) {
+			if err := s.userService.DeleteUser(ctx, deletion.FirebaseUID); err != nil {
+				return nil, err
+			}
+			deletion.UserDeleted = true
+			return []firestore.Update{{Path: "user_deleted", Value: true}}, nil
+		}},
+		{models.AccountDeletionStepFirebase, func() ([]firestore.Update, error) {
+			if err := s.userService.DisableFirebaseAccount(ctx, deletion.FirebaseUID); err != nil {
+				return nil, err
+			}
+			deletion.FirebaseAccountDisabled = true
+			return []firestore.Update{{Path: "firebase_account_disabled", Value: true}}, nil
+		}},
+	}
+
+	for _, step := range steps {
+		if slices.Contains(deletion.CompletedSteps, step.name) {
+			continue
+		}
+		if step.name == models.AccountDeletionStepFirebase && !deletion.DisableFirebaseAccount {
+			continue
+		}
+
+		updates, err := step.run()
+		if err == nil {
+			deletion.CompletedSteps = append(deletion.CompletedSteps, step.name)
+			updates = append(updates, firestore.Update{Path: "completed_steps", Value: firestore.ArrayUnion(step.name)})
+		}
+		if len(updates) > 0 {
+			if _, updateErr := ref.Update(ctx, updates); updateErr != nil {
+				return fmt.Errorf("failed to record %s step: %w", step.name, updateErr)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s step failed: %w", step.name, err)
+		}
+	}
+	return nil
+}
+
+// deleteTracks marks each of the user's tracks deleted and purges its files,
+// counting each track on the deletion once its purge succeeds. Tracks already
+// deleted and purged, including by an earlier run, are skipped, so a track
+// whose files couldn't all be removed is retried on the next run.
+func (s *AccountDeletionService) deleteTracks(ctx context.Context, ref *firestore.DocumentRef, deletion *models.AccountDeletion) error {
+	// Selects deleted tracks too; a single equality needs no composite index
+	iter := s.firestoreClient.Collection("nostr_tracks").
+		Where("firebase_uid", "==", deletion.FirebaseUID).
+		Documents(ctx)
+	defer iter.Stop()
+
+	incomplete := 0
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to iterate tracks: %w", err)
+		}
+
+		var track models.NostrTrack
+		if err := doc.DataTo(&track); err != nil {
+			return fmt.Errorf("failed to decode track %s: %w", doc.Ref.ID, err)
+		}
+		track.ID = doc.Ref.ID
+		if track.Deleted && track.FilesPurgedAt != nil {
+			continue
+		}
+
+		if !track.Deleted {
+			if err := s.nostrTrackService.DeleteTrack(ctx, track.ID); err != nil {
+				return fmt.Errorf("failed to delete track %s: %w", track.ID, err)
+			}
+		}
+		if err := s.nostrTrackService.loadVersions(ctx, &track); err != nil {
+			return err
+		}
+		purge, err := s.nostrTrackService.PurgeTrackFiles(ctx, &track, false)
+		if err != nil {
+			return fmt.Errorf("failed to purge track %s: %w", track.ID, err)
+		}
+		if len(purge.Failed) > 0 {
+			incomplete++
+			continue
+		}
+
+		deletion.TracksDeleted++
+		deletion.ObjectsPurged += len(purge.Objects)
+		if _, err := ref.Update(ctx, []firestore.Update{
+			{Path: "tracks_deleted", Value: firestore.Increment(1)},
+			{Path: "objects_purged", Value: firestore.Increment(len(purge.Objects))},
+		}); err != nil {
+			return fmt.Errorf("failed to record deleted track %s: %w", track.ID, err)
+		}
+	}
+
+	if incomplete > 0 {
+		return fmt.Errorf("files of %d tracks could not all be deleted", incomplete)
+	}
+	return nil
+}
+
+// deleteWebhooks deletes the user's webhooks, which hold their endpoint URLs
+// and signing secrets, returning how many there were
+func (s *AccountDeletionService) deleteWebhooks(ctx context.Context, firebaseUID string) (int, error) {
+	docs, err := s.firestoreClient.Collection(userWebhooksCollection).
+		Where("firebase_uid", "==", firebaseUID).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return 0, fmt.Errorf("failed to query webhooks: %w", err)
+	}
+
+	for i, doc := range docs {
+		if _, err := doc.Ref.Delete(ctx); err != nil {
+			return i, fmt.Errorf("failed to delete webhook %s: %w", doc.Ref.ID, err)
+		}
+	}
+	return len(docs), nil
+}
+
+// deleteExports deletes the user's export archives, which async exports
+// write to the primary region, then their export jobs, returning how many
+// jobs there were. Jobs are kept until every archive is gone, so a failure
+// is retried on the next run.
+func (s *AccountDeletionService) deleteExports(ctx context.Context, firebaseUID string) (int, error) {
+	storageService := s.nostrTrackService.storageRegions.Get("")
+	objectNames, err := storageService.ListObjects(ctx, fmt.Sprintf("%s/%s/", exportPrefix, firebaseUID))
+	if err != nil {
+		return 0, fmt.Errorf("failed to list export archives: %w", err)
+	}
+	if len(objectNames) > 0 {
+		if failed := storageService.DeleteObjects(ctx, objectNames); len(failed) > 0 {
+			return 0, fmt.Errorf("%d export archives could not be deleted", len(failed))
+		}
+	}
+
+	docs, err := s.firestoreClient.Collection(exportJobsCollection).
+		Where("firebase_uid", "==", firebaseUID).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return 0, fmt.Errorf("failed to query export jobs: %w", err)
+	}
+	for i, doc := range docs {
+		if _, err := doc.Ref.Delete(ctx); err != nil {
+			return i, fmt.Errorf("failed to delete export job %s: %w", doc.Ref.ID, err)
+		}
+	}
+	return len(docs), nil
+}
+
+// getAccountDeletionTx reads a user's deletion in a transaction
+func getAccountDeletionTx(tx *firestore.Transaction, ref *firestore.DocumentRef) (*models.AccountDeletion, error) {
+	doc, err := tx.Get(ref)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, ErrAccountDeletionNotRequested
+		}
+		return nil, fmt.Errorf("failed to get account deletion: %w", err)
+	}
+
+	var deletion models.AccountDeletion
+	if err := doc.DataTo(&deletion); err != nil {
+		return nil, fmt.Errorf("failed to decode account deletion: %w", err)
+	}
+	return &deletion, nil
+}
+
+// newDeletionCode returns 8 random base32 characters
+func newDeletionCode() (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate confirmation code: %w", err)
+	}
+	return base32.StdEncoding.EncodeToString(b), nil
+}
+
+// hashDeletionCode hashes a confirmation code for storage. Codes are compared
+// case-insensitively.
+func hashDeletionCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToUpper(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
+
+// DeactivatePubkeys deactivates every pubkey linked to a user, recording an
+// unlink event for each, and returns how many were active. Registered unlink
+// callbacks run for each.
+func (s *UserService) DeactivatePubkeys(ctx context.Context, firebaseUID string) (int, error) {
+	docs, err := s.firestoreClient.Collection("nostr_auth").
+		Where("firebase_uid", "==", firebaseUID).
+		Where("active", "==", true).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return 0, fmt.Errorf("failed to query pubkeys: %w", err)
+	}
+
+	deactivated := 0
+	for _, doc := range docs {
+		changed := false
+		err := s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			changed = false
+			current, err := tx.Get(doc.Ref)
+			if err != nil {
+				return err
+			}
+			var nostrAuth models.NostrAuth
+			if err := current.DataTo(&nostrAuth); err != nil {
+				return err
+			}
+			// Unlinked or transferred since the query
+			if !nostrAuth.Active || nostrAuth.FirebaseUID != firebaseUID {
+				return nil
+			}
+
+			if err := tx.Update(doc.Ref, []firestore.Update{{Path: "active", Value: false}}); err != nil {
+				return err
+			}
+			changed = true
+			return s.recordNostrAuthEventTx(ctx, tx, models.NostrAuthEvent{
+				Type:           models.NostrAuthEventUnlink,
+				Pubkey:         doc.Ref.ID,
+				OldFirebaseUID: firebaseUID,
+			})
+		})
+		if err != nil {
+			return deactivated, fmt.Errorf("failed to deactivate pubkey %s: %w", doc.Ref.ID, err)
+		}
+		if !changed {
+			continue
+		}
+		deactivated++
+		for _, fn := range s.onUnlink {
+			fn(doc.Ref.ID)
+		}
+	}
+	return deactivated, nil
+}
+
+// DeleteUser deletes a user's users document; a missing document isn't an error
+func (s *UserService) DeleteUser(ctx context.Context, firebaseUID string) error {
+	if _, err := s.firestoreClient.Collection("users").Doc(firebaseUID).Delete(ctx); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	return nil
+}
+
+// DisableFirebaseAccount disables a user's Firebase account so it can't sign
+// in again. An account that no longer exists counts as disabled.
+func (s *UserService) DisableFirebaseAccount(ctx context.Context, firebaseUID string) error {
+	if s.firebaseAuth == nil {
+		return fmt.Errorf("firebase auth is not configured")
+	}
+	if _, err := s.firebaseAuth.UpdateUser(ctx, firebaseUID, (&auth.UserToUpdate{}).Disabled(true)); err != nil && !auth.IsUserNotFound(err) {
+		return fmt.Errorf("failed to disable firebase account: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/wavlake/api/internal/models"
+)
+
+func TestDeletionCode(t *testing.T) {
+	code, err := newDeletionCode()
+	require.NoError(t, err)
+	assert.Len(t, code, 8)
+	assert.Regexp(t, "^[A-Z2-7]{8}$", code)
+
+	other, err := newDeletionCode()
+	require.NoError(t, err)
+	assert.NotEqual(t, code, other)
+
+	// Codes typed back in lowercase or with stray spaces still match
+	assert.Equal(t, hashDeletionCode(code), hashDeletionCode(" "+code+"\n"))
+	assert.Equal(t, hashDeletionCode("ABCD2345"), hashDeletionCode("abcd2345"))
+	assert.NotEqual(t, hashDeletionCode(code), hashDeletionCode(other))
+	assert.NotContains(t, hashDeletionCode(code), code)
+}
+
+// AccountDeletionEmulatorTestSuite exercises account deletion against the
+// Firestore emulator. Run with FIRESTORE_EMULATOR_HOST set, as for
+// NostrTrackEmulatorTestSuite.
+type AccountDeletionEmulatorTestSuite struct {
+	suite.Suite
+	ctx     context.Context
+	client  *firestore.Client
+	storage *deletingStorage
+	service *AccountDeletionService
+	uid     string
+}
+
+func (suite *AccountDeletionEmulatorTestSuite) SetupSuite() {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		suite.T().Skip("FIRESTORE_EMULATOR_HOST not set, skipping emulator tests")
+	}
+
+	suite.ctx = context.Background()
+	client, err := firestore.NewClient(suite.ctx, "wavlake-test")
+	suite.Require().NoError(err)
+	suite.client = client
+}
+
+func (suite *AccountDeletionEmulatorTestSuite) TearDownSuite() {
+	if suite.client != nil {
+		suite.client.Close()
+	}
+}
+
+func (suite *AccountDeletionEmulatorTestSuite) SetupTest() {
+	suite.uid = uuid.New().String()
+	suite.storage = &deletingStorage{objects: map[string]bool{}, failures: map[string]int{}}
+	suite.service = NewAccountDeletionService(suite.client,
+		NewNostrTrackService(suite.client, NewStorageRegions("us", suite.storage)),
+		NewUserService(suite.client, nil))
+}
+
+// seedAccount stores a users document, a linked pubkey, two tracks, one
+// already deleted, a webhook and a finished export with its archive
+func (suite *AccountDeletionEmulatorTestSuite) seedAccount() (pubkey string, trackIDs []string) {
+	pubkey = "pk-" + uuid.New().String()
+	now := time.Now()
+	_, err := suite.client.Collection("users").Doc(suite.uid).Set(suite.ctx, models.User{
+		FirebaseUID:   suite.uid,
+		ActivePubkeys: []string{pubkey},
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	})
+	suite.Require().NoError(err)
+	_, err = suite.client.Collection("nostr_auth").Doc(pubkey).Set(suite.ctx, models.NostrAuth{
+		Pubkey:      pubkey,
+		FirebaseUID: suite.uid,
+		Active:      true,
+		CreatedAt:   now,
+		LinkedAt:    now,
+	})
+	suite.Require().NoError(err)
+
+	for _, deleted := range []bool{false, true} {
+		id := uuid.New().String()
+		_, err := suite.client.Collection("nostr_tracks").Doc(id).Set(suite.ctx, models.NostrTrack{
+			ID:          id,
+			FirebaseUID: suite.uid,
+			Pubkey:      pubkey,
+			Extension:   "wav",
+			Deleted:     deleted,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		})
+		suite.Require().NoError(err)
+		suite.storage.objects["tracks/original/"+id+".wav"] = true
+		trackIDs = append(trackIDs, id)
+	}
+
+	webhookID := uuid.New().String()
+	_, err = suite.client.Collection(userWebhooksCollection).Doc(webhookID).Set(suite.ctx, models.UserWebhook{
+		ID:          webhookID,
+		FirebaseUID: suite.uid,
+		URL:         "https://hooks.example.com/wavlake",
+		Secret:      "0123456789abcdef",
+		Active:      true,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	})
+	suite.Require().NoError(err)
+	jobID := uuid.New().String()
+	archive := fmt.Sprintf("%s/%s/%s.zip", exportPrefix, suite.uid, jobID)
+	_, err = suite.client.Collection(exportJobsCollection).Doc(jobID).Set(suite.ctx, models.ExportJob{
+		ID:          jobID,
+		FirebaseUID: suite.uid,
+		Status:      models.ExportJobStatusCompleted,
+		ObjectName:  archive,
+		CreatedAt:   now,
+	})
+	suite.Require().NoError(err)
+	suite.storage.objects[archive] = true
+	return pubkey, trackIDs
+}
+
+// remaining counts the user's documents left in collection
+func (suite *AccountDeletionEmulatorTestSuite) remaining(collection string) int {
+	docs, err := suite.client.Collection(collection).Where("firebase_uid", "==", suite.uid).Documents(suite.ctx).GetAll()
+	suite.Require().NoError(err)
+	return len(docs)
+}
+
+func (suite *AccountDeletionEmulatorTestSuite) TestDeletesAccount() {
+	pubkey, trackIDs := suite.seedAccount()
+
+	confirmation, err := suite.service.RequestAccountDeletion(suite.ctx, suite.uid, false)
+	suite.Require().NoError(err)
+
+	_, err = suite.service.ConfirmAccountDeletion(suite.ctx, suite.uid, "WRONGCOD")
+	suite.ErrorIs(err, ErrInvalidDeletionCode)
+
+	deletion, err := suite.service.ConfirmAccountDeletion(suite.ctx, suite.uid, confirmation.ConfirmationCode)
+	suite.Require().NoError(err)
+	suite.Equal(models.AccountDeletionStatusCompleted, deletion.Status)
+	suite.Equal([]string{models.AccountDeletionStepTracks, models.AccountDeletionStepWebhooks, models.AccountDeletionStepExports, models.AccountDeletionStepPubkeys, models.AccountDeletionStepUser}, deletion.CompletedSteps)
+	suite.Equal(2, deletion.TracksDeleted)
+	suite.Equal(1, deletion.WebhooksDeleted)
+	suite.Equal(1, deletion.ExportsDeleted)
+	suite.Equal(1, deletion.PubkeysDeactivated)
+	suite.True(deletion.UserDeleted)
+	suite.False(deletion.FirebaseAccountDisabled)
+	suite.Empty(suite.storage.objects)
+	suite.Zero(suite.remaining(userWebhooksCollection))
+	suite.Zero(suite.remaining(exportJobsCollection))
+
+	for _, id := range trackIDs {
+		doc, err := suite.client.Collection("nostr_tracks").Doc(id).Get(suite.ctx)
+		suite.Require().NoError(err)
+		var track models.NostrTrack
+		suite.Require().NoError(doc.DataTo(&track))
+		suite.True(track.Deleted)
+		suite.NotNil(track.FilesPurgedAt)
+	}
+	doc, err := suite.client.Collection("nostr_auth").Doc(pubkey).Get(suite.ctx)
+	suite.Require().NoError(err)
+	suite.False(doc.Data()["active"].(bool))
+	_, err = suite.client.Collection("users").Doc(suite.uid).Get(suite.ctx)
+	suite.Error(err, "users document is deleted")
+
+	// The stored record matches, and confirming again returns it unchanged
+	again, err := suite.service.ConfirmAccountDeletion(suite.ctx, suite.uid, confirmation.ConfirmationCode)
+	suite.Require().NoError(err)
+	suite.Equal(deletion.TracksDeleted, again.TracksDeleted)
+	suite.Equal(deletion.CompletedSteps, again.CompletedSteps)
+}
+
+func (suite *AccountDeletionEmulatorTestSuite) TestResumesFailedDeletion() {
+	_, trackIDs := suite.seedAccount()
+	failing := "tracks/original/" + trackIDs[0] + ".wav"
+	suite.storage.failures[failing] = 100
+
+	confirmation, err := suite.service.RequestAccountDeletion(suite.ctx, suite.uid, false)
+	suite.Require().NoError(err)
+
+	deletion, err := suite.service.ConfirmAccountDeletion(suite.ctx, suite.uid, confirmation.ConfirmationCode)
+	suite.Require().Error(err)
+	suite.Equal(models.AccountDeletionStatusFailed, deletion.Status)
+	suite.Equal(1, deletion.TracksDeleted, "the track whose files were removed is counted")
+	suite.Empty(deletion.CompletedSteps)
+
+	// Retrying with the same code picks up the remaining track and steps
+	suite.storage.failures[failing] = 0
+	deletion, err = suite.service.ConfirmAccountDeletion(suite.ctx, suite.uid, confirmation.ConfirmationCode)
+	suite.Require().NoError(err)
+	suite.Equal(models.AccountDeletionStatusCompleted, deletion.Status)
+	suite.Equal(2, deletion.TracksDeleted)
+	suite.Equal(1, deletion.PubkeysDeactivated)
+	suite.Empty(suite.storage.objects)
+}
+
+func (suite *AccountDeletionEmulatorTestSuite) TestResumesFailedExportDeletion() {
+	suite.seedAccount()
+	var archive string
+	for objectName := range suite.storage.objects {
+		if strings.HasPrefix(objectName, exportPrefix+"/") {
+			archive = objectName
+		}
+	}
+	suite.storage.failures[archive] = 100
+
+	confirmation, err := suite.service.RequestAccountDeletion(suite.ctx, suite.uid, false)
+	suite.Require().NoError(err)
+
+	// The job is kept while its archive remains, so the retry finds it
+	deletion, err := suite.service.ConfirmAccountDeletion(suite.ctx, suite.uid, confirmation.ConfirmationCode)
+	suite.Require().Error(err)
+	suite.Equal([]string{models.AccountDeletionStepTracks, models.AccountDeletionStepWebhooks}, deletion.CompletedSteps)
+	suite.Equal(1, suite.remaining(exportJobsCollection))
+
+	suite.storage.failures[archive] = 0
+	deletion, err = suite.service.ConfirmAccountDeletion(suite.ctx, suite.uid, confirmation.ConfirmationCode)
+	suite.Require().NoError(err)
+	suite.Equal(models.AccountDeletionStatusCompleted, deletion.Status)
+	suite.Equal(1, deletion.WebhooksDeleted)
+	suite.Equal(1, deletion.ExportsDeleted)
+	suite.Empty(suite.storage.objects)
+	suite.Zero(suite.remaining(exportJobsCollection))
+}
+
+func (suite *AccountDeletionEmulatorTestSuite) TestExpiredCode() {
+	confirmation, err := suite.service.RequestAccountDeletion(suite.ctx, suite.uid, false)
+	suite.Require().NoError(err)
+	_, err = suite.client.Collection(accountDeletionsCollection).Doc(suite.uid).Update(suite.ctx, []firestore.Update{
+		{Path: "code_expires_at", Value: time.Now().Add(-time.Minute)},
+	})
+	suite.Require().NoError(err)
+
+	_, err = suite.service.ConfirmAccountDeletion(suite.ctx, suite.uid, confirmation.ConfirmationCode)
+	suite.ErrorIs(err, ErrDeletionCodeExpired)
+
+	// A new code replaces the expired one
+	confirmation, err = suite.service.RequestAccountDeletion(suite.ctx, suite.uid, false)
+	suite.Require().NoError(err)
+	deletion, err := suite.service.ConfirmAccountDeletion(suite.ctx, suite.uid, confirmation.ConfirmationCode)
+	suite.Require().NoError(err)
+	suite.Equal(models.AccountDeletionStatusCompleted, deletion.Status)
+}
+
+func (suite *AccountDeletionEmulatorTestSuite) TestRunningDeletionIsHeld() {
+	confirmation, err := suite.service.RequestAccountDeletion(suite.ctx, suite.uid, false)
+	suite.Require().NoError(err)
+	_, err = suite.client.Collection(accountDeletionsCollection).Doc(suite.uid).Update(suite.ctx, []firestore.Update{
+		{Path: "status", Value: models.AccountDeletionStatusRunning},
+		{Path: "lease_until", Value: time.Now().Add(time.Minute)},
+	})
+	suite.Require().NoError(err)
+
+	_, err = suite.service.ConfirmAccountDeletion(suite.ctx, suite.uid, confirmation.ConfirmationCode)
+	suite.ErrorIs(err, ErrAccountDeletionInProgress)
+	_, err = suite.service.RequestAccountDeletion(suite.ctx, suite.uid, false)
+	suite.ErrorIs(err, ErrAccountDeletionInProgress)
+}
+
+func (suite *AccountDeletionEmulatorTestSuite) TestNotRequested() {
+	_, err := suite.service.ConfirmAccountDeletion(suite.ctx, suite.uid, "ABCD2345")
+	suite.ErrorIs(err, ErrAccountDeletionNotRequested)
+}
+
+func (suite *AccountDeletionEmulatorTestSuite) TestFirebaseStepNeedsFirebaseAuth() {
+	confirmation, err := suite.service.RequestAccountDeletion(suite.ctx, suite.uid, true)
+	suite.Require().NoError(err)
+
+	// The test service has no Firebase client, so only that step fails
+	deletion, err := suite.service.ConfirmAccountDeletion(suite.ctx, suite.uid, confirmation.ConfirmationCode)
+	suite.Require().Error(err)
+	suite.Equal(models.AccountDeletionStatusFailed, deletion.Status)
+	suite.Equal([]string{models.AccountDeletionStepTracks, models.AccountDeletionStepWebhooks, models.AccountDeletionStepExports, models.AccountDeletionStepPubkeys, models.AccountDeletionStepUser}, deletion.CompletedSteps)
+	suite.Contains(deletion.Error, models.AccountDeletionStepFirebase)
+}
+
+func TestAccountDeletionEmulatorTestSuite(t *testing.T) {
+	suite.Run(t, new(AccountDeletionEmulatorTestSuite))
+}
@@ -0,0 +1,320 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+	"github.com/wavlake/api/internal/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	bulkCompressionJobsCollection = "bulk_compression_jobs"
+
+	// MaxBulkCompressionTracks bounds how many tracks one request may cover,
+	// which keeps the job document well under Firestore's size limit
+	MaxBulkCompressionTracks = 500
+
+	// bulkCompressionConcurrency is how many tracks of a job compress at once
+	bulkCompressionConcurrency = 2
+
+	// bulkJobWriteTimeout bounds each Firestore write a background job makes:
+	// progress updates, completion, and reserving a track's versions
+	bulkJobWriteTimeout = 10 * time.Second
+)
+
+var (
+	// ErrBulkCompressionJobNotFound is returned when a job doesn't exist or belongs to another pubkey
+	ErrBulkCompressionJobNotFound = errors.New("bulk compression job not found")
+	// ErrTooManyBulkTracks is returned when a request covers more than MaxBulkCompressionTracks
+	ErrTooManyBulkTracks = fmt.Errorf("at most %d tracks can be compressed in one request", MaxBulkCompressionTracks)
+)
+
+// CompressionPresets are named compression options accepted by bulk requests
+var CompressionPresets = map[string]models.CompressionOption{
+	"streaming-low":      {Format: "mp3", Bitrate: 64, Quality: "low", SampleRate: 44100},
+	"streaming-standard": {Format: "mp3", Bitrate: 128, Quality: "medium", SampleRate: 44100},
+	"high":               {Format: "mp3", Bitrate: 320, Quality: "high", SampleRate: 44100},
+	"aac-high":           {Format: "aac", Bitrate: 256, Quality: "high", SampleRate: 44100},
+	"ogg-standard":       {Format: "ogg", Bitrate: 128, Quality: "medium", SampleRate: 44100},
+	"opus-standard":      {Format: "opus", Bitrate: 96, Quality: "medium", SampleRate: 48000},
+	"data-saver":         {Format: "opus", Bitrate: 32, Quality: "low", SampleRate: 48000},
+}
+
+// BulkCompressionService requests compression versions across many tracks at
+// once. Each track is checked and deduplicated up front; the versions it is
+// missing are then compressed in the background, a few tracks at a time.
+type BulkCompressionService struct {
+	firestoreClient   *firestore.Client
+	nostrTrackService *NostrTrackService
+	processingService *ProcessingService
+}
+
+func NewBulkCompressionService(firestoreClient *firestore.Client, nostrTrackService *NostrTrackService, processingService *ProcessingService) *BulkCompressionService {
+	return &BulkCompressionService{
+		firestoreClient:   firestoreClient,
+		nostrTrackService: nostrTrackService,
+		processingService: processingService,
+	}
+}
+
+// StartBulkCompression plans compression for the given tracks, or for all of
+// the pubkey's tracks when all is set, saves the job and starts the work. The
+// returned job carries the per-track plan and the queued/skipped/rejected counts.
+func (s *BulkCompressionService) StartBulkCompression(ctx context.Context, pubkey string, trackIDs []string, all bool, options []models.CompressionOption) (*models.BulkCompressionJob, error) {
+	var tracks []*models.NostrTrack
+	var missing []string
+	if all {
+		owned, err := s.nostrTrackService.GetTracksByPubkey(ctx, pubkey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tracks: %w", err)
+		}
+		tracks = owned
+	} else {
+		trackIDs = uniqueStrings(trackIDs)
+		if len(trackIDs) > MaxBulkCompressionTracks {
+			return nil, ErrTooManyBulkTracks
+		}
+		for _, trackID := range trackIDs {
+			track, err := s.nostrTrackService.GetTrack(ctx, trackID)
+			if err != nil {
+				missing = append(missing, trackID)
+				continue
+			}
+			tracks = append(tracks, track)
+		}
+	}
+	if len(tracks)+len(missing) > MaxBulkCompressionTracks {
+		return nil, ErrTooManyBulkTracks
+	}
+
+	options = uniqueCompressionOptions(options)
+	job := &models.BulkCompressionJob{
+		ID:        uuid.New().String(),
+		Pubkey:    pubkey,
+		Status:    models.BulkCompressionJobStatusRunning,
+		Options:   options,
+		Tracks:    []models.BulkCompressionTrack{},
+		CreatedAt: time.Now(),
+	}
+	for _, track := range tracks {
+		job.Tracks = append(job.Tracks, planBulkCompression(track, pubkey, options))
+	}
+	for _, trackID := range missing {
+		job.Tracks = append(job.Tracks, models.BulkCompressionTrack{
+			TrackID: trackID,
+			Result:  models.BulkCompressionRejected,
+			Reason:  "track not found",
+		})
+	}
+
+	for _, planned := range job.Tracks {
+		switch planned.Result {
+		case models.BulkCompressionQueued:
+			job.Queued++
+		case models.BulkCompressionSkipped:
+			job.Skipped++
+		case models.BulkCompressionRejected:
+			job.Rejected++
+		}
+	}
+	if job.Queued == 0 {
+		now := time.Now()
+		job.Status = models.BulkCompressionJobStatusCompleted
+		job.CompletedAt = &now
+	}
+
+	if _, err := s.firestoreClient.Collection(bulkCompressionJobsCollection).Doc(job.ID).Set(ctx, job); err != nil {
+		return nil, fmt.Errorf("failed to save bulk compression job: %w", err)
+	}
+
+	log.Printf("Bulk compression job %s for %s: %d queued, %d skipped, %d rejected", job.ID, pubkey, job.Queued, job.Skipped, job.Rejected)
+
+	if job.Queued > 0 {
+		go s.runBulkCompression(job)
+	}
+
+	return job, nil
+}
+
+// planBulkCompression decides what a bulk request does with one track. Only
+// the requested options the track doesn't already have a version for are queued.
+func planBulkCompression(track *models.NostrTrack, pubkey string, options []models.CompressionOption) models.BulkCompressionTrack {
+	planned := models.BulkCompressionTrack{TrackID: track.ID}
+
+	switch {
+	case track.Pubkey != pubkey:
+		planned.Result = models.BulkCompressionRejected
+		planned.Reason = "track not owned by this pubkey"
+	case track.Deleted:
+		planned.Result = models.BulkCompressionRejected
+		planned.Reason = "track is deleted"
+	case track.Status != models.TrackStatusReady:
+		planned.Result = models.BulkCompressionSkipped
+		planned.Reason = fmt.Sprintf("track is %s, not ready", track.Status)
+	default:
+		for _, option := range options {
+			if !hasCompressionVersion(track, option) {
+				planned.Options = append(planned.Options, option)
+			}
+		}
+		if len(planned.Options) == 0 {
+			planned.Result = models.BulkCompressionSkipped
+			planned.Reason = "all requested versions already exist"
+		} else {
+			planned.Result = models.BulkCompressionQueued
+		}
+	}
+
+	return planned
+}
+
+// hasCompressionVersion reports whether a track already has a version made
+// from an equivalent request. Versions are matched on the options they were
+// requested with, since the encoder may report a slightly different bitrate.
+// Failed versions are ignored so they can be retried.
+func hasCompressionVersion(track *models.NostrTrack, option models.CompressionOption) bool {
+	for _, version := range track.CompressionVersions {
+		if version.Status != models.VersionStatusFailed && sameCompressionOption(version.Options, option) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameCompressionOption compares two options; an unset sample rate matches any
+func sameCompressionOption(a, b models.CompressionOption) bool {
+	if a.Format != b.Format || a.Bitrate != b.Bitrate || a.Quality != b.Quality {
+		return false
+	}
+	return a.SampleRate == 0 || b.SampleRate == 0 || a.SampleRate == b.SampleRate
+}
+
+// uniqueCompressionOptions drops options equivalent to an earlier one
+func uniqueCompressionOptions(options []models.CompressionOption) []models.CompressionOption {
+	unique := []models.CompressionOption{}
+	for _, option := range options {
+		duplicate := false
+		for _, seen := range unique {
+			if sameCompressionOption(seen, option) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			unique = append(unique, option)
+		}
+	}
+	return unique
+}
+
+// uniqueStrings drops repeated values, keeping the first occurrence
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// runBulkCompression compresses every queued track of a job, updating the
+// job's completed and failed counts as each track finishes
+func (s *BulkCompressionService) runBulkCompression(job *models.BulkCompressionJob) {
+	ref := s.firestoreClient.Collection(bulkCompressionJobsCollection).Doc(job.ID)
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, bulkCompressionConcurrency)
+	for _, planned := range job.Tracks {
+		if planned.Result != models.BulkCompressionQueued {
+			continue
+		}
+
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(planned models.BulkCompressionTrack) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			updates := []firestore.Update{{Path: "completed", Value: firestore.Increment(1)}}
+			if err := s.compressTrack(planned); err != nil {
+				log.Printf("Bulk compression job %s failed for track %s: %v", job.ID, planned.TrackID, err)
+				updates = []firestore.Update{
+					{Path: "failed", Value: firestore.Increment(1)},
+					{Path: "failed_track_ids", Value: firestore.ArrayUnion(planned.TrackID)},
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), bulkJobWriteTimeout)
+			defer cancel()
+			if _, err := ref.Update(ctx, updates); err != nil {
+				log.Printf("Failed to record bulk compression progress for job %s: %v", job.ID, err)
+			}
+		}(planned)
+	}
+	wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), bulkJobWriteTimeout)
+	defer cancel()
+	if _, err := ref.Update(ctx, []firestore.Update{
+		{Path: "status", Value: models.BulkCompressionJobStatusCompleted},
+		{Path: "completed_at", Value: time.Now()},
+	}); err != nil {
+		log.Printf("Failed to mark bulk compression job %s completed: %v", job.ID, err)
+		return
+	}
+
+	log.Printf("Bulk compression job %s completed (%d tracks)", job.ID, job.Queued)
+}
+
+// compressTrack reserves and creates the missing versions of one track as a
+// single request would, so the track's version limit holds and versions
+// another request has queued meanwhile aren't encoded twice. Every version
+// is attempted even if another fails.
+func (s *BulkCompressionService) compressTrack(planned models.BulkCompressionTrack) error {
+	p := s.processingService
+	ctx, cancel := context.WithTimeout(context.Background(), bulkJobWriteTimeout)
+	result, err := s.nostrTrackService.ReserveCompressionVersions(ctx, planned.TrackID, planned.Options, time.Now().Add(-p.processingTimeout))
+	cancel()
+	if err != nil {
+		return err
+	}
+	if len(result.Queued) == 0 {
+		return nil
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), p.compressionRequestTimeout(len(result.Queued)))
+	defer cancel()
+	return p.processReservedCompressions(ctx, planned.TrackID, result.Queued)
+}
+
+// GetBulkCompressionJob returns a pubkey's bulk compression job
+func (s *BulkCompressionService) GetBulkCompressionJob(ctx context.Context, pubkey, jobID string) (*models.BulkCompressionJob, error) {
+	doc, err := s.firestoreClient.Collection(bulkCompressionJobsCollection).Doc(jobID).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, ErrBulkCompressionJobNotFound
+		}
+		return nil, fmt.Errorf("failed to get bulk compression job: %w", err)
+	}
+
+	var job models.BulkCompressionJob
+	if err := doc.DataTo(&job); err != nil {
+		return nil, fmt.Errorf("failed to decode bulk compression job: %w", err)
+	}
+	if job.Pubkey != pubkey {
+		return nil, ErrBulkCompressionJobNotFound
+	}
+
+	return &job, nil
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wavlake/api/internal/models"
+)
+
+func bulkTestTrack() *models.NostrTrack {
+	return &models.NostrTrack{
+		ID:     "track-1",
+		Pubkey: "owner",
+		Status: models.TrackStatusReady,
+		CompressionVersions: []models.CompressionVersion{
+			{ID: "default", Bitrate: 127, Format: "mp3", Options: CompressionPresets["streaming-standard"]},
+		},
+	}
+}
+
+func TestPlanBulkCompressionQueuesOnlyMissingVersions(t *testing.T) {
+	options := []models.CompressionOption{CompressionPresets["streaming-standard"], CompressionPresets["high"]}
+
+	planned := planBulkCompression(bulkTestTrack(), "owner", options)
+
+	assert.Equal(t, models.BulkCompressionQueued, planned.Result)
+	assert.Equal(t, []models.CompressionOption{CompressionPresets["high"]}, planned.Options)
+}
+
+func TestPlanBulkCompressionSkipsExistingVersions(t *testing.T) {
+	// An unset sample rate matches the default version's 44100
+	options := []models.CompressionOption{{Format: "mp3", Bitrate: 128, Quality: "medium"}}
+
+	planned := planBulkCompression(bulkTestTrack(), "owner", options)
+
+	assert.Equal(t, models.BulkCompressionSkipped, planned.Result)
+	assert.Equal(t, "all requested versions already exist", planned.Reason)
+	assert.Empty(t, planned.Options)
+}
+
+func TestPlanBulkCompressionChecksTrack(t *testing.T) {
+	options := []models.CompressionOption{CompressionPresets["high"]}
+
+	planned := planBulkCompression(bulkTestTrack(), "someone-else", options)
+	assert.Equal(t, models.BulkCompressionRejected, planned.Result)
+
+	deleted := bulkTestTrack()
+	deleted.Deleted = true
+	planned = planBulkCompression(deleted, "owner", options)
+	assert.Equal(t, models.BulkCompressionRejected, planned.Result)
+
+	processing := bulkTestTrack()
+	processing.Status = models.TrackStatusProcessing
+	planned = planBulkCompression(processing, "owner", options)
+	assert.Equal(t, models.BulkCompressionSkipped, planned.Result)
+	assert.Equal(t, "track is processing, not ready", planned.Reason)
+}
+
+func TestUniqueCompressionOptions(t *testing.T) {
+	options := uniqueCompressionOptions([]models.CompressionOption{
+		CompressionPresets["high"],
+		{Format: "mp3", Bitrate: 320, Quality: "high"},
+		CompressionPresets["aac-high"],
+	})
+
+	assert.Equal(t, []models.CompressionOption{CompressionPresets["high"], CompressionPresets["aac-high"]}, options)
+}
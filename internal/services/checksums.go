@@ -0,0 +1,87 @@
+package services
+
+import (
+	"bytes"
+	"crypto/md5" // #nosec G501 -- Only compared with the MD5 storage records, not used for security
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// ErrChecksumMismatch is returned when a downloaded object doesn't match the
+// checksums storage recorded for it
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ObjectChecksums are the checksums storage recorded for an object. Either
+// may be missing; GCS has no MD5 for composite objects.
+type ObjectChecksums struct {
+	CRC32C    uint32
+	HasCRC32C bool
+	MD5       []byte
+}
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// downloadHash computes a download's SHA-256 alongside the checksums storage
+// records, so a single pass over the data both hashes and verifies it
+type downloadHash struct {
+	sha256 hash.Hash
+	crc32c hash.Hash32
+	md5    hash.Hash
+}
+
+func newDownloadHash() *downloadHash {
+	return &downloadHash{
+		sha256: sha256.New(),
+		crc32c: crc32.New(crc32cTable),
+		md5:    md5.New(), // #nosec G401 -- Integrity check against storage metadata
+	}
+}
+
+func (h *downloadHash) Write(p []byte) (int, error) {
+	h.sha256.Write(p)
+	h.crc32c.Write(p)
+	h.md5.Write(p)
+	return len(p), nil
+}
+
+// SHA256 returns the hex SHA-256 of the data written so far
+func (h *downloadHash) SHA256() string {
+	return hex.EncodeToString(h.sha256.Sum(nil))
+}
+
+// Verify compares the data written with the checksums storage recorded. A nil
+// expected, or one with neither checksum, passes.
+func (h *downloadHash) Verify(expected *ObjectChecksums) error {
+	if expected == nil {
+		return nil
+	}
+	if expected.HasCRC32C && h.crc32c.Sum32() != expected.CRC32C {
+		return fmt.Errorf("%w: CRC32C is %08x, storage recorded %08x", ErrChecksumMismatch, h.crc32c.Sum32(), expected.CRC32C)
+	}
+	if expected.MD5 != nil && !bytes.Equal(h.md5.Sum(nil), expected.MD5) {
+		return fmt.Errorf("%w: MD5 is %x, storage recorded %x", ErrChecksumMismatch, h.md5.Sum(nil), expected.MD5)
+	}
+	return nil
+}
+
+// sha256Reader hashes what is read through it, for files hashed as they are
+// uploaded
+type sha256Reader struct {
+	io.Reader
+	hash hash.Hash
+}
+
+func newSHA256Reader(r io.Reader) *sha256Reader {
+	h := sha256.New()
+	return &sha256Reader{Reader: io.TeeReader(r, h), hash: h}
+}
+
+// Sum returns the hex SHA-256 of everything read
+func (r *sha256Reader) Sum() string {
+	return hex.EncodeToString(r.hash.Sum(nil))
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/wavlake/api/internal/logging"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/recovery"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultCompressionWorkers is how many versions of one compression request
+// are encoded at once. Each encode keeps an ffmpeg process busy, so this is
+// kept low to stay within the instance's CPUs.
+const DefaultCompressionWorkers = 2
+
+// WithCompressionWorkers sets how many versions of one compression request
+// are encoded at once
+func WithCompressionWorkers(workers int) ProcessingOption {
+	return func(p *ProcessingService) {
+		if workers > 0 {
+			p.compressionWorkers = workers
+		}
+	}
+}
+
+// compressionOutcome is how one reserved version's encode went
+type compressionOutcome struct {
+	Item    models.CompressionRequestItem
+	Version *models.CompressionVersion // Set when the encode succeeded
+	Err     error
+}
+
+// record returns the version report saving the outcome: the completed
+// version, or the reserved one marked failed with its error
+func (o compressionOutcome) record() models.CompressionVersion {
+	if o.Err != nil {
+		return models.CompressionVersion{
+			ID:     o.Item.VersionID,
+			Status: models.VersionStatusFailed,
+			Error:  o.Err.Error(),
+		}
+	}
+	version := *o.Version
+	version.Status = models.VersionStatusCompleted
+	return version
+}
+
+// processReservedCompressionsAsync compresses the versions of one request in
+// the background
+func (p *ProcessingService) processReservedCompressionsAsync(ctx context.Context, trackID string, items []models.CompressionRequestItem) {
+	go func() {
+		// Create a background context with timeout, keeping the request ID
+		processCtx, cancel := context.WithTimeout(logging.WithRequestID(context.Background(), logging.RequestIDFromContext(ctx)), p.compressionRequestTimeout(len(items)))
+		defer cancel()
+		defer recovery.Catch(processCtx, p.panicAlerter, "compression", nil, "track_id", trackID)
+
+		if err := p.processReservedCompressions(processCtx, trackID, items); err != nil {
+			logging.FromContext(processCtx).Error("async compression failed", "track_id", trackID, "versions", len(items), "error", err)
+		}
+	}()
+}
+
+// compressionRequestTimeout bounds compressing count versions of one request:
+// each encode gets processingTimeout, and encodes run in rounds of
+// compressionWorkers
+func (p *ProcessingService) compressionRequestTimeout(count int) time.Duration {
+	rounds := (count + p.compressionWorkers - 1) / p.compressionWorkers
+	return p.processingTimeout * time.Duration(rounds)
+}
+
+// processReservedCompressions creates the versions reserved by one
+// ReserveCompressionVersions call, then records every completed and failed
+// version in a single track update. Versions that fail don't fail the
+// others; once they're recorded, their errors are returned joined.
+func (p *ProcessingService) processReservedCompressions(ctx context.Context, trackID string, items []models.CompressionRequestItem) error {
+	logging.FromContext(ctx).Info("starting compression", "track_id", trackID, "versions", len(items), "workers", p.compressionWorkers)
+
+	var outcomes []compressionOutcome
+	track, err := p.nostrTrackService.GetTrack(ctx, trackID)
+	if err != nil {
+		err = fmt.Errorf("failed to get track: %w", err)
+		for _, item := range items {
+			outcomes = append(outcomes, compressionOutcome{Item: item, Err: err})
+		}
+	} else {
+		outcomes = p.compressVersions(ctx, track, items)
+	}
+
+	// A cancelled run's versions are recorded failed like any other, so a
+	// track that's reprocessed or restored isn't left with them pending
+	records := make([]models.CompressionVersion, 0, len(outcomes))
+	var completed []*models.CompressionVersion
+	var failed []error
+	cancelled := false
+	for _, outcome := range outcomes {
+		records = append(records, outcome.record())
+		if errors.Is(outcome.Err, ErrProcessingCancelled) {
+			cancelled = true
+		} else if outcome.Err != nil {
+			logging.FromContext(ctx).Warn("compression version failed", "track_id", trackID, "version_id", outcome.Item.VersionID, "option", fmt.Sprintf("%+v", outcome.Item.CompressionOption), "error", outcome.Err)
+			failed = append(failed, fmt.Errorf("%s %dkbps: %w", outcome.Item.Format, outcome.Item.Bitrate, outcome.Err))
+		} else {
+			completed = append(completed, outcome.Version)
+		}
+	}
+
+	// Failures are recorded even if the attempt's context has expired, so no
+	// version is left pending
+	recordCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), historyWriteTimeout)
+	defer cancel()
+	if _, err := p.nostrTrackService.AddOrUpdateCompressionVersions(recordCtx, trackID, records); err != nil {
+		// A track purged while compressing took its versions with it
+		if cancelled && status.Code(err) == codes.NotFound {
+			return nil
+		}
+		return fmt.Errorf("failed to save compression versions: %w", err)
+	}
+	if cancelled {
+		logging.FromContext(ctx).Info("compression cancelled", "track_id", trackID, "versions", len(records))
+		return nil
+	}
+
+	switch {
+	case len(completed) == 1:
+		p.notifyTrack(track, models.NotificationTypeCompressionReady, fmt.Sprintf("A %s %dkbps version of your track is ready", completed[0].Format, completed[0].Bitrate))
+	case len(completed) > 1:
+		p.notifyTrack(track, models.NotificationTypeCompressionReady, fmt.Sprintf("%d new versions of your track are ready", len(completed)))
+	}
+
+	logging.FromContext(ctx).Info("created compression versions", "track_id", trackID, "completed", len(completed), "failed", len(records)-len(completed))
+	return errors.Join(failed...)
+}
+
+// compressVersions encodes reserved versions of a track, at most
+// compressionWorkers at a time and each within processingTimeout, returning
+// their outcomes in the order of items
+func (p *ProcessingService) compressVersions(ctx context.Context, track *models.NostrTrack, items []models.CompressionRequestItem) []compressionOutcome {
+	outcomes := make([]compressionOutcome, len(items))
+	slots := make(chan struct{}, p.compressionWorkers)
+	var wg sync.WaitGroup
+	for i, item := range items {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			encodeCtx, cancel := context.WithTimeout(ctx, p.processingTimeout)
+			defer cancel()
+			version, err := p.compressRecovered(encodeCtx, track, item)
+			outcomes[i] = compressionOutcome{Item: item, Version: version, Err: err}
+		}()
+	}
+	wg.Wait()
+	return outcomes
+}
+
+// compressRecovered is p.compress with a panic failing only its version
+func (p *ProcessingService) compressRecovered(ctx context.Context, track *models.NostrTrack, item models.CompressionRequestItem) (_ *models.CompressionVersion, err error) {
+	defer recovery.Catch(ctx, p.panicAlerter, "compression", &err, "track_id", track.ID, "version_id", item.VersionID)
+	return p.compress(ctx, track, item.VersionID, item.CompressionOption)
+}
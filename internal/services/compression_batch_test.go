@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/recovery"
+)
+
+// boundedEncoder records how many encodes run at once, failing the versions
+// in fail
+type boundedEncoder struct {
+	mu      sync.Mutex
+	running int
+	peak    int
+	fail    map[string]bool
+}
+
+func (e *boundedEncoder) compress(ctx context.Context, track *models.NostrTrack, versionID string, option models.CompressionOption) (*models.CompressionVersion, error) {
+	e.mu.Lock()
+	e.running++
+	e.peak = max(e.peak, e.running)
+	e.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	e.mu.Lock()
+	e.running--
+	e.mu.Unlock()
+
+	if e.fail[versionID] {
+		return nil, errors.New("compression failed: ffmpeg exited")
+	}
+	return &models.CompressionVersion{ID: versionID, Format: option.Format, Bitrate: option.Bitrate, Hash: "hash-" + versionID, Status: models.VersionStatusCompleted}, nil
+}
+
+func TestCompressVersionsBoundsConcurrencyAndKeepsPartialSuccess(t *testing.T) {
+	for _, workers := range []int{0, 3} {
+		t.Run(fmt.Sprintf("workers %d", workers), func(t *testing.T) {
+			encoder := &boundedEncoder{fail: map[string]bool{"v2": true}}
+			p := NewProcessingService(nil, nil, nil, nil, t.TempDir(), WithCompressionWorkers(workers))
+			p.compress = encoder.compress
+
+			var items []models.CompressionRequestItem
+			for i := range 7 {
+				items = append(items, models.CompressionRequestItem{
+					CompressionOption: models.CompressionOption{Format: "mp3", Bitrate: 64 + 32*i},
+					VersionID:         fmt.Sprintf("v%d", i),
+				})
+			}
+
+			outcomes := p.compressVersions(context.Background(), &models.NostrTrack{ID: "abc"}, items)
+
+			// Zero keeps the default
+			want := DefaultCompressionWorkers
+			if workers > 0 {
+				want = workers
+			}
+			assert.Equal(t, want, encoder.peak)
+
+			require.Len(t, outcomes, len(items))
+			for i, outcome := range outcomes {
+				assert.Equal(t, items[i], outcome.Item)
+				record := outcome.record()
+				assert.Equal(t, items[i].VersionID, record.ID)
+				if items[i].VersionID == "v2" {
+					assert.Nil(t, outcome.Version)
+					assert.Equal(t, models.VersionStatusFailed, record.Status)
+					assert.Equal(t, "compression failed: ffmpeg exited", record.Error)
+					continue
+				}
+				require.NoError(t, outcome.Err)
+				assert.Equal(t, models.VersionStatusCompleted, record.Status)
+				assert.Equal(t, items[i].Bitrate, record.Bitrate)
+				assert.Equal(t, "hash-"+items[i].VersionID, record.Hash)
+			}
+		})
+	}
+}
+
+// recordingAlerter collects the panics it's told of
+type recordingAlerter chan recovery.Report
+
+func (a recordingAlerter) Alert(ctx context.Context, report recovery.Report) error {
+	a <- report
+	return nil
+}
+
+func TestCompressVersionsRecoversPanickingEncode(t *testing.T) {
+	alerts := make(recordingAlerter, 1)
+	p := NewProcessingService(nil, nil, nil, nil, t.TempDir(), WithPanicAlerter(alerts))
+	encoder := &boundedEncoder{}
+	p.compress = func(ctx context.Context, track *models.NostrTrack, versionID string, option models.CompressionOption) (*models.CompressionVersion, error) {
+		if versionID == "v1" {
+			var version *models.CompressionVersion
+			return nil, errors.New(version.ID)
+		}
+		return encoder.compress(ctx, track, versionID, option)
+	}
+
+	items := []models.CompressionRequestItem{
+		{VersionID: "v0", CompressionOption: models.CompressionOption{Format: "mp3", Bitrate: 128}},
+		{VersionID: "v1", CompressionOption: models.CompressionOption{Format: "mp3", Bitrate: 256}},
+	}
+	outcomes := p.compressVersions(context.Background(), &models.NostrTrack{ID: "abc"}, items)
+
+	require.Len(t, outcomes, 2)
+	require.NoError(t, outcomes[0].Err)
+	assert.ErrorIs(t, outcomes[1].Err, recovery.ErrPanic)
+	assert.Equal(t, models.VersionStatusFailed, outcomes[1].record().Status)
+
+	select {
+	case report := <-alerts:
+		assert.Equal(t, "compression", report.Source)
+		assert.Equal(t, []any{"track_id", "abc", "version_id", "v1"}, report.Fields)
+	case <-time.After(time.Second):
+		t.Fatal("panic wasn't alerted")
+	}
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/models"
+)
+
+// DefaultMaxCompressionVersions is how many versions a track may have unless
+// configured otherwise
+const DefaultMaxCompressionVersions = 10
+
+// ErrTooManyCompressionVersions is returned when a compression request would
+// take a track past its version limit
+var ErrTooManyCompressionVersions = apierror.New(http.StatusBadRequest, "track.too_many_compression_versions", "too many compression versions")
+
+// WithMaxCompressionVersions sets how many versions a track may have. Failed
+// versions don't count.
+func WithMaxCompressionVersions(max int) NostrTrackOption {
+	return func(s *NostrTrackService) {
+		if max > 0 {
+			s.maxVersions = max
+		}
+	}
+}
+
+// ReserveCompressionVersions records a pending version for each requested
+// option the track doesn't already have, in one transaction so concurrent
+// requests can't queue the same option twice. Options matching a completed
+// version are reported as existing, and ones matching a pending or processing
+// version created after staleBefore as duplicates. A failed version, or one
+// left pending since before staleBefore, is queued again under its own ID.
+// Nothing is reserved if the request would exceed the track's version limit.
+func (s *NostrTrackService) ReserveCompressionVersions(ctx context.Context, trackID string, options []models.CompressionOption, staleBefore time.Time) (*models.CompressionRequestResult, error) {
+	trackRef := s.firestoreClient.Collection("nostr_tracks").Doc(trackID)
+
+	var result *models.CompressionRequestResult
+	err := s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		track, err := getTrackTx(tx, trackRef)
+		if err != nil {
+			return err
+		}
+		versions, err := trackVersionsTx(tx, trackRef, track)
+		if err != nil {
+			return err
+		}
+
+		result, err = planCompressionRequest(versions, options, staleBefore, s.maxVersions)
+		if err != nil || len(result.Queued) == 0 {
+			return err
+		}
+
+		now := time.Now()
+		reserved := make([]models.CompressionVersion, 0, len(result.Queued))
+		for _, item := range result.Queued {
+			reserved = append(reserved, models.CompressionVersion{
+				ID:         item.VersionID,
+				Bitrate:    item.Bitrate,
+				Format:     item.Format,
+				Quality:    item.Quality,
+				SampleRate: item.SampleRate,
+				Status:     models.VersionStatusPending,
+				CreatedAt:  now,
+				Options:    item.CompressionOption,
+			})
+		}
+
+		trackUpdates := []firestore.Update{
+			{Path: "has_pending_compression", Value: true},
+			{Path: "updated_at", Value: now},
+		}
+		if track.VersionsMigrated {
+			for _, version := range reserved {
+				if err := tx.Set(trackRef.Collection(trackVersionsCollection).Doc(version.ID), version); err != nil {
+					return fmt.Errorf("failed to save track version: %w", err)
+				}
+			}
+		} else {
+			// Migrate with the reserved versions in place, so each is written once
+			track.CompressionVersions = replaceVersions(track.CompressionVersions, reserved)
+			migration, err := migrateVersionsTx(tx, trackRef, track)
+			if err != nil {
+				return err
+			}
+			trackUpdates = append(trackUpdates, migration...)
+		}
+
+		if err := tx.Update(trackRef, trackUpdates); err != nil {
+			return fmt.Errorf("failed to update track: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		if isPreconditionConflict(err) {
+			return nil, ErrTrackUpdateConflict
+		}
+		return nil, err
+	}
+
+	log.Printf("Compression request for track %s: %d queued, %d duplicate, %d existing", trackID, len(result.Queued), len(result.Duplicates), len(result.Existing))
+	return result, nil
+}
+
+// planCompressionRequest matches each requested option against the track's
+// versions, assigning queued options a version ID. Versions are matched on
+// the options they were requested with, as for bulk requests.
+func planCompressionRequest(versions []models.CompressionVersion, options []models.CompressionOption, staleBefore time.Time, maxVersions int) (*models.CompressionRequestResult, error) {
+	result := &models.CompressionRequestResult{
+		Queued:     []models.CompressionRequestItem{},
+		Duplicates: []models.CompressionRequestItem{},
+		Existing:   []models.CompressionRequestItem{},
+	}
+
+	active := 0
+	for _, version := range versions {
+		if !retryableVersion(version, staleBefore) {
+			active++
+		}
+	}
+
+	var planned []models.CompressionRequestItem
+	for _, option := range options {
+		item := models.CompressionRequestItem{CompressionOption: option}
+
+		if earlier, ok := findOption(planned, option); ok {
+			item.VersionID = earlier.VersionID
+			result.Duplicates = append(result.Duplicates, item)
+			continue
+		}
+
+		version, ok := matchingVersion(versions, option, staleBefore)
+		switch {
+		case !ok:
+			item.VersionID = uuid.New().String()
+			active++
+			result.Queued = append(result.Queued, item)
+		case retryableVersion(version, staleBefore):
+			item.VersionID = version.ID
+			active++
+			result.Queued = append(result.Queued, item)
+		case version.IsTerminal():
+			item.VersionID = version.ID
+			result.Existing = append(result.Existing, item)
+		default:
+			item.VersionID = version.ID
+			result.Duplicates = append(result.Duplicates, item)
+		}
+		planned = append(planned, item)
+	}
+
+	if len(result.Queued) > 0 && active > maxVersions {
+		return nil, ErrTooManyCompressionVersions.WithMessage(fmt.Sprintf("%s: a track can have at most %d versions and this request would make %d", ErrTooManyCompressionVersions.Message, maxVersions, active))
+	}
+	return result, nil
+}
+
+// retryableVersion reports whether a version failed, or was left pending or
+// processing since before staleBefore by a run that never finished
+func retryableVersion(version models.CompressionVersion, staleBefore time.Time) bool {
+	if version.Status == models.VersionStatusFailed {
+		return true
+	}
+	return !version.IsTerminal() && version.CreatedAt.Before(staleBefore)
+}
+
+// matchingVersion finds the version made from an option equivalent to the
+// given one, preferring a version that doesn't need retrying
+func matchingVersion(versions []models.CompressionVersion, option models.CompressionOption, staleBefore time.Time) (models.CompressionVersion, bool) {
+	var retryable *models.CompressionVersion
+	for i, version := range versions {
+		if !sameCompressionOption(version.Options, option) {
+			continue
+		}
+		if !retryableVersion(version, staleBefore) {
+			return version, true
+		}
+		if retryable == nil {
+			retryable = &versions[i]
+		}
+	}
+	if retryable != nil {
+		return *retryable, true
+	}
+	return models.CompressionVersion{}, false
+}
+
+// findOption finds an already planned item equivalent to option
+func findOption(items []models.CompressionRequestItem, option models.CompressionOption) (models.CompressionRequestItem, bool) {
+	for _, item := range items {
+		if sameCompressionOption(item.CompressionOption, option) {
+			return item, true
+		}
+	}
+	return models.CompressionRequestItem{}, false
+}
+
+// replaceVersions returns versions with each of updates replacing the version
+// with its ID, or appended if there is none
+func replaceVersions(versions, updates []models.CompressionVersion) []models.CompressionVersion {
+	merged := append([]models.CompressionVersion{}, versions...)
+	for _, update := range updates {
+		replaced := false
+		for i := range merged {
+			if merged[i].ID == update.ID {
+				merged[i] = update
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, update)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/models"
+)
+
+func itemVersionIDs(items []models.CompressionRequestItem) []string {
+	ids := []string{}
+	for _, item := range items {
+		ids = append(ids, item.VersionID)
+	}
+	return ids
+}
+
+func TestPlanCompressionRequest(t *testing.T) {
+	now := time.Now()
+	staleBefore := now.Add(-10 * time.Minute)
+	high := CompressionPresets["high"]
+	ogg := CompressionPresets["ogg-standard"]
+	aac := CompressionPresets["aac-high"]
+	versions := []models.CompressionVersion{
+		{ID: "default", Options: CompressionPresets["streaming-standard"], CreatedAt: now},
+		{ID: "high", Options: high, Status: models.VersionStatusPending, CreatedAt: now},
+		{ID: "ogg", Options: ogg, Status: models.VersionStatusFailed, CreatedAt: now},
+	}
+
+	result, err := planCompressionRequest(versions, []models.CompressionOption{
+		{Format: "mp3", Bitrate: 128, Quality: "medium"}, // Matches the default version
+		high,
+		ogg,
+		aac,
+		aac,
+	}, staleBefore, 10)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"default"}, itemVersionIDs(result.Existing))
+	require.Len(t, result.Queued, 2)
+	assert.Equal(t, "ogg", result.Queued[0].VersionID, "a failed version is retried in place")
+	assert.Equal(t, aac, result.Queued[1].CompressionOption)
+	assert.NotEmpty(t, result.Queued[1].VersionID)
+	assert.Equal(t, []string{"high", result.Queued[1].VersionID}, itemVersionIDs(result.Duplicates))
+}
+
+func TestPlanCompressionRequestRetriesAbandonedVersions(t *testing.T) {
+	now := time.Now()
+	high := CompressionPresets["high"]
+	versions := []models.CompressionVersion{
+		{ID: "stuck", Options: high, Status: models.VersionStatusProcessing, CreatedAt: now.Add(-time.Hour)},
+	}
+
+	result, err := planCompressionRequest(versions, []models.CompressionOption{high}, now.Add(-10*time.Minute), 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"stuck"}, itemVersionIDs(result.Queued))
+
+	result, err = planCompressionRequest(versions, []models.CompressionOption{high}, now.Add(-2*time.Hour), 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"stuck"}, itemVersionIDs(result.Duplicates))
+}
+
+func TestPlanCompressionRequestEnforcesVersionLimit(t *testing.T) {
+	now := time.Now()
+	var versions []models.CompressionVersion
+	for i := 0; i < 3; i++ {
+		versions = append(versions, models.CompressionVersion{
+			ID: fmt.Sprintf("v%d", i), Options: models.CompressionOption{Format: "mp3", Bitrate: 64 * (i + 1)}, CreatedAt: now,
+		})
+	}
+	versions = append(versions, models.CompressionVersion{ID: "failed", Options: CompressionPresets["ogg-standard"], Status: models.VersionStatusFailed})
+
+	// Failed versions don't count, and retrying one takes its place
+	result, err := planCompressionRequest(versions, []models.CompressionOption{CompressionPresets["ogg-standard"]}, now, 4)
+	require.NoError(t, err)
+	assert.Len(t, result.Queued, 1)
+
+	_, err = planCompressionRequest(versions, []models.CompressionOption{CompressionPresets["ogg-standard"], CompressionPresets["aac-high"]}, now, 4)
+	assert.True(t, errors.Is(err, ErrTooManyCompressionVersions))
+
+	// A request queuing nothing is never over the limit
+	result, err = planCompressionRequest(versions, []models.CompressionOption{versions[0].Options}, now, 2)
+	require.NoError(t, err)
+	assert.Len(t, result.Existing, 1)
+}
+
+func TestReplaceVersions(t *testing.T) {
+	versions := []models.CompressionVersion{{ID: "a", Format: "mp3"}, {ID: "b", Format: "ogg", Status: models.VersionStatusFailed}}
+
+	merged := replaceVersions(versions, []models.CompressionVersion{
+		{ID: "b", Format: "ogg", Status: models.VersionStatusPending},
+		{ID: "c", Format: "aac", Status: models.VersionStatusPending},
+	})
+
+	require.Len(t, merged, 3)
+	assert.Equal(t, models.VersionStatusPending, merged[1].Status)
+	assert.Equal(t, "c", merged[2].ID)
+	assert.Equal(t, models.VersionStatusFailed, versions[1].Status, "the input is left unchanged")
+}
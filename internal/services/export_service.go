@@ -0,0 +1,350 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/storage"
+	"github.com/google/uuid"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/utils"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	exportJobsCollection = "export_jobs"
+
+	// exportPrefix holds archives for async exports in the primary region. The bucket should carry a
+	// lifecycle rule that deletes objects under it after a few days.
+	exportPrefix = "exports"
+
+	// DefaultExportSyncTrackLimit is the largest account exported inline; bigger
+	// accounts get an async job
+	DefaultExportSyncTrackLimit = 200
+
+	// exportArchiveRetention is how long a finished async archive can be downloaded
+	exportArchiveRetention = 72 * time.Hour
+
+	// exportDownloadURLExpiration bounds signed URLs for originals in the
+	// manifest. They last as long as the archive carrying them.
+	exportDownloadURLExpiration = exportArchiveRetention
+
+	// exportJobTimeout bounds building one async archive. A job pending or
+	// running for longer was abandoned, such as by an instance that stopped.
+	exportJobTimeout = 30 * time.Minute
+)
+
+// ErrExportJobNotFound is returned when a job doesn't exist or belongs to another user
+var ErrExportJobNotFound = errors.New("export job not found")
+
+// ExportManifestTrack is a single track entry in manifest.json
+type ExportManifestTrack struct {
+	*models.NostrTrack
+	OriginalObject      string `json:"original_object"`
+	OriginalDownloadURL string `json:"original_download_url,omitempty"`
+	OriginalMD5         string `json:"original_md5,omitempty"`
+	OriginalCRC32C      uint32 `json:"original_crc32c,omitempty"`
+}
+
+type ExportService struct {
+	firestoreClient   *firestore.Client
+	nostrTrackService *NostrTrackService
+	storageService    StorageServiceInterface
+	pathConfig        *utils.StoragePathConfig
+	syncTrackLimit    int
+}
+
+func NewExportService(firestoreClient *firestore.Client, nostrTrackService *NostrTrackService, storageService StorageServiceInterface) *ExportService {
+	return &ExportService{
+		firestoreClient:   firestoreClient,
+		nostrTrackService: nostrTrackService,
+		storageService:    storageService,
+		pathConfig:        utils.GetStoragePathConfig(),
+		syncTrackLimit:    DefaultExportSyncTrackLimit,
+	}
+}
+
+// CountTracks returns how many tracks an export for the user would contain
+func (s *ExportService) CountTracks(ctx context.Context, firebaseUID string) (int, error) {
+	query := s.firestoreClient.Collection("nostr_tracks").
+		Where("firebase_uid", "==", firebaseUID).
+		Where("deleted", "==", false)
+
+	results, err := query.NewAggregationQuery().WithCount("count").Get(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count tracks: %w", err)
+	}
+
+	count, err := aggregationInt(results, "count")
+	if err != nil {
+		return 0, err
+	}
+	return int(count), nil
+}
+
+// RequiresAsyncExport reports whether an export of trackCount tracks should run as a job
+func (s *ExportService) RequiresAsyncExport(trackCount int) bool {
+	return trackCount > s.syncTrackLimit
+}
+
+// WriteExport streams a zip archive with the user's manifest to w. Tracks are
+// read and encoded one at a time so memory use doesn't grow with account size.
+func (s *ExportService) WriteExport(ctx context.Context, firebaseUID string, w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	manifest, err := zw.Create("manifest.json")
+	if err != nil {
+		return fmt.Errorf("failed to create manifest entry: %w", err)
+	}
+
+	header, err := json.Marshal(map[string]interface{}{
+		"exported_at":  time.Now().UTC(),
+		"firebase_uid": firebaseUID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest header: %w", err)
+	}
+
+	// Splice the tracks array into the header object as the tracks stream in
+	if _, err := manifest.Write(header[:len(header)-1]); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(manifest, `,"tracks":[`); err != nil {
+		return err
+	}
+
+	iter := s.nostrTrackService.tracksByFirebaseUIDQuery(firebaseUID).Documents(ctx)
+	defer iter.Stop()
+
+	count := 0
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to iterate tracks: %w", wrapIndexError(err, IndexTracksByFirebaseUID))
+		}
+
+		var track models.NostrTrack
+		if err := doc.DataTo(&track); err != nil {
+			log.Printf("Failed to decode track %s for export: %v", doc.Ref.ID, err)
+			continue
+		}
+		if err := s.nostrTrackService.loadVersions(ctx, &track); err != nil {
+			return err
+		}
+
+		entry, err := json.Marshal(s.manifestTrack(ctx, &track))
+		if err != nil {
+			return fmt.Errorf("failed to encode track %s: %w", track.ID, err)
+		}
+
+		if count > 0 {
+			if _, err := io.WriteString(manifest, ","); err != nil {
+				return err
+			}
+		}
+		if _, err := manifest.Write(entry); err != nil {
+			return err
+		}
+		count++
+	}
+
+	if _, err := io.WriteString(manifest, "]}"); err != nil {
+		return err
+	}
+
+	readme, err := zw.Create("README.txt")
+	if err != nil {
+		return fmt.Errorf("failed to create readme entry: %w", err)
+	}
+	fmt.Fprintf(readme, "Wavlake track export\n\n"+
+		"manifest.json lists %d tracks with their metadata and compression versions.\n"+
+		"original_download_url links expire %s after the export was generated.\n", count, exportDownloadURLExpiration)
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to finalize archive: %w", err)
+	}
+
+	return nil
+}
+
+// manifestTrack decorates a track with a signed download URL and checksums for
+// its original. Storage failures are logged and leave the fields empty.
+func (s *ExportService) manifestTrack(ctx context.Context, track *models.NostrTrack) ExportManifestTrack {
+	objectName := s.pathConfig.GetOriginalPath(track.ID, track.Extension)
+	entry := ExportManifestTrack{
+		NostrTrack:     track,
+		OriginalObject: objectName,
+	}
+
+	storageService := s.nostrTrackService.StorageFor(track)
+	if url, err := storageService.GenerateDownloadURL(ctx, objectName, exportDownloadURLExpiration); err == nil {
+		entry.OriginalDownloadURL = url
+	} else {
+		log.Printf("Failed to sign export download URL for track %s: %v", track.ID, err)
+	}
+
+	if metadata, err := storageService.GetObjectMetadata(ctx, objectName); err == nil {
+		if attrs, ok := metadata.(*storage.ObjectAttrs); ok {
+			entry.OriginalMD5 = fmt.Sprintf("%x", attrs.MD5)
+			entry.OriginalCRC32C = attrs.CRC32C
+		}
+	}
+
+	return entry
+}
+
+// StartExportJob records a pending export job and builds the archive in the
+// background. A job of the user's that is still pending or running is
+// returned instead of starting another.
+func (s *ExportService) StartExportJob(ctx context.Context, firebaseUID string, trackCount int) (*models.ExportJob, error) {
+	active, err := s.activeExportJob(ctx, firebaseUID)
+	if err != nil {
+		return nil, err
+	}
+	if active != nil {
+		return active, nil
+	}
+
+	jobID := uuid.New().String()
+	job := &models.ExportJob{
+		ID:          jobID,
+		FirebaseUID: firebaseUID,
+		Status:      models.ExportJobStatusPending,
+		TrackCount:  trackCount,
+		ObjectName:  fmt.Sprintf("%s/%s/%s.zip", exportPrefix, firebaseUID, jobID),
+		CreatedAt:   time.Now(),
+	}
+
+	if _, err := s.firestoreClient.Collection(exportJobsCollection).Doc(jobID).Set(ctx, job); err != nil {
+		return nil, fmt.Errorf("failed to save export job: %w", err)
+	}
+
+	go s.runExportJob(job)
+
+	return job, nil
+}
+
+// activeExportJob returns the user's newest pending or running export job
+// started within exportJobTimeout, or nil if there isn't one
+func (s *ExportService) activeExportJob(ctx context.Context, firebaseUID string) (*models.ExportJob, error) {
+	docs, err := s.firestoreClient.Collection(exportJobsCollection).
+		Where("firebase_uid", "==", firebaseUID).
+		Where("status", "in", []string{models.ExportJobStatusPending, models.ExportJobStatusRunning}).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list export jobs: %w", err)
+	}
+
+	var active *models.ExportJob
+	for _, doc := range docs {
+		var job models.ExportJob
+		if err := doc.DataTo(&job); err != nil {
+			return nil, fmt.Errorf("failed to decode export job: %w", err)
+		}
+		if time.Since(job.CreatedAt) >= exportJobTimeout {
+			continue
+		}
+		if active == nil || job.CreatedAt.After(active.CreatedAt) {
+			active = &job
+		}
+	}
+	return active, nil
+}
+
+// runExportJob streams the archive straight into storage through a pipe
+func (s *ExportService) runExportJob(job *models.ExportJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), exportJobTimeout)
+	defer cancel()
+
+	ref := s.firestoreClient.Collection(exportJobsCollection).Doc(job.ID)
+	if _, err := ref.Update(ctx, []firestore.Update{{Path: "status", Value: models.ExportJobStatusRunning}}); err != nil {
+		log.Printf("Failed to mark export job %s running: %v", job.ID, err)
+	}
+
+	// The manifest's links are signed as the archive is written, so the
+	// archive expires no later than the first of them
+	startedAt := time.Now()
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(s.WriteExport(ctx, job.FirebaseUID, pw))
+	}()
+
+	err := s.storageService.UploadObject(ctx, job.ObjectName, pr, "application/zip")
+	pr.CloseWithError(err)
+
+	now := time.Now()
+	if err != nil {
+		log.Printf("Export job %s failed: %v", job.ID, err)
+		if _, updateErr := ref.Update(ctx, []firestore.Update{
+			{Path: "status", Value: models.ExportJobStatusFailed},
+			{Path: "error", Value: "failed to build export archive"},
+			{Path: "completed_at", Value: now},
+		}); updateErr != nil {
+			log.Printf("Failed to mark export job %s failed: %v", job.ID, updateErr)
+		}
+		return
+	}
+
+	expiresAt := startedAt.Add(exportArchiveRetention)
+	if _, err := ref.Update(ctx, []firestore.Update{
+		{Path: "status", Value: models.ExportJobStatusCompleted},
+		{Path: "completed_at", Value: now},
+		{Path: "expires_at", Value: expiresAt},
+	}); err != nil {
+		log.Printf("Failed to mark export job %s completed: %v", job.ID, err)
+		return
+	}
+
+	log.Printf("Export job %s completed for user %s (%d tracks)", job.ID, job.FirebaseUID, job.TrackCount)
+}
+
+// GetExportJob returns a user's export job. Completed jobs that are still
+// within their retention window carry a freshly signed download URL.
+func (s *ExportService) GetExportJob(ctx context.Context, firebaseUID, jobID string) (*models.ExportJob, error) {
+	doc, err := s.firestoreClient.Collection(exportJobsCollection).Doc(jobID).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, ErrExportJobNotFound
+		}
+		return nil, fmt.Errorf("failed to get export job: %w", err)
+	}
+
+	var job models.ExportJob
+	if err := doc.DataTo(&job); err != nil {
+		return nil, fmt.Errorf("failed to decode export job: %w", err)
+	}
+	if job.FirebaseUID != firebaseUID {
+		return nil, ErrExportJobNotFound
+	}
+
+	if job.Status == models.ExportJobStatusCompleted && job.ExpiresAt != nil {
+		remaining := time.Until(*job.ExpiresAt)
+		if remaining <= 0 {
+			job.Error = "export has expired, request a new one"
+			return &job, nil
+		}
+		if remaining > time.Hour {
+			remaining = time.Hour
+		}
+
+		url, err := s.storageService.GenerateDownloadURL(ctx, job.ObjectName, remaining)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign export download URL: %w", err)
+		}
+		job.DownloadURL = url
+	}
+
+	return &job, nil
+}
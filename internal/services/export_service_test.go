@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+	"github.com/wavlake/api/internal/models"
+)
+
+// ExportEmulatorTestSuite exercises export jobs against the Firestore
+// emulator. Run with FIRESTORE_EMULATOR_HOST set, as for
+// NostrTrackEmulatorTestSuite.
+type ExportEmulatorTestSuite struct {
+	suite.Suite
+	ctx     context.Context
+	client  *firestore.Client
+	service *ExportService
+	uid     string
+}
+
+func (suite *ExportEmulatorTestSuite) SetupSuite() {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		suite.T().Skip("FIRESTORE_EMULATOR_HOST not set, skipping emulator tests")
+	}
+
+	suite.ctx = context.Background()
+	client, err := firestore.NewClient(suite.ctx, "wavlake-test")
+	suite.Require().NoError(err)
+	suite.client = client
+}
+
+func (suite *ExportEmulatorTestSuite) TearDownSuite() {
+	if suite.client != nil {
+		suite.client.Close()
+	}
+}
+
+func (suite *ExportEmulatorTestSuite) SetupTest() {
+	suite.uid = uuid.New().String()
+	suite.service = NewExportService(suite.client, nil, nil)
+}
+
+// seedJob stores an export job for the user created age ago
+func (suite *ExportEmulatorTestSuite) seedJob(status string, age time.Duration) string {
+	jobID := uuid.New().String()
+	_, err := suite.client.Collection(exportJobsCollection).Doc(jobID).Set(suite.ctx, models.ExportJob{
+		ID:          jobID,
+		FirebaseUID: suite.uid,
+		Status:      status,
+		CreatedAt:   time.Now().Add(-age),
+	})
+	suite.Require().NoError(err)
+	return jobID
+}
+
+func (suite *ExportEmulatorTestSuite) TestStartExportJobReusesActiveJob() {
+	suite.seedJob(models.ExportJobStatusCompleted, time.Minute)
+	// Left running by an instance that stopped
+	suite.seedJob(models.ExportJobStatusRunning, 2*exportJobTimeout)
+
+	active, err := suite.service.activeExportJob(suite.ctx, suite.uid)
+	suite.Require().NoError(err)
+	suite.Nil(active, "finished and abandoned jobs don't block a new export")
+
+	running := suite.seedJob(models.ExportJobStatusRunning, time.Minute)
+	job, err := suite.service.StartExportJob(suite.ctx, suite.uid, 500)
+	suite.Require().NoError(err)
+	suite.Equal(running, job.ID)
+}
+
+func TestExportEmulatorTestSuite(t *testing.T) {
+	suite.Run(t, new(ExportEmulatorTestSuite))
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/wavlake/api/internal/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	emailNotificationsCollection = "email_notifications"
+
+	// failureEmailInterval limits processing failure emails to one per track per day
+	failureEmailInterval = 24 * time.Hour
+)
+
+var failureEmailTemplate = template.Must(template.New("processing_failed").Parse(`Hi,
+
+We weren't able to process one of the tracks you uploaded to Wavlake.
+
+Track ID: {{.TrackID}}
+Problem:  {{.ErrorClass}}
+
+{{.Advice}}
+
+You can check the track status or retry processing from the Wavlake app.
+
+To stop receiving these emails, turn off processing emails in your account settings.
+`))
+
+// FailureEmailNotifier emails track owners when processing fails terminally
+type FailureEmailNotifier struct {
+	firestoreClient *firestore.Client
+	userService     UserServiceInterface
+	mailer          Mailer
+}
+
+func NewFailureEmailNotifier(firestoreClient *firestore.Client, userService UserServiceInterface, mailer Mailer) *FailureEmailNotifier {
+	return &FailureEmailNotifier{
+		firestoreClient: firestoreClient,
+		userService:     userService,
+		mailer:          mailer,
+	}
+}
+
+// NotifyProcessingFailed sends the failure email in the background. errorCode
+// is the failure's ProcessingError class, or empty if it isn't known. It never
+// blocks or fails processing; problems are only logged.
+func (n *FailureEmailNotifier) NotifyProcessingFailed(firebaseUID, trackID, errorCode string) {
+	if n == nil || n.mailer == nil || firebaseUID == "" {
+		return
+	}
+	if _, ok := n.mailer.(NoopMailer); ok {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		if err := n.sendProcessingFailed(ctx, firebaseUID, trackID, errorCode); err != nil {
+			log.Printf("Failed to send processing failure email for track %s: %v", trackID, err)
+		}
+	}()
+}
+
+func (n *FailureEmailNotifier) sendProcessingFailed(ctx context.Context, firebaseUID, trackID, errorCode string) error {
+	optedOut, err := n.hasOptedOut(ctx, firebaseUID)
+	if err != nil {
+		return err
+	}
+	if optedOut {
+		return nil
+	}
+
+	email, err := n.userService.GetUserEmail(ctx, firebaseUID)
+	if err != nil {
+		return fmt.Errorf("failed to look up owner email: %w", err)
+	}
+	if email == "" {
+		return nil
+	}
+
+	allowed, err := n.claimSendSlot(ctx, trackID)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		log.Printf("Skipping processing failure email for track %s: already sent in the last %s", trackID, failureEmailInterval)
+		return nil
+	}
+
+	body, err := renderFailureEmail(trackID, errorCode)
+	if err != nil {
+		return err
+	}
+
+	return n.mailer.Send(ctx, EmailMessage{
+		To:      email,
+		Subject: "We couldn't process your Wavlake track",
+		Body:    body,
+	})
+}
+
+// hasOptedOut reports whether the user disabled processing emails on their User document
+func (n *FailureEmailNotifier) hasOptedOut(ctx context.Context, firebaseUID string) (bool, error) {
+	doc, err := n.firestoreClient.Collection("users").Doc(firebaseUID).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	optOut, err := doc.DataAt("email_notifications_opt_out")
+	if err != nil {
+		return false, nil
+	}
+	value, ok := optOut.(bool)
+	return ok && value, nil
+}
+
+// claimSendSlot records a send for the track unless one happened within the
+// rate-limit interval. The slot is claimed before sending so concurrent
+// failures for the same track produce at most one email.
+func (n *FailureEmailNotifier) claimSendSlot(ctx context.Context, trackID string) (bool, error) {
+	ref := n.firestoreClient.Collection(emailNotificationsCollection).Doc(trackID + ":processing_failed")
+	now := time.Now()
+
+	allowed := false
+	err := n.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		allowed = false
+
+		doc, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return fmt.Errorf("failed to read email rate limit: %w", err)
+		}
+		if err == nil {
+			if last, err := doc.DataAt("last_sent_at"); err == nil {
+				if lastAt, ok := last.(time.Time); ok && now.Sub(lastAt) < failureEmailInterval {
+					return nil
+				}
+			}
+		}
+
+		allowed = true
+		return tx.Set(ref, map[string]interface{}{
+			"track_id":     trackID,
+			"last_sent_at": now,
+		})
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return allowed, nil
+}
+
+// renderFailureEmail renders the failure email body for a track
+func renderFailureEmail(trackID, errorCode string) (string, error) {
+	errorClass, advice := classifyProcessingError(errorCode)
+
+	var body strings.Builder
+	err := failureEmailTemplate.Execute(&body, struct {
+		TrackID    string
+		ErrorClass string
+		Advice     string
+	}{
+		TrackID:    trackID,
+		ErrorClass: errorClass,
+		Advice:     advice,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to render email: %w", err)
+	}
+
+	return body.String(), nil
+}
+
+// classifyProcessingError maps a ProcessingError class to a user-facing
+// description and advice. Raw error details are deliberately not included.
+func classifyProcessingError(errorCode string) (string, string) {
+	switch errorCode {
+	case models.ProcessingErrorInvalidAudio:
+		return "The uploaded file is not a valid audio file", "Please check the file plays correctly and upload it again."
+	case models.ProcessingErrorFormat:
+		return "The file's contents don't match its format", "Export the file again in a supported format, keeping its usual extension, and upload it again."
+	case models.ProcessingErrorTooLarge:
+		return "The uploaded file is over the size limit", "Retrying won't help. Please upload a smaller file, for example one exported at a lower bitrate."
+	case models.ProcessingErrorTooLong:
+		return "The track is over the length limit", "Retrying won't help. Please upload a shorter track."
+	case models.ProcessingErrorDownload:
+		return "The uploaded file could not be found", "The upload may not have completed. Please try uploading again."
+	case models.ProcessingErrorCompression:
+		return "The audio could not be converted for streaming", "Try exporting the file again from your audio software and re-uploading."
+	case models.ProcessingErrorDiskSpace, models.ProcessingErrorUpload:
+		return "We couldn't store the processed audio", "This is a problem on our side. Retrying usually fixes it; if it keeps happening, contact support with the track ID."
+	default:
+		return "An internal processing error occurred", "Retrying usually fixes this. If it keeps happening, contact support with the track ID."
+	}
+}
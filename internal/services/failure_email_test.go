@@ -0,0 +1,54 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wavlake/api/internal/models"
+)
+
+func TestClassifyProcessingError(t *testing.T) {
+	tests := []struct {
+		errorCode string
+		expected  string
+	}{
+		{models.ProcessingErrorInvalidAudio, "The uploaded file is not a valid audio file"},
+		{models.ProcessingErrorFormat, "The file's contents don't match its format"},
+		{models.ProcessingErrorTooLarge, "The uploaded file is over the size limit"},
+		{models.ProcessingErrorTooLong, "The track is over the length limit"},
+		{models.ProcessingErrorDownload, "The uploaded file could not be found"},
+		{models.ProcessingErrorCompression, "The audio could not be converted for streaming"},
+		{models.ProcessingErrorUpload, "We couldn't store the processed audio"},
+		{models.ProcessingErrorInternal, "An internal processing error occurred"},
+		{"", "An internal processing error occurred"},
+	}
+
+	for _, tt := range tests {
+		errorClass, advice := classifyProcessingError(tt.errorCode)
+		assert.Equal(t, tt.expected, errorClass, tt.errorCode)
+		assert.NotEmpty(t, advice)
+	}
+
+	// Failures the user caused don't tell them to retry
+	for _, code := range []string{models.ProcessingErrorTooLarge, models.ProcessingErrorTooLong} {
+		_, advice := classifyProcessingError(code)
+		assert.NotContains(t, advice, "Retrying usually fixes", code)
+	}
+}
+
+func TestRenderFailureEmail(t *testing.T) {
+	body, err := renderFailureEmail("track-123", models.ProcessingErrorInvalidAudio)
+
+	assert.NoError(t, err)
+	assert.Contains(t, body, "Track ID: track-123")
+	assert.Contains(t, body, "The uploaded file is not a valid audio file")
+}
+
+func TestNotifyProcessingFailedNoop(t *testing.T) {
+	// The notifier is optional and a no-op mailer never touches Firestore
+	var nilNotifier *FailureEmailNotifier
+	nilNotifier.NotifyProcessingFailed("uid", "track-123", models.ProcessingErrorDownload)
+
+	notifier := NewFailureEmailNotifier(nil, nil, NoopMailer{})
+	notifier.NotifyProcessingFailed("uid", "track-123", models.ProcessingErrorDownload)
+}
@@ -0,0 +1,24 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// healthCheckDoc is read by CheckFirestore. It doesn't need to exist; a
+// not-found answer still proves Firestore is reachable.
+const healthCheckDoc = "_health/readyz"
+
+// CheckFirestore confirms Firestore is reachable with a single document read,
+// for readiness checks
+func CheckFirestore(ctx context.Context, client *firestore.Client) error {
+	_, err := client.Doc(healthCheckDoc).Get(ctx)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return fmt.Errorf("failed to read firestore: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Firestore index field orders
+const (
+	IndexAscending  = "ASCENDING"
+	IndexDescending = "DESCENDING"
+)
+
+// FirestoreIndexField is one field of a composite index
+type FirestoreIndexField struct {
+	Path  string `json:"fieldPath"`
+	Order string `json:"order"`
+}
+
+// FirestoreIndex describes a composite index a query depends on
+type FirestoreIndex struct {
+	Collection string                `json:"collectionGroup"`
+	Fields     []FirestoreIndexField `json:"fields"`
+}
+
+func (i FirestoreIndex) String() string {
+	fields := make([]string, len(i.Fields))
+	for n, field := range i.Fields {
+		order := "ASC"
+		if field.Order == IndexDescending {
+			order = "DESC"
+		}
+		fields[n] = field.Path + " " + order
+	}
+	return fmt.Sprintf("%s (%s)", i.Collection, strings.Join(fields, ", "))
+}
+
+// Composite indexes required by service queries. Every query that combines
+// equality filters with an ordering (or a range on the ordered field) must use one of these; RequiredIndexes is
+// checked by tests and mirrors what has to be deployed to Firestore.
+var (
+	IndexTracksByPubkey = FirestoreIndex{
+		Collection: "nostr_tracks",
+		Fields: []FirestoreIndexField{
+			{Path: "pubkey", Order: IndexAscending},
+			{Path: "deleted", Order: IndexAscending},
+			{Path: "created_at", Order: IndexDescending},
+		},
+	}
+
+	IndexAllTracksByPubkey = FirestoreIndex{
+		Collection: "nostr_tracks",
+		Fields: []FirestoreIndexField{
+			{Path: "pubkey", Order: IndexAscending},
+			{Path: "created_at", Order: IndexDescending},
+		},
+	}
+
+	IndexTracksByFirebaseUID = FirestoreIndex{
+		Collection: "nostr_tracks",
+		Fields: []FirestoreIndexField{
+			{Path: "firebase_uid", Order: IndexAscending},
+			{Path: "deleted", Order: IndexAscending},
+			{Path: "created_at", Order: IndexDescending},
+		},
+	}
+
+	IndexPublicTracksByTitle = FirestoreIndex{
+		Collection: "nostr_tracks",
+		Fields: []FirestoreIndexField{
+			{Path: "is_published", Order: IndexAscending},
+			{Path: "deleted", Order: IndexAscending},
+			{Path: "title_normalized", Order: IndexAscending},
+		},
+	}
+
+	IndexPublicTracksByArtist = FirestoreIndex{
+		Collection: "nostr_tracks",
+		Fields: []FirestoreIndexField{
+			{Path: "is_published", Order: IndexAscending},
+			{Path: "deleted", Order: IndexAscending},
+			{Path: "artist_normalized", Order: IndexAscending},
+		},
+	}
+
+	IndexNotificationsByUser = FirestoreIndex{
+		Collection: notificationsCollection,
+		Fields: []FirestoreIndexField{
+			{Path: "firebase_uid", Order: IndexAscending},
+			{Path: "created_at", Order: IndexDescending},
+		},
+	}
+
+	IndexDueProcessingJobs = FirestoreIndex{
+		Collection: processingJobsCollection,
+		Fields: []FirestoreIndexField{
+			{Path: "status", Order: IndexAscending},
+			{Path: "next_attempt_at", Order: IndexAscending},
+		},
+	}
+
+	IndexExpiredProcessingLeases = FirestoreIndex{
+		Collection: processingJobsCollection,
+		Fields: []FirestoreIndexField{
+			{Path: "status", Order: IndexAscending},
+			{Path: "lease_expires_at", Order: IndexAscending},
+		},
+	}
+
+	IndexPubkeyEventsByPubkey = FirestoreIndex{
+		Collection: nostrAuthEventsCollection,
+		Fields: []FirestoreIndexField{
+			{Path: "pubkey", Order: IndexAscending},
+			{Path: "created_at", Order: IndexDescending},
+		},
+	}
+
+	IndexPubkeyEventsByNewOwner = FirestoreIndex{
+		Collection: nostrAuthEventsCollection,
+		Fields: []FirestoreIndexField{
+			{Path: "new_firebase_uid", Order: IndexAscending},
+			{Path: "created_at", Order: IndexDescending},
+		},
+	}
+
+	IndexPubkeyEventsByOldOwner = FirestoreIndex{
+		Collection: nostrAuthEventsCollection,
+		Fields: []FirestoreIndexField{
+			{Path: "old_firebase_uid", Order: IndexAscending},
+			{Path: "created_at", Order: IndexDescending},
+		},
+	}
+
+	IndexUnreadNotificationsByUser = FirestoreIndex{
+		Collection: notificationsCollection,
+		Fields: []FirestoreIndexField{
+			{Path: "firebase_uid", Order: IndexAscending},
+			{Path: "read", Order: IndexAscending},
+			{Path: "created_at", Order: IndexDescending},
+		},
+	}
+)
+
+// RequiredIndexes lists every composite index the API needs
+var RequiredIndexes = []FirestoreIndex{
+	IndexTracksByPubkey,
+	IndexAllTracksByPubkey,
+	IndexTracksByFirebaseUID,
+	IndexPublicTracksByTitle,
+	IndexPublicTracksByArtist,
+	IndexNotificationsByUser,
+	IndexUnreadNotificationsByUser,
+	IndexDueProcessingJobs,
+	IndexExpiredProcessingLeases,
+	IndexPubkeyEventsByPubkey,
+	IndexPubkeyEventsByNewOwner,
+	IndexPubkeyEventsByOldOwner,
+}
+
+// ErrMissingIndex is matched by errors.Is for queries Firestore rejected
+// because a composite index is missing
+var ErrMissingIndex = errors.New("missing Firestore composite index")
+
+// MissingIndexError names the index a rejected query needs
+type MissingIndexError struct {
+	Index FirestoreIndex
+	Err   error
+}
+
+func (e *MissingIndexError) Error() string {
+	return fmt.Sprintf("%v %s: %v", ErrMissingIndex, e.Index, e.Err)
+}
+
+func (e *MissingIndexError) Unwrap() error {
+	return e.Err
+}
+
+func (e *MissingIndexError) Is(target error) bool {
+	return target == ErrMissingIndex
+}
+
+// wrapIndexError turns Firestore's FailedPrecondition for a query into a
+// MissingIndexError naming the index; other errors are returned unchanged
+func wrapIndexError(err error, index FirestoreIndex) error {
+	if err != nil && status.Code(err) == codes.FailedPrecondition {
+		return &MissingIndexError{Index: index, Err: err}
+	}
+	return err
+}
+
+// indexCreationURL matches the console link Firestore puts in a missing index
+// error, which creates the index when opened
+var indexCreationURL = regexp.MustCompile(`https://console\.firebase\.google\.com/\S+`)
+
+// warnedIndexes holds the indexes warnMissingIndex has logged
+var warnedIndexes sync.Map
+
+// warnMissingIndex logs, once per index, that a query fell back to running
+// without err's index
+func warnMissingIndex(err *MissingIndexError) {
+	if _, warned := warnedIndexes.LoadOrStore(err.Index.String(), true); warned {
+		return
+	}
+	link := indexCreationURL.FindString(err.Err.Error())
+	if link == "" {
+		link = "the Firestore console"
+	}
+	log.Printf("WARNING: missing Firestore index %s; falling back to an unordered query sorted in memory. Create it at %s", err.Index, link)
+}
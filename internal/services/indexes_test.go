@@ -0,0 +1,249 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/models"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// offlineFirestoreClient builds queries without ever contacting Firestore
+func offlineFirestoreClient(t *testing.T) *firestore.Client {
+	t.Helper()
+	client, err := firestore.NewClient(context.Background(), "wavlake-test",
+		option.WithoutAuthentication(), option.WithEndpoint("localhost:0"))
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// queryIndex derives the composite index a query needs: equality fields in
+// filter order followed by the ordering. Range filters must be on an ordered
+// field, which the ordering already covers.
+func queryIndex(t *testing.T, collection string, query firestore.Query) FirestoreIndex {
+	t.Helper()
+	raw, err := query.Serialize()
+	require.NoError(t, err)
+
+	var req firestorepb.RunQueryRequest
+	require.NoError(t, proto.Unmarshal(raw, &req))
+	structured := req.GetStructuredQuery()
+
+	index := FirestoreIndex{Collection: collection}
+	var filters []*firestorepb.StructuredQuery_Filter
+	if where := structured.GetWhere(); where.GetCompositeFilter() != nil {
+		filters = where.GetCompositeFilter().GetFilters()
+	} else if where != nil {
+		filters = []*firestorepb.StructuredQuery_Filter{where}
+	}
+	ordered := map[string]bool{}
+	for _, order := range structured.GetOrderBy() {
+		ordered[order.GetField().GetFieldPath()] = true
+	}
+	for _, filter := range filters {
+		field := filter.GetFieldFilter()
+		require.NotNil(t, field, "only field filters are supported")
+		path := field.GetField().GetFieldPath()
+		if field.GetOp() != firestorepb.StructuredQuery_FieldFilter_EQUAL {
+			require.True(t, ordered[path], "range filter on %s without ordering by it", path)
+			continue
+		}
+		index.Fields = append(index.Fields, FirestoreIndexField{Path: path, Order: IndexAscending})
+	}
+	for _, order := range structured.GetOrderBy() {
+		direction := IndexAscending
+		if order.GetDirection() == firestorepb.StructuredQuery_DESCENDING {
+			direction = IndexDescending
+		}
+		index.Fields = append(index.Fields, FirestoreIndexField{Path: order.GetField().GetFieldPath(), Order: direction})
+	}
+	return index
+}
+
+func TestRequiredIndexesCoverQueries(t *testing.T) {
+	client := offlineFirestoreClient(t)
+	tracks := NewNostrTrackService(client, nil)
+	search := NewFirestoreSearchIndex(tracks)
+	processing := NewProcessingService(tracks, nil, nil, nil, "")
+	users := NewUserService(client, nil)
+
+	tests := []struct {
+		name  string
+		query firestore.Query
+		index FirestoreIndex
+	}{
+		{"tracks by pubkey", tracks.tracksByPubkeyQuery("pk"), IndexTracksByPubkey},
+		{"all tracks by pubkey", tracks.allTracksByPubkeyQuery("pk"), IndexAllTracksByPubkey},
+		{"tracks by firebase uid", tracks.tracksByFirebaseUIDQuery("uid"), IndexTracksByFirebaseUID},
+		{"paginated tracks by pubkey", tracks.tracksByPubkeyQuery("pk").Limit(10), IndexTracksByPubkey},
+		{"search by title", search.searchPrefixQuery("title_normalized", "mid"), IndexPublicTracksByTitle},
+		{"search by artist", search.searchPrefixQuery("artist_normalized", "mid"), IndexPublicTracksByArtist},
+		{"due processing jobs", processing.dueJobsQuery(time.Now()).Limit(processingClaimBatch), IndexDueProcessingJobs},
+		{"expired processing leases", processing.expiredLeasesQuery(time.Now()), IndexExpiredProcessingLeases},
+		{"pubkey events by pubkey", users.pubkeyEventsQuery("pubkey", "pk"), IndexPubkeyEventsByPubkey},
+		{"pubkey events by new owner", users.pubkeyEventsQuery("new_firebase_uid", "uid"), IndexPubkeyEventsByNewOwner},
+		{"pubkey events by old owner", users.pubkeyEventsQuery("old_firebase_uid", "uid"), IndexPubkeyEventsByOldOwner},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.index, queryIndex(t, tt.index.Collection, tt.query))
+			assert.Contains(t, RequiredIndexes, tt.index)
+		})
+	}
+}
+
+func TestRequiredIndexesAreWellFormed(t *testing.T) {
+	seen := map[string]bool{}
+	for _, index := range RequiredIndexes {
+		assert.NotEmpty(t, index.Collection)
+		assert.GreaterOrEqual(t, len(index.Fields), 2, "%s is a single-field index", index)
+		for _, field := range index.Fields {
+			assert.Contains(t, []string{IndexAscending, IndexDescending}, field.Order, index.String())
+		}
+		assert.False(t, seen[index.String()], "%s is listed twice", index)
+		seen[index.String()] = true
+	}
+
+	assert.Equal(t, "nostr_tracks (pubkey ASC, deleted ASC, created_at DESC)", IndexTracksByPubkey.String())
+}
+
+func TestWrapIndexError(t *testing.T) {
+	rejected := status.Error(codes.FailedPrecondition, "The query requires an index.")
+	err := fmt.Errorf("failed to iterate tracks: %w", wrapIndexError(rejected, IndexTracksByPubkey))
+
+	assert.True(t, errors.Is(err, ErrMissingIndex))
+	assert.Contains(t, err.Error(), "nostr_tracks (pubkey ASC, deleted ASC, created_at DESC)")
+
+	var missing *MissingIndexError
+	require.True(t, errors.As(err, &missing))
+	assert.Equal(t, IndexTracksByPubkey, missing.Index)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(missing.Err))
+
+	other := status.Error(codes.Unavailable, "try again")
+	assert.Equal(t, other, wrapIndexError(other, IndexTracksByPubkey))
+	assert.NoError(t, wrapIndexError(nil, IndexTracksByPubkey))
+}
+
+// fakeIterator yields docs and then err, or iterator.Done when err is nil
+type fakeIterator struct {
+	docs    []*firestore.DocumentSnapshot
+	err     error
+	stopped bool
+}
+
+func (it *fakeIterator) Next() (*firestore.DocumentSnapshot, error) {
+	if len(it.docs) > 0 {
+		doc := it.docs[0]
+		it.docs = it.docs[1:]
+		return doc, nil
+	}
+	if it.err != nil {
+		return nil, it.err
+	}
+	return nil, iterator.Done
+}
+
+func (it *fakeIterator) Stop() {
+	it.stopped = true
+}
+
+func TestDocumentsWithIndexFallback(t *testing.T) {
+	indexErr := status.Error(codes.FailedPrecondition,
+		"The query requires an index. You can create it here: https://console.firebase.google.com/v1/r/project/wavlake/firestore/indexes?create_composite=abc")
+	doc := func() *firestore.DocumentSnapshot { return &firestore.DocumentSnapshot{} }
+
+	var logs bytes.Buffer
+	previous := log.Writer()
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(previous) })
+	index := FirestoreIndex{Collection: "fallback_test", Fields: IndexTracksByPubkey.Fields}
+
+	t.Run("ordered query succeeds", func(t *testing.T) {
+		ordered := &fakeIterator{docs: []*firestore.DocumentSnapshot{doc(), doc()}}
+		docs, fellBack, err := documentsWithIndexFallback(
+			func() documentIterator { return ordered },
+			func() documentIterator { t.Fatal("unordered query ran"); return nil },
+			index,
+		)
+		require.NoError(t, err)
+		assert.False(t, fellBack)
+		assert.Len(t, docs, 2)
+		assert.True(t, ordered.stopped)
+	})
+
+	t.Run("missing index falls back and warns once", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			ordered := &fakeIterator{err: indexErr}
+			unordered := &fakeIterator{docs: []*firestore.DocumentSnapshot{doc(), doc(), doc()}}
+			docs, fellBack, err := documentsWithIndexFallback(
+				func() documentIterator { return ordered },
+				func() documentIterator { return unordered },
+				index,
+			)
+			require.NoError(t, err)
+			assert.True(t, fellBack)
+			assert.Len(t, docs, 3)
+			assert.True(t, ordered.stopped)
+			assert.True(t, unordered.stopped)
+		}
+		assert.Equal(t, 1, strings.Count(logs.String(), "missing Firestore index fallback_test"))
+		assert.Contains(t, logs.String(), "https://console.firebase.google.com/v1/r/project/wavlake/firestore/indexes?create_composite=abc")
+	})
+
+	t.Run("other errors aren't retried", func(t *testing.T) {
+		unavailable := status.Error(codes.Unavailable, "try again")
+		_, _, err := documentsWithIndexFallback(
+			func() documentIterator {
+				return &fakeIterator{docs: []*firestore.DocumentSnapshot{doc()}, err: unavailable}
+			},
+			func() documentIterator { t.Fatal("unordered query ran"); return nil },
+			index,
+		)
+		assert.Equal(t, unavailable, err)
+	})
+
+	t.Run("fallback failure", func(t *testing.T) {
+		unavailable := status.Error(codes.Unavailable, "try again")
+		_, fellBack, err := documentsWithIndexFallback(
+			func() documentIterator { return &fakeIterator{err: indexErr} },
+			func() documentIterator { return &fakeIterator{err: unavailable} },
+			index,
+		)
+		assert.True(t, fellBack)
+		assert.Equal(t, unavailable, err)
+	})
+}
+
+func TestSortTracksNewestFirst(t *testing.T) {
+	at := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	tracks := []*models.NostrTrack{
+		{ID: "old", CreatedAt: at},
+		{ID: "new", CreatedAt: at.Add(2 * time.Hour)},
+		{ID: "tie-a", CreatedAt: at.Add(time.Hour)},
+		{ID: "tie-b", CreatedAt: at.Add(time.Hour)},
+	}
+
+	sortTracksNewestFirst(tracks)
+
+	var ids []string
+	for _, track := range tracks {
+		ids = append(ids, track.ID)
+	}
+	assert.Equal(t, []string{"new", "tie-a", "tie-b", "old"}, ids)
+}
@@ -5,41 +5,198 @@ import (
 	"io"
 	"time"
 
+	gonostr "github.com/nbd-wtf/go-nostr"
 	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/utils"
+	"github.com/wavlake/api/pkg/nostr"
 )
 
 // UserServiceInterface defines the interface for user operations
 type UserServiceInterface interface {
-	LinkPubkeyToUser(ctx context.Context, pubkey, firebaseUID string) error
+	LinkPubkeyToUser(ctx context.Context, pubkey, firebaseUID string) (*models.NostrAuth, bool, error)
 	UnlinkPubkeyFromUser(ctx context.Context, pubkey, firebaseUID string) error
 	GetLinkedPubkeys(ctx context.Context, firebaseUID string) ([]models.NostrAuth, error)
 	GetFirebaseUIDByPubkey(ctx context.Context, pubkey string) (string, error)
+	GetPubkeyLink(ctx context.Context, pubkey string) (*models.NostrAuth, error)
+	ArePubkeysLinked(ctx context.Context, pubkeys []string) (map[string]bool, error)
 	GetUserEmail(ctx context.Context, firebaseUID string) (string, error)
+	GetOrCreateUser(ctx context.Context, firebaseUID string) (*models.User, error)
+	UpdateUserProfile(ctx context.Context, firebaseUID string, update models.UserProfileUpdate) (*models.User, error)
+	GetPubkeyHistory(ctx context.Context, firebaseUID string) ([]models.NostrAuthEvent, error)
+	GetPubkeyHistoryByPubkey(ctx context.Context, pubkey string) ([]models.NostrAuthEvent, error)
 }
 
 // PostgresServiceInterface defines the interface for PostgreSQL operations
 type PostgresServiceInterface interface {
 	GetUserByFirebaseUID(ctx context.Context, firebaseUID string) (*models.LegacyUser, error)
-	GetUserTracks(ctx context.Context, firebaseUID string) ([]models.LegacyTrack, error)
+	GetUserTracks(ctx context.Context, firebaseUID string, filter LegacyTrackFilter) ([]models.LegacyTrack, int, error)
 	GetUserArtists(ctx context.Context, firebaseUID string) ([]models.LegacyArtist, error)
 	GetUserAlbums(ctx context.Context, firebaseUID string) ([]models.LegacyAlbum, error)
-	GetTracksByArtist(ctx context.Context, artistID string) ([]models.LegacyTrack, error)
-	GetTracksByAlbum(ctx context.Context, albumID string) ([]models.LegacyTrack, error)
+	GetTracksByArtist(ctx context.Context, artistID string, filter LegacyTrackFilter) ([]models.LegacyTrack, int, error)
+	GetTracksByAlbum(ctx context.Context, albumID string, filter LegacyTrackFilter) ([]models.LegacyTrack, int, error)
+	SearchUserCatalog(ctx context.Context, firebaseUID, query, searchType string, limit int) ([]models.LegacySearchResult, error)
+	GetUserEarnings(ctx context.Context, firebaseUID string) (*models.LegacyEarnings, error)
 }
 
 // StorageServiceInterface defines the interface for storage operations
 type StorageServiceInterface interface {
-	GeneratePresignedURL(ctx context.Context, objectName string, expiration time.Duration) (string, error)
+	GeneratePresignedURL(ctx context.Context, objectName string, expiration time.Duration, constraints UploadConstraints) (string, error)
+	UploadHeaders(constraints UploadConstraints) map[string]string
+	GenerateDownloadURL(ctx context.Context, objectName string, expiration time.Duration) (string, error)
 	GetPublicURL(objectName string) string
+	ResolvePublicURL(storedURL string) string
 	UploadObject(ctx context.Context, objectName string, data io.Reader, contentType string) error
 	CopyObject(ctx context.Context, srcObject, dstObject string) error
 	DeleteObject(ctx context.Context, objectName string) error
+	DeleteObjects(ctx context.Context, objectNames []string) map[string]error
+	ListObjects(ctx context.Context, prefix string) ([]string, error)
 	GetObjectMetadata(ctx context.Context, objectName string) (interface{}, error)
 	GetObjectReader(ctx context.Context, objectName string) (io.ReadCloser, error)
+	GetObjectRangeReader(ctx context.Context, objectName string, offset, length int64) (io.ReadCloser, error)
+	GetObjectSize(ctx context.Context, objectName string) (int64, error)
+	// GetObjectChecksums returns what storage recorded for an object; nil
+	// means it records none
+	GetObjectChecksums(ctx context.Context, objectName string) (*ObjectChecksums, error)
+	// SetStorageClass moves an object to a backend-specific storage class,
+	// such as COLDLINE on GCS or Cool on Azure
+	SetStorageClass(ctx context.Context, objectName, storageClass string) error
+	// RestoreObject reports whether an object can be read, starting a restore
+	// if its storage class keeps it offline
+	RestoreObject(ctx context.Context, objectName string) (bool, error)
 	GetBucketName() string
+	CheckBucket(ctx context.Context) error
 	Close() error
 }
 
+// NotificationServiceInterface defines the interface for user notification operations
+type NotificationServiceInterface interface {
+	Notify(notification models.Notification)
+	CreateNotification(ctx context.Context, notification models.Notification) (bool, error)
+	ListNotifications(ctx context.Context, firebaseUID string, unreadOnly bool, limit int, cursor string) ([]models.Notification, string, error)
+	MarkNotificationRead(ctx context.Context, firebaseUID, notificationID string) error
+}
+
+// ExportServiceInterface defines the interface for user data export operations
+type ExportServiceInterface interface {
+	CountTracks(ctx context.Context, firebaseUID string) (int, error)
+	RequiresAsyncExport(trackCount int) bool
+	WriteExport(ctx context.Context, firebaseUID string, w io.Writer) error
+	StartExportJob(ctx context.Context, firebaseUID string, trackCount int) (*models.ExportJob, error)
+	GetExportJob(ctx context.Context, firebaseUID, jobID string) (*models.ExportJob, error)
+}
+
+// AccountDeletionServiceInterface defines the interface for deleting accounts
+type AccountDeletionServiceInterface interface {
+	RequestAccountDeletion(ctx context.Context, firebaseUID string, disableFirebaseAccount bool) (*models.AccountDeletionConfirmation, error)
+	ConfirmAccountDeletion(ctx context.Context, firebaseUID, code string) (*models.AccountDeletion, error)
+}
+
+// WebhookServiceInterface defines the interface for user webhook operations
+type WebhookServiceInterface interface {
+	CreateWebhook(ctx context.Context, firebaseUID, url, secret string, eventTypes []string) (*models.UserWebhook, error)
+	ListWebhooks(ctx context.Context, firebaseUID string) ([]models.UserWebhook, error)
+	DeleteWebhook(ctx context.Context, firebaseUID, webhookID string) error
+	TestWebhook(ctx context.Context, firebaseUID, webhookID string) (*models.WebhookDelivery, error)
+	Dispatch(notification models.Notification)
+}
+
+// ProfileServiceInterface defines the interface for the account overview
+type ProfileServiceInterface interface {
+	GetProfile(ctx context.Context, firebaseUID string) (*models.UserProfile, error)
+}
+
+// NostrTrackServiceInterface defines the track operations used by the track handlers
+type NostrTrackServiceInterface interface {
+	Events() *TrackEventHub
+	ChooseRegion(hint, country string) (string, error)
+	CreateTrack(ctx context.Context, pubkey, firebaseUID, extension, region, dTag string) (*models.NostrTrack, error)
+	GetTrack(ctx context.Context, trackID string) (*models.NostrTrack, error)
+	GetTracksByPubkey(ctx context.Context, pubkey string) ([]*models.NostrTrack, error)
+	ListTracksByPubkey(ctx context.Context, pubkey string, limit int, cursor string) ([]*models.NostrTrack, string, error)
+	ListAllTracksByPubkey(ctx context.Context, pubkey string) ([]*models.NostrTrack, error)
+	TransitionTrack(ctx context.Context, trackID, status string, updates map[string]interface{}) error
+	ClaimIdempotencyKey(ctx context.Context, key, trackID string) (bool, error)
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+	MarkTrackAsProcessed(ctx context.Context, trackID string, size int64, duration int) error
+	MarkTrackAsCompressed(ctx context.Context, trackID, compressedURL string) error
+	MarkOriginalDeleted(ctx context.Context, trackID string) (bool, error)
+	DeleteTrack(ctx context.Context, trackID string) error
+	RestoreTrack(ctx context.Context, trackID string) error
+	PurgeTrackFiles(ctx context.Context, track *models.NostrTrack, dryRun bool) (*models.TrackPurge, error)
+	RecordPublication(ctx context.Context, trackID string, event *gonostr.Event, relays []string) (*models.NostrTrack, error)
+	PublishToRelays(ctx context.Context, trackID string, event *gonostr.Event) (*models.NostrTrack, []models.RelayPublishResult, error)
+	SetNostrRef(ctx context.Context, trackID string, ref NostrRef) (*models.NostrTrack, error)
+	BuildNostrEventDraft(ctx context.Context, track *models.NostrTrack) (*gonostr.Event, error)
+	UpdateCompressionVisibility(ctx context.Context, trackID string, updates []models.VersionUpdate) error
+	AddOrUpdateCompressionVersion(ctx context.Context, trackID string, report models.CompressionVersion) (*models.CompressionVersion, error)
+	RecordCompressedObject(ctx context.Context, trackID, versionID string, size int64) (*models.CompressionVersion, error)
+	ListProcessingHistory(ctx context.Context, trackID string, limit int, cursor string) ([]models.ProcessingAttempt, string, error)
+	CreateShareLink(ctx context.Context, trackID string, ttl time.Duration, maxUses int) (*models.ShareLink, error)
+	ListShareLinks(ctx context.Context, trackID string) ([]models.ShareLink, error)
+	RevokeShareLink(ctx context.Context, trackID, linkID string) error
+	OpenShareLink(ctx context.Context, token string) (*models.NostrTrack, *models.ShareLink, error)
+	SignSharedStreams(ctx context.Context, track *models.NostrTrack) ([]models.SharedStream, error)
+	SignOriginalDownload(ctx context.Context, track *models.NostrTrack, expiration time.Duration) (*models.OriginalDownload, error)
+	RenewUploadURL(ctx context.Context, trackID string, replace bool) (*models.UploadURL, error)
+	GetUsage(ctx context.Context, firebaseUID string) (*models.UsageReport, error)
+}
+
+// ProcessingServiceInterface defines the processing operations used by the track handlers
+type ProcessingServiceInterface interface {
+	ProcessTrackAsync(ctx context.Context, trackID, triggeredBy string) error
+	ReprocessTrackAsync(ctx context.Context, trackID string) error
+	ReconcileStuckTracks(ctx context.Context) (*models.ReconcileResult, error)
+	CancelProcessing(trackID string) int
+	RequestCompressionVersions(ctx context.Context, trackID string, compressionOptions []models.CompressionOption) (*models.CompressionRequestResult, error)
+}
+
+// BulkCompressionServiceInterface defines the interface for compression across many tracks
+type BulkCompressionServiceInterface interface {
+	StartBulkCompression(ctx context.Context, pubkey string, trackIDs []string, all bool, options []models.CompressionOption) (*models.BulkCompressionJob, error)
+	GetBulkCompressionJob(ctx context.Context, pubkey, jobID string) (*models.BulkCompressionJob, error)
+}
+
+// SearchIndex finds public tracks for listener search. FirestoreSearchIndex
+// implements it with prefix queries; a search backend can take its place.
+type SearchIndex interface {
+	SearchTracks(ctx context.Context, query string, limit int, cursor string) ([]*models.NostrTrack, string, error)
+}
+
+// RelayPublisher sends signed events to relays, reporting each relay's answer
+type RelayPublisher interface {
+	Publish(ctx context.Context, event *gonostr.Event) []nostr.RelayResult
+}
+
+// AudioProcessorInterface defines the audio operations used by track processing
+type AudioProcessorInterface interface {
+	ValidateAudioFile(ctx context.Context, filePath string) error
+	CheckFormat(filePath, extension string) error
+	GetAudioInfo(ctx context.Context, inputPath string) (*utils.AudioInfo, error)
+	GetAudioTags(ctx context.Context, inputPath string) (*utils.AudioTags, error)
+	ExtractArtwork(ctx context.Context, inputPath, outputPath string) error
+	CompressAudio(ctx context.Context, inputPath, outputPath string) error
+	CompressAudioWithOptions(ctx context.Context, inputPath, outputPath string, options models.CompressionOption) error
+	CompressStream(ctx context.Context, input io.Reader, inputFormat string, output io.Writer, options models.CompressionOption) error
+	ProbeStream(ctx context.Context, input io.Reader, inputFormat string) (*utils.AudioInfo, error)
+	GenerateWaveform(ctx context.Context, inputPath string, buckets int) (*utils.Waveform, error)
+	CreatePreview(ctx context.Context, inputPath, outputPath string, start, length time.Duration) error
+	IsFormatSupported(extension string) bool
+}
+
 // Ensure services implement their interfaces
 var _ UserServiceInterface = (*UserService)(nil)
 var _ StorageServiceInterface = (*StorageService)(nil)
+var _ StorageServiceInterface = (*AzureStorageService)(nil)
+var _ StorageServiceInterface = (*LocalStorageService)(nil)
+var _ StorageServiceInterface = (*RetryingStorage)(nil)
+var _ NotificationServiceInterface = (*NotificationService)(nil)
+var _ ExportServiceInterface = (*ExportService)(nil)
+var _ AccountDeletionServiceInterface = (*AccountDeletionService)(nil)
+var _ WebhookServiceInterface = (*WebhookService)(nil)
+var _ ProfileServiceInterface = (*ProfileService)(nil)
+var _ NostrTrackServiceInterface = (*NostrTrackService)(nil)
+var _ ProcessingServiceInterface = (*ProcessingService)(nil)
+var _ BulkCompressionServiceInterface = (*BulkCompressionService)(nil)
+var _ SearchIndex = (*FirestoreSearchIndex)(nil)
+var _ AudioProcessorInterface = (*utils.AudioProcessor)(nil)
+var _ RelayPublisher = (*nostr.RelayClient)(nil)
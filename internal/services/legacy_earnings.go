@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/wavlake/api/internal/models"
+)
+
+// legacyEarningsQuery totals a user's non-deleted tracks' msat_total per
+// album, as (artist id, artist name, album id, album title, total). Artists
+// without albums have one row with a NULL album, and albums without tracks
+// total 0.
+const legacyEarningsQuery = `
+	SELECT ar.id, ar.name, al.id, al.title, COALESCE(SUM(t.msat_total), 0)
+	FROM artist ar
+	LEFT JOIN album al ON al.artist_id = ar.id AND NOT COALESCE(al.deleted, false)
+	LEFT JOIN track t ON t.album_id = al.id AND NOT COALESCE(t.deleted, false)
+	WHERE ar.user_id = $1 AND NOT COALESCE(ar.deleted, false)
+	GROUP BY ar.id, ar.name, al.id, al.title
+	ORDER BY ar.name, ar.id, al.title, al.id`
+
+// GetUserEarnings totals a user's legacy earnings by artist and album, with
+// their msat_balance. Tracks are summed in the database; only one row per
+// album is read. Returns ErrLegacyNotFound for an unknown or locked user.
+func (p *PostgresService) GetUserEarnings(ctx context.Context, firebaseUID string) (*models.LegacyEarnings, error) {
+	earnings := &models.LegacyEarnings{Artists: []models.LegacyArtistEarnings{}}
+	err := p.observe(ctx, "user_earnings", []interface{}{firebaseUID}, func(ctx context.Context) error {
+		tx, err := p.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+		if err != nil {
+			return legacyError("failed to begin read-only transaction", err)
+		}
+		defer tx.Rollback() // #nosec G104 -- Read-only; nothing to roll back
+
+		var balance sql.NullInt64
+		err = tx.QueryRowContext(ctx, `SELECT msat_balance FROM "user" WHERE id = $1 AND NOT COALESCE(is_locked, false)`, firebaseUID).Scan(&balance)
+		if err != nil {
+			return legacyError("failed to get balance", err)
+		}
+		earnings.MSatBalance = balance.Int64
+
+		rows, err := tx.QueryContext(ctx, legacyEarningsQuery, firebaseUID)
+		if err != nil {
+			return legacyError("failed to total earnings", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var artistID string
+			var artistName, albumID, albumTitle sql.NullString
+			var total int64
+			if err := rows.Scan(&artistID, &artistName, &albumID, &albumTitle, &total); err != nil {
+				return legacyError("failed to scan earnings", err)
+			}
+
+			// Rows are ordered by artist, so an artist's albums are adjacent
+			last := len(earnings.Artists) - 1
+			if last < 0 || earnings.Artists[last].ArtistID != artistID {
+				earnings.Artists = append(earnings.Artists, models.LegacyArtistEarnings{
+					ArtistID: artistID,
+					Name:     artistName.String,
+					Albums:   []models.LegacyAlbumEarnings{},
+				})
+				last++
+			}
+			if albumID.Valid {
+				artist := &earnings.Artists[last]
+				artist.Albums = append(artist.Albums, models.LegacyAlbumEarnings{
+					AlbumID:   albumID.String,
+					Title:     albumTitle.String,
+					MSatTotal: total,
+				})
+				artist.MSatTotal += total
+				earnings.MSatTotal += total
+			}
+		}
+
+		if err = rows.Err(); err != nil {
+			return legacyError("failed to iterate earnings", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return earnings, nil
+}
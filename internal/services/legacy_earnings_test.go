@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/models"
+)
+
+var legacyEarningsColumns = []string{"id", "name", "id", "title", "coalesce"}
+
+func TestGetUserEarnings(t *testing.T) {
+	p, mock := newMockPostgres(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT msat_balance FROM "user"`).WithArgs("uid").
+		WillReturnRows(sqlmock.NewRows([]string{"msat_balance"}).AddRow(7000))
+	mock.ExpectQuery(`SUM\(t\.msat_total\).*WHERE ar\.user_id = \$1.*GROUP BY ar\.id, ar\.name, al\.id, al\.title`).WithArgs("uid").
+		WillReturnRows(sqlmock.NewRows(legacyEarningsColumns).
+			AddRow("artist-1", "Artist", "album-1", "Dawn", 1500).
+			AddRow("artist-1", "Artist", "album-2", "Dusk", 0).
+			AddRow("artist-2", "Other", "album-3", "Noon", 2500).
+			AddRow("artist-3", nil, nil, nil, 0))
+	mock.ExpectRollback()
+
+	earnings, err := p.GetUserEarnings(context.Background(), "uid")
+	require.NoError(t, err)
+	assert.Equal(t, &models.LegacyEarnings{
+		MSatBalance: 7000,
+		MSatTotal:   4000,
+		Artists: []models.LegacyArtistEarnings{
+			{ArtistID: "artist-1", Name: "Artist", MSatTotal: 1500, Albums: []models.LegacyAlbumEarnings{
+				{AlbumID: "album-1", Title: "Dawn", MSatTotal: 1500},
+				{AlbumID: "album-2", Title: "Dusk", MSatTotal: 0},
+			}},
+			{ArtistID: "artist-2", Name: "Other", MSatTotal: 2500, Albums: []models.LegacyAlbumEarnings{
+				{AlbumID: "album-3", Title: "Noon", MSatTotal: 2500},
+			}},
+			{ArtistID: "artist-3", Albums: []models.LegacyAlbumEarnings{}},
+		},
+	}, earnings)
+}
+
+func TestGetUserEarnings_NoContent(t *testing.T) {
+	p, mock := newMockPostgres(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT msat_balance FROM "user"`).WithArgs("uid").
+		WillReturnRows(sqlmock.NewRows([]string{"msat_balance"}).AddRow(nil))
+	mock.ExpectQuery(`GROUP BY`).WithArgs("uid").WillReturnRows(sqlmock.NewRows(legacyEarningsColumns))
+	mock.ExpectRollback()
+
+	earnings, err := p.GetUserEarnings(context.Background(), "uid")
+	require.NoError(t, err)
+	assert.Equal(t, &models.LegacyEarnings{Artists: []models.LegacyArtistEarnings{}}, earnings)
+}
+
+func TestGetUserEarnings_UnknownUser(t *testing.T) {
+	p, mock := newMockPostgres(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT msat_balance FROM "user"`).WithArgs("uid").
+		WillReturnRows(sqlmock.NewRows([]string{"msat_balance"}))
+	mock.ExpectRollback()
+
+	_, err := p.GetUserEarnings(context.Background(), "uid")
+	assert.ErrorIs(t, err, ErrLegacyNotFound)
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/wavlake/api/internal/models"
+)
+
+// Legacy catalog entity types matched by SearchUserCatalog
+const (
+	LegacySearchTypeTrack  = "track"
+	LegacySearchTypeAlbum  = "album"
+	LegacySearchTypeArtist = "artist"
+)
+
+const (
+	// MinLegacySearchQueryLength and MaxLegacySearchQueryLength bound the text
+	// of a legacy catalog search
+	MinLegacySearchQueryLength = 2
+	MaxLegacySearchQueryLength = 100
+
+	// DefaultLegacySearchLimit and MaxLegacySearchLimit bound its results
+	DefaultLegacySearchLimit = 20
+	MaxLegacySearchLimit     = 50
+)
+
+// legacySearchQueries select a user's non-deleted entities of each type whose
+// title or name matches the pattern in $2, as (type, id, title, artist name,
+// album name)
+var legacySearchQueries = map[string]string{
+	LegacySearchTypeTrack: `
+		SELECT 'track' AS type, t.id, t.title, ar.name, al.title
+		FROM track t
+		JOIN album al ON t.album_id = al.id
+		JOIN artist ar ON al.artist_id = ar.id
+		WHERE ar.user_id = $1 AND NOT COALESCE(t.deleted, false) AND t.title ILIKE $2 ESCAPE '\'`,
+	LegacySearchTypeAlbum: `
+		SELECT 'album' AS type, al.id, al.title, ar.name, NULL::text
+		FROM album al
+		JOIN artist ar ON al.artist_id = ar.id
+		WHERE ar.user_id = $1 AND NOT COALESCE(al.deleted, false) AND al.title ILIKE $2 ESCAPE '\'`,
+	LegacySearchTypeArtist: `
+		SELECT 'artist' AS type, ar.id, ar.name, NULL::text, NULL::text
+		FROM artist ar
+		WHERE ar.user_id = $1 AND NOT COALESCE(ar.deleted, false) AND ar.name ILIKE $2 ESCAPE '\'`,
+}
+
+// legacySearchTypes is the order types are combined in when searching them all
+var legacySearchTypes = []string{LegacySearchTypeArtist, LegacySearchTypeAlbum, LegacySearchTypeTrack}
+
+// IsValidLegacySearchType reports whether searchType names a legacy entity
+// type SearchUserCatalog can match
+func IsValidLegacySearchType(searchType string) bool {
+	_, ok := legacySearchQueries[searchType]
+	return ok
+}
+
+// escapeLike escapes LIKE's wildcards in user input, so it matches literally
+// with ESCAPE '\'
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// SearchUserCatalog finds a user's legacy tracks, albums or artists whose title
+// or name contains query, case-insensitively, ordered by title. An empty
+// searchType searches every type.
+func (p *PostgresService) SearchUserCatalog(ctx context.Context, firebaseUID, query, searchType string, limit int) ([]models.LegacySearchResult, error) {
+	types := legacySearchTypes
+	if searchType != "" {
+		if !IsValidLegacySearchType(searchType) {
+			return nil, fmt.Errorf("unknown legacy search type %q", searchType)
+		}
+		types = []string{searchType}
+	}
+	if limit <= 0 {
+		limit = DefaultLegacySearchLimit
+	}
+	limit = min(limit, MaxLegacySearchLimit)
+
+	selects := make([]string, len(types))
+	for i, entityType := range types {
+		selects[i] = legacySearchQueries[entityType]
+	}
+	sqlQuery := strings.Join(selects, "\n\t\tUNION ALL") + `
+		ORDER BY 3, 1, 2
+		LIMIT $3`
+
+	args := []interface{}{firebaseUID, "%" + escapeLike(query) + "%", limit}
+	results := []models.LegacySearchResult{}
+	err := p.observe(ctx, "search_catalog", args, func(ctx context.Context) error {
+		rows, err := p.db.QueryContext(ctx, sqlQuery, args...)
+		if err != nil {
+			return legacyError("failed to search catalog", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var result models.LegacySearchResult
+			var title, artistName, albumName sql.NullString
+			if err := rows.Scan(&result.Type, &result.ID, &title, &artistName, &albumName); err != nil {
+				return legacyError("failed to scan search result", err)
+			}
+			result.Title = title.String
+			result.ArtistName = artistName.String
+			result.AlbumName = albumName.String
+			results = append(results, result)
+		}
+
+		if err = rows.Err(); err != nil {
+			return legacyError("failed to iterate search results", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/models"
+)
+
+var legacySearchColumns = []string{"type", "id", "title", "name", "title"}
+
+func TestEscapeLike(t *testing.T) {
+	assert.Equal(t, `50\% off`, escapeLike("50% off"))
+	assert.Equal(t, `track\_01`, escapeLike("track_01"))
+	assert.Equal(t, `back\\slash`, escapeLike(`back\slash`))
+	assert.Equal(t, `\\\%\_`, escapeLike(`\%_`))
+}
+
+func TestSearchUserCatalog_EscapesWildcards(t *testing.T) {
+	p, mock := newMockPostgres(t)
+	mock.ExpectQuery(`FROM track t.*t\.title ILIKE \$2 ESCAPE '\\'`).
+		WithArgs("uid", `%100\%\_pure%`, 10).
+		WillReturnRows(sqlmock.NewRows(legacySearchColumns).
+			AddRow("track", "track-1", "100%_pure", "Artist", nil))
+
+	results, err := p.SearchUserCatalog(context.Background(), "uid", "100%_pure", LegacySearchTypeTrack, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []models.LegacySearchResult{{Type: "track", ID: "track-1", Title: "100%_pure", ArtistName: "Artist"}}, results)
+}
+
+func TestSearchUserCatalog_AllTypes(t *testing.T) {
+	p, mock := newMockPostgres(t)
+	mock.ExpectQuery(`FROM artist ar.*UNION ALL.*FROM album al.*UNION ALL.*FROM track t.*LIMIT \$3`).
+		WithArgs("uid", "%night%", MaxLegacySearchLimit).
+		WillReturnRows(sqlmock.NewRows(legacySearchColumns).
+			AddRow("album", "album-1", "Midnight", "Artist", nil).
+			AddRow("track", "track-1", "Nightfall", "Artist", "Midnight"))
+
+	results, err := p.SearchUserCatalog(context.Background(), "uid", "night", "", 1000)
+	require.NoError(t, err)
+	assert.Equal(t, []models.LegacySearchResult{
+		{Type: "album", ID: "album-1", Title: "Midnight", ArtistName: "Artist"},
+		{Type: "track", ID: "track-1", Title: "Nightfall", ArtistName: "Artist", AlbumName: "Midnight"},
+	}, results)
+}
+
+func TestSearchUserCatalog_UnknownType(t *testing.T) {
+	p, _ := newMockPostgres(t)
+	_, err := p.SearchUserCatalog(context.Background(), "uid", "night", "playlist", 10)
+	assert.Error(t, err)
+}
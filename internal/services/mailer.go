@@ -0,0 +1,156 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// EmailMessage is a plain-text email
+type EmailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends transactional emails
+type Mailer interface {
+	Send(ctx context.Context, msg EmailMessage) error
+}
+
+// NewMailerFromEnv returns a Mailer based on the configured credentials:
+// SENDGRID_API_KEY selects SendGrid, SMTP_HOST selects SMTP, otherwise a no-op
+// mailer is returned so environments without credentials run unchanged.
+func NewMailerFromEnv() Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "noreply@wavlake.com"
+	}
+
+	if apiKey := os.Getenv("SENDGRID_API_KEY"); apiKey != "" {
+		log.Println("Email notifications enabled via SendGrid")
+		return &SendGridMailer{
+			apiKey: apiKey,
+			from:   from,
+			client: &http.Client{Timeout: 15 * time.Second},
+		}
+	}
+
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		log.Printf("Email notifications enabled via SMTP (%s:%s)", host, port)
+		return &SMTPMailer{
+			addr:     net.JoinHostPort(host, port),
+			host:     host,
+			username: os.Getenv("SMTP_USERNAME"),
+			password: os.Getenv("SMTP_PASSWORD"),
+			from:     from,
+		}
+	}
+
+	log.Println("No mail provider configured, email notifications disabled")
+	return NoopMailer{}
+}
+
+// NoopMailer discards all messages
+type NoopMailer struct{}
+
+func (NoopMailer) Send(ctx context.Context, msg EmailMessage) error {
+	return nil
+}
+
+// SMTPMailer sends email through an SMTP relay using PLAIN auth
+type SMTPMailer struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg EmailMessage) error {
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", m.from)
+	fmt.Fprintf(&body, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&body, "Subject: %s\r\n", msg.Subject)
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n\r\n")
+	body.WriteString(msg.Body)
+
+	// net/smtp has no context support, so run the send in the background and
+	// stop waiting when the context ends
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- smtp.SendMail(m.addr, auth, m.from, []string{msg.To}, []byte(body.String()))
+	}()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return fmt.Errorf("failed to send email via SMTP: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SendGridMailer sends email through the SendGrid v3 mail API
+type SendGridMailer struct {
+	apiKey string
+	from   string
+	client *http.Client
+}
+
+func (m *SendGridMailer) Send(ctx context.Context, msg EmailMessage) error {
+	payload := map[string]interface{}{
+		"personalizations": []map[string]interface{}{
+			{"to": []map[string]string{{"email": msg.To}}},
+		},
+		"from":    map[string]string{"email": m.from},
+		"subject": msg.Subject,
+		"content": []map[string]string{
+			{"type": "text/plain", "value": msg.Body},
+		},
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal SendGrid payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.sendgrid.com/v3/mail/send", bytes.NewReader(payloadBytes))
+	if err != nil {
+		return fmt.Errorf("failed to create SendGrid request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+m.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call SendGrid: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("SendGrid returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -2,41 +2,177 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"slices"
 	"time"
 
 	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/storage"
 	"github.com/google/uuid"
+	gonostr "github.com/nbd-wtf/go-nostr"
+	"github.com/wavlake/api/internal/apierror"
 	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/telemetry"
 	"github.com/wavlake/api/internal/utils"
 	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// trackVersionsCollection is the per-track subcollection holding one document
+// per compression version
+const trackVersionsCollection = "versions"
+
+// ErrTrackNotFound is returned by GetTrack for a track ID with no document
+var ErrTrackNotFound = apierror.New(http.StatusNotFound, "track.not_found", "track not found")
+
+// ErrTrackUpdateConflict is returned when a track kept changing underneath an
+// update, even after retrying against the latest version of the document
+var ErrTrackUpdateConflict = apierror.New(http.StatusConflict, "track.update_conflict", "track was modified concurrently, please retry")
+
+// ErrInvalidTrackCursor is returned for a page cursor that doesn't name one of
+// the listed account's tracks
+var ErrInvalidTrackCursor = apierror.New(http.StatusBadRequest, "track.invalid_cursor", "invalid cursor")
+
+// DefaultTrackPageSize and MaxTrackPageSize bound paginated track listings
+const (
+	DefaultTrackPageSize = 50
+	MaxTrackPageSize     = 200
+)
+
+// DefaultMaxUploadBytes is the largest original an upload URL accepts unless
+// configured otherwise, matching the import download limit
+const DefaultMaxUploadBytes = DefaultImportMaxBytes
+
+// DefaultPresignedURLExpiry is how long CreateTrack's upload URLs work unless
+// configured otherwise
+const DefaultPresignedURLExpiry = time.Hour
+
+// NostrTrackOption configures a NostrTrackService
+type NostrTrackOption func(*NostrTrackService)
+
+// WithMaxUploadBytes sets the largest original an upload URL accepts
+func WithMaxUploadBytes(maxBytes int64) NostrTrackOption {
+	return func(s *NostrTrackService) {
+		if maxBytes > 0 {
+			s.maxUploadBytes = maxBytes
+		}
+	}
+}
+
+// WithPresignedURLExpiry sets how long upload URLs from CreateTrack work
+func WithPresignedURLExpiry(expiry time.Duration) NostrTrackOption {
+	return func(s *NostrTrackService) {
+		if expiry > 0 {
+			s.presignExpiry = expiry
+		}
+	}
+}
+
 type NostrTrackService struct {
 	firestoreClient *firestore.Client
-	storageService  StorageServiceInterface
+	storageRegions  *StorageRegions
 	pathConfig      *utils.StoragePathConfig
+	events          *TrackEventHub
+	quota           models.TrackQuota
+	presignExpiry   time.Duration  // How long CreateTrack's upload URLs work
+	maxUploadBytes  int64          // Largest original an upload URL accepts
+	maxVersions     int            // Most compression versions a track may have
+	relayPublisher  RelayPublisher // Nil unless server-side publishing is configured
 }
 
-func NewNostrTrackService(firestoreClient *firestore.Client, storageService StorageServiceInterface) *NostrTrackService {
-	return &NostrTrackService{
+func NewNostrTrackService(firestoreClient *firestore.Client, storageRegions *StorageRegions, opts ...NostrTrackOption) *NostrTrackService {
+	s := &NostrTrackService{
 		firestoreClient: firestoreClient,
-		storageService:  storageService,
+		storageRegions:  storageRegions,
 		pathConfig:      utils.GetStoragePathConfig(),
+		events:          NewTrackEventHub(),
+		presignExpiry:   DefaultPresignedURLExpiry,
+		maxUploadBytes:  DefaultMaxUploadBytes,
+		maxVersions:     DefaultMaxCompressionVersions,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Events returns the hub that track updates made through this service are
+// published to
+func (s *NostrTrackService) Events() *TrackEventHub {
+	return s.events
+}
+
+// StorageFor returns the storage service holding a track's files
+func (s *NostrTrackService) StorageFor(track *models.NostrTrack) StorageServiceInterface {
+	return s.storageRegions.Get(track.Region)
 }
 
-// CreateTrack creates a new NostrTrack record and returns a presigned upload URL
-func (s *NostrTrackService) CreateTrack(ctx context.Context, pubkey, firebaseUID, extension string) (*models.NostrTrack, error) {
+// resolveURLs rewrites a track's stored URLs to their current public form, so
+// tracks saved before a public base URL was configured get the new links
+// without a migration. The stored document is not changed.
+func (s *NostrTrackService) resolveURLs(track *models.NostrTrack) {
+	if s.storageRegions == nil {
+		return
+	}
+
+	storageService := s.StorageFor(track)
+	track.OriginalURL = storageService.ResolvePublicURL(track.OriginalURL)
+	track.CompressedURL = storageService.ResolvePublicURL(track.CompressedURL)
+	track.WaveformURL = storageService.ResolvePublicURL(track.WaveformURL)
+	track.PreviewURL = storageService.ResolvePublicURL(track.PreviewURL)
+	track.ArtworkURL = storageService.ResolvePublicURL(track.ArtworkURL)
+	for i := range track.CompressionVersions {
+		track.CompressionVersions[i].URL = storageService.ResolvePublicURL(track.CompressionVersions[i].URL)
+	}
+}
+
+// ChooseRegion picks the storage region for a new track from an optional
+// client hint and the client's country code
+func (s *NostrTrackService) ChooseRegion(hint, country string) (string, error) {
+	return s.storageRegions.Choose(hint, country)
+}
+
+// CreateTrack creates a new NostrTrack record in the given storage region and
+// returns a presigned upload URL. An empty region uses the primary region, and
+// an empty dTag gets a generated one.
+func (s *NostrTrackService) CreateTrack(ctx context.Context, pubkey, firebaseUID, extension, region, dTag string) (_ *models.NostrTrack, err error) {
 	trackID := uuid.New().String()
+	ctx, span := telemetry.Start(ctx, "NostrTrackService.CreateTrack", telemetry.AttributeTrackID.String(trackID), telemetry.AttributePubkey.String(pubkey))
+	defer func() { telemetry.End(span, err) }()
 	now := time.Now()
 
+	// A chosen d tag must be unique among the pubkey's tracks; a generated
+	// one is
+	chosenDTag := dTag != ""
+	if chosenDTag {
+		if err := ValidateNostrDTag(dTag); err != nil {
+			return nil, err
+		}
+	} else {
+		dTag = uuid.New().String()
+	}
+
+	if region == "" {
+		region = s.storageRegions.Primary()
+	}
+	storageService := s.storageRegions.Get(region)
+
+	// Fail fast before signing an upload URL; the transaction below checks
+	// again so concurrent creates can't overshoot the quota
+	if err := s.checkUserQuota(ctx, firebaseUID); err != nil {
+		return nil, err
+	}
+
 	// Generate storage object names using path configuration
 	originalObjectName := s.pathConfig.GetOriginalPath(trackID, extension)
 
 	// Generate presigned URL for upload (valid for 1 hour)
-	presignedURL, err := s.storageService.GeneratePresignedURL(ctx, originalObjectName, time.Hour)
+	constraints := s.uploadConstraints(extension)
+	presignedURL, err := storageService.GeneratePresignedURL(ctx, originalObjectName, s.presignExpiry, constraints)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate presigned URL: %w", err)
 	}
@@ -46,20 +182,52 @@ func (s *NostrTrackService) CreateTrack(ctx context.Context, pubkey, firebaseUID
 		ID:                    trackID,
 		FirebaseUID:           firebaseUID,
 		Pubkey:                pubkey,
-		OriginalURL:           s.storageService.GetPublicURL(originalObjectName),
+		OriginalURL:           storageService.GetPublicURL(originalObjectName),
 		PresignedURL:          presignedURL,
+		UploadHeaders:         storageService.UploadHeaders(constraints),
+		MaxUploadBytes:        constraints.MaxBytes,
 		Extension:             extension,
+		Region:                region,
+		Status:                models.TrackStatusPendingUpload,
+		StatusTimestamps:      map[string]time.Time{models.TrackStatusPendingUpload: now},
 		IsProcessing:          true,
 		IsCompressed:          false,
 		CompressionVersions:   []models.CompressionVersion{}, // Initialize empty slice
+		VersionsMigrated:      true,                          // New tracks store versions in the subcollection
 		HasPendingCompression: false,
+		NostrDTag:             dTag,
 		Deleted:               false,
 		CreatedAt:             now,
 		UpdatedAt:             now,
 	}
 
-	// Save to Firestore
-	_, err = s.firestoreClient.Collection("nostr_tracks").Doc(trackID).Set(ctx, track)
+	// Save to Firestore, counting the track toward its owner's usage
+	ref := s.firestoreClient.Collection("nostr_tracks").Doc(trackID)
+	err = s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if chosenDTag {
+			if err := s.checkNostrDTagUnusedTx(ctx, tx, pubkey, dTag, trackID); err != nil {
+				return err
+			}
+		}
+		if firebaseUID == "" {
+			return tx.Set(ref, track)
+		}
+
+		usage, err := s.getUsageTx(ctx, tx, firebaseUID)
+		if err != nil {
+			return err
+		}
+		if err := checkQuota(s.quota, usage); err != nil {
+			return err
+		}
+		if err := tx.Set(ref, track); err != nil {
+			return err
+		}
+		return s.setUsageTx(tx, firebaseUID, addUsage(usage, models.StorageUsage{Tracks: 1}))
+	})
+	if errors.Is(err, ErrQuotaExceeded) || errors.Is(err, ErrNostrDTagInUse) {
+		return nil, err
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to save track to firestore: %w", err)
 	}
@@ -69,8 +237,14 @@ func (s *NostrTrackService) CreateTrack(ctx context.Context, pubkey, firebaseUID
 }
 
 // GetTrack retrieves a track by ID
-func (s *NostrTrackService) GetTrack(ctx context.Context, trackID string) (*models.NostrTrack, error) {
+func (s *NostrTrackService) GetTrack(ctx context.Context, trackID string) (_ *models.NostrTrack, err error) {
+	ctx, span := telemetry.Start(ctx, "NostrTrackService.GetTrack", telemetry.AttributeTrackID.String(trackID))
+	defer func() { telemetry.End(span, err) }()
+
 	doc, err := s.firestoreClient.Collection("nostr_tracks").Doc(trackID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrTrackNotFound.WithCause(err)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get track: %w", err)
 	}
@@ -79,35 +253,150 @@ func (s *NostrTrackService) GetTrack(ctx context.Context, trackID string) (*mode
 	if err := doc.DataTo(&track); err != nil {
 		return nil, fmt.Errorf("failed to decode track: %w", err)
 	}
+	track.Status = track.CurrentStatus()
+
+	if err := s.loadVersions(ctx, &track); err != nil {
+		return nil, err
+	}
+	s.resolveURLs(&track)
 
 	return &track, nil
 }
 
-// GetTracksByPubkey retrieves all tracks for a given pubkey
+// GetTracksByPubkey retrieves all of a pubkey's non-deleted tracks, newest
+// first. Without IndexTracksByPubkey it falls back to an unordered query and
+// sorts in memory.
 func (s *NostrTrackService) GetTracksByPubkey(ctx context.Context, pubkey string) ([]*models.NostrTrack, error) {
-	query := s.firestoreClient.Collection("nostr_tracks").
+	docs, fellBack, err := documentsWithIndexFallback(
+		func() documentIterator { return s.tracksByPubkeyQuery(pubkey).Documents(ctx) },
+		func() documentIterator { return s.pubkeyTracksFilter(pubkey).Documents(ctx) },
+		IndexTracksByPubkey,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate tracks: %w", err)
+	}
+
+	tracks, err := s.decodeTracks(ctx, docs)
+	if err != nil {
+		return nil, err
+	}
+	if fellBack {
+		sortTracksNewestFirst(tracks)
+	}
+	return tracks, nil
+}
+
+// ListTracksByPubkey returns a page of a pubkey's tracks, newest first. The
+// returned cursor is the ID of the last track on the page and is empty when
+// there are no more results.
+func (s *NostrTrackService) ListTracksByPubkey(ctx context.Context, pubkey string, limit int, cursor string) (_ []*models.NostrTrack, _ string, err error) {
+	ctx, span := telemetry.Start(ctx, "NostrTrackService.ListTracksByPubkey", telemetry.AttributePubkey.String(pubkey))
+	defer func() { telemetry.End(span, err) }()
+
+	if limit <= 0 {
+		limit = DefaultTrackPageSize
+	}
+	if limit > MaxTrackPageSize {
+		limit = MaxTrackPageSize
+	}
+
+	query := s.tracksByPubkeyQuery(pubkey)
+	if cursor != "" {
+		cursorDoc, err := s.firestoreClient.Collection("nostr_tracks").Doc(cursor).Get(ctx)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return nil, "", ErrInvalidTrackCursor
+			}
+			return nil, "", fmt.Errorf("failed to get cursor track: %w", err)
+		}
+		// A cursor from another account would page through that account's ordering
+		if owner, _ := cursorDoc.DataAt("pubkey"); owner != pubkey {
+			return nil, "", ErrInvalidTrackCursor
+		}
+		query = query.StartAfter(cursorDoc)
+	}
+
+	// Fetch one extra document to know whether another page exists
+	tracks, err := s.listTracks(ctx, query.Limit(limit+1), IndexTracksByPubkey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if len(tracks) > limit {
+		tracks = tracks[:limit]
+		nextCursor = tracks[limit-1].ID
+	}
+
+	return tracks, nextCursor, nil
+}
+
+// ListAllTracksByPubkey retrieves every track for a pubkey, deleted ones
+// included, newest first. It backs the admin track listing.
+func (s *NostrTrackService) ListAllTracksByPubkey(ctx context.Context, pubkey string) ([]*models.NostrTrack, error) {
+	return s.listTracks(ctx, s.allTracksByPubkeyQuery(pubkey), IndexAllTracksByPubkey)
+}
+
+// GetTracksByFirebaseUID retrieves all tracks for a given Firebase UID, newest first
+func (s *NostrTrackService) GetTracksByFirebaseUID(ctx context.Context, firebaseUID string) ([]*models.NostrTrack, error) {
+	return s.listTracks(ctx, s.tracksByFirebaseUIDQuery(firebaseUID), IndexTracksByFirebaseUID)
+}
+
+// tracksByPubkeyQuery selects a pubkey's non-deleted tracks; it needs IndexTracksByPubkey
+func (s *NostrTrackService) tracksByPubkeyQuery(pubkey string) firestore.Query {
+	return s.pubkeyTracksFilter(pubkey).OrderBy("created_at", firestore.Desc)
+}
+
+// pubkeyTracksFilter selects a pubkey's non-deleted tracks in no particular
+// order; equality filters alone need no composite index
+func (s *NostrTrackService) pubkeyTracksFilter(pubkey string) firestore.Query {
+	return s.firestoreClient.Collection("nostr_tracks").
+		Where("pubkey", "==", pubkey).
+		Where("deleted", "==", false)
+}
+
+// allTracksByPubkeyQuery selects a pubkey's tracks whether or not they're
+// deleted; it needs IndexAllTracksByPubkey
+func (s *NostrTrackService) allTracksByPubkeyQuery(pubkey string) firestore.Query {
+	return s.firestoreClient.Collection("nostr_tracks").
 		Where("pubkey", "==", pubkey).
+		OrderBy("created_at", firestore.Desc)
+}
+
+// tracksByFirebaseUIDQuery selects a user's non-deleted tracks; it needs IndexTracksByFirebaseUID
+func (s *NostrTrackService) tracksByFirebaseUIDQuery(firebaseUID string) firestore.Query {
+	return s.firestoreClient.Collection("nostr_tracks").
+		Where("firebase_uid", "==", firebaseUID).
 		Where("deleted", "==", false).
 		OrderBy("created_at", firestore.Desc)
+}
 
-	iter := query.Documents(ctx)
-	defer iter.Stop()
+// listTracks runs a track query and loads each track's versions. A query
+// rejected for lack of an index fails with a MissingIndexError naming it.
+func (s *NostrTrackService) listTracks(ctx context.Context, query firestore.Query, index FirestoreIndex) ([]*models.NostrTrack, error) {
+	docs, err := readDocuments(query.Documents(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate tracks: %w", wrapIndexError(err, index))
+	}
+	return s.decodeTracks(ctx, docs)
+}
 
+// decodeTracks decodes track documents and loads each one's versions,
+// skipping documents that don't decode
+func (s *NostrTrackService) decodeTracks(ctx context.Context, docs []*firestore.DocumentSnapshot) ([]*models.NostrTrack, error) {
 	var tracks []*models.NostrTrack
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return nil, fmt.Errorf("failed to iterate tracks: %w", err)
-		}
-
+	for _, doc := range docs {
 		var track models.NostrTrack
 		if err := doc.DataTo(&track); err != nil {
 			log.Printf("Failed to decode track %s: %v", doc.Ref.ID, err)
 			continue
 		}
+		track.Status = track.CurrentStatus()
+
+		if err := s.loadVersions(ctx, &track); err != nil {
+			return nil, err
+		}
+		s.resolveURLs(&track)
 
 		tracks = append(tracks, &track)
 	}
@@ -115,65 +404,178 @@ func (s *NostrTrackService) GetTracksByPubkey(ctx context.Context, pubkey string
 	return tracks, nil
 }
 
-// GetTracksByFirebaseUID retrieves all tracks for a given Firebase UID
-func (s *NostrTrackService) GetTracksByFirebaseUID(ctx context.Context, firebaseUID string) ([]*models.NostrTrack, error) {
-	query := s.firestoreClient.Collection("nostr_tracks").
-		Where("firebase_uid", "==", firebaseUID).
-		Where("deleted", "==", false).
-		OrderBy("created_at", firestore.Desc)
+// sortTracksNewestFirst orders tracks the way IndexTracksByPubkey queries do
+func sortTracksNewestFirst(tracks []*models.NostrTrack) {
+	slices.SortStableFunc(tracks, func(a, b *models.NostrTrack) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+}
+
+// documentIterator is the part of *firestore.DocumentIterator queries are read through
+type documentIterator interface {
+	Next() (*firestore.DocumentSnapshot, error)
+	Stop()
+}
 
-	iter := query.Documents(ctx)
+// readDocuments reads every document from iter and stops it
+func readDocuments(iter documentIterator) ([]*firestore.DocumentSnapshot, error) {
 	defer iter.Stop()
 
-	var tracks []*models.NostrTrack
+	var docs []*firestore.DocumentSnapshot
 	for {
 		doc, err := iter.Next()
 		if err == iterator.Done {
-			break
+			return docs, nil
 		}
 		if err != nil {
-			return nil, fmt.Errorf("failed to iterate tracks: %w", err)
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+}
+
+// documentsWithIndexFallback reads the documents of ordered, or of unordered
+// if Firestore rejects ordered because index is missing. Other errors aren't
+// retried. fellBack reports whether unordered ran, in which case the
+// documents are in no particular order.
+func documentsWithIndexFallback(ordered, unordered func() documentIterator, index FirestoreIndex) (docs []*firestore.DocumentSnapshot, fellBack bool, err error) {
+	docs, err = readDocuments(ordered())
+	var missing *MissingIndexError
+	if err = wrapIndexError(err, index); !errors.As(err, &missing) {
+		return docs, false, err
+	}
+
+	warnMissingIndex(missing)
+	docs, err = readDocuments(unordered())
+	return docs, true, err
+}
+
+// UpdateTrack updates track metadata. The write is conditioned on the document
+// not having changed since it was read; see updateTrackWithPrecondition.
+func (s *NostrTrackService) UpdateTrack(ctx context.Context, trackID string, updates map[string]interface{}) (err error) {
+	ctx, span := telemetry.Start(ctx, "NostrTrackService.UpdateTrack", telemetry.AttributeTrackID.String(trackID))
+	defer func() { telemetry.End(span, err) }()
+
+	return s.updateTrackWithPrecondition(ctx, trackID, func(track *models.NostrTrack) ([]firestore.Update, error) {
+		var updatePaths []firestore.Update
+		for path, value := range updates {
+			if path == "updated_at" {
+				continue
+			}
+			updatePaths = append(updatePaths, firestore.Update{Path: path, Value: value})
+		}
+		if len(updatePaths) == 0 {
+			return nil, nil
+		}
+		// Fields written here no longer come from the file's tags
+		return append(updatePaths, embeddedTagOverrides(track, updates)...), nil
+	})
+}
+
+// embeddedTagOverrides returns the update removing the fields updates write
+// from the track's embedded_tags, so a value set by any source other than the
+// tags is kept by later processing runs
+func embeddedTagOverrides(track *models.NostrTrack, updates map[string]interface{}) []firestore.Update {
+	remaining := slices.DeleteFunc(slices.Clone(track.EmbeddedTags), func(field string) bool {
+		_, written := updates[field]
+		return written
+	})
+	switch {
+	case len(remaining) == len(track.EmbeddedTags):
+		return nil
+	case len(remaining) == 0:
+		return []firestore.Update{{Path: "embedded_tags", Value: firestore.Delete}}
+	default:
+		return []firestore.Update{{Path: "embedded_tags", Value: remaining}}
+	}
+}
+
+// updateTrackWithPrecondition reads the track, builds updates from it and writes
+// them only if the document's update time is unchanged. On conflict the read and
+// build are retried once; a second conflict returns ErrTrackUpdateConflict.
+// updated_at is always set. A build that returns no updates skips the write.
+func (s *NostrTrackService) updateTrackWithPrecondition(ctx context.Context, trackID string, build func(track *models.NostrTrack) ([]firestore.Update, error)) error {
+	ref := s.firestoreClient.Collection("nostr_tracks").Doc(trackID)
+
+	for attempt := 0; attempt < 2; attempt++ {
+		doc, err := ref.Get(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get track: %w", err)
 		}
 
 		var track models.NostrTrack
 		if err := doc.DataTo(&track); err != nil {
-			log.Printf("Failed to decode track %s: %v", doc.Ref.ID, err)
-			continue
+			return fmt.Errorf("failed to decode track: %w", err)
 		}
 
-		tracks = append(tracks, &track)
+		updates, err := build(&track)
+		if err != nil {
+			return err
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		updates = append(updates, firestore.Update{Path: "updated_at", Value: time.Now()})
+
+		_, err = ref.Update(ctx, updates, firestore.LastUpdateTime(doc.UpdateTime))
+		if err == nil {
+			s.publishStatus(trackID, &track, updates)
+			return nil
+		}
+		if !isPreconditionConflict(err) {
+			return fmt.Errorf("failed to update track: %w", err)
+		}
+
+		log.Printf("Conflicting update for track %s (attempt %d)", trackID, attempt+1)
 	}
 
-	return tracks, nil
+	return ErrTrackUpdateConflict
 }
 
-// UpdateTrack updates track metadata
-func (s *NostrTrackService) UpdateTrack(ctx context.Context, trackID string, updates map[string]interface{}) error {
-	updates["updated_at"] = time.Now()
-
-	var updatePaths []firestore.Update
-	for path, value := range updates {
-		updatePaths = append(updatePaths, firestore.Update{Path: path, Value: value})
+// publishStatus sends a status event for an update that changed the track's
+// status or error
+func (s *NostrTrackService) publishStatus(trackID string, track *models.NostrTrack, updates []firestore.Update) {
+	if !s.events.hasSubscribers(trackID) {
+		return
 	}
 
-	_, err := s.firestoreClient.Collection("nostr_tracks").Doc(trackID).Update(ctx, updatePaths)
-	if err != nil {
-		return fmt.Errorf("failed to update track: %w", err)
+	event := models.TrackEvent{
+		Type:    models.TrackEventStatus,
+		TrackID: trackID,
+		Status:  track.CurrentStatus(),
+		Error:   track.Error,
+	}
+	changed := false
+	for _, update := range updates {
+		switch update.Path {
+		case "status":
+			event.Status, _ = update.Value.(string)
+			changed = true
+		case "error":
+			event.Error, _ = update.Value.(string)
+			changed = true
+		}
 	}
+	if changed {
+		s.events.Publish(event)
+	}
+}
 
-	return nil
+// isPreconditionConflict reports whether a write failed because the document
+// changed since it was read
+func isPreconditionConflict(err error) bool {
+	code := status.Code(err)
+	return code == codes.FailedPrecondition || code == codes.Aborted
 }
 
-// MarkTrackAsProcessed updates track status after processing
+// MarkTrackAsProcessed marks a track ready after processing
 func (s *NostrTrackService) MarkTrackAsProcessed(ctx context.Context, trackID string, size int64, duration int) error {
 	updates := map[string]interface{}{
-		"is_processing": false,
-		"size":          size,
-		"duration":      duration,
-		"updated_at":    time.Now(),
+		"size":     size,
+		"duration": duration,
 	}
 
-	return s.UpdateTrack(ctx, trackID, updates)
+	return s.TransitionTrack(ctx, trackID, models.TrackStatusReady, updates)
 }
 
 // MarkTrackAsCompressed updates track with compressed file info
@@ -181,20 +583,85 @@ func (s *NostrTrackService) MarkTrackAsCompressed(ctx context.Context, trackID,
 	updates := map[string]interface{}{
 		"compressed_url": compressedURL,
 		"is_compressed":  true,
-		"updated_at":     time.Now(),
 	}
 
 	return s.UpdateTrack(ctx, trackID, updates)
 }
 
-// DeleteTrack soft deletes a track
-func (s *NostrTrackService) DeleteTrack(ctx context.Context, trackID string) error {
-	updates := map[string]interface{}{
-		"deleted":    true,
-		"updated_at": time.Now(),
+// MarkOriginalDeleted flags a track whose original storage reported deleted,
+// so the drift from the bucket shows. The deletion is checked first: an
+// original that was overwritten still exists, and one removed by a purge is
+// expected, so neither is flagged. It reports whether the track was flagged.
+func (s *NostrTrackService) MarkOriginalDeleted(ctx context.Context, trackID string) (bool, error) {
+	track, err := s.GetTrack(ctx, trackID)
+	if err != nil {
+		return false, err
+	}
+	if track.FilesPurgedAt != nil || track.OriginalDeletedAt != nil {
+		return false, nil
 	}
 
-	return s.UpdateTrack(ctx, trackID, updates)
+	_, err = s.StorageFor(track).GetObjectMetadata(ctx, s.pathConfig.GetOriginalPath(track.ID, track.Extension))
+	switch {
+	case err == nil:
+		return false, nil
+	case !errors.Is(err, storage.ErrObjectNotExist):
+		return false, fmt.Errorf("failed to check original: %w", err)
+	}
+
+	if err := s.UpdateTrack(ctx, trackID, map[string]interface{}{"original_deleted_at": time.Now()}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DeleteTrack soft deletes a track, which stops it counting toward its owner's
+// usage. A track that hasn't finished processing is also cancelled.
+func (s *NostrTrackService) DeleteTrack(ctx context.Context, trackID string) (err error) {
+	ctx, span := telemetry.Start(ctx, "NostrTrackService.DeleteTrack", telemetry.AttributeTrackID.String(trackID))
+	defer func() { telemetry.End(span, err) }()
+
+	return s.updateTrackWithUsage(ctx, trackID, func(track *models.NostrTrack) ([]firestore.Update, models.StorageUsage, error) {
+		updates := []firestore.Update{{Path: "deleted", Value: true}}
+		if !IsTerminalTrackStatus(track.CurrentStatus()) {
+			updates = append(updates, statusUpdates(models.TrackStatusCancelled, time.Now())...)
+		}
+		if track.Deleted {
+			return updates, models.StorageUsage{}, nil
+		}
+		return updates, models.StorageUsage{Tracks: -1, Bytes: -track.Size}, nil
+	})
+}
+
+// RecordPublication stores the published event's details on the track
+func (s *NostrTrackService) RecordPublication(ctx context.Context, trackID string, event *gonostr.Event, relays []string) (*models.NostrTrack, error) {
+	if relays == nil {
+		relays = []string{}
+	}
+
+	if err := s.UpdateTrack(ctx, trackID, publicationUpdates(event, relays, time.Now())); err != nil {
+		return nil, err
+	}
+
+	return s.GetTrack(ctx, trackID)
+}
+
+// publicationUpdates are the track fields recording that event was published
+// to relays
+func publicationUpdates(event *gonostr.Event, relays []string, publishedAt time.Time) map[string]interface{} {
+	updates := map[string]interface{}{
+		"is_published":   true,
+		"nostr_event_id": event.ID,
+		"nostr_kind":     event.Kind,
+		"nostr_d_tag":    event.Tags.GetD(),
+		"nostr_relays":   relays,
+		"published_at":   publishedAt,
+	}
+	// The event's title and artist tags are what listeners search by
+	for path, value := range searchFieldUpdates(eventTagValue(event, "title"), eventTagValue(event, "artist", "creator")) {
+		updates[path] = value
+	}
+	return updates
 }
 
 // HardDeleteTrack permanently deletes a track and its files
@@ -205,21 +672,44 @@ func (s *NostrTrackService) HardDeleteTrack(ctx context.Context, trackID string)
 		return fmt.Errorf("failed to get track for deletion: %w", err)
 	}
 
-	// Delete files from storage using path configuration
-	originalObjectName := s.pathConfig.GetOriginalPath(trackID, track.Extension)
-	if err := s.storageService.DeleteObject(ctx, originalObjectName); err != nil {
-		log.Printf("Failed to delete original file for track %s: %v", trackID, err)
-	}
+	// Delete files from the track's storage region; failures are logged and
+	// leave the objects behind
+	s.deleteTrackObjects(ctx, track, s.trackObjectNames(track))
 
-	if track.CompressedURL != "" {
-		compressedObjectName := s.pathConfig.GetCompressedPath(trackID)
-		if err := s.storageService.DeleteObject(ctx, compressedObjectName); err != nil {
-			log.Printf("Failed to delete compressed file for track %s: %v", trackID, err)
+	// Delete version and history documents; Firestore doesn't remove
+	// subcollections with their parent
+	ref := s.firestoreClient.Collection("nostr_tracks").Doc(trackID)
+	for _, subcollection := range []string{trackVersionsCollection, trackHistoryCollection, trackShareLinksCollection} {
+		docRefs, err := ref.Collection(subcollection).DocumentRefs(ctx).GetAll()
+		if err != nil {
+			return fmt.Errorf("failed to list track %s: %w", subcollection, err)
+		}
+		for _, docRef := range docRefs {
+			if _, err := docRef.Delete(ctx); err != nil {
+				return fmt.Errorf("failed to delete track %s document %s: %w", subcollection, docRef.ID, err)
+			}
 		}
 	}
 
-	// Delete from Firestore
-	_, err = s.firestoreClient.Collection("nostr_tracks").Doc(trackID).Delete(ctx)
+	// Delete from Firestore, removing a live track from its owner's usage
+	err = s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		track, err := getTrackTx(tx, ref)
+		if err != nil {
+			return err
+		}
+		if track.FirebaseUID == "" || track.Deleted {
+			return tx.Delete(ref)
+		}
+
+		usage, err := s.getUsageTx(ctx, tx, track.FirebaseUID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(ref); err != nil {
+			return err
+		}
+		return s.setUsageTx(tx, track.FirebaseUID, addUsage(usage, models.StorageUsage{Tracks: -1, Bytes: -track.Size}))
+	})
 	if err != nil {
 		return fmt.Errorf("failed to delete track from firestore: %w", err)
 	}
@@ -228,67 +718,219 @@ func (s *NostrTrackService) HardDeleteTrack(ctx context.Context, trackID string)
 	return nil
 }
 
-// UpdateCompressionVisibility updates which compression versions are public
+// UpdateCompressionVisibility updates which compression versions are public.
+// Only the affected version documents are written; unknown version IDs are ignored.
 func (s *NostrTrackService) UpdateCompressionVisibility(ctx context.Context, trackID string, updates []models.VersionUpdate) error {
-	// Get current track
-	track, err := s.GetTrack(ctx, trackID)
-	if err != nil {
-		return fmt.Errorf("failed to get track: %w", err)
-	}
+	trackRef := s.firestoreClient.Collection("nostr_tracks").Doc(trackID)
+
+	err := s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		track, err := getTrackTx(tx, trackRef)
+		if err != nil {
+			return err
+		}
 
-	// Update visibility for specified versions
-	for i, version := range track.CompressionVersions {
+		if !track.VersionsMigrated {
+			// Apply the change to the embedded array and migrate it in one go
+			for i, version := range track.CompressionVersions {
+				for _, update := range updates {
+					if version.ID == update.VersionID {
+						track.CompressionVersions[i].IsPublic = update.IsPublic
+						break
+					}
+				}
+			}
+			trackUpdates, err := migrateVersionsTx(tx, trackRef, track)
+			if err != nil {
+				return err
+			}
+			return tx.Update(trackRef, trackUpdates)
+		}
+
+		var versionRefs []*firestore.DocumentRef
 		for _, update := range updates {
-			if version.ID == update.VersionID {
-				track.CompressionVersions[i].IsPublic = update.IsPublic
-				break
+			versionRefs = append(versionRefs, trackRef.Collection(trackVersionsCollection).Doc(update.VersionID))
+		}
+		if len(versionRefs) == 0 {
+			return nil
+		}
+		versionDocs, err := tx.GetAll(versionRefs)
+		if err != nil {
+			return fmt.Errorf("failed to get track versions: %w", err)
+		}
+
+		for i, versionDoc := range versionDocs {
+			if !versionDoc.Exists() {
+				continue
+			}
+			if err := tx.Update(versionDoc.Ref, []firestore.Update{
+				{Path: "is_public", Value: updates[i].IsPublic},
+			}); err != nil {
+				return fmt.Errorf("failed to update track version: %w", err)
 			}
 		}
-	}
 
-	// Save updated track
-	_, err = s.firestoreClient.Collection("nostr_tracks").Doc(trackID).Set(ctx, track)
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to update track: %w", err)
+		if isPreconditionConflict(err) {
+			return ErrTrackUpdateConflict
+		}
+		return err
 	}
 
 	log.Printf("Updated compression visibility for track %s", trackID)
 	return nil
 }
 
-// AddCompressionVersion adds a new compression version to a track
+// AddCompressionVersion adds a new compression version to a track, replacing
+// any existing version with the same ID
 func (s *NostrTrackService) AddCompressionVersion(ctx context.Context, trackID string, version models.CompressionVersion) error {
-	// Get current track
-	track, err := s.GetTrack(ctx, trackID)
+	trackRef := s.firestoreClient.Collection("nostr_tracks").Doc(trackID)
+	versionRef := trackRef.Collection(trackVersionsCollection).Doc(version.ID)
+
+	replaced := false
+	err := s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		replaced = false
+
+		track, err := getTrackTx(tx, trackRef)
+		if err != nil {
+			return err
+		}
+
+		var trackUpdates []firestore.Update
+		if track.VersionsMigrated {
+			existing, err := tx.Get(versionRef)
+			if err != nil && status.Code(err) != codes.NotFound {
+				return fmt.Errorf("failed to get track version: %w", err)
+			}
+			replaced = err == nil && existing.Exists()
+		} else {
+			for _, existing := range track.CompressionVersions {
+				if existing.ID == version.ID {
+					replaced = true
+					break
+				}
+			}
+			// The version being added is written below, so skip it during migration
+			trackUpdates, err = migrateVersionsTx(tx, trackRef, track, version.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Set(versionRef, version); err != nil {
+			return fmt.Errorf("failed to save track version: %w", err)
+		}
+
+		if !replaced {
+			// Clear pending flag
+			trackUpdates = append(trackUpdates,
+				firestore.Update{Path: "has_pending_compression", Value: false},
+				firestore.Update{Path: "updated_at", Value: time.Now()},
+			)
+		}
+		if len(trackUpdates) == 0 {
+			return nil
+		}
+
+		if err := tx.Update(trackRef, trackUpdates); err != nil {
+			return fmt.Errorf("failed to update track: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to get track: %w", err)
+		if isPreconditionConflict(err) {
+			return ErrTrackUpdateConflict
+		}
+		return err
 	}
 
-	// Check if version with same ID already exists
-	for i, existing := range track.CompressionVersions {
-		if existing.ID == version.ID {
-			// Update existing version
-			track.CompressionVersions[i] = version
-			log.Printf("Updated existing compression version %s for track %s", version.ID, trackID)
+	if replaced {
+		log.Printf("Updated existing compression version %s for track %s", version.ID, trackID)
+	} else {
+		log.Printf("Added compression version %s for track %s", version.ID, trackID)
+	}
 
-			// Save updated track
-			_, err = s.firestoreClient.Collection("nostr_tracks").Doc(trackID).Set(ctx, track)
-			return err
+	s.events.Publish(models.TrackEvent{
+		Type:    models.TrackEventVersion,
+		TrackID: trackID,
+		Version: &version,
+	})
+	return nil
+}
+
+// loadVersions fills CompressionVersions from the versions subcollection for
+// migrated tracks. Unmigrated tracks keep their embedded array.
+func (s *NostrTrackService) loadVersions(ctx context.Context, track *models.NostrTrack) error {
+	if !track.VersionsMigrated {
+		return nil
+	}
+
+	iter := s.firestoreClient.Collection("nostr_tracks").Doc(track.ID).
+		Collection(trackVersionsCollection).
+		OrderBy("created_at", firestore.Asc).
+		Documents(ctx)
+	defer iter.Stop()
+
+	versions := []models.CompressionVersion{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to iterate track versions: %w", err)
+		}
+
+		var version models.CompressionVersion
+		if err := doc.DataTo(&version); err != nil {
+			log.Printf("Failed to decode version %s of track %s: %v", doc.Ref.ID, track.ID, err)
+			continue
 		}
+		versions = append(versions, version)
 	}
 
-	// Add new version
-	track.CompressionVersions = append(track.CompressionVersions, version)
-	track.HasPendingCompression = false // Clear pending flag
+	track.CompressionVersions = versions
+	return nil
+}
 
-	// Save updated track
-	_, err = s.firestoreClient.Collection("nostr_tracks").Doc(trackID).Set(ctx, track)
+// getTrackTx reads and decodes a track inside a transaction
+func getTrackTx(tx *firestore.Transaction, trackRef *firestore.DocumentRef) (*models.NostrTrack, error) {
+	doc, err := tx.Get(trackRef)
 	if err != nil {
-		return fmt.Errorf("failed to update track: %w", err)
+		return nil, fmt.Errorf("failed to get track: %w", err)
 	}
 
-	log.Printf("Added compression version %s for track %s", version.ID, trackID)
-	return nil
+	var track models.NostrTrack
+	if err := doc.DataTo(&track); err != nil {
+		return nil, fmt.Errorf("failed to decode track: %w", err)
+	}
+
+	return &track, nil
+}
+
+// migrateVersionsTx copies a track's embedded versions into the versions
+// subcollection and returns the track updates that remove the embedded array.
+// The caller applies them so the track document is written once per commit.
+// skipIDs name versions the caller writes itself in the same transaction.
+func migrateVersionsTx(tx *firestore.Transaction, trackRef *firestore.DocumentRef, track *models.NostrTrack, skipIDs ...string) ([]firestore.Update, error) {
+	for _, version := range track.CompressionVersions {
+		if version.ID == "" {
+			version.ID = uuid.New().String()
+		}
+		if slices.Contains(skipIDs, version.ID) {
+			continue
+		}
+		if err := tx.Set(trackRef.Collection(trackVersionsCollection).Doc(version.ID), version); err != nil {
+			return nil, fmt.Errorf("failed to migrate track version %s: %w", version.ID, err)
+		}
+	}
+
+	log.Printf("Migrating %d compression versions for track %s to subcollection", len(track.CompressionVersions), track.ID)
+	return []firestore.Update{
+		{Path: "compression_versions", Value: firestore.Delete},
+		{Path: "versions_migrated", Value: true},
+	}, nil
 }
 
 // SetPendingCompression marks a track as having pending compression requests
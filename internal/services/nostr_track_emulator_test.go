@@ -0,0 +1,936 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+	"github.com/wavlake/api/internal/models"
+)
+
+// NostrTrackEmulatorTestSuite exercises Firestore preconditions and track
+// listings against the emulator. The emulator doesn't enforce composite
+// indexes; indexes_test.go checks the queries against RequiredIndexes instead.
+// Run with FIRESTORE_EMULATOR_HOST set, e.g.:
+//
+//	gcloud emulators firestore start --host-port=localhost:8081
+//	FIRESTORE_EMULATOR_HOST=localhost:8081 go test ./internal/services/...
+type NostrTrackEmulatorTestSuite struct {
+	suite.Suite
+	ctx     context.Context
+	client  *firestore.Client
+	service *NostrTrackService
+	trackID string
+}
+
+func (suite *NostrTrackEmulatorTestSuite) SetupSuite() {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		suite.T().Skip("FIRESTORE_EMULATOR_HOST not set, skipping emulator tests")
+	}
+
+	suite.ctx = context.Background()
+	client, err := firestore.NewClient(suite.ctx, "wavlake-test")
+	suite.Require().NoError(err)
+	suite.client = client
+	suite.service = NewNostrTrackService(client, nil)
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TearDownSuite() {
+	if suite.client != nil {
+		suite.client.Close()
+	}
+}
+
+func (suite *NostrTrackEmulatorTestSuite) SetupTest() {
+	suite.trackID = uuid.New().String()
+	_, err := suite.client.Collection("nostr_tracks").Doc(suite.trackID).Set(suite.ctx, models.NostrTrack{
+		ID:           suite.trackID,
+		Pubkey:       "test-pubkey",
+		IsProcessing: true,
+		CompressionVersions: []models.CompressionVersion{
+			{ID: "v1", Format: "mp3", IsPublic: false},
+		},
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	})
+	suite.Require().NoError(err)
+}
+
+// concurrentWrite changes the track between the read and the conditional write
+func (suite *NostrTrackEmulatorTestSuite) concurrentWrite() {
+	_, err := suite.client.Collection("nostr_tracks").Doc(suite.trackID).Update(suite.ctx, []firestore.Update{
+		{Path: "has_pending_compression", Value: true},
+	})
+	suite.Require().NoError(err)
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestUpdateTrack() {
+	err := suite.service.UpdateTrack(suite.ctx, suite.trackID, map[string]interface{}{"is_processing": false})
+	suite.Require().NoError(err)
+
+	track, err := suite.service.GetTrack(suite.ctx, suite.trackID)
+	suite.Require().NoError(err)
+	suite.False(track.IsProcessing)
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestConflictRetriesOnce() {
+	attempts := 0
+	err := suite.service.updateTrackWithPrecondition(suite.ctx, suite.trackID, func(track *models.NostrTrack) ([]firestore.Update, error) {
+		attempts++
+		if attempts == 1 {
+			suite.concurrentWrite()
+		}
+		return []firestore.Update{{Path: "is_processing", Value: false}}, nil
+	})
+	suite.Require().NoError(err)
+	suite.Equal(2, attempts)
+
+	// The retry re-read the document, so the concurrent write is preserved
+	track, err := suite.service.GetTrack(suite.ctx, suite.trackID)
+	suite.Require().NoError(err)
+	suite.False(track.IsProcessing)
+	suite.True(track.HasPendingCompression)
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestPersistentConflictReturnsError() {
+	attempts := 0
+	err := suite.service.updateTrackWithPrecondition(suite.ctx, suite.trackID, func(track *models.NostrTrack) ([]firestore.Update, error) {
+		attempts++
+		suite.concurrentWrite()
+		return []firestore.Update{{Path: "is_processing", Value: false}}, nil
+	})
+	suite.True(errors.Is(err, ErrTrackUpdateConflict))
+	suite.Equal(2, attempts)
+
+	track, err := suite.service.GetTrack(suite.ctx, suite.trackID)
+	suite.Require().NoError(err)
+	suite.True(track.IsProcessing)
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestUpdateCompressionVisibility() {
+	err := suite.service.UpdateCompressionVisibility(suite.ctx, suite.trackID, []models.VersionUpdate{
+		{VersionID: "v1", IsPublic: true},
+	})
+	suite.Require().NoError(err)
+
+	track, err := suite.service.GetTrack(suite.ctx, suite.trackID)
+	suite.Require().NoError(err)
+	suite.Require().Len(track.CompressionVersions, 1)
+	suite.True(track.CompressionVersions[0].IsPublic)
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestLazyVersionMigration() {
+	// The fixture stores v1 in the embedded array; the first write migrates it
+	err := suite.service.AddCompressionVersion(suite.ctx, suite.trackID, models.CompressionVersion{
+		ID: "v2", Format: "aac", CreatedAt: time.Now(),
+	})
+	suite.Require().NoError(err)
+
+	doc, err := suite.client.Collection("nostr_tracks").Doc(suite.trackID).Get(suite.ctx)
+	suite.Require().NoError(err)
+	_, err = doc.DataAt("compression_versions")
+	suite.Error(err, "embedded array should be removed after migration")
+	migrated, err := doc.DataAt("versions_migrated")
+	suite.Require().NoError(err)
+	suite.Equal(true, migrated)
+
+	track, err := suite.service.GetTrack(suite.ctx, suite.trackID)
+	suite.Require().NoError(err)
+	suite.ElementsMatch([]string{"v1", "v2"}, versionIDs(track))
+	suite.False(track.HasPendingCompression)
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestConcurrentAddCompressionVersion() {
+	const writers = 5
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- suite.service.AddCompressionVersion(suite.ctx, suite.trackID, models.CompressionVersion{
+				ID: fmt.Sprintf("concurrent-%d", i), Format: "mp3", CreatedAt: time.Now(),
+			})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		suite.NoError(err)
+	}
+
+	// No writer clobbers another's version
+	track, err := suite.service.GetTrack(suite.ctx, suite.trackID)
+	suite.Require().NoError(err)
+	suite.Len(track.CompressionVersions, writers+1)
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestConcurrentVisibilityAndVersionWrites() {
+	// Migrate first so the writes below touch separate version documents
+	suite.Require().NoError(suite.service.AddCompressionVersion(suite.ctx, suite.trackID, models.CompressionVersion{
+		ID: "v2", Format: "aac", CreatedAt: time.Now(),
+	}))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		suite.NoError(suite.service.UpdateCompressionVisibility(suite.ctx, suite.trackID, []models.VersionUpdate{
+			{VersionID: "v1", IsPublic: true},
+		}))
+	}()
+	go func() {
+		defer wg.Done()
+		suite.NoError(suite.service.AddCompressionVersion(suite.ctx, suite.trackID, models.CompressionVersion{
+			ID: "v2", Format: "aac", Size: 1234, CreatedAt: time.Now(),
+		}))
+	}()
+	wg.Wait()
+
+	track, err := suite.service.GetTrack(suite.ctx, suite.trackID)
+	suite.Require().NoError(err)
+	for _, version := range track.CompressionVersions {
+		switch version.ID {
+		case "v1":
+			suite.True(version.IsPublic)
+		case "v2":
+			suite.Equal(int64(1234), version.Size)
+		}
+	}
+}
+
+// seedPubkeyTracks creates count tracks for a fresh pubkey, one minute apart,
+// plus a deleted track that listings must skip. IDs are returned newest first.
+func (suite *NostrTrackEmulatorTestSuite) TestOutOfOrderVersionReports() {
+	report := func(id, status string) {
+		_, err := suite.service.AddOrUpdateCompressionVersion(suite.ctx, suite.trackID, models.CompressionVersion{ID: id, Format: "mp3", Status: status})
+		suite.Require().NoError(err)
+	}
+	pending := func() bool {
+		track, err := suite.service.GetTrack(suite.ctx, suite.trackID)
+		suite.Require().NoError(err)
+		return track.HasPendingCompression
+	}
+
+	report("v2", models.VersionStatusPending)
+	report("v3", models.VersionStatusPending)
+	suite.True(pending())
+
+	// v3 completes before its processing report arrives, and v2 fails
+	report("v3", models.VersionStatusCompleted)
+	report("v3", models.VersionStatusProcessing)
+	suite.True(pending(), "v2 is still pending")
+	report("v2", models.VersionStatusFailed)
+	suite.False(pending())
+
+	track, err := suite.service.GetTrack(suite.ctx, suite.trackID)
+	suite.Require().NoError(err)
+	statuses := map[string]string{}
+	for _, version := range track.CompressionVersions {
+		statuses[version.ID] = version.Status
+	}
+	suite.Equal(map[string]string{"v1": "", "v2": models.VersionStatusFailed, "v3": models.VersionStatusCompleted}, statuses)
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestRecordCompressedObject() {
+	_, err := suite.service.AddOrUpdateCompressionVersion(suite.ctx, suite.trackID, models.CompressionVersion{
+		ID: "v2", Format: "mp3", URL: "https://storage.example.com/v2.mp3", Status: models.VersionStatusProcessing,
+	})
+	suite.Require().NoError(err)
+
+	version, err := suite.service.RecordCompressedObject(suite.ctx, suite.trackID, "v2", 2048)
+	suite.Require().NoError(err)
+	suite.Equal(models.VersionStatusCompleted, version.Status)
+	suite.Equal(int64(2048), version.Size)
+	suite.Equal("https://storage.example.com/v2.mp3", version.URL)
+
+	_, err = suite.service.RecordCompressedObject(suite.ctx, suite.trackID, "v9", 2048)
+	suite.ErrorIs(err, ErrVersionNotFound)
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestBatchVersionReports() {
+	for _, id := range []string{"v2", "v3"} {
+		_, err := suite.service.AddOrUpdateCompressionVersion(suite.ctx, suite.trackID, models.CompressionVersion{ID: id, Format: "mp3", Status: models.VersionStatusPending})
+		suite.Require().NoError(err)
+	}
+
+	stored, err := suite.service.AddOrUpdateCompressionVersions(suite.ctx, suite.trackID, []models.CompressionVersion{
+		{ID: "v2", Status: models.VersionStatusCompleted, URL: "https://example.com/v2.mp3", Size: 1234, Hash: "abc123"},
+		{ID: "v3", Status: models.VersionStatusFailed, Error: "compression failed"},
+	})
+	suite.Require().NoError(err)
+	suite.Require().Len(stored, 2)
+	suite.Equal("abc123", stored[0].Hash)
+	suite.Equal("compression failed", stored[1].Error)
+
+	track, err := suite.service.GetTrack(suite.ctx, suite.trackID)
+	suite.Require().NoError(err)
+	suite.False(track.HasPendingCompression)
+	for _, version := range track.CompressionVersions {
+		switch version.ID {
+		case "v2":
+			suite.Equal(models.VersionStatusCompleted, version.Status)
+			suite.Equal(int64(1234), version.Size)
+		case "v3":
+			suite.Equal(models.VersionStatusFailed, version.Status)
+		}
+	}
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestConcurrentReserveCompressionVersions() {
+	const requests = 4
+	option := CompressionPresets["high"]
+
+	var wg sync.WaitGroup
+	results := make(chan *models.CompressionRequestResult, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := suite.service.ReserveCompressionVersions(suite.ctx, suite.trackID, []models.CompressionOption{option}, time.Now().Add(-time.Hour))
+			suite.NoError(err)
+			results <- result
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	// Exactly one request queues the version; the others see it pending
+	queued := 0
+	for result := range results {
+		if result != nil {
+			queued += len(result.Queued)
+		}
+	}
+	suite.Equal(1, queued)
+
+	track, err := suite.service.GetTrack(suite.ctx, suite.trackID)
+	suite.Require().NoError(err)
+	suite.Len(track.CompressionVersions, 2)
+	suite.True(track.HasPendingCompression)
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestBulkCompressionReservesVersions() {
+	// The seeded track has one version, so a limit of two leaves room for one
+	service := NewNostrTrackService(suite.client, nil, WithMaxCompressionVersions(2))
+	processing := NewProcessingService(service, nil, nil, nil, suite.T().TempDir())
+	encoder := &boundedEncoder{}
+	processing.compress = encoder.compress
+	bulk := NewBulkCompressionService(suite.client, service, processing)
+
+	planned := models.BulkCompressionTrack{TrackID: suite.trackID, Options: []models.CompressionOption{CompressionPresets["high"]}}
+	suite.Require().NoError(bulk.compressTrack(planned))
+
+	// A repeat finds the version already made, and going past the limit fails
+	suite.Require().NoError(bulk.compressTrack(planned))
+	planned.Options = []models.CompressionOption{CompressionPresets["aac-high"]}
+	suite.ErrorIs(bulk.compressTrack(planned), ErrTooManyCompressionVersions)
+
+	track, err := service.GetTrack(suite.ctx, suite.trackID)
+	suite.Require().NoError(err)
+	suite.Len(track.CompressionVersions, 2)
+	suite.False(track.HasPendingCompression)
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestCancelledCompressionFailsReservedVersions() {
+	processing := NewProcessingService(suite.service, nil, nil, nil, suite.T().TempDir())
+	processing.compress = func(ctx context.Context, track *models.NostrTrack, versionID string, option models.CompressionOption) (*models.CompressionVersion, error) {
+		return nil, ErrProcessingCancelled
+	}
+
+	result, err := suite.service.ReserveCompressionVersions(suite.ctx, suite.trackID, []models.CompressionOption{CompressionPresets["high"]}, time.Now().Add(-time.Hour))
+	suite.Require().NoError(err)
+	suite.Require().Len(result.Queued, 1)
+	suite.Require().NoError(processing.processReservedCompressions(suite.ctx, suite.trackID, result.Queued))
+
+	track, err := suite.service.GetTrack(suite.ctx, suite.trackID)
+	suite.Require().NoError(err)
+	suite.False(track.HasPendingCompression)
+	for _, version := range track.CompressionVersions {
+		if version.ID == result.Queued[0].VersionID {
+			suite.Equal(models.VersionStatusFailed, version.Status)
+		}
+	}
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestReplacedTrackReplansVersions() {
+	local, err := NewLocalStorageService(suite.T().TempDir(), "http://localhost:8080", []byte("test-secret"))
+	suite.Require().NoError(err)
+	service := NewNostrTrackService(suite.client, NewStorageRegions("us", local))
+
+	option := CompressionPresets["high"]
+	suite.Require().NoError(service.AddCompressionVersion(suite.ctx, suite.trackID, models.CompressionVersion{
+		ID: "v2", Format: option.Format, Bitrate: option.Bitrate, Status: models.VersionStatusCompleted,
+		IsPublic: true, Options: option, CreatedAt: time.Now(),
+	}))
+	_, err = suite.client.Collection("nostr_tracks").Doc(suite.trackID).Update(suite.ctx, []firestore.Update{
+		{Path: "status", Value: models.TrackStatusReady},
+		{Path: "is_processing", Value: false},
+		{Path: "has_pending_compression", Value: true},
+	})
+	suite.Require().NoError(err)
+
+	result, err := service.ReserveCompressionVersions(suite.ctx, suite.trackID, []models.CompressionOption{option}, time.Now().Add(-time.Hour))
+	suite.Require().NoError(err)
+	suite.Len(result.Existing, 1)
+
+	_, err = service.RenewUploadURL(suite.ctx, suite.trackID, true)
+	suite.Require().NoError(err)
+
+	track, err := service.GetTrack(suite.ctx, suite.trackID)
+	suite.Require().NoError(err)
+	suite.Equal(models.TrackStatusPendingUpload, track.Status)
+	suite.Empty(track.CompressionVersions, "versions of the old file should be gone")
+	suite.False(track.HasPendingCompression)
+
+	// The new file's versions are encoded rather than reported as existing
+	result, err = service.ReserveCompressionVersions(suite.ctx, suite.trackID, []models.CompressionOption{option}, time.Now().Add(-time.Hour))
+	suite.Require().NoError(err)
+	suite.Len(result.Queued, 1)
+	suite.Empty(result.Existing)
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestTransitionTrack() {
+	// The seeded track predates status and derives processing from is_processing
+	track, err := suite.service.GetTrack(suite.ctx, suite.trackID)
+	suite.Require().NoError(err)
+	suite.Equal(models.TrackStatusProcessing, track.Status)
+
+	err = suite.service.TransitionTrack(suite.ctx, suite.trackID, models.TrackStatusReady, map[string]interface{}{"duration": 42})
+	suite.Require().NoError(err)
+
+	track, err = suite.service.GetTrack(suite.ctx, suite.trackID)
+	suite.Require().NoError(err)
+	suite.Equal(models.TrackStatusReady, track.Status)
+	suite.False(track.IsProcessing)
+	suite.Equal(42, track.Duration)
+	suite.Contains(track.StatusTimestamps, models.TrackStatusReady)
+
+	err = suite.service.TransitionTrack(suite.ctx, suite.trackID, models.TrackStatusProcessing, nil)
+	suite.True(errors.Is(err, ErrInvalidStatusTransition))
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestConcurrentClaimTrackForProcessing() {
+	_, err := suite.client.Collection("nostr_tracks").Doc(suite.trackID).Update(suite.ctx, []firestore.Update{
+		{Path: "status", Value: models.TrackStatusUploaded},
+	})
+	suite.Require().NoError(err)
+
+	// Two upload triggers for the same file race to start processing
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = suite.service.ClaimTrackForProcessing(suite.ctx, suite.trackID)
+		}(i)
+	}
+	wg.Wait()
+
+	claimed := 0
+	for _, err := range errs {
+		if err == nil {
+			claimed++
+			continue
+		}
+		suite.ErrorIs(err, ErrTrackAlreadyProcessing)
+	}
+	suite.Equal(1, claimed)
+
+	track, err := suite.service.GetTrack(suite.ctx, suite.trackID)
+	suite.Require().NoError(err)
+	suite.Equal(models.TrackStatusProcessing, track.Status)
+
+	suite.Require().NoError(suite.service.TransitionTrack(suite.ctx, suite.trackID, models.TrackStatusReady, nil))
+	suite.ErrorIs(suite.service.ClaimTrackForProcessing(suite.ctx, suite.trackID), ErrTrackAlreadyProcessed)
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestReclaimTrackForProcessing() {
+	_, err := suite.client.Collection("nostr_tracks").Doc(suite.trackID).Update(suite.ctx, []firestore.Update{
+		{Path: "status", Value: models.TrackStatusProcessing},
+		{Path: "error", Value: "worker lost"},
+	})
+	suite.Require().NoError(err)
+
+	// A stuck run's claim is taken over rather than refused
+	suite.ErrorIs(suite.service.ClaimTrackForProcessing(suite.ctx, suite.trackID), ErrTrackAlreadyProcessing)
+	suite.Require().NoError(suite.service.ReclaimTrackForProcessing(suite.ctx, suite.trackID))
+
+	track, err := suite.service.GetTrack(suite.ctx, suite.trackID)
+	suite.Require().NoError(err)
+	suite.Equal(models.TrackStatusProcessing, track.Status)
+	suite.Empty(track.Error)
+
+	suite.Require().NoError(suite.service.TransitionTrack(suite.ctx, suite.trackID, models.TrackStatusReady, nil))
+	suite.ErrorIs(suite.service.ReclaimTrackForProcessing(suite.ctx, suite.trackID), ErrTrackAlreadyProcessed)
+
+	// Forcing takes ready tracks too
+	suite.Require().NoError(suite.service.ForceClaimTrackForProcessing(suite.ctx, suite.trackID))
+	track, err = suite.service.GetTrack(suite.ctx, suite.trackID)
+	suite.Require().NoError(err)
+	suite.Equal(models.TrackStatusProcessing, track.Status)
+}
+
+// queueProcessingJob claims the seeded track and queues a job for it
+func (suite *NostrTrackEmulatorTestSuite) queueProcessingJob(processing *ProcessingService) {
+	_, err := suite.client.Collection("nostr_tracks").Doc(suite.trackID).Update(suite.ctx, []firestore.Update{
+		{Path: "status", Value: models.TrackStatusUploaded},
+	})
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.service.ClaimTrackForProcessing(suite.ctx, suite.trackID))
+	suite.Require().NoError(processing.enqueueJob(suite.ctx, suite.trackID, models.ProcessingTriggerWebhook))
+}
+
+// expireLease makes a running job's lease run out
+func (suite *NostrTrackEmulatorTestSuite) expireLease(processing *ProcessingService) {
+	_, err := processing.jobs().Doc(suite.trackID).Update(suite.ctx, []firestore.Update{
+		{Path: "lease_expires_at", Value: time.Now().Add(-time.Second)},
+	})
+	suite.Require().NoError(err)
+}
+
+// claimTrackJob claims due jobs until the seeded track's job is returned;
+// jobs left by other tests may be due as well
+func (suite *NostrTrackEmulatorTestSuite) claimTrackJob(processing *ProcessingService) *models.ProcessingJob {
+	for i := 0; i < 20; i++ {
+		job, err := processing.claimNextJob(suite.ctx)
+		suite.Require().NoError(err)
+		if job == nil {
+			return nil
+		}
+		if job.TrackID == suite.trackID {
+			return job
+		}
+	}
+	return nil
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestProcessingJobLeaseLifecycle() {
+	processing := NewProcessingService(suite.service, nil, nil, nil, "", WithProcessingMaxAttempts(2))
+	suite.queueProcessingJob(processing)
+
+	job := suite.claimTrackJob(processing)
+	suite.Require().NotNil(job)
+	suite.Equal(1, job.Attempts)
+	suite.Equal(models.ProcessingJobStatusRunning, job.Status)
+	track, err := suite.service.GetTrack(suite.ctx, suite.trackID)
+	suite.Require().NoError(err)
+	suite.Equal(1, track.ProcessingAttempts)
+
+	// A running job isn't claimed twice
+	suite.Nil(suite.claimTrackJob(processing))
+
+	// The instance running it stops; the reconciler queues it again
+	suite.expireLease(processing)
+	reconciled, err := processing.reconcileExpiredLeases(suite.ctx)
+	suite.Require().NoError(err)
+	suite.GreaterOrEqual(reconciled, 1)
+
+	job = suite.claimTrackJob(processing)
+	suite.Require().NotNil(job)
+	suite.Equal(2, job.Attempts)
+
+	// Expiring on the last attempt fails the job and the track
+	suite.expireLease(processing)
+	_, err = processing.reconcileExpiredLeases(suite.ctx)
+	suite.Require().NoError(err)
+
+	doc, err := processing.jobs().Doc(suite.trackID).Get(suite.ctx)
+	suite.Require().NoError(err)
+	var stored models.ProcessingJob
+	suite.Require().NoError(doc.DataTo(&stored))
+	suite.Equal(models.ProcessingJobStatusFailed, stored.Status)
+	suite.Nil(stored.LeaseExpiresAt)
+
+	track, err = suite.service.GetTrack(suite.ctx, suite.trackID)
+	suite.Require().NoError(err)
+	suite.Equal(models.TrackStatusFailed, track.Status)
+	suite.Equal("processing did not finish", track.Error)
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestProcessingJobClaimedOnce() {
+	processing := NewProcessingService(suite.service, nil, nil, nil, "")
+	suite.queueProcessingJob(processing)
+
+	ref := processing.jobs().Doc(suite.trackID)
+	jobs := make([]*models.ProcessingJob, 2)
+	var wg sync.WaitGroup
+	for i := range jobs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			job, err := processing.claimJob(suite.ctx, ref)
+			suite.NoError(err)
+			jobs[i] = job
+		}(i)
+	}
+	wg.Wait()
+
+	claimed := 0
+	for _, job := range jobs {
+		if job != nil {
+			claimed++
+		}
+	}
+	suite.Equal(1, claimed)
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestProcessingJobForCancelledTrack() {
+	processing := NewProcessingService(suite.service, nil, nil, nil, "")
+	suite.queueProcessingJob(processing)
+	suite.Require().NoError(suite.service.DeleteTrack(suite.ctx, suite.trackID))
+
+	job, err := processing.claimJob(suite.ctx, processing.jobs().Doc(suite.trackID))
+	suite.Require().NoError(err)
+	suite.Nil(job)
+
+	doc, err := processing.jobs().Doc(suite.trackID).Get(suite.ctx)
+	suite.Require().NoError(err)
+	var stored models.ProcessingJob
+	suite.Require().NoError(doc.DataTo(&stored))
+	suite.Equal(models.ProcessingJobStatusFailed, stored.Status)
+	suite.Equal("track is "+models.TrackStatusCancelled, stored.LastError)
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestIdempotencyKeys() {
+	key := "delivery-" + uuid.New().String()
+
+	claimed, err := suite.service.ClaimIdempotencyKey(suite.ctx, key, suite.trackID)
+	suite.Require().NoError(err)
+	suite.True(claimed)
+
+	claimed, err = suite.service.ClaimIdempotencyKey(suite.ctx, key, suite.trackID)
+	suite.Require().NoError(err)
+	suite.False(claimed)
+
+	suite.Require().NoError(suite.service.ReleaseIdempotencyKey(suite.ctx, key))
+	claimed, err = suite.service.ClaimIdempotencyKey(suite.ctx, key, suite.trackID)
+	suite.Require().NoError(err)
+	suite.True(claimed)
+
+	// A key past expires_at that the TTL policy hasn't removed yet is claimable
+	_, err = suite.client.Collection(webhookIdempotencyCollection).Doc(idempotencyKeyDocID(key)).Update(suite.ctx, []firestore.Update{
+		{Path: "expires_at", Value: time.Now().Add(-time.Minute)},
+	})
+	suite.Require().NoError(err)
+	claimed, err = suite.service.ClaimIdempotencyKey(suite.ctx, key, suite.trackID)
+	suite.Require().NoError(err)
+	suite.True(claimed)
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestDeleteAndRestoreTrack() {
+	storage := &deletingStorage{objects: map[string]bool{}}
+	service := NewNostrTrackService(suite.client, NewStorageRegions("us", storage))
+	suite.Require().NoError(service.DeleteTrack(suite.ctx, suite.trackID))
+
+	track, err := service.GetTrack(suite.ctx, suite.trackID)
+	suite.Require().NoError(err)
+	suite.True(track.Deleted)
+	suite.Equal(models.TrackStatusCancelled, track.Status)
+	suite.False(track.IsProcessing)
+
+	// The seeded track's original was never uploaded
+	suite.Require().NoError(service.RestoreTrack(suite.ctx, suite.trackID))
+
+	track, err = service.GetTrack(suite.ctx, suite.trackID)
+	suite.Require().NoError(err)
+	suite.False(track.Deleted)
+	suite.Equal(models.TrackStatusPendingUpload, track.Status)
+	suite.True(track.IsProcessing)
+
+	err = service.RestoreTrack(suite.ctx, suite.trackID)
+	suite.True(errors.Is(err, ErrTrackNotDeleted))
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestRestoreUploadedTrack() {
+	storage := &deletingStorage{objects: map[string]bool{}}
+	service := NewNostrTrackService(suite.client, NewStorageRegions("us", storage))
+	track, err := service.GetTrack(suite.ctx, suite.trackID)
+	suite.Require().NoError(err)
+	storage.objects[service.pathConfig.GetOriginalPath(suite.trackID, track.Extension)] = true
+
+	// Cancelled after its upload, so it can be processed again at once
+	suite.Require().NoError(service.DeleteTrack(suite.ctx, suite.trackID))
+	suite.Require().NoError(service.RestoreTrack(suite.ctx, suite.trackID))
+
+	track, err = service.GetTrack(suite.ctx, suite.trackID)
+	suite.Require().NoError(err)
+	suite.Equal(models.TrackStatusUploaded, track.Status)
+	suite.Require().NoError(service.ClaimTrackForProcessing(suite.ctx, suite.trackID))
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestPurgedTrackCannotBeRestored() {
+	storage := &deletingStorage{objects: map[string]bool{}}
+	service := NewNostrTrackService(suite.client, NewStorageRegions("us", storage))
+	suite.Require().NoError(service.DeleteTrack(suite.ctx, suite.trackID))
+
+	track, err := service.GetTrack(suite.ctx, suite.trackID)
+	suite.Require().NoError(err)
+	purge, err := service.PurgeTrackFiles(suite.ctx, track, false)
+	suite.Require().NoError(err)
+	suite.Empty(purge.Failed)
+	suite.Len(storage.batches, 1)
+
+	track, err = service.GetTrack(suite.ctx, suite.trackID)
+	suite.Require().NoError(err)
+	suite.NotNil(track.FilesPurgedAt)
+
+	err = service.RestoreTrack(suite.ctx, suite.trackID)
+	suite.True(errors.Is(err, ErrTrackPurged))
+}
+
+func (suite *NostrTrackEmulatorTestSuite) seedPubkeyTracks(count int) (string, []string) {
+	pubkey := "pk-" + uuid.New().String()
+	base := time.Now().Add(-time.Hour)
+
+	var ids []string
+	for i := 0; i < count; i++ {
+		id := uuid.New().String()
+		_, err := suite.client.Collection("nostr_tracks").Doc(id).Set(suite.ctx, models.NostrTrack{
+			ID:        id,
+			Pubkey:    pubkey,
+			CreatedAt: base.Add(time.Duration(i) * time.Minute),
+			UpdatedAt: base,
+		})
+		suite.Require().NoError(err)
+		ids = append([]string{id}, ids...)
+	}
+
+	deletedID := uuid.New().String()
+	_, err := suite.client.Collection("nostr_tracks").Doc(deletedID).Set(suite.ctx, models.NostrTrack{
+		ID:        deletedID,
+		Pubkey:    pubkey,
+		Deleted:   true,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	})
+	suite.Require().NoError(err)
+
+	return pubkey, ids
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestGetTracksByPubkeyOrdered() {
+	pubkey, want := suite.seedPubkeyTracks(3)
+
+	tracks, err := suite.service.GetTracksByPubkey(suite.ctx, pubkey)
+	suite.Require().NoError(err)
+	suite.Equal(want, trackIDs(tracks))
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestListTracksByPubkeyPaginates() {
+	pubkey, want := suite.seedPubkeyTracks(5)
+
+	var got []string
+	cursor := ""
+	pages := 0
+	for {
+		tracks, next, err := suite.service.ListTracksByPubkey(suite.ctx, pubkey, 2, cursor)
+		suite.Require().NoError(err)
+		suite.LessOrEqual(len(tracks), 2)
+		got = append(got, trackIDs(tracks)...)
+		pages++
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	suite.Equal(want, got)
+	suite.Equal(3, pages)
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestListTracksByPubkeyExactPage() {
+	pubkey, want := suite.seedPubkeyTracks(2)
+
+	tracks, next, err := suite.service.ListTracksByPubkey(suite.ctx, pubkey, 2, "")
+	suite.Require().NoError(err)
+	suite.Equal(want, trackIDs(tracks))
+	suite.Empty(next)
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestListTracksByPubkeyRejectsForeignCursor() {
+	pubkey, _ := suite.seedPubkeyTracks(1)
+	_, otherIDs := suite.seedPubkeyTracks(1)
+
+	_, _, err := suite.service.ListTracksByPubkey(suite.ctx, pubkey, 2, otherIDs[0])
+	suite.ErrorIs(err, ErrInvalidTrackCursor)
+
+	_, _, err = suite.service.ListTracksByPubkey(suite.ctx, pubkey, 2, uuid.New().String())
+	suite.ErrorIs(err, ErrInvalidTrackCursor)
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestProcessingHistoryPrunesAndPaginates() {
+	start := time.Now().Add(-time.Hour)
+	var ids []string
+	for i := 0; i < MaxProcessingHistoryEntries+2; i++ {
+		attempt := models.ProcessingAttempt{
+			ID:          fmt.Sprintf("attempt-%02d", i),
+			StartedAt:   start.Add(time.Duration(i) * time.Second),
+			TriggeredBy: models.ProcessingTriggerWebhook,
+			Outcome:     models.ProcessingOutcomeRunning,
+		}
+		suite.Require().NoError(suite.service.RecordProcessingAttempt(suite.ctx, suite.trackID, attempt))
+		ids = append([]string{attempt.ID}, ids...)
+	}
+
+	// Finishing an attempt overwrites it in place
+	finished := time.Now()
+	suite.Require().NoError(suite.service.RecordProcessingAttempt(suite.ctx, suite.trackID, models.ProcessingAttempt{
+		ID:          ids[0],
+		StartedAt:   start.Add(time.Duration(MaxProcessingHistoryEntries+1) * time.Second),
+		FinishedAt:  &finished,
+		TriggeredBy: models.ProcessingTriggerWebhook,
+		Outcome:     models.ProcessingOutcomeSucceeded,
+		Versions:    []string{"default-128k-mp3"},
+	}))
+
+	var listed []models.ProcessingAttempt
+	cursor := ""
+	for {
+		page, next, err := suite.service.ListProcessingHistory(suite.ctx, suite.trackID, 20, cursor)
+		suite.Require().NoError(err)
+		listed = append(listed, page...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	// The two oldest attempts were pruned
+	suite.Require().Len(listed, MaxProcessingHistoryEntries)
+	for i, attempt := range listed {
+		suite.Equal(ids[i], attempt.ID)
+	}
+	suite.Equal(models.ProcessingOutcomeSucceeded, listed[0].Outcome)
+	suite.Equal([]string{"default-128k-mp3"}, listed[0].Versions)
+
+	_, _, err := suite.service.ListProcessingHistory(suite.ctx, suite.trackID, 20, "attempt-00")
+	suite.ErrorIs(err, ErrInvalidHistoryCursor)
+}
+
+func trackIDs(tracks []*models.NostrTrack) []string {
+	var ids []string
+	for _, track := range tracks {
+		ids = append(ids, track.ID)
+	}
+	return ids
+}
+
+func versionIDs(track *models.NostrTrack) []string {
+	var ids []string
+	for _, version := range track.CompressionVersions {
+		ids = append(ids, version.ID)
+	}
+	return ids
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestSearchTracks() {
+	// A token unique to this run keeps tracks from other runs out of the results
+	token := "zq" + uuid.New().String()[:8]
+	now := time.Now()
+	seed := func(name, title, artist string, published, deleted bool, status string, age time.Duration) {
+		track := models.NostrTrack{
+			ID:          token + "-" + name,
+			Pubkey:      "search-pubkey",
+			Status:      status,
+			IsPublished: published,
+			Deleted:     deleted,
+			CreatedAt:   now.Add(-age),
+		}
+		for path, value := range searchFieldUpdates(title, artist) {
+			switch path {
+			case "title":
+				track.Title = value.(string)
+			case "title_normalized":
+				track.TitleNormalized = value.(string)
+			case "artist":
+				track.Artist = value.(string)
+			case "artist_normalized":
+				track.ArtistNormalized = value.(string)
+			}
+		}
+		_, err := suite.client.Collection("nostr_tracks").Doc(track.ID).Set(suite.ctx, track)
+		suite.Require().NoError(err)
+	}
+
+	seed("artist-prefix", "Other Song", strings.ToUpper(token)+" Band", true, false, models.TrackStatusReady, 0)
+	seed("title-prefix", token+" Nights", "Someone", true, false, models.TrackStatusReady, time.Minute)
+	seed("title-exact", token, "Someone", true, false, models.TrackStatusReady, time.Hour)
+	seed("unpublished", token+" Demo", "Someone", false, false, models.TrackStatusReady, 0)
+	seed("deleted", token+" Gone", "Someone", true, true, models.TrackStatusReady, 0)
+	seed("processing", token+" Soon", "Someone", true, false, models.TrackStatusProcessing, 0)
+
+	index := NewFirestoreSearchIndex(suite.service)
+
+	var got []string
+	cursor := ""
+	for {
+		tracks, next, err := index.SearchTracks(suite.ctx, "  "+strings.ToUpper(token)+" ", 2, cursor)
+		suite.Require().NoError(err)
+		got = append(got, trackIDs(tracks)...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	suite.Equal([]string{token + "-title-exact", token + "-title-prefix", token + "-artist-prefix"}, got)
+
+	_, _, err := index.SearchTracks(suite.ctx, token, 2, uuid.New().String())
+	suite.ErrorIs(err, ErrInvalidSearchCursor)
+}
+
+func (suite *NostrTrackEmulatorTestSuite) TestShareLinkLifecycle() {
+	link, err := suite.service.CreateShareLink(suite.ctx, suite.trackID, time.Hour, 2)
+	suite.Require().NoError(err)
+	suite.Require().NotEmpty(link.Token)
+
+	// Only the hash is stored
+	doc, err := suite.client.Collection("nostr_tracks").Doc(suite.trackID).Collection(trackShareLinksCollection).Doc(link.ID).Get(suite.ctx)
+	suite.Require().NoError(err)
+	suite.NotContains(fmt.Sprint(doc.Data()), link.Token)
+
+	for i := 1; i <= 2; i++ {
+		track, opened, err := suite.service.OpenShareLink(suite.ctx, link.Token)
+		suite.Require().NoError(err)
+		suite.Equal(suite.trackID, track.ID)
+		suite.Equal(i, opened.Uses)
+	}
+
+	_, _, err = suite.service.OpenShareLink(suite.ctx, link.Token)
+	suite.ErrorIs(err, ErrShareLinkGone)
+
+	_, _, err = suite.service.OpenShareLink(suite.ctx, suite.trackID+".not-the-secret")
+	suite.ErrorIs(err, ErrShareLinkNotFound)
+	_, _, err = suite.service.OpenShareLink(suite.ctx, uuid.New().String()+".secret")
+	suite.ErrorIs(err, ErrShareLinkNotFound)
+
+	unlimited, err := suite.service.CreateShareLink(suite.ctx, suite.trackID, time.Hour, 0)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.service.RevokeShareLink(suite.ctx, suite.trackID, unlimited.ID))
+	suite.Require().NoError(suite.service.RevokeShareLink(suite.ctx, suite.trackID, unlimited.ID))
+	_, _, err = suite.service.OpenShareLink(suite.ctx, unlimited.Token)
+	suite.ErrorIs(err, ErrShareLinkGone)
+	suite.ErrorIs(suite.service.RevokeShareLink(suite.ctx, suite.trackID, "missing"), ErrShareLinkNotFound)
+
+	links, err := suite.service.ListShareLinks(suite.ctx, suite.trackID)
+	suite.Require().NoError(err)
+	suite.Require().Len(links, 2)
+	suite.Equal(unlimited.ID, links[0].ID)
+	suite.Equal(models.ShareLinkStatusRevoked, links[0].Status)
+	suite.Equal(models.ShareLinkStatusExhausted, links[1].Status)
+	suite.Empty(links[1].Token)
+}
+
+func TestNostrTrackEmulatorTestSuite(t *testing.T) {
+	suite.Run(t, new(NostrTrackEmulatorTestSuite))
+}
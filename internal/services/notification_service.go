@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+	"github.com/wavlake/api/internal/models"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	notificationsCollection     = "notifications"
+	notificationDedupCollection = "notification_dedupe"
+
+	// DefaultNotificationDedupeWindow collapses repeated notifications for the
+	// same track and event type (e.g. webhook retries) into a single entry
+	DefaultNotificationDedupeWindow = 10 * time.Minute
+
+	// DefaultNotificationPageSize and MaxNotificationPageSize bound feed pages
+	DefaultNotificationPageSize = 20
+	MaxNotificationPageSize     = 100
+)
+
+// ErrNotificationNotFound is returned when a notification doesn't exist or
+// belongs to a different user
+var ErrNotificationNotFound = fmt.Errorf("notification not found")
+
+type NotificationService struct {
+	firestoreClient *firestore.Client
+	webhooks        WebhookServiceInterface
+	dedupeWindow    time.Duration
+}
+
+// NewNotificationService creates a notification service. Notifications are also
+// dispatched to the owner's webhooks; webhooks may be nil.
+func NewNotificationService(firestoreClient *firestore.Client, webhooks WebhookServiceInterface) *NotificationService {
+	return &NotificationService{
+		firestoreClient: firestoreClient,
+		webhooks:        webhooks,
+		dedupeWindow:    DefaultNotificationDedupeWindow,
+	}
+}
+
+// Notify records a notification in the background and, unless it was collapsed
+// as a repeat, sends it to the owner's webhooks. Failures are logged and never
+// propagate to the caller so processing is unaffected by notification problems.
+func (s *NotificationService) Notify(notification models.Notification) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		created, err := s.CreateNotification(ctx, notification)
+		if err != nil {
+			log.Printf("Failed to create %s notification for track %s: %v", notification.Type, notification.TrackID, err)
+			return
+		}
+		if created && s.webhooks != nil {
+			s.webhooks.Dispatch(notification)
+		}
+	}()
+}
+
+// CreateNotification stores a notification unless one with the same user, track
+// and type was created within the dedupe window. It returns false when collapsed.
+func (s *NotificationService) CreateNotification(ctx context.Context, notification models.Notification) (bool, error) {
+	if notification.FirebaseUID == "" {
+		return false, fmt.Errorf("notification requires a firebase_uid")
+	}
+
+	now := time.Now()
+	notification.ID = uuid.New().String()
+	notification.Read = false
+	notification.ReadAt = nil
+	notification.CreatedAt = now
+
+	dedupeRef := s.firestoreClient.Collection(notificationDedupCollection).
+		Doc(fmt.Sprintf("%s:%s:%s", notification.FirebaseUID, notification.TrackID, notification.Type))
+	notificationRef := s.firestoreClient.Collection(notificationsCollection).Doc(notification.ID)
+
+	created := false
+	err := s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		created = false
+
+		dedupeDoc, err := tx.Get(dedupeRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return fmt.Errorf("failed to read notification dedupe marker: %w", err)
+		}
+		if err == nil {
+			if last, err := dedupeDoc.DataAt("last_created_at"); err == nil {
+				if lastAt, ok := last.(time.Time); ok && now.Sub(lastAt) < s.dedupeWindow {
+					return nil
+				}
+			}
+		}
+
+		if err := tx.Set(notificationRef, notification); err != nil {
+			return fmt.Errorf("failed to save notification: %w", err)
+		}
+		if err := tx.Set(dedupeRef, map[string]interface{}{
+			"notification_id": notification.ID,
+			"last_created_at": now,
+		}); err != nil {
+			return fmt.Errorf("failed to save notification dedupe marker: %w", err)
+		}
+
+		created = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return created, nil
+}
+
+// ListNotifications returns a page of notifications for a user, newest first.
+// The returned cursor is the ID of the last notification on the page and is empty
+// when there are no more results.
+func (s *NotificationService) ListNotifications(ctx context.Context, firebaseUID string, unreadOnly bool, limit int, cursor string) ([]models.Notification, string, error) {
+	if limit <= 0 {
+		limit = DefaultNotificationPageSize
+	}
+	if limit > MaxNotificationPageSize {
+		limit = MaxNotificationPageSize
+	}
+
+	index := IndexNotificationsByUser
+	query := s.firestoreClient.Collection(notificationsCollection).Where("firebase_uid", "==", firebaseUID)
+	if unreadOnly {
+		index = IndexUnreadNotificationsByUser
+		query = query.Where("read", "==", false)
+	}
+	query = query.OrderBy("created_at", firestore.Desc)
+
+	if cursor != "" {
+		cursorDoc, err := s.firestoreClient.Collection(notificationsCollection).Doc(cursor).Get(ctx)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid cursor: %w", err)
+		}
+		query = query.StartAfter(cursorDoc)
+	}
+
+	// Fetch one extra document to know whether another page exists
+	iter := query.Limit(limit + 1).Documents(ctx)
+	defer iter.Stop()
+
+	notifications := []models.Notification{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to iterate notifications: %w", wrapIndexError(err, index))
+		}
+
+		var notification models.Notification
+		if err := doc.DataTo(&notification); err != nil {
+			log.Printf("Failed to decode notification %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		notifications = append(notifications, notification)
+	}
+
+	nextCursor := ""
+	if len(notifications) > limit {
+		notifications = notifications[:limit]
+		nextCursor = notifications[limit-1].ID
+	}
+
+	return notifications, nextCursor, nil
+}
+
+// MarkNotificationRead marks a user's notification as read
+func (s *NotificationService) MarkNotificationRead(ctx context.Context, firebaseUID, notificationID string) error {
+	ref := s.firestoreClient.Collection(notificationsCollection).Doc(notificationID)
+
+	return s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return ErrNotificationNotFound
+			}
+			return fmt.Errorf("failed to get notification: %w", err)
+		}
+
+		var notification models.Notification
+		if err := doc.DataTo(&notification); err != nil {
+			return fmt.Errorf("failed to decode notification: %w", err)
+		}
+
+		if notification.FirebaseUID != firebaseUID {
+			return ErrNotificationNotFound
+		}
+		if notification.Read {
+			return nil
+		}
+
+		return tx.Update(ref, []firestore.Update{
+			{Path: "read", Value: true},
+			{Path: "read_at", Value: time.Now()},
+		})
+	})
+}
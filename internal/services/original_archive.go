@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/logging"
+	"github.com/wavlake/api/internal/models"
+)
+
+// ErrOriginalRestoring is returned when a track's original is in a storage
+// class that keeps it offline. A restore has been started; the original can
+// be downloaded once it finishes.
+var ErrOriginalRestoring = apierror.New(http.StatusConflict, "track.original_restoring", "original is archived and being restored")
+
+// OriginalRestoreRetryAfter is how long clients are told to wait before
+// retrying the download of an original being restored
+const OriginalRestoreRetryAfter = time.Hour
+
+// WithOriginalStorageClass moves originals to a colder storage class once a
+// track is processed, as named by the storage backend (e.g. COLDLINE on GCS,
+// Cool on Azure). Empty leaves originals where they were uploaded.
+func WithOriginalStorageClass(storageClass string) ProcessingOption {
+	return func(p *ProcessingService) {
+		p.originalStorageClass = storageClass
+	}
+}
+
+// archiveOriginal moves a processed track's original to the configured
+// storage class, returning the track update recording it. Originals already
+// archived are left alone, and failures only leave the original where it is.
+func (p *ProcessingService) archiveOriginal(ctx context.Context, storageService StorageServiceInterface, track *models.NostrTrack) map[string]interface{} {
+	if p.originalStorageClass == "" || track.ArchivedAt != nil {
+		return nil
+	}
+
+	objectName := p.pathConfig.GetOriginalPath(track.ID, track.Extension)
+	if err := storageService.SetStorageClass(ctx, objectName, p.originalStorageClass); err != nil {
+		logging.FromContext(ctx).Warn("failed to archive original", "track_id", track.ID, "storage_class", p.originalStorageClass, "error", err)
+		return nil
+	}
+	return map[string]interface{}{"archived_at": p.now()}
+}
+
+// restoreOriginal checks an archived original can be read, starting a
+// restore when it can't
+func (s *NostrTrackService) restoreOriginal(ctx context.Context, track *models.NostrTrack) error {
+	if track.ArchivedAt == nil {
+		return nil
+	}
+	ready, err := s.StorageFor(track).RestoreObject(ctx, s.pathConfig.GetOriginalPath(track.ID, track.Extension))
+	if err != nil {
+		return err
+	}
+	if !ready {
+		return ErrOriginalRestoring
+	}
+	return nil
+}
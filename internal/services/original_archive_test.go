@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/models"
+)
+
+// archivingStorage records storage class changes and reports restores as
+// not ready while restoring is set
+type archivingStorage struct {
+	fakeObjectStorage
+	classes   map[string]string
+	classErr  error
+	restoring bool
+	restores  []string
+}
+
+func (s *archivingStorage) SetStorageClass(ctx context.Context, objectName, storageClass string) error {
+	if s.classErr != nil {
+		return s.classErr
+	}
+	if s.classes == nil {
+		s.classes = map[string]string{}
+	}
+	s.classes[objectName] = storageClass
+	return nil
+}
+
+func (s *archivingStorage) RestoreObject(ctx context.Context, objectName string) (bool, error) {
+	s.restores = append(s.restores, objectName)
+	return !s.restoring, nil
+}
+
+func (s *archivingStorage) GenerateDownloadURL(ctx context.Context, objectName string, expiration time.Duration) (string, error) {
+	return "https://signed.example.com/" + objectName, nil
+}
+
+// failingCompressionAudio accepts any file and fails compression
+type failingCompressionAudio struct {
+	slowAudio
+}
+
+func (a *failingCompressionAudio) CompressAudio(ctx context.Context, inputPath, outputPath string) error {
+	return errors.New("ffmpeg exited")
+}
+
+func TestArchiveOriginal(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	archivedAt := now.Add(-time.Hour)
+
+	tests := []struct {
+		name        string
+		class       string
+		track       *models.NostrTrack
+		classErr    error
+		wantClasses map[string]string
+		wantUpdates map[string]interface{}
+	}{
+		{"disabled", "", &models.NostrTrack{ID: "abc", Extension: "wav"}, nil, nil, nil},
+		{"archives", "COLDLINE", &models.NostrTrack{ID: "abc", Extension: "wav"}, nil,
+			map[string]string{"tracks/original/abc.wav": "COLDLINE"}, map[string]interface{}{"archived_at": now}},
+		{"already archived", "COLDLINE", &models.NostrTrack{ID: "abc", Extension: "wav", ArchivedAt: &archivedAt}, nil, nil, nil},
+		{"storage fails", "COLDLINE", &models.NostrTrack{ID: "abc", Extension: "wav"}, errors.New("rewrite failed"), nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &archivingStorage{classErr: tt.classErr}
+			p := NewProcessingService(nil, nil, nil, nil, t.TempDir(), WithOriginalStorageClass(tt.class))
+			p.now = func() time.Time { return now }
+
+			updates := p.archiveOriginal(context.Background(), storage, tt.track)
+			assert.Equal(t, tt.wantUpdates, updates)
+			assert.Equal(t, tt.wantClasses, storage.classes)
+		})
+	}
+}
+
+func TestProcessTrackKeepsOriginalWhenCompressionFails(t *testing.T) {
+	storage := &archivingStorage{fakeObjectStorage: fakeObjectStorage{objects: map[string]string{"tracks/original/abc.wav": "audio bytes"}}}
+	p := NewProcessingService(NewNostrTrackService(nil, NewStorageRegions("us", storage)), &failingCompressionAudio{}, nil, nil, t.TempDir(),
+		WithOriginalStorageClass("COLDLINE"))
+	p.diskFree = func(string) (int64, error) { return 1 << 30, nil }
+
+	run := newProcessingRun("abc", models.ProcessingTriggerWebhook)
+	run.canRetry = true
+	err := p.processTrack(context.Background(), &models.NostrTrack{ID: "abc", Extension: "wav"}, run)
+
+	assert.ErrorIs(t, err, errRetryProcessing)
+	assert.Equal(t, models.ProcessingErrorCompression, run.attempt.ErrorClass)
+	assert.Empty(t, storage.classes)
+}
+
+func TestSignOriginalDownload_Archived(t *testing.T) {
+	archivedAt := time.Now().Add(-24 * time.Hour)
+	track := &models.NostrTrack{ID: "abc", Extension: "flac", ArchivedAt: &archivedAt}
+
+	t.Run("restoring", func(t *testing.T) {
+		storage := &archivingStorage{restoring: true}
+		s := NewNostrTrackService(nil, NewStorageRegions("us", storage))
+
+		_, err := s.SignOriginalDownload(context.Background(), track, time.Hour)
+		assert.ErrorIs(t, err, ErrOriginalRestoring)
+		assert.Equal(t, []string{"tracks/original/abc.flac"}, storage.restores)
+	})
+
+	t.Run("readable", func(t *testing.T) {
+		storage := &archivingStorage{}
+		s := NewNostrTrackService(nil, NewStorageRegions("us", storage))
+
+		download, err := s.SignOriginalDownload(context.Background(), track, time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, "https://signed.example.com/tracks/original/abc.flac", download.URL)
+	})
+
+	t.Run("not archived", func(t *testing.T) {
+		storage := &archivingStorage{restoring: true}
+		s := NewNostrTrackService(nil, NewStorageRegions("us", storage))
+
+		_, err := s.SignOriginalDownload(context.Background(), &models.NostrTrack{ID: "abc", Extension: "flac"}, time.Hour)
+		require.NoError(t, err)
+		assert.Empty(t, storage.restores)
+	})
+}
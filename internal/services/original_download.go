@@ -0,0 +1,44 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wavlake/api/internal/models"
+)
+
+// DefaultOriginalDownloadExpiration and MaxOriginalDownloadExpiration bound
+// how long a signed URL for a track's original works
+const (
+	DefaultOriginalDownloadExpiration = 15 * time.Minute
+	MaxOriginalDownloadExpiration     = 24 * time.Hour
+)
+
+// SignOriginalDownload returns a short-lived signed GET URL for a track's
+// original upload, so owners can fetch it without the bucket being public.
+// An archived original that storage keeps offline fails with
+// ErrOriginalRestoring after its restore is started.
+func (s *NostrTrackService) SignOriginalDownload(ctx context.Context, track *models.NostrTrack, expiration time.Duration) (*models.OriginalDownload, error) {
+	objectName := s.pathConfig.GetOriginalPath(track.ID, track.Extension)
+
+	if err := s.restoreOriginal(ctx, track); err != nil {
+		if errors.Is(err, ErrOriginalRestoring) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to check archived original: %w", err)
+	}
+
+	url, err := s.StorageFor(track).GenerateDownloadURL(ctx, objectName, expiration)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign original download URL: %w", err)
+	}
+
+	return &models.OriginalDownload{
+		URL:       url,
+		Filename:  fmt.Sprintf("%s.%s", track.ID, track.Extension),
+		ExpiresIn: int(expiration / time.Second),
+		ExpiresAt: time.Now().Add(expiration),
+	}, nil
+}
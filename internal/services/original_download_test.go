@@ -0,0 +1,41 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/models"
+)
+
+// signingStorage returns a fake signed URL and records what it signed
+type signingStorage struct {
+	StorageServiceInterface
+	objectName string
+	expiration time.Duration
+}
+
+func (s *signingStorage) GenerateDownloadURL(ctx context.Context, objectName string, expiration time.Duration) (string, error) {
+	s.objectName, s.expiration = objectName, expiration
+	return "https://signed.example.com/" + objectName, nil
+}
+
+func TestSignOriginalDownload(t *testing.T) {
+	us, eu := &signingStorage{}, &signingStorage{}
+	regions := NewStorageRegions("us", us)
+	require.NoError(t, regions.Add("eu", eu, nil))
+	s := NewNostrTrackService(nil, regions)
+
+	download, err := s.SignOriginalDownload(context.Background(), &models.NostrTrack{ID: "abc", Extension: "flac", Region: "eu"}, time.Hour)
+	require.NoError(t, err)
+
+	assert.Equal(t, "tracks/original/abc.flac", eu.objectName)
+	assert.Equal(t, time.Hour, eu.expiration)
+	assert.Empty(t, us.objectName)
+	assert.Equal(t, "https://signed.example.com/tracks/original/abc.flac", download.URL)
+	assert.Equal(t, "abc.flac", download.Filename)
+	assert.Equal(t, 3600, download.ExpiresIn)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), download.ExpiresAt, time.Minute)
+}
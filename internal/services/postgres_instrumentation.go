@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/logging"
+)
+
+// Defaults for PostgresService's query bounds
+const (
+	DefaultPostgresQueryTimeout       = 5 * time.Second
+	DefaultPostgresSlowQueryThreshold = 500 * time.Millisecond
+)
+
+// ErrLegacyTimeout is returned, wrapping the query's ErrLegacyDatabase, when a
+// query doesn't finish within the query timeout or the caller's deadline
+var ErrLegacyTimeout = apierror.New(http.StatusGatewayTimeout, "legacy.timeout", "legacy database query timed out")
+
+// Outcomes recorded on legacyQueryDuration
+const (
+	legacyQueryOK       = "ok"
+	legacyQueryNotFound = "not_found"
+	legacyQueryError    = "error"
+	legacyQueryTimeout  = "timeout"
+)
+
+// legacyQueryDuration records how long each named legacy query took, by
+// outcome
+var legacyQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "wavlake",
+	Subsystem: "legacy_postgres",
+	Name:      "query_duration_seconds",
+	Help:      "Duration of legacy PostgreSQL queries by query name and outcome.",
+	Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+}, []string{"query", "outcome"})
+
+// RegisterPostgresMetrics registers the legacy query metrics with reg
+func RegisterPostgresMetrics(reg prometheus.Registerer) error {
+	return reg.Register(legacyQueryDuration)
+}
+
+// PostgresOption configures a PostgresService
+type PostgresOption func(*PostgresService)
+
+// WithPostgresQueryTimeout bounds each query, including reading its rows.
+// lib/pq cancels a statement on the server when its context ends, so a hung
+// replica fails the query instead of holding the request and connection.
+func WithPostgresQueryTimeout(timeout time.Duration) PostgresOption {
+	return func(p *PostgresService) {
+		if timeout > 0 {
+			p.queryTimeout = timeout
+		}
+	}
+}
+
+// WithPostgresSlowQueryThreshold logs queries taking at least threshold
+func WithPostgresSlowQueryThreshold(threshold time.Duration) PostgresOption {
+	return func(p *PostgresService) {
+		if threshold > 0 {
+			p.slowQueryThreshold = threshold
+		}
+	}
+}
+
+// observe runs a named query under the query timeout, recording its duration
+// and logging it if slow. args are the query's parameters, logged redacted.
+func (p *PostgresService) observe(ctx context.Context, name string, args []interface{}, query func(ctx context.Context) error) error {
+	queryCtx, cancel := context.WithTimeout(ctx, p.queryTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := query(queryCtx)
+	elapsed := time.Since(start)
+
+	// The driver reports a cancelled statement in its own words, so check the
+	// deadline, ours or the caller's, rather than the error
+	outcome := legacyQueryOK
+	switch {
+	case err == nil:
+	case errors.Is(queryCtx.Err(), context.DeadlineExceeded):
+		outcome = legacyQueryTimeout
+		err = fmt.Errorf("%w: %w", ErrLegacyTimeout, err)
+	case errors.Is(err, ErrLegacyNotFound):
+		outcome = legacyQueryNotFound
+	default:
+		outcome = legacyQueryError
+	}
+	legacyQueryDuration.WithLabelValues(name, outcome).Observe(elapsed.Seconds())
+
+	if elapsed >= p.slowQueryThreshold {
+		logging.FromContext(ctx).Warn("slow legacy query", "query", name, "duration", elapsed, "outcome", outcome, "params", redactParams(args))
+	}
+	return err
+}
+
+// redactParams describes query parameters for logs without their values.
+// Strings are user IDs and search text, so only their length is kept; limits,
+// offsets and flags are kept as they are.
+func redactParams(args []interface{}) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case string:
+			redacted[i] = fmt.Sprintf("$%d=<redacted, %d chars>", i+1, len(v))
+		case int, int64, bool:
+			redacted[i] = fmt.Sprintf("$%d=%v", i+1, v)
+		default:
+			redacted[i] = fmt.Sprintf("$%d=<redacted>", i+1)
+		}
+	}
+	return redacted
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/logging"
+)
+
+// legacyQueryCount reads how many queries were recorded under name and outcome
+func legacyQueryCount(t *testing.T, name, outcome string) uint64 {
+	t.Helper()
+	var metric dto.Metric
+	require.NoError(t, legacyQueryDuration.WithLabelValues(name, outcome).(prometheus.Metric).Write(&metric))
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestPostgresQueryTimeout(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	p := NewPostgresService(db, WithPostgresQueryTimeout(20*time.Millisecond))
+
+	mock.ExpectQuery(`FROM artist`).WithArgs("uid").WillDelayFor(time.Minute).
+		WillReturnRows(sqlmock.NewRows(legacyArtistColumns))
+	before := legacyQueryCount(t, "user_artists", legacyQueryTimeout)
+
+	start := time.Now()
+	_, err = p.GetUserArtists(context.Background(), "uid")
+	assert.Less(t, time.Since(start), time.Second)
+	assert.ErrorIs(t, err, ErrLegacyTimeout)
+	assert.ErrorIs(t, err, ErrLegacyDatabase)
+	assert.Equal(t, before+1, legacyQueryCount(t, "user_artists", legacyQueryTimeout))
+}
+
+func TestPostgresQueryMetrics(t *testing.T) {
+	p, mock := newMockPostgres(t)
+	mock.ExpectQuery(`FROM "user"`).WithArgs("uid").WillReturnRows(sqlmock.NewRows(legacyUserColumns))
+	mock.ExpectQuery(`FROM "user"`).WithArgs("uid").WillReturnError(sql.ErrConnDone)
+	notFound, failed := legacyQueryCount(t, "get_user", legacyQueryNotFound), legacyQueryCount(t, "get_user", legacyQueryError)
+
+	_, err := p.GetUserByFirebaseUID(context.Background(), "uid")
+	assert.ErrorIs(t, err, ErrLegacyNotFound)
+	_, err = p.GetUserByFirebaseUID(context.Background(), "uid")
+	assert.ErrorIs(t, err, ErrLegacyDatabase)
+	assert.NotErrorIs(t, err, ErrLegacyTimeout)
+
+	assert.Equal(t, notFound+1, legacyQueryCount(t, "get_user", legacyQueryNotFound))
+	assert.Equal(t, failed+1, legacyQueryCount(t, "get_user", legacyQueryError))
+}
+
+func TestPostgresSlowQueryLog(t *testing.T) {
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(logging.NewHandler(&logs, "json", nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	p := NewPostgresService(db, WithPostgresSlowQueryThreshold(10*time.Millisecond))
+
+	mock.ExpectQuery(`ILIKE`).WithArgs("secret-uid", "%private search%", 20).WillDelayFor(20 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows(legacySearchColumns))
+	_, err = p.SearchUserCatalog(context.Background(), "secret-uid", "private search", "", 20)
+	require.NoError(t, err)
+
+	assert.Contains(t, logs.String(), "slow legacy query")
+	assert.Contains(t, logs.String(), `"query":"search_catalog"`)
+	assert.Contains(t, logs.String(), "$3=20")
+	assert.NotContains(t, logs.String(), "secret-uid")
+	assert.NotContains(t, logs.String(), "private search")
+}
+
+func TestRedactParams(t *testing.T) {
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, []string{"$1=<redacted, 3 chars>", "$2=true", "$3=<redacted>", "$4=100"},
+		redactParams([]interface{}{"uid", true, at, 100}))
+}
@@ -3,9 +3,14 @@ package services
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
+	"time"
 
 	_ "github.com/lib/pq" // PostgreSQL driver
+	"github.com/wavlake/api/internal/apierror"
 	"github.com/wavlake/api/internal/models"
 )
 
@@ -15,15 +20,89 @@ import (
 // All queries referencing this table MUST use quoted identifiers: "user" (with quotes)
 // Failure to use quotes will result in cryptic "column does not exist" errors.
 
+// Errors returned by PostgresService, wrapping the driver's error. Listings
+// return an empty list rather than ErrLegacyNotFound when nothing matches.
+var (
+	// ErrLegacyNotFound is returned when a looked-up record doesn't exist
+	ErrLegacyNotFound = apierror.New(http.StatusNotFound, "legacy.not_found", "legacy record not found")
+	// ErrLegacyDatabase is returned when a query fails
+	ErrLegacyDatabase = apierror.New(http.StatusInternalServerError, "legacy.database_error", "legacy database error")
+)
+
+// legacyError wraps a query error in ErrLegacyNotFound for missing rows and
+// ErrLegacyDatabase otherwise
+func legacyError(action string, err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s: %w", action, ErrLegacyNotFound)
+	}
+	return fmt.Errorf("%w: %s: %w", ErrLegacyDatabase, action, err)
+}
+
+// Page sizes for the legacy track listings
+const (
+	DefaultLegacyPageSize = 100
+	MaxLegacyPageSize     = 500
+)
+
+// LegacyTrackFilter pages and filters the legacy track listings. The zero
+// value is the first page of non-deleted tracks.
+type LegacyTrackFilter struct {
+	Limit  int // Defaults to DefaultLegacyPageSize, capped at MaxLegacyPageSize
+	Offset int
+	// IsDraft, when set, keeps only drafts or only non-drafts
+	IsDraft *bool
+	// Deleted lists deleted tracks instead of the others
+	Deleted bool
+	// PublishedSince, when set, keeps tracks published at or after it
+	PublishedSince *time.Time
+}
+
+// page returns the filter's limit and offset, defaulted and capped
+func (f LegacyTrackFilter) page() (int, int) {
+	limit := f.Limit
+	if limit <= 0 {
+		limit = DefaultLegacyPageSize
+	}
+	return min(limit, MaxLegacyPageSize), max(f.Offset, 0)
+}
+
+// where appends the filter's conditions on track t to a query's WHERE
+// clause, numbering placeholders after args
+func (f LegacyTrackFilter) where(args []interface{}) (string, []interface{}) {
+	var clause strings.Builder
+	if f.Deleted {
+		clause.WriteString(` AND COALESCE(t.deleted, false)`)
+	} else {
+		clause.WriteString(` AND NOT COALESCE(t.deleted, false)`)
+	}
+	if f.IsDraft != nil {
+		args = append(args, *f.IsDraft)
+		fmt.Fprintf(&clause, ` AND COALESCE(t.is_draft, false) = $%d`, len(args))
+	}
+	if f.PublishedSince != nil {
+		args = append(args, *f.PublishedSince)
+		fmt.Fprintf(&clause, ` AND t.published_at >= $%d`, len(args))
+	}
+	return clause.String(), args
+}
+
 type PostgresService struct {
-	db *sql.DB
+	db                 *sql.DB
+	queryTimeout       time.Duration
+	slowQueryThreshold time.Duration
 }
 
 // NewPostgresService creates a new PostgreSQL service instance
-func NewPostgresService(db *sql.DB) *PostgresService {
-	return &PostgresService{
-		db: db,
+func NewPostgresService(db *sql.DB, opts ...PostgresOption) *PostgresService {
+	p := &PostgresService{
+		db:                 db,
+		queryTimeout:       DefaultPostgresQueryTimeout,
+		slowQueryThreshold: DefaultPostgresSlowQueryThreshold,
 	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
 }
 
 // GetUserByFirebaseUID retrieves a user by their Firebase UID
@@ -32,149 +111,72 @@ func (p *PostgresService) GetUserByFirebaseUID(ctx context.Context, firebaseUID
 	// Without quotes, PostgreSQL interprets 'user' as a keyword rather than a table identifier,
 	// resulting in confusing "column does not exist" errors instead of the actual table access.
 	query := `
-		SELECT id, name, COALESCE(lightning_address, '') as lightning_address, 
-		       COALESCE(msat_balance, 0) as msat_balance, COALESCE(amp_msat, 1000) as amp_msat,
-		       COALESCE(artwork_url, '') as artwork_url, COALESCE(profile_url, '') as profile_url,
-		       COALESCE(is_locked, false) as is_locked, created_at, updated_at
+		SELECT id, name, lightning_address, msat_balance, amp_msat,
+		       artwork_url, profile_url, is_locked, created_at, updated_at
 		FROM "user" 
 		WHERE id = $1 AND NOT COALESCE(is_locked, false)
 	`
 
-	var user models.LegacyUser
-	err := p.db.QueryRowContext(ctx, query, firebaseUID).Scan(
-		&user.ID,
-		&user.Name,
-		&user.LightningAddress,
-		&user.MSatBalance,
-		&user.AmpMsat,
-		&user.ArtworkURL,
-		&user.ProfileURL,
-		&user.IsLocked,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
-
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("user not found")
+	var user *models.LegacyUser
+	err := p.observe(ctx, "get_user", []interface{}{firebaseUID}, func(ctx context.Context) error {
+		var err error
+		if user, err = scanLegacyUser(p.db.QueryRowContext(ctx, query, firebaseUID)); err != nil {
+			return legacyError("failed to get user", err)
 		}
-		return nil, fmt.Errorf("failed to get user: %w", err)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return &user, nil
+	return user, nil
 }
 
-// GetUserTracks retrieves all tracks for a user by Firebase UID
-func (p *PostgresService) GetUserTracks(ctx context.Context, firebaseUID string) ([]models.LegacyTrack, error) {
-	query := `
-		SELECT t.id, t.artist_id, t.album_id, t.title, t."order", 
-		       COALESCE(t.play_count, 0) as play_count, COALESCE(t.msat_total, 0) as msat_total,
-		       t.live_url, COALESCE(t.raw_url, '') as raw_url, 
-		       COALESCE(t.size, 0) as size, COALESCE(t.duration, 0) as duration,
-		       COALESCE(t.is_processing, false) as is_processing, COALESCE(t.is_draft, false) as is_draft,
-		       COALESCE(t.is_explicit, false) as is_explicit, COALESCE(t.compressor_error, false) as compressor_error,
-		       COALESCE(t.deleted, false) as deleted, COALESCE(t.lyrics, '') as lyrics,
-		       t.created_at, t.updated_at, t.published_at
+// GetUserTracks retrieves a page of a user's tracks by Firebase UID, newest
+// first, with the total matching the filter
+func (p *PostgresService) GetUserTracks(ctx context.Context, firebaseUID string, filter LegacyTrackFilter) ([]models.LegacyTrack, int, error) {
+	from := `
 		FROM track t
 		JOIN album al ON t.album_id = al.id
 		JOIN artist ar ON al.artist_id = ar.id
-		WHERE ar.user_id = $1 AND NOT COALESCE(t.deleted, false)
-		ORDER BY t.created_at DESC
-	`
-
-	rows, err := p.db.QueryContext(ctx, query, firebaseUID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query tracks: %w", err)
-	}
-	defer rows.Close()
-
-	var tracks []models.LegacyTrack
-	for rows.Next() {
-		var track models.LegacyTrack
-		err := rows.Scan(
-			&track.ID,
-			&track.ArtistID,
-			&track.AlbumID,
-			&track.Title,
-			&track.Order,
-			&track.PlayCount,
-			&track.MSatTotal,
-			&track.LiveURL,
-			&track.RawURL,
-			&track.Size,
-			&track.Duration,
-			&track.IsProcessing,
-			&track.IsDraft,
-			&track.IsExplicit,
-			&track.CompressorError,
-			&track.Deleted,
-			&track.Lyrics,
-			&track.CreatedAt,
-			&track.UpdatedAt,
-			&track.PublishedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan track: %w", err)
-		}
-		tracks = append(tracks, track)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("failed to iterate tracks: %w", err)
-	}
-
-	return tracks, nil
+		WHERE ar.user_id = $1`
+	return p.listTracks(ctx, "user_tracks", from, `t.created_at DESC, t.id`, firebaseUID, filter)
 }
 
 // GetUserArtists retrieves all artists for a user by Firebase UID
 func (p *PostgresService) GetUserArtists(ctx context.Context, firebaseUID string) ([]models.LegacyArtist, error) {
 	query := `
-		SELECT id, user_id, name, COALESCE(artwork_url, '') as artwork_url,
-		       artist_url, COALESCE(bio, '') as bio, COALESCE(twitter, '') as twitter,
-		       COALESCE(instagram, '') as instagram, COALESCE(youtube, '') as youtube,
-		       COALESCE(website, '') as website, COALESCE(npub, '') as npub,
-		       COALESCE(verified, false) as verified, COALESCE(deleted, false) as deleted,
-		       COALESCE(msat_total, 0) as msat_total, created_at, updated_at
+		SELECT id, user_id, name, artwork_url, artist_url, bio, twitter,
+		       instagram, youtube, website, npub, verified, deleted,
+		       msat_total, created_at, updated_at
 		FROM artist 
 		WHERE user_id = $1 AND NOT COALESCE(deleted, false)
 		ORDER BY created_at DESC
 	`
 
-	rows, err := p.db.QueryContext(ctx, query, firebaseUID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query artists: %w", err)
-	}
-	defer rows.Close()
-
-	var artists []models.LegacyArtist
-	for rows.Next() {
-		var artist models.LegacyArtist
-		err := rows.Scan(
-			&artist.ID,
-			&artist.UserID,
-			&artist.Name,
-			&artist.ArtworkURL,
-			&artist.ArtistURL,
-			&artist.Bio,
-			&artist.Twitter,
-			&artist.Instagram,
-			&artist.Youtube,
-			&artist.Website,
-			&artist.Npub,
-			&artist.Verified,
-			&artist.Deleted,
-			&artist.MSatTotal,
-			&artist.CreatedAt,
-			&artist.UpdatedAt,
-		)
+	artists := []models.LegacyArtist{}
+	err := p.observe(ctx, "user_artists", []interface{}{firebaseUID}, func(ctx context.Context) error {
+		rows, err := p.db.QueryContext(ctx, query, firebaseUID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan artist: %w", err)
+			return legacyError("failed to query artists", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			artist, err := scanLegacyArtist(rows)
+			if err != nil {
+				return legacyError("failed to scan artist", err)
+			}
+			artists = append(artists, *artist)
 		}
-		artists = append(artists, artist)
-	}
 
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("failed to iterate artists: %w", err)
+		if err = rows.Err(); err != nil {
+			return legacyError("failed to iterate artists", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return artists, nil
@@ -183,175 +185,243 @@ func (p *PostgresService) GetUserArtists(ctx context.Context, firebaseUID string
 // GetUserAlbums retrieves all albums for a user by Firebase UID
 func (p *PostgresService) GetUserAlbums(ctx context.Context, firebaseUID string) ([]models.LegacyAlbum, error) {
 	query := `
-		SELECT al.id, al.artist_id, al.title, COALESCE(al.artwork_url, '') as artwork_url,
-		       COALESCE(al.description, '') as description, COALESCE(al.genre_id, 0) as genre_id,
-		       COALESCE(al.subgenre_id, 0) as subgenre_id, COALESCE(al.is_draft, false) as is_draft,
-		       COALESCE(al.is_single, false) as is_single, COALESCE(al.deleted, false) as deleted,
-		       COALESCE(al.msat_total, 0) as msat_total, COALESCE(al.is_feed_published, true) as is_feed_published,
-		       al.published_at, al.created_at, al.updated_at
+		SELECT al.id, al.artist_id, al.title, al.artwork_url, al.description,
+		       al.genre_id, al.subgenre_id, al.is_draft, al.is_single, al.deleted,
+		       al.msat_total, al.is_feed_published, al.published_at, al.created_at, al.updated_at
 		FROM album al
 		JOIN artist ar ON al.artist_id = ar.id
 		WHERE ar.user_id = $1 AND NOT COALESCE(al.deleted, false)
 		ORDER BY al.created_at DESC
 	`
 
-	rows, err := p.db.QueryContext(ctx, query, firebaseUID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query albums: %w", err)
-	}
-	defer rows.Close()
-
-	var albums []models.LegacyAlbum
-	for rows.Next() {
-		var album models.LegacyAlbum
-		err := rows.Scan(
-			&album.ID,
-			&album.ArtistID,
-			&album.Title,
-			&album.ArtworkURL,
-			&album.Description,
-			&album.GenreID,
-			&album.SubgenreID,
-			&album.IsDraft,
-			&album.IsSingle,
-			&album.Deleted,
-			&album.MSatTotal,
-			&album.IsFeedPublished,
-			&album.PublishedAt,
-			&album.CreatedAt,
-			&album.UpdatedAt,
-		)
+	albums := []models.LegacyAlbum{}
+	err := p.observe(ctx, "user_albums", []interface{}{firebaseUID}, func(ctx context.Context) error {
+		rows, err := p.db.QueryContext(ctx, query, firebaseUID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan album: %w", err)
+			return legacyError("failed to query albums", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			album, err := scanLegacyAlbum(rows)
+			if err != nil {
+				return legacyError("failed to scan album", err)
+			}
+			albums = append(albums, *album)
 		}
-		albums = append(albums, album)
-	}
 
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("failed to iterate albums: %w", err)
+		if err = rows.Err(); err != nil {
+			return legacyError("failed to iterate albums", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return albums, nil
 }
 
-// GetTracksByArtist retrieves all tracks for a specific artist
-func (p *PostgresService) GetTracksByArtist(ctx context.Context, artistID string) ([]models.LegacyTrack, error) {
+// GetTracksByArtist retrieves a page of an artist's tracks in album order,
+// with the total matching the filter
+func (p *PostgresService) GetTracksByArtist(ctx context.Context, artistID string, filter LegacyTrackFilter) ([]models.LegacyTrack, int, error) {
+	return p.listTracks(ctx, "artist_tracks", `FROM track t WHERE t.artist_id = $1`, `t."order", t.created_at, t.id`, artistID, filter)
+}
+
+// GetTracksByAlbum retrieves a page of an album's tracks in order, with the
+// total matching the filter
+func (p *PostgresService) GetTracksByAlbum(ctx context.Context, albumID string, filter LegacyTrackFilter) ([]models.LegacyTrack, int, error) {
+	return p.listTracks(ctx, "album_tracks", `FROM track t WHERE t.album_id = $1`, `t."order", t.created_at, t.id`, albumID, filter)
+}
+
+// listTracks runs the count and page queries for tracks selected by from,
+// whose only placeholder is $1 for owner. Both run in one read-only
+// transaction so the total matches the page.
+func (p *PostgresService) listTracks(ctx context.Context, name, from, orderBy, owner string, filter LegacyTrackFilter) ([]models.LegacyTrack, int, error) {
+	where, args := filter.where([]interface{}{owner})
+	limit, offset := filter.page()
+	args = append(args, limit, offset)
+
 	query := `
-		SELECT t.id, t.artist_id, t.album_id, t.title, t."order", 
-		       COALESCE(t.play_count, 0) as play_count, COALESCE(t.msat_total, 0) as msat_total,
-		       t.live_url, COALESCE(t.raw_url, '') as raw_url, 
-		       COALESCE(t.size, 0) as size, COALESCE(t.duration, 0) as duration,
-		       COALESCE(t.is_processing, false) as is_processing, COALESCE(t.is_draft, false) as is_draft,
-		       COALESCE(t.is_explicit, false) as is_explicit, COALESCE(t.compressor_error, false) as compressor_error,
-		       COALESCE(t.deleted, false) as deleted, COALESCE(t.lyrics, '') as lyrics,
+		SELECT t.id, t.artist_id, t.album_id, t.title, t."order", t.play_count, t.msat_total,
+		       t.live_url, t.raw_url, t.size, t.duration, t.is_processing, t.is_draft,
+		       t.is_explicit, t.compressor_error, t.deleted, t.lyrics,
 		       t.created_at, t.updated_at, t.published_at
-		FROM track t
-		WHERE t.artist_id = $1 AND NOT COALESCE(t.deleted, false)
-		ORDER BY t."order", t.created_at
-	`
+		` + from + where + fmt.Sprintf(`
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d`, orderBy, len(args)-1, len(args))
+
+	tracks := []models.LegacyTrack{}
+	var total int
+	err := p.observe(ctx, name, args, func(ctx context.Context) error {
+		tx, err := p.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+		if err != nil {
+			return legacyError("failed to begin read-only transaction", err)
+		}
+		defer tx.Rollback() // #nosec G104 -- Read-only; nothing to roll back
 
-	rows, err := p.db.QueryContext(ctx, query, artistID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query tracks by artist: %w", err)
-	}
-	defer rows.Close()
-
-	var tracks []models.LegacyTrack
-	for rows.Next() {
-		var track models.LegacyTrack
-		err := rows.Scan(
-			&track.ID,
-			&track.ArtistID,
-			&track.AlbumID,
-			&track.Title,
-			&track.Order,
-			&track.PlayCount,
-			&track.MSatTotal,
-			&track.LiveURL,
-			&track.RawURL,
-			&track.Size,
-			&track.Duration,
-			&track.IsProcessing,
-			&track.IsDraft,
-			&track.IsExplicit,
-			&track.CompressorError,
-			&track.Deleted,
-			&track.Lyrics,
-			&track.CreatedAt,
-			&track.UpdatedAt,
-			&track.PublishedAt,
-		)
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) `+from+where, args[:len(args)-2]...).Scan(&total); err != nil {
+			return legacyError("failed to count tracks", err)
+		}
+
+		rows, err := tx.QueryContext(ctx, query, args...)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan track: %w", err)
+			return legacyError("failed to query tracks", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			track, err := scanLegacyTrack(rows)
+			if err != nil {
+				return legacyError("failed to scan track", err)
+			}
+			tracks = append(tracks, *track)
 		}
-		tracks = append(tracks, track)
-	}
 
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("failed to iterate tracks: %w", err)
+		if err = rows.Err(); err != nil {
+			return legacyError("failed to iterate tracks", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
 	}
 
-	return tracks, nil
+	return tracks, total, nil
 }
 
-// GetTracksByAlbum retrieves all tracks for a specific album
-func (p *PostgresService) GetTracksByAlbum(ctx context.Context, albumID string) ([]models.LegacyTrack, error) {
-	query := `
-		SELECT id, artist_id, album_id, title, "order", 
-		       COALESCE(play_count, 0) as play_count, COALESCE(msat_total, 0) as msat_total,
-		       live_url, COALESCE(raw_url, '') as raw_url, 
-		       COALESCE(size, 0) as size, COALESCE(duration, 0) as duration,
-		       COALESCE(is_processing, false) as is_processing, COALESCE(is_draft, false) as is_draft,
-		       COALESCE(is_explicit, false) as is_explicit, COALESCE(compressor_error, false) as compressor_error,
-		       COALESCE(deleted, false) as deleted, COALESCE(lyrics, '') as lyrics,
-		       created_at, updated_at, published_at
-		FROM track 
-		WHERE album_id = $1 AND NOT COALESCE(deleted, false)
-		ORDER BY "order", created_at
-	`
+// rowScanner is a *sql.Row or *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
 
-	rows, err := p.db.QueryContext(ctx, query, albumID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query tracks by album: %w", err)
+// Many legacy columns are NULL for older rows, so everything but the keys is
+// scanned into sql.Null* values. NULL reads as the column's default: empty,
+// zero or false, 1000 for amp_msat, true for is_feed_published, and an
+// omitted published_at.
+
+func scanLegacyUser(row rowScanner) (*models.LegacyUser, error) {
+	var user models.LegacyUser
+	var name, lightningAddress, artworkURL, profileURL sql.NullString
+	var msatBalance, ampMsat sql.NullInt64
+	var isLocked sql.NullBool
+	var createdAt, updatedAt sql.NullTime
+	if err := row.Scan(&user.ID, &name, &lightningAddress, &msatBalance, &ampMsat,
+		&artworkURL, &profileURL, &isLocked, &createdAt, &updatedAt); err != nil {
+		return nil, err
 	}
-	defer rows.Close()
-
-	var tracks []models.LegacyTrack
-	for rows.Next() {
-		var track models.LegacyTrack
-		err := rows.Scan(
-			&track.ID,
-			&track.ArtistID,
-			&track.AlbumID,
-			&track.Title,
-			&track.Order,
-			&track.PlayCount,
-			&track.MSatTotal,
-			&track.LiveURL,
-			&track.RawURL,
-			&track.Size,
-			&track.Duration,
-			&track.IsProcessing,
-			&track.IsDraft,
-			&track.IsExplicit,
-			&track.CompressorError,
-			&track.Deleted,
-			&track.Lyrics,
-			&track.CreatedAt,
-			&track.UpdatedAt,
-			&track.PublishedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan track: %w", err)
-		}
-		tracks = append(tracks, track)
+
+	user.Name = name.String
+	user.LightningAddress = lightningAddress.String
+	user.MSatBalance = msatBalance.Int64
+	user.AmpMsat = 1000
+	if ampMsat.Valid {
+		user.AmpMsat = int(ampMsat.Int64)
 	}
+	user.ArtworkURL = artworkURL.String
+	user.ProfileURL = profileURL.String
+	user.IsLocked = isLocked.Bool
+	user.CreatedAt = createdAt.Time
+	user.UpdatedAt = updatedAt.Time
+	return &user, nil
+}
 
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("failed to iterate tracks: %w", err)
+func scanLegacyTrack(row rowScanner) (*models.LegacyTrack, error) {
+	var track models.LegacyTrack
+	var title, liveURL, rawURL, lyrics sql.NullString
+	var order, playCount, msatTotal, size, duration sql.NullInt64
+	var isProcessing, isDraft, isExplicit, compressorError, deleted sql.NullBool
+	var createdAt, updatedAt, publishedAt sql.NullTime
+	if err := row.Scan(&track.ID, &track.ArtistID, &track.AlbumID, &title, &order, &playCount, &msatTotal,
+		&liveURL, &rawURL, &size, &duration, &isProcessing, &isDraft,
+		&isExplicit, &compressorError, &deleted, &lyrics,
+		&createdAt, &updatedAt, &publishedAt); err != nil {
+		return nil, err
 	}
 
-	return tracks, nil
+	track.Title = title.String
+	track.Order = int(order.Int64)
+	track.PlayCount = int(playCount.Int64)
+	track.MSatTotal = msatTotal.Int64
+	track.LiveURL = liveURL.String
+	track.RawURL = rawURL.String
+	track.Size = int(size.Int64)
+	track.Duration = int(duration.Int64)
+	track.IsProcessing = isProcessing.Bool
+	track.IsDraft = isDraft.Bool
+	track.IsExplicit = isExplicit.Bool
+	track.CompressorError = compressorError.Bool
+	track.Deleted = deleted.Bool
+	track.Lyrics = lyrics.String
+	track.CreatedAt = createdAt.Time
+	track.UpdatedAt = updatedAt.Time
+	track.PublishedAt = nullTime(publishedAt)
+	return &track, nil
+}
+
+func scanLegacyArtist(row rowScanner) (*models.LegacyArtist, error) {
+	var artist models.LegacyArtist
+	var name, artworkURL, artistURL, bio, twitter, instagram, youtube, website, npub sql.NullString
+	var verified, deleted sql.NullBool
+	var msatTotal sql.NullInt64
+	var createdAt, updatedAt sql.NullTime
+	if err := row.Scan(&artist.ID, &artist.UserID, &name, &artworkURL, &artistURL, &bio, &twitter,
+		&instagram, &youtube, &website, &npub, &verified, &deleted,
+		&msatTotal, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+
+	artist.Name = name.String
+	artist.ArtworkURL = artworkURL.String
+	artist.ArtistURL = artistURL.String
+	artist.Bio = bio.String
+	artist.Twitter = twitter.String
+	artist.Instagram = instagram.String
+	artist.Youtube = youtube.String
+	artist.Website = website.String
+	artist.Npub = npub.String
+	artist.Verified = verified.Bool
+	artist.Deleted = deleted.Bool
+	artist.MSatTotal = msatTotal.Int64
+	artist.CreatedAt = createdAt.Time
+	artist.UpdatedAt = updatedAt.Time
+	return &artist, nil
+}
+
+func scanLegacyAlbum(row rowScanner) (*models.LegacyAlbum, error) {
+	var album models.LegacyAlbum
+	var title, artworkURL, description sql.NullString
+	var genreID, subgenreID, msatTotal sql.NullInt64
+	var isDraft, isSingle, deleted, isFeedPublished sql.NullBool
+	var publishedAt, createdAt, updatedAt sql.NullTime
+	if err := row.Scan(&album.ID, &album.ArtistID, &title, &artworkURL, &description,
+		&genreID, &subgenreID, &isDraft, &isSingle, &deleted,
+		&msatTotal, &isFeedPublished, &publishedAt, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+
+	album.Title = title.String
+	album.ArtworkURL = artworkURL.String
+	album.Description = description.String
+	album.GenreID = int(genreID.Int64)
+	album.SubgenreID = int(subgenreID.Int64)
+	album.IsDraft = isDraft.Bool
+	album.IsSingle = isSingle.Bool
+	album.Deleted = deleted.Bool
+	album.MSatTotal = msatTotal.Int64
+	album.IsFeedPublished = !isFeedPublished.Valid || isFeedPublished.Bool
+	album.PublishedAt = nullTime(publishedAt)
+	album.CreatedAt = createdAt.Time
+	album.UpdatedAt = updatedAt.Time
+	return &album, nil
+}
+
+// nullTime returns a NULL-able timestamp as nil or a pointer to its time
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
 }
 
 // Ensure PostgresService implements the interface
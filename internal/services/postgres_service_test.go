@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/models"
+)
+
+func TestLegacyTrackFilterWhere(t *testing.T) {
+	isDraft := true
+	publishedSince := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		filter     LegacyTrackFilter
+		wantClause string
+		wantArgs   []interface{}
+	}{
+		{"default", LegacyTrackFilter{}, ` AND NOT COALESCE(t.deleted, false)`, []interface{}{"owner"}},
+		{"deleted", LegacyTrackFilter{Deleted: true}, ` AND COALESCE(t.deleted, false)`, []interface{}{"owner"}},
+		{"all filters", LegacyTrackFilter{IsDraft: &isDraft, PublishedSince: &publishedSince},
+			` AND NOT COALESCE(t.deleted, false) AND COALESCE(t.is_draft, false) = $2 AND t.published_at >= $3`,
+			[]interface{}{"owner", true, publishedSince}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clause, args := tt.filter.where([]interface{}{"owner"})
+			assert.Equal(t, tt.wantClause, clause)
+			assert.Equal(t, tt.wantArgs, args)
+		})
+	}
+}
+
+func TestLegacyTrackFilterPage(t *testing.T) {
+	limit, offset := LegacyTrackFilter{}.page()
+	assert.Equal(t, DefaultLegacyPageSize, limit)
+	assert.Zero(t, offset)
+
+	limit, offset = LegacyTrackFilter{Limit: 10000, Offset: -5}.page()
+	assert.Equal(t, MaxLegacyPageSize, limit)
+	assert.Zero(t, offset)
+}
+
+func TestLegacyError(t *testing.T) {
+	err := legacyError("failed to get user", sql.ErrNoRows)
+	assert.ErrorIs(t, err, ErrLegacyNotFound)
+	assert.NotErrorIs(t, err, ErrLegacyDatabase)
+
+	err = legacyError("failed to query tracks", sql.ErrConnDone)
+	assert.ErrorIs(t, err, ErrLegacyDatabase)
+	assert.ErrorIs(t, err, sql.ErrConnDone)
+	assert.NotErrorIs(t, err, ErrLegacyNotFound)
+	assert.Equal(t, "legacy database error: failed to query tracks: sql: connection is already closed", err.Error())
+}
+
+func newMockPostgres(t *testing.T) (*PostgresService, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, mock.ExpectationsWereMet())
+		db.Close()
+	})
+	return NewPostgresService(db), mock
+}
+
+// nullRow is a row of NULLs apart from the leading key columns
+func nullRow(columns []string, keys ...driver.Value) []driver.Value {
+	row := make([]driver.Value, len(columns))
+	copy(row, keys)
+	return row
+}
+
+var (
+	legacyUserColumns   = []string{"id", "name", "lightning_address", "msat_balance", "amp_msat", "artwork_url", "profile_url", "is_locked", "created_at", "updated_at"}
+	legacyTrackColumns  = []string{"id", "artist_id", "album_id", "title", "order", "play_count", "msat_total", "live_url", "raw_url", "size", "duration", "is_processing", "is_draft", "is_explicit", "compressor_error", "deleted", "lyrics", "created_at", "updated_at", "published_at"}
+	legacyArtistColumns = []string{"id", "user_id", "name", "artwork_url", "artist_url", "bio", "twitter", "instagram", "youtube", "website", "npub", "verified", "deleted", "msat_total", "created_at", "updated_at"}
+	legacyAlbumColumns  = []string{"id", "artist_id", "title", "artwork_url", "description", "genre_id", "subgenre_id", "is_draft", "is_single", "deleted", "msat_total", "is_feed_published", "published_at", "created_at", "updated_at"}
+)
+
+func TestGetUserByFirebaseUID_NullColumns(t *testing.T) {
+	p, mock := newMockPostgres(t)
+	mock.ExpectQuery(`FROM "user"`).WithArgs("uid").
+		WillReturnRows(sqlmock.NewRows(legacyUserColumns).AddRow(nullRow(legacyUserColumns, "uid")...))
+
+	user, err := p.GetUserByFirebaseUID(context.Background(), "uid")
+	require.NoError(t, err)
+	assert.Equal(t, &models.LegacyUser{ID: "uid", AmpMsat: 1000}, user)
+}
+
+func TestGetUserByFirebaseUID_NotFound(t *testing.T) {
+	p, mock := newMockPostgres(t)
+	mock.ExpectQuery(`FROM "user"`).WithArgs("uid").WillReturnRows(sqlmock.NewRows(legacyUserColumns))
+
+	_, err := p.GetUserByFirebaseUID(context.Background(), "uid")
+	assert.ErrorIs(t, err, ErrLegacyNotFound)
+}
+
+func TestGetUserTracks_NullColumns(t *testing.T) {
+	p, mock := newMockPostgres(t)
+	publishedAt := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+	published := nullRow(legacyTrackColumns, "track-2", "artist-1", "album-1")
+	published[3], published[4], published[7], published[19] = "Second", int64(2), "https://cdn.example.com/track-2.mp3", publishedAt
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT COUNT\(\*\)`).WithArgs("uid").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(`LIMIT \$2 OFFSET \$3`).WithArgs("uid", DefaultLegacyPageSize, 0).
+		WillReturnRows(sqlmock.NewRows(legacyTrackColumns).
+			AddRow(nullRow(legacyTrackColumns, "track-1", "artist-1", "album-1")...).
+			AddRow(published...))
+	mock.ExpectRollback()
+
+	tracks, total, err := p.GetUserTracks(context.Background(), "uid", LegacyTrackFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, []models.LegacyTrack{
+		{ID: "track-1", ArtistID: "artist-1", AlbumID: "album-1"},
+		{ID: "track-2", ArtistID: "artist-1", AlbumID: "album-1", Title: "Second", Order: 2,
+			LiveURL: "https://cdn.example.com/track-2.mp3", PublishedAt: &publishedAt},
+	}, tracks)
+
+	// NULL strings stay empty strings and a NULL published_at is omitted
+	encoded, err := json.Marshal(tracks[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(encoded), `"lyrics":""`)
+	assert.NotContains(t, string(encoded), "published_at")
+}
+
+func TestGetUserArtists_NullColumns(t *testing.T) {
+	p, mock := newMockPostgres(t)
+	mock.ExpectQuery(`FROM artist`).WithArgs("uid").
+		WillReturnRows(sqlmock.NewRows(legacyArtistColumns).AddRow(nullRow(legacyArtistColumns, "artist-1", "uid")...))
+
+	artists, err := p.GetUserArtists(context.Background(), "uid")
+	require.NoError(t, err)
+	assert.Equal(t, []models.LegacyArtist{{ID: "artist-1", UserID: "uid"}}, artists)
+}
+
+func TestGetUserAlbums_NullColumns(t *testing.T) {
+	p, mock := newMockPostgres(t)
+	mock.ExpectQuery(`FROM album al`).WithArgs("uid").
+		WillReturnRows(sqlmock.NewRows(legacyAlbumColumns).AddRow(nullRow(legacyAlbumColumns, "album-1", "artist-1")...))
+
+	albums, err := p.GetUserAlbums(context.Background(), "uid")
+	require.NoError(t, err)
+	assert.Equal(t, []models.LegacyAlbum{{ID: "album-1", ArtistID: "artist-1", IsFeedPublished: true}}, albums)
+
+	encoded, err := json.Marshal(albums[0])
+	require.NoError(t, err)
+	assert.NotContains(t, string(encoded), "published_at")
+}
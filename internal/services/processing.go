@@ -1,39 +1,131 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/wavlake/api/internal/logging"
 	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/recovery"
+	"github.com/wavlake/api/internal/telemetry"
 	"github.com/wavlake/api/internal/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// defaultVersionID names the version made by every processing run; its file
+// lives at the legacy compressed path
+const defaultVersionID = "default-128k-mp3"
+
 type ProcessingService struct {
-	storageService    StorageServiceInterface
-	nostrTrackService *NostrTrackService
-	audioProcessor    *utils.AudioProcessor
-	tempDir           string
-	pathConfig        *utils.StoragePathConfig
+	nostrTrackService   *NostrTrackService
+	audioProcessor      AudioProcessorInterface
+	notificationService NotificationServiceInterface
+	failureEmails       *FailureEmailNotifier
+	tempDir             string
+	tempSpaceFactor     int                             // See temp_space.go
+	diskFree            func(dir string) (int64, error) // Free bytes in the temp dir; replaced in tests
+	pathConfig          *utils.StoragePathConfig
+	previewLength       time.Duration // How long preview clips run; see track_preview.go
+	maxTrackDuration    time.Duration // Longest original accepted; see track_limits.go
+
+	// Storage class processed originals move to, empty to leave them; see
+	// original_archive.go
+	originalStorageClass string
+
+	// Versions of one compression request encoded at once, and the encoder
+	// they run, replaced in tests; see compression_batch.go
+	compressionWorkers int
+	compress           func(ctx context.Context, track *models.NostrTrack, versionID string, option models.CompressionOption) (*models.CompressionVersion, error)
+
+	// Processing job queue; see processing_jobs.go
+	workerID     string
+	maxAttempts  int
+	workers      int
+	pollInterval time.Duration
+	retryBackoff time.Duration
+	// processingTimeout bounds each processing and compression attempt
+	processingTimeout time.Duration
+	wake              chan struct{}
+	stop              chan struct{}
+	stopOnce          sync.Once
+
+	// Runs CancelProcessing can stop, by track; see processing_cancel.go
+	activeMu sync.Mutex
+	active   map[string]map[*activeRun]struct{}
+
+	// Stuck-track reconciliation; see processing_reconcile.go
+	stuckThreshold         time.Duration
+	stuckReconcileInterval time.Duration
+	now                    func() time.Time
+
+	// panicAlerter is told of panics recovered in processing goroutines; nil
+	// only logs them
+	panicAlerter recovery.Alerter
+}
+
+func NewProcessingService(nostrTrackService *NostrTrackService, audioProcessor AudioProcessorInterface, notificationService NotificationServiceInterface, failureEmails *FailureEmailNotifier, tempDir string, opts ...ProcessingOption) *ProcessingService {
+	p := &ProcessingService{
+		nostrTrackService:   nostrTrackService,
+		audioProcessor:      audioProcessor,
+		notificationService: notificationService,
+		failureEmails:       failureEmails,
+		tempDir:             tempDir,
+		tempSpaceFactor:     DefaultTempSpaceFactor,
+		diskFree:            diskFree,
+		pathConfig:          utils.GetStoragePathConfig(),
+		workerID:            uuid.New().String(),
+		maxAttempts:         DefaultProcessingMaxAttempts,
+		workers:             DefaultProcessingWorkers,
+		pollInterval:        DefaultProcessingPollInterval,
+		retryBackoff:        DefaultProcessingRetryBackoff,
+		processingTimeout:   DefaultProcessingTimeout,
+		previewLength:       DefaultPreviewLength,
+		maxTrackDuration:    DefaultMaxTrackDuration,
+		compressionWorkers:  DefaultCompressionWorkers,
+		stuckThreshold:      DefaultStuckProcessingThreshold,
+		now:                 time.Now,
+		stop:                make(chan struct{}),
+		active:              map[string]map[*activeRun]struct{}{},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	p.wake = make(chan struct{}, p.workers)
+	p.compress = p.compressVersion
+	return p
 }
 
-func NewProcessingService(storageService StorageServiceInterface, nostrTrackService *NostrTrackService, audioProcessor *utils.AudioProcessor, tempDir string) *ProcessingService {
-	return &ProcessingService{
-		storageService:    storageService,
-		nostrTrackService: nostrTrackService,
-		audioProcessor:    audioProcessor,
-		tempDir:           tempDir,
-		pathConfig:        utils.GetStoragePathConfig(),
+// WithPanicAlerter sets who is told when processing panics
+func WithPanicAlerter(alerter recovery.Alerter) ProcessingOption {
+	return func(p *ProcessingService) {
+		p.panicAlerter = alerter
 	}
 }
 
-// ProcessTrack downloads, analyzes, and compresses an uploaded track
-func (p *ProcessingService) ProcessTrack(ctx context.Context, trackID string) error {
-	log.Printf("Starting processing for track %s", trackID)
+// processClaimedTrack runs processing for a track this run has claimed
+func (p *ProcessingService) processClaimedTrack(ctx context.Context, run *processingRun) (err error) {
+	trackID := run.trackID
+	ctx, run.span = telemetry.Start(ctx, "ProcessingService.processTrack",
+		telemetry.AttributeTrackID.String(trackID),
+		attribute.String("wavlake.triggered_by", run.attempt.TriggeredBy),
+	)
+	defer func() { run.endSpans(err) }()
+
+	ctx, done := p.trackRunContext(ctx, trackID)
+	defer done()
+	logging.FromContext(ctx).Info("starting processing", "track_id", trackID, "triggered_by", run.attempt.TriggeredBy)
 
 	// Get track info
 	track, err := p.nostrTrackService.GetTrack(ctx, trackID)
@@ -41,6 +133,32 @@ func (p *ProcessingService) ProcessTrack(ctx context.Context, trackID string) er
 		return fmt.Errorf("failed to get track: %w", err)
 	}
 
+	p.recordRun(ctx, run)
+	defer p.nostrTrackService.Events().EndRun(trackID)
+
+	err = p.processTrackRecovered(ctx, track, run)
+	run.finish(err)
+	p.recordRun(ctx, run)
+	return err
+}
+
+// processTrackRecovered is processTrack with a panic failing the run as an
+// internal error, so the track is retried or marked failed rather than left
+// processing
+func (p *ProcessingService) processTrackRecovered(ctx context.Context, track *models.NostrTrack, run *processingRun) (err error) {
+	defer func() {
+		if errors.Is(err, recovery.ErrPanic) {
+			err = p.markProcessingFailed(ctx, run, models.ProcessingErrorInternal, err.Error())
+		}
+	}()
+	defer recovery.Catch(ctx, p.panicAlerter, "processing", &err, "track_id", track.ID)
+	return p.processTrack(ctx, track, run)
+}
+
+// processTrack runs the pipeline for a claimed track
+func (p *ProcessingService) processTrack(ctx context.Context, track *models.NostrTrack, run *processingRun) error {
+	trackID := track.ID
+
 	// Create temp files
 	originalPath := filepath.Join(p.tempDir, fmt.Sprintf("%s_original.%s", trackID, track.Extension))
 	compressedPath := filepath.Join(p.tempDir, fmt.Sprintf("%s_compressed.mp3", trackID))
@@ -50,47 +168,104 @@ func (p *ProcessingService) ProcessTrack(ctx context.Context, trackID string) er
 		_ = os.Remove(compressedPath) // #nosec G104 -- Cleanup operation, errors not critical
 	}()
 
-	// Download original file from GCS
-	if err := p.downloadFile(ctx, track.OriginalURL, originalPath); err != nil {
-		return p.markProcessingFailed(ctx, trackID, fmt.Sprintf("download failed: %v", err))
+	// Download original file from the track's storage region
+	storageService := p.nostrTrackService.StorageFor(track)
+	originalObjectName := p.pathConfig.GetOriginalPath(trackID, track.Extension)
+	ctx = p.reportStage(ctx, run, models.ProcessingStageDownloading)
+	if exceeded := p.originalSizeLimit(ctx, storageService, originalObjectName); exceeded != nil {
+		return p.markLimitExceeded(ctx, run, exceeded)
+	}
+	originalHash, err := p.downloadFile(ctx, storageService, originalObjectName, originalPath, p.downloadProgress(run))
+	if errors.Is(err, ErrInsufficientDiskSpace) {
+		return p.markProcessingFailed(ctx, run, models.ProcessingErrorDiskSpace, err.Error())
+	}
+	if err != nil {
+		return p.markProcessingFailed(ctx, run, models.ProcessingErrorDownload, fmt.Sprintf("download failed: %v", err))
 	}
 
-	// Validate it's a valid audio file
+	// Validate it's a valid audio file, checking the header matches the
+	// declared extension before anything decodes it
+	ctx = p.reportStage(ctx, run, models.ProcessingStageValidating)
+	if err := p.audioProcessor.CheckFormat(originalPath, track.Extension); errors.Is(err, utils.ErrFormatMismatch) {
+		return p.markProcessingFailed(ctx, run, models.ProcessingErrorFormat, err.Error())
+	} else if err != nil {
+		return p.markProcessingFailed(ctx, run, models.ProcessingErrorInternal, fmt.Sprintf("format check failed: %v", err))
+	}
 	if err := p.audioProcessor.ValidateAudioFile(ctx, originalPath); err != nil {
-		return p.markProcessingFailed(ctx, trackID, fmt.Sprintf("invalid audio file: %v", err))
+		return p.markProcessingFailed(ctx, run, models.ProcessingErrorInvalidAudio, fmt.Sprintf("invalid audio file: %v", err))
 	}
 
 	// Get audio metadata
 	audioInfo, err := p.audioProcessor.GetAudioInfo(ctx, originalPath)
 	if err != nil {
-		log.Printf("Warning: Could not get audio info for %s: %v", trackID, err)
+		logging.FromContext(ctx).Warn("could not get audio info", "track_id", trackID, "error", err)
 		// Continue processing even if we can't get metadata
 	}
+	if exceeded := p.durationLimit(audioInfo); exceeded != nil {
+		return p.markLimitExceeded(ctx, run, exceeded)
+	}
+
+	// Embedded tags only fill in metadata, so missing or corrupt ones are skipped
+	tags, err := p.audioProcessor.GetAudioTags(ctx, originalPath)
+	if err != nil {
+		logging.FromContext(ctx).Debug("could not read embedded tags", "track_id", trackID, "error", err)
+	}
 
 	// Compress the audio
+	ctx = p.reportStage(ctx, run, models.ProcessingStageCompressing)
 	if err := p.audioProcessor.CompressAudio(ctx, originalPath, compressedPath); err != nil {
-		return p.markProcessingFailed(ctx, trackID, fmt.Sprintf("compression failed: %v", err))
+		return p.markProcessingFailed(ctx, run, models.ProcessingErrorCompression, fmt.Sprintf("compression failed: %v", err))
+	}
+
+	// Don't upload files for a track nobody can see
+	if p.trackDeleted(ctx, trackID) {
+		return p.cancelRun(ctx, run)
 	}
 
 	// Upload compressed file to GCS
+	ctx = p.reportStage(ctx, run, models.ProcessingStageUploading)
 	compressedObjectName := p.pathConfig.GetCompressedPath(trackID)
 	compressedFile, err := os.Open(compressedPath) // #nosec G304 -- Opening controlled temp file for upload
 	if err != nil {
-		return p.markProcessingFailed(ctx, trackID, fmt.Sprintf("failed to open compressed file: %v", err))
+		return p.markProcessingFailed(ctx, run, models.ProcessingErrorUpload, fmt.Sprintf("failed to open compressed file: %v", err))
 	}
 	defer compressedFile.Close()
 
-	if err := p.storageService.UploadObject(ctx, compressedObjectName, compressedFile, "audio/mpeg"); err != nil {
-		return p.markProcessingFailed(ctx, trackID, fmt.Sprintf("failed to upload compressed file: %v", err))
+	hashed := newSHA256Reader(compressedFile)
+	if err := storageService.UploadObject(ctx, compressedObjectName, hashed, "audio/mpeg"); err != nil {
+		return p.markProcessingFailed(ctx, run, models.ProcessingErrorUpload, fmt.Sprintf("failed to upload compressed file: %v", err))
 	}
 
-	compressedURL := p.storageService.GetPublicURL(compressedObjectName)
+	compressedURL := storageService.GetPublicURL(compressedObjectName)
 
 	// Update track with processing results (legacy fields for backwards compatibility)
 	updates := map[string]interface{}{
-		"is_processing":  false,
 		"is_compressed":  true,
 		"compressed_url": compressedURL,
+		"original_hash":  originalHash,
+	}
+
+	// A track without a waveform still plays, so this never fails processing
+	if waveformURL, err := p.uploadWaveform(ctx, storageService, trackID, originalPath); err != nil {
+		logging.FromContext(ctx).Warn("failed to generate waveform", "track_id", trackID, "error", err)
+	} else {
+		updates["waveform_url"] = waveformURL
+	}
+
+	// Listeners without access to a full rendition hear the preview instead;
+	// the track works without one
+	var duration int
+	if audioInfo != nil {
+		duration = audioInfo.Duration
+	}
+	if previewURL, err := p.uploadPreview(ctx, storageService, trackID, originalPath, duration); err != nil {
+		logging.FromContext(ctx).Warn("failed to create preview", "track_id", trackID, "error", err)
+	} else {
+		updates["preview_url"] = previewURL
+	}
+
+	if tags != nil {
+		maps.Copy(updates, p.embeddedTagUpdates(ctx, storageService, track, originalPath, tags))
 	}
 
 	if audioInfo != nil {
@@ -98,20 +273,30 @@ func (p *ProcessingService) ProcessTrack(ctx context.Context, trackID string) er
 		updates["duration"] = audioInfo.Duration
 	}
 
-	if err := p.nostrTrackService.UpdateTrack(ctx, trackID, updates); err != nil {
-		log.Printf("Failed to update track %s after processing: %v", trackID, err)
+	// Files already uploaded are left for a purge to remove
+	if runCancelled(ctx) {
+		return p.cancelRun(ctx, run)
+	}
+
+	// The original is only read again for new versions and downloads once
+	// the track is compressed
+	maps.Copy(updates, p.archiveOriginal(ctx, storageService, track))
+
+	if err := p.nostrTrackService.TransitionTrack(ctx, trackID, models.TrackStatusReady, updates); err != nil {
+		logging.FromContext(ctx).Error("failed to update track after processing", "track_id", trackID, "error", err)
 		// Don't return error since processing succeeded
 	}
 
 	// Also add as a compression version for new system compatibility
 	defaultVersion := models.CompressionVersion{
-		ID:         "default-128k-mp3",
+		ID:         defaultVersionID,
 		URL:        compressedURL,
 		Bitrate:    128,
 		Format:     "mp3",
 		Quality:    "medium",
 		SampleRate: 44100,
-		Size:       0,    // Will be updated if we can get file info
+		Size:       0, // Will be updated if we can get file info
+		Hash:       hashed.Sum(),
 		IsPublic:   true, // Default compressed version is public for backwards compatibility
 		CreatedAt:  time.Now(),
 		Options: models.CompressionOption{
@@ -129,166 +314,481 @@ func (p *ProcessingService) ProcessTrack(ctx context.Context, trackID string) er
 
 	// Add default compression version (ignore errors to maintain backwards compatibility)
 	if err := p.nostrTrackService.AddCompressionVersion(ctx, trackID, defaultVersion); err != nil {
-		log.Printf("Warning: Failed to add default compression version for track %s: %v", trackID, err)
+		logging.FromContext(ctx).Warn("failed to add default compression version", "track_id", trackID, "error", err)
+	} else {
+		run.attempt.Versions = append(run.attempt.Versions, defaultVersion.ID)
 	}
 
-	log.Printf("Successfully processed track %s", trackID)
+	p.notifyTrack(track, models.NotificationTypeProcessingComplete, "Your track has finished processing and is ready to stream")
+
+	logging.FromContext(ctx).Info("processed track", "track_id", trackID)
 	return nil
 }
 
-// downloadFile downloads a file from a URL to local path
-func (p *ProcessingService) downloadFile(ctx context.Context, url, filePath string) error {
-	// For GCS URLs, we can use the storage client directly
-	// This is more efficient than HTTP download for files in the same project
+// downloadFile copies a stored object to a local path, verifying it against
+// the checksums storage recorded. It returns the file's hex SHA-256, or
+// ErrInsufficientDiskSpace without downloading if the temp dir is too full.
+// progress, if set, is called as the object is read.
+func (p *ProcessingService) downloadFile(ctx context.Context, storageService StorageServiceInterface, objectName, filePath string, progress readProgress) (string, error) {
+	if err := p.checkTempSpace(ctx, storageService, objectName); err != nil {
+		return "", err
+	}
+
+	objectReader, err := storageService.GetObjectReader(ctx, objectName)
+	if err != nil {
+		return "", fmt.Errorf("failed to create storage reader: %w", err)
+	}
+	defer objectReader.Close()
+
+	var reader io.Reader = objectReader
+	if progress != nil {
+		total, err := storageService.GetObjectSize(ctx, objectName)
+		if err != nil {
+			total = -1
+		}
+		reader = &progressReader{reader: objectReader, total: total, progress: progress}
+	}
 
 	// Create temp file
 	tempFile, err := os.Create(filePath) // #nosec G304 -- Creating controlled temp file for processing
 	if err != nil {
-		return fmt.Errorf("failed to create temp file: %w", err)
+		return "", fmt.Errorf("failed to create temp file: %w", err)
 	}
 	defer tempFile.Close()
 
-	// Extract object name from URL
-	// URL format: https://storage.googleapis.com/bucket/object
-	// We need to get the object name part
-	objectName := ""
-	if len(url) > 0 {
-		// Simple extraction - in production you might want more robust parsing
-		parts := filepath.Base(url)
-		if track, err := p.nostrTrackService.GetTrack(ctx, parts[:len(parts)-len(filepath.Ext(parts))]); err == nil {
-			objectName = p.pathConfig.GetOriginalPath(track.ID, track.Extension)
-		}
+	hashes := newDownloadHash()
+	if _, err := io.Copy(io.MultiWriter(tempFile, hashes), reader); err != nil {
+		return "", fmt.Errorf("failed to download file: %w", err)
 	}
 
-	if objectName == "" {
-		return fmt.Errorf("could not determine object name from URL")
+	checksums, err := storageService.GetObjectChecksums(ctx, objectName)
+	if err != nil {
+		return "", err
+	}
+	if err := hashes.Verify(checksums); err != nil {
+		return "", err
 	}
+	return hashes.SHA256(), nil
+}
 
-	// Download from storage
-	reader, err := p.storageService.GetObjectReader(ctx, objectName)
-	if err != nil {
-		return fmt.Errorf("failed to create storage reader: %w", err)
+// readProgress is called as a download is read, with the bytes read so far
+// and the total size, or -1 if unknown
+type readProgress func(read, total int64)
+
+// progressReader reports bytes read so far, out of total or -1 if unknown
+type progressReader struct {
+	reader   io.Reader
+	read     int64
+	total    int64
+	progress readProgress
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.read += int64(n)
+		r.progress(r.read, r.total)
 	}
-	defer reader.Close()
+	return n, err
+}
 
-	// Copy to temp file
-	if _, err := tempFile.ReadFrom(reader); err != nil {
-		return fmt.Errorf("failed to download file: %w", err)
+// markProcessingFailed records why a run failed. When the run's job will try
+// again and the failure might not repeat, the track stays processing and an
+// error wrapping errRetryProcessing is returned; otherwise the track is marked
+// failed.
+func (p *ProcessingService) markProcessingFailed(ctx context.Context, run *processingRun, errorClass, errorMsg string) error {
+	// A stage cut short by CancelProcessing didn't fail
+	if runCancelled(ctx) {
+		return p.cancelRun(ctx, run)
 	}
 
-	return nil
+	trackID := run.trackID
+	run.fail(errorClass, errorMsg)
+
+	// Invalid audio stays invalid however often it is tried
+	if run.canRetry && errorClass != models.ProcessingErrorInvalidAudio && errorClass != models.ProcessingErrorFormat {
+		logging.FromContext(ctx).Warn("processing attempt failed, will retry", "track_id", trackID, "error", errorMsg)
+		return fmt.Errorf("%w: %s", errRetryProcessing, errorMsg)
+	}
+
+	logging.FromContext(ctx).Error("processing failed", "track_id", trackID, "error", errorMsg)
+	return p.failTrack(ctx, trackID, errorClass, errorMsg)
 }
 
-// markProcessingFailed marks a track as failed processing
-func (p *ProcessingService) markProcessingFailed(ctx context.Context, trackID, errorMsg string) error {
-	log.Printf("Processing failed for track %s: %s", trackID, errorMsg)
+// cancelRun ends a run whose track was deleted. The track is already
+// cancelled, so only the run is recorded.
+func (p *ProcessingService) cancelRun(ctx context.Context, run *processingRun) error {
+	logging.FromContext(ctx).Info("processing cancelled, track was deleted", "track_id", run.trackID)
+	return ErrProcessingCancelled
+}
 
-	updates := map[string]interface{}{
-		"is_processing": false,
-		"error":         errorMsg,
+// failTrack marks a track as failed processing and tells its owner. A track
+// cancelled while processing stays cancelled and its owner isn't notified.
+// errorCode is the failure's ProcessingError class, if known.
+func (p *ProcessingService) failTrack(ctx context.Context, trackID, errorCode, errorMsg string) error {
+	return p.failTrackWith(ctx, trackID, errorCode, errorMsg, map[string]interface{}{})
+}
+
+// failTrackWith is failTrack with further fields to set on the track
+func (p *ProcessingService) failTrackWith(ctx context.Context, trackID, errorCode, errorMsg string, updates map[string]interface{}) error {
+	updates["error"] = errorMsg
+	if errorCode != "" {
+		updates["error_code"] = errorCode
+	}
+	if err := p.nostrTrackService.TransitionTrack(ctx, trackID, models.TrackStatusFailed, updates); err != nil {
+		return err
+	}
+
+	if track, err := p.nostrTrackService.GetTrack(ctx, trackID); err == nil {
+		p.notifyTrack(track, models.NotificationTypeProcessingFailed, "Processing failed for your track: "+errorMsg)
+		p.failureEmails.NotifyProcessingFailed(track.FirebaseUID, trackID, errorCode)
 	}
 
-	return p.nostrTrackService.UpdateTrack(ctx, trackID, updates)
+	return nil
 }
 
-// ProcessTrackAsync starts track processing in a goroutine
-func (p *ProcessingService) ProcessTrackAsync(ctx context.Context, trackID string) {
-	go func() {
-		// Create a background context with timeout
-		processCtx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
-		defer cancel()
+// stageSpanNames name the span of each pipeline stage
+var stageSpanNames = map[string]string{
+	models.ProcessingStageDownloading: "processing.download",
+	models.ProcessingStageValidating:  "processing.probe",
+	models.ProcessingStageCompressing: "processing.encode",
+	models.ProcessingStageUploading:   "processing.upload",
+}
 
-		if err := p.ProcessTrack(processCtx, trackID); err != nil {
-			log.Printf("Async processing failed for track %s: %v", trackID, err)
+// reportStage records the stage a run has reached, publishes a progress
+// event for the track's event stream and starts the stage's span, ending the
+// last stage's. The stage's work should use the context returned.
+func (p *ProcessingService) reportStage(ctx context.Context, run *processingRun, stage string) context.Context {
+	run.attempt.Phase = stage
+	p.nostrTrackService.Events().Publish(models.TrackEvent{
+		Type:    models.TrackEventProgress,
+		TrackID: run.trackID,
+		Status:  models.TrackStatusProcessing,
+		Stage:   stage,
+	})
+
+	run.endStage()
+	if run.span != nil {
+		// Stages are siblings under the run, whichever stage ctx came from
+		ctx = trace.ContextWithSpan(ctx, run.span)
+	}
+	ctx, run.stage = telemetry.Start(ctx, stageSpanNames[stage])
+	return ctx
+}
+
+// downloadProgressStep is the percentage download progress events are
+// rounded down to, so a download publishes at most a dozen
+const downloadProgressStep = 10
+
+// downloadProgress returns a callback publishing a run's download progress
+// each time it passes a multiple of downloadProgressStep percent
+func (p *ProcessingService) downloadProgress(run *processingRun) readProgress {
+	last := 0
+	return func(downloaded, total int64) {
+		if total <= 0 {
+			return
 		}
-	}()
+		percent := int(downloaded*100/total) / downloadProgressStep * downloadProgressStep
+		if percent <= last {
+			return
+		}
+		last = percent
+		p.nostrTrackService.Events().Publish(models.TrackEvent{
+			Type:    models.TrackEventProgress,
+			TrackID: run.trackID,
+			Status:  models.TrackStatusProcessing,
+			Stage:   models.ProcessingStageDownloading,
+			Percent: percent,
+		})
+	}
 }
 
-// RequestCompressionVersions queues multiple compression jobs for a track
-func (p *ProcessingService) RequestCompressionVersions(ctx context.Context, trackID string, compressionOptions []models.CompressionOption) error {
-	log.Printf("Requesting compression versions for track %s with %d options", trackID, len(compressionOptions))
+// notifyTrack records a notification for the track owner without blocking processing
+func (p *ProcessingService) notifyTrack(track *models.NostrTrack, notificationType, message string) {
+	if p.notificationService == nil || track == nil {
+		return
+	}
 
-	// Mark track as having pending compression
-	if err := p.nostrTrackService.SetPendingCompression(ctx, trackID, true); err != nil {
-		return fmt.Errorf("failed to mark track as pending compression: %w", err)
+	p.notificationService.Notify(models.Notification{
+		FirebaseUID: track.FirebaseUID,
+		Pubkey:      track.Pubkey,
+		TrackID:     track.ID,
+		Type:        notificationType,
+		Message:     message,
+	})
+}
+
+// ProcessTrackAsync claims the track for processing and queues a processing
+// job for the job workers. Duplicate triggers fail the claim with
+// ErrTrackAlreadyProcessing or ErrTrackAlreadyProcessed and queue nothing.
+func (p *ProcessingService) ProcessTrackAsync(ctx context.Context, trackID, triggeredBy string) error {
+	if err := p.nostrTrackService.ClaimTrackForProcessing(ctx, trackID); err != nil {
+		return err
 	}
+	return p.queueClaimedTrack(ctx, trackID, triggeredBy)
+}
 
-	// Process each compression option asynchronously
-	for _, option := range compressionOptions {
-		p.ProcessCompressionAsync(ctx, trackID, option)
+// ReprocessTrackAsync queues processing for a track even if another run holds
+// it, replacing that run's job, for tracks stuck processing. Ready tracks are
+// processed again.
+func (p *ProcessingService) ReprocessTrackAsync(ctx context.Context, trackID string) error {
+	if err := p.nostrTrackService.ForceClaimTrackForProcessing(ctx, trackID); err != nil {
+		return err
 	}
+	return p.queueClaimedTrack(ctx, trackID, models.ProcessingTriggerAdmin)
+}
 
+// queueClaimedTrack queues the job for a claimed track, failing the track if
+// the job can't be queued
+func (p *ProcessingService) queueClaimedTrack(ctx context.Context, trackID, triggeredBy string) error {
+	if err := p.enqueueJob(ctx, trackID, triggeredBy); err != nil {
+		// Don't leave the track processing with no job to finish it
+		if failErr := p.nostrTrackService.TransitionTrack(ctx, trackID, models.TrackStatusFailed, map[string]interface{}{"error": "failed to queue processing"}); failErr != nil {
+			logging.FromContext(ctx).Error("failed to mark track failed after queueing failed", "track_id", trackID, "error", failErr)
+		}
+		return err
+	}
 	return nil
 }
 
-// ProcessCompressionAsync processes a single compression option in background
-func (p *ProcessingService) ProcessCompressionAsync(ctx context.Context, trackID string, option models.CompressionOption) {
-	go func() {
-		// Create a background context with timeout
-		processCtx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
-		defer cancel()
+// RequestCompressionVersions queues compression for each requested option the
+// track doesn't already have a version for; see ReserveCompressionVersions.
+// Queued versions are compressed in the background, compressionWorkers at a
+// time; see compression_batch.go.
+func (p *ProcessingService) RequestCompressionVersions(ctx context.Context, trackID string, compressionOptions []models.CompressionOption) (*models.CompressionRequestResult, error) {
+	logging.FromContext(ctx).Info("requesting compression versions", "track_id", trackID, "options", len(compressionOptions))
+
+	// A version pending for longer than an attempt may run was abandoned
+	result, err := p.nostrTrackService.ReserveCompressionVersions(ctx, trackID, compressionOptions, time.Now().Add(-p.processingTimeout))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Queued) > 0 {
+		p.processReservedCompressionsAsync(ctx, trackID, result.Queued)
+	}
 
-		if err := p.ProcessCompression(processCtx, trackID, option); err != nil {
-			log.Printf("Async compression failed for track %s (option: %+v): %v", trackID, option, err)
+	return result, nil
+}
+
+// uploadWaveform computes a track's waveform peaks and uploads them as JSON,
+// returning the public URL
+func (p *ProcessingService) uploadWaveform(ctx context.Context, storageService StorageServiceInterface, trackID, audioPath string) (string, error) {
+	waveform, err := p.audioProcessor.GenerateWaveform(ctx, audioPath, utils.DefaultWaveformBuckets)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(waveform)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode waveform: %w", err)
+	}
+
+	objectName := p.pathConfig.GetWaveformPath(trackID)
+	if err := storageService.UploadObject(ctx, objectName, bytes.NewReader(data), "application/json"); err != nil {
+		return "", fmt.Errorf("failed to upload waveform: %w", err)
+	}
+	return storageService.GetPublicURL(objectName), nil
+}
+
+// embeddedTagFields are the track fields embedded tags can fill, in the order
+// they're listed in embedded_tags
+var embeddedTagFields = []string{"title", "artist", "album", "genre", "artwork_url"}
+
+// embeddedTagField returns the value of one of embeddedTagFields
+func embeddedTagField(track *models.NostrTrack, field string) string {
+	switch field {
+	case "title":
+		return track.Title
+	case "artist":
+		return track.Artist
+	case "album":
+		return track.Album
+	case "genre":
+		return track.Genre
+	case "artwork_url":
+		return track.ArtworkURL
+	}
+	return ""
+}
+
+// tagFillable reports whether embedded tags may fill a field: it's empty, or
+// was filled from tags and not written by anything else since
+func tagFillable(track *models.NostrTrack, field string) bool {
+	return embeddedTagField(track, field) == "" || slices.Contains(track.EmbeddedTags, field)
+}
+
+// embeddedTagUpdates returns the track updates filling metadata from a file's
+// embedded tags and uploading its cover art. Fields the user set are kept,
+// while fields filled from an earlier run's tags are refreshed; embedded_tags
+// lists the fields that were filled.
+func (p *ProcessingService) embeddedTagUpdates(ctx context.Context, storageService StorageServiceInterface, track *models.NostrTrack, audioPath string, tags *utils.AudioTags) map[string]interface{} {
+	fill := func(field, tagged string) string {
+		if tagFillable(track, field) {
+			return tagged
 		}
-	}()
+		return ""
+	}
+
+	updates := searchFieldUpdates(fill("title", tags.Title), fill("artist", tags.Artist))
+	if album := fill("album", tags.Album); album != "" {
+		updates["album"] = album
+	}
+	if genre := fill("genre", tags.Genre); genre != "" {
+		updates["genre"] = genre
+	}
+	if tags.HasArtwork && tagFillable(track, "artwork_url") {
+		if artworkURL, err := p.uploadArtwork(ctx, storageService, track.ID, audioPath); err != nil {
+			logging.FromContext(ctx).Debug("could not extract artwork", "track_id", track.ID, "error", err)
+		} else {
+			updates["artwork_url"] = artworkURL
+		}
+	}
+
+	var filled []string
+	for _, field := range embeddedTagFields {
+		if _, ok := updates[field]; ok {
+			filled = append(filled, field)
+		}
+	}
+	if len(filled) > 0 {
+		updates["embedded_tags"] = filled
+	}
+	return updates
 }
 
-// ProcessCompression creates a single compressed version of a track
-func (p *ProcessingService) ProcessCompression(ctx context.Context, trackID string, option models.CompressionOption) error {
-	versionID := uuid.New().String()
-	log.Printf("Starting compression for track %s, version %s (bitrate: %d, format: %s)", trackID, versionID, option.Bitrate, option.Format)
+// withoutEditedTags drops the fields of a run's embedded tag updates that were
+// written by something else since the run read the track, checked against the
+// stored track as the run's results are saved
+func withoutEditedTags(track *models.NostrTrack, updates map[string]interface{}) map[string]interface{} {
+	filled, ok := updates["embedded_tags"].([]string)
+	if !ok {
+		return updates
+	}
+
+	kept := maps.Clone(updates)
+	var still []string
+	for _, field := range filled {
+		if tagFillable(track, field) {
+			still = append(still, field)
+			continue
+		}
+		delete(kept, field)
+		delete(kept, field+"_normalized")
+	}
+	if len(still) == 0 {
+		delete(kept, "embedded_tags")
+	} else {
+		kept["embedded_tags"] = still
+	}
+	return kept
+}
 
-	// Get track info
-	track, err := p.nostrTrackService.GetTrack(ctx, trackID)
+// uploadArtwork extracts a file's cover art and uploads it as a JPEG,
+// returning the public URL
+func (p *ProcessingService) uploadArtwork(ctx context.Context, storageService StorageServiceInterface, trackID, audioPath string) (string, error) {
+	artworkPath := filepath.Join(p.tempDir, fmt.Sprintf("%s_artwork.jpg", trackID))
+	defer func() {
+		_ = os.Remove(artworkPath) // #nosec G104 -- Cleanup operation, errors not critical
+	}()
+
+	if err := p.audioProcessor.ExtractArtwork(ctx, audioPath, artworkPath); err != nil {
+		return "", err
+	}
+	artworkFile, err := os.Open(artworkPath) // #nosec G304 -- Opening controlled temp file for upload
 	if err != nil {
-		return fmt.Errorf("failed to get track: %w", err)
+		return "", fmt.Errorf("failed to open artwork: %w", err)
+	}
+	defer artworkFile.Close()
+
+	objectName := p.pathConfig.GetArtworkPath(trackID)
+	if err := storageService.UploadObject(ctx, objectName, artworkFile, "image/jpeg"); err != nil {
+		return "", fmt.Errorf("failed to upload artwork: %w", err)
+	}
+	return storageService.GetPublicURL(objectName), nil
+}
+
+// compressVersion compresses and uploads one version of a track, returning
+// the completed version record without saving it
+func (p *ProcessingService) compressVersion(ctx context.Context, track *models.NostrTrack, versionID string, option models.CompressionOption) (_ *models.CompressionVersion, err error) {
+	ctx, span := telemetry.Start(ctx, "ProcessingService.compressVersion",
+		telemetry.AttributeTrackID.String(track.ID),
+		attribute.String("wavlake.version_id", versionID),
+		attribute.String("wavlake.format", option.Format),
+	)
+	defer func() { telemetry.End(span, err) }()
+
+	ctx, done := p.trackRunContext(ctx, track.ID)
+	defer done()
+
+	// Originals ffmpeg can decode from a pipe are streamed through it. One
+	// that fails the ranged probe goes through temp files, where the whole
+	// file is validated.
+	storageService := p.nostrTrackService.StorageFor(track)
+	if utils.IsStreamable(track.Extension) {
+		original, err := p.probeOriginal(ctx, storageService, p.pathConfig.GetOriginalPath(track.ID, track.Extension), track.Extension)
+		if err == nil {
+			return p.compressVersionStream(ctx, storageService, track, versionID, option, original)
+		}
+		if runCancelled(ctx) {
+			return nil, ErrProcessingCancelled
+		}
+		logging.FromContext(ctx).Warn("could not probe original for streaming, compressing from temp files", "track_id", track.ID, "error", err)
 	}
 
 	// Create temp files
-	originalPath := filepath.Join(p.tempDir, fmt.Sprintf("%s_original.%s", trackID, track.Extension))
-	compressedPath := filepath.Join(p.tempDir, fmt.Sprintf("%s_%s_compressed.%s", trackID, versionID, option.Format))
+	// Named for the version too, so concurrent compressions of one track, and
+	// processing, don't overwrite or remove each other's original
+	originalPath := filepath.Join(p.tempDir, fmt.Sprintf("%s_%s_original.%s", track.ID, versionID, track.Extension))
+	compressedPath := filepath.Join(p.tempDir, fmt.Sprintf("%s_%s_compressed.%s", track.ID, versionID, option.Format))
 
 	defer func() {
 		_ = os.Remove(originalPath)   // #nosec G104 -- Cleanup operation, errors not critical
 		_ = os.Remove(compressedPath) // #nosec G104 -- Cleanup operation, errors not critical
 	}()
 
-	// Download original file from GCS
-	if err := p.downloadFile(ctx, track.OriginalURL, originalPath); err != nil {
-		return fmt.Errorf("download failed: %v", err)
+	// Download original file from the track's storage region
+	if _, err := p.downloadFile(ctx, storageService, p.pathConfig.GetOriginalPath(track.ID, track.Extension), originalPath, nil); err != nil {
+		return nil, fmt.Errorf("download failed: %w", err)
 	}
 
 	// Validate it's a valid audio file
 	if err := p.audioProcessor.ValidateAudioFile(ctx, originalPath); err != nil {
-		return fmt.Errorf("invalid audio file: %v", err)
+		return nil, fmt.Errorf("invalid audio file: %v", err)
 	}
 
 	// Compress with specific options
 	if err := p.audioProcessor.CompressAudioWithOptions(ctx, originalPath, compressedPath, option); err != nil {
-		return fmt.Errorf("compression failed: %v", err)
+		if runCancelled(ctx) {
+			return nil, ErrProcessingCancelled
+		}
+		return nil, fmt.Errorf("compression failed: %v", err)
+	}
+	if p.trackDeleted(ctx, track.ID) {
+		return nil, ErrProcessingCancelled
 	}
 
 	// Get compressed file info
 	compressedInfo, err := os.Stat(compressedPath)
 	if err != nil {
-		return fmt.Errorf("failed to get compressed file info: %v", err)
+		return nil, fmt.Errorf("failed to get compressed file info: %v", err)
 	}
 
 	// Upload compressed file to GCS
-	compressedObjectName := p.pathConfig.GetCompressedVersionPath(trackID, versionID, option.Format)
+	compressedObjectName := p.pathConfig.GetCompressedVersionPath(track.ID, versionID, option.Format)
 	compressedFile, err := os.Open(compressedPath) // #nosec G304 -- Opening controlled temp file for upload
 	if err != nil {
-		return fmt.Errorf("failed to open compressed file: %v", err)
+		return nil, fmt.Errorf("failed to open compressed file: %v", err)
 	}
 	defer compressedFile.Close()
 
+	// Hash while uploading, so the file is only read once
 	contentType := getContentTypeForFormat(option.Format)
-	if err := p.storageService.UploadObject(ctx, compressedObjectName, compressedFile, contentType); err != nil {
-		return fmt.Errorf("failed to upload compressed file: %v", err)
+	hashed := newSHA256Reader(compressedFile)
+	if err := storageService.UploadObject(ctx, compressedObjectName, hashed, contentType); err != nil {
+		return nil, fmt.Errorf("failed to upload compressed file: %v", err)
 	}
 
-	compressedURL := p.storageService.GetPublicURL(compressedObjectName)
+	compressedURL := storageService.GetPublicURL(compressedObjectName)
 
 	// Get actual audio info from compressed file
 	actualInfo, err := p.audioProcessor.GetAudioInfo(ctx, compressedPath)
@@ -308,30 +808,20 @@ func (p *ProcessingService) ProcessCompression(ctx context.Context, trackID stri
 		Quality:    option.Quality,
 		SampleRate: actualSampleRate,
 		Size:       compressedInfo.Size(),
+		Hash:       hashed.Sum(),
+		Status:     models.VersionStatusCompleted,
 		IsPublic:   false, // Default to private, user can make public later
 		CreatedAt:  time.Now(),
 		Options:    option,
 	}
 
-	// Add to track
-	if err := p.nostrTrackService.AddCompressionVersion(ctx, trackID, version); err != nil {
-		return fmt.Errorf("failed to save compression version: %v", err)
-	}
-
-	log.Printf("Successfully created compression version %s for track %s", versionID, trackID)
-	return nil
+	return &version, nil
 }
 
 // getContentTypeForFormat returns the appropriate MIME type for audio formats
 func getContentTypeForFormat(format string) string {
-	switch format {
-	case "mp3":
-		return "audio/mpeg"
-	case "aac":
-		return "audio/aac"
-	case "ogg":
-		return "audio/ogg"
-	default:
-		return "audio/mpeg"
+	if compression, ok := utils.CompressionFormats[format]; ok {
+		return compression.ContentType
 	}
+	return "audio/mpeg"
 }
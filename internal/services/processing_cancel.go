@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+)
+
+// ErrProcessingCancelled is returned by processing and compression runs that
+// stopped because their track was deleted
+var ErrProcessingCancelled = errors.New("processing cancelled")
+
+// activeRun is one processing or compression run CancelProcessing can stop
+type activeRun struct {
+	cancel context.CancelCauseFunc
+}
+
+// trackRunContext derives a context for a run on trackID that
+// CancelProcessing cancels. Call done when the run ends.
+func (p *ProcessingService) trackRunContext(ctx context.Context, trackID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	run := &activeRun{cancel: cancel}
+
+	p.activeMu.Lock()
+	if p.active[trackID] == nil {
+		p.active[trackID] = map[*activeRun]struct{}{}
+	}
+	p.active[trackID][run] = struct{}{}
+	p.activeMu.Unlock()
+
+	return ctx, func() {
+		p.activeMu.Lock()
+		delete(p.active[trackID], run)
+		if len(p.active[trackID]) == 0 {
+			delete(p.active, trackID)
+		}
+		p.activeMu.Unlock()
+		cancel(nil)
+	}
+}
+
+// CancelProcessing stops this instance's processing and compression runs for
+// a track, returning how many it stopped. Runs on other instances see the
+// track is deleted before they upload results.
+func (p *ProcessingService) CancelProcessing(trackID string) int {
+	p.activeMu.Lock()
+	defer p.activeMu.Unlock()
+
+	for run := range p.active[trackID] {
+		run.cancel(ErrProcessingCancelled)
+	}
+	if n := len(p.active[trackID]); n > 0 {
+		log.Printf("Cancelled %d processing runs for track %s", n, trackID)
+		return n
+	}
+	return 0
+}
+
+// runCancelled reports whether CancelProcessing stopped the run ctx belongs to
+func runCancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrProcessingCancelled)
+}
+
+// trackDeleted reports whether a run should stop before uploading results,
+// because it was cancelled or the track was deleted on another instance,
+// where CancelProcessing couldn't reach it
+func (p *ProcessingService) trackDeleted(ctx context.Context, trackID string) bool {
+	if runCancelled(ctx) {
+		return true
+	}
+	track, err := p.nostrTrackService.GetTrack(ctx, trackID)
+	return err == nil && track.Deleted
+}
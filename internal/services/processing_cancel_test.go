@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/utils"
+)
+
+// slowAudio accepts any file and blocks in compression until its context
+// ends, closing started when compression begins
+type slowAudio struct {
+	AudioProcessorInterface
+	started chan struct{}
+}
+
+func (a *slowAudio) ValidateAudioFile(ctx context.Context, filePath string) error {
+	return nil
+}
+
+func (a *slowAudio) CheckFormat(filePath, extension string) error {
+	return nil
+}
+
+func (a *slowAudio) GetAudioInfo(ctx context.Context, inputPath string) (*utils.AudioInfo, error) {
+	return &utils.AudioInfo{Duration: 180}, nil
+}
+
+func (a *slowAudio) GetAudioTags(ctx context.Context, inputPath string) (*utils.AudioTags, error) {
+	return nil, errors.New("no tags")
+}
+
+func (a *slowAudio) CompressAudio(ctx context.Context, inputPath, outputPath string) error {
+	close(a.started)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestCancelProcessingStopsRunMidway(t *testing.T) {
+	storage := &fakeObjectStorage{objects: map[string]string{"tracks/original/abc.wav": "audio bytes"}}
+	audio := &slowAudio{started: make(chan struct{})}
+	p := NewProcessingService(NewNostrTrackService(nil, NewStorageRegions("us", storage)), audio, nil, nil, t.TempDir())
+
+	track := &models.NostrTrack{ID: "abc", Extension: "wav"}
+	run := newProcessingRun(track.ID, models.ProcessingTriggerWebhook)
+	run.canRetry = true
+
+	ctx, done := p.trackRunContext(context.Background(), track.ID)
+	defer done()
+	result := make(chan error, 1)
+	go func() { result <- p.processTrack(ctx, track, run) }()
+
+	select {
+	case <-audio.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("processing never reached compression")
+	}
+	assert.Equal(t, 0, p.CancelProcessing("other-track"))
+	assert.Equal(t, 1, p.CancelProcessing(track.ID))
+
+	var err error
+	select {
+	case err = <-result:
+	case <-time.After(5 * time.Second):
+		t.Fatal("processing didn't stop after being cancelled")
+	}
+
+	// The run stops without failing the track or uploading anything
+	assert.ErrorIs(t, err, ErrProcessingCancelled)
+	assert.Empty(t, run.attempt.ErrorClass)
+	assert.NotContains(t, storage.objects, p.pathConfig.GetCompressedPath(track.ID))
+
+	run.finish(err)
+	assert.Equal(t, models.ProcessingOutcomeCancelled, run.attempt.Outcome)
+}
+
+func TestTrackRunContextCancelsEveryRunForTheTrack(t *testing.T) {
+	p := NewProcessingService(nil, nil, nil, nil, t.TempDir())
+
+	first, doneFirst := p.trackRunContext(context.Background(), "abc")
+	second, doneSecond := p.trackRunContext(context.Background(), "abc")
+	other, doneOther := p.trackRunContext(context.Background(), "def")
+	defer doneOther()
+
+	assert.Equal(t, 2, p.CancelProcessing("abc"))
+	assert.True(t, runCancelled(first))
+	assert.True(t, runCancelled(second))
+	assert.False(t, runCancelled(other))
+
+	doneFirst()
+	doneSecond()
+	assert.Equal(t, 0, p.CancelProcessing("abc"))
+	assert.NotContains(t, p.active, "abc")
+
+	// A run that ended normally isn't reported as cancelled
+	doneOther()
+	require.Error(t, other.Err())
+	assert.False(t, runCancelled(other))
+}
+
+// panickingAudio accepts any file and panics in compression
+type panickingAudio struct {
+	slowAudio
+}
+
+func (a *panickingAudio) CompressAudio(ctx context.Context, inputPath, outputPath string) error {
+	var info *utils.AudioInfo
+	_ = info.Duration
+	return nil
+}
+
+func TestProcessTrackRecoveredRetriesAfterPanic(t *testing.T) {
+	storage := &fakeObjectStorage{objects: map[string]string{"tracks/original/abc.wav": "audio bytes"}}
+	p := NewProcessingService(NewNostrTrackService(nil, NewStorageRegions("us", storage)), &panickingAudio{}, nil, nil, t.TempDir())
+
+	track := &models.NostrTrack{ID: "abc", Extension: "wav"}
+	run := newProcessingRun(track.ID, models.ProcessingTriggerWebhook)
+	run.canRetry = true
+
+	// The panic fails the attempt like any internal error, which the job retries
+	err := p.processTrackRecovered(context.Background(), track, run)
+	assert.ErrorIs(t, err, errRetryProcessing)
+	assert.Contains(t, err.Error(), "nil pointer dereference")
+	assert.Equal(t, models.ProcessingErrorInternal, run.attempt.ErrorClass)
+	assert.Equal(t, models.ProcessingStageCompressing, run.attempt.Phase)
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/telemetry"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// trackHistoryCollection is the per-track subcollection holding one
+	// document per processing attempt
+	trackHistoryCollection = "processing_history"
+
+	// MaxProcessingHistoryEntries is how many attempts are kept per track;
+	// older ones are pruned when a new attempt starts
+	MaxProcessingHistoryEntries = 50
+
+	// DefaultHistoryPageSize and MaxHistoryPageSize bound history pages
+	DefaultHistoryPageSize = 20
+	MaxHistoryPageSize     = 100
+
+	// historyWriteTimeout bounds each best-effort history write
+	historyWriteTimeout = 10 * time.Second
+)
+
+// ErrInvalidHistoryCursor is returned for a page cursor that doesn't name one
+// of the track's history entries
+var ErrInvalidHistoryCursor = errors.New("invalid cursor")
+
+// RecordProcessingAttempt writes a processing attempt to the track's history,
+// replacing any earlier write of the same attempt. When an attempt starts, the
+// oldest entries beyond MaxProcessingHistoryEntries are removed.
+func (s *NostrTrackService) RecordProcessingAttempt(ctx context.Context, trackID string, attempt models.ProcessingAttempt) error {
+	history := s.firestoreClient.Collection("nostr_tracks").Doc(trackID).Collection(trackHistoryCollection)
+	if _, err := history.Doc(attempt.ID).Set(ctx, attempt); err != nil {
+		return fmt.Errorf("failed to record processing attempt: %w", err)
+	}
+
+	if attempt.FinishedAt != nil {
+		return nil
+	}
+
+	stale, err := history.OrderBy("started_at", firestore.Desc).Offset(MaxProcessingHistoryEntries).Documents(ctx).GetAll()
+	if err != nil {
+		return fmt.Errorf("failed to list old processing attempts: %w", err)
+	}
+	for _, doc := range stale {
+		if _, err := doc.Ref.Delete(ctx); err != nil {
+			return fmt.Errorf("failed to prune processing attempt %s: %w", doc.Ref.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// ListProcessingHistory returns a page of a track's processing attempts, newest
+// first. The returned cursor is the ID of the last attempt on the page and is
+// empty when there are no more results.
+func (s *NostrTrackService) ListProcessingHistory(ctx context.Context, trackID string, limit int, cursor string) ([]models.ProcessingAttempt, string, error) {
+	if limit <= 0 {
+		limit = DefaultHistoryPageSize
+	}
+	if limit > MaxHistoryPageSize {
+		limit = MaxHistoryPageSize
+	}
+
+	history := s.firestoreClient.Collection("nostr_tracks").Doc(trackID).Collection(trackHistoryCollection)
+	query := history.OrderBy("started_at", firestore.Desc)
+	if cursor != "" {
+		cursorDoc, err := history.Doc(cursor).Get(ctx)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return nil, "", ErrInvalidHistoryCursor
+			}
+			return nil, "", fmt.Errorf("failed to get cursor attempt: %w", err)
+		}
+		query = query.StartAfter(cursorDoc)
+	}
+
+	// Fetch one extra document to know whether another page exists
+	iter := query.Limit(limit + 1).Documents(ctx)
+	defer iter.Stop()
+
+	attempts := []models.ProcessingAttempt{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to iterate processing history: %w", err)
+		}
+
+		var attempt models.ProcessingAttempt
+		if err := doc.DataTo(&attempt); err != nil {
+			log.Printf("Failed to decode processing attempt %s for track %s: %v", doc.Ref.ID, trackID, err)
+			continue
+		}
+		attempts = append(attempts, attempt)
+	}
+
+	nextCursor := ""
+	if len(attempts) > limit {
+		attempts = attempts[:limit]
+		nextCursor = attempts[limit-1].ID
+	}
+
+	return attempts, nextCursor, nil
+}
+
+// processingRun collects what happens during one processing attempt
+type processingRun struct {
+	trackID string
+	attempt models.ProcessingAttempt
+
+	// canRetry is set when the run's job has attempts left, so failures that
+	// might not repeat are retried instead of failing the track
+	canRetry bool
+
+	// span traces the run, and stage the pipeline stage it is in
+	span  trace.Span
+	stage trace.Span
+}
+
+func newProcessingRun(trackID, triggeredBy string) *processingRun {
+	return &processingRun{
+		trackID: trackID,
+		attempt: models.ProcessingAttempt{
+			ID:          uuid.New().String(),
+			StartedAt:   time.Now(),
+			TriggeredBy: triggeredBy,
+			Outcome:     models.ProcessingOutcomeRunning,
+		},
+	}
+}
+
+// fail records why the attempt failed; the first failure wins
+func (r *processingRun) fail(errorClass, message string) {
+	if r.attempt.ErrorClass != "" {
+		return
+	}
+	r.attempt.ErrorClass = errorClass
+	r.attempt.Error = message
+	if r.stage != nil {
+		r.stage.SetStatus(otelcodes.Error, message)
+	}
+}
+
+// endStage ends the span of the stage the run is in, if any
+func (r *processingRun) endStage() {
+	if r.stage != nil {
+		r.stage.End()
+		r.stage = nil
+	}
+}
+
+// endSpans ends the run's spans, marking the run's failed if the attempt
+// failed or err is set
+func (r *processingRun) endSpans(err error) {
+	r.endStage()
+	if r.span == nil {
+		return
+	}
+	if r.attempt.ErrorClass != "" {
+		r.span.SetStatus(otelcodes.Error, r.attempt.Error)
+	}
+	telemetry.End(r.span, err)
+}
+
+// finish closes the attempt. An error the run didn't classify is internal.
+func (r *processingRun) finish(err error) {
+	now := time.Now()
+	r.attempt.FinishedAt = &now
+	if errors.Is(err, ErrProcessingCancelled) {
+		r.attempt.Outcome = models.ProcessingOutcomeCancelled
+		return
+	}
+	if err != nil {
+		r.fail(models.ProcessingErrorInternal, err.Error())
+	}
+	if r.attempt.ErrorClass != "" {
+		r.attempt.Outcome = models.ProcessingOutcomeFailed
+	} else {
+		r.attempt.Outcome = models.ProcessingOutcomeSucceeded
+	}
+}
+
+// recordRun saves the run to the track's history. It is best-effort: failures
+// are logged and the write survives the processing context being cancelled.
+func (p *ProcessingService) recordRun(ctx context.Context, run *processingRun) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), historyWriteTimeout)
+	defer cancel()
+
+	if err := p.nostrTrackService.RecordProcessingAttempt(ctx, run.trackID, run.attempt); err != nil {
+		log.Printf("Failed to record processing history for track %s: %v", run.trackID, err)
+	}
+}
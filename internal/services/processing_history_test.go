@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/models"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestProcessingRunOutcome(t *testing.T) {
+	run := newProcessingRun("track-1", models.ProcessingTriggerWebhook)
+	assert.NotEmpty(t, run.attempt.ID)
+	assert.Equal(t, models.ProcessingOutcomeRunning, run.attempt.Outcome)
+	assert.Nil(t, run.attempt.FinishedAt)
+
+	run.finish(nil)
+	assert.Equal(t, models.ProcessingOutcomeSucceeded, run.attempt.Outcome)
+	assert.NotNil(t, run.attempt.FinishedAt)
+	assert.Empty(t, run.attempt.ErrorClass)
+}
+
+func TestProcessingRunKeepsFirstFailure(t *testing.T) {
+	run := newProcessingRun("track-1", models.ProcessingTriggerManual)
+	run.fail(models.ProcessingErrorInvalidAudio, "invalid audio file: not audio")
+
+	// markProcessingFailed can still return an error, e.g. for a cancelled
+	// track; the recorded cause stays the pipeline failure
+	run.finish(errors.New("invalid track status transition: cancelled to failed"))
+
+	assert.Equal(t, models.ProcessingOutcomeFailed, run.attempt.Outcome)
+	assert.Equal(t, models.ProcessingErrorInvalidAudio, run.attempt.ErrorClass)
+	assert.Equal(t, "invalid audio file: not audio", run.attempt.Error)
+}
+
+func TestProcessingRunUnclassifiedErrorIsInternal(t *testing.T) {
+	run := newProcessingRun("track-1", models.ProcessingTriggerRetry)
+	run.finish(errors.New("failed to start processing: track was modified concurrently"))
+
+	assert.Equal(t, models.ProcessingOutcomeFailed, run.attempt.Outcome)
+	assert.Equal(t, models.ProcessingErrorInternal, run.attempt.ErrorClass)
+}
+
+func TestProcessingRunSpansMarkFailure(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	run := newProcessingRun("track-1", models.ProcessingTriggerWebhook)
+	ctx, span := tracer.Start(context.Background(), "ProcessingService.processTrack")
+	run.span = span
+	_, run.stage = tracer.Start(ctx, "processing.probe")
+
+	run.fail(models.ProcessingErrorInvalidAudio, "invalid audio file: not audio")
+	run.endSpans(nil)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "processing.probe", spans[0].Name())
+	assert.Equal(t, "ProcessingService.processTrack", spans[1].Name())
+	for _, span := range spans {
+		assert.Equal(t, codes.Error, span.Status().Code)
+		assert.Equal(t, "invalid audio file: not audio", span.Status().Description)
+	}
+	assert.Nil(t, run.stage)
+}
@@ -0,0 +1,486 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/wavlake/api/internal/logging"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/recovery"
+	"github.com/wavlake/api/internal/telemetry"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// processingJobsCollection holds one processing job per track, keyed by
+	// track ID. Queueing a track again replaces its finished job.
+	processingJobsCollection = "processing_jobs"
+
+	// DefaultProcessingMaxAttempts is how many times a job runs before its
+	// track is marked failed
+	DefaultProcessingMaxAttempts = 3
+
+	// DefaultProcessingWorkers is how many jobs an instance runs at once
+	DefaultProcessingWorkers = 2
+
+	// DefaultProcessingPollInterval is how often idle workers look for due jobs
+	DefaultProcessingPollInterval = 5 * time.Second
+
+	// DefaultProcessingRetryBackoff is the delay before a job's first retry. It
+	// doubles with each attempt, up to maxProcessingRetryBackoff.
+	DefaultProcessingRetryBackoff = 30 * time.Second
+	maxProcessingRetryBackoff     = 10 * time.Minute
+
+	// DefaultProcessingTimeout bounds one attempt. Leases outlast the timeout
+	// by processingLeaseMargin, so a worker that is still running never loses
+	// its job.
+	DefaultProcessingTimeout = 10 * time.Minute
+	processingLeaseMargin    = 5 * time.Minute
+
+	// processingReconcileInterval is how often expired leases are looked for
+	// after the pass at startup
+	processingReconcileInterval = time.Minute
+
+	// processingClaimBatch is how many due jobs a worker tries to claim per query
+	processingClaimBatch = 5
+
+	// processingQueueTimeout bounds the queue reads and writes around a run
+	processingQueueTimeout = 30 * time.Second
+)
+
+// errRetryProcessing is wrapped by run errors the job will retry
+var errRetryProcessing = errors.New("processing will be retried")
+
+// ProcessingOption configures a ProcessingService
+type ProcessingOption func(*ProcessingService)
+
+// WithProcessingMaxAttempts sets how many times a job runs before its track
+// is marked failed
+func WithProcessingMaxAttempts(attempts int) ProcessingOption {
+	return func(p *ProcessingService) {
+		if attempts > 0 {
+			p.maxAttempts = attempts
+		}
+	}
+}
+
+// WithProcessingWorkers sets how many jobs an instance runs at once
+func WithProcessingWorkers(workers int) ProcessingOption {
+	return func(p *ProcessingService) {
+		if workers > 0 {
+			p.workers = workers
+		}
+	}
+}
+
+// WithProcessingPollInterval sets how often idle workers look for due jobs
+func WithProcessingPollInterval(interval time.Duration) ProcessingOption {
+	return func(p *ProcessingService) {
+		if interval > 0 {
+			p.pollInterval = interval
+		}
+	}
+}
+
+// WithProcessingRetryBackoff sets the delay before a job's first retry
+func WithProcessingRetryBackoff(backoff time.Duration) ProcessingOption {
+	return func(p *ProcessingService) {
+		if backoff > 0 {
+			p.retryBackoff = backoff
+		}
+	}
+}
+
+// WithProcessingTimeout sets how long one processing or compression attempt
+// may run
+func WithProcessingTimeout(timeout time.Duration) ProcessingOption {
+	return func(p *ProcessingService) {
+		if timeout > 0 {
+			p.processingTimeout = timeout
+		}
+	}
+}
+
+// processingRetryBackoff returns how long to wait after a job's nth failed
+// attempt: base, then doubling, capped at maxProcessingRetryBackoff
+func processingRetryBackoff(base time.Duration, attempt int) time.Duration {
+	backoff := base
+	for i := 1; i < attempt && backoff < maxProcessingRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxProcessingRetryBackoff {
+		backoff = maxProcessingRetryBackoff
+	}
+	return backoff
+}
+
+func (p *ProcessingService) jobs() *firestore.CollectionRef {
+	return p.nostrTrackService.firestoreClient.Collection(processingJobsCollection)
+}
+
+// dueJobsQuery selects queued jobs whose next attempt is due, oldest first;
+// it needs IndexDueProcessingJobs
+func (p *ProcessingService) dueJobsQuery(now time.Time) firestore.Query {
+	return p.jobs().
+		Where("status", "==", models.ProcessingJobStatusQueued).
+		Where("next_attempt_at", "<=", now).
+		OrderBy("next_attempt_at", firestore.Asc)
+}
+
+// expiredLeasesQuery selects running jobs whose lease has run out; it needs
+// IndexExpiredProcessingLeases
+func (p *ProcessingService) expiredLeasesQuery(now time.Time) firestore.Query {
+	return p.jobs().
+		Where("status", "==", models.ProcessingJobStatusRunning).
+		Where("lease_expires_at", "<", now).
+		OrderBy("lease_expires_at", firestore.Asc)
+}
+
+// enqueueJob queues a processing job for a track the caller has claimed and
+// wakes an idle worker
+func (p *ProcessingService) enqueueJob(ctx context.Context, trackID, triggeredBy string) error {
+	now := time.Now()
+	job := models.ProcessingJob{
+		TrackID:       trackID,
+		TriggeredBy:   triggeredBy,
+		RequestID:     logging.RequestIDFromContext(ctx),
+		TraceContext:  telemetry.Inject(ctx),
+		Status:        models.ProcessingJobStatusQueued,
+		MaxAttempts:   p.maxAttempts,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if _, err := p.jobs().Doc(trackID).Set(ctx, job); err != nil {
+		return fmt.Errorf("failed to queue processing job: %w", err)
+	}
+
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// claimNextJob leases the oldest due job. It returns nil when no job is due
+// or other workers claimed all of them first.
+func (p *ProcessingService) claimNextJob(ctx context.Context) (*models.ProcessingJob, error) {
+	docs, err := p.dueJobsQuery(time.Now()).Limit(processingClaimBatch).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list due processing jobs: %w", wrapIndexError(err, IndexDueProcessingJobs))
+	}
+
+	for _, doc := range docs {
+		job, err := p.claimJob(ctx, doc.Ref)
+		if err != nil {
+			log.Printf("Failed to claim processing job %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		if job != nil {
+			return job, nil
+		}
+	}
+	return nil, nil
+}
+
+// claimJob leases one job in a transaction, counting the attempt on the job
+// and the track. A job whose track is no longer processing, because it was
+// cancelled or an external pipeline reported a result, is finished instead
+// and nil is returned.
+func (p *ProcessingService) claimJob(ctx context.Context, ref *firestore.DocumentRef) (*models.ProcessingJob, error) {
+	var claimed *models.ProcessingJob
+	err := p.nostrTrackService.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		claimed = nil
+
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return fmt.Errorf("failed to get processing job: %w", err)
+		}
+		var job models.ProcessingJob
+		if err := doc.DataTo(&job); err != nil {
+			return fmt.Errorf("failed to decode processing job: %w", err)
+		}
+
+		now := time.Now()
+		if job.Status != models.ProcessingJobStatusQueued || job.NextAttemptAt.After(now) {
+			return nil
+		}
+
+		trackRef := p.nostrTrackService.firestoreClient.Collection("nostr_tracks").Doc(job.TrackID)
+		trackDoc, err := tx.Get(trackRef)
+		trackStatus := ""
+		switch {
+		case status.Code(err) == codes.NotFound:
+			trackStatus = "missing"
+		case err != nil:
+			return fmt.Errorf("failed to get track: %w", err)
+		default:
+			var track models.NostrTrack
+			if err := trackDoc.DataTo(&track); err != nil {
+				return fmt.Errorf("failed to decode track: %w", err)
+			}
+			trackStatus = track.CurrentStatus()
+		}
+
+		if trackStatus != models.TrackStatusProcessing {
+			outcome := models.ProcessingJobStatusFailed
+			if trackStatus == models.TrackStatusReady {
+				outcome = models.ProcessingJobStatusSucceeded
+			}
+			return tx.Update(ref, []firestore.Update{
+				{Path: "status", Value: outcome},
+				{Path: "last_error", Value: "track is " + trackStatus},
+				{Path: "updated_at", Value: now},
+			})
+		}
+
+		leaseExpiresAt := now.Add(p.processingTimeout + processingLeaseMargin)
+		job.Status = models.ProcessingJobStatusRunning
+		job.Attempts++
+		job.LeaseOwner = p.workerID
+		job.LeaseExpiresAt = &leaseExpiresAt
+		job.UpdatedAt = now
+		if err := tx.Update(ref, []firestore.Update{
+			{Path: "status", Value: job.Status},
+			{Path: "attempts", Value: job.Attempts},
+			{Path: "lease_owner", Value: job.LeaseOwner},
+			{Path: "lease_expires_at", Value: leaseExpiresAt},
+			{Path: "updated_at", Value: now},
+		}); err != nil {
+			return err
+		}
+		claimed = &job
+		return tx.Update(trackRef, []firestore.Update{{Path: "processing_attempts", Value: job.Attempts}})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// runJob processes a leased job's track and records how the attempt ended
+func (p *ProcessingService) runJob(job *models.ProcessingJob) {
+	// Log with the ID of the request that queued the job, and continue its trace
+	ctx := telemetry.Extract(logging.WithRequestID(context.Background(), job.RequestID), job.TraceContext)
+	ctx, cancel := context.WithTimeout(ctx, p.processingTimeout)
+	defer cancel()
+
+	run := newProcessingRun(job.TrackID, job.TriggeredBy)
+	run.canRetry = job.Attempts < job.MaxAttempts
+	err := p.processClaimedTrack(ctx, run)
+	if err != nil && !errors.Is(err, ErrProcessingCancelled) {
+		logging.FromContext(ctx).Warn("processing attempt failed", "track_id", job.TrackID, "attempt", job.Attempts, "max_attempts", job.MaxAttempts, "error", err)
+	}
+
+	finishCtx, finishCancel := context.WithTimeout(context.Background(), processingQueueTimeout)
+	defer finishCancel()
+
+	now := time.Now()
+	updates := []firestore.Update{
+		{Path: "lease_owner", Value: firestore.Delete},
+		{Path: "lease_expires_at", Value: firestore.Delete},
+		{Path: "updated_at", Value: now},
+	}
+	switch {
+	case err == nil && run.attempt.Outcome == models.ProcessingOutcomeSucceeded:
+		updates = append(updates, firestore.Update{Path: "status", Value: models.ProcessingJobStatusSucceeded})
+	case errors.Is(err, ErrProcessingCancelled):
+		updates = append(updates,
+			firestore.Update{Path: "status", Value: models.ProcessingJobStatusCancelled},
+			firestore.Update{Path: "last_error", Value: err.Error()},
+		)
+	case err == nil:
+		// The run already marked the track failed
+		updates = append(updates,
+			firestore.Update{Path: "status", Value: models.ProcessingJobStatusFailed},
+			firestore.Update{Path: "last_error", Value: run.attempt.Error},
+		)
+	case run.canRetry:
+		updates = append(updates,
+			firestore.Update{Path: "status", Value: models.ProcessingJobStatusQueued},
+			firestore.Update{Path: "next_attempt_at", Value: now.Add(processingRetryBackoff(p.retryBackoff, job.Attempts))},
+			firestore.Update{Path: "last_error", Value: err.Error()},
+		)
+	default:
+		// Out of attempts on an error the run couldn't record on the track
+		if failErr := p.failTrack(finishCtx, job.TrackID, "", err.Error()); failErr != nil {
+			logging.FromContext(ctx).Error("failed to mark track failed", "track_id", job.TrackID, "error", failErr)
+		}
+		updates = append(updates,
+			firestore.Update{Path: "status", Value: models.ProcessingJobStatusFailed},
+			firestore.Update{Path: "last_error", Value: err.Error()},
+		)
+	}
+
+	if _, err := p.jobs().Doc(job.TrackID).Update(finishCtx, updates); err != nil {
+		logging.FromContext(ctx).Error("failed to update processing job", "track_id", job.TrackID, "error", err)
+	}
+}
+
+// reconcileExpiredLeases queues again every running job whose lease has
+// expired, because the instance running it stopped. Jobs that were on their
+// last attempt fail their track instead. It returns how many jobs it changed.
+func (p *ProcessingService) reconcileExpiredLeases(ctx context.Context) (int, error) {
+	docs, err := p.expiredLeasesQuery(time.Now()).Documents(ctx).GetAll()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list expired processing leases: %w", wrapIndexError(err, IndexExpiredProcessingLeases))
+	}
+
+	reconciled := 0
+	for _, doc := range docs {
+		exhausted := false
+		changed := false
+		var job models.ProcessingJob
+		err := p.nostrTrackService.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			changed = false
+
+			current, err := tx.Get(doc.Ref)
+			if err != nil {
+				return fmt.Errorf("failed to get processing job: %w", err)
+			}
+			job = models.ProcessingJob{}
+			if err := current.DataTo(&job); err != nil {
+				return fmt.Errorf("failed to decode processing job: %w", err)
+			}
+
+			now := time.Now()
+			if job.Status != models.ProcessingJobStatusRunning || job.LeaseExpiresAt == nil || job.LeaseExpiresAt.After(now) {
+				return nil
+			}
+
+			changed = true
+			exhausted = job.Attempts >= job.MaxAttempts
+			updates := []firestore.Update{
+				{Path: "lease_owner", Value: firestore.Delete},
+				{Path: "lease_expires_at", Value: firestore.Delete},
+				{Path: "last_error", Value: "processing lease expired"},
+				{Path: "updated_at", Value: now},
+			}
+			if exhausted {
+				updates = append(updates, firestore.Update{Path: "status", Value: models.ProcessingJobStatusFailed})
+			} else {
+				updates = append(updates,
+					firestore.Update{Path: "status", Value: models.ProcessingJobStatusQueued},
+					firestore.Update{Path: "next_attempt_at", Value: now},
+				)
+			}
+			return tx.Update(doc.Ref, updates)
+		})
+		if err != nil {
+			log.Printf("Failed to reconcile processing job %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+
+		reconciled++
+		if exhausted {
+			log.Printf("Processing job for track %s expired on its last attempt", job.TrackID)
+			if err := p.failTrack(ctx, job.TrackID, "", "processing did not finish"); err != nil {
+				log.Printf("Failed to mark track %s failed: %v", job.TrackID, err)
+			}
+		} else {
+			log.Printf("Requeued processing job for track %s after its lease expired", job.TrackID)
+		}
+	}
+
+	return reconciled, nil
+}
+
+// StartJobWorkers starts the processing workers and the lease reconciler,
+// which runs once straight away so jobs orphaned by a previous instance are
+// picked up, and the stuck-track reconciler if it has an interval. Call Close
+// to stop them.
+func (p *ProcessingService) StartJobWorkers() {
+	go p.reconcileLoop()
+	if p.stuckReconcileInterval > 0 {
+		go p.stuckReconcileLoop()
+	}
+	for i := 0; i < p.workers; i++ {
+		go p.workLoop()
+	}
+	log.Printf("Started %d processing workers (max %d attempts per job)", p.workers, p.maxAttempts)
+}
+
+// Close stops the workers from claiming more jobs. Jobs already running carry
+// on; if the instance stops first, their leases expire and another instance
+// takes them over.
+func (p *ProcessingService) Close() {
+	p.stopOnce.Do(func() { close(p.stop) })
+}
+
+func (p *ProcessingService) stopped() bool {
+	select {
+	case <-p.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *ProcessingService) workLoop() {
+	ticker := time.NewTicker(p.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		p.runDueJobs()
+
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		case <-p.wake:
+		}
+	}
+}
+
+// runDueJobs runs due jobs one after another until none are left
+func (p *ProcessingService) runDueJobs() {
+	for !p.stopped() {
+		ctx, cancel := context.WithTimeout(context.Background(), processingQueueTimeout)
+		job, err := p.claimNextJob(ctx)
+		cancel()
+		if err != nil {
+			log.Printf("Failed to claim processing job: %v", err)
+			return
+		}
+		if job == nil {
+			return
+		}
+		p.runJobRecovered(job)
+	}
+}
+
+// runJobRecovered is runJob, keeping the worker running through a panic
+// outside the pipeline, which processTrackRecovered doesn't catch. The job's
+// lease then expires and the reconciler queues it again.
+func (p *ProcessingService) runJobRecovered(job *models.ProcessingJob) {
+	ctx := logging.WithRequestID(context.Background(), job.RequestID)
+	defer recovery.Catch(ctx, p.panicAlerter, "processing job", nil, "track_id", job.TrackID)
+	p.runJob(job)
+}
+
+func (p *ProcessingService) reconcileLoop() {
+	ticker := time.NewTicker(processingReconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), processingQueueTimeout)
+		if _, err := p.reconcileExpiredLeases(ctx); err != nil {
+			log.Printf("Failed to reconcile processing leases: %v", err)
+		}
+		cancel()
+
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wavlake/api/internal/models"
+)
+
+func TestProcessingRetryBackoff(t *testing.T) {
+	base := 30 * time.Second
+	assert.Equal(t, 30*time.Second, processingRetryBackoff(base, 1))
+	assert.Equal(t, time.Minute, processingRetryBackoff(base, 2))
+	assert.Equal(t, 2*time.Minute, processingRetryBackoff(base, 3))
+	assert.Equal(t, maxProcessingRetryBackoff, processingRetryBackoff(base, 10))
+	assert.Equal(t, maxProcessingRetryBackoff, processingRetryBackoff(base, 1000))
+}
+
+func TestProcessingOptions(t *testing.T) {
+	p := NewProcessingService(nil, nil, nil, nil, "",
+		WithProcessingMaxAttempts(5),
+		WithProcessingWorkers(4),
+		WithProcessingPollInterval(time.Second),
+		WithProcessingRetryBackoff(time.Millisecond),
+		WithProcessingTimeout(time.Hour),
+	)
+	assert.Equal(t, 5, p.maxAttempts)
+	assert.Equal(t, 4, p.workers)
+	assert.Equal(t, 4, cap(p.wake))
+	assert.Equal(t, time.Second, p.pollInterval)
+	assert.Equal(t, time.Millisecond, p.retryBackoff)
+	assert.Equal(t, time.Hour, p.processingTimeout)
+
+	// Non-positive values keep the defaults
+	p = NewProcessingService(nil, nil, nil, nil, "", WithProcessingMaxAttempts(0), WithProcessingWorkers(-1))
+	assert.Equal(t, DefaultProcessingMaxAttempts, p.maxAttempts)
+	assert.Equal(t, DefaultProcessingWorkers, p.workers)
+	assert.Equal(t, DefaultProcessingTimeout, p.processingTimeout)
+}
+
+func TestMarkProcessingFailedRetriesWhileAttemptsRemain(t *testing.T) {
+	p := NewProcessingService(nil, nil, nil, nil, "")
+	run := newProcessingRun("track-1", models.ProcessingTriggerWebhook)
+	run.canRetry = true
+
+	// The track is left alone, so no track service is needed
+	err := p.markProcessingFailed(context.Background(), run, models.ProcessingErrorDownload, "download failed: timeout")
+
+	assert.ErrorIs(t, err, errRetryProcessing)
+	assert.Equal(t, models.ProcessingErrorDownload, run.attempt.ErrorClass)
+	assert.Equal(t, "download failed: timeout", run.attempt.Error)
+}
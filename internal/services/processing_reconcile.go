@@ -0,0 +1,262 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/storage"
+	"github.com/wavlake/api/internal/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultStuckProcessingThreshold is how long a track may stay processing
+	// before the reconciler looks at it. It outlasts a job's lease, so the
+	// lease reconciler gets the first chance at tracks with a job.
+	DefaultStuckProcessingThreshold = 30 * time.Minute
+
+	// stuckReconcileTimeout bounds one periodic reconciliation pass
+	stuckReconcileTimeout = 5 * time.Minute
+
+	// stuckProcessingError is recorded on tracks failed by the reconciler
+	stuckProcessingError = "processing did not finish"
+)
+
+// WithStuckProcessingThreshold sets how long a track may stay processing
+// before ReconcileStuckTracks repairs, requeues or fails it
+func WithStuckProcessingThreshold(threshold time.Duration) ProcessingOption {
+	return func(p *ProcessingService) {
+		if threshold > 0 {
+			p.stuckThreshold = threshold
+		}
+	}
+}
+
+// WithStuckReconcileInterval makes StartJobWorkers also run
+// ReconcileStuckTracks on this interval. Zero, the default, leaves it to
+// POST /v1/admin/processing/reconcile.
+func WithStuckReconcileInterval(interval time.Duration) ProcessingOption {
+	return func(p *ProcessingService) {
+		if interval > 0 {
+			p.stuckReconcileInterval = interval
+		}
+	}
+}
+
+// processingStuck reports whether a track has been processing for at least
+// threshold with nothing left to finish it: no job, a finished job, or a job
+// whose lease has run out. Queued jobs are waiting for a worker and are left
+// alone. Tracks from before status timestamps use updated_at.
+func processingStuck(track *models.NostrTrack, job *models.ProcessingJob, now time.Time, threshold time.Duration) bool {
+	if track.CurrentStatus() != models.TrackStatusProcessing {
+		return false
+	}
+
+	since, ok := track.StatusTimestamps[models.TrackStatusProcessing]
+	if !ok {
+		since = track.UpdatedAt
+	}
+	if now.Sub(since) < threshold {
+		return false
+	}
+
+	if job == nil {
+		return true
+	}
+	switch job.Status {
+	case models.ProcessingJobStatusQueued:
+		return false
+	case models.ProcessingJobStatusRunning:
+		return job.LeaseExpiresAt == nil || !job.LeaseExpiresAt.After(now)
+	default:
+		return true
+	}
+}
+
+// stuckJobExhausted reports whether a stuck track's job used its last attempt,
+// so queueing it again would only repeat the failure
+func stuckJobExhausted(job *models.ProcessingJob) bool {
+	return job != nil && job.MaxAttempts > 0 && job.Attempts >= job.MaxAttempts
+}
+
+// processingTracksQueries find tracks that may be processing: those with the
+// processing status, and tracks from before status that only have
+// is_processing set. The second also matches tracks whose status is set while
+// is_processing lingers, which the caller skips.
+func (p *ProcessingService) processingTracksQueries() []firestore.Query {
+	tracks := p.nostrTrackService.firestoreClient.Collection("nostr_tracks")
+	return []firestore.Query{
+		tracks.Where("status", "==", models.TrackStatusProcessing),
+		tracks.Where("is_processing", "==", true),
+	}
+}
+
+// ReconcileStuckTracks finds tracks processing longer than the stuck threshold
+// whose run has died. A track whose compressed file made it to storage is
+// marked ready; otherwise it is queued again, or failed if its job is out of
+// attempts. Tracks that change while being looked at are left for the next
+// pass.
+func (p *ProcessingService) ReconcileStuckTracks(ctx context.Context) (*models.ReconcileResult, error) {
+	var docs []*firestore.DocumentSnapshot
+	for _, query := range p.processingTracksQueries() {
+		found, err := query.Documents(ctx).GetAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list processing tracks: %w", err)
+		}
+		docs = append(docs, found...)
+	}
+
+	result := &models.ReconcileResult{}
+	now := p.now()
+	seen := map[string]bool{}
+	for _, doc := range docs {
+		if seen[doc.Ref.ID] {
+			continue
+		}
+		seen[doc.Ref.ID] = true
+
+		var track models.NostrTrack
+		if err := doc.DataTo(&track); err != nil {
+			log.Printf("Failed to decode track %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		track.ID = doc.Ref.ID
+		if track.CurrentStatus() != models.TrackStatusProcessing {
+			continue
+		}
+
+		job, err := p.getJob(ctx, track.ID)
+		if err != nil {
+			log.Printf("Failed to get processing job for track %s: %v", track.ID, err)
+			continue
+		}
+		if !processingStuck(&track, job, now, p.stuckThreshold) {
+			continue
+		}
+		result.Checked++
+
+		if err := p.reconcileStuckTrack(ctx, &track, job, result); err != nil {
+			log.Printf("Failed to reconcile stuck track %s: %v", track.ID, err)
+		}
+	}
+
+	log.Printf("Reconciled stuck tracks: %d checked, %d repaired, %d requeued, %d failed",
+		result.Checked, result.Repaired, result.Requeued, result.Failed)
+	return result, nil
+}
+
+// reconcileStuckTrack repairs, requeues or fails one stuck track, counting
+// what it did in result
+func (p *ProcessingService) reconcileStuckTrack(ctx context.Context, track *models.NostrTrack, job *models.ProcessingJob, result *models.ReconcileResult) error {
+	storageService := p.nostrTrackService.StorageFor(track)
+	compressedPath := p.pathConfig.GetCompressedPath(track.ID)
+
+	_, err := storageService.GetObjectMetadata(ctx, compressedPath)
+	switch {
+	case err == nil:
+		if err := p.repairStuckTrack(ctx, track, storageService.GetPublicURL(compressedPath)); err != nil {
+			return err
+		}
+		log.Printf("Marked stuck track %s ready, its compressed file exists", track.ID)
+		result.Repaired++
+		return nil
+	case !errors.Is(err, storage.ErrObjectNotExist):
+		return fmt.Errorf("failed to check compressed file: %w", err)
+	}
+
+	if stuckJobExhausted(job) {
+		errorMsg := stuckProcessingError
+		if job.LastError != "" {
+			errorMsg = job.LastError
+		}
+		if err := p.failTrack(ctx, track.ID, "", errorMsg); err != nil {
+			return err
+		}
+		log.Printf("Marked stuck track %s failed after %d attempts", track.ID, job.Attempts)
+		result.Failed++
+		return nil
+	}
+
+	if err := p.nostrTrackService.ReclaimTrackForProcessing(ctx, track.ID); err != nil {
+		return err
+	}
+	if err := p.queueClaimedTrack(ctx, track.ID, models.ProcessingTriggerReconcile); err != nil {
+		return err
+	}
+	log.Printf("Requeued stuck track %s", track.ID)
+	result.Requeued++
+	return nil
+}
+
+// repairStuckTrack marks a track whose run died after uploading its
+// compressed file ready, adding the default version if the run didn't get
+// that far. The size and duration the run would have probed are left unset.
+func (p *ProcessingService) repairStuckTrack(ctx context.Context, track *models.NostrTrack, compressedURL string) error {
+	if err := p.nostrTrackService.TransitionTrack(ctx, track.ID, models.TrackStatusReady, map[string]interface{}{
+		"compressed_url": compressedURL,
+		"is_compressed":  true,
+	}); err != nil {
+		return err
+	}
+
+	for _, version := range track.CompressionVersions {
+		if version.ID == defaultVersionID {
+			return nil
+		}
+	}
+	option := models.CompressionOption{Bitrate: 128, Format: "mp3", Quality: "medium", SampleRate: 44100}
+	if err := p.nostrTrackService.AddCompressionVersion(ctx, track.ID, models.CompressionVersion{
+		ID:         defaultVersionID,
+		URL:        compressedURL,
+		Bitrate:    option.Bitrate,
+		Format:     option.Format,
+		Quality:    option.Quality,
+		SampleRate: option.SampleRate,
+		IsPublic:   true,
+		CreatedAt:  p.now(),
+		Options:    option,
+	}); err != nil {
+		log.Printf("Failed to add default compression version for repaired track %s: %v", track.ID, err)
+	}
+	return nil
+}
+
+// getJob returns a track's processing job, or nil if it has none
+func (p *ProcessingService) getJob(ctx context.Context, trackID string) (*models.ProcessingJob, error) {
+	doc, err := p.jobs().Doc(trackID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var job models.ProcessingJob
+	if err := doc.DataTo(&job); err != nil {
+		return nil, fmt.Errorf("failed to decode processing job: %w", err)
+	}
+	return &job, nil
+}
+
+func (p *ProcessingService) stuckReconcileLoop() {
+	ticker := time.NewTicker(p.stuckReconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), stuckReconcileTimeout)
+		if _, err := p.ReconcileStuckTracks(ctx); err != nil {
+			log.Printf("Failed to reconcile stuck tracks: %v", err)
+		}
+		cancel()
+	}
+}
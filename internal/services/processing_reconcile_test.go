@@ -0,0 +1,108 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/models"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestProcessingStuck(t *testing.T) {
+	// A fake clock: the track entered processing an hour before now
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	started := now.Add(-time.Hour)
+	threshold := 30 * time.Minute
+	expired := now.Add(-time.Minute)
+	live := now.Add(time.Minute)
+
+	processing := func() *models.NostrTrack {
+		return &models.NostrTrack{
+			Status:           models.TrackStatusProcessing,
+			IsProcessing:     true,
+			StatusTimestamps: map[string]time.Time{models.TrackStatusProcessing: started},
+		}
+	}
+
+	tests := []struct {
+		name  string
+		track func() *models.NostrTrack
+		job   *models.ProcessingJob
+		now   time.Time
+		want  bool
+	}{
+		{"no job", processing, nil, now, true},
+		{"not stuck long enough", processing, nil, started.Add(threshold - time.Second), false},
+		{"exactly at the threshold", processing, nil, started.Add(threshold), true},
+		{"queued job", processing, &models.ProcessingJob{Status: models.ProcessingJobStatusQueued}, now, false},
+		{"running with a live lease", processing, &models.ProcessingJob{Status: models.ProcessingJobStatusRunning, LeaseExpiresAt: &live}, now, false},
+		{"running with an expired lease", processing, &models.ProcessingJob{Status: models.ProcessingJobStatusRunning, LeaseExpiresAt: &expired}, now, true},
+		{"running without a lease", processing, &models.ProcessingJob{Status: models.ProcessingJobStatusRunning}, now, true},
+		{"job finished, track still processing", processing, &models.ProcessingJob{Status: models.ProcessingJobStatusFailed}, now, true},
+		{"ready track", func() *models.NostrTrack {
+			track := processing()
+			track.Status = models.TrackStatusReady
+			return track
+		}, nil, now, false},
+		{"legacy track uses updated_at", func() *models.NostrTrack {
+			return &models.NostrTrack{IsProcessing: true, UpdatedAt: now.Add(-10 * time.Minute)}
+		}, nil, now, false},
+		{"stale legacy track", func() *models.NostrTrack {
+			return &models.NostrTrack{IsProcessing: true, UpdatedAt: started}
+		}, nil, now, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, processingStuck(tt.track(), tt.job, tt.now, threshold))
+		})
+	}
+}
+
+func TestStuckJobExhausted(t *testing.T) {
+	assert.False(t, stuckJobExhausted(nil))
+	assert.False(t, stuckJobExhausted(&models.ProcessingJob{Attempts: 2, MaxAttempts: 3}))
+	assert.True(t, stuckJobExhausted(&models.ProcessingJob{Attempts: 3, MaxAttempts: 3}))
+	assert.False(t, stuckJobExhausted(&models.ProcessingJob{Attempts: 3}))
+}
+
+func TestStuckReconcileOptions(t *testing.T) {
+	p := NewProcessingService(nil, nil, nil, nil, "")
+	assert.Equal(t, DefaultStuckProcessingThreshold, p.stuckThreshold)
+	assert.Zero(t, p.stuckReconcileInterval)
+
+	p = NewProcessingService(nil, nil, nil, nil, "",
+		WithStuckProcessingThreshold(time.Hour),
+		WithStuckReconcileInterval(5*time.Minute),
+	)
+	assert.Equal(t, time.Hour, p.stuckThreshold)
+	assert.Equal(t, 5*time.Minute, p.stuckReconcileInterval)
+}
+
+func TestProcessingTracksQueries(t *testing.T) {
+	p := NewProcessingService(NewNostrTrackService(offlineFirestoreClient(t), nil), nil, nil, nil, "")
+
+	// Legacy tracks have no status, only is_processing
+	var filters []any
+	for _, query := range p.processingTracksQueries() {
+		raw, err := query.Serialize()
+		require.NoError(t, err)
+		var req firestorepb.RunQueryRequest
+		require.NoError(t, proto.Unmarshal(raw, &req))
+
+		field := req.GetStructuredQuery().GetWhere().GetFieldFilter()
+		require.NotNil(t, field)
+		assert.Equal(t, firestorepb.StructuredQuery_FieldFilter_EQUAL, field.GetOp())
+		value := field.GetValue()
+		filters = append(filters, field.GetField().GetFieldPath())
+		if _, ok := value.GetValueType().(*firestorepb.Value_BooleanValue); ok {
+			filters = append(filters, value.GetBooleanValue())
+		} else {
+			filters = append(filters, value.GetStringValue())
+		}
+	}
+	assert.Equal(t, []any{"status", models.TrackStatusProcessing, "is_processing", true}, filters)
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/utils"
+)
+
+// streamProbeBytes is how much of an original is read to probe it before it
+// is compressed from a pipe. It covers the headers and first frames of FLAC
+// and WAV files, and MP3s whose ID3 tag carries ordinary cover art.
+const streamProbeBytes = 1 << 20
+
+// streamedUpload is what a streamed compression uploaded
+type streamedUpload struct {
+	Size int64
+	Hash string
+}
+
+// byteCounter counts the bytes written to it
+type byteCounter int64
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
+
+// probeOriginal reads audio info from the start of an original, without
+// downloading the rest of it
+func (p *ProcessingService) probeOriginal(ctx context.Context, storageService StorageServiceInterface, objectName, extension string) (*utils.AudioInfo, error) {
+	reader, err := storageService.GetObjectRangeReader(ctx, objectName, 0, streamProbeBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage reader: %w", err)
+	}
+	defer reader.Close()
+
+	return p.audioProcessor.ProbeStream(ctx, io.LimitReader(reader, streamProbeBytes), extension)
+}
+
+// compressVersionStream compresses a version by piping the original from
+// storage through ffmpeg and ffmpeg's output straight back to storage, so
+// neither is written to the temp directory. original is the original's
+// probed info.
+func (p *ProcessingService) compressVersionStream(ctx context.Context, storageService StorageServiceInterface, track *models.NostrTrack, versionID string, option models.CompressionOption, original *utils.AudioInfo) (*models.CompressionVersion, error) {
+	if p.trackDeleted(ctx, track.ID) {
+		return nil, ErrProcessingCancelled
+	}
+
+	compressedObjectName := p.pathConfig.GetCompressedVersionPath(track.ID, versionID, option.Format)
+	uploaded, err := p.streamCompress(ctx, storageService, p.pathConfig.GetOriginalPath(track.ID, track.Extension), track.Extension, compressedObjectName, option)
+	if err != nil {
+		if runCancelled(ctx) {
+			return nil, ErrProcessingCancelled
+		}
+		return nil, err
+	}
+
+	// A track deleted on another instance mid-stream keeps no new files
+	if p.trackDeleted(ctx, track.ID) {
+		p.abandonUpload(ctx, storageService, compressedObjectName)
+		return nil, ErrProcessingCancelled
+	}
+
+	// The output isn't probed, so the version records what ffmpeg was asked
+	// for, with the original's sample rate when the option keeps it
+	sampleRate := option.SampleRate
+	if format, ok := utils.CompressionFormats[option.Format]; ok && len(format.SampleRates) == 1 {
+		sampleRate = format.SampleRates[0]
+	}
+	if sampleRate == 0 {
+		sampleRate = original.SampleRate
+	}
+
+	return &models.CompressionVersion{
+		ID:         versionID,
+		URL:        storageService.GetPublicURL(compressedObjectName),
+		Bitrate:    option.Bitrate,
+		Format:     option.Format,
+		Quality:    option.Quality,
+		SampleRate: sampleRate,
+		Size:       uploaded.Size,
+		Hash:       uploaded.Hash,
+		Status:     models.VersionStatusCompleted,
+		IsPublic:   false, // Default to private, user can make public later
+		CreatedAt:  time.Now(),
+		Options:    option,
+	}, nil
+}
+
+// streamCompress pipes originalObject through CompressStream into
+// objectName. The original is checked against the checksums storage recorded
+// as it streams, and the upload is removed if it doesn't match.
+func (p *ProcessingService) streamCompress(ctx context.Context, storageService StorageServiceInterface, originalObject, extension, objectName string, option models.CompressionOption) (*streamedUpload, error) {
+	reader, err := storageService.GetObjectReader(ctx, originalObject)
+	if err != nil {
+		return nil, fmt.Errorf("download failed: failed to create storage reader: %w", err)
+	}
+	defer reader.Close()
+
+	// Cancelling stops ffmpeg and abandons the upload once either side fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	originalHashes := newDownloadHash()
+	original := io.TeeReader(reader, originalHashes)
+	pr, pw := io.Pipe()
+	compressed := make(chan error, 1)
+	go func() {
+		err := p.audioProcessor.CompressStream(ctx, original, extension, pw, option)
+		pw.CloseWithError(err)
+		compressed <- err
+	}()
+
+	var size byteCounter
+	hashed := newSHA256Reader(io.TeeReader(pr, &size))
+	uploadErr := storageService.UploadObject(ctx, objectName, hashed, getContentTypeForFormat(option.Format))
+	if uploadErr != nil {
+		cancel()
+		pr.CloseWithError(uploadErr)
+	}
+	compressErr := <-compressed
+
+	// A failed compression also fails the upload reading from it
+	if compressErr != nil && (uploadErr == nil || errors.Is(uploadErr, compressErr)) {
+		return nil, fmt.Errorf("compression failed: %v", compressErr)
+	}
+	if uploadErr != nil {
+		return nil, fmt.Errorf("failed to upload compressed file: %v", uploadErr)
+	}
+
+	// ffmpeg may stop before trailing metadata; hash the rest of the original
+	// so it can be verified
+	if _, err := io.Copy(io.Discard, original); err != nil {
+		p.abandonUpload(ctx, storageService, objectName)
+		return nil, fmt.Errorf("download failed: failed to read original: %w", err)
+	}
+	checksums, err := storageService.GetObjectChecksums(ctx, originalObject)
+	if err == nil {
+		err = originalHashes.Verify(checksums)
+	}
+	if err != nil {
+		p.abandonUpload(ctx, storageService, objectName)
+		return nil, fmt.Errorf("download failed: %w", err)
+	}
+
+	return &streamedUpload{Size: int64(size), Hash: hashed.Sum()}, nil
+}
+
+// abandonUpload removes an uploaded file whose run failed or was cancelled
+// after the upload finished
+func (p *ProcessingService) abandonUpload(ctx context.Context, storageService StorageServiceInterface, objectName string) {
+	if err := storageService.DeleteObject(context.WithoutCancel(ctx), objectName); err != nil {
+		log.Printf("Failed to remove abandoned upload %s: %v", objectName, err)
+	}
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"crypto/md5" // #nosec G501 -- Test of the MD5 check
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/utils"
+)
+
+// streamAudio treats inputs starting with "AUDIO" as audio and "encodes" by
+// prefixing the input, recording how much each probe read
+type streamAudio struct {
+	AudioProcessorInterface
+	compressErr error
+	probed      int
+}
+
+func (a *streamAudio) ProbeStream(ctx context.Context, input io.Reader, inputFormat string) (*utils.AudioInfo, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	a.probed = len(data)
+	if !strings.HasPrefix(string(data), "AUDIO") {
+		return nil, errors.New("no audio stream found")
+	}
+	return &utils.AudioInfo{Duration: 180, SampleRate: 48000}, nil
+}
+
+func (a *streamAudio) CompressStream(ctx context.Context, input io.Reader, inputFormat string, output io.Writer, options models.CompressionOption) error {
+	if a.compressErr != nil {
+		return a.compressErr
+	}
+	if _, err := io.WriteString(output, "encoded:"); err != nil {
+		return err
+	}
+	_, err := io.Copy(output, input)
+	return err
+}
+
+func TestStreamCompressWritesNoTempFiles(t *testing.T) {
+	original := "AUDIO" + strings.Repeat("x", 2*streamProbeBytes)
+	sum := md5.Sum([]byte(original)) // #nosec G401 -- Matches the MD5 storage records
+	storage := &fakeObjectStorage{
+		objects:   map[string]string{"tracks/original/abc.flac": original},
+		checksums: map[string]*ObjectChecksums{"tracks/original/abc.flac": {MD5: sum[:]}},
+	}
+	tempDir := t.TempDir()
+	p := NewProcessingService(nil, &streamAudio{}, nil, nil, tempDir)
+
+	uploaded, err := p.streamCompress(context.Background(), storage, "tracks/original/abc.flac", "flac", "tracks/compressed/abc/v1.mp3", utils.DefaultCompressionOption)
+	require.NoError(t, err)
+
+	want := "encoded:" + original
+	hash := sha256.Sum256([]byte(want))
+	assert.Equal(t, want, storage.objects["tracks/compressed/abc/v1.mp3"])
+	assert.Equal(t, int64(len(want)), uploaded.Size)
+	assert.Equal(t, hex.EncodeToString(hash[:]), uploaded.Hash)
+
+	entries, err := os.ReadDir(tempDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestStreamCompressRemovesUploadOfCorruptOriginal(t *testing.T) {
+	storage := &fakeObjectStorage{
+		objects:   map[string]string{"tracks/original/abc.wav": "AUDIO bytes"},
+		checksums: map[string]*ObjectChecksums{"tracks/original/abc.wav": {CRC32C: 1, HasCRC32C: true}},
+	}
+	p := NewProcessingService(nil, &streamAudio{}, nil, nil, t.TempDir())
+
+	_, err := p.streamCompress(context.Background(), storage, "tracks/original/abc.wav", "wav", "tracks/compressed/abc/v1.mp3", utils.DefaultCompressionOption)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	assert.NotContains(t, storage.objects, "tracks/compressed/abc/v1.mp3")
+}
+
+func TestStreamCompressReportsCompressionFailure(t *testing.T) {
+	storage := &fakeObjectStorage{objects: map[string]string{"tracks/original/abc.mp3": "AUDIO bytes"}}
+	p := NewProcessingService(nil, &streamAudio{compressErr: errors.New("ffmpeg exited")}, nil, nil, t.TempDir())
+
+	_, err := p.streamCompress(context.Background(), storage, "tracks/original/abc.mp3", "mp3", "tracks/compressed/abc/v1.mp3", utils.DefaultCompressionOption)
+	assert.EqualError(t, err, "compression failed: ffmpeg exited")
+	assert.NotContains(t, storage.objects, "tracks/compressed/abc/v1.mp3")
+}
+
+func TestProbeOriginalReadsOnlyTheStart(t *testing.T) {
+	storage := &fakeObjectStorage{objects: map[string]string{
+		"tracks/original/abc.flac": "AUDIO" + strings.Repeat("x", 3*streamProbeBytes),
+		"tracks/original/def.flac": "not audio",
+	}}
+	audio := &streamAudio{}
+	p := NewProcessingService(nil, audio, nil, nil, t.TempDir())
+
+	info, err := p.probeOriginal(context.Background(), storage, "tracks/original/abc.flac", "flac")
+	require.NoError(t, err)
+	assert.Equal(t, 48000, info.SampleRate)
+	assert.Equal(t, streamProbeBytes, audio.probed)
+
+	_, err = p.probeOriginal(context.Background(), storage, "tracks/original/def.flac", "flac")
+	assert.Error(t, err)
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"context"
+	"crypto/md5" // #nosec G501 -- Test of the MD5 check
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/utils"
+)
+
+// fakeObjectStorage serves objects from memory and records which keys were
+// read. Methods the tests don't use panic through the nil interface.
+type fakeObjectStorage struct {
+	StorageServiceInterface
+	objects   map[string]string
+	checksums map[string]*ObjectChecksums
+	reads     []string
+}
+
+func (f *fakeObjectStorage) GetObjectReader(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	f.reads = append(f.reads, objectName)
+	data, ok := f.objects[objectName]
+	if !ok {
+		return nil, errors.New("object not found")
+	}
+	return io.NopCloser(strings.NewReader(data)), nil
+}
+
+func (f *fakeObjectStorage) GetObjectRangeReader(ctx context.Context, objectName string, offset, length int64) (io.ReadCloser, error) {
+	f.reads = append(f.reads, objectName)
+	data, ok := f.objects[objectName]
+	if !ok {
+		return nil, errors.New("object not found")
+	}
+	data = data[min(offset, int64(len(data))):]
+	if length >= 0 && length < int64(len(data)) {
+		data = data[:length]
+	}
+	return io.NopCloser(strings.NewReader(data)), nil
+}
+
+func (f *fakeObjectStorage) DeleteObject(ctx context.Context, objectName string) error {
+	delete(f.objects, objectName)
+	return nil
+}
+
+func (f *fakeObjectStorage) GetObjectSize(ctx context.Context, objectName string) (int64, error) {
+	data, ok := f.objects[objectName]
+	if !ok {
+		return 0, errors.New("object not found")
+	}
+	return int64(len(data)), nil
+}
+
+func (f *fakeObjectStorage) GetObjectChecksums(ctx context.Context, objectName string) (*ObjectChecksums, error) {
+	return f.checksums[objectName], nil
+}
+
+func (f *fakeObjectStorage) UploadObject(ctx context.Context, objectName string, data io.Reader, contentType string) error {
+	content, err := io.ReadAll(data)
+	if err != nil {
+		return err
+	}
+	if f.objects == nil {
+		f.objects = map[string]string{}
+	}
+	f.objects[objectName] = string(content)
+	return nil
+}
+
+func (f *fakeObjectStorage) GetPublicURL(objectName string) string {
+	return "https://storage.example.com/" + objectName
+}
+
+// waveformAudio generates a fixed waveform, or fails with err
+type waveformAudio struct {
+	AudioProcessorInterface
+	err error
+}
+
+func (a *waveformAudio) GenerateWaveform(ctx context.Context, inputPath string, buckets int) (*utils.Waveform, error) {
+	if a.err != nil {
+		return nil, a.err
+	}
+	return &utils.Waveform{Version: 2, Channels: 1, SampleRate: 8000, SamplesPerPixel: 10, Bits: 8, Length: 1, Data: []int{-3, 4}}, nil
+}
+
+// artworkAudio writes fixed cover art, or fails with err
+type artworkAudio struct {
+	AudioProcessorInterface
+	err error
+}
+
+func (a *artworkAudio) ExtractArtwork(ctx context.Context, inputPath, outputPath string) error {
+	if a.err != nil {
+		return a.err
+	}
+	return os.WriteFile(outputPath, []byte("jpeg bytes"), 0o600)
+}
+
+func TestDownloadFile(t *testing.T) {
+	storage := &fakeObjectStorage{objects: map[string]string{"tracks/original/abc.flac": "audio bytes"}}
+	p := NewProcessingService(nil, nil, nil, nil, t.TempDir())
+	path := filepath.Join(p.tempDir, "abc_original.flac")
+
+	hash, err := p.downloadFile(context.Background(), storage, "tracks/original/abc.flac", path, nil)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "audio bytes", string(data))
+	assert.Equal(t, []string{"tracks/original/abc.flac"}, storage.reads)
+	assert.Equal(t, "ef71589075ccf9332917b0d8d711d1a8d205560f96842f9221de70e6c29454e0", hash)
+}
+
+func TestDownloadFile_ReportsProgress(t *testing.T) {
+	storage := &fakeObjectStorage{objects: map[string]string{"tracks/original/abc.flac": "audio bytes"}}
+	p := NewProcessingService(nil, nil, nil, nil, t.TempDir())
+
+	var downloaded, total int64
+	_, err := p.downloadFile(context.Background(), storage, "tracks/original/abc.flac", filepath.Join(p.tempDir, "abc_original.flac"),
+		func(d, t int64) { downloaded, total = d, t })
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("audio bytes")), downloaded)
+	assert.Equal(t, int64(len("audio bytes")), total)
+}
+
+func TestDownloadProgressPublishesEachStep(t *testing.T) {
+	nts := NewNostrTrackService(nil, nil)
+	p := NewProcessingService(nts, nil, nil, nil, t.TempDir())
+	events, unsubscribe := nts.Events().Subscribe("track-1")
+	defer unsubscribe()
+
+	progress := p.downloadProgress(&processingRun{trackID: "track-1"})
+	for _, downloaded := range []int64{5, 10, 14, 25, 99, 100} {
+		progress(downloaded, 100)
+	}
+	progress(1, -1) // Unknown size
+
+	var percents []int
+	for len(events) > 0 {
+		event := <-events
+		assert.Equal(t, models.ProcessingStageDownloading, event.Stage)
+		percents = append(percents, event.Percent)
+	}
+	assert.Equal(t, []int{10, 20, 90, 100}, percents)
+
+	latest, ok := nts.Events().LatestProgress("track-1")
+	require.True(t, ok)
+	assert.Equal(t, 100, latest.Percent)
+}
+
+func TestDownloadFile_VerifiesChecksums(t *testing.T) {
+	md5Sum := md5.Sum([]byte("audio bytes")) // #nosec G401 -- Test of the MD5 check
+	crc := crc32.Checksum([]byte("audio bytes"), crc32cTable)
+	p := NewProcessingService(nil, nil, nil, nil, t.TempDir())
+	path := filepath.Join(p.tempDir, "abc_original.flac")
+
+	tests := []struct {
+		name      string
+		checksums *ObjectChecksums
+		wantErr   bool
+	}{
+		{"none recorded", nil, false},
+		{"both match", &ObjectChecksums{CRC32C: crc, HasCRC32C: true, MD5: md5Sum[:]}, false},
+		{"CRC32C only", &ObjectChecksums{CRC32C: crc, HasCRC32C: true}, false},
+		{"CRC32C mismatch", &ObjectChecksums{CRC32C: crc + 1, HasCRC32C: true, MD5: md5Sum[:]}, true},
+		{"MD5 mismatch", &ObjectChecksums{CRC32C: crc, HasCRC32C: true, MD5: make([]byte, 16)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &fakeObjectStorage{
+				objects:   map[string]string{"tracks/original/abc.flac": "audio bytes"},
+				checksums: map[string]*ObjectChecksums{"tracks/original/abc.flac": tt.checksums},
+			}
+
+			_, err := p.downloadFile(context.Background(), storage, "tracks/original/abc.flac", path, nil)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrChecksumMismatch)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestDownloadFile_MissingObject(t *testing.T) {
+	storage := &fakeObjectStorage{}
+	p := NewProcessingService(nil, nil, nil, nil, t.TempDir())
+
+	_, err := p.downloadFile(context.Background(), storage, "tracks/original/missing.wav", filepath.Join(p.tempDir, "missing.wav"), nil)
+	assert.ErrorContains(t, err, "object not found")
+}
+
+func TestProcessTrackDownloadsOriginalByTrackID(t *testing.T) {
+	us := &fakeObjectStorage{}
+	eu := &fakeObjectStorage{}
+	regions := NewStorageRegions("us", us)
+	require.NoError(t, regions.Add("eu", eu, nil))
+	p := NewProcessingService(NewNostrTrackService(nil, regions), nil, nil, nil, t.TempDir())
+
+	// The stored URL includes the bucket path, and doesn't have to match the
+	// object at all; the key comes from the track's ID and extension
+	track := &models.NostrTrack{
+		ID:          "abc",
+		Extension:   "flac",
+		Region:      "eu",
+		OriginalURL: "https://storage.googleapis.com/wavlake-eu/tracks/original/something-else.wav",
+	}
+	run := newProcessingRun(track.ID, models.ProcessingTriggerWebhook)
+	run.canRetry = true
+
+	err := p.processTrack(context.Background(), track, run)
+
+	assert.ErrorIs(t, err, errRetryProcessing)
+	assert.Equal(t, []string{p.pathConfig.GetOriginalPath("abc", "flac")}, eu.reads)
+	assert.Empty(t, us.reads)
+	assert.Equal(t, models.ProcessingErrorDownload, run.attempt.ErrorClass)
+}
+
+func TestWithoutEditedTags(t *testing.T) {
+	updates := map[string]interface{}{
+		"title":            "Night Drive",
+		"title_normalized": "night drive",
+		"album":            "Routes",
+		"embedded_tags":    []string{"title", "album"},
+		"duration":         180,
+	}
+
+	// The title was edited while the run went, after the run read it empty
+	edited := &models.NostrTrack{Title: "My Title", Album: "Old Routes", EmbeddedTags: []string{"album"}}
+	assert.Equal(t, map[string]interface{}{
+		"album":         "Routes",
+		"embedded_tags": []string{"album"},
+		"duration":      180,
+	}, withoutEditedTags(edited, updates))
+	assert.Contains(t, updates, "title", "the run's updates aren't changed")
+
+	assert.Equal(t, updates, withoutEditedTags(&models.NostrTrack{}, updates))
+	assert.Equal(t, map[string]interface{}{"duration": 180}, withoutEditedTags(&models.NostrTrack{Title: "a", Album: "b"}, updates))
+}
+
+func TestEmbeddedTagOverrides(t *testing.T) {
+	track := &models.NostrTrack{EmbeddedTags: []string{"title", "album"}}
+
+	assert.Nil(t, embeddedTagOverrides(track, map[string]interface{}{"is_published": true}))
+	assert.Equal(t, []firestore.Update{{Path: "embedded_tags", Value: []string{"album"}}},
+		embeddedTagOverrides(track, map[string]interface{}{"title": "Published Title", "title_normalized": "published title"}))
+	assert.Equal(t, []firestore.Update{{Path: "embedded_tags", Value: firestore.Delete}},
+		embeddedTagOverrides(track, map[string]interface{}{"title": "a", "album": "b"}))
+	assert.Nil(t, embeddedTagOverrides(&models.NostrTrack{}, map[string]interface{}{"title": "a"}))
+}
+
+func TestUploadWaveform(t *testing.T) {
+	storage := &fakeObjectStorage{}
+	p := NewProcessingService(nil, &waveformAudio{}, nil, nil, t.TempDir())
+
+	url, err := p.uploadWaveform(context.Background(), storage, "abc", "abc_original.wav")
+	require.NoError(t, err)
+
+	assert.Equal(t, "https://storage.example.com/tracks/waveform/abc.json", url)
+	assert.JSONEq(t, `{"version":2,"channels":1,"sample_rate":8000,"samples_per_pixel":10,"bits":8,"length":1,"data":[-3,4]}`,
+		storage.objects["tracks/waveform/abc.json"])
+
+	p = NewProcessingService(nil, &waveformAudio{err: errors.New("decode failed")}, nil, nil, t.TempDir())
+	_, err = p.uploadWaveform(context.Background(), storage, "def", "def_original.wav")
+	assert.ErrorContains(t, err, "decode failed")
+}
+
+func TestEmbeddedTagUpdates(t *testing.T) {
+	storage := &fakeObjectStorage{}
+	p := NewProcessingService(nil, &artworkAudio{}, nil, nil, t.TempDir())
+	tags := &utils.AudioTags{Title: "Night Drive", Artist: "The Wavs", Album: "Routes", HasArtwork: true}
+
+	// Fields the user set are kept; the rest come from the tags
+	track := &models.NostrTrack{ID: "abc", Artist: "Imported Artist"}
+	updates := p.embeddedTagUpdates(context.Background(), storage, track, "abc_original.mp3", tags)
+	assert.Equal(t, map[string]interface{}{
+		"title":            "Night Drive",
+		"title_normalized": "night drive",
+		"album":            "Routes",
+		"artwork_url":      "https://storage.example.com/tracks/artwork/abc.jpg",
+		"embedded_tags":    []string{"title", "album", "artwork_url"},
+	}, updates)
+	assert.Equal(t, "jpeg bytes", storage.objects["tracks/artwork/abc.jpg"])
+
+	// Fields filled by an earlier run are refreshed
+	track = &models.NostrTrack{ID: "abc", Title: "Old Title", Artist: "Imported Artist", EmbeddedTags: []string{"title"}}
+	updates = p.embeddedTagUpdates(context.Background(), storage, track, "abc_original.mp3", &utils.AudioTags{Title: "Night Drive"})
+	assert.Equal(t, "Night Drive", updates["title"])
+	assert.Equal(t, []string{"title"}, updates["embedded_tags"])
+	assert.NotContains(t, updates, "artist")
+
+	// Artwork the user set is kept too
+	track = &models.NostrTrack{ID: "abc", ArtworkURL: "https://images.example.com/cover.png"}
+	updates = p.embeddedTagUpdates(context.Background(), storage, track, "abc_original.mp3", &utils.AudioTags{HasArtwork: true})
+	assert.Empty(t, updates)
+
+	// Artwork that can't be extracted is skipped
+	p = NewProcessingService(nil, &artworkAudio{err: errors.New("no video stream")}, nil, nil, t.TempDir())
+	updates = p.embeddedTagUpdates(context.Background(), storage, &models.NostrTrack{ID: "def"}, "def_original.mp3", &utils.AudioTags{HasArtwork: true})
+	assert.Empty(t, updates)
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
+	"github.com/wavlake/api/internal/models"
+)
+
+// ProfileService assembles the account overview from Firestore, linked
+// pubkeys and the legacy catalog
+type ProfileService struct {
+	firestoreClient *firestore.Client
+	userService     UserServiceInterface
+	postgresService PostgresServiceInterface
+}
+
+// NewProfileService creates a profile service. postgresService may be nil
+// when the legacy database isn't configured.
+func NewProfileService(firestoreClient *firestore.Client, userService UserServiceInterface, postgresService PostgresServiceInterface) *ProfileService {
+	return &ProfileService{
+		firestoreClient: firestoreClient,
+		userService:     userService,
+		postgresService: postgresService,
+	}
+}
+
+// GetProfile loads every section of the overview concurrently, creating the
+// users document if it doesn't exist yet. A section that fails is left nil
+// with a warning instead of failing the whole profile.
+func (s *ProfileService) GetProfile(ctx context.Context, firebaseUID string) (*models.UserProfile, error) {
+	profile := &models.UserProfile{FirebaseUID: firebaseUID}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		user     *models.User
+		userErr  error
+		linked   []models.NostrAuth
+		linkErr  error
+		warnings []string
+	)
+	warn := func(section string, err error) {
+		log.Printf("Profile %s for user %s unavailable: %v", section, firebaseUID, err)
+		mu.Lock()
+		warnings = append(warnings, section+" unavailable")
+		mu.Unlock()
+	}
+
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		user, userErr = s.userService.GetOrCreateUser(ctx, firebaseUID)
+	}()
+	go func() {
+		defer wg.Done()
+		linked, linkErr = s.userService.GetLinkedPubkeys(ctx, firebaseUID)
+	}()
+	go func() {
+		defer wg.Done()
+		tracks, storage, err := s.summarizeTracks(ctx, firebaseUID)
+		if err != nil {
+			warn("tracks", err)
+			return
+		}
+		profile.Tracks, profile.Storage = tracks, storage
+	}()
+	go func() {
+		defer wg.Done()
+		legacy, err := s.getLegacy(ctx, firebaseUID)
+		if err != nil {
+			warn("legacy", err)
+			return
+		}
+		profile.Legacy = legacy
+	}()
+	wg.Wait()
+
+	if userErr != nil {
+		warn("user", userErr)
+	}
+	profile.User = user
+
+	if linkErr != nil {
+		warn("pubkeys", linkErr)
+		profile.Pubkeys = []models.ProfilePubkey{}
+	} else {
+		profile.Pubkeys = profilePubkeys(user, linked)
+	}
+
+	profile.Warnings = warnings
+	return profile, nil
+}
+
+// profilePubkeys marks the primary pubkey: the user's chosen one if it is
+// still linked, otherwise the earliest linked
+func profilePubkeys(user *models.User, linked []models.NostrAuth) []models.ProfilePubkey {
+	pubkeys := make([]models.ProfilePubkey, 0, len(linked))
+	primary := -1
+	for i, auth := range linked {
+		pubkeys = append(pubkeys, models.ProfilePubkey{
+			Pubkey:     auth.Pubkey,
+			Label:      auth.Label,
+			LinkedAt:   auth.LinkedAt,
+			LastUsedAt: auth.LastUsedAt,
+		})
+		if user != nil && user.PrimaryPubkey != "" && auth.Pubkey == user.PrimaryPubkey {
+			primary = i
+		}
+	}
+
+	if primary == -1 {
+		for i := range linked {
+			if primary == -1 || linked[i].LinkedAt.Before(linked[primary].LinkedAt) {
+				primary = i
+			}
+		}
+	}
+	if primary >= 0 {
+		pubkeys[primary].Primary = true
+	}
+	return pubkeys
+}
+
+// summarizeTracks counts the user's tracks and totals their original sizes with
+// aggregation queries, so no track documents are read
+func (s *ProfileService) summarizeTracks(ctx context.Context, firebaseUID string) (*models.ProfileTrackSummary, *models.ProfileStorageUsage, error) {
+	base := s.firestoreClient.Collection("nostr_tracks").
+		Where("firebase_uid", "==", firebaseUID).
+		Where("deleted", "==", false)
+
+	totals, err := base.NewAggregationQuery().WithCount("count").WithSum("size", "bytes").Get(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to count tracks: %w", err)
+	}
+	processingQuery := base.Where("is_processing", "==", true)
+	processing, err := processingQuery.NewAggregationQuery().WithCount("count").Get(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to count processing tracks: %w", err)
+	}
+	publishedQuery := base.Where("is_published", "==", true)
+	published, err := publishedQuery.NewAggregationQuery().WithCount("count").Get(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to count published tracks: %w", err)
+	}
+
+	summary := &models.ProfileTrackSummary{}
+	storage := &models.ProfileStorageUsage{}
+	for _, field := range []struct {
+		results firestore.AggregationResult
+		alias   string
+		set     func(int64)
+	}{
+		{totals, "count", func(v int64) { summary.Total = int(v) }},
+		{totals, "bytes", func(v int64) { storage.OriginalBytes = v }},
+		{processing, "count", func(v int64) { summary.Processing = int(v) }},
+		{published, "count", func(v int64) { summary.Published = int(v) }},
+	} {
+		value, err := aggregationInt(field.results, field.alias)
+		if err != nil {
+			return nil, nil, err
+		}
+		field.set(value)
+	}
+
+	return summary, storage, nil
+}
+
+// getLegacy reports whether the user exists in the legacy catalog
+func (s *ProfileService) getLegacy(ctx context.Context, firebaseUID string) (*models.ProfileLegacy, error) {
+	if s.postgresService == nil {
+		return nil, fmt.Errorf("legacy database is not configured")
+	}
+
+	legacyUser, err := s.postgresService.GetUserByFirebaseUID(ctx, firebaseUID)
+	if err != nil {
+		if errors.Is(err, ErrLegacyNotFound) {
+			return &models.ProfileLegacy{Exists: false}, nil
+		}
+		return nil, err
+	}
+	return &models.ProfileLegacy{Exists: true, Name: legacyUser.Name}, nil
+}
+
+// aggregationInt reads an integer aggregation result. Sums over fields that are
+// missing on some documents can come back as doubles.
+func aggregationInt(results firestore.AggregationResult, alias string) (int64, error) {
+	value, ok := results[alias]
+	if !ok {
+		return 0, fmt.Errorf("%s aggregation missing from result", alias)
+	}
+
+	switch v := value.(type) {
+	case int64:
+		return v, nil
+	case float64:
+		return int64(v), nil
+	case *firestorepb.Value:
+		if _, isDouble := v.GetValueType().(*firestorepb.Value_DoubleValue); isDouble {
+			return int64(v.GetDoubleValue()), nil
+		}
+		return v.GetIntegerValue(), nil
+	default:
+		return 0, fmt.Errorf("unexpected %s aggregation type %T", alias, value)
+	}
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/models"
+)
+
+func TestProfilePubkeysPrimary(t *testing.T) {
+	now := time.Now()
+	linked := []models.NostrAuth{
+		{Pubkey: "newer", LinkedAt: now, Label: "phone"},
+		{Pubkey: "oldest", LinkedAt: now.Add(-time.Hour)},
+	}
+
+	// Without a chosen primary the earliest linked key is primary
+	pubkeys := profilePubkeys(nil, linked)
+	require.Len(t, pubkeys, 2)
+	assert.False(t, pubkeys[0].Primary)
+	assert.True(t, pubkeys[1].Primary)
+	assert.Equal(t, "phone", pubkeys[0].Label)
+
+	// A chosen primary wins while it is still linked
+	pubkeys = profilePubkeys(&models.User{PrimaryPubkey: "newer"}, linked)
+	assert.True(t, pubkeys[0].Primary)
+	assert.False(t, pubkeys[1].Primary)
+
+	pubkeys = profilePubkeys(&models.User{PrimaryPubkey: "unlinked"}, linked)
+	assert.True(t, pubkeys[1].Primary)
+
+	assert.Empty(t, profilePubkeys(nil, nil))
+}
+
+func TestAggregationInt(t *testing.T) {
+	results := firestore.AggregationResult{
+		"int":    int64(3),
+		"pbInt":  &firestorepb.Value{ValueType: &firestorepb.Value_IntegerValue{IntegerValue: 7}},
+		"pbSum":  &firestorepb.Value{ValueType: &firestorepb.Value_DoubleValue{DoubleValue: 1024}},
+		"string": "nope",
+	}
+
+	for alias, want := range map[string]int64{"int": 3, "pbInt": 7, "pbSum": 1024} {
+		got, err := aggregationInt(results, alias)
+		require.NoError(t, err, alias)
+		assert.Equal(t, want, got, alias)
+	}
+
+	_, err := aggregationInt(results, "string")
+	assert.Error(t, err)
+	_, err = aggregationInt(results, "missing")
+	assert.Error(t, err)
+}
+
+// legacyUserStub answers only the legacy user lookup
+type legacyUserStub struct {
+	PostgresServiceInterface
+	user *models.LegacyUser
+	err  error
+}
+
+func (s legacyUserStub) GetUserByFirebaseUID(ctx context.Context, firebaseUID string) (*models.LegacyUser, error) {
+	return s.user, s.err
+}
+
+func TestProfileLegacy(t *testing.T) {
+	ctx := context.Background()
+
+	legacy, err := (&ProfileService{postgresService: legacyUserStub{user: &models.LegacyUser{Name: "Artist"}}}).getLegacy(ctx, "uid")
+	require.NoError(t, err)
+	assert.Equal(t, &models.ProfileLegacy{Exists: true, Name: "Artist"}, legacy)
+
+	legacy, err = (&ProfileService{postgresService: legacyUserStub{err: fmt.Errorf("failed to get user: %w", ErrLegacyNotFound)}}).getLegacy(ctx, "uid")
+	require.NoError(t, err)
+	assert.False(t, legacy.Exists)
+
+	_, err = (&ProfileService{postgresService: legacyUserStub{err: errors.New("connection refused")}}).getLegacy(ctx, "uid")
+	assert.Error(t, err)
+
+	_, err = (&ProfileService{}).getLegacy(ctx, "uid")
+	assert.Error(t, err)
+}
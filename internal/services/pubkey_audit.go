@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/wavlake/api/internal/models"
+)
+
+const nostrAuthEventsCollection = "nostr_auth_events"
+
+// PubkeyHistoryLimit caps the events returned by a pubkey history lookup
+const PubkeyHistoryLimit = 200
+
+// Authentication methods recorded on pubkey audit events
+const (
+	AuditAuthFirebase = "firebase"
+	AuditAuthDual     = "firebase+nip98"
+)
+
+// RequestOrigin describes the request behind a change, for audit records
+type RequestOrigin struct {
+	IP         string
+	AuthMethod string
+}
+
+type requestOriginContextKey struct{}
+
+// WithRequestOrigin returns a copy of ctx carrying the request's origin, which
+// pubkey audit events record
+func WithRequestOrigin(ctx context.Context, origin RequestOrigin) context.Context {
+	return context.WithValue(ctx, requestOriginContextKey{}, origin)
+}
+
+// RequestOriginFromContext returns the origin carried by ctx, if any;
+// background work has none
+func RequestOriginFromContext(ctx context.Context) RequestOrigin {
+	origin, _ := ctx.Value(requestOriginContextKey{}).(RequestOrigin)
+	return origin
+}
+
+// recordNostrAuthEventTx appends an audit event in the transaction changing
+// the pubkey, so the history can't miss a transition
+func (s *UserService) recordNostrAuthEventTx(ctx context.Context, tx *firestore.Transaction, event models.NostrAuthEvent) error {
+	origin := RequestOriginFromContext(ctx)
+	event.IP = origin.IP
+	event.AuthMethod = origin.AuthMethod
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	if err := tx.Create(s.firestoreClient.Collection(nostrAuthEventsCollection).NewDoc(), event); err != nil {
+		return fmt.Errorf("failed to record pubkey %s event: %w", event.Type, err)
+	}
+	return nil
+}
+
+// GetPubkeyHistory returns the audit events for pubkeys the user linked,
+// unlinked or lost to a transfer, newest first. The other account's UID and
+// request IP are left out of transfers.
+func (s *UserService) GetPubkeyHistory(ctx context.Context, firebaseUID string) ([]models.NostrAuthEvent, error) {
+	var events []models.NostrAuthEvent
+	for _, q := range []struct {
+		query firestore.Query
+		index FirestoreIndex
+	}{
+		{s.pubkeyEventsQuery("new_firebase_uid", firebaseUID), IndexPubkeyEventsByNewOwner},
+		{s.pubkeyEventsQuery("old_firebase_uid", firebaseUID), IndexPubkeyEventsByOldOwner},
+	} {
+		found, err := readNostrAuthEvents(ctx, q.query, q.index)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, found...)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].CreatedAt.After(events[j].CreatedAt) })
+	if len(events) > PubkeyHistoryLimit {
+		events = events[:PubkeyHistoryLimit]
+	}
+	for i := range events {
+		events[i] = ownPubkeyEvent(events[i], firebaseUID)
+	}
+	return events, nil
+}
+
+// GetPubkeyHistoryByPubkey returns every audit event for a pubkey, newest
+// first, for support tooling
+func (s *UserService) GetPubkeyHistoryByPubkey(ctx context.Context, pubkey string) ([]models.NostrAuthEvent, error) {
+	return readNostrAuthEvents(ctx, s.pubkeyEventsQuery("pubkey", pubkey), IndexPubkeyEventsByPubkey)
+}
+
+func (s *UserService) pubkeyEventsQuery(field, value string) firestore.Query {
+	return s.firestoreClient.Collection(nostrAuthEventsCollection).
+		Where(field, "==", value).
+		OrderBy("created_at", firestore.Desc).
+		Limit(PubkeyHistoryLimit)
+}
+
+func readNostrAuthEvents(ctx context.Context, query firestore.Query, index FirestoreIndex) ([]models.NostrAuthEvent, error) {
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pubkey history: %w", wrapIndexError(err, index))
+	}
+
+	events := make([]models.NostrAuthEvent, 0, len(docs))
+	for _, doc := range docs {
+		var event models.NostrAuthEvent
+		if err := doc.DataTo(&event); err != nil {
+			return nil, fmt.Errorf("failed to parse pubkey event %s: %w", doc.Ref.ID, err)
+		}
+		event.ID = doc.Ref.ID
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// ownPubkeyEvent removes what an event says about an account other than
+// firebaseUID's; only transfers involve two accounts
+func ownPubkeyEvent(event models.NostrAuthEvent, firebaseUID string) models.NostrAuthEvent {
+	if event.OldFirebaseUID != firebaseUID {
+		event.OldFirebaseUID = ""
+	}
+	if event.NewFirebaseUID != "" && event.NewFirebaseUID != firebaseUID {
+		// The request came from the other account
+		event.NewFirebaseUID = ""
+		event.IP = ""
+	}
+	return event
+}
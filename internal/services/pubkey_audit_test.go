@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/wavlake/api/internal/models"
+)
+
+func TestRequestOriginFromContext(t *testing.T) {
+	assert.Equal(t, RequestOrigin{}, RequestOriginFromContext(context.Background()))
+
+	ctx := WithRequestOrigin(context.Background(), RequestOrigin{IP: "203.0.113.7", AuthMethod: AuditAuthDual})
+	assert.Equal(t, RequestOrigin{IP: "203.0.113.7", AuthMethod: AuditAuthDual}, RequestOriginFromContext(ctx))
+	// Detached background work keeps the origin of the request that started it
+	assert.Equal(t, "203.0.113.7", RequestOriginFromContext(context.WithoutCancel(ctx)).IP)
+}
+
+func TestOwnPubkeyEvent(t *testing.T) {
+	transfer := models.NostrAuthEvent{
+		Type:           models.NostrAuthEventTransfer,
+		Pubkey:         "pk",
+		OldFirebaseUID: "user-a",
+		NewFirebaseUID: "user-b",
+		IP:             "203.0.113.7",
+		AuthMethod:     AuditAuthDual,
+	}
+
+	// The previous owner sees that the pubkey moved, but not where or from which IP
+	lost := ownPubkeyEvent(transfer, "user-a")
+	assert.Equal(t, "user-a", lost.OldFirebaseUID)
+	assert.Empty(t, lost.NewFirebaseUID)
+	assert.Empty(t, lost.IP)
+	assert.Equal(t, AuditAuthDual, lost.AuthMethod)
+
+	// The new owner sees their own request, but not who had the pubkey before
+	gained := ownPubkeyEvent(transfer, "user-b")
+	assert.Empty(t, gained.OldFirebaseUID)
+	assert.Equal(t, "user-b", gained.NewFirebaseUID)
+	assert.Equal(t, "203.0.113.7", gained.IP)
+
+	// Unlinks are the owner's own request
+	unlink := models.NostrAuthEvent{Type: models.NostrAuthEventUnlink, Pubkey: "pk", OldFirebaseUID: "user-a", IP: "203.0.113.7"}
+	assert.Equal(t, unlink, ownPubkeyEvent(unlink, "user-a"))
+}
+
+// PubkeyAuditEmulatorTestSuite checks the audit events written for each
+// pubkey transition against the Firestore emulator. Run with
+// FIRESTORE_EMULATOR_HOST set, as for NostrTrackEmulatorTestSuite.
+type PubkeyAuditEmulatorTestSuite struct {
+	suite.Suite
+	ctx     context.Context
+	client  *firestore.Client
+	service *UserService
+	pubkey  string
+}
+
+func (suite *PubkeyAuditEmulatorTestSuite) SetupSuite() {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		suite.T().Skip("FIRESTORE_EMULATOR_HOST not set, skipping emulator tests")
+	}
+
+	client, err := firestore.NewClient(context.Background(), "wavlake-test")
+	suite.Require().NoError(err)
+	suite.client = client
+	suite.service = NewUserService(client, nil)
+	suite.ctx = WithRequestOrigin(context.Background(), RequestOrigin{IP: "203.0.113.7", AuthMethod: AuditAuthDual})
+}
+
+func (suite *PubkeyAuditEmulatorTestSuite) TearDownSuite() {
+	if suite.client != nil {
+		suite.client.Close()
+	}
+}
+
+func (suite *PubkeyAuditEmulatorTestSuite) SetupTest() {
+	suite.pubkey = randomPubkey()
+}
+
+// events returns the pubkey's audit events, oldest first
+func (suite *PubkeyAuditEmulatorTestSuite) events() []models.NostrAuthEvent {
+	events, err := suite.service.GetPubkeyHistoryByPubkey(suite.ctx, suite.pubkey)
+	suite.Require().NoError(err)
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return events
+}
+
+func (suite *PubkeyAuditEmulatorTestSuite) TestLinkAndUnlink() {
+	uid := uuid.New().String()
+	suite.Require().NoError(linkPubkey(suite.ctx, suite.service, suite.pubkey, uid))
+	unlinkCtx := WithRequestOrigin(context.Background(), RequestOrigin{IP: "198.51.100.2", AuthMethod: AuditAuthFirebase})
+	suite.Require().NoError(suite.service.UnlinkPubkeyFromUser(unlinkCtx, suite.pubkey, uid))
+
+	events := suite.events()
+	suite.Require().Len(events, 2)
+	suite.Equal(models.NostrAuthEventLink, events[0].Type)
+	suite.Equal(uid, events[0].NewFirebaseUID)
+	suite.Empty(events[0].OldFirebaseUID)
+	suite.Equal("203.0.113.7", events[0].IP)
+	suite.Equal(AuditAuthDual, events[0].AuthMethod)
+
+	suite.Equal(models.NostrAuthEventUnlink, events[1].Type)
+	suite.Equal(uid, events[1].OldFirebaseUID)
+	suite.Empty(events[1].NewFirebaseUID)
+	suite.Equal("198.51.100.2", events[1].IP)
+	suite.Equal(AuditAuthFirebase, events[1].AuthMethod)
+
+	history, err := suite.service.GetPubkeyHistory(suite.ctx, uid)
+	suite.Require().NoError(err)
+	suite.Len(history, 2)
+	suite.Equal(models.NostrAuthEventUnlink, history[0].Type, "newest first")
+}
+
+func (suite *PubkeyAuditEmulatorTestSuite) TestInactivePubkeyTransfer() {
+	previous, next := uuid.New().String(), uuid.New().String()
+	suite.Require().NoError(linkPubkey(suite.ctx, suite.service, suite.pubkey, previous))
+	suite.Require().NoError(suite.service.UnlinkPubkeyFromUser(suite.ctx, suite.pubkey, previous))
+	suite.Require().NoError(linkPubkey(suite.ctx, suite.service, suite.pubkey, next))
+
+	events := suite.events()
+	suite.Require().Len(events, 3)
+	transfer := events[2]
+	suite.Equal(models.NostrAuthEventTransfer, transfer.Type)
+	suite.Equal(previous, transfer.OldFirebaseUID)
+	suite.Equal(next, transfer.NewFirebaseUID)
+
+	// Both accounts see the transfer, each without the other's details
+	lost, err := suite.service.GetPubkeyHistory(suite.ctx, previous)
+	suite.Require().NoError(err)
+	suite.Require().Len(lost, 3)
+	suite.Equal(models.NostrAuthEventTransfer, lost[0].Type)
+	suite.Empty(lost[0].NewFirebaseUID)
+	suite.Empty(lost[0].IP)
+
+	gained, err := suite.service.GetPubkeyHistory(suite.ctx, next)
+	suite.Require().NoError(err)
+	suite.Require().Len(gained, 1)
+	suite.Empty(gained[0].OldFirebaseUID)
+}
+
+func (suite *PubkeyAuditEmulatorTestSuite) TestRejectedLinkRecordsNothing() {
+	owner := uuid.New().String()
+	suite.Require().NoError(linkPubkey(suite.ctx, suite.service, suite.pubkey, owner))
+
+	err := linkPubkey(suite.ctx, suite.service, suite.pubkey, uuid.New().String())
+	suite.ErrorContains(err, "already linked to a different user")
+	suite.Len(suite.events(), 1)
+}
+
+func (suite *PubkeyAuditEmulatorTestSuite) TestRelinkBySameUser() {
+	uid := uuid.New().String()
+	suite.Require().NoError(linkPubkey(suite.ctx, suite.service, suite.pubkey, uid))
+	suite.Require().NoError(suite.service.UnlinkPubkeyFromUser(suite.ctx, suite.pubkey, uid))
+	suite.Require().NoError(linkPubkey(suite.ctx, suite.service, suite.pubkey, uid))
+
+	events := suite.events()
+	suite.Require().Len(events, 3)
+	suite.Equal(models.NostrAuthEventLink, events[2].Type)
+	suite.Empty(events[2].OldFirebaseUID)
+}
+
+func (suite *PubkeyAuditEmulatorTestSuite) TestDeactivatePubkeys() {
+	uid := uuid.New().String()
+	suite.Require().NoError(linkPubkey(suite.ctx, suite.service, suite.pubkey, uid))
+
+	count, err := suite.service.DeactivatePubkeys(suite.ctx, uid)
+	suite.Require().NoError(err)
+	suite.Equal(1, count)
+
+	events := suite.events()
+	suite.Require().Len(events, 2)
+	suite.Equal(models.NostrAuthEventUnlink, events[1].Type)
+	suite.Equal(uid, events[1].OldFirebaseUID)
+}
+
+func TestPubkeyAuditEmulatorTestSuite(t *testing.T) {
+	suite.Run(t, new(PubkeyAuditEmulatorTestSuite))
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"github.com/wavlake/api/internal/models"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	// DefaultSearchPageSize and MaxSearchPageSize bound search result pages
+	DefaultSearchPageSize = 20
+	MaxSearchPageSize     = 50
+
+	// MaxSearchQueryLength bounds the text of a search query
+	MaxSearchQueryLength = 100
+
+	// searchCandidateLimit is how many prefix matches are read per field before
+	// ranking; results past it are not reachable by paging
+	searchCandidateLimit = 200
+
+	// searchPrefixEnd sorts after any character used in normalized text, so
+	// [prefix, prefix+searchPrefixEnd) selects every value starting with prefix
+	searchPrefixEnd = "\uf8ff"
+)
+
+// ErrInvalidSearchCursor is returned for a page cursor that isn't one of the
+// query's results
+var ErrInvalidSearchCursor = errors.New("invalid cursor")
+
+// Search relevance, highest first
+const (
+	searchScoreTitleExact = 4 - iota
+	searchScoreArtistExact
+	searchScoreTitlePrefix
+	searchScoreArtistPrefix
+	searchScoreNone
+)
+
+// FirestoreSearchIndex serves track search from Firestore prefix queries over
+// the normalized title and artist fields written alongside track metadata.
+// Only whole-field prefixes match; a search backend can replace it later.
+type FirestoreSearchIndex struct {
+	nostrTrackService *NostrTrackService
+}
+
+func NewFirestoreSearchIndex(nostrTrackService *NostrTrackService) *FirestoreSearchIndex {
+	return &FirestoreSearchIndex{nostrTrackService: nostrTrackService}
+}
+
+// NormalizeSearchText lowercases text and collapses whitespace, the form
+// stored in the *_normalized fields and used for queries
+func NormalizeSearchText(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(text)), " ")
+}
+
+// searchFieldUpdates returns the track updates for new title and artist
+// metadata, keeping the normalized search fields in step. Empty values are
+// left unchanged.
+func searchFieldUpdates(title, artist string) map[string]interface{} {
+	updates := map[string]interface{}{}
+	if title = strings.TrimSpace(title); title != "" {
+		updates["title"] = title
+		updates["title_normalized"] = NormalizeSearchText(title)
+	}
+	if artist = strings.TrimSpace(artist); artist != "" {
+		updates["artist"] = artist
+		updates["artist_normalized"] = NormalizeSearchText(artist)
+	}
+	return updates
+}
+
+// searchPrefixQuery selects published, non-deleted tracks whose normalized
+// field starts with prefix; it needs IndexPublicTracksByTitle or IndexPublicTracksByArtist
+func (s *FirestoreSearchIndex) searchPrefixQuery(field, prefix string) firestore.Query {
+	return s.nostrTrackService.firestoreClient.Collection("nostr_tracks").
+		Where("is_published", "==", true).
+		Where("deleted", "==", false).
+		Where(field, ">=", prefix).
+		Where(field, "<", prefix+searchPrefixEnd).
+		OrderBy(field, firestore.Asc)
+}
+
+// SearchTracks returns a page of public tracks matching the query by title or
+// artist, most relevant first. The returned cursor is the ID of the last track
+// on the page and is empty when there are no more results.
+func (s *FirestoreSearchIndex) SearchTracks(ctx context.Context, query string, limit int, cursor string) ([]*models.NostrTrack, string, error) {
+	if limit <= 0 {
+		limit = DefaultSearchPageSize
+	}
+	if limit > MaxSearchPageSize {
+		limit = MaxSearchPageSize
+	}
+
+	normalized := NormalizeSearchText(query)
+	if normalized == "" {
+		return []*models.NostrTrack{}, "", nil
+	}
+
+	candidates := map[string]*models.NostrTrack{}
+	for _, search := range []struct {
+		field string
+		index FirestoreIndex
+	}{
+		{"title_normalized", IndexPublicTracksByTitle},
+		{"artist_normalized", IndexPublicTracksByArtist},
+	} {
+		if err := s.collectCandidates(ctx, s.searchPrefixQuery(search.field, normalized), search.index, candidates); err != nil {
+			return nil, "", err
+		}
+	}
+
+	ranked := rankSearchResults(normalized, candidates)
+
+	start := 0
+	if cursor != "" {
+		start = -1
+		for i, track := range ranked {
+			if track.ID == cursor {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			return nil, "", ErrInvalidSearchCursor
+		}
+	}
+
+	page := ranked[start:]
+	nextCursor := ""
+	if len(page) > limit {
+		page = page[:limit]
+		nextCursor = page[limit-1].ID
+	}
+
+	for _, track := range page {
+		if err := s.nostrTrackService.loadVersions(ctx, track); err != nil {
+			return nil, "", err
+		}
+		s.nostrTrackService.resolveURLs(track)
+	}
+
+	return page, nextCursor, nil
+}
+
+// collectCandidates adds the ready tracks a prefix query returns to candidates
+func (s *FirestoreSearchIndex) collectCandidates(ctx context.Context, query firestore.Query, index FirestoreIndex, candidates map[string]*models.NostrTrack) error {
+	iter := query.Limit(searchCandidateLimit).Documents(ctx)
+	defer iter.Stop()
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to search tracks: %w", wrapIndexError(err, index))
+		}
+
+		var track models.NostrTrack
+		if err := doc.DataTo(&track); err != nil {
+			log.Printf("Failed to decode track %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		track.Status = track.CurrentStatus()
+		if track.Status != models.TrackStatusReady {
+			continue
+		}
+
+		candidates[track.ID] = &track
+	}
+}
+
+// rankSearchResults orders matching tracks by relevance to the normalized
+// query: exact title, exact artist, title prefix, then artist prefix. Ties go
+// to the newer track, then the lower ID so pages are stable.
+func rankSearchResults(query string, candidates map[string]*models.NostrTrack) []*models.NostrTrack {
+	scores := make(map[string]int, len(candidates))
+	ranked := make([]*models.NostrTrack, 0, len(candidates))
+	for id, track := range candidates {
+		score := searchScore(query, track)
+		if score == searchScoreNone {
+			continue
+		}
+		scores[id] = score
+		ranked = append(ranked, track)
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if scores[a.ID] != scores[b.ID] {
+			return scores[a.ID] > scores[b.ID]
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	})
+
+	return ranked
+}
+
+func searchScore(query string, track *models.NostrTrack) int {
+	switch {
+	case track.TitleNormalized == query:
+		return searchScoreTitleExact
+	case track.ArtistNormalized == query:
+		return searchScoreArtistExact
+	case strings.HasPrefix(track.TitleNormalized, query):
+		return searchScoreTitlePrefix
+	case strings.HasPrefix(track.ArtistNormalized, query):
+		return searchScoreArtistPrefix
+	default:
+		return searchScoreNone
+	}
+}
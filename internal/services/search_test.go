@@ -0,0 +1,86 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	gonostr "github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/wavlake/api/internal/models"
+)
+
+func searchFixture(id, title, artist string, age time.Duration) *models.NostrTrack {
+	return &models.NostrTrack{
+		ID:               id,
+		Title:            title,
+		TitleNormalized:  NormalizeSearchText(title),
+		Artist:           artist,
+		ArtistNormalized: NormalizeSearchText(artist),
+		CreatedAt:        time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).Add(-age),
+	}
+}
+
+func TestRankSearchResultsOrder(t *testing.T) {
+	candidates := map[string]*models.NostrTrack{}
+	for _, track := range []*models.NostrTrack{
+		searchFixture("artist-prefix", "Blue Skies", "Midnight Riders", 0),
+		searchFixture("title-prefix-old", "Midnight Train", "Various", 2*time.Hour),
+		searchFixture("title-prefix-new", "Midnight  City", "Various", time.Hour),
+		searchFixture("artist-exact", "Daybreak", "Midnight", 0),
+		searchFixture("title-exact", "MIDNIGHT", "Someone", 3*time.Hour),
+		searchFixture("no-match", "Noon", "Afternoon Midnight", 0),
+		searchFixture("tie-b", "Midnight Sun", "Various", 4*time.Hour),
+		searchFixture("tie-a", "Midnight Sun", "Various", 4*time.Hour),
+	} {
+		candidates[track.ID] = track
+	}
+
+	ranked := rankSearchResults(NormalizeSearchText(" Midnight "), candidates)
+
+	assert.Equal(t, []string{
+		"title-exact",
+		"artist-exact",
+		"title-prefix-new",
+		"title-prefix-old",
+		"tie-a",
+		"tie-b",
+		"artist-prefix",
+	}, trackIDs(ranked))
+}
+
+func TestRankSearchResultsMultiWordPrefix(t *testing.T) {
+	candidates := map[string]*models.NostrTrack{
+		"city":  searchFixture("city", "Midnight City", "M83", 0),
+		"train": searchFixture("train", "Midnight Train", "Various", 0),
+	}
+
+	ranked := rankSearchResults(NormalizeSearchText("midnight   c"), candidates)
+
+	assert.Equal(t, []string{"city"}, trackIDs(ranked))
+}
+
+func TestNormalizeSearchText(t *testing.T) {
+	assert.Equal(t, "the night shift", NormalizeSearchText("  The\tNight   SHIFT "))
+	assert.Equal(t, "", NormalizeSearchText("   "))
+}
+
+func TestSearchFieldUpdates(t *testing.T) {
+	assert.Equal(t, map[string]interface{}{
+		"title":            "Midnight City",
+		"title_normalized": "midnight city",
+	}, searchFieldUpdates(" Midnight City ", ""))
+
+	assert.Empty(t, searchFieldUpdates("", "  "))
+}
+
+func TestEventTagValue(t *testing.T) {
+	event := &gonostr.Event{Tags: gonostr.Tags{
+		{"d", "track-1"},
+		{"title", "Midnight City"},
+		{"creator", "M83"},
+	}}
+
+	assert.Equal(t, "Midnight City", eventTagValue(event, "title"))
+	assert.Equal(t, "M83", eventTagValue(event, "artist", "creator"))
+	assert.Equal(t, "", eventTagValue(event, "album"))
+}
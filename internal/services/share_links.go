@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/models"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// trackShareLinksCollection is the per-track subcollection of share links
+	trackShareLinksCollection = "share_links"
+
+	// DefaultShareLinkTTL and MaxShareLinkTTL bound how long a share link works
+	DefaultShareLinkTTL = 7 * 24 * time.Hour
+	MaxShareLinkTTL     = 30 * 24 * time.Hour
+
+	// MaxShareLinksPerTrack bounds the links kept on a track, revoked or not
+	MaxShareLinksPerTrack = 50
+
+	// sharedStreamExpiration bounds the signed URLs handed out for a share link
+	sharedStreamExpiration = 15 * time.Minute
+
+	// shareTokenBytes is the size of the random part of a token
+	shareTokenBytes = 32
+)
+
+var (
+	// ErrShareLinkNotFound is returned for tokens and link IDs that don't name a link
+	ErrShareLinkNotFound = apierror.New(http.StatusNotFound, "share_link.not_found", "share link not found")
+	// ErrShareLinkGone is returned for links that were revoked, have expired or
+	// are used up, and for links to tracks that were deleted
+	ErrShareLinkGone = apierror.New(http.StatusGone, "share_link.gone", "share link is no longer valid")
+	// ErrTooManyShareLinks is returned when a track already has MaxShareLinksPerTrack links
+	ErrTooManyShareLinks = apierror.New(http.StatusConflict, "share_link.limit_reached", fmt.Sprintf("a track can have at most %d share links", MaxShareLinksPerTrack))
+)
+
+// hashShareToken returns the stored form of a token
+func hashShareToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateShareLink adds a share link to a track. The returned link carries the
+// token, which is "<track ID>.<random secret>"; only its hash is stored, so it
+// can't be shown again. maxUses of zero allows unlimited uses.
+func (s *NostrTrackService) CreateShareLink(ctx context.Context, trackID string, ttl time.Duration, maxUses int) (*models.ShareLink, error) {
+	links := s.firestoreClient.Collection("nostr_tracks").Doc(trackID).Collection(trackShareLinksCollection)
+
+	existing, err := links.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count share links: %w", err)
+	}
+	if len(existing) >= MaxShareLinksPerTrack {
+		return nil, ErrTooManyShareLinks
+	}
+
+	secret := make([]byte, shareTokenBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate share token: %w", err)
+	}
+	token := trackID + "." + base64.RawURLEncoding.EncodeToString(secret)
+
+	now := time.Now()
+	link := &models.ShareLink{
+		ID:        uuid.New().String(),
+		TrackID:   trackID,
+		TokenHash: hashShareToken(token),
+		ExpiresAt: now.Add(ttl),
+		MaxUses:   maxUses,
+		CreatedAt: now,
+	}
+	if _, err := links.Doc(link.ID).Set(ctx, link); err != nil {
+		return nil, fmt.Errorf("failed to save share link: %w", err)
+	}
+
+	link.Token = token
+	link.Status = link.CurrentStatus(now)
+	log.Printf("Created share link %s for track %s (expires %s)", link.ID, trackID, link.ExpiresAt.Format(time.RFC3339))
+	return link, nil
+}
+
+// ListShareLinks returns a track's share links, newest first
+func (s *NostrTrackService) ListShareLinks(ctx context.Context, trackID string) ([]models.ShareLink, error) {
+	iter := s.firestoreClient.Collection("nostr_tracks").Doc(trackID).Collection(trackShareLinksCollection).
+		OrderBy("created_at", firestore.Desc).
+		Documents(ctx)
+	defer iter.Stop()
+
+	now := time.Now()
+	links := []models.ShareLink{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate share links: %w", err)
+		}
+
+		var link models.ShareLink
+		if err := doc.DataTo(&link); err != nil {
+			log.Printf("Failed to decode share link %s for track %s: %v", doc.Ref.ID, trackID, err)
+			continue
+		}
+		link.Status = link.CurrentStatus(now)
+		links = append(links, link)
+	}
+
+	return links, nil
+}
+
+// RevokeShareLink stops a share link from working. Revoking a link twice is
+// not an error.
+func (s *NostrTrackService) RevokeShareLink(ctx context.Context, trackID, linkID string) error {
+	ref := s.firestoreClient.Collection("nostr_tracks").Doc(trackID).Collection(trackShareLinksCollection).Doc(linkID)
+
+	return s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return ErrShareLinkNotFound
+			}
+			return fmt.Errorf("failed to get share link: %w", err)
+		}
+
+		if revokedAt, _ := doc.DataAt("revoked_at"); revokedAt != nil {
+			return nil
+		}
+		return tx.Update(ref, []firestore.Update{{Path: "revoked_at", Value: time.Now()}})
+	})
+}
+
+// OpenShareLink resolves a token to its track and counts one use. Links that
+// can't be used any more fail with ErrShareLinkGone.
+func (s *NostrTrackService) OpenShareLink(ctx context.Context, token string) (*models.NostrTrack, *models.ShareLink, error) {
+	trackID, _, ok := strings.Cut(token, ".")
+	if !ok || trackID == "" {
+		return nil, nil, ErrShareLinkNotFound
+	}
+
+	track, err := s.GetTrack(ctx, trackID)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, nil, ErrShareLinkNotFound
+		}
+		return nil, nil, err
+	}
+
+	query := s.firestoreClient.Collection("nostr_tracks").Doc(trackID).Collection(trackShareLinksCollection).
+		Where("token_hash", "==", hashShareToken(token)).
+		Limit(1)
+
+	var link models.ShareLink
+	err = s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docs, err := tx.Documents(query).GetAll()
+		if err != nil {
+			return fmt.Errorf("failed to find share link: %w", err)
+		}
+		if len(docs) == 0 {
+			return ErrShareLinkNotFound
+		}
+
+		link = models.ShareLink{}
+		if err := docs[0].DataTo(&link); err != nil {
+			return fmt.Errorf("failed to decode share link: %w", err)
+		}
+
+		now := time.Now()
+		if track.Deleted {
+			return ErrShareLinkGone.WithMessage(ErrShareLinkGone.Message + ": track was deleted")
+		}
+		if linkStatus := link.CurrentStatus(now); linkStatus != models.ShareLinkStatusActive {
+			return ErrShareLinkGone.WithMessage(fmt.Sprintf("%s: link is %s", ErrShareLinkGone.Message, linkStatus))
+		}
+
+		link.Uses++
+		link.LastUsedAt = &now
+		link.Status = link.CurrentStatus(now)
+		return tx.Update(docs[0].Ref, []firestore.Update{
+			{Path: "uses", Value: firestore.Increment(1)},
+			{Path: "last_used_at", Value: now},
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return track, &link, nil
+}
+
+// SignSharedStreams returns short-lived signed URLs for each of a track's
+// completed compressed versions, so shared tracks play without their files
+// being public. Versions still encoding, or that failed, have no file to sign.
+func (s *NostrTrackService) SignSharedStreams(ctx context.Context, track *models.NostrTrack) ([]models.SharedStream, error) {
+	storageService := s.StorageFor(track)
+	expiresAt := time.Now().Add(sharedStreamExpiration)
+
+	versions := track.CompressionVersions
+	if len(versions) == 0 && track.CompressedURL != "" {
+		// Tracks processed before versions existed only have the default file
+		versions = []models.CompressionVersion{{ID: defaultVersionID, URL: track.CompressedURL, Format: "mp3", Bitrate: 128}}
+	}
+
+	streams := []models.SharedStream{}
+	for _, version := range versions {
+		if !version.Completed() || version.URL == "" {
+			continue
+		}
+		objectName := s.pathConfig.GetCompressedVersionPath(track.ID, version.ID, version.Format)
+		if version.ID == defaultVersionID {
+			objectName = s.pathConfig.GetCompressedPath(track.ID)
+		}
+
+		url, err := storageService.GenerateDownloadURL(ctx, objectName, sharedStreamExpiration)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign stream URL for version %s: %w", version.ID, err)
+		}
+		streams = append(streams, models.SharedStream{
+			VersionID: version.ID,
+			Format:    version.Format,
+			Bitrate:   version.Bitrate,
+			URL:       url,
+			ExpiresAt: expiresAt,
+		})
+	}
+
+	return streams, nil
+}
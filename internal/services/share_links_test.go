@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/models"
+)
+
+func TestShareLinkStatus(t *testing.T) {
+	now := time.Now()
+	revokedAt := now.Add(-time.Minute)
+
+	tests := []struct {
+		name string
+		link models.ShareLink
+		want string
+	}{
+		{"active", models.ShareLink{ExpiresAt: now.Add(time.Hour)}, models.ShareLinkStatusActive},
+		{"uses left", models.ShareLink{ExpiresAt: now.Add(time.Hour), MaxUses: 2, Uses: 1}, models.ShareLinkStatusActive},
+		{"used up", models.ShareLink{ExpiresAt: now.Add(time.Hour), MaxUses: 2, Uses: 2}, models.ShareLinkStatusExhausted},
+		{"expired", models.ShareLink{ExpiresAt: now}, models.ShareLinkStatusExpired},
+		{"revoked wins", models.ShareLink{ExpiresAt: now, MaxUses: 1, Uses: 1, RevokedAt: &revokedAt}, models.ShareLinkStatusRevoked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.link.CurrentStatus(now))
+		})
+	}
+}
+
+func TestHashShareToken(t *testing.T) {
+	hash := hashShareToken("track-1.secret")
+
+	assert.Len(t, hash, 64)
+	assert.Equal(t, hash, hashShareToken("track-1.secret"))
+	assert.NotEqual(t, hash, hashShareToken("track-1.secreT"))
+	assert.NotContains(t, hash, "secret")
+}
+
+func TestSignSharedStreamsSkipsUnfinishedVersions(t *testing.T) {
+	s := NewNostrTrackService(nil, NewStorageRegions("us", &signingStorage{}))
+	track := &models.NostrTrack{ID: "abc", CompressionVersions: []models.CompressionVersion{
+		{ID: "done", Format: "mp3", Bitrate: 128, URL: "https://storage.example.com/done.mp3", Status: models.VersionStatusCompleted},
+		{ID: "legacy", Format: "aac", Bitrate: 256, URL: "https://storage.example.com/legacy.aac"},
+		{ID: "pending", Format: "mp3", Bitrate: 320, Status: models.VersionStatusPending},
+		{ID: "failed", Format: "opus", Bitrate: 96, Status: models.VersionStatusFailed, Error: "ffmpeg exited"},
+		{ID: "no-file", Format: "ogg", Bitrate: 128, Status: models.VersionStatusCompleted},
+	}}
+
+	streams, err := s.SignSharedStreams(context.Background(), track)
+	require.NoError(t, err)
+
+	var ids []string
+	for _, stream := range streams {
+		ids = append(ids, stream.VersionID)
+	}
+	assert.Equal(t, []string{"done", "legacy"}, ids)
+}
@@ -3,24 +3,105 @@ package services
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/storage"
 	"google.golang.org/api/iamcredentials/v1"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
 type StorageService struct {
 	client     *storage.Client
 	bucketName string
+	cdnDomain  string // Optional domain serving the bucket, used for public URLs
+
+	// Optional base URL serving the bucket (PUBLIC_MEDIA_BASE_URL); takes
+	// precedence over cdnDomain
+	publicBaseURL string
+}
+
+// StorageProviderGCS is the STORAGE_PROVIDER value for Google Cloud Storage,
+// and the backend used when STORAGE_PROVIDER is unset
+const StorageProviderGCS = "gcs"
+
+// deleteObjectsConcurrency bounds the deletes DeleteObjects runs at once
+const deleteObjectsConcurrency = 8
+
+// ErrUnsupportedStorageProvider is returned for STORAGE_PROVIDER values this
+// build has no backend for
+var ErrUnsupportedStorageProvider = errors.New("unsupported storage provider")
+
+// NewStorageFromEnv creates the storage backend named by STORAGE_PROVIDER.
+// GCS reads its bucket from GCS_BUCKET_NAME; Azure reads its account and
+// container from the AZURE_STORAGE_* variables, and local storage its
+// directory from LOCAL_STORAGE_DIR. Any other provider, s3 included, returns
+// ErrUnsupportedStorageProvider. The backend is wrapped in a RetryingStorage
+// making up to STORAGE_RETRY_ATTEMPTS attempts.
+func NewStorageFromEnv(ctx context.Context) (StorageServiceInterface, error) {
+	backend, err := newStorageBackendFromEnv(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := DefaultRetryPolicy()
+	if raw := os.Getenv("STORAGE_RETRY_ATTEMPTS"); raw != "" {
+		attempts, err := strconv.Atoi(raw)
+		if err != nil || attempts < 1 {
+			return nil, fmt.Errorf("invalid STORAGE_RETRY_ATTEMPTS %q: must be a positive integer", raw)
+		}
+		policy.MaxAttempts = attempts
+	}
+	return NewRetryingStorage(backend, policy), nil
+}
+
+// StorageProviderFromEnv returns the STORAGE_PROVIDER backend
+// NewStorageFromEnv creates, normalized, with unset as StorageProviderGCS
+func StorageProviderFromEnv() string {
+	provider := strings.ToLower(strings.TrimSpace(os.Getenv("STORAGE_PROVIDER")))
+	if provider == "" {
+		return StorageProviderGCS
+	}
+	return provider
 }
 
-// Make client accessible for direct operations
-func (s *StorageService) GetClient() *storage.Client {
-	return s.client
+func newStorageBackendFromEnv(ctx context.Context) (StorageServiceInterface, error) {
+	provider := StorageProviderFromEnv()
+
+	switch provider {
+	case StorageProviderGCS:
+		bucketName := os.Getenv("GCS_BUCKET_NAME")
+		if bucketName == "" {
+			log.Println("Warning: GCS_BUCKET_NAME environment variable not set")
+			bucketName = "default-bucket"
+		}
+		log.Printf("Initializing GCS storage service with bucket: %s", bucketName)
+		return NewStorageService(ctx, bucketName)
+	case StorageProviderAzure:
+		service, err := newAzureStorageFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Initializing Azure storage service with container: %s", service.containerName)
+		return service, nil
+	case StorageProviderLocal:
+		service, err := newLocalStorageFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Initializing local storage service in %s, served from %s", service.root, service.baseURL+LocalFilesRoute)
+		return service, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedStorageProvider, provider)
+	}
 }
 
 func (s *StorageService) GetBucketName() string {
@@ -48,31 +129,105 @@ func NewStorageService(ctx context.Context, bucketName string) (*StorageService,
 	}, nil
 }
 
+// newStorageServiceForBucket creates a service for another bucket that shares an
+// existing client. Closing the owner of the client closes it for both.
+func newStorageServiceForBucket(client *storage.Client, bucketName, cdnDomain string) *StorageService {
+	return &StorageService{
+		client:     client,
+		bucketName: bucketName,
+		cdnDomain:  cdnDomain,
+	}
+}
+
 func (s *StorageService) Close() error {
 	return s.client.Close()
 }
 
+// UploadConstraints limit what a presigned upload URL accepts. Backends that
+// can sign headers into the URL reject uploads that don't send them or that
+// go past MaxBytes. Zero values leave that part unconstrained.
+type UploadConstraints struct {
+	ContentType string
+	MaxBytes    int64
+}
+
+// UploadHeaders returns the headers an upload must send with a URL from
+// GeneratePresignedURL
+func (s *StorageService) UploadHeaders(constraints UploadConstraints) map[string]string {
+	return gcsUploadHeaders(constraints)
+}
+
+// gcsUploadHeaders returns the headers GCS signs into an upload URL
+func gcsUploadHeaders(c UploadConstraints) map[string]string {
+	headers := map[string]string{}
+	if c.ContentType != "" {
+		headers["Content-Type"] = c.ContentType
+	}
+	if c.MaxBytes > 0 {
+		headers["X-Goog-Content-Length-Range"] = fmt.Sprintf("0,%d", c.MaxBytes)
+	}
+	return headers
+}
+
+// signingServiceAccount signs URLs; with Cloud Run's default credentials the
+// service account email has to be given explicitly
+const signingServiceAccount = "api-service@wavlake-alpha.iam.gserviceaccount.com"
+
 // GeneratePresignedURL creates a presigned URL for uploading files
-func (s *StorageService) GeneratePresignedURL(ctx context.Context, objectName string, expiration time.Duration) (string, error) {
-	// For Cloud Run with default credentials, we need to specify the service account email
-	serviceAccountEmail := "api-service@wavlake-alpha.iam.gserviceaccount.com"
+func (s *StorageService) GeneratePresignedURL(ctx context.Context, objectName string, expiration time.Duration, constraints UploadConstraints) (string, error) {
+	serviceAccountEmail := signingServiceAccount
 
-	// Generate a presigned URL for PUT operations
-	opts := &storage.SignedURLOptions{
+	opts := uploadURLOptions(serviceAccountEmail, expiration, constraints, func(b []byte) ([]byte, error) {
+		// Use the IAM service to sign the bytes
+		return signBytes(ctx, serviceAccountEmail, b)
+	})
+
+	url, err := s.client.Bucket(s.bucketName).SignedURL(objectName, opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate presigned URL: %w", err)
+	}
+
+	return url, nil
+}
+
+// uploadURLOptions returns the options signing a PUT URL that requires the
+// constraints' headers. Content-Type is signed with the constrained value, or
+// without one when the constraints don't set it.
+func uploadURLOptions(serviceAccountEmail string, expiration time.Duration, constraints UploadConstraints, sign func([]byte) ([]byte, error)) *storage.SignedURLOptions {
+	headers := []string{"Content-Type"}
+	for name, value := range gcsUploadHeaders(constraints) {
+		if name == "Content-Type" {
+			headers[0] = name + ":" + value
+			continue
+		}
+		headers = append(headers, name+":"+value)
+	}
+
+	return &storage.SignedURLOptions{
 		Scheme:         storage.SigningSchemeV4,
 		Method:         "PUT",
-		Headers:        []string{"Content-Type"},
+		Headers:        headers,
 		Expires:        time.Now().Add(expiration),
 		GoogleAccessID: serviceAccountEmail,
+		SignBytes:      sign,
+	}
+}
+
+// GenerateDownloadURL creates a presigned URL for downloading a private object
+func (s *StorageService) GenerateDownloadURL(ctx context.Context, objectName string, expiration time.Duration) (string, error) {
+	opts := &storage.SignedURLOptions{
+		Scheme:         storage.SigningSchemeV4,
+		Method:         "GET",
+		Expires:        time.Now().Add(expiration),
+		GoogleAccessID: signingServiceAccount,
 		SignBytes: func(b []byte) ([]byte, error) {
-			// Use the IAM service to sign the bytes
-			return signBytes(ctx, serviceAccountEmail, b)
+			return signBytes(ctx, signingServiceAccount, b)
 		},
 	}
 
 	url, err := s.client.Bucket(s.bucketName).SignedURL(objectName, opts)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate presigned URL: %w", err)
+		return "", fmt.Errorf("failed to generate download URL: %w", err)
 	}
 
 	return url, nil
@@ -80,9 +235,35 @@ func (s *StorageService) GeneratePresignedURL(ctx context.Context, objectName st
 
 // GetPublicURL returns the public URL for a storage object
 func (s *StorageService) GetPublicURL(objectName string) string {
+	if s.publicBaseURL != "" {
+		return s.publicBaseURL + "/" + objectName
+	}
+	if s.cdnDomain != "" {
+		return fmt.Sprintf("https://%s/%s", s.cdnDomain, objectName)
+	}
 	return fmt.Sprintf("https://storage.googleapis.com/%s/%s", s.bucketName, objectName)
 }
 
+// ResolvePublicURL rewrites a stored public URL for one of this bucket's
+// objects to its current public URL. URLs stored before a CDN domain or public
+// base was configured resolve to the new host; other URLs are returned unchanged.
+func (s *StorageService) ResolvePublicURL(storedURL string) string {
+	prefixes := []string{fmt.Sprintf("https://storage.googleapis.com/%s/", s.bucketName)}
+	if s.cdnDomain != "" {
+		prefixes = append(prefixes, fmt.Sprintf("https://%s/", s.cdnDomain))
+	}
+	if s.publicBaseURL != "" {
+		prefixes = append(prefixes, s.publicBaseURL+"/")
+	}
+
+	for _, prefix := range prefixes {
+		if objectName, ok := strings.CutPrefix(storedURL, prefix); ok && objectName != "" {
+			return s.GetPublicURL(objectName)
+		}
+	}
+	return storedURL
+}
+
 // CopyObject copies an object within the same bucket
 func (s *StorageService) CopyObject(ctx context.Context, srcObject, dstObject string) error {
 	src := s.client.Bucket(s.bucketName).Object(srcObject)
@@ -105,13 +286,69 @@ func (s *StorageService) DeleteObject(ctx context.Context, objectName string) er
 	return nil
 }
 
+// DeleteObjects deletes objects concurrently and returns the ones that couldn't
+// be deleted with their errors. Objects that don't exist count as deleted.
+func (s *StorageService) DeleteObjects(ctx context.Context, objectNames []string) map[string]error {
+	var mu sync.Mutex
+	failed := map[string]error{}
+
+	sem := make(chan struct{}, deleteObjectsConcurrency)
+	var wg sync.WaitGroup
+	for _, objectName := range objectNames {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(objectName string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			err := s.client.Bucket(s.bucketName).Object(objectName).Delete(ctx)
+			if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+				mu.Lock()
+				failed[objectName] = err
+				mu.Unlock()
+			}
+		}(objectName)
+	}
+	wg.Wait()
+
+	if len(failed) == 0 {
+		return nil
+	}
+	return failed
+}
+
+// ListObjects returns the names of the objects starting with prefix, in
+// lexical order
+func (s *StorageService) ListObjects(ctx context.Context, prefix string) ([]string, error) {
+	it := s.client.Bucket(s.bucketName).Objects(ctx, &storage.Query{Prefix: prefix})
+	it.PageInfo().MaxSize = 1000
+
+	var names []string
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return names, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects with prefix %q: %w", prefix, err)
+		}
+		names = append(names, attrs.Name)
+	}
+}
+
 // UploadObject uploads data to storage
 func (s *StorageService) UploadObject(ctx context.Context, objectName string, data io.Reader, contentType string) error {
+	// Cancelling the writer's context abandons the upload, so a failed read
+	// of data, such as a stream cut short, doesn't leave a partial object
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	obj := s.client.Bucket(s.bucketName).Object(objectName)
 	writer := obj.NewWriter(ctx)
 	writer.ContentType = contentType
 
 	if _, err := io.Copy(writer, data); err != nil {
+		cancel()
 		_ = writer.Close() // #nosec G104 -- Error in cleanup, primary error is more important
 		return fmt.Errorf("failed to upload object: %w", err)
 	}
@@ -123,6 +360,15 @@ func (s *StorageService) UploadObject(ctx context.Context, objectName string, da
 	return nil
 }
 
+// CheckBucket confirms the bucket is reachable with a metadata read, for
+// readiness checks
+func (s *StorageService) CheckBucket(ctx context.Context) error {
+	if _, err := s.client.Bucket(s.bucketName).Attrs(ctx); err != nil {
+		return fmt.Errorf("failed to read bucket %s: %w", s.bucketName, err)
+	}
+	return nil
+}
+
 // GetObjectMetadata returns metadata for an object
 func (s *StorageService) GetObjectMetadata(ctx context.Context, objectName string) (interface{}, error) {
 	obj := s.client.Bucket(s.bucketName).Object(objectName)
@@ -133,6 +379,42 @@ func (s *StorageService) GetObjectMetadata(ctx context.Context, objectName strin
 	return attrs, nil
 }
 
+// GetObjectChecksums returns the CRC32C and MD5 GCS recorded for an object
+func (s *StorageService) GetObjectChecksums(ctx context.Context, objectName string) (*ObjectChecksums, error) {
+	attrs, err := s.client.Bucket(s.bucketName).Object(objectName).Attrs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object checksums: %w", err)
+	}
+	return &ObjectChecksums{CRC32C: attrs.CRC32C, HasCRC32C: true, MD5: attrs.MD5}, nil
+}
+
+// SetStorageClass rewrites an object into a storage class, such as NEARLINE,
+// COLDLINE or ARCHIVE. The rewrite happens within GCS.
+func (s *StorageService) SetStorageClass(ctx context.Context, objectName, storageClass string) error {
+	obj := s.client.Bucket(s.bucketName).Object(objectName)
+	copier := obj.CopierFrom(obj)
+	copier.StorageClass = storageClass
+	if _, err := copier.Run(ctx); err != nil {
+		return fmt.Errorf("failed to set storage class: %w", err)
+	}
+	return nil
+}
+
+// RestoreObject reports true: every GCS storage class stays readable, at a
+// retrieval fee for the colder ones
+func (s *StorageService) RestoreObject(ctx context.Context, objectName string) (bool, error) {
+	return true, nil
+}
+
+// GetObjectSize returns an object's length in bytes
+func (s *StorageService) GetObjectSize(ctx context.Context, objectName string) (int64, error) {
+	attrs, err := s.client.Bucket(s.bucketName).Object(objectName).Attrs(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get object size: %w", err)
+	}
+	return attrs.Size, nil
+}
+
 // GetObjectReader returns a reader for an object
 func (s *StorageService) GetObjectReader(ctx context.Context, objectName string) (io.ReadCloser, error) {
 	obj := s.client.Bucket(s.bucketName).Object(objectName)
@@ -143,6 +425,17 @@ func (s *StorageService) GetObjectReader(ctx context.Context, objectName string)
 	return reader, nil
 }
 
+// GetObjectRangeReader returns a reader for length bytes of an object from
+// offset; a negative length reads to the end
+func (s *StorageService) GetObjectRangeReader(ctx context.Context, objectName string, offset, length int64) (io.ReadCloser, error) {
+	obj := s.client.Bucket(s.bucketName).Object(objectName)
+	reader, err := obj.NewRangeReader(ctx, offset, length)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create object range reader: %w", err)
+	}
+	return reader, nil
+}
+
 // signBytes uses the Service Account Credentials API to sign bytes with the service account
 func signBytes(ctx context.Context, serviceAccountEmail string, bytesToSign []byte) ([]byte, error) {
 	// Create IAM Credentials service client
@@ -0,0 +1,397 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+)
+
+// StorageProviderAzure is the STORAGE_PROVIDER value for Azure Blob Storage
+const StorageProviderAzure = "azure"
+
+// azureCopyPollInterval is how often CopyObject checks on a pending copy
+const azureCopyPollInterval = 500 * time.Millisecond
+
+// AzureStorageService stores objects as block blobs in an Azure Storage
+// container. Upload and download URLs are SAS tokens signed with the account
+// key.
+type AzureStorageService struct {
+	client        *container.Client
+	credential    *container.SharedKeyCredential
+	containerName string
+	cdnDomain     string // Optional domain serving the container, used for public URLs
+
+	// Optional base URL serving the container (PUBLIC_MEDIA_BASE_URL); takes
+	// precedence over cdnDomain
+	publicBaseURL string
+}
+
+// newAzureStorageFromEnv creates an Azure backend from AZURE_STORAGE_ACCOUNT,
+// AZURE_STORAGE_KEY and AZURE_STORAGE_CONTAINER. AZURE_STORAGE_ENDPOINT
+// overrides the account's blob endpoint, for Azurite or sovereign clouds.
+func newAzureStorageFromEnv() (*AzureStorageService, error) {
+	accountName := os.Getenv("AZURE_STORAGE_ACCOUNT")
+	accountKey := os.Getenv("AZURE_STORAGE_KEY")
+	containerName := os.Getenv("AZURE_STORAGE_CONTAINER")
+	if accountName == "" || accountKey == "" || containerName == "" {
+		return nil, errors.New("azure storage needs AZURE_STORAGE_ACCOUNT, AZURE_STORAGE_KEY and AZURE_STORAGE_CONTAINER")
+	}
+	return NewAzureStorageService(accountName, accountKey, containerName, os.Getenv("AZURE_STORAGE_ENDPOINT"))
+}
+
+// NewAzureStorageService creates a service for a container in a storage
+// account. An empty endpoint uses https://<account>.blob.core.windows.net.
+// No request is made until the service is used.
+func NewAzureStorageService(accountName, accountKey, containerName, endpoint string) (*AzureStorageService, error) {
+	credential, err := container.NewSharedKeyCredential(accountName, accountKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid azure storage credentials: %w", err)
+	}
+
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", accountName)
+	}
+	containerURL, err := url.JoinPath(endpoint, containerName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid azure storage endpoint: %w", err)
+	}
+
+	client, err := container.NewClientWithSharedKeyCredential(containerURL, credential, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create azure storage client: %w", err)
+	}
+
+	return &AzureStorageService{
+		client:        client,
+		credential:    credential,
+		containerName: containerName,
+	}, nil
+}
+
+func (s *AzureStorageService) GetBucketName() string {
+	return s.containerName
+}
+
+// Close is a no-op; the client holds no connections of its own
+func (s *AzureStorageService) Close() error {
+	return nil
+}
+
+// GeneratePresignedURL creates a SAS URL for uploading a blob. SAS tokens
+// can't require request headers or a size limit, so the constraints are
+// only returned as headers for the client to send; processing still rejects
+// originals past its download limit.
+func (s *AzureStorageService) GeneratePresignedURL(ctx context.Context, objectName string, expiration time.Duration, constraints UploadConstraints) (string, error) {
+	permissions := sas.BlobPermissions{Create: true, Write: true}
+	signedURL, err := s.signedURL(objectName, permissions, expiration)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate presigned URL: %w", err)
+	}
+	return signedURL, nil
+}
+
+// UploadHeaders returns the headers an upload must send with a URL from
+// GeneratePresignedURL. Put Blob requires the blob type.
+func (s *AzureStorageService) UploadHeaders(constraints UploadConstraints) map[string]string {
+	headers := map[string]string{"x-ms-blob-type": string(blob.BlobTypeBlockBlob)}
+	if constraints.ContentType != "" {
+		headers["Content-Type"] = constraints.ContentType
+	}
+	return headers
+}
+
+// GenerateDownloadURL creates a SAS URL for downloading a private blob
+func (s *AzureStorageService) GenerateDownloadURL(ctx context.Context, objectName string, expiration time.Duration) (string, error) {
+	signedURL, err := s.signedURL(objectName, sas.BlobPermissions{Read: true}, expiration)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate download URL: %w", err)
+	}
+	return signedURL, nil
+}
+
+// signedURL returns the blob's URL with a SAS token granting permissions
+// until expiration from now
+func (s *AzureStorageService) signedURL(objectName string, permissions sas.BlobPermissions, expiration time.Duration) (string, error) {
+	blobURL := s.blobURL(objectName)
+
+	values := sas.BlobSignatureValues{
+		ExpiryTime:    time.Now().UTC().Add(expiration),
+		Permissions:   permissions.String(),
+		ContainerName: s.containerName,
+		BlobName:      objectName,
+	}
+	// Azurite and other local endpoints serve plain HTTP
+	if strings.HasPrefix(blobURL, "https://") {
+		values.Protocol = sas.ProtocolHTTPS
+	}
+
+	params, err := values.SignWithSharedKey(s.credential)
+	if err != nil {
+		return "", err
+	}
+	return blobURL + "?" + params.Encode(), nil
+}
+
+// GetPublicURL returns the public URL for a blob
+func (s *AzureStorageService) GetPublicURL(objectName string) string {
+	if s.publicBaseURL != "" {
+		return s.publicBaseURL + "/" + objectName
+	}
+	if s.cdnDomain != "" {
+		return fmt.Sprintf("https://%s/%s", s.cdnDomain, objectName)
+	}
+	return s.blobURL(objectName)
+}
+
+// blobURL returns a blob's URL on the storage endpoint. The SDK's blob URLs
+// escape the slashes in object names; Azure serves both forms.
+func (s *AzureStorageService) blobURL(objectName string) string {
+	return s.client.URL() + "/" + objectName
+}
+
+// ResolvePublicURL rewrites a stored public URL of this container to the
+// current public base
+func (s *AzureStorageService) ResolvePublicURL(storedURL string) string {
+	prefixes := []string{s.client.URL() + "/"}
+	if s.cdnDomain != "" {
+		prefixes = append(prefixes, fmt.Sprintf("https://%s/", s.cdnDomain))
+	}
+	if s.publicBaseURL != "" {
+		prefixes = append(prefixes, s.publicBaseURL+"/")
+	}
+
+	for _, prefix := range prefixes {
+		if objectName, ok := strings.CutPrefix(storedURL, prefix); ok && objectName != "" {
+			return s.GetPublicURL(objectName)
+		}
+	}
+	return storedURL
+}
+
+// UploadObject uploads data to a block blob. Blocks are only committed once
+// data is fully read, so a failed read leaves no partial blob.
+func (s *AzureStorageService) UploadObject(ctx context.Context, objectName string, data io.Reader, contentType string) error {
+	_, err := s.client.NewBlockBlobClient(objectName).UploadStream(ctx, data, &blockblob.UploadStreamOptions{
+		HTTPHeaders: &blob.HTTPHeaders{BlobContentType: to.Ptr(contentType)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload object: %w", azureStorageError(err))
+	}
+	return nil
+}
+
+// CopyObject copies a blob within the container, waiting for the copy to
+// finish
+func (s *AzureStorageService) CopyObject(ctx context.Context, srcObject, dstObject string) error {
+	dst := s.client.NewBlobClient(dstObject)
+	resp, err := dst.StartCopyFromURL(ctx, s.client.NewBlobClient(srcObject).URL(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to copy object: %w", azureStorageError(err))
+	}
+
+	status := resp.CopyStatus
+	for status != nil && *status == blob.CopyStatusTypePending {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to copy object: %w", ctx.Err())
+		case <-time.After(azureCopyPollInterval):
+		}
+		props, err := dst.GetProperties(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to copy object: %w", azureStorageError(err))
+		}
+		status = props.CopyStatus
+	}
+	if status != nil && *status != blob.CopyStatusTypeSuccess {
+		return fmt.Errorf("failed to copy object: copy %s", *status)
+	}
+	return nil
+}
+
+// DeleteObject deletes a blob
+func (s *AzureStorageService) DeleteObject(ctx context.Context, objectName string) error {
+	if _, err := s.client.NewBlobClient(objectName).Delete(ctx, nil); err != nil {
+		return fmt.Errorf("failed to delete object: %w", azureStorageError(err))
+	}
+	return nil
+}
+
+// DeleteObjects deletes blobs concurrently and returns the ones that couldn't
+// be deleted with their errors. Blobs that don't exist count as deleted.
+func (s *AzureStorageService) DeleteObjects(ctx context.Context, objectNames []string) map[string]error {
+	var mu sync.Mutex
+	failed := map[string]error{}
+
+	sem := make(chan struct{}, deleteObjectsConcurrency)
+	var wg sync.WaitGroup
+	for _, objectName := range objectNames {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(objectName string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			err := s.DeleteObject(ctx, objectName)
+			if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+				mu.Lock()
+				failed[objectName] = err
+				mu.Unlock()
+			}
+		}(objectName)
+	}
+	wg.Wait()
+
+	if len(failed) == 0 {
+		return nil
+	}
+	return failed
+}
+
+// ListObjects returns the names of the blobs starting with prefix, in
+// lexical order
+func (s *AzureStorageService) ListObjects(ctx context.Context, prefix string) ([]string, error) {
+	pager := s.client.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{
+		Prefix:     to.Ptr(prefix),
+		MaxResults: to.Ptr(int32(1000)),
+	})
+
+	var names []string
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects with prefix %q: %w", prefix, azureStorageError(err))
+		}
+		for _, item := range page.Segment.BlobItems {
+			if item.Name != nil {
+				names = append(names, *item.Name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// CheckBucket confirms the container is reachable with a metadata read, for
+// readiness checks
+func (s *AzureStorageService) CheckBucket(ctx context.Context) error {
+	if _, err := s.client.GetProperties(ctx, nil); err != nil {
+		return fmt.Errorf("failed to read container %s: %w", s.containerName, err)
+	}
+	return nil
+}
+
+// GetObjectMetadata returns a blob's properties as a blob.GetPropertiesResponse
+func (s *AzureStorageService) GetObjectMetadata(ctx context.Context, objectName string) (interface{}, error) {
+	props, err := s.client.NewBlobClient(objectName).GetProperties(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object metadata: %w", azureStorageError(err))
+	}
+	return props, nil
+}
+
+// GetObjectChecksums returns the MD5 Azure recorded for a blob. Azure keeps
+// no CRC32C, and blobs uploaded in blocks have no MD5 unless the uploader set
+// one, in which case nil is returned.
+func (s *AzureStorageService) GetObjectChecksums(ctx context.Context, objectName string) (*ObjectChecksums, error) {
+	props, err := s.client.NewBlobClient(objectName).GetProperties(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object checksums: %w", azureStorageError(err))
+	}
+	if len(props.ContentMD5) == 0 {
+		return nil, nil
+	}
+	return &ObjectChecksums{MD5: props.ContentMD5}, nil
+}
+
+// SetStorageClass moves a blob to an access tier: Hot, Cool, Cold or Archive
+func (s *AzureStorageService) SetStorageClass(ctx context.Context, objectName, storageClass string) error {
+	if _, err := s.client.NewBlobClient(objectName).SetTier(ctx, blob.AccessTier(storageClass), nil); err != nil {
+		return fmt.Errorf("failed to set storage class: %w", azureStorageError(err))
+	}
+	return nil
+}
+
+// RestoreObject reports whether a blob can be read. An archived blob can't
+// until it's rehydrated to the Hot tier, which this starts and which takes
+// hours.
+func (s *AzureStorageService) RestoreObject(ctx context.Context, objectName string) (bool, error) {
+	client := s.client.NewBlobClient(objectName)
+	props, err := client.GetProperties(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to restore object: %w", azureStorageError(err))
+	}
+	if props.AccessTier == nil || blob.AccessTier(*props.AccessTier) != blob.AccessTierArchive {
+		return true, nil
+	}
+	// Already rehydrating
+	if props.ArchiveStatus != nil {
+		return false, nil
+	}
+
+	_, err = client.SetTier(ctx, blob.AccessTierHot, &blob.SetTierOptions{RehydratePriority: to.Ptr(blob.RehydratePriorityStandard)})
+	if err != nil {
+		return false, fmt.Errorf("failed to restore object: %w", azureStorageError(err))
+	}
+	return false, nil
+}
+
+// GetObjectSize returns a blob's length in bytes
+func (s *AzureStorageService) GetObjectSize(ctx context.Context, objectName string) (int64, error) {
+	props, err := s.client.NewBlobClient(objectName).GetProperties(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get object size: %w", azureStorageError(err))
+	}
+	if props.ContentLength == nil {
+		return 0, nil
+	}
+	return *props.ContentLength, nil
+}
+
+// GetObjectReader returns a reader for a blob
+func (s *AzureStorageService) GetObjectReader(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	resp, err := s.client.NewBlobClient(objectName).DownloadStream(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create object reader: %w", azureStorageError(err))
+	}
+	return resp.Body, nil
+}
+
+// GetObjectRangeReader returns a reader for length bytes of a blob from
+// offset; a negative length reads to the end
+func (s *AzureStorageService) GetObjectRangeReader(ctx context.Context, objectName string, offset, length int64) (io.ReadCloser, error) {
+	if length == 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	// A zero Count reads to the end
+	count := max(length, 0)
+
+	resp, err := s.client.NewBlobClient(objectName).DownloadStream(ctx, &blob.DownloadStreamOptions{
+		Range: blob.HTTPRange{Offset: offset, Count: count},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create object range reader: %w", azureStorageError(err))
+	}
+	return resp.Body, nil
+}
+
+// azureStorageError wraps missing blob errors in storage.ErrObjectNotExist,
+// so callers check for missing objects the same way for every backend
+func azureStorageError(err error) error {
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return fmt.Errorf("%w: %w", storage.ErrObjectNotExist, err)
+	}
+	return err
+}
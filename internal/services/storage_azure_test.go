@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testAzureKey is a well-formed account key; nothing here reaches Azure
+var testAzureKey = base64.StdEncoding.EncodeToString([]byte("wavlake-test-account-key"))
+
+func newTestAzureStorage(t *testing.T, endpoint string) *AzureStorageService {
+	service, err := NewAzureStorageService("wavlake", testAzureKey, "tracks", endpoint)
+	require.NoError(t, err)
+	return service
+}
+
+func TestAzurePublicURL(t *testing.T) {
+	service := newTestAzureStorage(t, "")
+	stored := "https://wavlake.blob.core.windows.net/tracks/tracks/original/abc.wav"
+	assert.Equal(t, stored, service.GetPublicURL("tracks/original/abc.wav"))
+	assert.Equal(t, "tracks", service.GetBucketName())
+
+	service.cdnDomain = "cdn.wavlake.com"
+	assert.Equal(t, "https://cdn.wavlake.com/tracks/original/abc.wav", service.GetPublicURL("tracks/original/abc.wav"))
+	assert.Equal(t, "https://cdn.wavlake.com/tracks/original/abc.wav", service.ResolvePublicURL(stored))
+
+	service.publicBaseURL = "https://media.wavlake.com"
+	assert.Equal(t, "https://media.wavlake.com/tracks/original/abc.wav", service.ResolvePublicURL(stored))
+	assert.Equal(t, "https://media.wavlake.com/tracks/original/abc.wav", service.ResolvePublicURL("https://cdn.wavlake.com/tracks/original/abc.wav"))
+	assert.Equal(t, "https://elsewhere.example/abc.wav", service.ResolvePublicURL("https://elsewhere.example/abc.wav"))
+}
+
+func TestAzurePresignedURLs(t *testing.T) {
+	service := newTestAzureStorage(t, "")
+	constraints := UploadConstraints{ContentType: "audio/wav", MaxBytes: 500 << 20}
+
+	for _, tc := range []struct {
+		name        string
+		sign        func() (string, error)
+		permissions string
+	}{
+		{"upload", func() (string, error) {
+			return service.GeneratePresignedURL(context.Background(), "tracks/original/abc.wav", time.Hour, constraints)
+		}, "cw"},
+		{"download", func() (string, error) {
+			return service.GenerateDownloadURL(context.Background(), "tracks/original/abc.wav", time.Hour)
+		}, "r"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			signedURL, err := tc.sign()
+			require.NoError(t, err)
+
+			parsed, err := url.Parse(signedURL)
+			require.NoError(t, err)
+			assert.Equal(t, "wavlake.blob.core.windows.net", parsed.Host)
+			assert.Equal(t, "/tracks/tracks/original/abc.wav", parsed.Path)
+
+			query := parsed.Query()
+			assert.Equal(t, tc.permissions, query.Get("sp"))
+			assert.Equal(t, "b", query.Get("sr"))
+			assert.Equal(t, "https", query.Get("spr"))
+			assert.NotEmpty(t, query.Get("sig"))
+
+			expiry, err := time.Parse(time.RFC3339, query.Get("se"))
+			require.NoError(t, err)
+			assert.WithinDuration(t, time.Now().Add(time.Hour), expiry, time.Minute)
+		})
+	}
+
+	// SAS can't enforce the constraints, so only the headers Put Blob needs
+	// are returned
+	assert.Equal(t, map[string]string{
+		"x-ms-blob-type": "BlockBlob",
+		"Content-Type":   "audio/wav",
+	}, service.UploadHeaders(constraints))
+}
+
+func TestAzureLocalEndpoint(t *testing.T) {
+	service := newTestAzureStorage(t, "http://127.0.0.1:10000/wavlake")
+
+	signedURL, err := service.GeneratePresignedURL(context.Background(), "tracks/original/abc.wav", time.Minute, UploadConstraints{})
+	require.NoError(t, err)
+	parsed, err := url.Parse(signedURL)
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:10000", parsed.Host)
+	assert.Equal(t, "/wavlake/tracks/tracks/original/abc.wav", parsed.Path)
+	assert.Empty(t, parsed.Query().Get("spr"))
+}
+
+func TestNewAzureStorageServiceRejectsBadKey(t *testing.T) {
+	_, err := NewAzureStorageService("wavlake", "not base64!", "tracks", "")
+	assert.Error(t, err)
+}
+
+func TestNewStorageFromEnv_Azure(t *testing.T) {
+	t.Setenv("STORAGE_PROVIDER", "azure")
+	t.Setenv("AZURE_STORAGE_ACCOUNT", "wavlake")
+	t.Setenv("AZURE_STORAGE_KEY", testAzureKey)
+	t.Setenv("AZURE_STORAGE_CONTAINER", "tracks")
+
+	service, err := NewStorageFromEnv(context.Background())
+	require.NoError(t, err)
+	assert.IsType(t, &RetryingStorage{}, service)
+	assert.IsType(t, &AzureStorageService{}, UnwrapStorage(service))
+	assert.Equal(t, "tracks", service.GetBucketName())
+
+	t.Setenv("AZURE_STORAGE_CONTAINER", "")
+	_, err = NewStorageFromEnv(context.Background())
+	assert.ErrorContains(t, err, "AZURE_STORAGE_CONTAINER")
+}
@@ -0,0 +1,412 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// StorageProviderLocal is the STORAGE_PROVIDER value for the local
+// filesystem backend, for development without a bucket
+const StorageProviderLocal = "local"
+
+// LocalFilesRoute is where the API serves a local backend's objects; the
+// object name follows it
+const LocalFilesRoute = "/v1/dev/files/"
+
+// Errors returned when checking a local upload or download URL
+var (
+	ErrLocalURLInvalid = errors.New("invalid or missing signature")
+	ErrLocalURLExpired = errors.New("signed URL has expired")
+)
+
+// LocalStorageService stores objects as files under a directory, for running
+// the API offline. Objects are served from LocalFilesRoute, and upload and
+// download URLs carry an HMAC of the request they allow.
+type LocalStorageService struct {
+	root    string
+	baseURL string // Origin of the API serving LocalFilesRoute
+	secret  []byte
+}
+
+// newLocalStorageFromEnv creates a local backend storing objects under
+// LOCAL_STORAGE_DIR (default ./data/storage), served from
+// LOCAL_STORAGE_BASE_URL (default http://localhost:$PORT). URLs are signed
+// with LOCAL_STORAGE_SECRET, or a random secret that changes on restart.
+func newLocalStorageFromEnv() (*LocalStorageService, error) {
+	root := os.Getenv("LOCAL_STORAGE_DIR")
+	if root == "" {
+		root = filepath.Join("data", "storage")
+	}
+
+	baseURL := os.Getenv("LOCAL_STORAGE_BASE_URL")
+	if baseURL == "" {
+		port := os.Getenv("PORT")
+		if port == "" {
+			port = "8080"
+		}
+		baseURL = "http://localhost:" + port
+	}
+
+	secret := []byte(os.Getenv("LOCAL_STORAGE_SECRET"))
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate local storage secret: %w", err)
+		}
+		log.Println("Warning: LOCAL_STORAGE_SECRET not set; signed URLs stop working on restart")
+	}
+
+	return NewLocalStorageService(root, baseURL, secret)
+}
+
+// NewLocalStorageService creates a service storing objects under root, which
+// is created if missing. baseURL is the origin serving LocalFilesRoute.
+func NewLocalStorageService(root, baseURL string, secret []byte) (*LocalStorageService, error) {
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create local storage directory: %w", err)
+	}
+	return &LocalStorageService{
+		root:    root,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		secret:  secret,
+	}, nil
+}
+
+func (s *LocalStorageService) GetBucketName() string {
+	return s.root
+}
+
+// Close is a no-op; files are closed after each operation
+func (s *LocalStorageService) Close() error {
+	return nil
+}
+
+// GeneratePresignedURL creates a URL for uploading an object with PUT. The
+// content type and size limit are signed into it.
+func (s *LocalStorageService) GeneratePresignedURL(ctx context.Context, objectName string, expiration time.Duration, constraints UploadConstraints) (string, error) {
+	if _, err := s.objectPath(objectName); err != nil {
+		return "", fmt.Errorf("failed to generate presigned URL: %w", err)
+	}
+	return s.signedURL("PUT", objectName, expiration, constraints), nil
+}
+
+// UploadHeaders returns the headers an upload must send with a URL from
+// GeneratePresignedURL
+func (s *LocalStorageService) UploadHeaders(constraints UploadConstraints) map[string]string {
+	headers := map[string]string{}
+	if constraints.ContentType != "" {
+		headers["Content-Type"] = constraints.ContentType
+	}
+	return headers
+}
+
+// GenerateDownloadURL creates a URL for downloading an object until
+// expiration
+func (s *LocalStorageService) GenerateDownloadURL(ctx context.Context, objectName string, expiration time.Duration) (string, error) {
+	if _, err := s.objectPath(objectName); err != nil {
+		return "", fmt.Errorf("failed to generate download URL: %w", err)
+	}
+	return s.signedURL("GET", objectName, expiration, UploadConstraints{}), nil
+}
+
+// signedURL returns the object's URL with the query VerifySignedURL checks
+func (s *LocalStorageService) signedURL(method, objectName string, expiration time.Duration, constraints UploadConstraints) string {
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(time.Now().Add(expiration).Unix(), 10))
+	if constraints.ContentType != "" {
+		query.Set("content_type", constraints.ContentType)
+	}
+	if constraints.MaxBytes > 0 {
+		query.Set("max_bytes", strconv.FormatInt(constraints.MaxBytes, 10))
+	}
+	query.Set("signature", s.sign(method, objectName, query))
+	return s.GetPublicURL(objectName) + "?" + query.Encode()
+}
+
+// sign returns the HMAC of a request's method, object and signed query values
+func (s *LocalStorageService) sign(method, objectName string, query url.Values) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(strings.Join([]string{method, objectName, query.Get("expires"), query.Get("content_type"), query.Get("max_bytes")}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignedURL checks the query of a request to an object's URL and
+// returns the size limit signed into it, 0 for none. contentType is the
+// request's Content-Type, which must match a signed content_type.
+func (s *LocalStorageService) VerifySignedURL(method, objectName string, query url.Values, contentType string) (int64, error) {
+	if !hmac.Equal([]byte(s.sign(method, objectName, query)), []byte(query.Get("signature"))) {
+		return 0, ErrLocalURLInvalid
+	}
+
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return 0, ErrLocalURLInvalid
+	}
+	if time.Now().Unix() > expires {
+		return 0, ErrLocalURLExpired
+	}
+
+	if signed := query.Get("content_type"); signed != "" && signed != contentType {
+		return 0, fmt.Errorf("%w: Content-Type must be %s", ErrLocalURLInvalid, signed)
+	}
+
+	if query.Get("max_bytes") == "" {
+		return 0, nil
+	}
+	maxBytes, err := strconv.ParseInt(query.Get("max_bytes"), 10, 64)
+	if err != nil {
+		return 0, ErrLocalURLInvalid
+	}
+	return maxBytes, nil
+}
+
+// GetPublicURL returns the URL serving an object
+func (s *LocalStorageService) GetPublicURL(objectName string) string {
+	return s.baseURL + LocalFilesRoute + objectName
+}
+
+// ResolvePublicURL returns stored URLs unchanged; they already point at the
+// local route
+func (s *LocalStorageService) ResolvePublicURL(storedURL string) string {
+	return storedURL
+}
+
+// UploadObject writes data to an object. It's written to a temporary file
+// first, so a failed read of data leaves no partial object.
+func (s *LocalStorageService) UploadObject(ctx context.Context, objectName string, data io.Reader, contentType string) error {
+	path, err := s.objectPath(objectName)
+	if err != nil {
+		return fmt.Errorf("failed to upload object: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("failed to upload object: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to upload object: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // #nosec G104 -- Gone after the rename
+
+	if _, err := io.Copy(tmp, data); err != nil {
+		_ = tmp.Close() // #nosec G104 -- Error in cleanup, primary error is more important
+		return fmt.Errorf("failed to upload object: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close writer: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to upload object: %w", err)
+	}
+	return nil
+}
+
+// CopyObject copies an object
+func (s *LocalStorageService) CopyObject(ctx context.Context, srcObject, dstObject string) error {
+	reader, err := s.GetObjectReader(ctx, srcObject)
+	if err != nil {
+		return fmt.Errorf("failed to copy object: %w", err)
+	}
+	defer reader.Close()
+
+	if err := s.UploadObject(ctx, dstObject, reader, ""); err != nil {
+		return fmt.Errorf("failed to copy object: %w", err)
+	}
+	return nil
+}
+
+// DeleteObject deletes an object
+func (s *LocalStorageService) DeleteObject(ctx context.Context, objectName string) error {
+	path, err := s.objectPath(objectName)
+	if err == nil {
+		err = os.Remove(path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete object: %w", localStorageError(err))
+	}
+	return nil
+}
+
+// DeleteObjects deletes objects and returns the ones that couldn't be deleted
+// with their errors. Objects that don't exist count as deleted.
+func (s *LocalStorageService) DeleteObjects(ctx context.Context, objectNames []string) map[string]error {
+	failed := map[string]error{}
+	for _, objectName := range objectNames {
+		if err := s.DeleteObject(ctx, objectName); err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+			failed[objectName] = err
+		}
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+	return failed
+}
+
+// ListObjects returns the names of the objects starting with prefix, in
+// lexical order
+func (s *LocalStorageService) ListObjects(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(s.root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Skip uploads still being written
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, path)
+		if err != nil {
+			return err
+		}
+		if name := filepath.ToSlash(rel); strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects with prefix %q: %w", prefix, err)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// CheckBucket confirms the storage directory exists, for readiness checks
+func (s *LocalStorageService) CheckBucket(ctx context.Context) error {
+	info, err := os.Stat(s.root)
+	if err == nil && !info.IsDir() {
+		err = fmt.Errorf("%s is not a directory", s.root)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read storage directory %s: %w", s.root, err)
+	}
+	return nil
+}
+
+// GetObjectMetadata returns an object's fs.FileInfo
+func (s *LocalStorageService) GetObjectMetadata(ctx context.Context, objectName string) (interface{}, error) {
+	info, err := s.stat(objectName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object metadata: %w", err)
+	}
+	return info, nil
+}
+
+// GetObjectChecksums returns nil; files have no recorded checksums
+func (s *LocalStorageService) GetObjectChecksums(ctx context.Context, objectName string) (*ObjectChecksums, error) {
+	if _, err := s.stat(objectName); err != nil {
+		return nil, fmt.Errorf("failed to get object checksums: %w", err)
+	}
+	return nil, nil
+}
+
+// SetStorageClass only checks the object exists; files have one class
+func (s *LocalStorageService) SetStorageClass(ctx context.Context, objectName, storageClass string) error {
+	if _, err := s.stat(objectName); err != nil {
+		return fmt.Errorf("failed to set storage class: %w", err)
+	}
+	return nil
+}
+
+// RestoreObject reports true; files are always readable
+func (s *LocalStorageService) RestoreObject(ctx context.Context, objectName string) (bool, error) {
+	return true, nil
+}
+
+// GetObjectSize returns an object's length in bytes
+func (s *LocalStorageService) GetObjectSize(ctx context.Context, objectName string) (int64, error) {
+	info, err := s.stat(objectName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get object size: %w", err)
+	}
+	return info.Size(), nil
+}
+
+// GetObjectReader returns a reader for an object
+func (s *LocalStorageService) GetObjectReader(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	file, err := s.OpenObject(objectName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create object reader: %w", err)
+	}
+	return file, nil
+}
+
+// GetObjectRangeReader returns a reader for length bytes of an object from
+// offset; a negative length reads to the end
+func (s *LocalStorageService) GetObjectRangeReader(ctx context.Context, objectName string, offset, length int64) (io.ReadCloser, error) {
+	file, err := s.OpenObject(objectName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create object range reader: %w", err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		_ = file.Close() // #nosec G104 -- Error in cleanup, primary error is more important
+		return nil, fmt.Errorf("failed to create object range reader: %w", err)
+	}
+	if length < 0 {
+		return file, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(file, length), file}, nil
+}
+
+// OpenObject opens the file storing an object, for serving it
+func (s *LocalStorageService) OpenObject(objectName string) (*os.File, error) {
+	path, err := s.objectPath(objectName)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path) // #nosec G304 -- objectPath keeps the path under root
+	if err != nil {
+		return nil, localStorageError(err)
+	}
+	return file, nil
+}
+
+func (s *LocalStorageService) stat(objectName string) (fs.FileInfo, error) {
+	path, err := s.objectPath(objectName)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, localStorageError(err)
+	}
+	return info, nil
+}
+
+// objectPath returns the file storing an object. Names that could reach
+// outside root, such as ones with ".." elements, are rejected.
+func (s *LocalStorageService) objectPath(objectName string) (string, error) {
+	if !fs.ValidPath(objectName) || objectName == "." || strings.Contains(objectName, `\`) {
+		return "", fmt.Errorf("invalid object name %q", objectName)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(objectName)), nil
+}
+
+// localStorageError wraps missing file errors in storage.ErrObjectNotExist,
+// so callers check for missing objects the same way for every backend
+func localStorageError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %w", storage.ErrObjectNotExist, err)
+	}
+	return err
+}
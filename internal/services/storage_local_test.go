@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLocalStorage(t *testing.T) *LocalStorageService {
+	service, err := NewLocalStorageService(t.TempDir(), "http://localhost:8080/", []byte("secret"))
+	require.NoError(t, err)
+	return service
+}
+
+func readObject(t *testing.T, reader io.ReadCloser) string {
+	t.Helper()
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestLocalStorageUploadReadAndDelete(t *testing.T) {
+	ctx := context.Background()
+	s := newTestLocalStorage(t)
+
+	require.NoError(t, s.UploadObject(ctx, "tracks/original/abc.wav", strings.NewReader("RIFF audio"), "audio/wav"))
+	require.NoError(t, s.CopyObject(ctx, "tracks/original/abc.wav", "tracks/compressed/abc_v1.mp3"))
+
+	reader, err := s.GetObjectReader(ctx, "tracks/original/abc.wav")
+	require.NoError(t, err)
+	assert.Equal(t, "RIFF audio", readObject(t, reader))
+
+	reader, err = s.GetObjectRangeReader(ctx, "tracks/compressed/abc_v1.mp3", 5, 3)
+	require.NoError(t, err)
+	assert.Equal(t, "aud", readObject(t, reader))
+
+	size, err := s.GetObjectSize(ctx, "tracks/original/abc.wav")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), size)
+
+	names, err := s.ListObjects(ctx, "tracks/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tracks/compressed/abc_v1.mp3", "tracks/original/abc.wav"}, names)
+
+	assert.Nil(t, s.DeleteObjects(ctx, []string{"tracks/original/abc.wav", "tracks/original/missing.wav"}))
+	_, err = s.GetObjectMetadata(ctx, "tracks/original/abc.wav")
+	assert.ErrorIs(t, err, storage.ErrObjectNotExist)
+	assert.ErrorIs(t, s.DeleteObject(ctx, "tracks/original/abc.wav"), storage.ErrObjectNotExist)
+}
+
+func TestLocalStorageFailedUploadLeavesNoObject(t *testing.T) {
+	ctx := context.Background()
+	s := newTestLocalStorage(t)
+
+	failing := io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errors.New("connection reset")))
+	assert.Error(t, s.UploadObject(ctx, "tracks/original/abc.wav", failing, "audio/wav"))
+
+	_, err := s.GetObjectSize(ctx, "tracks/original/abc.wav")
+	assert.ErrorIs(t, err, storage.ErrObjectNotExist)
+	entries, err := os.ReadDir(filepath.Join(s.root, "tracks", "original"))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestLocalStorageRejectsPathsOutsideRoot(t *testing.T) {
+	ctx := context.Background()
+	s := newTestLocalStorage(t)
+
+	for _, name := range []string{"../escape", "/etc/passwd", "tracks/../../escape", "", `tracks\..\escape`} {
+		assert.Error(t, s.UploadObject(ctx, name, strings.NewReader("x"), ""), name)
+		_, err := s.GeneratePresignedURL(ctx, name, time.Hour, UploadConstraints{})
+		assert.Error(t, err, name)
+	}
+}
+
+func TestLocalStorageSignedURLs(t *testing.T) {
+	ctx := context.Background()
+	s := newTestLocalStorage(t)
+	assert.Equal(t, "http://localhost:8080/v1/dev/files/tracks/original/abc.wav", s.GetPublicURL("tracks/original/abc.wav"))
+
+	signed, err := s.GeneratePresignedURL(ctx, "tracks/original/abc.wav", time.Hour, UploadConstraints{ContentType: "audio/wav", MaxBytes: 100})
+	require.NoError(t, err)
+	parsed, err := url.Parse(signed)
+	require.NoError(t, err)
+	assert.Equal(t, "/v1/dev/files/tracks/original/abc.wav", parsed.Path)
+	query := parsed.Query()
+
+	maxBytes, err := s.VerifySignedURL("PUT", "tracks/original/abc.wav", query, "audio/wav")
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), maxBytes)
+
+	// The content type, object, method and limit are all signed
+	_, err = s.VerifySignedURL("PUT", "tracks/original/abc.wav", query, "audio/mpeg")
+	assert.ErrorIs(t, err, ErrLocalURLInvalid)
+	_, err = s.VerifySignedURL("PUT", "tracks/original/def.wav", query, "audio/wav")
+	assert.ErrorIs(t, err, ErrLocalURLInvalid)
+	_, err = s.VerifySignedURL("GET", "tracks/original/abc.wav", query, "")
+	assert.ErrorIs(t, err, ErrLocalURLInvalid)
+	tampered := url.Values{}
+	for key, values := range query {
+		tampered[key] = values
+	}
+	tampered.Set("max_bytes", "1000000")
+	_, err = s.VerifySignedURL("PUT", "tracks/original/abc.wav", tampered, "audio/wav")
+	assert.ErrorIs(t, err, ErrLocalURLInvalid)
+
+	download, err := s.GenerateDownloadURL(ctx, "tracks/original/abc.wav", time.Hour)
+	require.NoError(t, err)
+	parsed, err = url.Parse(download)
+	require.NoError(t, err)
+	maxBytes, err = s.VerifySignedURL("GET", "tracks/original/abc.wav", parsed.Query(), "")
+	require.NoError(t, err)
+	assert.Zero(t, maxBytes)
+}
+
+func TestLocalStorageSignedURLExpiry(t *testing.T) {
+	s := newTestLocalStorage(t)
+
+	signed, err := s.GeneratePresignedURL(context.Background(), "tracks/original/abc.wav", -time.Minute, UploadConstraints{})
+	require.NoError(t, err)
+	parsed, err := url.Parse(signed)
+	require.NoError(t, err)
+
+	_, err = s.VerifySignedURL("PUT", "tracks/original/abc.wav", parsed.Query(), "")
+	assert.ErrorIs(t, err, ErrLocalURLExpired)
+}
+
+func TestNewStorageFromEnv_Local(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "storage")
+	t.Setenv("STORAGE_PROVIDER", "local")
+	t.Setenv("LOCAL_STORAGE_DIR", dir)
+	t.Setenv("LOCAL_STORAGE_BASE_URL", "http://127.0.0.1:9000")
+
+	service, err := NewStorageFromEnv(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:9000/v1/dev/files/tracks/original/abc.wav", service.GetPublicURL("tracks/original/abc.wav"))
+	assert.NoError(t, service.CheckBucket(context.Background()))
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/utils"
+)
+
+// DefaultPrimaryStorageRegion names the region backed by GCS_BUCKET_NAME when
+// STORAGE_PRIMARY_REGION is unset
+const DefaultPrimaryStorageRegion = "us"
+
+// ErrUnknownStorageRegion is returned when a region hint doesn't match any configured region
+var ErrUnknownStorageRegion = apierror.New(http.StatusBadRequest, "track.unknown_storage_region", "unknown storage region")
+
+// StorageRegionConfig describes an additional storage region in STORAGE_REGIONS
+type StorageRegionConfig struct {
+	Name      string   `json:"name"`
+	Bucket    string   `json:"bucket"`
+	CDNDomain string   `json:"cdn_domain,omitempty"`
+	Countries []string `json:"countries,omitempty"` // ISO 3166-1 alpha-2 codes routed here by default
+}
+
+// StorageRegions resolves the storage backend for a region. Tracks without a
+// region (created before regions existed) resolve to the primary region.
+type StorageRegions struct {
+	primary   string
+	services  map[string]StorageServiceInterface
+	countries map[string]string
+}
+
+// NewStorageRegions creates a registry with a single primary region
+func NewStorageRegions(primaryName string, primary StorageServiceInterface) *StorageRegions {
+	return &StorageRegions{
+		primary:   primaryName,
+		services:  map[string]StorageServiceInterface{primaryName: primary},
+		countries: map[string]string{},
+	}
+}
+
+// NewStorageRegionsFromEnv builds the registry from the primary storage service
+// and STORAGE_REGIONS, a JSON array of StorageRegionConfig. Additional regions
+// are GCS buckets sharing the primary's client, so they need a GCS primary.
+// PUBLIC_MEDIA_BASE_URL and STORAGE_PRIMARY_CDN_DOMAIN, when set, serve a GCS
+// or Azure primary region's public URLs.
+func NewStorageRegionsFromEnv(primary StorageServiceInterface) (*StorageRegions, error) {
+	primaryName := os.Getenv("STORAGE_PRIMARY_REGION")
+	if primaryName == "" {
+		primaryName = DefaultPrimaryStorageRegion
+	}
+
+	publicURLs, err := utils.GetPublicURLConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// Retries wrap the backend, and wrap additional regions the same way
+	backend := UnwrapStorage(primary)
+	retrying, _ := primary.(*RetryingStorage)
+
+	gcsPrimary, isGCS := backend.(*StorageService)
+	if isGCS {
+		gcsPrimary.cdnDomain = os.Getenv("STORAGE_PRIMARY_CDN_DOMAIN")
+		gcsPrimary.publicBaseURL = publicURLs.MediaBaseURL
+	}
+	if azurePrimary, ok := backend.(*AzureStorageService); ok {
+		azurePrimary.cdnDomain = os.Getenv("STORAGE_PRIMARY_CDN_DOMAIN")
+		azurePrimary.publicBaseURL = publicURLs.MediaBaseURL
+	}
+
+	regions := NewStorageRegions(primaryName, primary)
+
+	raw := os.Getenv("STORAGE_REGIONS")
+	if raw == "" {
+		return regions, nil
+	}
+	if !isGCS {
+		return nil, fmt.Errorf("invalid STORAGE_REGIONS: additional regions need GCS primary storage")
+	}
+
+	var configs []StorageRegionConfig
+	if err := json.Unmarshal([]byte(raw), &configs); err != nil {
+		return nil, fmt.Errorf("invalid STORAGE_REGIONS: %w", err)
+	}
+
+	for _, config := range configs {
+		if config.Name == "" || config.Bucket == "" {
+			return nil, fmt.Errorf("invalid STORAGE_REGIONS: each region needs a name and bucket")
+		}
+		var service StorageServiceInterface = newStorageServiceForBucket(gcsPrimary.client, config.Bucket, config.CDNDomain)
+		if retrying != nil {
+			service = NewRetryingStorage(service, retrying.policy)
+		}
+		if err := regions.Add(config.Name, service, config.Countries); err != nil {
+			return nil, err
+		}
+		log.Printf("Configured storage region %s (bucket: %s)", config.Name, config.Bucket)
+	}
+
+	return regions, nil
+}
+
+// Add registers an additional region and the countries routed to it by default
+func (r *StorageRegions) Add(name string, service StorageServiceInterface, countries []string) error {
+	if _, exists := r.services[name]; exists {
+		return fmt.Errorf("storage region %s is already configured", name)
+	}
+
+	r.services[name] = service
+	for _, country := range countries {
+		r.countries[strings.ToUpper(country)] = name
+	}
+	return nil
+}
+
+// Primary returns the name of the primary region
+func (r *StorageRegions) Primary() string {
+	return r.primary
+}
+
+// Names returns all configured region names, sorted
+func (r *StorageRegions) Names() []string {
+	names := make([]string, 0, len(r.services))
+	for name := range r.services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the storage service for a region. An empty region is the primary;
+// a region that is no longer configured also falls back to the primary.
+func (r *StorageRegions) Get(region string) StorageServiceInterface {
+	if region == "" {
+		return r.services[r.primary]
+	}
+	if service, ok := r.services[region]; ok {
+		return service
+	}
+
+	log.Printf("Storage region %s is not configured, using primary region %s", region, r.primary)
+	return r.services[r.primary]
+}
+
+// Choose picks the region for a new track: an explicit hint must name a
+// configured region, otherwise the client's country picks a region, otherwise
+// the primary is used
+func (r *StorageRegions) Choose(hint, country string) (string, error) {
+	if hint != "" {
+		if _, ok := r.services[hint]; !ok {
+			return "", ErrUnknownStorageRegion
+		}
+		return hint, nil
+	}
+
+	if region, ok := r.countries[strings.ToUpper(country)]; ok {
+		return region, nil
+	}
+
+	return r.primary, nil
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/models"
+)
+
+func TestStorageRegionsFromEnv(t *testing.T) {
+	t.Setenv("STORAGE_PRIMARY_REGION", "us")
+	t.Setenv("STORAGE_PRIMARY_CDN_DOMAIN", "")
+	t.Setenv("PUBLIC_MEDIA_BASE_URL", "")
+	t.Setenv("STORAGE_REGIONS", `[{"name":"eu","bucket":"wavlake-eu","cdn_domain":"eu.cdn.wavlake.com","countries":["de","FR"]}]`)
+
+	primary := &StorageService{bucketName: "wavlake-us"}
+	regions, err := NewStorageRegionsFromEnv(primary)
+	require.NoError(t, err)
+
+	assert.Equal(t, "us", regions.Primary())
+	assert.Equal(t, []string{"eu", "us"}, regions.Names())
+
+	assert.Equal(t, "wavlake-us", regions.Get("").GetBucketName())
+	assert.Equal(t, "wavlake-us", regions.Get("us").GetBucketName())
+	assert.Equal(t, "wavlake-eu", regions.Get("eu").GetBucketName())
+
+	// Tracks from a region that was removed from config fall back to the primary
+	assert.Equal(t, "wavlake-us", regions.Get("ap").GetBucketName())
+
+	assert.Equal(t, "https://eu.cdn.wavlake.com/tracks/original/abc.mp3", regions.Get("eu").GetPublicURL("tracks/original/abc.mp3"))
+	assert.Equal(t, "https://storage.googleapis.com/wavlake-us/tracks/original/abc.mp3", regions.Get("").GetPublicURL("tracks/original/abc.mp3"))
+}
+
+func TestStorageRegionsFromEnv_Invalid(t *testing.T) {
+	t.Setenv("STORAGE_REGIONS", `[{"name":"eu"}]`)
+	_, err := NewStorageRegionsFromEnv(&StorageService{bucketName: "wavlake-us"})
+	assert.Error(t, err)
+
+	t.Setenv("STORAGE_REGIONS", `not json`)
+	_, err = NewStorageRegionsFromEnv(&StorageService{bucketName: "wavlake-us"})
+	assert.Error(t, err)
+}
+
+func TestStorageRegionsFromEnv_PublicMediaBaseURL(t *testing.T) {
+	t.Setenv("STORAGE_PRIMARY_CDN_DOMAIN", "cdn.wavlake.com")
+	t.Setenv("PUBLIC_MEDIA_BASE_URL", "https://media.wavlake.com/")
+	t.Setenv("STORAGE_REGIONS", `[{"name":"eu","bucket":"wavlake-eu","cdn_domain":"eu.cdn.wavlake.com"}]`)
+
+	regions, err := NewStorageRegionsFromEnv(&StorageService{bucketName: "wavlake-us"})
+	require.NoError(t, err)
+
+	// The public base serves the primary region; other regions keep their CDN domain
+	assert.Equal(t, "https://media.wavlake.com/tracks/original/abc.mp3", regions.Get("").GetPublicURL("tracks/original/abc.mp3"))
+	assert.Equal(t, "https://eu.cdn.wavlake.com/tracks/original/abc.mp3", regions.Get("eu").GetPublicURL("tracks/original/abc.mp3"))
+
+	t.Setenv("PUBLIC_MEDIA_BASE_URL", "media.wavlake.com")
+	_, err = NewStorageRegionsFromEnv(&StorageService{bucketName: "wavlake-us"})
+	assert.Error(t, err)
+}
+
+func TestResolvePublicURL(t *testing.T) {
+	legacyGCS := "https://storage.googleapis.com/wavlake-us/tracks/compressed/abc.mp3"
+	legacyCDN := "https://cdn.wavlake.com/tracks/compressed/abc.mp3"
+	external := "https://example.com/tracks/compressed/abc.mp3"
+	otherBucket := "https://storage.googleapis.com/wavlake-eu/tracks/compressed/abc.mp3"
+
+	tests := []struct {
+		name     string
+		storage  *StorageService
+		stored   string
+		expected string
+	}{
+		{name: "unconfigured keeps GCS URL", storage: &StorageService{bucketName: "wavlake-us"}, stored: legacyGCS, expected: legacyGCS},
+		{name: "CDN rewrites GCS URL", storage: &StorageService{bucketName: "wavlake-us", cdnDomain: "cdn.wavlake.com"}, stored: legacyGCS, expected: legacyCDN},
+		{name: "base rewrites GCS URL", storage: &StorageService{bucketName: "wavlake-us", publicBaseURL: "https://media.wavlake.com"}, stored: legacyGCS, expected: "https://media.wavlake.com/tracks/compressed/abc.mp3"},
+		{name: "base rewrites CDN URL", storage: &StorageService{bucketName: "wavlake-us", cdnDomain: "cdn.wavlake.com", publicBaseURL: "https://media.wavlake.com/v1"}, stored: legacyCDN, expected: "https://media.wavlake.com/v1/tracks/compressed/abc.mp3"},
+		{name: "base URL is stable", storage: &StorageService{bucketName: "wavlake-us", publicBaseURL: "https://media.wavlake.com"}, stored: "https://media.wavlake.com/tracks/compressed/abc.mp3", expected: "https://media.wavlake.com/tracks/compressed/abc.mp3"},
+		{name: "external URL unchanged", storage: &StorageService{bucketName: "wavlake-us", publicBaseURL: "https://media.wavlake.com"}, stored: external, expected: external},
+		{name: "other bucket unchanged", storage: &StorageService{bucketName: "wavlake-us", publicBaseURL: "https://media.wavlake.com"}, stored: otherBucket, expected: otherBucket},
+		{name: "empty URL unchanged", storage: &StorageService{bucketName: "wavlake-us", publicBaseURL: "https://media.wavlake.com"}, stored: "", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.storage.ResolvePublicURL(tt.stored))
+		})
+	}
+}
+
+func TestTrackURLsResolveOnRead(t *testing.T) {
+	regions := NewStorageRegions("us", &StorageService{bucketName: "wavlake-us", publicBaseURL: "https://media.wavlake.com"})
+	require.NoError(t, regions.Add("eu", &StorageService{bucketName: "wavlake-eu"}, nil))
+	service := NewNostrTrackService(nil, regions)
+
+	track := &models.NostrTrack{
+		OriginalURL:   "https://storage.googleapis.com/wavlake-us/tracks/original/abc.wav",
+		CompressedURL: "https://storage.googleapis.com/wavlake-us/tracks/compressed/abc.mp3",
+		CompressionVersions: []models.CompressionVersion{
+			{ID: "v1", URL: "https://storage.googleapis.com/wavlake-us/tracks/compressed/abc_v1.ogg"},
+		},
+	}
+	service.resolveURLs(track)
+	assert.Equal(t, "https://media.wavlake.com/tracks/original/abc.wav", track.OriginalURL)
+	assert.Equal(t, "https://media.wavlake.com/tracks/compressed/abc.mp3", track.CompressedURL)
+	assert.Equal(t, "https://media.wavlake.com/tracks/compressed/abc_v1.ogg", track.CompressionVersions[0].URL)
+
+	// A track in a region without a public base keeps its bucket URLs
+	euTrack := &models.NostrTrack{Region: "eu", OriginalURL: "https://storage.googleapis.com/wavlake-eu/tracks/original/abc.wav"}
+	service.resolveURLs(euTrack)
+	assert.Equal(t, "https://storage.googleapis.com/wavlake-eu/tracks/original/abc.wav", euTrack.OriginalURL)
+}
+
+func TestStorageRegionsChoose(t *testing.T) {
+	regions := NewStorageRegions("us", &StorageService{bucketName: "wavlake-us"})
+	require.NoError(t, regions.Add("eu", &StorageService{bucketName: "wavlake-eu"}, []string{"DE"}))
+
+	tests := []struct {
+		name     string
+		hint     string
+		country  string
+		expected string
+		err      error
+	}{
+		{name: "hint wins over country", hint: "us", country: "DE", expected: "us"},
+		{name: "country default", country: "de", expected: "eu"},
+		{name: "unmapped country uses primary", country: "BR", expected: "us"},
+		{name: "no hint or country uses primary", expected: "us"},
+		{name: "unknown hint", hint: "ap", err: ErrUnknownStorageRegion},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			region, err := regions.Choose(tt.hint, tt.country)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, region)
+		})
+	}
+
+	assert.Error(t, regions.Add("eu", &StorageService{bucketName: "other"}, nil))
+}
+
+func TestStorageRegionsFromEnv_NonGCSPrimary(t *testing.T) {
+	t.Setenv("PUBLIC_MEDIA_BASE_URL", "")
+	t.Setenv("STORAGE_REGIONS", "")
+
+	primary := &fakeObjectStorage{}
+	regions, err := NewStorageRegionsFromEnv(primary)
+	require.NoError(t, err)
+	assert.Same(t, primary, regions.Get(""))
+
+	// Extra regions share a GCS client, which other backends don't have
+	t.Setenv("STORAGE_REGIONS", `[{"name":"eu","bucket":"wavlake-eu"}]`)
+	_, err = NewStorageRegionsFromEnv(primary)
+	assert.Error(t, err)
+}
+
+func TestNewStorageFromEnv_UnsupportedProvider(t *testing.T) {
+	t.Setenv("STORAGE_PROVIDER", "S3")
+
+	_, err := NewStorageFromEnv(context.Background())
+	assert.ErrorIs(t, err, ErrUnsupportedStorageProvider)
+	assert.Contains(t, err.Error(), `"s3"`)
+}
@@ -0,0 +1,369 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/wavlake/api/internal/logging"
+	"github.com/wavlake/api/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/api/googleapi"
+)
+
+// Defaults for DefaultRetryPolicy
+const (
+	DefaultStorageRetryAttempts = 4
+	defaultStorageRetryBackoff  = 200 * time.Millisecond
+	maxStorageRetryBackoff      = 5 * time.Second
+)
+
+// RetryPolicy says how RetryingStorage retries a failed operation. Delays
+// start at InitialBackoff and double up to MaxBackoff, each shortened by up
+// to half at random so instances don't retry in step.
+type RetryPolicy struct {
+	MaxAttempts    int // Including the first; 1 disables retries
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Retryable reports whether an error is worth another attempt; nil uses
+	// IsRetryableStorageError
+	Retryable func(error) bool
+}
+
+// DefaultRetryPolicy makes up to DefaultStorageRetryAttempts attempts of
+// transient failures, waiting from 200ms up to 5s between them
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    DefaultStorageRetryAttempts,
+		InitialBackoff: defaultStorageRetryBackoff,
+		MaxBackoff:     maxStorageRetryBackoff,
+	}
+}
+
+// backoff returns the delay before the attempt after the nth failed one
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.InitialBackoff
+	for i := 1; i < attempt && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, p.MaxBackoff)
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1) // #nosec G404 -- Jitter, not security
+}
+
+// IsRetryableStorageError reports whether a storage error is transient: a
+// 408, 429 or 5xx response from GCS or Azure, or a network error. Cancelled
+// contexts and missing objects aren't.
+func IsRetryableStorageError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, storage.ErrObjectNotExist) {
+		return false
+	}
+
+	var gcsErr *googleapi.Error
+	if errors.As(err, &gcsErr) {
+		return retryableStatus(gcsErr.Code)
+	}
+	var azureErr *azcore.ResponseError
+	if errors.As(err, &azureErr) {
+		return retryableStatus(azureErr.StatusCode)
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+}
+
+// RetryingStorage retries a backend's idempotent operations on transient
+// errors. Uploads are retried only when their data can be rewound, and
+// readers only while opening; a read failing partway is left to the caller.
+// Each operation that reaches the backend is traced as one span, with its
+// retries as events. Readiness checks aren't traced.
+type RetryingStorage struct {
+	inner  StorageServiceInterface
+	policy RetryPolicy
+}
+
+// NewRetryingStorage wraps a storage backend with retries. A policy with no
+// MaxAttempts makes a single attempt.
+func NewRetryingStorage(inner StorageServiceInterface, policy RetryPolicy) *RetryingStorage {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = 1
+	}
+	if policy.Retryable == nil {
+		policy.Retryable = IsRetryableStorageError
+	}
+	return &RetryingStorage{inner: inner, policy: policy}
+}
+
+// Unwrap returns the wrapped backend
+func (s *RetryingStorage) Unwrap() StorageServiceInterface {
+	return s.inner
+}
+
+// UnwrapStorage returns the backend under any RetryingStorage, for checks of
+// the backend's type
+func UnwrapStorage(storageService StorageServiceInterface) StorageServiceInterface {
+	for {
+		retrying, ok := storageService.(*RetryingStorage)
+		if !ok {
+			return storageService
+		}
+		storageService = retrying.inner
+	}
+}
+
+// traced runs a single storage operation in a span named storage.<operation>
+func (s *RetryingStorage) traced(ctx context.Context, operation, objectName string, op func(ctx context.Context) error) error {
+	ctx, span := telemetry.Start(ctx, "storage."+operation, attribute.String("storage.object", objectName))
+	if span.IsRecording() {
+		span.SetAttributes(attribute.String("storage.bucket", s.inner.GetBucketName()))
+	}
+	err := op(ctx)
+	telemetry.End(span, err)
+	return err
+}
+
+// retry runs op until it succeeds, fails with an error that isn't
+// retryable, runs out of attempts, or ctx would end before the next one
+func (s *RetryingStorage) retry(ctx context.Context, operation, objectName string, op func(ctx context.Context, attempt int) error) error {
+	return s.traced(ctx, operation, objectName, func(ctx context.Context) error {
+		return s.retryTraced(ctx, operation, objectName, op)
+	})
+}
+
+func (s *RetryingStorage) retryTraced(ctx context.Context, operation, objectName string, op func(ctx context.Context, attempt int) error) error {
+	for attempt := 1; ; attempt++ {
+		err := op(ctx, attempt)
+		if err == nil || attempt >= s.policy.MaxAttempts || !s.policy.Retryable(err) {
+			return err
+		}
+
+		delay := s.policy.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return err
+		}
+		logging.FromContext(ctx).Warn("retrying storage operation", "operation", operation, "object", objectName, "attempt", attempt, "delay", delay, "error", err)
+		trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(
+			attribute.Int("attempt", attempt),
+			attribute.String("error", err.Error()),
+		))
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (s *RetryingStorage) GeneratePresignedURL(ctx context.Context, objectName string, expiration time.Duration, constraints UploadConstraints) (string, error) {
+	var url string
+	err := s.retry(ctx, "presign_upload", objectName, func(ctx context.Context, _ int) error {
+		var err error
+		url, err = s.inner.GeneratePresignedURL(ctx, objectName, expiration, constraints)
+		return err
+	})
+	return url, err
+}
+
+func (s *RetryingStorage) UploadHeaders(constraints UploadConstraints) map[string]string {
+	return s.inner.UploadHeaders(constraints)
+}
+
+func (s *RetryingStorage) GenerateDownloadURL(ctx context.Context, objectName string, expiration time.Duration) (string, error) {
+	var url string
+	err := s.retry(ctx, "presign_download", objectName, func(ctx context.Context, _ int) error {
+		var err error
+		url, err = s.inner.GenerateDownloadURL(ctx, objectName, expiration)
+		return err
+	})
+	return url, err
+}
+
+func (s *RetryingStorage) GetPublicURL(objectName string) string {
+	return s.inner.GetPublicURL(objectName)
+}
+
+func (s *RetryingStorage) ResolvePublicURL(storedURL string) string {
+	return s.inner.ResolvePublicURL(storedURL)
+}
+
+// UploadObject retries when data is an io.Seeker, seeking back to where the
+// first attempt started. Other readers are consumed by the first attempt, so
+// it's the only one.
+func (s *RetryingStorage) UploadObject(ctx context.Context, objectName string, data io.Reader, contentType string) error {
+	uploadOnce := func(ctx context.Context) error {
+		return s.inner.UploadObject(ctx, objectName, data, contentType)
+	}
+	seeker, ok := data.(io.Seeker)
+	if !ok {
+		return s.traced(ctx, "upload", objectName, uploadOnce)
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return s.traced(ctx, "upload", objectName, uploadOnce)
+	}
+
+	return s.retry(ctx, "upload", objectName, func(ctx context.Context, attempt int) error {
+		if attempt > 1 {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return err
+			}
+		}
+		return s.inner.UploadObject(ctx, objectName, data, contentType)
+	})
+}
+
+func (s *RetryingStorage) CopyObject(ctx context.Context, srcObject, dstObject string) error {
+	return s.retry(ctx, "copy", dstObject, func(ctx context.Context, _ int) error {
+		return s.inner.CopyObject(ctx, srcObject, dstObject)
+	})
+}
+
+// DeleteObject treats a missing object on a retry as deleted, since the
+// failed attempt may have deleted it
+func (s *RetryingStorage) DeleteObject(ctx context.Context, objectName string) error {
+	return s.retry(ctx, "delete", objectName, func(ctx context.Context, attempt int) error {
+		err := s.inner.DeleteObject(ctx, objectName)
+		if attempt > 1 && errors.Is(err, storage.ErrObjectNotExist) {
+			return nil
+		}
+		return err
+	})
+}
+
+// DeleteObjects retries only the deletes that failed with retryable errors,
+// treating objects missing on a retry as deleted like DeleteObject does
+func (s *RetryingStorage) DeleteObjects(ctx context.Context, objectNames []string) map[string]error {
+	failed := map[string]error{}
+	remaining := objectNames
+	// The per-object failures are returned, so the last attempt's error isn't
+	_ = s.retry(ctx, "delete_objects", "", func(ctx context.Context, attempt int) error {
+		var retryErr error
+		var retry []string
+		for _, objectName := range remaining {
+			delete(failed, objectName)
+		}
+		for objectName, err := range s.inner.DeleteObjects(ctx, remaining) {
+			if attempt > 1 && errors.Is(err, storage.ErrObjectNotExist) {
+				continue
+			}
+			failed[objectName] = err
+			if s.policy.Retryable(err) {
+				retry = append(retry, objectName)
+				retryErr = err
+			}
+		}
+		remaining = retry
+		return retryErr
+	})
+
+	if len(failed) == 0 {
+		return nil
+	}
+	return failed
+}
+
+func (s *RetryingStorage) ListObjects(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	err := s.retry(ctx, "list", prefix, func(ctx context.Context, _ int) error {
+		var err error
+		names, err = s.inner.ListObjects(ctx, prefix)
+		return err
+	})
+	return names, err
+}
+
+func (s *RetryingStorage) GetObjectMetadata(ctx context.Context, objectName string) (interface{}, error) {
+	var metadata interface{}
+	err := s.retry(ctx, "metadata", objectName, func(ctx context.Context, _ int) error {
+		var err error
+		metadata, err = s.inner.GetObjectMetadata(ctx, objectName)
+		return err
+	})
+	return metadata, err
+}
+
+// GetObjectReader retries opening the reader; reads from it aren't retried
+func (s *RetryingStorage) GetObjectReader(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	var reader io.ReadCloser
+	err := s.retry(ctx, "open_reader", objectName, func(ctx context.Context, _ int) error {
+		var err error
+		reader, err = s.inner.GetObjectReader(ctx, objectName)
+		return err
+	})
+	return reader, err
+}
+
+// GetObjectRangeReader retries opening the reader; reads from it aren't
+// retried
+func (s *RetryingStorage) GetObjectRangeReader(ctx context.Context, objectName string, offset, length int64) (io.ReadCloser, error) {
+	var reader io.ReadCloser
+	err := s.retry(ctx, "open_range_reader", objectName, func(ctx context.Context, _ int) error {
+		var err error
+		reader, err = s.inner.GetObjectRangeReader(ctx, objectName, offset, length)
+		return err
+	})
+	return reader, err
+}
+
+func (s *RetryingStorage) GetObjectSize(ctx context.Context, objectName string) (int64, error) {
+	var size int64
+	err := s.retry(ctx, "size", objectName, func(ctx context.Context, _ int) error {
+		var err error
+		size, err = s.inner.GetObjectSize(ctx, objectName)
+		return err
+	})
+	return size, err
+}
+
+func (s *RetryingStorage) GetObjectChecksums(ctx context.Context, objectName string) (*ObjectChecksums, error) {
+	var checksums *ObjectChecksums
+	err := s.retry(ctx, "checksums", objectName, func(ctx context.Context, _ int) error {
+		var err error
+		checksums, err = s.inner.GetObjectChecksums(ctx, objectName)
+		return err
+	})
+	return checksums, err
+}
+
+func (s *RetryingStorage) SetStorageClass(ctx context.Context, objectName, storageClass string) error {
+	return s.retry(ctx, "set_storage_class", objectName, func(ctx context.Context, _ int) error {
+		return s.inner.SetStorageClass(ctx, objectName, storageClass)
+	})
+}
+
+func (s *RetryingStorage) RestoreObject(ctx context.Context, objectName string) (bool, error) {
+	var ready bool
+	err := s.retry(ctx, "restore", objectName, func(ctx context.Context, _ int) error {
+		var err error
+		ready, err = s.inner.RestoreObject(ctx, objectName)
+		return err
+	})
+	return ready, err
+}
+
+func (s *RetryingStorage) GetBucketName() string {
+	return s.inner.GetBucketName()
+}
+
+// CheckBucket isn't retried, so readiness reflects the backend as it is
+func (s *RetryingStorage) CheckBucket(ctx context.Context) error {
+	return s.inner.CheckBucket(ctx)
+}
+
+func (s *RetryingStorage) Close() error {
+	return s.inner.Close()
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+)
+
+var errUnavailable = &googleapi.Error{Code: http.StatusServiceUnavailable, Message: "backend unavailable"}
+
+// flakyStorage fails each operation with err for its first failures calls
+type flakyStorage struct {
+	StorageServiceInterface
+	failures int
+	err      error
+	calls    int
+	uploads  []string
+	deletes  [][]string
+}
+
+func (s *flakyStorage) fail() error {
+	s.calls++
+	if s.calls <= s.failures {
+		return s.err
+	}
+	return nil
+}
+
+func (s *flakyStorage) GetObjectSize(ctx context.Context, objectName string) (int64, error) {
+	if err := s.fail(); err != nil {
+		return 0, err
+	}
+	return 42, nil
+}
+
+func (s *flakyStorage) UploadObject(ctx context.Context, objectName string, data io.Reader, contentType string) error {
+	content, err := io.ReadAll(data)
+	if err != nil {
+		return err
+	}
+	s.uploads = append(s.uploads, string(content))
+	return s.fail()
+}
+
+func (s *flakyStorage) DeleteObject(ctx context.Context, objectName string) error {
+	if err := s.fail(); err != nil {
+		return err
+	}
+	if s.calls > 1 {
+		return storage.ErrObjectNotExist
+	}
+	return nil
+}
+
+func (s *flakyStorage) DeleteObjects(ctx context.Context, objectNames []string) map[string]error {
+	s.deletes = append(s.deletes, objectNames)
+	if err := s.fail(); err != nil {
+		failed := map[string]error{}
+		for _, objectName := range objectNames {
+			failed[objectName] = err
+			if strings.HasSuffix(objectName, "forbidden.wav") {
+				failed[objectName] = &googleapi.Error{Code: http.StatusForbidden}
+			}
+		}
+		return failed
+	}
+	return nil
+}
+
+func newTestRetryingStorage(inner StorageServiceInterface) *RetryingStorage {
+	return NewRetryingStorage(inner, RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond})
+}
+
+func TestRetryingStorageRetriesTransientErrors(t *testing.T) {
+	inner := &flakyStorage{failures: 2, err: errUnavailable}
+	size, err := newTestRetryingStorage(inner).GetObjectSize(context.Background(), "tracks/original/abc.wav")
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), size)
+	assert.Equal(t, 3, inner.calls)
+}
+
+func TestRetryingStorageGivesUp(t *testing.T) {
+	inner := &flakyStorage{failures: 5, err: errUnavailable}
+	_, err := newTestRetryingStorage(inner).GetObjectSize(context.Background(), "tracks/original/abc.wav")
+
+	assert.ErrorIs(t, err, errUnavailable)
+	assert.Equal(t, 3, inner.calls)
+}
+
+func TestRetryingStorageDoesNotRetryPermanentErrors(t *testing.T) {
+	for _, err := range []error{storage.ErrObjectNotExist, &googleapi.Error{Code: http.StatusForbidden}, context.Canceled} {
+		inner := &flakyStorage{failures: 1, err: err}
+		_, got := newTestRetryingStorage(inner).GetObjectSize(context.Background(), "tracks/original/abc.wav")
+
+		assert.ErrorIs(t, got, err)
+		assert.Equal(t, 1, inner.calls, err.Error())
+	}
+}
+
+func TestRetryingStorageHonoursDeadline(t *testing.T) {
+	inner := &flakyStorage{failures: 5, err: errUnavailable}
+	s := NewRetryingStorage(inner, RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Minute, MaxBackoff: time.Minute})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	_, err := s.GetObjectSize(ctx, "tracks/original/abc.wav")
+	assert.ErrorIs(t, err, errUnavailable)
+	assert.Equal(t, 1, inner.calls)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestRetryingStorageUploads(t *testing.T) {
+	t.Run("seekable data is rewound", func(t *testing.T) {
+		inner := &flakyStorage{failures: 1, err: errUnavailable}
+		require.NoError(t, newTestRetryingStorage(inner).UploadObject(context.Background(), "tracks/compressed/abc.mp3", strings.NewReader("ID3 audio"), "audio/mpeg"))
+		assert.Equal(t, []string{"ID3 audio", "ID3 audio"}, inner.uploads)
+	})
+
+	t.Run("streams get one attempt", func(t *testing.T) {
+		inner := &flakyStorage{failures: 1, err: errUnavailable}
+		stream := io.MultiReader(strings.NewReader("ID3 audio"))
+		err := newTestRetryingStorage(inner).UploadObject(context.Background(), "tracks/compressed/abc.mp3", stream, "audio/mpeg")
+		assert.ErrorIs(t, err, errUnavailable)
+		assert.Equal(t, []string{"ID3 audio"}, inner.uploads)
+	})
+}
+
+func TestRetryingStorageDeletes(t *testing.T) {
+	t.Run("missing on retry counts as deleted", func(t *testing.T) {
+		inner := &flakyStorage{failures: 1, err: errUnavailable}
+		assert.NoError(t, newTestRetryingStorage(inner).DeleteObject(context.Background(), "tracks/original/abc.wav"))
+		assert.Equal(t, 2, inner.calls)
+	})
+
+	t.Run("batch retries only retryable failures", func(t *testing.T) {
+		inner := &flakyStorage{failures: 1, err: errUnavailable}
+		failed := newTestRetryingStorage(inner).DeleteObjects(context.Background(), []string{"tracks/original/abc.wav", "tracks/original/forbidden.wav"})
+
+		assert.Equal(t, [][]string{{"tracks/original/abc.wav", "tracks/original/forbidden.wav"}, {"tracks/original/abc.wav"}}, inner.deletes)
+		require.Len(t, failed, 1)
+		assert.Contains(t, failed, "tracks/original/forbidden.wav")
+	})
+}
+
+func TestIsRetryableStorageError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errUnavailable, true},
+		{&googleapi.Error{Code: http.StatusTooManyRequests}, true},
+		{&googleapi.Error{Code: http.StatusNotFound}, false},
+		{&azcore.ResponseError{StatusCode: http.StatusInternalServerError}, true},
+		{&azcore.ResponseError{StatusCode: http.StatusConflict}, false},
+		{io.ErrUnexpectedEOF, true},
+		{context.DeadlineExceeded, false},
+		{errors.New("invalid object name"), false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, IsRetryableStorageError(tt.err), "%v", tt.err)
+	}
+}
+
+func TestNewStorageFromEnv_RetryAttempts(t *testing.T) {
+	t.Setenv("STORAGE_PROVIDER", "local")
+	t.Setenv("LOCAL_STORAGE_DIR", t.TempDir())
+
+	t.Setenv("STORAGE_RETRY_ATTEMPTS", "1")
+	service, err := NewStorageFromEnv(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, service.(*RetryingStorage).policy.MaxAttempts)
+
+	t.Setenv("STORAGE_RETRY_ATTEMPTS", "none")
+	_, err = NewStorageFromEnv(context.Background())
+	assert.ErrorContains(t, err, "STORAGE_RETRY_ATTEMPTS")
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadURLOptionsSignConstraints(t *testing.T) {
+	sign := func(b []byte) ([]byte, error) { return []byte("signature"), nil }
+	constraints := UploadConstraints{ContentType: "audio/wav", MaxBytes: 500 << 20}
+
+	opts := uploadURLOptions("api@example.iam.gserviceaccount.com", time.Hour, constraints, sign)
+	signedURL, err := storage.SignedURL("wavlake", "tracks/original/abc.wav", opts)
+	require.NoError(t, err)
+
+	parsed, err := url.Parse(signedURL)
+	require.NoError(t, err)
+	signedHeaders := strings.Split(parsed.Query().Get("X-Goog-SignedHeaders"), ";")
+	assert.Contains(t, signedHeaders, "content-type")
+	assert.Contains(t, signedHeaders, "x-goog-content-length-range")
+
+	assert.Equal(t, map[string]string{
+		"Content-Type":                "audio/wav",
+		"X-Goog-Content-Length-Range": "0,524288000",
+	}, gcsUploadHeaders(constraints))
+}
+
+func TestUploadURLOptionsWithoutConstraints(t *testing.T) {
+	opts := uploadURLOptions("api@example.iam.gserviceaccount.com", time.Hour, UploadConstraints{}, nil)
+	assert.Equal(t, []string{"Content-Type"}, opts.Headers)
+	assert.Empty(t, gcsUploadHeaders(UploadConstraints{}))
+}
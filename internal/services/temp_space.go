@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/wavlake/api/internal/logging"
+)
+
+const (
+	// DefaultTempFileMaxAge is how old a processing temp file must be before
+	// the startup sweep removes it
+	DefaultTempFileMaxAge = 6 * time.Hour
+
+	// DefaultTempSpaceFactor is how many times an original's size must be free
+	// in the temp dir before it is downloaded, leaving room for the renditions,
+	// preview and artwork made from it
+	DefaultTempSpaceFactor = 3
+)
+
+// ErrInsufficientDiskSpace is returned when the temp dir doesn't have room
+// for a download. Processing retries it like other transient failures.
+var ErrInsufficientDiskSpace = errors.New("insufficient disk space")
+
+// tempFilePattern matches the files processing writes to the temp dir, named
+// for the track and, for compression versions, the version:
+// {trackID}_original.wav, {trackID}_{versionID}_compressed.aac,
+// {trackID}_preview.mp3. It also matches utils.AudioProcessor's
+// audio_download_* files.
+var tempFilePattern = regexp.MustCompile(`^(?:[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}_(?:[0-9a-z-]+_)?(?:original|compressed|preview|artwork)\.[0-9A-Za-z]+|audio_download_[0-9]+)$`)
+
+// WithTempSpaceFactor sets how many times an original's size must be free in
+// the temp dir before processing downloads it
+func WithTempSpaceFactor(factor int) ProcessingOption {
+	return func(p *ProcessingService) {
+		if factor > 0 {
+			p.tempSpaceFactor = factor
+		}
+	}
+}
+
+// SweepTempDir removes processing temp files older than maxAge, left behind
+// by runs that crashed before their deferred cleanup. Call it at startup,
+// before any worker writes to the temp dir. Other files are left alone, so
+// the temp dir can be shared with other programs.
+func (p *ProcessingService) SweepTempDir(maxAge time.Duration) (int, error) {
+	entries, err := os.ReadDir(p.tempDir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read temp dir: %w", err)
+	}
+
+	cutoff := p.now().Add(-maxAge)
+	removed := 0
+	var freed int64
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !tempFilePattern.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(p.tempDir, entry.Name())); err != nil {
+			log.Printf("Failed to remove stale temp file %s: %v", entry.Name(), err)
+			continue
+		}
+		removed++
+		freed += info.Size()
+	}
+
+	used, err := p.tempDirUsage()
+	if err != nil {
+		return removed, err
+	}
+	log.Printf("Swept temp dir %s: removed %d stale files (%d bytes), %d bytes in use", p.tempDir, removed, freed, used)
+	return removed, nil
+}
+
+// tempDirUsage totals the size of the processing files in the temp dir
+func (p *ProcessingService) tempDirUsage() (int64, error) {
+	entries, err := os.ReadDir(p.tempDir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read temp dir: %w", err)
+	}
+
+	var used int64
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !tempFilePattern.MatchString(entry.Name()) {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			used += info.Size()
+		}
+	}
+	return used, nil
+}
+
+// checkTempSpace refuses a download when the temp dir has less than
+// tempSpaceFactor times the object's size free. The check is skipped when the
+// object's size or the free space can't be read; the download reports a
+// missing object itself.
+func (p *ProcessingService) checkTempSpace(ctx context.Context, storageService StorageServiceInterface, objectName string) error {
+	size, err := storageService.GetObjectSize(ctx, objectName)
+	if err != nil {
+		return nil
+	}
+	free, err := p.diskFree(p.tempDir)
+	if err != nil {
+		logging.FromContext(ctx).Debug("could not read temp dir free space", "temp_dir", p.tempDir, "error", err)
+		return nil
+	}
+
+	needed := size * int64(p.tempSpaceFactor)
+	used, _ := p.tempDirUsage()
+	if free < needed {
+		logging.FromContext(ctx).Warn("temp dir too full to download", "object", objectName, "needed_bytes", needed, "free_bytes", free, "used_bytes", used)
+		return fmt.Errorf("%w: %s needs %d bytes, %d free", ErrInsufficientDiskSpace, objectName, needed, free)
+	}
+	logging.FromContext(ctx).Debug("temp dir usage", "needed_bytes", needed, "free_bytes", free, "used_bytes", used)
+	return nil
+}
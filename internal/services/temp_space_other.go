@@ -0,0 +1,10 @@
+//go:build !unix
+
+package services
+
+import "errors"
+
+// diskFree isn't supported here, so temp space checks are skipped
+func diskFree(dir string) (int64, error) {
+	return 0, errors.New("free space not supported on this platform")
+}
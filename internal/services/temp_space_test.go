@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/models"
+)
+
+const (
+	testTempTrackID   = "0b6f3c1e-8d2a-4f5b-9c7e-1a2b3c4d5e6f"
+	testTempVersionID = "9f8e7d6c-5b4a-4321-8765-0fedcba98765"
+)
+
+func TestTempFilePattern(t *testing.T) {
+	for _, name := range []string{
+		testTempTrackID + "_original.wav",
+		testTempTrackID + "_compressed.mp3",
+		testTempTrackID + "_preview.mp3",
+		testTempTrackID + "_artwork.jpg",
+		testTempTrackID + "_" + testTempVersionID + "_original.flac",
+		testTempTrackID + "_" + testTempVersionID + "_compressed.aac",
+		"audio_download_123456",
+	} {
+		assert.True(t, tempFilePattern.MatchString(name), name)
+	}
+
+	for _, name := range []string{
+		"original.wav",
+		"abc_original.wav",
+		testTempTrackID + "_notes.txt",
+		testTempTrackID + "_original",
+		"audio_download_",
+		"systemd-private-abc",
+	} {
+		assert.False(t, tempFilePattern.MatchString(name), name)
+	}
+}
+
+func TestSweepTempDir(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	p := NewProcessingService(nil, nil, nil, nil, dir)
+	p.now = func() time.Time { return now }
+
+	write := func(name string, age time.Duration) {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte("data"), 0o600))
+		require.NoError(t, os.Chtimes(path, now.Add(-age), now.Add(-age)))
+	}
+	write(testTempTrackID+"_original.wav", 7*time.Hour)
+	write(testTempTrackID+"_"+testTempVersionID+"_compressed.ogg", 24*time.Hour)
+	write("audio_download_42", 8*time.Hour)
+	write(testTempTrackID+"_compressed.mp3", time.Hour) // A run that may still be going
+	write("someone-elses.wav", 48*time.Hour)
+
+	removed, err := p.SweepTempDir(6 * time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 3, removed)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var left []string
+	for _, entry := range entries {
+		left = append(left, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{testTempTrackID + "_compressed.mp3", "someone-elses.wav"}, left)
+
+	used, err := p.tempDirUsage()
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), used)
+}
+
+func TestCheckTempSpace(t *testing.T) {
+	storage := &fakeObjectStorage{objects: map[string]string{"tracks/original/abc.wav": "0123456789"}}
+
+	tests := []struct {
+		name    string
+		object  string
+		free    int64
+		freeErr error
+		wantErr bool
+	}{
+		{"enough space", "tracks/original/abc.wav", 30, nil, false},
+		{"too little space", "tracks/original/abc.wav", 29, nil, true},
+		{"free space unknown", "tracks/original/abc.wav", 0, errors.New("statfs failed"), false},
+		{"object size unknown", "tracks/original/missing.wav", 0, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProcessingService(nil, nil, nil, nil, t.TempDir(), WithTempSpaceFactor(3))
+			p.diskFree = func(string) (int64, error) { return tt.free, tt.freeErr }
+
+			err := p.checkTempSpace(context.Background(), storage, tt.object)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInsufficientDiskSpace)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestProcessTrackRetriesWhenTempDirFull(t *testing.T) {
+	storage := &fakeObjectStorage{objects: map[string]string{"tracks/original/abc.wav": "audio bytes"}}
+	p := NewProcessingService(NewNostrTrackService(nil, NewStorageRegions("us", storage)), nil, nil, nil, t.TempDir())
+	p.diskFree = func(string) (int64, error) { return 1, nil }
+
+	run := newProcessingRun("abc", models.ProcessingTriggerWebhook)
+	run.canRetry = true
+	err := p.processTrack(context.Background(), &models.NostrTrack{ID: "abc", Extension: "wav"}, run)
+
+	// Nothing is downloaded, and the job tries again later
+	assert.ErrorIs(t, err, errRetryProcessing)
+	assert.Equal(t, models.ProcessingErrorDiskSpace, run.attempt.ErrorClass)
+	assert.Contains(t, run.attempt.Error, "insufficient disk space")
+	assert.Empty(t, storage.reads)
+}
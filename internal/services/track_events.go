@@ -0,0 +1,113 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/wavlake/api/internal/models"
+)
+
+// trackEventBuffer is how many events a subscriber can fall behind before the
+// oldest are dropped
+const trackEventBuffer = 16
+
+// TrackEventHub fans track events out to in-process subscribers keyed by track
+// ID. Events only reach subscribers on the instance that made the change, so
+// streams should also re-read the track periodically. Each event is numbered,
+// and the latest progress event of a running track is kept for streams that
+// reconnect.
+type TrackEventHub struct {
+	mu          sync.Mutex
+	seq         uint64
+	subscribers map[string]map[chan models.TrackEvent]struct{}
+	progress    map[string]models.TrackEvent
+}
+
+func NewTrackEventHub() *TrackEventHub {
+	return &TrackEventHub{
+		subscribers: make(map[string]map[chan models.TrackEvent]struct{}),
+		progress:    make(map[string]models.TrackEvent),
+	}
+}
+
+// Subscribe returns a channel of events for a track and a function that ends
+// the subscription. The channel is never closed.
+func (h *TrackEventHub) Subscribe(trackID string) (<-chan models.TrackEvent, func()) {
+	ch := make(chan models.TrackEvent, trackEventBuffer)
+
+	h.mu.Lock()
+	if h.subscribers[trackID] == nil {
+		h.subscribers[trackID] = make(map[chan models.TrackEvent]struct{})
+	}
+	h.subscribers[trackID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			delete(h.subscribers[trackID], ch)
+			if len(h.subscribers[trackID]) == 0 {
+				delete(h.subscribers, trackID)
+			}
+		})
+	}
+}
+
+// Publish sends an event to the track's subscribers without blocking. A
+// subscriber whose buffer is full loses its oldest event.
+func (h *TrackEventHub) Publish(event models.TrackEvent) {
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	event.ID = h.seq
+	switch event.Type {
+	case models.TrackEventProgress:
+		h.progress[event.TrackID] = event
+	case models.TrackEventStatus:
+		// Progress only describes the run; a new status ends it
+		delete(h.progress, event.TrackID)
+	}
+
+	for ch := range h.subscribers[event.TrackID] {
+		select {
+		case ch <- event:
+			continue
+		default:
+		}
+		// Only Publish sends, and it holds the lock, so this can't block
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- event
+	}
+}
+
+// LatestProgress returns the last progress event published for a track
+// whose processing run hasn't finished
+func (h *TrackEventHub) LatestProgress(trackID string) (models.TrackEvent, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	event, ok := h.progress[trackID]
+	return event, ok
+}
+
+// EndRun drops a track's progress once its processing run finishes
+func (h *TrackEventHub) EndRun(trackID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.progress, trackID)
+}
+
+// hasSubscribers reports whether anyone is listening to a track
+func (h *TrackEventHub) hasSubscribers(trackID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers[trackID]) > 0
+}
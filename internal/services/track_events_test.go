@@ -0,0 +1,77 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/models"
+)
+
+func TestTrackEventHubDeliversPerTrack(t *testing.T) {
+	hub := NewTrackEventHub()
+	events, unsubscribe := hub.Subscribe("track-1")
+	other, unsubscribeOther := hub.Subscribe("track-2")
+	defer unsubscribeOther()
+
+	hub.Publish(models.TrackEvent{Type: models.TrackEventStatus, TrackID: "track-1", Status: models.TrackStatusProcessing})
+
+	require.Len(t, events, 1)
+	event := <-events
+	assert.Equal(t, models.TrackStatusProcessing, event.Status)
+	assert.False(t, event.At.IsZero())
+	assert.Empty(t, other)
+
+	unsubscribe()
+	unsubscribe()
+	assert.False(t, hub.hasSubscribers("track-1"))
+	assert.True(t, hub.hasSubscribers("track-2"))
+
+	// Publishing with nobody listening is a no-op
+	hub.Publish(models.TrackEvent{Type: models.TrackEventStatus, TrackID: "track-1"})
+	assert.Empty(t, events)
+}
+
+func TestTrackEventHubDropsOldestWhenFull(t *testing.T) {
+	hub := NewTrackEventHub()
+	events, unsubscribe := hub.Subscribe("track-1")
+	defer unsubscribe()
+
+	for i := 0; i < trackEventBuffer+3; i++ {
+		hub.Publish(models.TrackEvent{Type: models.TrackEventProgress, TrackID: "track-1", Stage: string(rune('a' + i))})
+	}
+
+	require.Len(t, events, trackEventBuffer)
+	assert.Equal(t, "d", (<-events).Stage)
+
+	var last models.TrackEvent
+	for len(events) > 0 {
+		last = <-events
+	}
+	assert.Equal(t, string(rune('a'+trackEventBuffer+2)), last.Stage)
+}
+
+func TestTrackEventHubKeepsLatestProgress(t *testing.T) {
+	hub := NewTrackEventHub()
+
+	// Progress is kept even with nobody listening, for streams that reconnect
+	hub.Publish(models.TrackEvent{Type: models.TrackEventProgress, TrackID: "track-1", Stage: models.ProcessingStageDownloading, Percent: 10})
+	hub.Publish(models.TrackEvent{Type: models.TrackEventProgress, TrackID: "track-1", Stage: models.ProcessingStageDownloading, Percent: 20})
+	hub.Publish(models.TrackEvent{Type: models.TrackEventProgress, TrackID: "track-2", Stage: models.ProcessingStageCompressing})
+
+	latest, ok := hub.LatestProgress("track-1")
+	require.True(t, ok)
+	assert.Equal(t, 20, latest.Percent)
+	assert.Equal(t, uint64(2), latest.ID)
+
+	events, unsubscribe := hub.Subscribe("track-1")
+	defer unsubscribe()
+	hub.Publish(models.TrackEvent{Type: models.TrackEventStatus, TrackID: "track-1", Status: models.TrackStatusReady})
+	assert.Equal(t, uint64(4), (<-events).ID, "IDs increase across tracks")
+	_, ok = hub.LatestProgress("track-1")
+	assert.False(t, ok, "a status ends the run")
+
+	hub.EndRun("track-2")
+	_, ok = hub.LatestProgress("track-2")
+	assert.False(t, ok)
+}
@@ -0,0 +1,334 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/utils"
+)
+
+const (
+	// DefaultImportMaxBytes caps the size of an imported source file
+	DefaultImportMaxBytes = 500 << 20
+
+	// importTimeout bounds the whole remote download
+	importTimeout = 15 * time.Minute
+)
+
+// Import error classes recorded on the track when an import fails
+const (
+	ImportErrorSourceUnreachable = "source_unreachable"
+	ImportErrorSourceHTTP        = "source_http_error"
+	ImportErrorContentType       = "unsupported_content_type"
+	ImportErrorTooLarge          = "file_too_large"
+	ImportErrorStorage           = "storage_error"
+)
+
+var (
+	// ErrImportHostNotAllowed is returned for source URLs outside the allowlist
+	ErrImportHostNotAllowed = errors.New("source host is not allowed")
+	// ErrImportInvalidURL is returned for malformed or non-https source URLs
+	ErrImportInvalidURL = errors.New("source URL must be an absolute https URL")
+)
+
+// importError carries the error class recorded on a failed import
+type importError struct {
+	class string
+	err   error
+}
+
+func (e *importError) Error() string {
+	return fmt.Sprintf("%s: %v", e.class, e.err)
+}
+
+func (e *importError) Unwrap() error {
+	return e.err
+}
+
+// TrackImportService creates tracks from files hosted elsewhere. The remote file
+// is streamed into the originals path, where the storage trigger starts normal
+// processing exactly as it does for browser uploads.
+type TrackImportService struct {
+	nostrTrackService *NostrTrackService
+	audioProcessor    *utils.AudioProcessor
+	pathConfig        *utils.StoragePathConfig
+	allowedHosts      []string
+	maxBytes          int64
+	httpClient        *http.Client
+}
+
+// NewTrackImportService creates an import service. Allowed hosts come from
+// TRACK_IMPORT_ALLOWED_HOSTS (comma-separated; "*.example.com" matches
+// subdomains). With no hosts configured every import is rejected.
+func NewTrackImportService(nostrTrackService *NostrTrackService, audioProcessor *utils.AudioProcessor) *TrackImportService {
+	var allowedHosts []string
+	for _, host := range strings.Split(os.Getenv("TRACK_IMPORT_ALLOWED_HOSTS"), ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			allowedHosts = append(allowedHosts, host)
+		}
+	}
+
+	return &TrackImportService{
+		nostrTrackService: nostrTrackService,
+		audioProcessor:    audioProcessor,
+		pathConfig:        utils.GetStoragePathConfig(),
+		allowedHosts:      allowedHosts,
+		maxBytes:          DefaultImportMaxBytes,
+		httpClient:        newImportHTTPClient(),
+	}
+}
+
+// newImportHTTPClient returns a client that refuses to connect to private,
+// loopback or link-local addresses, so an allowed hostname can't be pointed at
+// internal services
+func newImportHTTPClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("refusing to connect to non-public address %s", host)
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Transport: transport,
+		// Redirects must stay on https; hosts are re-checked by the dialer
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "https" {
+				return ErrImportInvalidURL
+			}
+			return nil
+		},
+	}
+}
+
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast())
+}
+
+// ValidateSourceURL checks the scheme and host of a source URL and returns the
+// audio extension to store it under. An explicit extension takes precedence
+// over the one in the URL path.
+func (s *TrackImportService) ValidateSourceURL(rawURL, extension string) (*url.URL, string, error) {
+	sourceURL, err := url.Parse(rawURL)
+	if err != nil || sourceURL.Scheme != "https" || sourceURL.Host == "" || sourceURL.User != nil {
+		return nil, "", ErrImportInvalidURL
+	}
+
+	if !s.isHostAllowed(sourceURL.Hostname()) {
+		return nil, "", ErrImportHostNotAllowed
+	}
+
+	if extension == "" {
+		extension = path.Ext(sourceURL.Path)
+	}
+	extension = strings.ToLower(strings.TrimPrefix(extension, "."))
+	if extension == "" || !s.audioProcessor.IsFormatSupported(extension) {
+		return nil, "", fmt.Errorf("unsupported audio format")
+	}
+
+	return sourceURL, extension, nil
+}
+
+func (s *TrackImportService) isHostAllowed(host string) bool {
+	host = strings.ToLower(host)
+	for _, allowed := range s.allowedHosts {
+		if strings.HasPrefix(allowed, "*.") {
+			if strings.HasSuffix(host, allowed[1:]) {
+				return true
+			}
+			continue
+		}
+		if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// ChooseRegion picks the storage region for an imported track
+func (s *TrackImportService) ChooseRegion(hint, country string) (string, error) {
+	return s.nostrTrackService.ChooseRegion(hint, country)
+}
+
+// ImportTrack creates the track record in the given storage region and starts
+// the download in the background. The returned track is still processing.
+func (s *TrackImportService) ImportTrack(ctx context.Context, pubkey, firebaseUID string, sourceURL *url.URL, extension, region string, metadata map[string]string) (*models.NostrTrack, error) {
+	track, err := s.nostrTrackService.CreateTrack(ctx, pubkey, firebaseUID, extension, region, "")
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{
+		"source_url": sourceURL.String(),
+	}
+	if len(metadata) > 0 {
+		updates["metadata"] = metadata
+		for path, value := range searchFieldUpdates(metadata["title"], metadata["artist"]) {
+			updates[path] = value
+		}
+	}
+	if err := s.nostrTrackService.UpdateTrack(ctx, track.ID, updates); err != nil {
+		return nil, err
+	}
+
+	track.SourceURL = sourceURL.String()
+	track.Metadata = metadata
+	track.Title, _ = updates["title"].(string)
+	track.Artist, _ = updates["artist"].(string)
+	// Imports never upload from the client
+	track.PresignedURL = ""
+	track.UploadHeaders = nil
+	track.MaxUploadBytes = 0
+
+	go s.download(track.ID, sourceURL, extension, s.nostrTrackService.StorageFor(track))
+
+	log.Printf("Started import of track %s from %s", track.ID, sourceURL.Host)
+	return track, nil
+}
+
+// download streams the source file into storage, cleaning up and marking the
+// track failed if anything goes wrong
+func (s *TrackImportService) download(trackID string, sourceURL *url.URL, extension string, storageService StorageServiceInterface) {
+	ctx, cancel := context.WithTimeout(context.Background(), importTimeout)
+	defer cancel()
+
+	objectName := s.pathConfig.GetOriginalPath(trackID, extension)
+	err := s.streamToStorage(ctx, storageService, sourceURL, objectName)
+	if err == nil {
+		log.Printf("Imported track %s into %s", trackID, objectName)
+		if err := s.nostrTrackService.TransitionTrack(ctx, trackID, models.TrackStatusUploaded, nil); err != nil {
+			log.Printf("Failed to mark import of track %s uploaded: %v", trackID, err)
+		}
+		return
+	}
+
+	class := ImportErrorStorage
+	var ie *importError
+	if errors.As(err, &ie) {
+		class = ie.class
+	}
+	log.Printf("Import of track %s failed (%s): %v", trackID, class, err)
+
+	// Use a fresh context: the download context may be what failed
+	cleanupCtx, cleanupCancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cleanupCancel()
+
+	if err := storageService.DeleteObject(cleanupCtx, objectName); err != nil {
+		log.Printf("No partial import object removed for track %s: %v", trackID, err)
+	}
+
+	if err := s.nostrTrackService.TransitionTrack(cleanupCtx, trackID, models.TrackStatusFailed, map[string]interface{}{
+		"error": "import failed: " + class,
+	}); err != nil {
+		log.Printf("Failed to mark import of track %s failed: %v", trackID, err)
+	}
+}
+
+func (s *TrackImportService) streamToStorage(ctx context.Context, storageService StorageServiceInterface, sourceURL *url.URL, objectName string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL.String(), nil)
+	if err != nil {
+		return &importError{class: ImportErrorSourceUnreachable, err: err}
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return &importError{class: ImportErrorSourceUnreachable, err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &importError{class: ImportErrorSourceHTTP, err: fmt.Errorf("source returned status %d", resp.StatusCode)}
+	}
+
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !strings.HasPrefix(contentType, "audio/") && contentType != "application/octet-stream" {
+		return &importError{class: ImportErrorContentType, err: fmt.Errorf("content type %q is not audio", contentType)}
+	}
+	if contentType == "application/octet-stream" {
+		contentType = ""
+	}
+
+	if resp.ContentLength > s.maxBytes {
+		return &importError{class: ImportErrorTooLarge, err: fmt.Errorf("source is %d bytes, limit is %d", resp.ContentLength, s.maxBytes)}
+	}
+
+	// Cancelling the upload context on a read error stops the storage writer
+	// from committing a truncated object
+	uploadCtx, cancelUpload := context.WithCancel(ctx)
+	defer cancelUpload()
+
+	body := &limitedImportReader{r: resp.Body, remaining: s.maxBytes, cancel: cancelUpload}
+	if err := storageService.UploadObject(uploadCtx, objectName, body, contentType); err != nil {
+		if body.err != nil {
+			return body.err
+		}
+		return &importError{class: ImportErrorStorage, err: err}
+	}
+
+	return nil
+}
+
+// limitedImportReader enforces the size limit while streaming and records why
+// a read failed so the error class survives the storage layer's wrapping
+type limitedImportReader struct {
+	r         io.Reader
+	remaining int64
+	cancel    context.CancelFunc
+	err       error
+}
+
+func (l *limitedImportReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// Probe for one more byte to tell "exactly at the limit" from "over it"
+		var probe [1]byte
+		if n, _ := l.r.Read(probe[:]); n > 0 {
+			return 0, l.fail(&importError{class: ImportErrorTooLarge, err: errors.New("source exceeds size limit")})
+		}
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if err != nil && err != io.EOF {
+		return n, l.fail(&importError{class: ImportErrorSourceUnreachable, err: err})
+	}
+	return n, err
+}
+
+func (l *limitedImportReader) fail(err error) error {
+	l.err = err
+	l.cancel()
+	return err
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/wavlake/api/internal/logging"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/utils"
+)
+
+// DefaultMaxTrackDuration is the longest original processing accepts unless
+// WithMaxTrackDuration says otherwise
+const DefaultMaxTrackDuration = 2 * time.Hour
+
+// WithMaxTrackDuration sets the longest original processing accepts; longer
+// ones fail before compression
+func WithMaxTrackDuration(duration time.Duration) ProcessingOption {
+	return func(p *ProcessingService) {
+		if duration > 0 {
+			p.maxTrackDuration = duration
+		}
+	}
+}
+
+// originalSizeLimit reports an original in storage larger than upload URLs
+// accept. Storage enforces the limit at upload, except on providers that
+// can't sign it, so this catches those before the download. A size that
+// can't be read is left to the download.
+func (p *ProcessingService) originalSizeLimit(ctx context.Context, storageService StorageServiceInterface, objectName string) *models.TrackLimitExceeded {
+	maxBytes := p.nostrTrackService.maxUploadBytes
+	if maxBytes <= 0 {
+		return nil
+	}
+	size, err := storageService.GetObjectSize(ctx, objectName)
+	if err != nil || size <= maxBytes {
+		return nil
+	}
+	return &models.TrackLimitExceeded{Limit: models.TrackLimitSize, Max: maxBytes, Actual: size}
+}
+
+// durationLimit reports an original longer than maxTrackDuration
+func (p *ProcessingService) durationLimit(info *utils.AudioInfo) *models.TrackLimitExceeded {
+	maxSeconds := int64(p.maxTrackDuration / time.Second)
+	if info == nil || maxSeconds <= 0 || int64(info.Duration) <= maxSeconds {
+		return nil
+	}
+	return &models.TrackLimitExceeded{Limit: models.TrackLimitDuration, Max: maxSeconds, Actual: int64(info.Duration)}
+}
+
+// markLimitExceeded fails a run whose original broke a limit. The original
+// won't change on a retry, so the track is marked failed with the limit and
+// measured value for its owner to see.
+func (p *ProcessingService) markLimitExceeded(ctx context.Context, run *processingRun, exceeded *models.TrackLimitExceeded) error {
+	if runCancelled(ctx) {
+		return p.cancelRun(ctx, run)
+	}
+
+	errorClass, errorMsg := models.ProcessingErrorTooLarge, fmt.Sprintf("file too large: %d bytes, the limit is %d", exceeded.Actual, exceeded.Max)
+	if exceeded.Limit == models.TrackLimitDuration {
+		errorClass = models.ProcessingErrorTooLong
+		errorMsg = fmt.Sprintf("track too long: %s, the limit is %s",
+			time.Duration(exceeded.Actual)*time.Second, time.Duration(exceeded.Max)*time.Second)
+	}
+	run.fail(errorClass, errorMsg)
+
+	logging.FromContext(ctx).Warn("processing failed, original exceeds a limit", "track_id", run.trackID,
+		"limit", exceeded.Limit, "max", exceeded.Max, "actual", exceeded.Actual)
+	return p.failTrackWith(ctx, run.trackID, errorClass, errorMsg, map[string]interface{}{
+		"limit_exceeded": exceeded,
+	})
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/utils"
+)
+
+func TestOriginalSizeLimit(t *testing.T) {
+	storage := &fakeObjectStorage{objects: map[string]string{
+		"tracks/original/small.flac": "12345",
+		"tracks/original/big.flac":   "1234567890",
+	}}
+	p := NewProcessingService(NewNostrTrackService(nil, NewStorageRegions("us", storage), WithMaxUploadBytes(8)), nil, nil, nil, t.TempDir())
+
+	assert.Nil(t, p.originalSizeLimit(context.Background(), storage, "tracks/original/small.flac"))
+	assert.Equal(t, &models.TrackLimitExceeded{Limit: models.TrackLimitSize, Max: 8, Actual: 10},
+		p.originalSizeLimit(context.Background(), storage, "tracks/original/big.flac"))
+	// A size that can't be read is left to the download
+	assert.Nil(t, p.originalSizeLimit(context.Background(), storage, "tracks/original/missing.flac"))
+}
+
+func TestDurationLimit(t *testing.T) {
+	p := NewProcessingService(nil, nil, nil, nil, t.TempDir(), WithMaxTrackDuration(time.Hour))
+
+	assert.Nil(t, p.durationLimit(nil), "unknown durations pass")
+	assert.Nil(t, p.durationLimit(&utils.AudioInfo{Duration: 3600}))
+	assert.Equal(t, &models.TrackLimitExceeded{Limit: models.TrackLimitDuration, Max: 3600, Actual: 6 * 3600},
+		p.durationLimit(&utils.AudioInfo{Duration: 6 * 3600}))
+
+	assert.Equal(t, DefaultMaxTrackDuration, NewProcessingService(nil, nil, nil, nil, t.TempDir(), WithMaxTrackDuration(0)).maxTrackDuration)
+}
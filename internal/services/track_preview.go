@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultPreviewLength is how long preview clips run
+const DefaultPreviewLength = 30 * time.Second
+
+// WithPreviewLength sets how long preview clips run
+func WithPreviewLength(length time.Duration) ProcessingOption {
+	return func(p *ProcessingService) {
+		if length > 0 {
+			p.previewLength = length
+		}
+	}
+}
+
+// previewWindow picks where a track's preview starts and how long it runs:
+// from 10% into the track, moved back if the clip would run past the end.
+// Tracks no longer than the clip are previewed whole, which a zero length
+// means. An unknown duration starts the clip at the beginning.
+func previewWindow(duration, length time.Duration) (time.Duration, time.Duration) {
+	if duration <= 0 {
+		return 0, length
+	}
+	if duration <= length {
+		return 0, 0
+	}
+	start := duration / 10
+	if start+length > duration {
+		start = duration - length
+	}
+	return start, length
+}
+
+// uploadPreview cuts a track's preview clip and uploads it, returning the
+// public URL. duration is the track's length in seconds, or 0 if unknown.
+func (p *ProcessingService) uploadPreview(ctx context.Context, storageService StorageServiceInterface, trackID, audioPath string, duration int) (string, error) {
+	previewPath := filepath.Join(p.tempDir, fmt.Sprintf("%s_preview.mp3", trackID))
+	defer func() {
+		_ = os.Remove(previewPath) // #nosec G104 -- Cleanup operation, errors not critical
+	}()
+
+	start, length := previewWindow(time.Duration(duration)*time.Second, p.previewLength)
+	if err := p.audioProcessor.CreatePreview(ctx, audioPath, previewPath, start, length); err != nil {
+		return "", err
+	}
+	previewFile, err := os.Open(previewPath) // #nosec G304 -- Opening controlled temp file for upload
+	if err != nil {
+		return "", fmt.Errorf("failed to open preview: %w", err)
+	}
+	defer previewFile.Close()
+
+	objectName := p.pathConfig.GetPreviewPath(trackID)
+	if err := storageService.UploadObject(ctx, objectName, previewFile, "audio/mpeg"); err != nil {
+		return "", fmt.Errorf("failed to upload preview: %w", err)
+	}
+	return storageService.GetPublicURL(objectName), nil
+}
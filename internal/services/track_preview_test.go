@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// previewAudio records the clip it was asked for and writes fixed bytes, or
+// fails with err
+type previewAudio struct {
+	AudioProcessorInterface
+	start, length time.Duration
+	err           error
+}
+
+func (a *previewAudio) CreatePreview(ctx context.Context, inputPath, outputPath string, start, length time.Duration) error {
+	if a.err != nil {
+		return a.err
+	}
+	a.start, a.length = start, length
+	return os.WriteFile(outputPath, []byte("preview bytes"), 0o600)
+}
+
+func TestPreviewWindow(t *testing.T) {
+	tests := []struct {
+		name          string
+		duration      time.Duration
+		start, length time.Duration
+	}{
+		{"starts 10% in", 5 * time.Minute, 30 * time.Second, 30 * time.Second},
+		{"moved back to fit", 32 * time.Second, 2 * time.Second, 30 * time.Second},
+		{"short track played whole", 20 * time.Second, 0, 0},
+		{"exactly the clip length", 30 * time.Second, 0, 0},
+		{"unknown duration", 0, 0, 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, length := previewWindow(tt.duration, 30*time.Second)
+			assert.Equal(t, tt.start, start)
+			assert.Equal(t, tt.length, length)
+		})
+	}
+}
+
+func TestUploadPreview(t *testing.T) {
+	storage := &fakeObjectStorage{}
+	audio := &previewAudio{}
+	p := NewProcessingService(nil, audio, nil, nil, t.TempDir(), WithPreviewLength(15*time.Second))
+
+	url, err := p.uploadPreview(context.Background(), storage, "abc", "abc_original.wav", 200)
+	require.NoError(t, err)
+
+	assert.Equal(t, "https://storage.example.com/tracks/preview/abc.mp3", url)
+	assert.Equal(t, "preview bytes", storage.objects["tracks/preview/abc.mp3"])
+	assert.Equal(t, 20*time.Second, audio.start)
+	assert.Equal(t, 15*time.Second, audio.length)
+
+	p = NewProcessingService(nil, &previewAudio{err: errors.New("encode failed")}, nil, nil, t.TempDir())
+	_, err = p.uploadPreview(context.Background(), storage, "def", "def_original.wav", 200)
+	assert.ErrorContains(t, err, "encode failed")
+}
@@ -0,0 +1,374 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+	gonostr "github.com/nbd-wtf/go-nostr"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/pkg/nostr"
+)
+
+// maxPublicationRelays bounds the relay list stored on a track
+const maxPublicationRelays = 20
+
+var (
+	ErrPublicationInvalidEvent     = apierror.New(http.StatusBadRequest, "track.publication_invalid_event", "event ID or signature is invalid")
+	ErrPublicationPubkeyMismatch   = apierror.New(http.StatusForbidden, "track.publication_pubkey_mismatch", "event pubkey does not match track owner")
+	ErrPublicationNoTrackURL       = apierror.New(http.StatusBadRequest, "track.publication_no_track_url", "event does not reference any of the track's files")
+	ErrPublicationForeignURL       = apierror.New(http.StatusBadRequest, "track.publication_foreign_url", "event references a URL that does not belong to this track")
+	ErrPublicationInvalidRelayList = apierror.New(http.StatusBadRequest, "track.publication_invalid_relays", "relays must be a list of up to 20 ws:// or wss:// URLs")
+	ErrPublicationPrivateURL       = apierror.New(http.StatusBadRequest, "track.publication_private_url", "event references a version that is not public")
+	ErrNoPublicVersions            = apierror.New(http.StatusConflict, "track.no_public_versions", "track has no public versions to publish")
+	ErrRelayPublishingDisabled     = apierror.New(http.StatusServiceUnavailable, "track.relay_publishing_disabled", "relay publishing is not configured")
+	ErrInvalidNostrEventID         = apierror.New(http.StatusBadRequest, "track.invalid_nostr_event_id", "event_id must be 64 hex characters")
+	ErrInvalidNostrKind            = apierror.New(http.StatusBadRequest, "track.invalid_nostr_kind", "kind must be an addressable kind (30000-39999)")
+	ErrInvalidNostrDTag            = apierror.New(http.StatusBadRequest, "track.invalid_d_tag", "d_tag must be 1 to 256 characters")
+	ErrNostrDTagInUse              = apierror.New(http.StatusConflict, "track.d_tag_in_use", "d_tag is already used by another of this pubkey's tracks")
+)
+
+// maxNostrDTagLength bounds a client-chosen d tag
+const maxNostrDTagLength = 256
+
+// NostrRef identifies the event a client published for a track. An empty DTag
+// keeps the track's current one.
+type NostrRef struct {
+	EventID string
+	Kind    int
+	DTag    string
+	Relays  []string
+}
+
+// WithRelayPublisher enables PublishToRelays; without it the service only
+// records events clients published themselves
+func WithRelayPublisher(publisher RelayPublisher) NostrTrackOption {
+	return func(s *NostrTrackService) {
+		s.relayPublisher = publisher
+	}
+}
+
+// ValidatePublication checks that a client-reported event was signed by the
+// track owner and that every media URL it references is one of the track's
+// compressed versions
+func ValidatePublication(track *models.NostrTrack, event *gonostr.Event, relays []string) error {
+	if err := validateEventOwner(track, event); err != nil {
+		return err
+	}
+
+	if err := validateRelays(relays); err != nil {
+		return err
+	}
+
+	trackURLs := trackMediaURLs(track)
+	return validateEventURLs(event, trackURLs, trackURLs)
+}
+
+// ValidateRelayPublication checks an event the server is asked to publish:
+// it must be signed by the track owner and reference only the track's public
+// versions
+func ValidateRelayPublication(track *models.NostrTrack, event *gonostr.Event) error {
+	if err := validateEventOwner(track, event); err != nil {
+		return err
+	}
+
+	public := map[string]bool{}
+	for _, version := range track.CompressionVersions {
+		if version.Available() {
+			public[version.URL] = true
+		}
+	}
+	return validateEventURLs(event, public, trackMediaURLs(track))
+}
+
+func validateEventOwner(track *models.NostrTrack, event *gonostr.Event) error {
+	if event.GetID() != event.ID {
+		return ErrPublicationInvalidEvent
+	}
+	if ok, err := event.CheckSignature(); err != nil || !ok {
+		return ErrPublicationInvalidEvent
+	}
+
+	if event.PubKey != track.Pubkey {
+		return ErrPublicationPubkeyMismatch
+	}
+	return nil
+}
+
+// trackMediaURLs returns every file URL an event for the track may reference
+func trackMediaURLs(track *models.NostrTrack) map[string]bool {
+	trackURLs := map[string]bool{}
+	if track.CompressedURL != "" {
+		trackURLs[track.CompressedURL] = true
+	}
+	for _, version := range track.CompressionVersions {
+		trackURLs[version.URL] = true
+	}
+	return trackURLs
+}
+
+// validateEventURLs checks that the event references at least one media URL
+// and only allowed ones. A URL that is the track's but not allowed fails with
+// ErrPublicationPrivateURL.
+func validateEventURLs(event *gonostr.Event, allowed, trackURLs map[string]bool) error {
+	referenced := eventMediaURLs(event)
+	if len(referenced) == 0 {
+		return ErrPublicationNoTrackURL
+	}
+	for _, mediaURL := range referenced {
+		if allowed[mediaURL] {
+			continue
+		}
+		if trackURLs[mediaURL] {
+			return ErrPublicationPrivateURL.WithMessage(ErrPublicationPrivateURL.Message + ": " + mediaURL)
+		}
+		return ErrPublicationForeignURL.WithMessage(ErrPublicationForeignURL.Message + ": " + mediaURL)
+	}
+	return nil
+}
+
+// PublishToRelays sends an event that passed ValidateRelayPublication to the
+// configured relays and stores each relay's answer on the track. If any relay
+// accepted it, the publication is recorded as by RecordPublication with the
+// accepting relays; otherwise only the answers are stored.
+func (s *NostrTrackService) PublishToRelays(ctx context.Context, trackID string, event *gonostr.Event) (*models.NostrTrack, []models.RelayPublishResult, error) {
+	if s.relayPublisher == nil {
+		return nil, nil, ErrRelayPublishingDisabled
+	}
+
+	results := make([]models.RelayPublishResult, 0)
+	accepted := make([]string, 0)
+	for _, result := range s.relayPublisher.Publish(ctx, event) {
+		results = append(results, models.RelayPublishResult{Relay: result.Relay, Accepted: result.Accepted, Message: result.Message})
+		if result.Accepted {
+			accepted = append(accepted, result.Relay)
+		}
+	}
+
+	updates := map[string]interface{}{"relay_results": results}
+	if len(accepted) > 0 {
+		updates = publicationUpdates(event, accepted, time.Now())
+		updates["relay_results"] = results
+	}
+	if err := s.UpdateTrack(ctx, trackID, updates); err != nil {
+		return nil, results, err
+	}
+
+	track, err := s.GetTrack(ctx, trackID)
+	if err != nil {
+		return nil, results, err
+	}
+	return track, results, nil
+}
+
+// eventMediaURLs collects the media URLs an event points at: url, media and
+// stream tags plus the url field of NIP-92 imeta tags
+func eventMediaURLs(event *gonostr.Event) []string {
+	var urls []string
+	for _, tag := range event.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "url", "media", "stream":
+			urls = append(urls, tag[1])
+		case "imeta":
+			for _, entry := range tag[1:] {
+				if value, ok := strings.CutPrefix(entry, "url "); ok {
+					urls = append(urls, value)
+				}
+			}
+		}
+	}
+	return urls
+}
+
+// eventTagValue returns the value of the first tag with one of the given
+// names, trying the names in order
+func eventTagValue(event *gonostr.Event, names ...string) string {
+	for _, name := range names {
+		if tag := event.Tags.GetFirst([]string{name, ""}); tag != nil && len(*tag) >= 2 {
+			return (*tag)[1]
+		}
+	}
+	return ""
+}
+
+func validateRelays(relays []string) error {
+	if len(relays) > maxPublicationRelays {
+		return ErrPublicationInvalidRelayList
+	}
+	for _, relay := range relays {
+		if nostr.ValidateRelayURL(relay) != nil {
+			return ErrPublicationInvalidRelayList
+		}
+	}
+	return nil
+}
+
+// BuildNostrEventDraft returns an unsigned event publishing the track's public
+// versions, for the owner to sign. A track without a d tag gets one generated
+// and stored, so every draft for it addresses the same event.
+func (s *NostrTrackService) BuildNostrEventDraft(ctx context.Context, track *models.NostrTrack) (*gonostr.Event, error) {
+	if !hasPublicVersion(track) {
+		return nil, ErrNoPublicVersions
+	}
+
+	dTag, err := s.ensureNostrDTag(ctx, track.ID)
+	if err != nil {
+		return nil, err
+	}
+	return nostrEventDraft(track, dTag, time.Now()), nil
+}
+
+// ensureNostrDTag returns the track's d tag, storing a new UUID first if it
+// has none
+func (s *NostrTrackService) ensureNostrDTag(ctx context.Context, trackID string) (string, error) {
+	var dTag string
+	err := s.updateTrackWithPrecondition(ctx, trackID, func(track *models.NostrTrack) ([]firestore.Update, error) {
+		if track.NostrDTag != "" {
+			dTag = track.NostrDTag
+			return nil, nil
+		}
+		dTag = uuid.New().String()
+		return []firestore.Update{{Path: "nostr_d_tag", Value: dTag}}, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return dTag, nil
+}
+
+func hasPublicVersion(track *models.NostrTrack) bool {
+	for _, version := range track.CompressionVersions {
+		if version.Available() {
+			return true
+		}
+	}
+	return false
+}
+
+// nostrEventDraft builds the track's event: an imeta tag per public version
+// plus its title and artist. The kind defaults to nostr.KindMusicTrack.
+func nostrEventDraft(track *models.NostrTrack, dTag string, createdAt time.Time) *gonostr.Event {
+	kind := track.NostrKind
+	if kind == 0 {
+		kind = nostr.KindMusicTrack
+	}
+
+	builder := nostr.NewEventBuilder(kind).
+		DTag(dTag).
+		Title(track.Title).
+		Artist(track.Artist)
+	for _, version := range track.CompressionVersions {
+		if !version.Available() {
+			continue
+		}
+		builder.AudioFile(nostr.AudioFile{
+			URL:          version.URL,
+			MimeType:     getContentTypeForFormat(version.Format),
+			Size:         version.Size,
+			Duration:     track.Duration,
+			Hash:         version.Hash,
+			OriginalHash: track.OriginalHash,
+		})
+	}
+	return builder.Draft(createdAt)
+}
+
+// ValidateNostrDTag checks a client-chosen d tag
+func ValidateNostrDTag(dTag string) error {
+	if dTag == "" || len(dTag) > maxNostrDTagLength || strings.TrimSpace(dTag) != dTag {
+		return ErrInvalidNostrDTag
+	}
+	return nil
+}
+
+// SetNostrRef records the event a client published for a track, without the
+// event itself. The d tag must not be used by any other track of the same
+// pubkey, since relays would treat both as one replaceable event.
+func (s *NostrTrackService) SetNostrRef(ctx context.Context, trackID string, ref NostrRef) (*models.NostrTrack, error) {
+	eventID := strings.ToLower(ref.EventID)
+	if !gonostr.IsValid32ByteHex(eventID) {
+		return nil, ErrInvalidNostrEventID
+	}
+	if !gonostr.IsAddressableKind(ref.Kind) {
+		return nil, ErrInvalidNostrKind
+	}
+	if ref.DTag != "" {
+		if err := ValidateNostrDTag(ref.DTag); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateRelays(ref.Relays); err != nil {
+		return nil, err
+	}
+	relays := ref.Relays
+	if relays == nil {
+		relays = []string{}
+	}
+
+	trackRef := s.firestoreClient.Collection("nostr_tracks").Doc(trackID)
+	err := s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		track, err := getTrackTx(tx, trackRef)
+		if err != nil {
+			return err
+		}
+
+		dTag := ref.DTag
+		if dTag == "" {
+			dTag = track.NostrDTag
+		}
+		if dTag == "" {
+			return ErrInvalidNostrDTag
+		}
+		if dTag != track.NostrDTag {
+			if err := s.checkNostrDTagUnusedTx(ctx, tx, track.Pubkey, dTag, trackID); err != nil {
+				return err
+			}
+		}
+
+		return tx.Update(trackRef, []firestore.Update{
+			{Path: "is_published", Value: true},
+			{Path: "nostr_event_id", Value: eventID},
+			{Path: "nostr_kind", Value: ref.Kind},
+			{Path: "nostr_d_tag", Value: dTag},
+			{Path: "nostr_relays", Value: relays},
+			{Path: "published_at", Value: time.Now()},
+			{Path: "updated_at", Value: time.Now()},
+		})
+	})
+	if err != nil {
+		if isPreconditionConflict(err) {
+			return nil, ErrTrackUpdateConflict
+		}
+		return nil, err
+	}
+
+	return s.GetTrack(ctx, trackID)
+}
+
+// checkNostrDTagUnusedTx returns ErrNostrDTagInUse if a track of pubkey other
+// than exceptID has dTag. Deleted tracks keep theirs, since they can be
+// restored.
+func (s *NostrTrackService) checkNostrDTagUnusedTx(ctx context.Context, tx *firestore.Transaction, pubkey, dTag, exceptID string) error {
+	query := s.firestoreClient.Collection("nostr_tracks").
+		Where("pubkey", "==", pubkey).
+		Where("nostr_d_tag", "==", dTag).
+		Limit(2)
+	docs, err := tx.Documents(query).GetAll()
+	if err != nil {
+		return fmt.Errorf("failed to check d tag: %w", err)
+	}
+	for _, doc := range docs {
+		if doc.Ref.ID != exceptID {
+			return ErrNostrDTagInUse
+		}
+	}
+	return nil
+}
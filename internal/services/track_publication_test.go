@@ -0,0 +1,310 @@
+package services
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+	gonostr "github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/pkg/nostr"
+)
+
+func signedTrackEvent(t *testing.T, sk string, tags gonostr.Tags) *gonostr.Event {
+	event := &gonostr.Event{
+		Kind:      31337,
+		CreatedAt: gonostr.Now(),
+		Tags:      tags,
+		Content:   "",
+	}
+	require.NoError(t, event.Sign(sk))
+	return event
+}
+
+func TestValidatePublication(t *testing.T) {
+	sk := gonostr.GeneratePrivateKey()
+	pk, err := gonostr.GetPublicKey(sk)
+	require.NoError(t, err)
+
+	track := &models.NostrTrack{
+		ID:            "track-1",
+		Pubkey:        pk,
+		CompressedURL: "https://storage.googleapis.com/bucket/tracks/compressed/track-1.mp3",
+		CompressionVersions: []models.CompressionVersion{
+			{ID: "v1", URL: "https://storage.googleapis.com/bucket/tracks/compressed/track-1_v1.ogg"},
+		},
+	}
+	relays := []string{"wss://relay.wavlake.com"}
+
+	t.Run("valid event", func(t *testing.T) {
+		event := signedTrackEvent(t, sk, gonostr.Tags{
+			{"d", "track-1"},
+			{"url", track.CompressedURL},
+			{"imeta", "url " + track.CompressionVersions[0].URL, "m audio/ogg"},
+		})
+		assert.NoError(t, ValidatePublication(track, event, relays))
+	})
+
+	t.Run("tampered event", func(t *testing.T) {
+		event := signedTrackEvent(t, sk, gonostr.Tags{{"url", track.CompressedURL}})
+		event.Content = "changed after signing"
+		assert.ErrorIs(t, ValidatePublication(track, event, relays), ErrPublicationInvalidEvent)
+	})
+
+	t.Run("other signer", func(t *testing.T) {
+		event := signedTrackEvent(t, gonostr.GeneratePrivateKey(), gonostr.Tags{{"url", track.CompressedURL}})
+		assert.ErrorIs(t, ValidatePublication(track, event, relays), ErrPublicationPubkeyMismatch)
+	})
+
+	t.Run("foreign url", func(t *testing.T) {
+		event := signedTrackEvent(t, sk, gonostr.Tags{
+			{"url", track.CompressedURL},
+			{"media", "https://example.com/other.mp3"},
+		})
+		assert.ErrorIs(t, ValidatePublication(track, event, relays), ErrPublicationForeignURL)
+	})
+
+	t.Run("no track url", func(t *testing.T) {
+		event := signedTrackEvent(t, sk, gonostr.Tags{{"d", "track-1"}})
+		assert.ErrorIs(t, ValidatePublication(track, event, relays), ErrPublicationNoTrackURL)
+	})
+
+	t.Run("invalid relays", func(t *testing.T) {
+		event := signedTrackEvent(t, sk, gonostr.Tags{{"url", track.CompressedURL}})
+		assert.ErrorIs(t, ValidatePublication(track, event, []string{"https://relay.example.com"}), ErrPublicationInvalidRelayList)
+	})
+}
+
+func TestNostrEventDraft(t *testing.T) {
+	track := &models.NostrTrack{
+		ID:           "track-1",
+		Title:        "Song",
+		Artist:       "Band",
+		Duration:     200,
+		OriginalHash: "def",
+		CompressionVersions: []models.CompressionVersion{
+			{ID: "v1", URL: "https://cdn.example.com/track-1_v1.mp3", Format: "mp3", Size: 4096, IsPublic: true, Hash: "abc"},
+			{ID: "v2", URL: "https://cdn.example.com/track-1_v2.ogg", Format: "ogg", Size: 2048},
+			{ID: "v3", URL: "https://cdn.example.com/track-1_v3.aac", Format: "aac", Size: 1024, IsPublic: true},
+		},
+	}
+
+	event := nostrEventDraft(track, "d-1", time.Unix(1700000000, 0))
+	assert.Equal(t, 31337, event.Kind)
+	assert.Equal(t, gonostr.Tags{
+		{"d", "d-1"},
+		{"title", "Song"},
+		{"artist", "Band"},
+		{"imeta", "url https://cdn.example.com/track-1_v1.mp3", "m audio/mpeg", "size 4096", "duration 200", "x abc", "ox def"},
+		{"imeta", "url https://cdn.example.com/track-1_v3.aac", "m audio/aac", "size 1024", "duration 200", "ox def"},
+	}, event.Tags)
+
+	// The draft, once signed by the owner, passes publication checks
+	sk := gonostr.GeneratePrivateKey()
+	track.Pubkey, _ = gonostr.GetPublicKey(sk)
+	require.NoError(t, event.Sign(sk))
+	assert.NoError(t, ValidatePublication(track, event, nil))
+
+	track.NostrKind = 31338
+	assert.Equal(t, 31338, nostrEventDraft(track, "d-1", time.Now()).Kind)
+}
+
+func TestBuildNostrEventDraftNeedsPublicVersion(t *testing.T) {
+	service := NewNostrTrackService(nil, nil)
+	_, err := service.BuildNostrEventDraft(context.Background(), &models.NostrTrack{ID: "track-1"})
+	assert.ErrorIs(t, err, ErrNoPublicVersions)
+}
+
+func TestEnsureNostrDTag(t *testing.T) {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST not set, skipping emulator tests")
+	}
+
+	ctx := context.Background()
+	client, err := firestore.NewClient(ctx, "wavlake-test")
+	require.NoError(t, err)
+	defer client.Close()
+
+	service := NewNostrTrackService(client, nil)
+	trackID := uuid.New().String()
+	_, err = client.Collection("nostr_tracks").Doc(trackID).Set(ctx, models.NostrTrack{ID: trackID, Pubkey: "test-pubkey"})
+	require.NoError(t, err)
+
+	dTag, err := service.ensureNostrDTag(ctx, trackID)
+	require.NoError(t, err)
+	assert.NotEmpty(t, dTag)
+
+	// The generated tag is stored and reused
+	again, err := service.ensureNostrDTag(ctx, trackID)
+	require.NoError(t, err)
+	assert.Equal(t, dTag, again)
+	track, err := service.GetTrack(ctx, trackID)
+	require.NoError(t, err)
+	assert.Equal(t, dTag, track.NostrDTag)
+}
+
+func TestValidateRelayPublication(t *testing.T) {
+	sk := gonostr.GeneratePrivateKey()
+	pk, err := gonostr.GetPublicKey(sk)
+	require.NoError(t, err)
+
+	track := &models.NostrTrack{
+		ID:     "track-1",
+		Pubkey: pk,
+		CompressionVersions: []models.CompressionVersion{
+			{ID: "v1", URL: "https://cdn.example.com/track-1_v1.mp3", IsPublic: true},
+			{ID: "v2", URL: "https://cdn.example.com/track-1_v2.ogg"},
+		},
+	}
+
+	event := signedTrackEvent(t, sk, gonostr.Tags{{"imeta", "url " + track.CompressionVersions[0].URL}})
+	assert.NoError(t, ValidateRelayPublication(track, event))
+
+	// Client-reported publications may name private versions; the server won't publish them
+	event = signedTrackEvent(t, sk, gonostr.Tags{{"url", track.CompressionVersions[0].URL}, {"url", track.CompressionVersions[1].URL}})
+	assert.NoError(t, ValidatePublication(track, event, nil))
+	assert.ErrorIs(t, ValidateRelayPublication(track, event), ErrPublicationPrivateURL)
+
+	event = signedTrackEvent(t, sk, gonostr.Tags{{"url", "https://example.com/other.mp3"}})
+	assert.ErrorIs(t, ValidateRelayPublication(track, event), ErrPublicationForeignURL)
+
+	event = signedTrackEvent(t, gonostr.GeneratePrivateKey(), gonostr.Tags{{"url", track.CompressionVersions[0].URL}})
+	assert.ErrorIs(t, ValidateRelayPublication(track, event), ErrPublicationPubkeyMismatch)
+}
+
+// fakeRelayPublisher answers every publish with fixed results
+type fakeRelayPublisher struct {
+	results []nostr.RelayResult
+}
+
+func (f *fakeRelayPublisher) Publish(ctx context.Context, event *gonostr.Event) []nostr.RelayResult {
+	return f.results
+}
+
+func TestPublishToRelaysNeedsPublisher(t *testing.T) {
+	service := NewNostrTrackService(nil, nil)
+	_, _, err := service.PublishToRelays(context.Background(), "track-1", &gonostr.Event{})
+	assert.ErrorIs(t, err, ErrRelayPublishingDisabled)
+}
+
+func TestPublishToRelays(t *testing.T) {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST not set, skipping emulator tests")
+	}
+
+	ctx := context.Background()
+	client, err := firestore.NewClient(ctx, "wavlake-test")
+	require.NoError(t, err)
+	defer client.Close()
+
+	publisher := &fakeRelayPublisher{results: []nostr.RelayResult{
+		{Relay: "wss://down.example.com", Message: "connect failed: refused"},
+		{Relay: "wss://relay.wavlake.com", Accepted: true},
+	}}
+	service := NewNostrTrackService(client, nil, WithRelayPublisher(publisher))
+	trackID := uuid.New().String()
+	_, err = client.Collection("nostr_tracks").Doc(trackID).Set(ctx, models.NostrTrack{ID: trackID, Pubkey: "test-pubkey"})
+	require.NoError(t, err)
+
+	event := signedTrackEvent(t, gonostr.GeneratePrivateKey(), gonostr.Tags{{"d", "d-1"}, {"title", "Song"}})
+	track, results, err := service.PublishToRelays(ctx, trackID, event)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.False(t, results[0].Accepted)
+	assert.Equal(t, "connect failed: refused", results[0].Message)
+	assert.True(t, track.IsPublished)
+	assert.Equal(t, event.ID, track.NostrEventID)
+	assert.Equal(t, []string{"wss://relay.wavlake.com"}, track.NostrRelays)
+	assert.Equal(t, results, track.RelayResults)
+
+	// When every relay refuses, only the answers are stored
+	otherID := uuid.New().String()
+	_, err = client.Collection("nostr_tracks").Doc(otherID).Set(ctx, models.NostrTrack{ID: otherID, Pubkey: "test-pubkey"})
+	require.NoError(t, err)
+	publisher.results = []nostr.RelayResult{{Relay: "wss://relay.wavlake.com", Message: "blocked: not allowed"}}
+	track, _, err = service.PublishToRelays(ctx, otherID, event)
+	require.NoError(t, err)
+	assert.False(t, track.IsPublished)
+	assert.Empty(t, track.NostrEventID)
+	require.Len(t, track.RelayResults, 1)
+	assert.Equal(t, "blocked: not allowed", track.RelayResults[0].Message)
+}
+
+func TestValidateNostrDTag(t *testing.T) {
+	assert.NoError(t, ValidateNostrDTag("my-song"))
+	assert.NoError(t, ValidateNostrDTag(strings.Repeat("a", maxNostrDTagLength)))
+
+	for _, dTag := range []string{"", " padded", "padded\n", strings.Repeat("a", maxNostrDTagLength+1)} {
+		assert.ErrorIs(t, ValidateNostrDTag(dTag), ErrInvalidNostrDTag, dTag)
+	}
+}
+
+func TestSetNostrRefValidation(t *testing.T) {
+	service := NewNostrTrackService(nil, nil)
+	valid := NostrRef{EventID: strings.Repeat("a", 64), Kind: nostr.KindMusicTrack, DTag: "d-1"}
+
+	tests := []struct {
+		name   string
+		modify func(ref *NostrRef)
+		want   error
+	}{
+		{"short event ID", func(ref *NostrRef) { ref.EventID = "abc" }, ErrInvalidNostrEventID},
+		{"non-hex event ID", func(ref *NostrRef) { ref.EventID = strings.Repeat("z", 64) }, ErrInvalidNostrEventID},
+		{"regular kind", func(ref *NostrRef) { ref.Kind = 1 }, ErrInvalidNostrKind},
+		{"blank d tag", func(ref *NostrRef) { ref.DTag = " " }, ErrInvalidNostrDTag},
+		{"bad relay", func(ref *NostrRef) { ref.Relays = []string{"https://relay.wavlake.com"} }, ErrPublicationInvalidRelayList},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref := valid
+			tt.modify(&ref)
+			_, err := service.SetNostrRef(context.Background(), "track-1", ref)
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
+
+func TestSetNostrRef(t *testing.T) {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST not set, skipping emulator tests")
+	}
+
+	ctx := context.Background()
+	client, err := firestore.NewClient(ctx, "wavlake-test")
+	require.NoError(t, err)
+	defer client.Close()
+
+	service := NewNostrTrackService(client, nil)
+	pubkey := uuid.New().String()
+	trackID, otherID := uuid.New().String(), uuid.New().String()
+	_, err = client.Collection("nostr_tracks").Doc(trackID).Set(ctx, models.NostrTrack{ID: trackID, Pubkey: pubkey, NostrDTag: "generated"})
+	require.NoError(t, err)
+	_, err = client.Collection("nostr_tracks").Doc(otherID).Set(ctx, models.NostrTrack{ID: otherID, Pubkey: pubkey, NostrDTag: "taken"})
+	require.NoError(t, err)
+
+	eventID := strings.Repeat("ab", 32)
+	track, err := service.SetNostrRef(ctx, trackID, NostrRef{EventID: strings.ToUpper(eventID), Kind: nostr.KindMusicTrack, Relays: []string{"wss://relay.wavlake.com"}})
+	require.NoError(t, err)
+	assert.True(t, track.IsPublished)
+	assert.Equal(t, eventID, track.NostrEventID)
+	assert.Equal(t, nostr.KindMusicTrack, track.NostrKind)
+	assert.Equal(t, "generated", track.NostrDTag, "an empty d_tag keeps the track's")
+	assert.Equal(t, []string{"wss://relay.wavlake.com"}, track.NostrRelays)
+
+	_, err = service.SetNostrRef(ctx, trackID, NostrRef{EventID: eventID, Kind: nostr.KindMusicTrack, DTag: "taken"})
+	assert.ErrorIs(t, err, ErrNostrDTagInUse)
+
+	// Another pubkey may use the same d tag
+	_, err = client.Collection("nostr_tracks").Doc(otherID).Update(ctx, []firestore.Update{{Path: "pubkey", Value: "someone-else"}})
+	require.NoError(t, err)
+	track, err = service.SetNostrRef(ctx, trackID, NostrRef{EventID: eventID, Kind: nostr.KindMusicTrack, DTag: "taken"})
+	require.NoError(t, err)
+	assert.Equal(t, "taken", track.NostrDTag)
+}
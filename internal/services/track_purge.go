@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/models"
+)
+
+const (
+	// purgeDeleteAttempts is how many times a purge tries each object
+	purgeDeleteAttempts = 3
+
+	// purgeRetryDelay is the wait before the first retry, doubling after it
+	purgeRetryDelay = 250 * time.Millisecond
+)
+
+// ErrTrackPurged is returned when restoring a track whose files were purged
+var ErrTrackPurged = apierror.New(http.StatusConflict, "track.purged", "track files were purged")
+
+// trackObjectNames returns the storage objects holding a track's files: the
+// original, the legacy compressed file, the waveform, the preview, the artwork
+// and every compression version
+func (s *NostrTrackService) trackObjectNames(track *models.NostrTrack) []string {
+	names := map[string]bool{
+		s.pathConfig.GetOriginalPath(track.ID, track.Extension): true,
+		s.pathConfig.GetCompressedPath(track.ID):                true,
+	}
+	if track.WaveformURL != "" {
+		names[s.pathConfig.GetWaveformPath(track.ID)] = true
+	}
+	if track.PreviewURL != "" {
+		names[s.pathConfig.GetPreviewPath(track.ID)] = true
+	}
+	if track.ArtworkURL != "" {
+		names[s.pathConfig.GetArtworkPath(track.ID)] = true
+	}
+	for _, version := range track.CompressionVersions {
+		if version.ID == defaultVersionID {
+			continue
+		}
+		names[s.pathConfig.GetCompressedVersionPath(track.ID, version.ID, version.Format)] = true
+	}
+
+	objectNames := make([]string, 0, len(names))
+	for name := range names {
+		objectNames = append(objectNames, name)
+	}
+	sort.Strings(objectNames)
+	return objectNames
+}
+
+// purgeObjectNames returns trackObjectNames plus any version files in
+// storage the track has no record of, such as uploads from compressions that
+// died before saving their version. A failed listing is logged and the
+// recorded names are used alone.
+func (s *NostrTrackService) purgeObjectNames(ctx context.Context, track *models.NostrTrack) []string {
+	objectNames := s.trackObjectNames(track)
+	listed, err := s.StorageFor(track).ListObjects(ctx, s.pathConfig.GetCompressedVersionPrefix(track.ID))
+	if err != nil {
+		log.Printf("Failed to list version files for track %s: %v", track.ID, err)
+		return objectNames
+	}
+	for _, name := range listed {
+		if !slices.Contains(objectNames, name) {
+			objectNames = append(objectNames, name)
+		}
+	}
+	sort.Strings(objectNames)
+	return objectNames
+}
+
+// PurgeTrackFiles deletes a track's files from its storage region. Objects
+// that fail to delete are retried and then reported in Failed rather than
+// stopping the purge. With dryRun nothing is deleted and the result lists the
+// objects a purge would remove. A purge that removes every object records
+// files_purged_at, after which the track can't be restored.
+func (s *NostrTrackService) PurgeTrackFiles(ctx context.Context, track *models.NostrTrack, dryRun bool) (*models.TrackPurge, error) {
+	purge := &models.TrackPurge{
+		DryRun:  dryRun,
+		Objects: s.purgeObjectNames(ctx, track),
+	}
+	if dryRun {
+		return purge, nil
+	}
+
+	if remaining := s.deleteTrackObjects(ctx, track, purge.Objects); len(remaining) > 0 {
+		purge.Failed = remaining
+		log.Printf("Purged track %s with %d of %d objects left behind", track.ID, len(remaining), len(purge.Objects))
+		return purge, nil
+	}
+
+	now := time.Now()
+	_, err := s.firestoreClient.Collection("nostr_tracks").Doc(track.ID).Update(ctx, []firestore.Update{
+		{Path: "files_purged_at", Value: now},
+		{Path: "updated_at", Value: now},
+	})
+	if err != nil {
+		return purge, fmt.Errorf("failed to record purge: %w", err)
+	}
+
+	log.Printf("Purged %d objects for track %s", len(purge.Objects), track.ID)
+	return purge, nil
+}
+
+// deleteTrackObjects deletes objects from a track's storage region, retrying
+// failures with backoff, and returns the objects that are still there
+func (s *NostrTrackService) deleteTrackObjects(ctx context.Context, track *models.NostrTrack, objectNames []string) []string {
+	storageService := s.StorageFor(track)
+	remaining := objectNames
+	delay := purgeRetryDelay
+retry:
+	for attempt := 1; attempt <= purgeDeleteAttempts && len(remaining) > 0; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				break retry
+			case <-time.After(delay):
+				delay *= 2
+			}
+		}
+
+		var failedNames []string
+		for objectName, err := range storageService.DeleteObjects(ctx, remaining) {
+			log.Printf("Failed to delete %s for track %s (attempt %d/%d): %v", objectName, track.ID, attempt, purgeDeleteAttempts, err)
+			failedNames = append(failedNames, objectName)
+		}
+		remaining = failedNames
+	}
+
+	sort.Strings(remaining)
+	return remaining
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/models"
+)
+
+// deletingStorage deletes objects from memory. Objects in failures fail that
+// many more deletes first.
+type deletingStorage struct {
+	StorageServiceInterface
+	objects  map[string]bool
+	failures map[string]int
+	batches  [][]string
+}
+
+func (s *deletingStorage) DeleteObjects(ctx context.Context, objectNames []string) map[string]error {
+	s.batches = append(s.batches, append([]string(nil), objectNames...))
+
+	failed := map[string]error{}
+	for _, objectName := range objectNames {
+		if s.failures[objectName] > 0 {
+			s.failures[objectName]--
+			failed[objectName] = errors.New("backend unavailable")
+			continue
+		}
+		delete(s.objects, objectName)
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return failed
+}
+
+func (s *deletingStorage) GetObjectMetadata(ctx context.Context, objectName string) (interface{}, error) {
+	if !s.objects[objectName] {
+		return nil, storage.ErrObjectNotExist
+	}
+	return objectName, nil
+}
+
+func (s *deletingStorage) ListObjects(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	for objectName := range s.objects {
+		if strings.HasPrefix(objectName, prefix) {
+			names = append(names, objectName)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func purgeTestTrack() *models.NostrTrack {
+	return &models.NostrTrack{
+		ID:        "abc",
+		Extension: "wav",
+		CompressionVersions: []models.CompressionVersion{
+			{ID: defaultVersionID, Format: "mp3"},
+			{ID: "v1", Format: "ogg"},
+			{ID: "v2", Format: "aac"},
+		},
+	}
+}
+
+func TestTrackObjectNames(t *testing.T) {
+	s := NewNostrTrackService(nil, nil)
+
+	assert.Equal(t, []string{
+		"tracks/compressed/abc.mp3",
+		"tracks/compressed/abc_v1.ogg",
+		"tracks/compressed/abc_v2.aac",
+		"tracks/original/abc.wav",
+	}, s.trackObjectNames(purgeTestTrack()))
+
+	// Only tracks that got a waveform, preview or artwork have them to delete
+	track := purgeTestTrack()
+	track.WaveformURL = "https://storage.googleapis.com/wavlake/tracks/waveform/abc.json"
+	track.PreviewURL = "https://storage.googleapis.com/wavlake/tracks/preview/abc.mp3"
+	track.ArtworkURL = "https://storage.googleapis.com/wavlake/tracks/artwork/abc.jpg"
+	assert.Contains(t, s.trackObjectNames(track), "tracks/waveform/abc.json")
+	assert.Contains(t, s.trackObjectNames(track), "tracks/preview/abc.mp3")
+	assert.Contains(t, s.trackObjectNames(track), "tracks/artwork/abc.jpg")
+}
+
+func TestPurgeTrackFiles_DryRun(t *testing.T) {
+	storage := &deletingStorage{}
+	s := NewNostrTrackService(nil, NewStorageRegions("us", storage))
+
+	purge, err := s.PurgeTrackFiles(context.Background(), purgeTestTrack(), true)
+	require.NoError(t, err)
+
+	assert.True(t, purge.DryRun)
+	assert.Len(t, purge.Objects, 4)
+	assert.Empty(t, purge.Failed)
+	assert.Empty(t, storage.batches)
+}
+
+func TestPurgeTrackFiles_FindsUnrecordedVersions(t *testing.T) {
+	storage := &deletingStorage{objects: map[string]bool{
+		"tracks/compressed/abc_v1.ogg":     true,
+		"tracks/compressed/abc_orphan.mp3": true,
+		"tracks/compressed/abcd_v1.mp3":    true,
+	}}
+	s := NewNostrTrackService(nil, NewStorageRegions("us", storage))
+
+	purge, err := s.PurgeTrackFiles(context.Background(), purgeTestTrack(), true)
+	require.NoError(t, err)
+
+	// The orphaned version is found; another track sharing the ID's prefix isn't
+	assert.Equal(t, []string{
+		"tracks/compressed/abc.mp3",
+		"tracks/compressed/abc_orphan.mp3",
+		"tracks/compressed/abc_v1.ogg",
+		"tracks/compressed/abc_v2.aac",
+		"tracks/original/abc.wav",
+	}, purge.Objects)
+}
+
+func TestDeleteTrackObjects_RetriesFailures(t *testing.T) {
+	storage := &deletingStorage{
+		objects:  map[string]bool{"a": true, "b": true, "c": true},
+		failures: map[string]int{"b": 1, "c": purgeDeleteAttempts},
+	}
+	s := NewNostrTrackService(nil, NewStorageRegions("us", storage))
+
+	remaining := s.deleteTrackObjects(context.Background(), &models.NostrTrack{ID: "abc"}, []string{"a", "b", "c"})
+
+	// b succeeds on its retry; c never does, and doesn't stop a or b
+	assert.Equal(t, []string{"c"}, remaining)
+	assert.Equal(t, map[string]bool{"c": true}, storage.objects)
+	require.Len(t, storage.batches, purgeDeleteAttempts)
+	assert.Equal(t, []string{"c"}, storage.batches[2])
+}
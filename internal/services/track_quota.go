@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/wavlake/api/internal/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrQuotaExceeded is matched by errors.Is when a user is at one of their limits
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaExceededError reports which limit a user reached and their usage
+type QuotaExceededError struct {
+	Limit string // "tracks" or "bytes"
+	Usage models.StorageUsage
+	Quota models.TrackQuota
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%v: %s limit reached", ErrQuotaExceeded, e.Limit)
+}
+
+func (e *QuotaExceededError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// WithTrackQuota limits each user's non-deleted tracks and original bytes
+func WithTrackQuota(quota models.TrackQuota) NostrTrackOption {
+	return func(s *NostrTrackService) {
+		s.quota = quota
+	}
+}
+
+// TrackQuotaFromEnv reads TRACK_QUOTA_MAX_TRACKS and TRACK_QUOTA_MAX_BYTES.
+// Unset or zero values are unlimited.
+func TrackQuotaFromEnv() (models.TrackQuota, error) {
+	var quota models.TrackQuota
+	if raw := os.Getenv("TRACK_QUOTA_MAX_TRACKS"); raw != "" {
+		maxTracks, err := strconv.Atoi(raw)
+		if err != nil || maxTracks < 0 {
+			return quota, fmt.Errorf("invalid TRACK_QUOTA_MAX_TRACKS %q", raw)
+		}
+		quota.MaxTracks = maxTracks
+	}
+	if raw := os.Getenv("TRACK_QUOTA_MAX_BYTES"); raw != "" {
+		maxBytes, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || maxBytes < 0 {
+			return quota, fmt.Errorf("invalid TRACK_QUOTA_MAX_BYTES %q", raw)
+		}
+		quota.MaxBytes = maxBytes
+	}
+	return quota, nil
+}
+
+// checkQuota fails with a QuotaExceededError if usage leaves no room for
+// another track. Bytes are only known once a track is processed, so a user
+// under the byte limit can still go over it with their last upload.
+func checkQuota(quota models.TrackQuota, usage models.StorageUsage) error {
+	if quota.MaxTracks > 0 && usage.Tracks >= quota.MaxTracks {
+		return &QuotaExceededError{Limit: "tracks", Usage: usage, Quota: quota}
+	}
+	if quota.MaxBytes > 0 && usage.Bytes >= quota.MaxBytes {
+		return &QuotaExceededError{Limit: "bytes", Usage: usage, Quota: quota}
+	}
+	return nil
+}
+
+// checkUserQuota checks a user's current usage against the quota outside a
+// transaction
+func (s *NostrTrackService) checkUserQuota(ctx context.Context, firebaseUID string) error {
+	if firebaseUID == "" || s.quota == (models.TrackQuota{}) {
+		return nil
+	}
+
+	var usage models.StorageUsage
+	err := s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		var err error
+		usage, err = s.getUsageTx(ctx, tx, firebaseUID)
+		return err
+	}, firestore.ReadOnly)
+	if err != nil {
+		return err
+	}
+	return checkQuota(s.quota, usage)
+}
+
+// addUsage applies a change to usage; counters never go below zero
+func addUsage(usage, delta models.StorageUsage) models.StorageUsage {
+	usage.Tracks = max(usage.Tracks+delta.Tracks, 0)
+	usage.Bytes = max(usage.Bytes+delta.Bytes, 0)
+	return usage
+}
+
+// getUsageTx reads a user's usage counters in a transaction. Users whose
+// counters aren't set yet get them computed from their tracks, so callers
+// must write the result back with setUsageTx.
+func (s *NostrTrackService) getUsageTx(ctx context.Context, tx *firestore.Transaction, firebaseUID string) (models.StorageUsage, error) {
+	doc, err := tx.Get(s.firestoreClient.Collection("users").Doc(firebaseUID))
+	if err != nil && status.Code(err) != codes.NotFound {
+		return models.StorageUsage{}, fmt.Errorf("failed to get user usage: %w", err)
+	}
+	if err == nil {
+		var user models.User
+		if err := doc.DataTo(&user); err != nil {
+			return models.StorageUsage{}, fmt.Errorf("failed to decode user: %w", err)
+		}
+		if user.Usage != nil {
+			return *user.Usage, nil
+		}
+	}
+
+	// Aggregation reads no track documents, so this stays cheap for large accounts
+	tracks := s.firestoreClient.Collection("nostr_tracks").
+		Where("firebase_uid", "==", firebaseUID).
+		Where("deleted", "==", false)
+	results, err := tracks.NewAggregationQuery().
+		WithCount("count").
+		WithSum("size", "bytes").
+		Transaction(tx).
+		Get(ctx)
+	if err != nil {
+		return models.StorageUsage{}, fmt.Errorf("failed to count user tracks: %w", err)
+	}
+	count, err := aggregationInt(results, "count")
+	if err != nil {
+		return models.StorageUsage{}, err
+	}
+	bytes, err := aggregationInt(results, "bytes")
+	if err != nil {
+		return models.StorageUsage{}, err
+	}
+	return models.StorageUsage{Tracks: int(count), Bytes: bytes}, nil
+}
+
+// setUsageTx stores a user's usage counters, creating the users document if
+// needed
+func (s *NostrTrackService) setUsageTx(tx *firestore.Transaction, firebaseUID string, usage models.StorageUsage) error {
+	return tx.Set(s.firestoreClient.Collection("users").Doc(firebaseUID), map[string]interface{}{
+		"usage": map[string]interface{}{
+			"tracks": usage.Tracks,
+			"bytes":  usage.Bytes,
+		},
+	}, firestore.MergeAll)
+}
+
+// GetUsage returns a user's usage and quota, initialising their counters if
+// they aren't set yet
+func (s *NostrTrackService) GetUsage(ctx context.Context, firebaseUID string) (*models.UsageReport, error) {
+	report := &models.UsageReport{Quota: s.quota}
+	err := s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		usage, err := s.getUsageTx(ctx, tx, firebaseUID)
+		if err != nil {
+			return err
+		}
+		report.Usage = usage
+		return s.setUsageTx(tx, firebaseUID, usage)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// updateTrackWithUsage updates a track and its owner's usage counters in one
+// transaction. build returns the track updates and the change to usage; a
+// change that adds a track is checked against the quota first.
+func (s *NostrTrackService) updateTrackWithUsage(ctx context.Context, trackID string, build func(track *models.NostrTrack) ([]firestore.Update, models.StorageUsage, error)) error {
+	ref := s.firestoreClient.Collection("nostr_tracks").Doc(trackID)
+
+	var track *models.NostrTrack
+	var updates []firestore.Update
+	err := s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		updates = nil
+		var err error
+		if track, err = getTrackTx(tx, ref); err != nil {
+			return err
+		}
+
+		trackUpdates, delta, err := build(track)
+		if err != nil || len(trackUpdates) == 0 {
+			return err
+		}
+
+		// Transactions need every read before the first write
+		countUsage := track.FirebaseUID != "" && delta != (models.StorageUsage{})
+		var usage models.StorageUsage
+		if countUsage {
+			if usage, err = s.getUsageTx(ctx, tx, track.FirebaseUID); err != nil {
+				return err
+			}
+			if delta.Tracks > 0 {
+				if err := checkQuota(s.quota, usage); err != nil {
+					return err
+				}
+			}
+		}
+
+		trackUpdates = append(trackUpdates, firestore.Update{Path: "updated_at", Value: time.Now()})
+		if err := tx.Update(ref, trackUpdates); err != nil {
+			return err
+		}
+		if countUsage {
+			if err := s.setUsageTx(tx, track.FirebaseUID, addUsage(usage, delta)); err != nil {
+				return err
+			}
+		}
+		updates = trackUpdates
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(updates) > 0 {
+		s.publishStatus(trackID, track, updates)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/models"
+)
+
+func TestCheckQuota(t *testing.T) {
+	quota := models.TrackQuota{MaxTracks: 2, MaxBytes: 1000}
+
+	assert.NoError(t, checkQuota(quota, models.StorageUsage{Tracks: 1, Bytes: 999}))
+	assert.NoError(t, checkQuota(models.TrackQuota{}, models.StorageUsage{Tracks: 100, Bytes: 1 << 40}), "zero limits are unlimited")
+
+	err := checkQuota(quota, models.StorageUsage{Tracks: 2, Bytes: 10})
+	var quotaErr *QuotaExceededError
+	require.True(t, errors.As(err, &quotaErr))
+	assert.Equal(t, "tracks", quotaErr.Limit)
+	assert.Equal(t, models.StorageUsage{Tracks: 2, Bytes: 10}, quotaErr.Usage)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+
+	err = checkQuota(quota, models.StorageUsage{Tracks: 1, Bytes: 1000})
+	require.True(t, errors.As(err, &quotaErr))
+	assert.Equal(t, "bytes", quotaErr.Limit)
+}
+
+func TestAddUsage(t *testing.T) {
+	usage := addUsage(models.StorageUsage{Tracks: 1, Bytes: 100}, models.StorageUsage{Tracks: 1, Bytes: 50})
+	assert.Equal(t, models.StorageUsage{Tracks: 2, Bytes: 150}, usage)
+
+	usage = addUsage(models.StorageUsage{Tracks: 1, Bytes: 100}, models.StorageUsage{Tracks: -2, Bytes: -500})
+	assert.Equal(t, models.StorageUsage{}, usage, "counters never go negative")
+}
+
+func TestTrackQuotaFromEnv(t *testing.T) {
+	t.Setenv("TRACK_QUOTA_MAX_TRACKS", "")
+	t.Setenv("TRACK_QUOTA_MAX_BYTES", "")
+	quota, err := TrackQuotaFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, models.TrackQuota{}, quota)
+
+	t.Setenv("TRACK_QUOTA_MAX_TRACKS", "50")
+	t.Setenv("TRACK_QUOTA_MAX_BYTES", "1073741824")
+	quota, err = TrackQuotaFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, models.TrackQuota{MaxTracks: 50, MaxBytes: 1 << 30}, quota)
+
+	t.Setenv("TRACK_QUOTA_MAX_TRACKS", "-1")
+	_, err = TrackQuotaFromEnv()
+	assert.Error(t, err)
+
+	t.Setenv("TRACK_QUOTA_MAX_TRACKS", "")
+	t.Setenv("TRACK_QUOTA_MAX_BYTES", "1GB")
+	_, err = TrackQuotaFromEnv()
+	assert.Error(t, err)
+}
+
+func TestTrackUsageCounters(t *testing.T) {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST not set, skipping emulator tests")
+	}
+
+	ctx := context.Background()
+	client, err := firestore.NewClient(ctx, "wavlake-test")
+	require.NoError(t, err)
+	defer client.Close()
+
+	service := NewNostrTrackService(client, nil)
+	uid := "uid-" + uuid.New().String()
+	seed := func(deleted bool, size int64) string {
+		trackID := uuid.New().String()
+		_, err := client.Collection("nostr_tracks").Doc(trackID).Set(ctx, models.NostrTrack{
+			ID:          trackID,
+			FirebaseUID: uid,
+			Pubkey:      "test-pubkey",
+			Status:      models.TrackStatusProcessing,
+			Size:        size,
+			Deleted:     deleted,
+			CreatedAt:   time.Now(),
+			UpdatedAt:   time.Now(),
+		})
+		require.NoError(t, err)
+		return trackID
+	}
+	usage := func() models.StorageUsage {
+		report, err := service.GetUsage(ctx, uid)
+		require.NoError(t, err)
+		return report.Usage
+	}
+
+	first := seed(false, 0)
+	second := seed(true, 500)
+
+	// Counters start from the user's existing non-deleted tracks
+	assert.Equal(t, models.StorageUsage{Tracks: 1}, usage())
+
+	require.NoError(t, service.MarkTrackAsProcessed(ctx, first, 1000, 60))
+	assert.Equal(t, models.StorageUsage{Tracks: 1, Bytes: 1000}, usage())
+
+	service.quota = models.TrackQuota{MaxTracks: 1}
+	err = service.RestoreTrack(ctx, second)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.Equal(t, models.StorageUsage{Tracks: 1, Bytes: 1000}, usage())
+
+	require.NoError(t, service.DeleteTrack(ctx, first))
+	assert.Equal(t, models.StorageUsage{}, usage())
+
+	require.NoError(t, service.RestoreTrack(ctx, second))
+	assert.Equal(t, models.StorageUsage{Tracks: 1, Bytes: 500}, usage())
+}
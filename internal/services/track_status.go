@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/storage"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrInvalidStatusTransition is returned when a track can't move from its
+// current status to the requested one
+var ErrInvalidStatusTransition = apierror.New(http.StatusConflict, "track.invalid_status_transition", "invalid track status transition")
+
+// ErrTrackNotDeleted is returned when restoring a track that isn't deleted
+var ErrTrackNotDeleted = apierror.New(http.StatusBadRequest, "track.not_deleted", "track is not deleted")
+
+var (
+	// ErrTrackAlreadyProcessing is returned when claiming a track another
+	// processing run already holds
+	ErrTrackAlreadyProcessing = apierror.New(http.StatusConflict, "track.already_processing", "track is already processing")
+	// ErrTrackAlreadyProcessed is returned when claiming a track that is ready
+	ErrTrackAlreadyProcessed = apierror.New(http.StatusConflict, "track.already_processed", "track is already processed")
+)
+
+// trackStatusTransitions lists the statuses each status may move to. Setting
+// a track to the status it already has is always allowed.
+var trackStatusTransitions = map[string][]string{
+	// A manual trigger can start processing before the upload trigger fires,
+	// and an external pipeline may report a result without either
+	models.TrackStatusPendingUpload: {models.TrackStatusUploaded, models.TrackStatusProcessing, models.TrackStatusReady, models.TrackStatusFailed, models.TrackStatusCancelled},
+	models.TrackStatusUploaded:      {models.TrackStatusProcessing, models.TrackStatusReady, models.TrackStatusFailed, models.TrackStatusCancelled},
+	models.TrackStatusProcessing:    {models.TrackStatusReady, models.TrackStatusFailed, models.TrackStatusCancelled},
+	models.TrackStatusReady:         {},
+	// Failed tracks can be re-uploaded or retried
+	models.TrackStatusFailed: {models.TrackStatusUploaded, models.TrackStatusProcessing, models.TrackStatusCancelled},
+	// Restoring a cancelled track waits for the upload again, or is processed
+	// again if the original was uploaded
+	models.TrackStatusCancelled: {models.TrackStatusPendingUpload, models.TrackStatusUploaded},
+}
+
+// IsValidTrackStatus reports whether status is one of the known track statuses
+func IsValidTrackStatus(status string) bool {
+	_, ok := trackStatusTransitions[status]
+	return ok
+}
+
+// IsTerminalTrackStatus reports whether a track in this status will not change
+// again without user action
+func IsTerminalTrackStatus(status string) bool {
+	switch status {
+	case models.TrackStatusReady, models.TrackStatusFailed, models.TrackStatusCancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+// CanTransitionTrack reports whether a track may move from one status to another
+func CanTransitionTrack(from, to string) bool {
+	if !IsValidTrackStatus(to) {
+		return false
+	}
+	if from == to {
+		return true
+	}
+	for _, next := range trackStatusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// statusUpdates sets the status, records when it was entered and keeps the
+// legacy is_processing flag in step
+func statusUpdates(status string, at time.Time) []firestore.Update {
+	return []firestore.Update{
+		{Path: "status", Value: status},
+		{Path: "status_timestamps." + status, Value: at},
+		{Path: "is_processing", Value: !IsTerminalTrackStatus(status)},
+	}
+}
+
+// TransitionTrack moves a track to a new status, applying any other updates in
+// the same write. It fails with ErrInvalidStatusTransition if the track's
+// current status doesn't allow the move.
+func (s *NostrTrackService) TransitionTrack(ctx context.Context, trackID, status string, updates map[string]interface{}) (err error) {
+	ctx, span := telemetry.Start(ctx, "NostrTrackService.TransitionTrack", telemetry.AttributeTrackID.String(trackID), attribute.String("wavlake.status", status))
+	defer func() { telemetry.End(span, err) }()
+
+	build := func(track *models.NostrTrack) ([]firestore.Update, error) {
+		from := track.CurrentStatus()
+		if !CanTransitionTrack(from, status) {
+			return nil, ErrInvalidStatusTransition.WithMessage(fmt.Sprintf("%s: %s to %s", ErrInvalidStatusTransition.Message, from, status))
+		}
+
+		trackUpdates := statusUpdates(status, time.Now())
+		// A processing run's tags yield to fields edited while it ran
+		for path, value := range withoutEditedTags(track, updates) {
+			if path == "updated_at" {
+				continue
+			}
+			trackUpdates = append(trackUpdates, firestore.Update{Path: path, Value: value})
+		}
+		return trackUpdates, nil
+	}
+
+	size, hasSize := updates["size"].(int64)
+	if !hasSize {
+		return s.updateTrackWithPrecondition(ctx, trackID, build)
+	}
+
+	// A new size changes the owner's byte usage
+	return s.updateTrackWithUsage(ctx, trackID, func(track *models.NostrTrack) ([]firestore.Update, models.StorageUsage, error) {
+		trackUpdates, err := build(track)
+		if err != nil || track.Deleted {
+			return trackUpdates, models.StorageUsage{}, err
+		}
+		return trackUpdates, models.StorageUsage{Bytes: size - track.Size}, nil
+	})
+}
+
+// RestoreTrack undoes a soft delete. A track whose processing was cancelled by
+// the delete goes back to uploaded if its original is in storage, for the
+// caller to process again, and to waiting for its upload otherwise. The track
+// counts toward its owner's usage again, so restoring fails with
+// ErrQuotaExceeded at the quota.
+func (s *NostrTrackService) RestoreTrack(ctx context.Context, trackID string) error {
+	return s.updateTrackWithUsage(ctx, trackID, func(track *models.NostrTrack) ([]firestore.Update, models.StorageUsage, error) {
+		if !track.Deleted {
+			return nil, models.StorageUsage{}, ErrTrackNotDeleted
+		}
+		if track.FilesPurgedAt != nil {
+			return nil, models.StorageUsage{}, ErrTrackPurged
+		}
+
+		updates := []firestore.Update{{Path: "deleted", Value: false}}
+		if track.CurrentStatus() == models.TrackStatusCancelled {
+			restoredStatus := models.TrackStatusPendingUpload
+			_, err := s.StorageFor(track).GetObjectMetadata(ctx, s.pathConfig.GetOriginalPath(trackID, track.Extension))
+			switch {
+			case err == nil:
+				restoredStatus = models.TrackStatusUploaded
+			case !errors.Is(err, storage.ErrObjectNotExist):
+				return nil, models.StorageUsage{}, fmt.Errorf("failed to check original: %w", err)
+			}
+			updates = append(updates, statusUpdates(restoredStatus, time.Now())...)
+		}
+		return updates, models.StorageUsage{Tracks: 1, Bytes: track.Size}, nil
+	})
+}
+
+// claimMode says which tracks a processing claim may take
+type claimMode int
+
+const (
+	// claimNew takes tracks waiting for processing or failed
+	claimNew claimMode = iota
+	// claimStuck also takes tracks another run holds
+	claimStuck
+	// claimForced also takes ready tracks, to process them again
+	claimForced
+)
+
+// ClaimTrackForProcessing moves a track to processing in a transaction, so
+// only one of several concurrent callers can start a processing run. It fails
+// with ErrTrackAlreadyProcessing or ErrTrackAlreadyProcessed when another run
+// got there first, and ErrInvalidStatusTransition for other statuses that
+// can't be processed.
+func (s *NostrTrackService) ClaimTrackForProcessing(ctx context.Context, trackID string) error {
+	return s.claimTrackForProcessing(ctx, trackID, claimNew)
+}
+
+// ReclaimTrackForProcessing is ClaimTrackForProcessing for tracks stuck in
+// processing: it takes the claim from a run that holds it instead of failing
+// with ErrTrackAlreadyProcessing. Ready tracks still fail with
+// ErrTrackAlreadyProcessed.
+func (s *NostrTrackService) ReclaimTrackForProcessing(ctx context.Context, trackID string) error {
+	return s.claimTrackForProcessing(ctx, trackID, claimStuck)
+}
+
+// ForceClaimTrackForProcessing is ReclaimTrackForProcessing that also claims
+// ready tracks, so a finished track can be processed again
+func (s *NostrTrackService) ForceClaimTrackForProcessing(ctx context.Context, trackID string) error {
+	return s.claimTrackForProcessing(ctx, trackID, claimForced)
+}
+
+func (s *NostrTrackService) claimTrackForProcessing(ctx context.Context, trackID string, mode claimMode) (err error) {
+	ctx, span := telemetry.Start(ctx, "NostrTrackService.ClaimTrackForProcessing", telemetry.AttributeTrackID.String(trackID),
+		attribute.Bool("wavlake.reclaim", mode >= claimStuck), attribute.Bool("wavlake.force", mode == claimForced))
+	defer func() { telemetry.End(span, err) }()
+
+	ref := s.firestoreClient.Collection("nostr_tracks").Doc(trackID)
+
+	var track models.NostrTrack
+	var updates []firestore.Update
+	err = s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return fmt.Errorf("failed to get track: %w", err)
+		}
+
+		track = models.NostrTrack{}
+		if err := doc.DataTo(&track); err != nil {
+			return fmt.Errorf("failed to decode track: %w", err)
+		}
+
+		switch from := track.CurrentStatus(); {
+		case from == models.TrackStatusProcessing && mode < claimStuck:
+			return ErrTrackAlreadyProcessing
+		case from == models.TrackStatusReady && mode < claimForced:
+			return ErrTrackAlreadyProcessed
+		case from == models.TrackStatusReady:
+			// Forced: ready has no transitions of its own
+		case !CanTransitionTrack(from, models.TrackStatusProcessing):
+			return ErrInvalidStatusTransition.WithMessage(fmt.Sprintf("%s: %s to %s", ErrInvalidStatusTransition.Message, from, models.TrackStatusProcessing))
+		}
+
+		now := time.Now()
+		updates = append(statusUpdates(models.TrackStatusProcessing, now),
+			firestore.Update{Path: "error", Value: ""},
+			firestore.Update{Path: "error_code", Value: firestore.Delete},
+			firestore.Update{Path: "limit_exceeded", Value: firestore.Delete},
+			firestore.Update{Path: "processing_attempts", Value: firestore.Delete},
+			firestore.Update{Path: "updated_at", Value: now},
+		)
+		return tx.Update(ref, updates)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.publishStatus(trackID, &track, updates)
+	return nil
+}
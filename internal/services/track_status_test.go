@@ -0,0 +1,77 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/stretchr/testify/assert"
+	"github.com/wavlake/api/internal/models"
+)
+
+func TestCanTransitionTrack(t *testing.T) {
+	tests := []struct {
+		from, to string
+		allowed  bool
+	}{
+		{models.TrackStatusPendingUpload, models.TrackStatusUploaded, true},
+		{models.TrackStatusUploaded, models.TrackStatusProcessing, true},
+		{models.TrackStatusProcessing, models.TrackStatusReady, true},
+		{models.TrackStatusProcessing, models.TrackStatusFailed, true},
+		{models.TrackStatusProcessing, models.TrackStatusCancelled, true},
+		{models.TrackStatusFailed, models.TrackStatusProcessing, true},
+		{models.TrackStatusCancelled, models.TrackStatusPendingUpload, true},
+		{models.TrackStatusProcessing, models.TrackStatusProcessing, true},
+		{models.TrackStatusReady, models.TrackStatusProcessing, false},
+		{models.TrackStatusReady, models.TrackStatusCancelled, false},
+		{models.TrackStatusCancelled, models.TrackStatusProcessing, false},
+		{models.TrackStatusProcessing, models.TrackStatusUploaded, false},
+		{models.TrackStatusUploaded, "done", false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.allowed, CanTransitionTrack(tt.from, tt.to), "%s -> %s", tt.from, tt.to)
+	}
+}
+
+func TestTrackStatusTransitionsAreKnown(t *testing.T) {
+	for from, targets := range trackStatusTransitions {
+		for _, to := range targets {
+			assert.True(t, IsValidTrackStatus(to), "%s -> %s", from, to)
+		}
+	}
+}
+
+func TestCurrentStatusDerivesLegacyTracks(t *testing.T) {
+	tests := []struct {
+		name  string
+		track models.NostrTrack
+		want  string
+	}{
+		{"stored status wins", models.NostrTrack{Status: models.TrackStatusUploaded, IsProcessing: true}, models.TrackStatusUploaded},
+		{"processing", models.NostrTrack{IsProcessing: true}, models.TrackStatusProcessing},
+		{"failed", models.NostrTrack{Error: "invalid audio file"}, models.TrackStatusFailed},
+		{"done", models.NostrTrack{IsCompressed: true}, models.TrackStatusReady},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.track.CurrentStatus())
+		})
+	}
+}
+
+func TestStatusUpdatesDeriveIsProcessing(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	for status, processing := range map[string]bool{
+		models.TrackStatusPendingUpload: true,
+		models.TrackStatusProcessing:    true,
+		models.TrackStatusReady:         false,
+		models.TrackStatusCancelled:     false,
+	} {
+		updates := statusUpdates(status, at)
+		assert.Contains(t, updates, firestore.Update{Path: "status", Value: status})
+		assert.Contains(t, updates, firestore.Update{Path: "status_timestamps." + status, Value: at})
+		assert.Contains(t, updates, firestore.Update{Path: "is_processing", Value: processing})
+	}
+}
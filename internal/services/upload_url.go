@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/wavlake/api/internal/models"
+)
+
+// uploadContentTypes maps supported extensions to the Content-Type an upload
+// should send
+var uploadContentTypes = map[string]string{
+	"mp3":  "audio/mpeg",
+	"wav":  "audio/wav",
+	"flac": "audio/flac",
+	"aac":  "audio/aac",
+	"ogg":  "audio/ogg",
+	"m4a":  "audio/mp4",
+	"wma":  "audio/x-ms-wma",
+	"aiff": "audio/aiff",
+	"au":   "audio/basic",
+}
+
+// uploadContentType returns the Content-Type for an original's extension
+func uploadContentType(extension string) string {
+	if contentType, ok := uploadContentTypes[strings.ToLower(extension)]; ok {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// uploadConstraints are what upload URLs for an original accept: its
+// extension's Content-Type, up to the configured size
+func (s *NostrTrackService) uploadConstraints(extension string) UploadConstraints {
+	return UploadConstraints{ContentType: uploadContentType(extension), MaxBytes: s.maxUploadBytes}
+}
+
+// RenewUploadURL signs a new upload URL for a track's original, for uploads
+// that outlived the URL from CreateTrack. Tracks that are processing fail with
+// ErrTrackAlreadyProcessing and ready tracks with ErrTrackAlreadyProcessed,
+// unless replace is set: then a ready track goes back to pending_upload with
+// its processing results and compression versions cleared, so the new file
+// is processed and encoded from scratch.
+func (s *NostrTrackService) RenewUploadURL(ctx context.Context, trackID string, replace bool) (*models.UploadURL, error) {
+	trackRef := s.firestoreClient.Collection("nostr_tracks").Doc(trackID)
+
+	var track models.NostrTrack
+	var updates []firestore.Update
+	err := s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		current, err := getTrackTx(tx, trackRef)
+		if err != nil {
+			return err
+		}
+		track = *current
+		updates = nil
+		if current.Deleted {
+			return ErrInvalidStatusTransition.WithMessage(ErrInvalidStatusTransition.Message + ": track is deleted")
+		}
+
+		switch from := current.CurrentStatus(); {
+		case from == models.TrackStatusProcessing:
+			return ErrTrackAlreadyProcessing
+		case from == models.TrackStatusReady && !replace:
+			return ErrTrackAlreadyProcessed
+		case from == models.TrackStatusReady:
+			versionUpdates, err := clearVersionsTx(tx, trackRef, current)
+			if err != nil {
+				return err
+			}
+			updates = append(statusUpdates(models.TrackStatusPendingUpload, time.Now()), embeddedTagResets(current)...)
+			updates = append(updates, versionUpdates...)
+			updates = append(updates,
+				firestore.Update{Path: "error", Value: ""},
+				firestore.Update{Path: "processing_attempts", Value: firestore.Delete},
+				firestore.Update{Path: "duration", Value: firestore.Delete},
+				firestore.Update{Path: "original_hash", Value: firestore.Delete},
+				firestore.Update{Path: "archived_at", Value: firestore.Delete},
+				firestore.Update{Path: "is_compressed", Value: false},
+				firestore.Update{Path: "compressed_url", Value: firestore.Delete},
+				firestore.Update{Path: "waveform_url", Value: firestore.Delete},
+				firestore.Update{Path: "preview_url", Value: firestore.Delete},
+				firestore.Update{Path: "updated_at", Value: time.Now()},
+			)
+			if err := tx.Update(trackRef, updates); err != nil {
+				return fmt.Errorf("failed to update track: %w", err)
+			}
+			return nil
+		case !CanTransitionTrack(from, models.TrackStatusUploaded):
+			return ErrInvalidStatusTransition.WithMessage(fmt.Sprintf("%s: %s to %s", ErrInvalidStatusTransition.Message, from, models.TrackStatusUploaded))
+		}
+		// Waiting for its upload already; only the URL is new
+		return nil
+	})
+	if err != nil {
+		if isPreconditionConflict(err) {
+			return nil, ErrTrackUpdateConflict
+		}
+		return nil, err
+	}
+	if len(updates) > 0 {
+		s.publishStatus(trackID, &track, updates)
+	}
+
+	objectName := s.pathConfig.GetOriginalPath(track.ID, track.Extension)
+	constraints := s.uploadConstraints(track.Extension)
+	storageService := s.StorageFor(&track)
+	url, err := storageService.GeneratePresignedURL(ctx, objectName, s.presignExpiry, constraints)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate presigned URL: %w", err)
+	}
+
+	return &models.UploadURL{
+		URL:       url,
+		Method:    http.MethodPut,
+		Headers:   storageService.UploadHeaders(constraints),
+		MaxBytes:  constraints.MaxBytes,
+		ExpiresIn: int(s.presignExpiry / time.Second),
+		ExpiresAt: time.Now().Add(s.presignExpiry),
+	}, nil
+}
+
+// embeddedTagResets clears the fields a track's embedded tags filled, so a
+// replaced file's metadata doesn't outlive it
+func embeddedTagResets(track *models.NostrTrack) []firestore.Update {
+	if len(track.EmbeddedTags) == 0 {
+		return nil
+	}
+	updates := []firestore.Update{{Path: "embedded_tags", Value: firestore.Delete}}
+	for _, field := range track.EmbeddedTags {
+		updates = append(updates, firestore.Update{Path: field, Value: firestore.Delete})
+		if field == "title" || field == "artist" {
+			updates = append(updates, firestore.Update{Path: field + "_normalized", Value: firestore.Delete})
+		}
+	}
+	return updates
+}
+
+// clearVersionsTx deletes a track's compression versions, which were encoded
+// from a file that's being replaced, and returns the track updates that go
+// with it. Left in place, they'd stay public with the old audio and be
+// reported as existing to later compression requests instead of re-encoded.
+func clearVersionsTx(tx *firestore.Transaction, trackRef *firestore.DocumentRef, track *models.NostrTrack) ([]firestore.Update, error) {
+	updates := []firestore.Update{{Path: "has_pending_compression", Value: false}}
+	if !track.VersionsMigrated {
+		return append(updates, firestore.Update{Path: "compression_versions", Value: firestore.Delete}), nil
+	}
+
+	docs, err := tx.Documents(trackRef.Collection(trackVersionsCollection)).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get track versions: %w", err)
+	}
+	for _, doc := range docs {
+		if err := tx.Delete(doc.Ref); err != nil {
+			return nil, fmt.Errorf("failed to delete track version %s: %w", doc.Ref.ID, err)
+		}
+	}
+	return updates, nil
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"cloud.google.com/go/firestore"
+	"github.com/wavlake/api/internal/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Limits on the profile fields set with UpdateUserProfile
+const (
+	MaxDisplayNameLength = 64
+	MaxAvatarURLLength   = 2048
+)
+
+var (
+	// ErrInvalidDisplayName is returned for display names that are too long or
+	// contain control characters
+	ErrInvalidDisplayName = fmt.Errorf("display_name must be at most %d characters without control characters", MaxDisplayNameLength)
+	// ErrInvalidLightningAddress is returned for lightning addresses that
+	// don't look like user@domain
+	ErrInvalidLightningAddress = errors.New("lightning_address must look like user@domain")
+	// ErrInvalidAvatarURL is returned for avatar URLs that aren't absolute
+	// https URLs
+	ErrInvalidAvatarURL = errors.New("avatar_url must be an absolute https URL")
+	// ErrEmptyProfileUpdate is returned for an update that sets no fields
+	ErrEmptyProfileUpdate = errors.New("no profile fields to update")
+)
+
+// lightningAddressPattern matches a LUD-16 lightning address, user@domain,
+// after lowercasing
+var lightningAddressPattern = regexp.MustCompile(`^[a-z0-9._+-]+@[a-z0-9-]+(\.[a-z0-9-]+)+$`)
+
+// GetOrCreateUser returns the user's users document, creating it if it
+// doesn't exist yet. Documents only hold usage counters until a pubkey is
+// linked, so those are completed too. Concurrent first calls create the
+// document once and all return it.
+func (s *UserService) GetOrCreateUser(ctx context.Context, firebaseUID string) (*models.User, error) {
+	var user models.User
+	userRef := s.firestoreClient.Collection("users").Doc(firebaseUID)
+	err := s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		var fields map[string]interface{}
+		var err error
+		if user, fields, err = getUserTx(tx, userRef, firebaseUID, time.Now()); err != nil {
+			return err
+		}
+		if fields == nil {
+			return nil
+		}
+		if err := tx.Set(userRef, fields, firestore.MergeAll); err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// UpdateUserProfile validates and applies a profile update, creating the
+// users document if needed, and returns the updated user
+func (s *UserService) UpdateUserProfile(ctx context.Context, firebaseUID string, update models.UserProfileUpdate) (*models.User, error) {
+	update, err := normalizeProfileUpdate(update)
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	userRef := s.firestoreClient.Collection("users").Doc(firebaseUID)
+	err = s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		now := time.Now()
+		var fields map[string]interface{}
+		var err error
+		if user, fields, err = getUserTx(tx, userRef, firebaseUID, now); err != nil {
+			return err
+		}
+		if fields == nil {
+			fields = map[string]interface{}{}
+		}
+
+		for _, field := range []struct {
+			name  string
+			value *string
+			dest  *string
+		}{
+			{"display_name", update.DisplayName, &user.DisplayName},
+			{"lightning_address", update.LightningAddress, &user.LightningAddress},
+			{"avatar_url", update.AvatarURL, &user.AvatarURL},
+		} {
+			if field.value == nil {
+				continue
+			}
+			*field.dest = *field.value
+			if *field.value == "" {
+				fields[field.name] = firestore.Delete
+			} else {
+				fields[field.name] = *field.value
+			}
+		}
+		if update.EmailNotificationsOptOut != nil {
+			user.EmailNotificationsOptOut = *update.EmailNotificationsOptOut
+			fields["email_notifications_opt_out"] = *update.EmailNotificationsOptOut
+		}
+		user.UpdatedAt = now
+		fields["updated_at"] = now
+
+		if err := tx.Set(userRef, fields, firestore.MergeAll); err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// getUserTx reads a users document in a transaction. A missing document, or
+// one without created_at, comes back filled in with the fields the caller must
+// merge into it; otherwise fields is nil.
+func getUserTx(tx *firestore.Transaction, userRef *firestore.DocumentRef, firebaseUID string, now time.Time) (models.User, map[string]interface{}, error) {
+	var user models.User
+	doc, err := tx.Get(userRef)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return user, nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if err == nil {
+		if err := doc.DataTo(&user); err != nil {
+			return user, nil, fmt.Errorf("failed to parse user data: %w", err)
+		}
+	}
+	if user.ActivePubkeys == nil {
+		// Unlinking the last pubkey stores an empty list as null
+		user.ActivePubkeys = []string{}
+	}
+	if !user.CreatedAt.IsZero() {
+		return user, nil, nil
+	}
+
+	user.FirebaseUID = firebaseUID
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	return user, map[string]interface{}{
+		"firebase_uid":   firebaseUID,
+		"created_at":     now,
+		"updated_at":     now,
+		"active_pubkeys": user.ActivePubkeys,
+	}, nil
+}
+
+// normalizeProfileUpdate trims the update's fields, lowercases the lightning
+// address and checks each set field
+func normalizeProfileUpdate(update models.UserProfileUpdate) (models.UserProfileUpdate, error) {
+	if update.DisplayName == nil && update.LightningAddress == nil && update.AvatarURL == nil && update.EmailNotificationsOptOut == nil {
+		return update, ErrEmptyProfileUpdate
+	}
+
+	if update.DisplayName != nil {
+		name := strings.TrimSpace(*update.DisplayName)
+		if utf8.RuneCountInString(name) > MaxDisplayNameLength || strings.ContainsFunc(name, unicode.IsControl) {
+			return update, ErrInvalidDisplayName
+		}
+		update.DisplayName = &name
+	}
+	if update.LightningAddress != nil {
+		address := strings.ToLower(strings.TrimSpace(*update.LightningAddress))
+		if address != "" && !lightningAddressPattern.MatchString(address) {
+			return update, ErrInvalidLightningAddress
+		}
+		update.LightningAddress = &address
+	}
+	if update.AvatarURL != nil {
+		rawURL := strings.TrimSpace(*update.AvatarURL)
+		if rawURL != "" {
+			avatarURL, err := url.Parse(rawURL)
+			if err != nil || avatarURL.Scheme != "https" || avatarURL.Host == "" || avatarURL.User != nil || len(rawURL) > MaxAvatarURLLength {
+				return update, ErrInvalidAvatarURL
+			}
+		}
+		update.AvatarURL = &rawURL
+	}
+
+	return update, nil
+}
@@ -2,39 +2,130 @@ package services
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
+	"net/http"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/firestore"
 	"firebase.google.com/go/v4/auth"
+	"github.com/wavlake/api/internal/apierror"
 	"github.com/wavlake/api/internal/models"
 	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// DefaultMaxActivePubkeys is how many pubkeys one account may have linked at
+// once unless configured otherwise
+const DefaultMaxActivePubkeys = 10
+
+var (
+	// ErrInvalidPubkey is returned for a pubkey that isn't 64 hex characters
+	ErrInvalidPubkey = apierror.New(http.StatusBadRequest, "user.invalid_pubkey", "pubkey must be 64 hex characters")
+	// ErrPubkeyLimitReached is returned when linking would exceed the account's
+	// active pubkey limit
+	ErrPubkeyLimitReached = apierror.New(http.StatusConflict, "user.pubkey_limit_reached", "account has reached its linked pubkey limit")
+	// ErrPubkeyNotLinked is returned for a pubkey that has never been linked to
+	// an account
+	ErrPubkeyNotLinked = apierror.New(http.StatusNotFound, "user.pubkey_not_linked", "pubkey is not linked to an account")
+	// ErrPubkeyInactive is returned for a pubkey whose link has been removed
+	ErrPubkeyInactive = apierror.New(http.StatusNotFound, "user.pubkey_inactive", "pubkey is not active")
+	// ErrPubkeyLinkedElsewhere is returned when linking a pubkey another
+	// account has an active link to
+	ErrPubkeyLinkedElsewhere = apierror.New(http.StatusConflict, "user.pubkey_linked_elsewhere", "pubkey is already linked to a different user")
+	// ErrPubkeyNotOwned is returned when unlinking another account's pubkey
+	ErrPubkeyNotOwned = apierror.New(http.StatusForbidden, "user.pubkey_not_owned", "pubkey does not belong to this user")
+	// ErrPubkeyAlreadyUnlinked is returned when unlinking an inactive link
+	ErrPubkeyAlreadyUnlinked = apierror.New(http.StatusConflict, "user.pubkey_already_unlinked", "pubkey is already unlinked")
+)
+
+// UserOption configures a UserService
+type UserOption func(*UserService)
+
+// WithMaxActivePubkeys sets how many pubkeys one account may have linked at once
+func WithMaxActivePubkeys(max int) UserOption {
+	return func(s *UserService) {
+		if max > 0 {
+			s.maxActivePubkeys = max
+		}
+	}
+}
+
 type UserService struct {
-	firestoreClient *firestore.Client
-	firebaseAuth    *auth.Client
+	firestoreClient  *firestore.Client
+	firebaseAuth     *auth.Client
+	onUnlink         []func(pubkey string)
+	maxActivePubkeys int
 }
 
-func NewUserService(firestoreClient *firestore.Client, firebaseAuth *auth.Client) *UserService {
-	return &UserService{
-		firestoreClient: firestoreClient,
-		firebaseAuth:    firebaseAuth,
+func NewUserService(firestoreClient *firestore.Client, firebaseAuth *auth.Client, opts ...UserOption) *UserService {
+	s := &UserService{
+		firestoreClient:  firestoreClient,
+		firebaseAuth:     firebaseAuth,
+		maxActivePubkeys: DefaultMaxActivePubkeys,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
-// LinkPubkeyToUser links a Nostr pubkey to a Firebase user
-func (s *UserService) LinkPubkeyToUser(ctx context.Context, pubkey, firebaseUID string) error {
-	now := time.Now()
-
-	// Check if pubkey is already linked to a different user
-	existingAuth, err := s.getNostrAuth(ctx, pubkey)
-	if err == nil && existingAuth.FirebaseUID != firebaseUID && existingAuth.Active {
-		return fmt.Errorf("pubkey is already linked to a different user")
+// LinkPubkeyToUser links a Nostr pubkey to a Firebase user and returns the
+// stored record. Linking an inactive pubkey owned by another user transfers
+// it; either way an audit event is recorded. Relinking a pubkey the user
+// already has active changes nothing and reports alreadyLinked. Hex pubkeys
+// are stored lowercased.
+func (s *UserService) LinkPubkeyToUser(ctx context.Context, pubkey, firebaseUID string) (linked *models.NostrAuth, alreadyLinked bool, err error) {
+	pubkey, err = normalizeHexPubkey(pubkey)
+	if err != nil {
+		return nil, false, err
 	}
+	// Firestore keeps microseconds, so the record returned matches the stored one
+	now := time.Now().Truncate(time.Microsecond)
 
 	// Start a transaction
 	err = s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		// Reset in case the transaction is retried
+		linked, alreadyLinked = nil, false
+
+		// Check if pubkey is already linked to a different user
+		nostrAuthRef := s.firestoreClient.Collection("nostr_auth").Doc(pubkey)
+		var existingAuth *models.NostrAuth
+		if authDoc, err := tx.Get(nostrAuthRef); err == nil {
+			existingAuth = &models.NostrAuth{}
+			if err := authDoc.DataTo(existingAuth); err != nil {
+				return fmt.Errorf("failed to parse nostr auth: %w", err)
+			}
+		} else if status.Code(err) != codes.NotFound {
+			return fmt.Errorf("failed to get nostr auth: %w", err)
+		}
+		if existingAuth != nil && existingAuth.Active {
+			if existingAuth.FirebaseUID != firebaseUID {
+				return ErrPubkeyLinkedElsewhere
+			}
+			linked, alreadyLinked = existingAuth, true
+			return nil
+		}
+
+		// Counted in the transaction so concurrent links can't pass the limit
+		activeDocs, err := tx.Documents(s.firestoreClient.Collection("nostr_auth").
+			Where("firebase_uid", "==", firebaseUID).
+			Where("active", "==", true)).GetAll()
+		if err != nil {
+			return fmt.Errorf("failed to count linked pubkeys: %w", err)
+		}
+		active := 0
+		for _, doc := range activeDocs {
+			if doc.Ref.ID != pubkey {
+				active++
+			}
+		}
+		if active >= s.maxActivePubkeys {
+			return ErrPubkeyLimitReached.WithMessage(fmt.Sprintf("%s (%d)", ErrPubkeyLimitReached.Message, s.maxActivePubkeys))
+		}
+
 		// Create or update User record
 		userRef := s.firestoreClient.Collection("users").Doc(firebaseUID)
 		userDoc, err := tx.Get(userRef)
@@ -65,45 +156,72 @@ func (s *UserService) LinkPubkeyToUser(ctx context.Context, pubkey, firebaseUID
 			return fmt.Errorf("failed to update user: %w", err)
 		}
 
-		// Create or update NostrAuth record
-		nostrAuthRef := s.firestoreClient.Collection("nostr_auth").Doc(pubkey)
-		nostrAuth := models.NostrAuth{
-			Pubkey:      pubkey,
-			FirebaseUID: firebaseUID,
-			Active:      true,
-			CreatedAt:   now,
-			LastUsedAt:  now,
-			LinkedAt:    now,
+		// Create or reactivate the NostrAuth record, keeping when it was
+		// first created
+		nostrAuth := models.NostrAuth{CreatedAt: now}
+		if existingAuth != nil {
+			nostrAuth = *existingAuth
+			if existingAuth.FirebaseUID != firebaseUID {
+				// The label was the previous owner's
+				nostrAuth.Label = ""
+			}
 		}
+		nostrAuth.Pubkey = pubkey
+		nostrAuth.FirebaseUID = firebaseUID
+		nostrAuth.Active = true
+		nostrAuth.LastUsedAt = now
+		nostrAuth.LinkedAt = now
 
 		if err := tx.Set(nostrAuthRef, nostrAuth); err != nil {
 			return fmt.Errorf("failed to create nostr auth: %w", err)
 		}
+		linked = &nostrAuth
 
-		return nil
+		event := models.NostrAuthEvent{
+			Type:           models.NostrAuthEventLink,
+			Pubkey:         pubkey,
+			NewFirebaseUID: firebaseUID,
+			CreatedAt:      now,
+		}
+		if existingAuth != nil && existingAuth.FirebaseUID != firebaseUID {
+			event.Type = models.NostrAuthEventTransfer
+			event.OldFirebaseUID = existingAuth.FirebaseUID
+		}
+		return s.recordNostrAuthEventTx(ctx, tx, event)
 	})
+	if err != nil {
+		return nil, false, err
+	}
+	return linked, alreadyLinked, nil
+}
 
-	return err
+// OnPubkeyUnlinked registers fn to be called after a pubkey is unlinked, so
+// caches keyed by pubkey can drop it. Register before serving requests.
+func (s *UserService) OnPubkeyUnlinked(fn func(pubkey string)) {
+	s.onUnlink = append(s.onUnlink, fn)
 }
 
 // UnlinkPubkeyFromUser unlinks a pubkey from a Firebase user
 func (s *UserService) UnlinkPubkeyFromUser(ctx context.Context, pubkey, firebaseUID string) error {
+	// Pubkeys are stored lowercased
+	pubkey = strings.ToLower(pubkey)
+
 	// Verify the pubkey belongs to this user
-	nostrAuth, err := s.getNostrAuth(ctx, pubkey)
+	nostrAuth, err := s.GetPubkeyLink(ctx, pubkey)
 	if err != nil {
-		return fmt.Errorf("pubkey not found")
+		return err
 	}
 
 	if nostrAuth.FirebaseUID != firebaseUID {
-		return fmt.Errorf("pubkey does not belong to this user")
+		return ErrPubkeyNotOwned
 	}
 
 	if !nostrAuth.Active {
-		return fmt.Errorf("pubkey is already unlinked")
+		return ErrPubkeyAlreadyUnlinked
 	}
 
 	// Start a transaction
-	return s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+	err = s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
 		// First, get all documents we need to read
 		userRef := s.firestoreClient.Collection("users").Doc(firebaseUID)
 		userDoc, err := tx.Get(userRef)
@@ -133,8 +251,21 @@ func (s *UserService) UnlinkPubkeyFromUser(ctx context.Context, pubkey, firebase
 			return fmt.Errorf("failed to update user: %w", err)
 		}
 
-		return nil
+		return s.recordNostrAuthEventTx(ctx, tx, models.NostrAuthEvent{
+			Type:           models.NostrAuthEventUnlink,
+			Pubkey:         pubkey,
+			OldFirebaseUID: firebaseUID,
+			CreatedAt:      user.UpdatedAt,
+		})
 	})
+	if err != nil {
+		return err
+	}
+
+	for _, fn := range s.onUnlink {
+		fn(pubkey)
+	}
+	return nil
 }
 
 // GetLinkedPubkeys returns all active pubkeys for a Firebase user
@@ -194,18 +325,76 @@ func (s *UserService) GetLinkedPubkeys(ctx context.Context, firebaseUID string)
 
 // GetFirebaseUIDByPubkey returns the Firebase UID for a given pubkey if it's linked and active
 func (s *UserService) GetFirebaseUIDByPubkey(ctx context.Context, pubkey string) (string, error) {
-	nostrAuth, err := s.getNostrAuth(ctx, pubkey)
+	nostrAuth, err := s.GetPubkeyLink(ctx, pubkey)
 	if err != nil {
-		return "", fmt.Errorf("pubkey not found: %w", err)
+		return "", err
 	}
 
 	if !nostrAuth.Active {
-		return "", fmt.Errorf("pubkey is not active")
+		return "", ErrPubkeyInactive
 	}
 
 	return nostrAuth.FirebaseUID, nil
 }
 
+// GetPubkeyLink returns the pubkey's link record whether or not it's still
+// active, or ErrPubkeyNotLinked if the pubkey was never linked
+func (s *UserService) GetPubkeyLink(ctx context.Context, pubkey string) (*models.NostrAuth, error) {
+	nostrAuth, err := s.getNostrAuth(ctx, pubkey)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrPubkeyNotLinked
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pubkey link: %w", err)
+	}
+	return nostrAuth, nil
+}
+
+// MaxCheckPubkeys is the most pubkeys ArePubkeysLinked accepts at once
+const MaxCheckPubkeys = 100
+
+// ArePubkeysLinked reports whether each pubkey is actively linked to any
+// account, reading every nostr_auth document in one batched call. Pubkeys
+// must be hex; uppercase is accepted. The result is keyed by lowercase hex.
+func (s *UserService) ArePubkeysLinked(ctx context.Context, pubkeys []string) (map[string]bool, error) {
+	if len(pubkeys) > MaxCheckPubkeys {
+		return nil, fmt.Errorf("at most %d pubkeys can be checked at once, got %d", MaxCheckPubkeys, len(pubkeys))
+	}
+
+	linked := make(map[string]bool, len(pubkeys))
+	refs := make([]*firestore.DocumentRef, 0, len(pubkeys))
+	for _, pubkey := range pubkeys {
+		normalized, err := normalizeHexPubkey(pubkey)
+		if err != nil {
+			return nil, err
+		}
+		if _, seen := linked[normalized]; seen {
+			continue
+		}
+		linked[normalized] = false
+		refs = append(refs, s.firestoreClient.Collection("nostr_auth").Doc(normalized))
+	}
+	if len(refs) == 0 {
+		return linked, nil
+	}
+
+	docs, err := s.firestoreClient.GetAll(ctx, refs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nostr auth records: %w", err)
+	}
+	for _, doc := range docs {
+		if !doc.Exists() {
+			continue
+		}
+		var nostrAuth models.NostrAuth
+		if err := doc.DataTo(&nostrAuth); err != nil {
+			return nil, fmt.Errorf("failed to parse nostr auth %s: %w", doc.Ref.ID, err)
+		}
+		linked[doc.Ref.ID] = nostrAuth.Active
+	}
+	return linked, nil
+}
+
 // getNostrAuth retrieves a NostrAuth record by pubkey
 func (s *UserService) getNostrAuth(ctx context.Context, pubkey string) (*models.NostrAuth, error) {
 	doc, err := s.firestoreClient.Collection("nostr_auth").Doc(pubkey).Get(ctx)
@@ -221,6 +410,19 @@ func (s *UserService) getNostrAuth(ctx context.Context, pubkey string) (*models.
 	return &nostrAuth, nil
 }
 
+// normalizeHexPubkey lowercases a hex pubkey, rejecting anything but 64 hex
+// characters; pubkeys are document IDs, so one key must have one spelling
+func normalizeHexPubkey(pubkey string) (string, error) {
+	pubkey = strings.ToLower(strings.TrimSpace(pubkey))
+	if len(pubkey) != 64 {
+		return "", ErrInvalidPubkey.WithMessage(fmt.Sprintf("%s, got %d", ErrInvalidPubkey.Message, len(pubkey)))
+	}
+	if _, err := hex.DecodeString(pubkey); err != nil {
+		return "", ErrInvalidPubkey.WithMessage(ErrInvalidPubkey.Message + ", got non-hex characters")
+	}
+	return pubkey, nil
+}
+
 // Helper functions
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
@@ -1,10 +1,17 @@
 package services
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"github.com/wavlake/api/internal/models"
 )
@@ -179,3 +186,203 @@ func (suite *UserServiceTestSuite) TestEdgeCases() {
 func TestUserServiceTestSuite(t *testing.T) {
 	suite.Run(t, new(UserServiceTestSuite))
 }
+
+const testPubkeyHex = "7e7e9c42a91bfef19fa929e5fda1b72e0ebc1a4c1141673e2794234d86addf4e"
+
+func TestNormalizeHexPubkey(t *testing.T) {
+	pubkey, err := normalizeHexPubkey(testPubkeyHex)
+	require.NoError(t, err)
+	assert.Equal(t, testPubkeyHex, pubkey)
+
+	// Uppercase and mixed-case hex are the same key
+	pubkey, err = normalizeHexPubkey(strings.ToUpper(testPubkeyHex))
+	require.NoError(t, err)
+	assert.Equal(t, testPubkeyHex, pubkey)
+	pubkey, err = normalizeHexPubkey(" 7E7E9c42" + testPubkeyHex[8:] + "\n")
+	require.NoError(t, err)
+	assert.Equal(t, testPubkeyHex, pubkey)
+
+	for name, input := range map[string]string{
+		"empty":     "",
+		"npub":      "npub10elfcs4fr0l0r8af98jlmgdh9c8tcxjvz9qkw038js35mp4dma8qzvjptg",
+		"short":     testPubkeyHex[:63],
+		"long":      testPubkeyHex + "0",
+		"non-hex":   "g" + testPubkeyHex[1:],
+		"with path": testPubkeyHex[:62] + "/x",
+	} {
+		_, err := normalizeHexPubkey(input)
+		assert.ErrorIs(t, err, ErrInvalidPubkey, name)
+	}
+}
+
+func TestWithMaxActivePubkeys(t *testing.T) {
+	assert.Equal(t, DefaultMaxActivePubkeys, NewUserService(nil, nil).maxActivePubkeys)
+	assert.Equal(t, 3, NewUserService(nil, nil, WithMaxActivePubkeys(3)).maxActivePubkeys)
+	assert.Equal(t, DefaultMaxActivePubkeys, NewUserService(nil, nil, WithMaxActivePubkeys(0)).maxActivePubkeys)
+}
+
+func TestArePubkeysLinkedRejectsBadInput(t *testing.T) {
+	service := NewUserService(nil, nil)
+
+	_, err := service.ArePubkeysLinked(context.Background(), make([]string, MaxCheckPubkeys+1))
+	assert.ErrorContains(t, err, "at most 100")
+
+	_, err = service.ArePubkeysLinked(context.Background(), []string{"npub1notdecoded"})
+	assert.ErrorIs(t, err, ErrInvalidPubkey)
+}
+
+// UserServiceEmulatorTestSuite exercises pubkey linking against the Firestore
+// emulator. Run with FIRESTORE_EMULATOR_HOST set, as for
+// NostrTrackEmulatorTestSuite.
+type UserServiceEmulatorTestSuite struct {
+	suite.Suite
+	ctx     context.Context
+	client  *firestore.Client
+	service *UserService
+	uid     string
+}
+
+func (suite *UserServiceEmulatorTestSuite) SetupSuite() {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		suite.T().Skip("FIRESTORE_EMULATOR_HOST not set, skipping emulator tests")
+	}
+
+	suite.ctx = context.Background()
+	client, err := firestore.NewClient(suite.ctx, "wavlake-test")
+	suite.Require().NoError(err)
+	suite.client = client
+	suite.service = NewUserService(client, nil, WithMaxActivePubkeys(2))
+}
+
+func (suite *UserServiceEmulatorTestSuite) TearDownSuite() {
+	if suite.client != nil {
+		suite.client.Close()
+	}
+}
+
+func (suite *UserServiceEmulatorTestSuite) SetupTest() {
+	suite.uid = uuid.New().String()
+}
+
+// linkPubkey links pubkey to firebaseUID, for tests that only need the error
+func linkPubkey(ctx context.Context, service *UserService, pubkey, firebaseUID string) error {
+	_, _, err := service.LinkPubkeyToUser(ctx, pubkey, firebaseUID)
+	return err
+}
+
+// randomPubkey returns a hex pubkey no other test uses
+func randomPubkey() string {
+	return strings.ReplaceAll(uuid.New().String()+uuid.New().String(), "-", "")
+}
+
+func (suite *UserServiceEmulatorTestSuite) TestUppercaseHexIsSameKey() {
+	pubkey := randomPubkey()
+	suite.Require().NoError(linkPubkey(suite.ctx, suite.service, strings.ToUpper(pubkey), suite.uid))
+
+	uid, err := suite.service.GetFirebaseUIDByPubkey(suite.ctx, pubkey)
+	suite.Require().NoError(err)
+	suite.Equal(suite.uid, uid)
+	_, err = suite.client.Collection("nostr_auth").Doc(strings.ToUpper(pubkey)).Get(suite.ctx)
+	suite.Error(err, "no document under the uppercase spelling")
+
+	// Linking the lowercase spelling again doesn't count as a second key
+	suite.Require().NoError(linkPubkey(suite.ctx, suite.service, pubkey, suite.uid))
+	linked, err := suite.service.GetLinkedPubkeys(suite.ctx, suite.uid)
+	suite.Require().NoError(err)
+	suite.Len(linked, 1)
+
+	// Nor can another account take it with different casing
+	err = linkPubkey(suite.ctx, suite.service, strings.ToUpper(pubkey), uuid.New().String())
+	suite.ErrorContains(err, "already linked to a different user")
+
+	suite.Require().NoError(suite.service.UnlinkPubkeyFromUser(suite.ctx, strings.ToUpper(pubkey), suite.uid))
+}
+
+func (suite *UserServiceEmulatorTestSuite) TestRejectsInvalidPubkey() {
+	err := linkPubkey(suite.ctx, suite.service, "npub10elfcs4fr0l0r8af98jlmgdh9c8tcxjvz9qkw038js35mp4dma8qzvjptg", suite.uid)
+	suite.ErrorIs(err, ErrInvalidPubkey)
+
+	_, err = suite.client.Collection("users").Doc(suite.uid).Get(suite.ctx)
+	suite.Error(err, "nothing is written")
+}
+
+func (suite *UserServiceEmulatorTestSuite) TestActivePubkeyLimit() {
+	first, second := randomPubkey(), randomPubkey()
+	suite.Require().NoError(linkPubkey(suite.ctx, suite.service, first, suite.uid))
+	suite.Require().NoError(linkPubkey(suite.ctx, suite.service, second, suite.uid))
+
+	err := linkPubkey(suite.ctx, suite.service, randomPubkey(), suite.uid)
+	suite.ErrorIs(err, ErrPubkeyLimitReached)
+
+	// Relinking a key already counted is fine, and unlinking frees a slot
+	suite.Require().NoError(linkPubkey(suite.ctx, suite.service, first, suite.uid))
+	suite.Require().NoError(suite.service.UnlinkPubkeyFromUser(suite.ctx, second, suite.uid))
+	suite.Require().NoError(linkPubkey(suite.ctx, suite.service, randomPubkey(), suite.uid))
+}
+
+func (suite *UserServiceEmulatorTestSuite) TestConcurrentLinksRespectLimit() {
+	const attempts = 5
+	errs := make(chan error, attempts)
+	for range attempts {
+		go func() { errs <- linkPubkey(suite.ctx, suite.service, randomPubkey(), suite.uid) }()
+	}
+
+	linked := 0
+	for range attempts {
+		if err := <-errs; err == nil {
+			linked++
+		} else {
+			suite.ErrorIs(err, ErrPubkeyLimitReached, fmt.Sprint(err))
+		}
+	}
+	suite.Equal(2, linked)
+}
+
+func (suite *UserServiceEmulatorTestSuite) TestRelinkKeepsTimestamps() {
+	pubkey := randomPubkey()
+	linked, alreadyLinked, err := suite.service.LinkPubkeyToUser(suite.ctx, pubkey, suite.uid)
+	suite.Require().NoError(err)
+	suite.False(alreadyLinked)
+	suite.Equal(linked.CreatedAt, linked.LinkedAt)
+
+	// Relinking an active pubkey changes nothing and records no event
+	relinked, alreadyLinked, err := suite.service.LinkPubkeyToUser(suite.ctx, pubkey, suite.uid)
+	suite.Require().NoError(err)
+	suite.True(alreadyLinked)
+	suite.True(linked.CreatedAt.Equal(relinked.CreatedAt))
+	suite.True(linked.LinkedAt.Equal(relinked.LinkedAt))
+	events, err := suite.service.GetPubkeyHistoryByPubkey(suite.ctx, pubkey)
+	suite.Require().NoError(err)
+	suite.Len(events, 1)
+
+	// Relinking after an unlink is a new link, but the record keeps its CreatedAt
+	suite.Require().NoError(suite.service.UnlinkPubkeyFromUser(suite.ctx, pubkey, suite.uid))
+	relinked, alreadyLinked, err = suite.service.LinkPubkeyToUser(suite.ctx, pubkey, suite.uid)
+	suite.Require().NoError(err)
+	suite.False(alreadyLinked)
+	suite.True(linked.CreatedAt.Equal(relinked.CreatedAt))
+	suite.True(relinked.LinkedAt.After(linked.LinkedAt))
+
+	doc, err := suite.client.Collection("nostr_auth").Doc(pubkey).Get(suite.ctx)
+	suite.Require().NoError(err)
+	var stored models.NostrAuth
+	suite.Require().NoError(doc.DataTo(&stored))
+	suite.True(linked.CreatedAt.Equal(stored.CreatedAt))
+	suite.True(relinked.LinkedAt.Equal(stored.LinkedAt))
+	suite.True(stored.Active)
+}
+
+func (suite *UserServiceEmulatorTestSuite) TestArePubkeysLinked() {
+	active, unlinked, unknown := randomPubkey(), randomPubkey(), randomPubkey()
+	suite.Require().NoError(linkPubkey(suite.ctx, suite.service, active, suite.uid))
+	suite.Require().NoError(linkPubkey(suite.ctx, suite.service, unlinked, suite.uid))
+	suite.Require().NoError(suite.service.UnlinkPubkeyFromUser(suite.ctx, unlinked, suite.uid))
+
+	linked, err := suite.service.ArePubkeysLinked(suite.ctx, []string{strings.ToUpper(active), unlinked, unknown, active})
+	suite.Require().NoError(err)
+	suite.Equal(map[string]bool{active: true, unlinked: false, unknown: false}, linked)
+}
+
+func TestUserServiceEmulatorTestSuite(t *testing.T) {
+	suite.Run(t, new(UserServiceEmulatorTestSuite))
+}
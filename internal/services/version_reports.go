@@ -0,0 +1,248 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/wavlake/api/internal/apierror"
+	"github.com/wavlake/api/internal/models"
+	"github.com/wavlake/api/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrInvalidVersionReport is returned for a version report without an ID or
+// with an unknown status
+var ErrInvalidVersionReport = apierror.New(http.StatusBadRequest, "track.invalid_version_report", "invalid compression version report")
+
+// ErrVersionNotFound is returned for a compression version the track doesn't
+// have
+var ErrVersionNotFound = apierror.New(http.StatusNotFound, "track.version_not_found", "compression version not found")
+
+// RecordCompressedObject records that one of a track's compression versions
+// has its file in storage, as the GCS trigger reports: the version is marked
+// completed with the object's size, and its URL if it had none. An object for
+// a version the track doesn't have is ErrVersionNotFound, since the version's
+// format and options are only known from its record.
+func (s *NostrTrackService) RecordCompressedObject(ctx context.Context, trackID, versionID string, size int64) (*models.CompressionVersion, error) {
+	track, err := s.GetTrack(ctx, trackID)
+	if err != nil {
+		return nil, err
+	}
+
+	var version *models.CompressionVersion
+	for i := range track.CompressionVersions {
+		if track.CompressionVersions[i].ID == versionID {
+			version = &track.CompressionVersions[i]
+			break
+		}
+	}
+	if version == nil {
+		return nil, ErrVersionNotFound.WithMessage(fmt.Sprintf("compression version %s not found", versionID))
+	}
+
+	report := models.CompressionVersion{ID: versionID, Status: models.VersionStatusCompleted, Size: size}
+	if version.URL == "" {
+		report.URL = s.StorageFor(track).GetPublicURL(s.pathConfig.GetCompressedVersionPath(track.ID, versionID, version.Format))
+	}
+	return s.AddOrUpdateCompressionVersion(ctx, trackID, report)
+}
+
+// AddOrUpdateCompressionVersion records an external worker's report on one
+// compression version: the version is created if it is new, and otherwise the
+// report's status, error and non-zero file details are merged into it. Reports
+// can arrive out of order, so one that would move a failed version back to
+// pending or processing, or a completed version to any other status, is
+// ignored. has_pending_compression is then set from whether any version is
+// still pending or processing. The stored version is returned.
+func (s *NostrTrackService) AddOrUpdateCompressionVersion(ctx context.Context, trackID string, report models.CompressionVersion) (*models.CompressionVersion, error) {
+	stored, err := s.AddOrUpdateCompressionVersions(ctx, trackID, []models.CompressionVersion{report})
+	if err != nil {
+		return nil, err
+	}
+	return &stored[0], nil
+}
+
+// AddOrUpdateCompressionVersions records reports on several of a track's
+// versions in one transaction, as AddOrUpdateCompressionVersion does for one,
+// so the track is updated once. The stored versions are returned in the
+// order of the reports.
+func (s *NostrTrackService) AddOrUpdateCompressionVersions(ctx context.Context, trackID string, reports []models.CompressionVersion) (_ []models.CompressionVersion, err error) {
+	ctx, span := telemetry.Start(ctx, "NostrTrackService.AddOrUpdateCompressionVersions", telemetry.AttributeTrackID.String(trackID), attribute.Int("wavlake.reports", len(reports)))
+	defer func() { telemetry.End(span, err) }()
+
+	reportedIDs := make([]string, 0, len(reports))
+	for _, report := range reports {
+		switch report.Status {
+		case models.VersionStatusPending, models.VersionStatusProcessing, models.VersionStatusCompleted, models.VersionStatusFailed:
+		default:
+			return nil, ErrInvalidVersionReport.WithMessage(fmt.Sprintf("%s: unknown status %q", ErrInvalidVersionReport.Message, report.Status))
+		}
+		if report.ID == "" {
+			return nil, ErrInvalidVersionReport.WithMessage(ErrInvalidVersionReport.Message + ": version_id is required")
+		}
+		reportedIDs = append(reportedIDs, report.ID)
+	}
+
+	trackRef := s.firestoreClient.Collection("nostr_tracks").Doc(trackID)
+
+	var stored []models.CompressionVersion
+	var changed []bool
+	err = s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		stored = make([]models.CompressionVersion, len(reports))
+		changed = make([]bool, len(reports))
+
+		track, err := getTrackTx(tx, trackRef)
+		if err != nil {
+			return err
+		}
+
+		versions, err := trackVersionsTx(tx, trackRef, track)
+		if err != nil {
+			return err
+		}
+		byID := make(map[string]models.CompressionVersion, len(versions))
+		for _, version := range versions {
+			byID[version.ID] = version
+		}
+
+		// A version reported twice is written once, with both reports merged
+		written := map[string]bool{}
+		for i, report := range reports {
+			var existing *models.CompressionVersion
+			if version, ok := byID[report.ID]; ok {
+				existing = &version
+			}
+			stored[i], changed[i] = mergeVersionReport(existing, report)
+			byID[report.ID] = stored[i]
+			written[report.ID] = written[report.ID] || changed[i]
+		}
+
+		pending := false
+		for _, version := range byID {
+			if !version.IsTerminal() {
+				pending = true
+			}
+		}
+
+		var trackUpdates []firestore.Update
+		if !track.VersionsMigrated {
+			trackUpdates, err = migrateVersionsTx(tx, trackRef, track, reportedIDs...)
+			if err != nil {
+				return err
+			}
+		}
+		for id, wrote := range written {
+			if wrote || !track.VersionsMigrated {
+				if err := tx.Set(trackRef.Collection(trackVersionsCollection).Doc(id), byID[id]); err != nil {
+					return fmt.Errorf("failed to save track version: %w", err)
+				}
+			}
+		}
+		if pending != track.HasPendingCompression {
+			trackUpdates = append(trackUpdates, firestore.Update{Path: "has_pending_compression", Value: pending})
+		}
+		if len(trackUpdates) == 0 {
+			return nil
+		}
+		trackUpdates = append(trackUpdates, firestore.Update{Path: "updated_at", Value: time.Now()})
+		if err := tx.Update(trackRef, trackUpdates); err != nil {
+			return fmt.Errorf("failed to update track: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		if isPreconditionConflict(err) {
+			return nil, ErrTrackUpdateConflict
+		}
+		return nil, err
+	}
+
+	for i := range stored {
+		if !changed[i] {
+			continue
+		}
+		log.Printf("Recorded %s compression version %s for track %s", stored[i].Status, stored[i].ID, trackID)
+		version := stored[i]
+		s.events.Publish(models.TrackEvent{
+			Type:    models.TrackEventVersion,
+			TrackID: trackID,
+			Version: &version,
+		})
+	}
+	return stored, nil
+}
+
+// mergeVersionReport applies a version report to the stored version, if any.
+// It reports false when the report is stale and the version is unchanged.
+func mergeVersionReport(existing *models.CompressionVersion, report models.CompressionVersion) (models.CompressionVersion, bool) {
+	if existing == nil {
+		version := models.CompressionVersion{
+			ID:         report.ID,
+			URL:        report.URL,
+			Bitrate:    report.Bitrate,
+			Format:     report.Format,
+			SampleRate: report.SampleRate,
+			Size:       report.Size,
+			Hash:       report.Hash,
+			Status:     report.Status,
+			Error:      report.Error,
+			CreatedAt:  time.Now(),
+			Options:    models.CompressionOption{Bitrate: report.Bitrate, Format: report.Format, SampleRate: report.SampleRate},
+		}
+		return version, true
+	}
+
+	version := *existing
+	completed := version.Status == "" || version.Status == models.VersionStatusCompleted
+	if (completed && report.Status != models.VersionStatusCompleted) || (version.IsTerminal() && !report.IsTerminal()) {
+		return version, false
+	}
+
+	version.Status = report.Status
+	version.Error = report.Error
+	if report.URL != "" {
+		version.URL = report.URL
+	}
+	if report.Format != "" {
+		version.Format = report.Format
+	}
+	if report.Bitrate != 0 {
+		version.Bitrate = report.Bitrate
+	}
+	if report.SampleRate != 0 {
+		version.SampleRate = report.SampleRate
+	}
+	if report.Size != 0 {
+		version.Size = report.Size
+	}
+	if report.Hash != "" {
+		version.Hash = report.Hash
+	}
+	return version, true
+}
+
+// trackVersionsTx reads a track's versions, from the subcollection once they
+// have been migrated there
+func trackVersionsTx(tx *firestore.Transaction, trackRef *firestore.DocumentRef, track *models.NostrTrack) ([]models.CompressionVersion, error) {
+	if !track.VersionsMigrated {
+		return track.CompressionVersions, nil
+	}
+
+	docs, err := tx.Documents(trackRef.Collection(trackVersionsCollection)).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get track versions: %w", err)
+	}
+	versions := make([]models.CompressionVersion, 0, len(docs))
+	for _, doc := range docs {
+		var version models.CompressionVersion
+		if err := doc.DataTo(&version); err != nil {
+			return nil, fmt.Errorf("failed to decode track version %s: %w", doc.Ref.ID, err)
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
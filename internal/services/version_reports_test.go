@@ -0,0 +1,53 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wavlake/api/internal/models"
+)
+
+func TestMergeVersionReport(t *testing.T) {
+	stored := func(status string) *models.CompressionVersion {
+		return &models.CompressionVersion{ID: "v1", URL: "https://storage.example.com/v1.mp3", Format: "mp3", Bitrate: 128, IsPublic: true, Status: status}
+	}
+
+	tests := []struct {
+		name        string
+		existing    *models.CompressionVersion
+		report      models.CompressionVersion
+		wantStatus  string
+		wantChanged bool
+	}{
+		{"new version", nil, models.CompressionVersion{ID: "v1", Status: models.VersionStatusPending}, models.VersionStatusPending, true},
+		{"pending to processing", stored(models.VersionStatusPending), models.CompressionVersion{Status: models.VersionStatusProcessing}, models.VersionStatusProcessing, true},
+		{"completed before processing", stored(models.VersionStatusPending), models.CompressionVersion{Status: models.VersionStatusCompleted}, models.VersionStatusCompleted, true},
+		{"late processing after completed", stored(models.VersionStatusCompleted), models.CompressionVersion{Status: models.VersionStatusProcessing}, models.VersionStatusCompleted, false},
+		{"late failure after completed", stored(models.VersionStatusCompleted), models.CompressionVersion{Status: models.VersionStatusFailed}, models.VersionStatusCompleted, false},
+		{"legacy version counts as completed", stored(""), models.CompressionVersion{Status: models.VersionStatusPending}, "", false},
+		{"late pending after failed", stored(models.VersionStatusFailed), models.CompressionVersion{Status: models.VersionStatusPending}, models.VersionStatusFailed, false},
+		{"retry succeeds after failed", stored(models.VersionStatusFailed), models.CompressionVersion{Status: models.VersionStatusCompleted}, models.VersionStatusCompleted, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, changed := mergeVersionReport(tt.existing, tt.report)
+			assert.Equal(t, tt.wantStatus, version.Status)
+			assert.Equal(t, tt.wantChanged, changed)
+		})
+	}
+}
+
+func TestMergeVersionReportKeepsUnreportedFields(t *testing.T) {
+	existing := &models.CompressionVersion{ID: "v1", URL: "https://storage.example.com/v1.mp3", Format: "mp3", Bitrate: 128, IsPublic: true,
+		Status: models.VersionStatusFailed, Error: "encoder crashed"}
+
+	version, changed := mergeVersionReport(existing, models.CompressionVersion{ID: "v1", Size: 4096, Status: models.VersionStatusCompleted})
+
+	assert.True(t, changed)
+	assert.Equal(t, "https://storage.example.com/v1.mp3", version.URL)
+	assert.Equal(t, 128, version.Bitrate)
+	assert.Equal(t, int64(4096), version.Size)
+	assert.True(t, version.IsPublic)
+	assert.Empty(t, version.Error, "a completed report clears the earlier failure")
+}
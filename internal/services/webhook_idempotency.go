@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/wavlake/api/internal/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// webhookIdempotencyCollection holds one document per processing webhook
+	// idempotency key. Give expires_at a Firestore TTL policy so old keys are
+	// removed.
+	webhookIdempotencyCollection = "webhook_idempotency_keys"
+
+	// WebhookIdempotencyKeyTTL is how long a key keeps rejecting duplicates
+	WebhookIdempotencyKeyTTL = 24 * time.Hour
+)
+
+// idempotencyKeyDocID returns the document ID for a key, so keys can hold
+// characters Firestore doesn't allow in IDs
+func idempotencyKeyDocID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ClaimIdempotencyKey records a processing webhook's idempotency key. It
+// returns false if the key was already claimed and hasn't expired, in which
+// case the delivery is a duplicate and should not be handled again. The TTL
+// policy can take a day or more to delete an expired key, so one still
+// present past its expires_at is claimed afresh.
+func (s *NostrTrackService) ClaimIdempotencyKey(ctx context.Context, key, trackID string) (bool, error) {
+	ref := s.firestoreClient.Collection(webhookIdempotencyCollection).Doc(idempotencyKeyDocID(key))
+
+	claimed := false
+	err := s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		claimed = false
+		now := time.Now()
+
+		doc, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			var existing models.WebhookIdempotencyKey
+			if err := doc.DataTo(&existing); err != nil {
+				return err
+			}
+			if now.Before(existing.ExpiresAt) {
+				return nil
+			}
+		}
+
+		claimed = true
+		return tx.Set(ref, models.WebhookIdempotencyKey{
+			Key:       key,
+			TrackID:   trackID,
+			CreatedAt: now,
+			ExpiresAt: now.Add(WebhookIdempotencyKeyTTL),
+		})
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+	return claimed, nil
+}
+
+// ReleaseIdempotencyKey forgets a claimed key so a delivery that failed can
+// be retried with it
+func (s *NostrTrackService) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	if _, err := s.firestoreClient.Collection(webhookIdempotencyCollection).Doc(idempotencyKeyDocID(key)).Delete(ctx); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,404 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+	"github.com/wavlake/api/internal/models"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	userWebhooksCollection = "user_webhooks"
+
+	// MaxWebhooksPerUser caps how many endpoints one account can register
+	MaxWebhooksPerUser = 10
+
+	// MinWebhookSecretLength is the shortest accepted signing secret
+	MinWebhookSecretLength = 16
+
+	// DefaultWebhookFailureLimit is how many consecutive failed deliveries
+	// disable a webhook
+	DefaultWebhookFailureLimit = 10
+
+	// webhookDeliveryTimeout bounds a single delivery attempt
+	webhookDeliveryTimeout = 10 * time.Second
+)
+
+// Headers sent with every webhook delivery
+const (
+	WebhookSignatureHeader = "X-Wavlake-Signature"
+	WebhookEventHeader     = "X-Wavlake-Event"
+	WebhookDeliveryHeader  = "X-Wavlake-Delivery"
+)
+
+var (
+	// ErrWebhookNotFound is returned when a webhook doesn't exist or belongs to
+	// a different user
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrInvalidWebhookURL is returned for URLs that aren't absolute https URLs
+	ErrInvalidWebhookURL = errors.New("webhook URL must be an absolute https URL")
+	// ErrInvalidWebhookEvent is returned for unknown event types
+	ErrInvalidWebhookEvent = errors.New("unknown webhook event type")
+	// ErrWebhookSecretTooShort is returned for secrets under MinWebhookSecretLength
+	ErrWebhookSecretTooShort = fmt.Errorf("webhook secret must be at least %d characters", MinWebhookSecretLength)
+	// ErrTooManyWebhooks is returned when the account already has MaxWebhooksPerUser
+	ErrTooManyWebhooks = fmt.Errorf("at most %d webhooks per account", MaxWebhooksPerUser)
+)
+
+// WebhookEventTypes lists the events a webhook can subscribe to
+var WebhookEventTypes = []string{
+	models.NotificationTypeProcessingComplete,
+	models.NotificationTypeProcessingFailed,
+	models.NotificationTypeCompressionReady,
+}
+
+// WebhookService manages user-registered webhooks and delivers notification
+// events to them. Deliveries are signed with the webhook's secret, retried,
+// and a webhook that keeps failing is disabled.
+type WebhookService struct {
+	firestoreClient *firestore.Client
+	httpClient      *http.Client
+	retryDelays     []time.Duration
+	failureLimit    int
+}
+
+func NewWebhookService(firestoreClient *firestore.Client) *WebhookService {
+	return &WebhookService{
+		firestoreClient: firestoreClient,
+		httpClient:      newWebhookHTTPClient(),
+		retryDelays:     []time.Duration{5 * time.Second, 30 * time.Second},
+		failureLimit:    DefaultWebhookFailureLimit,
+	}
+}
+
+// newWebhookHTTPClient refuses non-public addresses like the import client and
+// doesn't follow redirects
+func newWebhookHTTPClient() *http.Client {
+	client := newImportHTTPClient()
+	client.Timeout = webhookDeliveryTimeout
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return client
+}
+
+// SignWebhookPayload returns the signature header value for a delivery:
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">"
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	t := strconv.FormatInt(timestamp, 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t + "."))
+	mac.Write(body)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// CreateWebhook registers a webhook. An empty eventTypes subscribes to every event.
+func (s *WebhookService) CreateWebhook(ctx context.Context, firebaseUID, rawURL, secret string, eventTypes []string) (*models.UserWebhook, error) {
+	webhookURL, err := url.Parse(rawURL)
+	if err != nil || webhookURL.Scheme != "https" || webhookURL.Host == "" || webhookURL.User != nil {
+		return nil, ErrInvalidWebhookURL
+	}
+	if len(secret) < MinWebhookSecretLength {
+		return nil, ErrWebhookSecretTooShort
+	}
+	if len(eventTypes) == 0 {
+		eventTypes = append([]string(nil), WebhookEventTypes...)
+	}
+	for _, eventType := range eventTypes {
+		if !isWebhookEventType(eventType) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidWebhookEvent, eventType)
+		}
+	}
+
+	existing, err := s.ListWebhooks(ctx, firebaseUID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= MaxWebhooksPerUser {
+		return nil, ErrTooManyWebhooks
+	}
+
+	now := time.Now()
+	webhook := &models.UserWebhook{
+		ID:          uuid.New().String(),
+		FirebaseUID: firebaseUID,
+		URL:         webhookURL.String(),
+		Secret:      secret,
+		EventTypes:  eventTypes,
+		Active:      true,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if _, err := s.firestoreClient.Collection(userWebhooksCollection).Doc(webhook.ID).Set(ctx, webhook); err != nil {
+		return nil, fmt.Errorf("failed to save webhook: %w", err)
+	}
+
+	log.Printf("Created webhook %s for user %s", webhook.ID, firebaseUID)
+	return webhook, nil
+}
+
+// ListWebhooks returns a user's webhooks, oldest first
+func (s *WebhookService) ListWebhooks(ctx context.Context, firebaseUID string) ([]models.UserWebhook, error) {
+	iter := s.firestoreClient.Collection(userWebhooksCollection).Where("firebase_uid", "==", firebaseUID).Documents(ctx)
+	defer iter.Stop()
+
+	webhooks := []models.UserWebhook{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate webhooks: %w", err)
+		}
+
+		var webhook models.UserWebhook
+		if err := doc.DataTo(&webhook); err != nil {
+			log.Printf("Failed to decode webhook %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	// Sorted here rather than in the query so no composite index is needed
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+	})
+	return webhooks, nil
+}
+
+// DeleteWebhook removes one of a user's webhooks
+func (s *WebhookService) DeleteWebhook(ctx context.Context, firebaseUID, webhookID string) error {
+	webhook, err := s.getWebhook(ctx, firebaseUID, webhookID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.firestoreClient.Collection(userWebhooksCollection).Doc(webhook.ID).Delete(ctx); err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+
+	log.Printf("Deleted webhook %s for user %s", webhookID, firebaseUID)
+	return nil
+}
+
+// TestWebhook sends a single webhook_test event and reports the outcome. It is
+// sent to disabled webhooks too, and a successful test re-enables them.
+func (s *WebhookService) TestWebhook(ctx context.Context, firebaseUID, webhookID string) (*models.WebhookDelivery, error) {
+	webhook, err := s.getWebhook(ctx, firebaseUID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	event := models.WebhookEvent{
+		ID:        uuid.New().String(),
+		Type:      models.WebhookEventTest,
+		CreatedAt: time.Now(),
+		Data:      models.WebhookEventData{Message: "Test event from Wavlake"},
+	}
+	statusCode, err := s.deliver(ctx, webhook, event)
+
+	result := &models.WebhookDelivery{Delivered: err == nil, StatusCode: statusCode}
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+
+	s.recordDelivery(ctx, webhook.ID, nil)
+	return result, nil
+}
+
+// Dispatch delivers a notification to the owner's active webhooks subscribed to
+// its type. It returns immediately; failures are logged and counted against
+// each webhook.
+func (s *WebhookService) Dispatch(notification models.Notification) {
+	if notification.FirebaseUID == "" {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		webhooks, err := s.ListWebhooks(ctx, notification.FirebaseUID)
+		if err != nil {
+			log.Printf("Failed to load webhooks for user %s: %v", notification.FirebaseUID, err)
+			return
+		}
+
+		event := models.WebhookEvent{
+			ID:        uuid.New().String(),
+			Type:      notification.Type,
+			CreatedAt: time.Now(),
+			Data: models.WebhookEventData{
+				TrackID: notification.TrackID,
+				Pubkey:  notification.Pubkey,
+				Message: notification.Message,
+			},
+		}
+		for i := range webhooks {
+			if webhooks[i].Active && subscribes(&webhooks[i], notification.Type) {
+				go s.deliverWithRetries(&webhooks[i], event)
+			}
+		}
+	}()
+}
+
+// deliverWithRetries attempts a delivery once plus once per retry delay and
+// records the final outcome on the webhook
+func (s *WebhookService) deliverWithRetries(webhook *models.UserWebhook, event models.WebhookEvent) {
+	var err error
+	for attempt := 0; attempt <= len(s.retryDelays); attempt++ {
+		if attempt > 0 {
+			time.Sleep(s.retryDelays[attempt-1])
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), webhookDeliveryTimeout)
+		_, err = s.deliver(ctx, webhook, event)
+		cancel()
+		if err == nil {
+			break
+		}
+		log.Printf("Webhook %s delivery of %s failed (attempt %d): %v", webhook.ID, event.Type, attempt+1, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	s.recordDelivery(ctx, webhook.ID, err)
+}
+
+// deliver POSTs a signed event. Any non-2xx response is an error.
+func (s *WebhookService) deliver(ctx context.Context, webhook *models.UserWebhook, event models.WebhookEvent) (int, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, event.Type)
+	req.Header.Set(WebhookDeliveryHeader, event.ID)
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(webhook.Secret, time.Now().Unix(), body))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) // #nosec G104 -- Drain so the connection can be reused
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned HTTP %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// recordDelivery resets the failure counter after a success, or counts a
+// failure and disables the webhook once it reaches the failure limit
+func (s *WebhookService) recordDelivery(ctx context.Context, webhookID string, deliveryErr error) {
+	ref := s.firestoreClient.Collection(userWebhooksCollection).Doc(webhookID)
+
+	err := s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				// Deleted while the delivery was in flight
+				return nil
+			}
+			return fmt.Errorf("failed to get webhook: %w", err)
+		}
+
+		var webhook models.UserWebhook
+		if err := doc.DataTo(&webhook); err != nil {
+			return fmt.Errorf("failed to decode webhook: %w", err)
+		}
+
+		now := time.Now()
+		if deliveryErr == nil {
+			return tx.Update(ref, []firestore.Update{
+				{Path: "active", Value: true},
+				{Path: "failure_count", Value: 0},
+				{Path: "last_error", Value: firestore.Delete},
+				{Path: "last_delivery_at", Value: now},
+				{Path: "disabled_at", Value: firestore.Delete},
+				{Path: "updated_at", Value: now},
+			})
+		}
+
+		updates := []firestore.Update{
+			{Path: "failure_count", Value: webhook.FailureCount + 1},
+			{Path: "last_error", Value: deliveryErr.Error()},
+			{Path: "updated_at", Value: now},
+		}
+		if webhook.Active && webhook.FailureCount+1 >= s.failureLimit {
+			log.Printf("Disabling webhook %s after %d consecutive failures", webhookID, webhook.FailureCount+1)
+			updates = append(updates,
+				firestore.Update{Path: "active", Value: false},
+				firestore.Update{Path: "disabled_at", Value: now},
+			)
+		}
+		return tx.Update(ref, updates)
+	})
+	if err != nil {
+		log.Printf("Failed to record delivery for webhook %s: %v", webhookID, err)
+	}
+}
+
+// getWebhook loads a webhook owned by the user
+func (s *WebhookService) getWebhook(ctx context.Context, firebaseUID, webhookID string) (*models.UserWebhook, error) {
+	doc, err := s.firestoreClient.Collection(userWebhooksCollection).Doc(webhookID).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+
+	var webhook models.UserWebhook
+	if err := doc.DataTo(&webhook); err != nil {
+		return nil, fmt.Errorf("failed to decode webhook: %w", err)
+	}
+	if webhook.FirebaseUID != firebaseUID {
+		return nil, ErrWebhookNotFound
+	}
+	return &webhook, nil
+}
+
+func isWebhookEventType(eventType string) bool {
+	for _, known := range WebhookEventTypes {
+		if eventType == known {
+			return true
+		}
+	}
+	return false
+}
+
+func subscribes(webhook *models.UserWebhook, eventType string) bool {
+	for _, subscribed := range webhook.EventTypes {
+		if subscribed == eventType {
+			return true
+		}
+	}
+	return false
+}
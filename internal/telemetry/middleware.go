@@ -0,0 +1,72 @@
+package telemetry
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wavlake/api/internal/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Span attributes the API sets beyond the HTTP semantic conventions
+const (
+	AttributePubkey    = attribute.Key("wavlake.pubkey")
+	AttributeRequestID = attribute.Key("wavlake.request_id")
+	AttributeTrackID   = attribute.Key("wavlake.track_id")
+)
+
+// Middleware starts a server span per request, continuing a trace the caller
+// sent in traceparent, and names it for the matched route. The span's own
+// traceparent is set on the response so callers, such as the GCS trigger,
+// can find the trace. The authenticated pubkey is added once the handler has
+// run. Register it after logging.Middleware so the request ID is known.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		propagator := otel.GetTextMapPropagator()
+		ctx := propagator.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		route := c.FullPath()
+		name := c.Request.Method
+		if route != "" {
+			name += " " + route
+		}
+		ctx, span := Tracer().Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Request.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", c.Request.URL.Path),
+				AttributeRequestID.String(logging.RequestIDFromContext(ctx)),
+			),
+		)
+		defer span.End()
+
+		propagator.Inject(ctx, propagation.HeaderCarrier(c.Writer.Header()))
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		// NIP-98 auth sets pubkey; dual and flexible auth set nostr_pubkey
+		if pubkey := firstSet(c.GetString("pubkey"), c.GetString("nostr_pubkey")); pubkey != "" {
+			span.SetAttributes(AttributePubkey.String(pubkey))
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
+
+func firstSet(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,75 @@
+package telemetry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/logging"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := recordSpans(t)
+
+	var handlerSpan trace.SpanContext
+	router := gin.New()
+	router.Use(logging.Middleware(), Middleware())
+	router.GET("/v1/tracks/:id", func(c *gin.Context) {
+		handlerSpan = trace.SpanContextFromContext(c.Request.Context())
+		c.Set("pubkey", "owner-pubkey")
+		c.Status(http.StatusOK)
+	})
+
+	req, _ := http.NewRequest("GET", "/v1/tracks/track-123", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "GET /v1/tracks/:id", span.Name())
+	assert.Equal(t, trace.SpanKindServer, span.SpanKind())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+	assert.Equal(t, span.SpanContext(), handlerSpan)
+	assert.Subset(t, span.Attributes(), []attribute.KeyValue{
+		attribute.String("http.route", "/v1/tracks/:id"),
+		attribute.String("url.path", "/v1/tracks/track-123"),
+		attribute.Int("http.response.status_code", http.StatusOK),
+		AttributePubkey.String("owner-pubkey"),
+		AttributeRequestID.String(w.Header().Get(logging.RequestIDHeader)),
+	})
+	assert.Equal(t, codes.Unset, span.Status().Code)
+
+	// The caller can find the trace from the response
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+span.SpanContext().SpanID().String()+"-01", w.Header().Get("traceparent"))
+}
+
+func TestMiddlewareServerError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := recordSpans(t)
+
+	router := gin.New()
+	router.Use(Middleware())
+	router.POST("/v1/tracks/nostr", func(c *gin.Context) {
+		c.Set("nostr_pubkey", "dual-auth-pubkey")
+		c.Status(http.StatusInternalServerError)
+	})
+
+	req, _ := http.NewRequest("POST", "/v1/tracks/nostr", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.False(t, spans[0].Parent().IsValid(), "a request without traceparent starts a trace")
+	assert.Contains(t, spans[0].Attributes(), AttributePubkey.String("dual-auth-pubkey"))
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+}
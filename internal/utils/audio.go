@@ -2,13 +2,18 @@ package utils
 
 import (
 	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/wavlake/api/internal/models"
 )
@@ -16,13 +21,49 @@ import (
 // AudioProcessor handles audio file processing and compression
 type AudioProcessor struct {
 	tempDir string
+	formats []string
+}
+
+// AudioFormats are the extensions uploads may use, and the default set an
+// AudioProcessor accepts
+var AudioFormats = []string{
+	"mp3", "wav", "flac", "aac", "ogg", "m4a", "wma", "aiff", "au",
+}
+
+// AudioProcessorOption configures an AudioProcessor
+type AudioProcessorOption func(*AudioProcessor)
+
+// WithSupportedFormats limits the upload formats accepted to a subset of
+// AudioFormats; an empty list keeps them all
+func WithSupportedFormats(formats []string) AudioProcessorOption {
+	return func(ap *AudioProcessor) {
+		if len(formats) > 0 {
+			ap.formats = formats
+		}
+	}
 }
 
 // NewAudioProcessor creates a new audio processor
-func NewAudioProcessor(tempDir string) *AudioProcessor {
-	return &AudioProcessor{
+func NewAudioProcessor(tempDir string, opts ...AudioProcessorOption) *AudioProcessor {
+	ap := &AudioProcessor{
 		tempDir: tempDir,
+		formats: AudioFormats,
+	}
+	for _, opt := range opts {
+		opt(ap)
 	}
+	return ap
+}
+
+// FFmpegAvailable reports whether the ffmpeg and ffprobe binaries processing
+// runs are on the PATH
+func FFmpegAvailable() bool {
+	for _, name := range []string{"ffmpeg", "ffprobe"} {
+		if _, err := exec.LookPath(name); err != nil {
+			return false
+		}
+	}
+	return true
 }
 
 // AudioInfo contains metadata about an audio file
@@ -34,135 +75,332 @@ type AudioInfo struct {
 	Channels   int   // Number of channels
 }
 
+// AudioTags are the descriptive tags embedded in an audio file. Empty fields
+// weren't set in the file.
+type AudioTags struct {
+	Title      string
+	Artist     string
+	Album      string
+	Genre      string
+	HasArtwork bool // The file has an attached cover image
+}
+
+// CompressionFormat describes how one compressed output format is encoded
+type CompressionFormat struct {
+	Codec       string // ffmpeg encoder
+	Muxer       string // ffmpeg output container
+	ContentType string
+	MinBitrate  int   // Lowest accepted bitrate in kbps
+	SampleRates []int // Sample rates the encoder supports; nil means any
+}
+
+// CompressionFormats are the formats compression versions can be made in,
+// keyed by the format name, which is also the file extension
+var CompressionFormats = map[string]CompressionFormat{
+	"mp3":  {Codec: "libmp3lame", Muxer: "mp3", ContentType: "audio/mpeg", MinBitrate: 32},
+	"aac":  {Codec: "aac", Muxer: "adts", ContentType: "audio/aac", MinBitrate: 32},
+	"ogg":  {Codec: "libvorbis", Muxer: "ogg", ContentType: "audio/ogg", MinBitrate: 32},
+	"opus": {Codec: "libopus", Muxer: "opus", ContentType: "audio/ogg", MinBitrate: 24, SampleRates: []int{48000}},
+}
+
+// DefaultCompressionOption is the version every processed track gets
+var DefaultCompressionOption = models.CompressionOption{Format: "mp3", Bitrate: 128, SampleRate: 44100}
+
 // GetAudioInfo extracts metadata from an audio file using ffprobe
 func (ap *AudioProcessor) GetAudioInfo(ctx context.Context, inputPath string) (*AudioInfo, error) {
-	cmd := exec.CommandContext(ctx, "ffprobe",
-		"-v", "quiet",
-		"-show_entries", "format=duration,size,bit_rate",
-		"-show_entries", "stream=sample_rate,channels",
-		"-of", "csv=p=0",
-		inputPath)
-
-	output, err := cmd.Output()
+	output, err := probe(ctx, inputPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get audio info: %w", err)
 	}
+	return parseAudioInfo(output)
+}
 
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-	if len(lines) < 2 {
-		return nil, fmt.Errorf("unexpected ffprobe output format")
+// GetAudioTags reads a file's embedded ID3 or Vorbis comment tags using
+// ffprobe
+func (ap *AudioProcessor) GetAudioTags(ctx context.Context, inputPath string) (*AudioTags, error) {
+	output, err := probe(ctx, inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audio tags: %w", err)
 	}
+	return parseAudioTags(output)
+}
 
-	// Parse format info (duration, size, bit_rate)
-	formatParts := strings.Split(lines[0], ",")
-	if len(formatParts) < 3 {
-		return nil, fmt.Errorf("unexpected format info format")
-	}
+// probe runs ffprobe on a file, returning its JSON description of the
+// container and every stream
+func probe(ctx context.Context, inputPath string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "quiet",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		inputPath)
+	return cmd.Output()
+}
 
-	duration, err := strconv.ParseFloat(formatParts[0], 64)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse duration: %w", err)
+// ffprobeOutput is the part of ffprobe's JSON output we read. ffprobe leaves
+// out values it can't determine, and prints numbers other than channels as
+// strings.
+type ffprobeOutput struct {
+	Format struct {
+		Duration string            `json:"duration"`
+		Size     string            `json:"size"`
+		BitRate  string            `json:"bit_rate"`
+		Tags     map[string]string `json:"tags"`
+	} `json:"format"`
+	Streams []ffprobeStream `json:"streams"`
+}
+
+type ffprobeStream struct {
+	CodecType   string            `json:"codec_type"`
+	SampleRate  string            `json:"sample_rate"`
+	Channels    int               `json:"channels"`
+	Duration    string            `json:"duration"`
+	BitRate     string            `json:"bit_rate"`
+	Disposition map[string]int    `json:"disposition"`
+	Tags        map[string]string `json:"tags"`
+}
+
+// isArtwork reports whether the stream is an attached cover image
+func (s ffprobeStream) isArtwork() bool {
+	return s.CodecType == "video" && s.Disposition["attached_pic"] == 1
+}
+
+func unmarshalProbe(output []byte) (*ffprobeOutput, error) {
+	var probe ffprobeOutput
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe output: %w", err)
 	}
+	return &probe, nil
+}
 
-	size, err := strconv.ParseInt(formatParts[1], 10, 64)
+// parseAudioInfo reads the container and first audio stream from ffprobe's
+// JSON output. Other streams, such as cover art, are ignored. Missing
+// durations and bitrates fall back to the stream's, then to zero; a missing
+// bitrate is estimated from the size and duration where it can be.
+func parseAudioInfo(output []byte) (*AudioInfo, error) {
+	probe, err := unmarshalProbe(output)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse size: %w", err)
+		return nil, err
 	}
 
-	bitrate, err := strconv.ParseInt(formatParts[2], 10, 64)
-	if err != nil {
-		// Bitrate might be N/A, calculate from size and duration
-		if duration > 0 && size > 0 {
-			bitrate = int64((float64(size) * 8) / (duration * 1000))
+	var stream *ffprobeStream
+	for i := range probe.Streams {
+		if probe.Streams[i].CodecType == "audio" {
+			stream = &probe.Streams[i]
+			break
 		}
 	}
-
-	// Parse stream info (sample_rate, channels)
-	streamParts := strings.Split(lines[1], ",")
-	if len(streamParts) < 2 {
-		return nil, fmt.Errorf("unexpected stream info format")
+	if stream == nil {
+		return nil, errors.New("no audio stream found")
 	}
 
-	sampleRate, err := strconv.Atoi(streamParts[0])
+	sampleRate, err := strconv.Atoi(stream.SampleRate)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse sample rate: %w", err)
+		return nil, fmt.Errorf("failed to parse sample rate %q: %w", stream.SampleRate, err)
 	}
 
-	channels, err := strconv.Atoi(streamParts[1])
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse channels: %w", err)
+	duration := probeFloat(probe.Format.Duration, stream.Duration)
+	size := int64(probeFloat(probe.Format.Size))
+	bitrate := int(probeFloat(probe.Format.BitRate, stream.BitRate) / 1000)
+	if bitrate == 0 && duration > 0 && size > 0 {
+		bitrate = int((float64(size) * 8) / (duration * 1000))
 	}
 
 	return &AudioInfo{
 		Duration:   int(duration),
 		Size:       size,
-		Bitrate:    int(bitrate),
+		Bitrate:    bitrate,
 		SampleRate: sampleRate,
-		Channels:   channels,
+		Channels:   stream.Channels,
 	}, nil
 }
 
-// CompressAudio compresses an audio file to a reasonable streaming quality
-// Target: 128kbps MP3, 44.1kHz sample rate
-func (ap *AudioProcessor) CompressAudio(ctx context.Context, inputPath, outputPath string) error {
-	// Create output directory if it doesn't exist
-	// #nosec G301
-	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
+// probeFloat parses the first of values that is a positive number, or
+// returns zero
+func probeFloat(values ...string) float64 {
+	for _, value := range values {
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil && parsed > 0 {
+			return parsed
+		}
 	}
+	return 0
+}
 
-	// Use ffmpeg to compress the audio
+// parseAudioTags reads tags from ffprobe's JSON output. ID3 tags are on the
+// format and Vorbis comments on the audio stream, and the key case varies
+// by container, so keys are matched case-insensitively in both.
+func parseAudioTags(output []byte) (*AudioTags, error) {
+	probe, err := unmarshalProbe(output)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+	collect := func(tags map[string]string) {
+		for key, value := range tags {
+			key = strings.ToLower(key)
+			if value = strings.TrimSpace(value); value != "" && values[key] == "" {
+				values[key] = value
+			}
+		}
+	}
+	collect(probe.Format.Tags)
+
+	tags := &AudioTags{}
+	for _, stream := range probe.Streams {
+		switch {
+		case stream.CodecType == "audio":
+			collect(stream.Tags)
+		case stream.isArtwork():
+			tags.HasArtwork = true
+		}
+	}
+
+	tags.Title = values["title"]
+	tags.Artist = values["artist"]
+	if tags.Artist == "" {
+		tags.Artist = values["album_artist"]
+	}
+	tags.Album = values["album"]
+	tags.Genre = values["genre"]
+	return tags, nil
+}
+
+// ExtractArtwork writes a file's attached cover image to outputPath as a JPEG
+func (ap *AudioProcessor) ExtractArtwork(ctx context.Context, inputPath, outputPath string) error {
 	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-v", "error",
 		"-i", inputPath,
-		"-codec:a", "libmp3lame", // Use LAME MP3 encoder
-		"-b:a", "128k", // 128 kbps bitrate
-		"-ar", "44100", // 44.1 kHz sample rate
-		"-ac", "2", // Stereo (2 channels)
-		"-f", "mp3", // Output format
-		"-y", // Overwrite output file
+		"-an",
+		"-map", "0:v:0",
+		"-frames:v", "1",
+		"-c:v", "mjpeg",
+		"-f", "image2",
+		"-y",
 		outputPath)
 
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed to compress audio: %w, output: %s", err, string(output))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to extract artwork: %w, output: %s", err, string(output))
 	}
-
-	log.Printf("Successfully compressed audio: %s -> %s", inputPath, outputPath)
 	return nil
 }
 
-// DownloadAndCompress downloads an audio file from a URL and compresses it
-func (ap *AudioProcessor) DownloadAndCompress(ctx context.Context, sourceURL, outputPath string) (*AudioInfo, error) {
-	// Create temporary file for download
-	tempFile, err := os.CreateTemp(ap.tempDir, "audio_download_*")
+// CompressAudio compresses an audio file to a reasonable streaming quality
+// Target: 128kbps MP3, 44.1kHz sample rate, stereo
+func (ap *AudioProcessor) CompressAudio(ctx context.Context, inputPath, outputPath string) error {
+	return ap.compress(ctx, inputPath, outputPath, DefaultCompressionOption, "-ac", "2")
+}
+
+// DefaultWaveformBuckets is how many min/max pairs a track's waveform has
+const DefaultWaveformBuckets = 800
+
+// waveformSampleRate is the mono sample rate audio is decoded at for
+// waveforms; far more than 800 buckets need, and cheap to hold in memory
+const waveformSampleRate = 8000
+
+// Waveform is a downsampled peaks array in the audiowaveform JSON format, which
+// player libraries such as peaks.js read directly. Data holds a min and max
+// 8-bit sample per bucket.
+type Waveform struct {
+	Version         int   `json:"version"`
+	Channels        int   `json:"channels"`
+	SampleRate      int   `json:"sample_rate"`
+	SamplesPerPixel int   `json:"samples_per_pixel"`
+	Bits            int   `json:"bits"`
+	Length          int   `json:"length"`
+	Data            []int `json:"data"`
+}
+
+// GenerateWaveform decodes an audio file to mono with ffmpeg and computes
+// its peaks in up to buckets min/max pairs
+func (ap *AudioProcessor) GenerateWaveform(ctx context.Context, inputPath string, buckets int) (*Waveform, error) {
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-v", "error",
+		"-i", inputPath,
+		"-ac", "1", // Mix down to mono
+		"-ar", strconv.Itoa(waveformSampleRate),
+		"-f", "s16le", // Raw 16-bit little-endian samples
+		"-acodec", "pcm_s16le",
+		"pipe:1")
+
+	output, err := cmd.Output()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create temp file: %w", err)
+		return nil, fmt.Errorf("failed to decode audio for waveform: %w", err)
 	}
-	defer os.Remove(tempFile.Name())
-	defer tempFile.Close()
 
-	// Download the file using curl (more reliable than Go's http client for large files)
-	cmd := exec.CommandContext(ctx, "curl", // #nosec G204 -- Curl execution with controlled args for file download
-		"-L",                  // Follow redirects
-		"-o", tempFile.Name(), // Output to temp file
-		sourceURL)
+	samples := make([]int16, len(output)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(output[i*2:]))
+	}
+	return computeWaveform(samples, waveformSampleRate, buckets)
+}
 
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("failed to download audio file: %w", err)
+// computeWaveform buckets samples into min/max pairs scaled to 8 bits
+func computeWaveform(samples []int16, sampleRate, buckets int) (*Waveform, error) {
+	if len(samples) == 0 {
+		return nil, errors.New("no audio samples to compute a waveform from")
+	}
+	if buckets <= 0 {
+		buckets = DefaultWaveformBuckets
 	}
 
-	// Get info about the original file
-	audioInfo, err := ap.GetAudioInfo(ctx, tempFile.Name())
-	if err != nil {
-		return nil, fmt.Errorf("failed to get audio info: %w", err)
+	samplesPerPixel := (len(samples) + buckets - 1) / buckets
+	waveform := &Waveform{
+		Version:         2,
+		Channels:        1,
+		SampleRate:      sampleRate,
+		SamplesPerPixel: samplesPerPixel,
+		Bits:            8,
 	}
+	for start := 0; start < len(samples); start += samplesPerPixel {
+		end := min(start+samplesPerPixel, len(samples))
+		low, high := samples[start], samples[start]
+		for _, sample := range samples[start+1 : end] {
+			low = min(low, sample)
+			high = max(high, sample)
+		}
+		waveform.Data = append(waveform.Data, int(low>>8), int(high>>8))
+		waveform.Length++
+	}
+	return waveform, nil
+}
 
-	// Compress the audio
-	if err := ap.CompressAudio(ctx, tempFile.Name(), outputPath); err != nil {
-		return nil, fmt.Errorf("failed to compress audio: %w", err)
+// previewBitrate is the MP3 bitrate of preview clips, in kbps
+const previewBitrate = 96
+
+// CreatePreview encodes a clip of an audio file, starting at start and
+// lasting length, as an MP3 for unauthenticated listeners. Silence at the
+// start of the clip is skipped. A zero length clips to the end of the file.
+func (ap *AudioProcessor) CreatePreview(ctx context.Context, inputPath, outputPath string, start, length time.Duration) error {
+	cmd := exec.CommandContext(ctx, "ffmpeg", previewArgs(inputPath, outputPath, start, length)...) // #nosec G204 -- FFmpeg execution with controlled args for audio processing
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create preview: %w, output: %s", err, string(output))
 	}
+	return nil
+}
 
-	return audioInfo, nil
+// previewArgs builds the ffmpeg arguments for CreatePreview
+func previewArgs(inputPath, outputPath string, start, length time.Duration) []string {
+	args := []string{"-v", "error"}
+	if start > 0 {
+		args = append(args, "-ss", strconv.FormatFloat(start.Seconds(), 'f', 3, 64)) // Seek before decoding
+	}
+	args = append(args,
+		"-i", inputPath,
+		"-vn",
+		"-af", "silenceremove=start_periods=1:start_threshold=-50dB", // Skip leading silence
+	)
+	if length > 0 {
+		args = append(args, "-t", strconv.FormatFloat(length.Seconds(), 'f', 3, 64))
+	}
+	return append(args,
+		"-codec:a", "libmp3lame",
+		"-b:a", fmt.Sprintf("%dk", previewBitrate),
+		"-ar", "44100",
+		"-ac", "2",
+		"-f", "mp3",
+		"-y", outputPath,
+	)
 }
 
 // ValidateAudioFile checks if a file is a valid audio file
@@ -188,15 +426,13 @@ func (ap *AudioProcessor) ValidateAudioFile(ctx context.Context, filePath string
 
 // GetSupportedFormats returns a list of supported audio formats
 func (ap *AudioProcessor) GetSupportedFormats() []string {
-	return []string{
-		"mp3", "wav", "flac", "aac", "ogg", "m4a", "wma", "aiff", "au",
-	}
+	return slices.Clone(ap.formats)
 }
 
 // IsFormatSupported checks if an audio format is supported
 func (ap *AudioProcessor) IsFormatSupported(extension string) bool {
 	extension = strings.ToLower(strings.TrimPrefix(extension, "."))
-	for _, format := range ap.GetSupportedFormats() {
+	for _, format := range ap.formats {
 		if format == extension {
 			return true
 		}
@@ -206,47 +442,26 @@ func (ap *AudioProcessor) IsFormatSupported(extension string) bool {
 
 // CompressAudioWithOptions compresses audio with specific user-defined options
 func (ap *AudioProcessor) CompressAudioWithOptions(ctx context.Context, inputPath, outputPath string, options models.CompressionOption) error {
-	log.Printf("Compressing audio with options: %+v", options)
-
-	// Build ffmpeg command based on format and options
-	args := []string{
-		"-i", inputPath,
-		"-y", // Overwrite output file
-	}
+	return ap.compress(ctx, inputPath, outputPath, options)
+}
 
-	// Add format-specific encoding options
-	switch options.Format {
-	case "mp3":
-		args = append(args, "-c:a", "libmp3lame")
-		args = append(args, "-b:a", fmt.Sprintf("%dk", options.Bitrate))
-	case "aac":
-		args = append(args, "-c:a", "aac")
-		args = append(args, "-b:a", fmt.Sprintf("%dk", options.Bitrate))
-	case "ogg":
-		args = append(args, "-c:a", "libvorbis")
-		args = append(args, "-b:a", fmt.Sprintf("%dk", options.Bitrate))
-	default:
-		return fmt.Errorf("unsupported format: %s", options.Format)
-	}
+// compress runs ffmpeg for an option; extraArgs go before the output path
+func (ap *AudioProcessor) compress(ctx context.Context, inputPath, outputPath string, options models.CompressionOption, extraArgs ...string) error {
+	log.Printf("Compressing audio with options: %+v", options)
 
-	// Add sample rate if specified
-	if options.SampleRate > 0 {
-		args = append(args, "-ar", fmt.Sprintf("%d", options.SampleRate))
+	args, err := compressionArgs(inputPath, options)
+	if err != nil {
+		return err
 	}
+	args = append(args, extraArgs...)
+	args = append(args, "-y", outputPath) // Overwrite output file
 
-	// Add quality settings based on quality level
-	switch options.Quality {
-	case "low":
-		args = append(args, "-q:a", "9") // Lower quality, smaller file
-	case "medium":
-		args = append(args, "-q:a", "5") // Balanced
-	case "high":
-		args = append(args, "-q:a", "1") // Higher quality, larger file
+	// Create output directory if it doesn't exist
+	// #nosec G301
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	// Add output path
-	args = append(args, outputPath)
-
 	// Execute ffmpeg
 	cmd := exec.CommandContext(ctx, "ffmpeg", args...) // #nosec G204 -- FFmpeg execution with controlled args for audio processing
 	output, err := cmd.CombinedOutput()
@@ -257,3 +472,44 @@ func (ap *AudioProcessor) CompressAudioWithOptions(ctx context.Context, inputPat
 	log.Printf("Successfully compressed audio with options: %s -> %s", inputPath, outputPath)
 	return nil
 }
+
+// compressionArgs builds the ffmpeg arguments that encode inputPath with an
+// option, up to the output path
+func compressionArgs(inputPath string, options models.CompressionOption) ([]string, error) {
+	format, ok := CompressionFormats[options.Format]
+	if !ok {
+		return nil, fmt.Errorf("unsupported format: %s", options.Format)
+	}
+
+	args := []string{
+		"-i", inputPath,
+		"-c:a", format.Codec,
+		"-b:a", fmt.Sprintf("%dk", options.Bitrate),
+	}
+
+	// Add sample rate if specified; Opus always encodes at 48kHz
+	sampleRate := options.SampleRate
+	if len(format.SampleRates) == 1 {
+		sampleRate = format.SampleRates[0]
+	}
+	if sampleRate > 0 {
+		args = append(args, "-ar", fmt.Sprintf("%d", sampleRate))
+	}
+
+	// Add quality settings based on quality level. Opus's VBR already spends
+	// bits where they're needed, so the bitrate alone sets its quality.
+	if options.Format == "opus" {
+		args = append(args, "-vbr", "on")
+	} else {
+		switch options.Quality {
+		case "low":
+			args = append(args, "-q:a", "9") // Lower quality, smaller file
+		case "medium":
+			args = append(args, "-q:a", "5") // Balanced
+		case "high":
+			args = append(args, "-q:a", "1") // Higher quality, larger file
+		}
+	}
+
+	return append(args, "-f", format.Muxer), nil
+}
@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrFormatMismatch is returned when a file's contents aren't in the format
+// its extension declares
+var ErrFormatMismatch = errors.New("format mismatch")
+
+// sniffLength is how much of a file, after any ID3v2 tag, SniffAudioFormat
+// looks at
+const sniffLength = 16
+
+// maxID3Tags bounds how many stacked ID3v2 tags are skipped before sniffing
+const maxID3Tags = 4
+
+// asfHeaderGUID starts every ASF (WMA) file
+var asfHeaderGUID = []byte{0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11}
+
+// SniffAudioFormat returns the audio format header starts with, named by its
+// usual extension, or "" if it isn't one it recognizes. header starts after
+// any ID3v2 tag.
+func SniffAudioFormat(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, []byte("fLaC")):
+		return "flac"
+	case bytes.HasPrefix(header, []byte("OggS")):
+		return "ogg"
+	case len(header) >= 12 && bytes.HasPrefix(header, []byte("RIFF")) && string(header[8:12]) == "WAVE":
+		return "wav"
+	case len(header) >= 12 && bytes.HasPrefix(header, []byte("FORM")) &&
+		(string(header[8:12]) == "AIFF" || string(header[8:12]) == "AIFC"):
+		return "aiff"
+	case len(header) >= 8 && string(header[4:8]) == "ftyp":
+		return "m4a"
+	case bytes.HasPrefix(header, []byte(".snd")):
+		return "au"
+	case bytes.HasPrefix(header, asfHeaderGUID):
+		return "wma"
+	case bytes.HasPrefix(header, []byte("ADIF")):
+		return "aac"
+	case len(header) >= 2 && header[0] == 0xFF && header[1]&0xF6 == 0xF0:
+		// ADTS frame sync: MPEG layer bits are always zero
+		return "aac"
+	case len(header) >= 2 && header[0] == 0xFF && header[1]&0xE0 == 0xE0 && header[1]&0x06 != 0:
+		// MPEG audio frame sync with a layer set
+		return "mp3"
+	}
+	return ""
+}
+
+// CheckFormat reads the start of filePath and fails with ErrFormatMismatch
+// if it isn't in the format extension declares. It runs before ffprobe, so a
+// mislabeled upload fails without being decoded. Extensions without a known
+// signature pass.
+func (ap *AudioProcessor) CheckFormat(filePath, extension string) error {
+	extension = strings.ToLower(strings.TrimPrefix(extension, "."))
+	if !hasAudioSignature(extension) {
+		return nil
+	}
+
+	file, err := os.Open(filePath) // #nosec G304 -- Reading controlled temp file
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	header, err := readAudioHeader(file)
+	if err != nil {
+		return fmt.Errorf("failed to read file header: %w", err)
+	}
+
+	detected := SniffAudioFormat(header)
+	if detected == extension {
+		return nil
+	}
+	if detected != "" {
+		return fmt.Errorf("%w: file does not appear to be %s (it looks like %s)",
+			ErrFormatMismatch, strings.ToUpper(extension), strings.ToUpper(detected))
+	}
+	return fmt.Errorf("%w: file does not appear to be %s", ErrFormatMismatch, strings.ToUpper(extension))
+}
+
+// hasAudioSignature reports whether SniffAudioFormat recognizes extension's
+// format
+func hasAudioSignature(extension string) bool {
+	switch extension {
+	case "mp3", "wav", "flac", "aac", "ogg", "m4a", "wma", "aiff", "au":
+		return true
+	}
+	return false
+}
+
+// readAudioHeader returns the first bytes of r after any ID3v2 tags, which
+// MP3, AAC and some FLAC files start with
+func readAudioHeader(r io.ReaderAt) ([]byte, error) {
+	var offset int64
+	for range maxID3Tags {
+		header, err := readAt(r, offset, 10)
+		if err != nil {
+			return nil, err
+		}
+		size, ok := id3TagSize(header)
+		if !ok {
+			break
+		}
+		offset += size
+	}
+	return readAt(r, offset, sniffLength)
+}
+
+// id3TagSize returns the length of the ID3v2 tag header starts, including
+// its header and footer
+func id3TagSize(header []byte) (int64, bool) {
+	if len(header) < 10 || !bytes.HasPrefix(header, []byte("ID3")) {
+		return 0, false
+	}
+	// The size is synchsafe: seven bits per byte
+	size := int64(header[6]&0x7F)<<21 | int64(header[7]&0x7F)<<14 | int64(header[8]&0x7F)<<7 | int64(header[9]&0x7F)
+	size += 10
+	if header[5]&0x10 != 0 {
+		size += 10 // Footer
+	}
+	return size, true
+}
+
+// readAt reads up to n bytes from offset; fewer at the end of the file
+func readAt(r io.ReaderAt, offset int64, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	read, err := r.ReadAt(buf, offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return buf[:read], nil
+}
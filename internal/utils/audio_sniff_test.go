@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSniffAudioFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   string
+	}{
+		{"flac", []byte("fLaC\x00\x00\x00\x22"), "flac"},
+		{"ogg", []byte("OggS\x00\x02"), "ogg"},
+		{"wav", []byte("RIFF\x24\x08\x00\x00WAVEfmt "), "wav"},
+		{"avi is riff but not wav", []byte("RIFF\x24\x08\x00\x00AVI LIST"), ""},
+		{"aiff", []byte("FORM\x00\x00\x10\x00AIFFCOMM"), "aiff"},
+		{"aifc", []byte("FORM\x00\x00\x10\x00AIFCFVER"), "aiff"},
+		{"m4a", []byte("\x00\x00\x00\x20ftypM4A "), "m4a"},
+		{"au", []byte(".snd\x00\x00\x00\x18"), "au"},
+		{"wma", []byte{0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11, 0xA6, 0xD9}, "wma"},
+		{"adts aac", []byte{0xFF, 0xF1, 0x50, 0x80}, "aac"},
+		{"mpeg layer 3", []byte{0xFF, 0xFB, 0x90, 0x64}, "mp3"},
+		{"mpeg 2 layer 3", []byte{0xFF, 0xF3, 0x48, 0xC4}, "mp3"},
+		{"executable", []byte("MZ\x90\x00\x03\x00"), ""},
+		{"elf", []byte("\x7fELF\x02\x01"), ""},
+		{"empty", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, SniffAudioFormat(tt.header))
+		})
+	}
+}
+
+func TestCheckFormat(t *testing.T) {
+	ap := NewAudioProcessor(t.TempDir())
+	write := func(name string, data []byte) string {
+		path := filepath.Join(t.TempDir(), name)
+		require.NoError(t, os.WriteFile(path, data, 0o600))
+		return path
+	}
+
+	// An ID3v2 tag (here 20 bytes of body) comes before the first frame
+	id3 := append([]byte("ID3\x04\x00\x00\x00\x00\x00\x14"), make([]byte, 20)...)
+	mp3 := write("tagged.mp3", append(id3, 0xFF, 0xFB, 0x90, 0x64))
+	assert.NoError(t, ap.CheckFormat(mp3, "mp3"))
+	assert.NoError(t, ap.CheckFormat(mp3, ".MP3"))
+
+	flac := write("song.flac", []byte("fLaC\x00\x00\x00\x22"))
+	assert.NoError(t, ap.CheckFormat(flac, "flac"))
+
+	err := ap.CheckFormat(mp3, "flac")
+	assert.ErrorIs(t, err, ErrFormatMismatch)
+	assert.EqualError(t, err, "format mismatch: file does not appear to be FLAC (it looks like MP3)")
+
+	exe := write("song.flac", []byte("MZ\x90\x00\x03\x00\x00\x00"))
+	err = ap.CheckFormat(exe, "flac")
+	assert.ErrorIs(t, err, ErrFormatMismatch)
+	assert.EqualError(t, err, "format mismatch: file does not appear to be FLAC")
+
+	// Too short to be anything
+	assert.ErrorIs(t, ap.CheckFormat(write("tiny.wav", []byte("RI")), "wav"), ErrFormatMismatch)
+
+	// Formats without a known signature aren't sniffed
+	assert.NoError(t, ap.CheckFormat(exe, "opus"))
+
+	err = ap.CheckFormat(filepath.Join(t.TempDir(), "missing.wav"), "wav")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrFormatMismatch)
+}
+
+func TestWithSupportedFormats(t *testing.T) {
+	ap := NewAudioProcessor(t.TempDir(), WithSupportedFormats([]string{"mp3", "flac"}))
+	assert.True(t, ap.IsFormatSupported("MP3"))
+	assert.True(t, ap.IsFormatSupported(".flac"))
+	assert.False(t, ap.IsFormatSupported("wma"))
+	assert.Equal(t, []string{"mp3", "flac"}, ap.GetSupportedFormats())
+
+	// An empty list keeps the defaults
+	assert.Equal(t, AudioFormats, NewAudioProcessor(t.TempDir(), WithSupportedFormats(nil)).GetSupportedFormats())
+}
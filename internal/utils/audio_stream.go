@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"strings"
+
+	"github.com/wavlake/api/internal/models"
+)
+
+// StreamableFormats are the original formats ffmpeg can decode from a pipe,
+// keyed by extension, with the demuxer that reads them. Containers such as
+// m4a may keep their index at the end of the file and need to seek.
+var StreamableFormats = map[string]string{
+	"mp3":  "mp3",
+	"flac": "flac",
+	"wav":  "wav",
+}
+
+// IsStreamable reports whether originals with an extension can be compressed
+// from a pipe
+func IsStreamable(extension string) bool {
+	_, ok := StreamableFormats[strings.ToLower(strings.TrimPrefix(extension, "."))]
+	return ok
+}
+
+// CompressStream compresses an original read from input, writing the encoded
+// audio to output. Neither side touches disk.
+func (ap *AudioProcessor) CompressStream(ctx context.Context, input io.Reader, inputFormat string, output io.Writer, options models.CompressionOption) error {
+	log.Printf("Compressing audio stream with options: %+v", options)
+
+	args, err := streamCompressionArgs(inputFormat, options)
+	if err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...) // #nosec G204 -- FFmpeg execution with controlled args for audio processing
+	cmd.Stdin = input
+	cmd.Stdout = output
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to compress audio stream with options %+v: %w, output: %s", options, err, stderr.String())
+	}
+	return nil
+}
+
+// streamCompressionArgs builds the ffmpeg arguments that encode a piped
+// original with an option, writing to stdout. Only errors are logged, since
+// stderr is buffered for the length of the encode.
+func streamCompressionArgs(inputFormat string, options models.CompressionOption) ([]string, error) {
+	demuxer, ok := StreamableFormats[strings.ToLower(inputFormat)]
+	if !ok {
+		return nil, fmt.Errorf("format %s can't be streamed", inputFormat)
+	}
+
+	args, err := compressionArgs("pipe:0", options)
+	if err != nil {
+		return nil, err
+	}
+	args = append([]string{"-v", "error", "-f", demuxer}, args...)
+	return append(args, "pipe:1"), nil
+}
+
+// ProbeStream reads audio info from the start of an original, so a file
+// compressed from a pipe can be checked without downloading it. Formats that
+// record their length in the header (FLAC, WAV, MP3 with a Xing header) give
+// a duration; the size is left unknown.
+func (ap *AudioProcessor) ProbeStream(ctx context.Context, input io.Reader, inputFormat string) (*AudioInfo, error) {
+	demuxer, ok := StreamableFormats[strings.ToLower(inputFormat)]
+	if !ok {
+		return nil, fmt.Errorf("format %s can't be streamed", inputFormat)
+	}
+
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "quiet",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		"-f", demuxer,
+		"pipe:0") // #nosec G204 -- FFprobe execution with controlled args
+	cmd.Stdin = input
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe audio stream: %w", err)
+	}
+
+	info, err := parseAudioInfo(output)
+	if err != nil {
+		return nil, err
+	}
+	info.Size = 0
+	return info, nil
+}
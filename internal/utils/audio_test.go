@@ -0,0 +1,197 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wavlake/api/internal/models"
+)
+
+func TestCompressionArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		option models.CompressionOption
+		want   []string
+	}{
+		{
+			"default mp3",
+			DefaultCompressionOption,
+			[]string{"-i", "in.wav", "-c:a", "libmp3lame", "-b:a", "128k", "-ar", "44100", "-f", "mp3"},
+		},
+		{
+			"aac with quality",
+			models.CompressionOption{Format: "aac", Bitrate: 256, Quality: "high"},
+			[]string{"-i", "in.wav", "-c:a", "aac", "-b:a", "256k", "-q:a", "1", "-f", "adts"},
+		},
+		{
+			// Opus ignores quality and always encodes at 48kHz
+			"opus data saver",
+			models.CompressionOption{Format: "opus", Bitrate: 24, Quality: "low", SampleRate: 44100},
+			[]string{"-i", "in.wav", "-c:a", "libopus", "-b:a", "24k", "-ar", "48000", "-vbr", "on", "-f", "opus"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := compressionArgs("in.wav", tt.option)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, args)
+		})
+	}
+
+	_, err := compressionArgs("in.wav", models.CompressionOption{Format: "wma", Bitrate: 128})
+	assert.EqualError(t, err, "unsupported format: wma")
+}
+
+func TestStreamCompressionArgs(t *testing.T) {
+	args, err := streamCompressionArgs("FLAC", DefaultCompressionOption)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"-v", "error", "-f", "flac",
+		"-i", "pipe:0", "-c:a", "libmp3lame", "-b:a", "128k", "-ar", "44100", "-f", "mp3",
+		"pipe:1",
+	}, args)
+
+	_, err = streamCompressionArgs("m4a", DefaultCompressionOption)
+	assert.EqualError(t, err, "format m4a can't be streamed")
+}
+
+func TestIsStreamable(t *testing.T) {
+	assert.True(t, IsStreamable("wav"))
+	assert.True(t, IsStreamable(".FLAC"))
+	assert.True(t, IsStreamable("mp3"))
+	assert.False(t, IsStreamable("m4a"))
+	assert.False(t, IsStreamable("aiff"))
+}
+
+func TestComputeWaveform(t *testing.T) {
+	samples := []int16{0, 256, -512, 1024, 32767, -32768, 100}
+
+	waveform, err := computeWaveform(samples, 8000, 3)
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, waveform.SamplesPerPixel)
+	assert.Equal(t, 3, waveform.Length)
+	assert.Equal(t, []int{-2, 1, -128, 127, 0, 0}, waveform.Data)
+	assert.Equal(t, 8, waveform.Bits)
+	assert.Equal(t, 8000, waveform.SampleRate)
+
+	// Short files get fewer buckets than asked for
+	waveform, err = computeWaveform(samples[:2], 8000, 800)
+	require.NoError(t, err)
+	assert.Equal(t, 2, waveform.Length)
+
+	_, err = computeWaveform(nil, 8000, 800)
+	assert.Error(t, err)
+}
+
+// readProbeFixture returns recorded ffprobe output from testdata/ffprobe, so
+// the parsers are tested without ffmpeg installed
+func readProbeFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "ffprobe", name+".json"))
+	require.NoError(t, err)
+	return data
+}
+
+func TestParseAudioInfo(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    AudioInfo
+	}{
+		{"mp3", AudioInfo{Duration: 187, Size: 7512094, Bitrate: 320, SampleRate: 44100, Channels: 2}},
+		{"flac", AudioInfo{Duration: 240, Size: 98304000, Bitrate: 3276, SampleRate: 96000, Channels: 2}},
+		// The cover art stream comes first and has no sample rate
+		{"m4a_with_art", AudioInfo{Duration: 212, Size: 6891427, Bitrate: 259, SampleRate: 48000, Channels: 2}},
+		{"mono_wav", AudioInfo{Duration: 60, Size: 2646044, Bitrate: 352, SampleRate: 22050, Channels: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			info, err := parseAudioInfo(readProbeFixture(t, tt.fixture))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, *info)
+		})
+	}
+}
+
+func TestParseAudioInfoMissingValues(t *testing.T) {
+	// No container duration or any bitrate: the stream's duration is used and
+	// the bitrate estimated from it
+	info, err := parseAudioInfo([]byte(`{
+		"streams": [{"codec_type": "audio", "sample_rate": "44100", "channels": 2, "duration": "10.5"}],
+		"format": {"size": "168000", "bit_rate": "N/A"}
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, AudioInfo{Duration: 10, Size: 168000, Bitrate: 128, SampleRate: 44100, Channels: 2}, *info)
+
+	// Nothing to estimate from leaves them zero
+	info, err = parseAudioInfo([]byte(`{"streams": [{"codec_type": "audio", "sample_rate": "48000", "channels": 1}], "format": {}}`))
+	require.NoError(t, err)
+	assert.Equal(t, AudioInfo{SampleRate: 48000, Channels: 1}, *info)
+
+	_, err = parseAudioInfo([]byte(`{"streams": [{"codec_type": "video"}], "format": {"duration": "10"}}`))
+	assert.ErrorContains(t, err, "no audio stream")
+
+	_, err = parseAudioInfo([]byte(`{"streams": [{"codec_type": "audio", "sample_rate": "N/A"}], "format": {}}`))
+	assert.ErrorContains(t, err, "sample rate")
+
+	_, err = parseAudioInfo([]byte("duration,size"))
+	assert.Error(t, err)
+}
+
+func TestParseAudioTags(t *testing.T) {
+	// An MP3 with ID3 tags on the format and cover art as a video stream
+	tags, err := parseAudioTags([]byte(`{
+		"streams": [
+			{"codec_type": "audio", "disposition": {"attached_pic": 0}},
+			{"codec_type": "video", "disposition": {"attached_pic": 1}}
+		],
+		"format": {"tags": {"title": "Night Drive", "artist": "The Wavs", "album": "Routes", "genre": "Synthwave"}}
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, &AudioTags{Title: "Night Drive", Artist: "The Wavs", Album: "Routes", Genre: "Synthwave", HasArtwork: true}, tags)
+
+	// Vorbis comments are upper case and on the audio stream
+	tags, err = parseAudioTags([]byte(`{
+		"streams": [{"codec_type": "audio", "tags": {"TITLE": "Tide", "ALBUM_ARTIST": "Shore", "GENRE": " "}}],
+		"format": {}
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, &AudioTags{Title: "Tide", Artist: "Shore"}, tags)
+
+	tags, err = parseAudioTags(readProbeFixture(t, "m4a_with_art"))
+	require.NoError(t, err)
+	assert.Equal(t, &AudioTags{Title: "Harbour Lights", Artist: "Shore", Album: "Coastal", HasArtwork: true}, tags)
+
+	// A video stream that isn't cover art doesn't count
+	tags, err = parseAudioTags([]byte(`{"streams": [{"codec_type": "video"}], "format": {}}`))
+	require.NoError(t, err)
+	assert.False(t, tags.HasArtwork)
+
+	_, err = parseAudioTags([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestPreviewArgs(t *testing.T) {
+	args := previewArgs("in.wav", "out.mp3", 18*time.Second, 30*time.Second)
+	assert.Equal(t, []string{
+		"-v", "error",
+		"-ss", "18.000",
+		"-i", "in.wav",
+		"-vn",
+		"-af", "silenceremove=start_periods=1:start_threshold=-50dB",
+		"-t", "30.000",
+		"-codec:a", "libmp3lame", "-b:a", "96k", "-ar", "44100", "-ac", "2",
+		"-f", "mp3", "-y", "out.mp3",
+	}, args)
+
+	// The whole file: no seek and no length
+	args = previewArgs("in.wav", "out.mp3", 0, 0)
+	assert.NotContains(t, args, "-ss")
+	assert.NotContains(t, args, "-t")
+}
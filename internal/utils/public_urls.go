@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// PublicURLConfig holds the base URLs used for externally visible links. An
+// unset base keeps the URL derived from the bucket name or request path.
+type PublicURLConfig struct {
+	MediaBaseURL string // PUBLIC_MEDIA_BASE_URL, e.g. https://media.wavlake.com
+	APIBaseURL   string // PUBLIC_API_BASE_URL, e.g. https://api.wavlake.com
+}
+
+// GetPublicURLConfig reads PUBLIC_MEDIA_BASE_URL and PUBLIC_API_BASE_URL
+func GetPublicURLConfig() (*PublicURLConfig, error) {
+	mediaBaseURL, err := normalizeBaseURL("PUBLIC_MEDIA_BASE_URL", os.Getenv("PUBLIC_MEDIA_BASE_URL"))
+	if err != nil {
+		return nil, err
+	}
+
+	apiBaseURL, err := normalizeBaseURL("PUBLIC_API_BASE_URL", os.Getenv("PUBLIC_API_BASE_URL"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &PublicURLConfig{
+		MediaBaseURL: mediaBaseURL,
+		APIBaseURL:   apiBaseURL,
+	}, nil
+}
+
+// normalizeBaseURL checks that a base URL is absolute and strips trailing slashes
+func normalizeBaseURL(name, raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" || parsed.RawQuery != "" || parsed.Fragment != "" {
+		return "", fmt.Errorf("invalid %s %q: must be an absolute http(s) URL without query or fragment", name, raw)
+	}
+
+	return strings.TrimRight(raw, "/"), nil
+}
+
+// APIURL returns the absolute URL for an API path, or the path unchanged when
+// no API base is configured
+func (c *PublicURLConfig) APIURL(path string) string {
+	if c == nil || c.APIBaseURL == "" {
+		return path
+	}
+	return c.APIBaseURL + "/" + strings.TrimPrefix(path, "/")
+}
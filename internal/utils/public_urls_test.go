@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublicURLConfigUnset(t *testing.T) {
+	t.Setenv("PUBLIC_MEDIA_BASE_URL", "")
+	t.Setenv("PUBLIC_API_BASE_URL", "")
+
+	config, err := GetPublicURLConfig()
+	require.NoError(t, err)
+
+	assert.Empty(t, config.MediaBaseURL)
+	assert.Equal(t, "/v1/users/me/export/job-1", config.APIURL("/v1/users/me/export/job-1"))
+
+	// A nil config behaves as unset
+	var none *PublicURLConfig
+	assert.Equal(t, "/v1/tracks/abc", none.APIURL("/v1/tracks/abc"))
+}
+
+func TestPublicURLConfigConfigured(t *testing.T) {
+	t.Setenv("PUBLIC_MEDIA_BASE_URL", "https://media.wavlake.com/")
+	t.Setenv("PUBLIC_API_BASE_URL", " https://api.wavlake.com/base ")
+
+	config, err := GetPublicURLConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "https://media.wavlake.com", config.MediaBaseURL)
+	assert.Equal(t, "https://api.wavlake.com/base", config.APIBaseURL)
+
+	assert.Equal(t, "https://api.wavlake.com/base/v1/users/me/export/job-1", config.APIURL("/v1/users/me/export/job-1"))
+}
+
+func TestPublicURLConfigInvalid(t *testing.T) {
+	for _, raw := range []string{"media.wavlake.com", "ftp://media.wavlake.com", "https://", "https://media.wavlake.com/?v=1"} {
+		t.Setenv("PUBLIC_MEDIA_BASE_URL", raw)
+		_, err := GetPublicURLConfig()
+		assert.Error(t, err, raw)
+	}
+
+	t.Setenv("PUBLIC_MEDIA_BASE_URL", "")
+	t.Setenv("PUBLIC_API_BASE_URL", "/relative")
+	_, err := GetPublicURLConfig()
+	assert.Error(t, err)
+}
@@ -2,22 +2,50 @@ package utils
 
 import (
 	"fmt"
+	"os"
+	"strings"
 )
 
 // StoragePathConfig holds path configuration for different storage providers
 type StoragePathConfig struct {
 	OriginalPrefix   string
 	CompressedPrefix string
+	WaveformPrefix   string
+	ArtworkPrefix    string
+	PreviewPrefix    string
 	UseLegacyPaths   bool
 }
 
-// GetStoragePathConfig returns a fixed path configuration for GCS storage.
-// The paths are set to standard prefixes: 'tracks/original' and 'tracks/compressed'.
-
+// GetStoragePathConfig returns the path configuration for the storage backend
+// named by STORAGE_PROVIDER
 func GetStoragePathConfig() *StoragePathConfig {
+	return GetStoragePathConfigFor(os.Getenv("STORAGE_PROVIDER"))
+}
+
+// GetStoragePathConfigFor returns the path configuration for a storage
+// provider. GCS uses the standard prefixes: 'tracks/original',
+// 'tracks/compressed', 'tracks/waveform', 'tracks/artwork' and
+// 'tracks/preview'. Azure blob names keep the same virtual directories, so a
+// container copied from a bucket resolves the same paths.
+func GetStoragePathConfigFor(provider string) *StoragePathConfig {
+	switch strings.ToLower(strings.TrimSpace(provider)) {
+	case "azure":
+		return &StoragePathConfig{
+			OriginalPrefix:   "tracks/original",
+			CompressedPrefix: "tracks/compressed",
+			WaveformPrefix:   "tracks/waveform",
+			ArtworkPrefix:    "tracks/artwork",
+			PreviewPrefix:    "tracks/preview",
+			UseLegacyPaths:   false,
+		}
+	}
+
 	config := &StoragePathConfig{
 		OriginalPrefix:   "tracks/original",
 		CompressedPrefix: "tracks/compressed",
+		WaveformPrefix:   "tracks/waveform",
+		ArtworkPrefix:    "tracks/artwork",
+		PreviewPrefix:    "tracks/preview",
 		UseLegacyPaths:   false,
 	}
 
@@ -39,6 +67,27 @@ func (c *StoragePathConfig) GetCompressedVersionPath(trackID, versionID, format
 	return fmt.Sprintf("%s/%s_%s.%s", c.CompressedPrefix, trackID, versionID, format)
 }
 
+// GetCompressedVersionPrefix returns the prefix every compression version
+// path of a track starts with
+func (c *StoragePathConfig) GetCompressedVersionPrefix(trackID string) string {
+	return fmt.Sprintf("%s/%s_", c.CompressedPrefix, trackID)
+}
+
+// GetWaveformPath returns the storage path for a track's waveform peaks JSON
+func (c *StoragePathConfig) GetWaveformPath(trackID string) string {
+	return fmt.Sprintf("%s/%s.json", c.WaveformPrefix, trackID)
+}
+
+// GetArtworkPath returns the storage path for a track's embedded cover art
+func (c *StoragePathConfig) GetArtworkPath(trackID string) string {
+	return fmt.Sprintf("%s/%s.jpg", c.ArtworkPrefix, trackID)
+}
+
+// GetPreviewPath returns the storage path for a track's preview clip
+func (c *StoragePathConfig) GetPreviewPath(trackID string) string {
+	return fmt.Sprintf("%s/%s.mp3", c.PreviewPrefix, trackID)
+}
+
 // IsOriginalPath checks if a given path is in the original files directory
 func (c *StoragePathConfig) IsOriginalPath(objectPath string) bool {
 	expectedPrefix := c.OriginalPrefix + "/"
@@ -12,13 +12,28 @@ func TestStoragePathConfigGCS(t *testing.T) {
 
 	assert.Equal(t, "tracks/original", config.OriginalPrefix)
 	assert.Equal(t, "tracks/compressed", config.CompressedPrefix)
+	assert.Equal(t, "tracks/waveform", config.WaveformPrefix)
+	assert.Equal(t, "tracks/artwork", config.ArtworkPrefix)
+	assert.Equal(t, "tracks/preview", config.PreviewPrefix)
 	assert.False(t, config.UseLegacyPaths)
 }
 
+func TestStoragePathConfigAzure(t *testing.T) {
+	// Azure keeps the GCS layout so objects move between backends unchanged
+	assert.Equal(t, GetStoragePathConfigFor("gcs"), GetStoragePathConfigFor("azure"))
+	assert.Equal(t, GetStoragePathConfigFor(""), GetStoragePathConfigFor(" Azure "))
+
+	t.Setenv("STORAGE_PROVIDER", "azure")
+	assert.Equal(t, "tracks/original/abc.wav", GetStoragePathConfig().GetOriginalPath("abc", "wav"))
+}
+
 func TestStoragePathMethods(t *testing.T) {
 	config := &StoragePathConfig{
 		OriginalPrefix:   "tracks/original",
 		CompressedPrefix: "tracks/compressed",
+		WaveformPrefix:   "tracks/waveform",
+		ArtworkPrefix:    "tracks/artwork",
+		PreviewPrefix:    "tracks/preview",
 		UseLegacyPaths:   false,
 	}
 
@@ -39,6 +54,18 @@ func TestStoragePathMethods(t *testing.T) {
 	versionPath := config.GetCompressedVersionPath(trackID, versionID, format)
 	expectedVersion := "tracks/compressed/12345678-1234-5678-9012-123456789012_v1.aac"
 	assert.Equal(t, expectedVersion, versionPath)
+
+	waveformPath := config.GetWaveformPath(trackID)
+	expectedWaveform := "tracks/waveform/12345678-1234-5678-9012-123456789012.json"
+	assert.Equal(t, expectedWaveform, waveformPath)
+
+	artworkPath := config.GetArtworkPath(trackID)
+	expectedArtwork := "tracks/artwork/12345678-1234-5678-9012-123456789012.jpg"
+	assert.Equal(t, expectedArtwork, artworkPath)
+
+	previewPath := config.GetPreviewPath(trackID)
+	expectedPreview := "tracks/preview/12345678-1234-5678-9012-123456789012.mp3"
+	assert.Equal(t, expectedPreview, previewPath)
 }
 
 func TestStoragePathValidation(t *testing.T) {
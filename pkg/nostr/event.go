@@ -1,27 +1,191 @@
 package nostr
 
 import (
-	"log"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
 
 	gonostr "github.com/nbd-wtf/go-nostr"
 )
 
+// Reasons an event fails verification. VerifyWithReason wraps them with
+// detail; match them with errors.Is.
+var (
+	ErrEventIDMismatch  = errors.New("event ID does not match its contents")
+	ErrMalformedEvent   = errors.New("event ID, pubkey or signature is malformed")
+	ErrInvalidSignature = errors.New("signature does not match the event")
+)
+
+var logger atomic.Pointer[slog.Logger]
+
+func init() {
+	logger.Store(slog.New(slog.DiscardHandler))
+}
+
+// SetLogger sets where verification failures are logged, at debug level.
+// Nothing is logged until a logger is set; nil turns logging off again.
+func SetLogger(l *slog.Logger) {
+	if l == nil {
+		l = slog.New(slog.DiscardHandler)
+	}
+	logger.Store(l)
+}
+
+// Reasons ParseEvent rejects data, besides ErrMalformedEvent. Match them with
+// errors.Is.
+var (
+	ErrEventTooLarge = errors.New("event exceeds size limits")
+	ErrInvalidJSON   = errors.New("event is not valid JSON")
+)
+
+// Limits ParseEvent applies when ParseOptions leaves them zero. They are far
+// above what auth and track events need.
+const (
+	DefaultMaxEventBytes   = 64 << 10
+	DefaultMaxEventTags    = 500
+	DefaultMaxContentBytes = 32 << 10
+)
+
+// ParseOptions bounds what ParseEvent accepts; zero fields use the defaults
+type ParseOptions struct {
+	MaxBytes        int // Serialized JSON
+	MaxTags         int
+	MaxContentBytes int
+}
+
+func (o ParseOptions) withDefaults() ParseOptions {
+	if o.MaxBytes <= 0 {
+		o.MaxBytes = DefaultMaxEventBytes
+	}
+	if o.MaxTags <= 0 {
+		o.MaxTags = DefaultMaxEventTags
+	}
+	if o.MaxContentBytes <= 0 {
+		o.MaxContentBytes = DefaultMaxContentBytes
+	}
+	return o
+}
+
+// ParseEvent decodes an event from JSON, rejecting data over the size limits
+// before decoding it and events whose ID, pubkey or signature aren't
+// lowercase hex of the right length. The ID and signature aren't verified.
+func ParseEvent(data []byte, opts ParseOptions) (*Event, error) {
+	opts = opts.withDefaults()
+	if len(data) > opts.MaxBytes {
+		return nil, fmt.Errorf("%w: %d bytes, limit %d", ErrEventTooLarge, len(data), opts.MaxBytes)
+	}
+
+	var event gonostr.Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+	}
+
+	if len(event.Tags) > opts.MaxTags {
+		return nil, fmt.Errorf("%w: %d tags, limit %d", ErrEventTooLarge, len(event.Tags), opts.MaxTags)
+	}
+	if len(event.Content) > opts.MaxContentBytes {
+		return nil, fmt.Errorf("%w: %d bytes of content, limit %d", ErrEventTooLarge, len(event.Content), opts.MaxContentBytes)
+	}
+
+	switch {
+	case !gonostr.IsValid32ByteHex(event.ID):
+		return nil, fmt.Errorf("%w: id must be 64 lowercase hex characters", ErrMalformedEvent)
+	case !gonostr.IsValid32ByteHex(event.PubKey):
+		return nil, fmt.Errorf("%w: pubkey must be 64 lowercase hex characters", ErrMalformedEvent)
+	case !isLowerHex(event.Sig, 128):
+		return nil, fmt.Errorf("%w: sig must be 128 lowercase hex characters", ErrMalformedEvent)
+	}
+
+	return &Event{Event: &event}, nil
+}
+
+func isLowerHex(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if (s[i] < '0' || s[i] > '9') && (s[i] < 'a' || s[i] > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
 // Event wraps the go-nostr Event to maintain API compatibility
 type Event struct {
 	*gonostr.Event
 }
 
+// Verify reports whether the event's ID and signature are valid
 func (e *Event) Verify() bool {
-	log.Printf("Event Verify Debug - Using go-nostr CheckSignature for event ID: %s", e.ID)
-	log.Printf("Event Verify Debug - PubKey: %s", e.PubKey)
-	log.Printf("Event Verify Debug - Signature: %s", e.Sig)
+	return e.VerifyWithReason() == nil
+}
+
+// VerifyWithReason checks the event's ID and signature and returns why they
+// aren't valid, or nil
+func (e *Event) VerifyWithReason() error {
+	err := e.verify()
+	if err != nil {
+		logger.Load().Debug("nostr event verification failed", "event_id", e.ID, "pubkey", e.PubKey, "kind", e.Kind, "error", err)
+	}
+	return err
+}
 
-	isValid, err := e.Event.CheckSignature()
+// verify hashes the event once for both checks and skips the Schnorr check
+// for an event verified recently
+func (e *Event) verify() error {
+	hash := eventHash(e.Event)
+	if !matchesID(hash, e.ID) {
+		return ErrEventIDMismatch
+	}
+	if verified.contains(e.ID, e.Sig) {
+		return nil
+	}
+
+	ok, err := verifySignature(e.PubKey, e.Sig, hash)
 	if err != nil {
-		log.Printf("Event Verify Debug - CheckSignature error: %v", err)
+		return err
+	}
+	if !ok {
+		return ErrInvalidSignature
+	}
+	verified.add(e.ID, e.Sig)
+	return nil
+}
+
+// matchesID reports whether id is the lowercase hex of hash
+func matchesID(hash [32]byte, id string) bool {
+	const hexDigits = "0123456789abcdef"
+	if len(id) != 64 {
 		return false
 	}
+	for i, b := range hash {
+		if id[2*i] != hexDigits[b>>4] || id[2*i+1] != hexDigits[b&0x0f] {
+			return false
+		}
+	}
+	return true
+}
+
+// GetTagValue returns the value of the first tag named name that has one
+func (e *Event) GetTagValue(name string) (string, bool) {
+	for _, tag := range e.Tags {
+		if len(tag) >= 2 && tag[0] == name {
+			return tag[1], true
+		}
+	}
+	return "", false
+}
 
-	log.Printf("Event Verify Debug - Signature verification result: %t", isValid)
-	return isValid
+// GetAllTagValues returns the values of every tag named name, in order
+func (e *Event) GetAllTagValues(name string) []string {
+	var values []string
+	for _, tag := range e.Tags {
+		if len(tag) >= 2 && tag[0] == name {
+			values = append(values, tag[1])
+		}
+	}
+	return values
 }
@@ -0,0 +1,110 @@
+package nostr
+
+import (
+	"strconv"
+	"time"
+
+	gonostr "github.com/nbd-wtf/go-nostr"
+)
+
+// KindMusicTrack is the addressable event kind Wavlake publishes tracks as
+const KindMusicTrack = 31337
+
+// AudioFile describes one playable file of a track for an imeta tag. Zero
+// fields are left out of the tag.
+type AudioFile struct {
+	URL          string
+	MimeType     string // The "m" entry, e.g. "audio/mpeg"
+	Size         int64  // Bytes
+	Duration     int    // Seconds
+	Hash         string // SHA-256 hex, the "x" entry
+	OriginalHash string // SHA-256 hex of the file this one was transcoded from, the "ox" entry
+}
+
+// EventBuilder assembles an unsigned event draft. Setters skip empty values,
+// so callers can pass optional metadata without checking it first.
+type EventBuilder struct {
+	kind    int
+	content string
+	tags    gonostr.Tags
+}
+
+// NewEventBuilder starts a draft of the given kind
+func NewEventBuilder(kind int) *EventBuilder {
+	return &EventBuilder{kind: kind, tags: gonostr.Tags{}}
+}
+
+// Tag appends a tag unless value is empty
+func (b *EventBuilder) Tag(name, value string, extra ...string) *EventBuilder {
+	if value == "" {
+		return b
+	}
+	b.tags = append(b.tags, append(gonostr.Tag{name, value}, extra...))
+	return b
+}
+
+// DTag sets the identifier that makes the event addressable
+func (b *EventBuilder) DTag(d string) *EventBuilder {
+	return b.Tag("d", d)
+}
+
+// Title adds a title tag
+func (b *EventBuilder) Title(title string) *EventBuilder {
+	return b.Tag("title", title)
+}
+
+// Artist adds an artist tag
+func (b *EventBuilder) Artist(artist string) *EventBuilder {
+	return b.Tag("artist", artist)
+}
+
+// Content sets the event content
+func (b *EventBuilder) Content(content string) *EventBuilder {
+	b.content = content
+	return b
+}
+
+// AudioFile adds a NIP-92 imeta tag for a file. Files without a URL are
+// skipped.
+func (b *EventBuilder) AudioFile(file AudioFile) *EventBuilder {
+	if file.URL == "" {
+		return b
+	}
+	b.tags = append(b.tags, ImetaTag(file))
+	return b
+}
+
+// ImetaTag returns the imeta tag for a file: url, m, size, duration, x and ox
+// entries, each "<key> <value>"
+func ImetaTag(file AudioFile) gonostr.Tag {
+	tag := gonostr.Tag{"imeta", "url " + file.URL}
+	if file.MimeType != "" {
+		tag = append(tag, "m "+file.MimeType)
+	}
+	if file.Size > 0 {
+		tag = append(tag, "size "+strconv.FormatInt(file.Size, 10))
+	}
+	if file.Duration > 0 {
+		tag = append(tag, "duration "+strconv.Itoa(file.Duration))
+	}
+	if file.Hash != "" {
+		tag = append(tag, "x "+file.Hash)
+	}
+	if file.OriginalHash != "" {
+		tag = append(tag, "ox "+file.OriginalHash)
+	}
+	return tag
+}
+
+// Draft returns the unsigned event. ID, PubKey and Sig are left for the
+// signer to fill in.
+func (b *EventBuilder) Draft(createdAt time.Time) *gonostr.Event {
+	tags := make(gonostr.Tags, len(b.tags))
+	copy(tags, b.tags)
+	return &gonostr.Event{
+		Kind:      b.kind,
+		CreatedAt: gonostr.Timestamp(createdAt.Unix()),
+		Tags:      tags,
+		Content:   b.content,
+	}
+}
@@ -0,0 +1,51 @@
+package nostr
+
+import (
+	"testing"
+	"time"
+
+	gonostr "github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventBuilderDraft(t *testing.T) {
+	createdAt := time.Unix(1700000000, 0)
+
+	event := NewEventBuilder(KindMusicTrack).
+		DTag("d-123").
+		Title("Song").
+		Artist("").
+		AudioFile(AudioFile{URL: "https://cdn.example.com/a.mp3", MimeType: "audio/mpeg", Size: 2048, Duration: 180, Hash: "abc123", OriginalHash: "def456"}).
+		AudioFile(AudioFile{URL: "https://cdn.example.com/a.ogg", MimeType: "audio/ogg"}).
+		AudioFile(AudioFile{}).
+		Draft(createdAt)
+
+	assert.Equal(t, KindMusicTrack, event.Kind)
+	assert.Equal(t, gonostr.Timestamp(1700000000), event.CreatedAt)
+	assert.Empty(t, event.ID)
+	assert.Empty(t, event.PubKey)
+	assert.Empty(t, event.Sig)
+	assert.Equal(t, gonostr.Tags{
+		{"d", "d-123"},
+		{"title", "Song"},
+		{"imeta", "url https://cdn.example.com/a.mp3", "m audio/mpeg", "size 2048", "duration 180", "x abc123", "ox def456"},
+		{"imeta", "url https://cdn.example.com/a.ogg", "m audio/ogg"},
+	}, event.Tags)
+	assert.Equal(t, "d-123", event.Tags.GetD())
+}
+
+func TestEventBuilderDraftCanBeSigned(t *testing.T) {
+	builder := NewEventBuilder(KindMusicTrack).DTag("d-123").Content("liner notes")
+	event := builder.Draft(time.Now())
+
+	require.NoError(t, event.Sign(gonostr.GeneratePrivateKey()))
+	ok, err := event.CheckSignature()
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// Signing a draft doesn't change the builder's later drafts
+	event.Tags = append(event.Tags, gonostr.Tag{"t", "extra"})
+	assert.Len(t, builder.Draft(time.Now()).Tags, 1)
+	assert.Equal(t, "liner notes", event.Content)
+}
@@ -1,9 +1,12 @@
 package nostr
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"log/slog"
+	"strings"
 	"testing"
 
 	nostr "github.com/nbd-wtf/go-nostr"
@@ -215,6 +218,135 @@ func (suite *NostrEventTestSuite) TestEmptyTagsAndContent() {
 	assert.Equal(suite.T(), "", parsed[5])
 }
 
+func (suite *NostrEventTestSuite) TestVerifyWithReason() {
+	signed := func() *Event {
+		event := &Event{Event: &nostr.Event{
+			CreatedAt: nostr.Timestamp(1682327852),
+			Kind:      27235,
+			Tags:      nostr.Tags{{"u", "https://api.example.com/test"}, {"method", "GET"}},
+		}}
+		suite.Require().NoError(event.Sign(nostr.GeneratePrivateKey()))
+		return event
+	}
+
+	suite.NoError(signed().VerifyWithReason())
+
+	tampered := signed()
+	tampered.Content = "changed"
+	suite.ErrorIs(tampered.VerifyWithReason(), ErrEventIDMismatch)
+
+	wrongSig := signed()
+	other := signed()
+	wrongSig.Sig = other.Sig
+	suite.ErrorIs(wrongSig.VerifyWithReason(), ErrInvalidSignature)
+
+	badPubkey := signed()
+	badPubkey.PubKey = "not-hex"
+	badPubkey.ID = badPubkey.GetID()
+	suite.ErrorIs(badPubkey.VerifyWithReason(), ErrMalformedEvent)
+	suite.False(badPubkey.Verify())
+}
+
+func (suite *NostrEventTestSuite) TestVerifyLogsToInjectedLogger() {
+	var buf bytes.Buffer
+	SetLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer SetLogger(nil)
+
+	event := &Event{Event: &nostr.Event{ID: "test-id", PubKey: "test-pubkey", Kind: 27235, Tags: nostr.Tags{{"u", "https://api.example.com/secret-path"}}}}
+	suite.False(event.Verify())
+
+	suite.Contains(buf.String(), "nostr event verification failed")
+	suite.Contains(buf.String(), "event_id=test-id")
+	suite.NotContains(buf.String(), "secret-path", "the event's tags aren't logged")
+}
+
+func (suite *NostrEventTestSuite) TestGetTagValue() {
+	event := &Event{Event: &nostr.Event{Tags: nostr.Tags{{"u", "https://a"}, {"t"}, {"t", "rock"}, {"t", "jazz"}, {"u", "https://b"}}}}
+
+	value, ok := event.GetTagValue("u")
+	suite.True(ok)
+	suite.Equal("https://a", value)
+
+	value, ok = event.GetTagValue("t")
+	suite.True(ok, "a tag without a value is skipped")
+	suite.Equal("rock", value)
+
+	_, ok = event.GetTagValue("method")
+	suite.False(ok)
+
+	suite.Equal([]string{"rock", "jazz"}, event.GetAllTagValues("t"))
+	suite.Nil(event.GetAllTagValues("method"))
+}
+
+// signedJSON returns a signed event's JSON after mutate changes the event
+func (suite *NostrEventTestSuite) signedJSON(mutate func(event *nostr.Event)) []byte {
+	event := &nostr.Event{Kind: KindHTTPAuth, CreatedAt: nostr.Now(), Tags: nostr.Tags{{"u", "https://api.example.com"}}}
+	suite.Require().NoError(event.Sign(nostr.GeneratePrivateKey()))
+	mutate(event)
+	data, err := json.Marshal(event)
+	suite.Require().NoError(err)
+	return data
+}
+
+func (suite *NostrEventTestSuite) TestParseEvent() {
+	event, err := ParseEvent(suite.signedJSON(func(*nostr.Event) {}), ParseOptions{})
+	suite.Require().NoError(err)
+	suite.True(event.Verify())
+
+	tests := []struct {
+		name string
+		data []byte
+		opts ParseOptions
+		want error
+	}{
+		{"not JSON", []byte("not json"), ParseOptions{}, ErrInvalidJSON},
+		{"too many bytes", suite.signedJSON(func(*nostr.Event) {}), ParseOptions{MaxBytes: 100}, ErrEventTooLarge},
+		{"too many tags", suite.signedJSON(func(e *nostr.Event) { e.Tags = append(e.Tags, nostr.Tag{"t", "x"}) }), ParseOptions{MaxTags: 1}, ErrEventTooLarge},
+		{"long content", suite.signedJSON(func(e *nostr.Event) { e.Content = "hello" }), ParseOptions{MaxContentBytes: 4}, ErrEventTooLarge},
+		{"short ID", suite.signedJSON(func(e *nostr.Event) { e.ID = "abc" }), ParseOptions{}, ErrMalformedEvent},
+		{"uppercase ID", suite.signedJSON(func(e *nostr.Event) { e.ID = strings.ToUpper(e.ID) }), ParseOptions{}, ErrMalformedEvent},
+		{"non-hex pubkey", suite.signedJSON(func(e *nostr.Event) { e.PubKey = strings.Repeat("g", 64) }), ParseOptions{}, ErrMalformedEvent},
+		{"short sig", suite.signedJSON(func(e *nostr.Event) { e.Sig = e.Sig[:64] }), ParseOptions{}, ErrMalformedEvent},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseEvent(tt.data, tt.opts)
+		suite.ErrorIs(err, tt.want, tt.name)
+	}
+
+	// The default limits apply
+	_, err = ParseEvent(suite.signedJSON(func(e *nostr.Event) { e.Content = strings.Repeat("x", DefaultMaxContentBytes+1) }), ParseOptions{MaxBytes: 1 << 20})
+	suite.ErrorIs(err, ErrEventTooLarge)
+}
+
 func TestNostrEventTestSuite(t *testing.T) {
 	suite.Run(t, new(NostrEventTestSuite))
 }
+
+func FuzzParseEvent(f *testing.F) {
+	event := &nostr.Event{Kind: KindHTTPAuth, CreatedAt: 1682327852, Tags: nostr.Tags{{"u", "https://api.example.com"}, {"method", "GET"}}}
+	if err := event.Sign(nostr.GeneratePrivateKey()); err != nil {
+		f.Fatal(err)
+	}
+	signed, _ := json.Marshal(event)
+	f.Add(signed)
+	f.Add([]byte(`{"id":"","pubkey":"","sig":"","tags":[[]],"content":"\u0000"}`))
+	f.Add([]byte(`[]`))
+	f.Add([]byte(`null`))
+
+	opts := ParseOptions{MaxBytes: 4096, MaxTags: 8, MaxContentBytes: 256}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		event, err := ParseEvent(data, opts)
+		if err != nil {
+			return
+		}
+		if len(data) > opts.MaxBytes || len(event.Tags) > opts.MaxTags || len(event.Content) > opts.MaxContentBytes {
+			t.Fatalf("accepted an event over the limits: %s", data)
+		}
+		if !nostr.IsValid32ByteHex(event.ID) || !nostr.IsValid32ByteHex(event.PubKey) || len(event.Sig) != 128 {
+			t.Fatalf("accepted malformed fields: %s", data)
+		}
+		// Anything ParseEvent accepts is safe to verify
+		event.Verify()
+	})
+}
@@ -0,0 +1,50 @@
+package nostr
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	gonostr "github.com/nbd-wtf/go-nostr"
+)
+
+// KindHTTPAuth is the NIP-98 HTTP auth event kind
+const KindHTTPAuth = 27235
+
+// NewNIP98Event builds and signs a NIP-98 auth event for a request. A
+// non-empty body adds the payload tag with its SHA-256 hex.
+func NewNIP98Event(secretKey, method, url string, body []byte) (*Event, error) {
+	event := &gonostr.Event{
+		Kind:      KindHTTPAuth,
+		CreatedAt: gonostr.Now(),
+		Tags: gonostr.Tags{
+			{"u", url},
+			{"method", method},
+		},
+	}
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		event.Tags = append(event.Tags, gonostr.Tag{"payload", hex.EncodeToString(sum[:])})
+	}
+	if err := event.Sign(secretKey); err != nil {
+		return nil, fmt.Errorf("failed to sign NIP-98 event: %w", err)
+	}
+	return &Event{Event: event}, nil
+}
+
+// NIP98AuthorizationHeader returns the Authorization header value that
+// authenticates a request with the given body as the owner of secretKey
+func NIP98AuthorizationHeader(secretKey, method, url string, body []byte) (string, error) {
+	event, err := NewNIP98Event(secretKey, method, url, body)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(event.Event)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode NIP-98 event: %w", err)
+	}
+	return "Nostr " + base64.StdEncoding.EncodeToString(data), nil
+}
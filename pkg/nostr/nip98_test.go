@@ -0,0 +1,51 @@
+package nostr
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	gonostr "github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNIP98AuthorizationHeader(t *testing.T) {
+	sk := gonostr.GeneratePrivateKey()
+	pk, err := gonostr.GetPublicKey(sk)
+	require.NoError(t, err)
+
+	header, err := NIP98AuthorizationHeader(sk, "POST", "https://api.example.com/v1/tracks/nostr", nil)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(header, "Nostr "))
+
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, "Nostr "))
+	require.NoError(t, err)
+
+	var decoded gonostr.Event
+	require.NoError(t, json.Unmarshal(raw, &decoded))
+
+	event := &Event{Event: &decoded}
+	assert.True(t, event.Verify())
+	assert.Equal(t, pk, event.PubKey)
+	assert.Equal(t, KindHTTPAuth, event.Kind)
+	assert.Equal(t, "https://api.example.com/v1/tracks/nostr", event.Tags.GetFirst([]string{"u", ""}).Value())
+	assert.Equal(t, "POST", event.Tags.GetFirst([]string{"method", ""}).Value())
+	assert.Nil(t, event.Tags.GetFirst([]string{"payload", ""}))
+}
+
+func TestNewNIP98EventPayload(t *testing.T) {
+	event, err := NewNIP98Event(gonostr.GeneratePrivateKey(), "POST", "https://api.example.com/v1/tracks/nostr", []byte(`{"extension":"mp3"}`))
+	require.NoError(t, err)
+
+	payload := event.Tags.GetFirst([]string{"payload", ""})
+	require.NotNil(t, payload)
+	assert.Equal(t, "3df32d383d4e99088e8560a4748fff30c229d05d1316e5a4e3dc2c478d0e9517", payload.Value())
+	assert.True(t, event.Verify())
+}
+
+func TestNewNIP98EventRejectsInvalidKey(t *testing.T) {
+	_, err := NewNIP98Event("not-a-key", "GET", "https://api.example.com/", nil)
+	assert.Error(t, err)
+}
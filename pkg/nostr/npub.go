@@ -0,0 +1,93 @@
+package nostr
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// ErrInvalidBech32 is matched by errors.Is for npub and nsec strings that
+// don't decode
+var ErrInvalidBech32 = errors.New("invalid bech32 key")
+
+// EncodeNpub returns the NIP-19 npub form of a 64-character hex pubkey
+func EncodeNpub(pubkeyHex string) (string, error) {
+	if err := checkKeyHex("pubkey", pubkeyHex); err != nil {
+		return "", err
+	}
+	return nip19.EncodePublicKey(pubkeyHex)
+}
+
+// DecodeNpub returns the hex pubkey of an npub, checking its bech32 checksum,
+// prefix and length
+func DecodeNpub(npub string) (string, error) {
+	return decodeKey("npub", npub)
+}
+
+// EncodeNsec returns the NIP-19 nsec form of a 64-character hex private key
+func EncodeNsec(secretKeyHex string) (string, error) {
+	if err := checkKeyHex("secret key", secretKeyHex); err != nil {
+		return "", err
+	}
+	return nip19.EncodePrivateKey(secretKeyHex)
+}
+
+// DecodeNsec returns the hex private key of an nsec
+func DecodeNsec(nsec string) (string, error) {
+	return decodeKey("nsec", nsec)
+}
+
+// NormalizePubkey returns the hex form of a pubkey given as hex or npub.
+// Values without the npub prefix are returned unchanged.
+func NormalizePubkey(pubkey string) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(pubkey), "npub1") {
+		return pubkey, nil
+	}
+	return DecodeNpub(pubkey)
+}
+
+func checkKeyHex(name, keyHex string) error {
+	if len(keyHex) != 64 {
+		return fmt.Errorf("%s must be 64 hex characters, got %d", name, len(keyHex))
+	}
+	if _, err := hex.DecodeString(keyHex); err != nil {
+		return fmt.Errorf("%s is not hex: %w", name, err)
+	}
+	return nil
+}
+
+func decodeKey(prefix, encoded string) (string, error) {
+	gotPrefix, value, err := nip19.Decode(encoded)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidBech32, err)
+	}
+	if gotPrefix != prefix {
+		return "", fmt.Errorf("%w: expected %s, got %s", ErrInvalidBech32, prefix, gotPrefix)
+	}
+	keyHex, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%w: not a %s", ErrInvalidBech32, prefix)
+	}
+	return keyHex, nil
+}
+
+// DisplayPubkey returns a short form of a hex pubkey for showing to users:
+// "npub1" and the next 8 characters of its npub, "…", then the last 4. Values
+// that aren't valid pubkeys are shortened the same way as-is, and returned
+// unchanged when they're already short.
+func DisplayPubkey(pubkeyHex string) string {
+	display := pubkeyHex
+	head := 8
+	if npub, err := EncodeNpub(pubkeyHex); err == nil {
+		display = npub
+		head = len("npub1") + 8
+	}
+
+	if len(display) <= head+4 {
+		return display
+	}
+	return display[:head] + "…" + display[len(display)-4:]
+}
@@ -0,0 +1,97 @@
+package nostr
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// NIP-19's example key
+const (
+	testPubkeyHex = "3bf0c63fcb93463407af97a5e5ee64fa883d107ef9e558472c4eb9aaaefa459d"
+	testNpub      = "npub180cvv07tjdrrgpa0j7j7tmnyl2yr6yr7l8j4s3evf6u64th6gkwsyjh6w6"
+)
+
+func TestEncodeNpub(t *testing.T) {
+	npub, err := EncodeNpub(testPubkeyHex)
+	require.NoError(t, err)
+	assert.Equal(t, testNpub, npub)
+
+	_, err = EncodeNpub("abc123")
+	assert.Error(t, err)
+	_, err = EncodeNpub(strings.Repeat("z", 64))
+	assert.Error(t, err)
+}
+
+// Vectors from NIP-19
+const (
+	nip19PubkeyHex = "7e7e9c42a91bfef19fa929e5fda1b72e0ebc1a4c1141673e2794234d86addf4e"
+	nip19Npub      = "npub10elfcs4fr0l0r8af98jlmgdh9c8tcxjvz9qkw038js35mp4dma8qzvjptg"
+	nip19SecretHex = "67dea2ed018072d675f5415ecfaed7d2597555e202d85b3d65ea4e58d2d92ffa"
+	nip19Nsec      = "nsec1vl029mgpspedva04g90vltkh6fvh240zqtv9k0t9af8935ke9laqsnlfe5"
+)
+
+func TestNIP19Vectors(t *testing.T) {
+	npub, err := EncodeNpub(nip19PubkeyHex)
+	require.NoError(t, err)
+	assert.Equal(t, nip19Npub, npub)
+
+	pubkey, err := DecodeNpub(nip19Npub)
+	require.NoError(t, err)
+	assert.Equal(t, nip19PubkeyHex, pubkey)
+
+	nsec, err := EncodeNsec(nip19SecretHex)
+	require.NoError(t, err)
+	assert.Equal(t, nip19Nsec, nsec)
+
+	secret, err := DecodeNsec(nip19Nsec)
+	require.NoError(t, err)
+	assert.Equal(t, nip19SecretHex, secret)
+}
+
+func TestDecodeNpubRejectsInvalid(t *testing.T) {
+	for name, value := range map[string]string{
+		"bad checksum": nip19Npub[:len(nip19Npub)-1] + "h",
+		"nsec as npub": nip19Nsec,
+		"not bech32":   "npub1" + strings.Repeat("b", 10) + "!",
+		"truncated":    nip19Npub[:40],
+		"hex":          nip19PubkeyHex,
+		"mixed case":   "NPUB" + nip19Npub[4:],
+		"empty":        "",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := DecodeNpub(value)
+			assert.ErrorIs(t, err, ErrInvalidBech32)
+		})
+	}
+
+	_, err := DecodeNsec(nip19Npub)
+	assert.ErrorIs(t, err, ErrInvalidBech32)
+	_, err = EncodeNsec("abc123")
+	assert.Error(t, err)
+}
+
+func TestNormalizePubkey(t *testing.T) {
+	pubkey, err := NormalizePubkey(nip19Npub)
+	require.NoError(t, err)
+	assert.Equal(t, nip19PubkeyHex, pubkey)
+
+	pubkey, err = NormalizePubkey(nip19PubkeyHex)
+	require.NoError(t, err)
+	assert.Equal(t, nip19PubkeyHex, pubkey)
+
+	_, err = NormalizePubkey("npub1invalid")
+	assert.ErrorIs(t, err, ErrInvalidBech32)
+}
+
+func TestDisplayPubkey(t *testing.T) {
+	assert.Equal(t, "npub180cvv07t…h6w6", DisplayPubkey(testPubkeyHex))
+	assert.Equal(t, DisplayPubkey(testPubkeyHex), DisplayPubkey(testPubkeyHex))
+
+	// Not valid pubkeys: shortened as-is, or left alone when short
+	assert.Equal(t, "pubkey-l…-123", DisplayPubkey("pubkey-long-invalid-123"))
+	assert.Equal(t, "pubkey1", DisplayPubkey("pubkey1"))
+	assert.Equal(t, "", DisplayPubkey(""))
+}
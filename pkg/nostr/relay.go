@@ -0,0 +1,171 @@
+package nostr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	gonostr "github.com/nbd-wtf/go-nostr"
+)
+
+// DefaultRelayTimeout bounds connecting to one relay, sending an event and
+// waiting for its OK
+const DefaultRelayTimeout = 10 * time.Second
+
+// maxRelayMessageBytes bounds one message read from a relay; replies to
+// EVENT are short, but relays may push unrelated messages first
+const maxRelayMessageBytes = 1 << 20
+
+// ErrInvalidRelayURL is returned for a relay URL that isn't ws:// or wss://
+var ErrInvalidRelayURL = errors.New("relay URL must be an absolute ws:// or wss:// URL")
+
+// RelayResult is one relay's response to a published event. Message is the
+// relay's OK message, or why no OK arrived.
+type RelayResult struct {
+	Relay    string
+	Accepted bool
+	Message  string
+}
+
+// RelayClient publishes events to a fixed set of relays, each over its own
+// short-lived connection
+type RelayClient struct {
+	relays  []string
+	timeout time.Duration
+}
+
+// RelayClientOption configures a RelayClient
+type RelayClientOption func(*RelayClient)
+
+// WithRelayTimeout sets how long each relay gets; values <= 0 keep
+// DefaultRelayTimeout
+func WithRelayTimeout(timeout time.Duration) RelayClientOption {
+	return func(c *RelayClient) {
+		if timeout > 0 {
+			c.timeout = timeout
+		}
+	}
+}
+
+// NewRelayClient creates a client for relays, which must be ws:// or wss://
+// URLs
+func NewRelayClient(relays []string, opts ...RelayClientOption) (*RelayClient, error) {
+	for _, relay := range relays {
+		if err := ValidateRelayURL(relay); err != nil {
+			return nil, err
+		}
+	}
+	c := &RelayClient{relays: append([]string(nil), relays...), timeout: DefaultRelayTimeout}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// ValidateRelayURL checks that relay is an absolute ws:// or wss:// URL
+func ValidateRelayURL(relay string) error {
+	parsed, err := url.Parse(relay)
+	if err != nil || (parsed.Scheme != "wss" && parsed.Scheme != "ws") || parsed.Host == "" {
+		return fmt.Errorf("%w: %q", ErrInvalidRelayURL, relay)
+	}
+	return nil
+}
+
+// Relays returns the relays the client publishes to
+func (c *RelayClient) Relays() []string {
+	return append([]string(nil), c.relays...)
+}
+
+// Publish sends event to every relay concurrently and returns each relay's
+// result in the order the relays were configured. One relay failing doesn't
+// affect the others.
+func (c *RelayClient) Publish(ctx context.Context, event *gonostr.Event) []RelayResult {
+	results := make([]RelayResult, len(c.relays))
+	var wg sync.WaitGroup
+	for i, relay := range c.relays {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.publishTo(ctx, relay, event)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// publishTo sends event to one relay and waits for the OK naming it
+func (c *RelayClient) publishTo(ctx context.Context, relay string, event *gonostr.Event) RelayResult {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	result := RelayResult{Relay: relay}
+	conn, _, err := websocket.Dial(ctx, relay, nil)
+	if err != nil {
+		result.Message = "connect failed: " + err.Error()
+		return result
+	}
+	defer conn.CloseNow()
+	conn.SetReadLimit(maxRelayMessageBytes)
+
+	message, err := json.Marshal([]interface{}{"EVENT", event})
+	if err != nil {
+		result.Message = "encode failed: " + err.Error()
+		return result
+	}
+	if err := conn.Write(ctx, websocket.MessageText, message); err != nil {
+		result.Message = "send failed: " + err.Error()
+		return result
+	}
+
+	for {
+		_, data, err := conn.Read(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				result.Message = "timed out waiting for OK"
+			} else {
+				result.Message = "read failed: " + err.Error()
+			}
+			return result
+		}
+		accepted, reason, ok := parseOK(data, event.ID)
+		if !ok {
+			continue // NOTICE, AUTH or an answer to something else
+		}
+		conn.Close(websocket.StatusNormalClosure, "")
+		result.Accepted, result.Message = accepted, reason
+		return result
+	}
+}
+
+// parseOK reads an ["OK", <event id>, <accepted>, <message>] message for
+// eventID. A relay that already has the event reports it as a duplicate,
+// which counts as accepted.
+func parseOK(data []byte, eventID string) (accepted bool, message string, ok bool) {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil || len(fields) < 3 {
+		return false, "", false
+	}
+	var label, id string
+	if json.Unmarshal(fields[0], &label) != nil || label != "OK" {
+		return false, "", false
+	}
+	if json.Unmarshal(fields[1], &id) != nil || id != eventID {
+		return false, "", false
+	}
+	if json.Unmarshal(fields[2], &accepted) != nil {
+		return false, "", false
+	}
+	if len(fields) > 3 {
+		_ = json.Unmarshal(fields[3], &message) // #nosec G104 -- The message is informational
+	}
+	if !accepted && strings.HasPrefix(message, "duplicate:") {
+		accepted = true
+	}
+	return accepted, message, true
+}
@@ -0,0 +1,132 @@
+package nostr
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	gonostr "github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRelay runs a websocket relay that answers each EVENT with reply, given
+// the event's ID. A nil reply never answers.
+func testRelay(t *testing.T, reply func(eventID string) []string) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.CloseNow()
+
+		_, data, err := conn.Read(r.Context())
+		if err != nil {
+			return
+		}
+		var message []json.RawMessage
+		var event gonostr.Event
+		if json.Unmarshal(data, &message) != nil || len(message) != 2 || json.Unmarshal(message[1], &event) != nil {
+			t.Errorf("relay got a malformed EVENT: %s", data)
+			return
+		}
+
+		if reply == nil {
+			<-r.Context().Done()
+			return
+		}
+		for _, answer := range reply(event.ID) {
+			if err := conn.Write(r.Context(), websocket.MessageText, []byte(answer)); err != nil {
+				return
+			}
+		}
+		_, _, _ = conn.Read(r.Context()) // #nosec G104 -- Wait for the client to close
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func signedEvent(t *testing.T) *gonostr.Event {
+	t.Helper()
+	event := &gonostr.Event{Kind: KindMusicTrack, CreatedAt: gonostr.Now(), Tags: gonostr.Tags{{"d", "track-1"}}}
+	require.NoError(t, event.Sign(gonostr.GeneratePrivateKey()))
+	return event
+}
+
+func TestRelayClientPublish(t *testing.T) {
+	accepting := testRelay(t, func(id string) []string {
+		return []string{
+			`["NOTICE","welcome"]`,
+			`["OK","` + strings.Repeat("0", 64) + `",false,"not yours"]`,
+			`["OK","` + id + `",true,""]`,
+		}
+	})
+	rejecting := testRelay(t, func(id string) []string {
+		return []string{`["OK","` + id + `",false,"blocked: pubkey not allowed"]`}
+	})
+	duplicate := testRelay(t, func(id string) []string {
+		return []string{`["OK","` + id + `",false,"duplicate: already have this event"]`}
+	})
+	silent := testRelay(t, nil)
+
+	client, err := NewRelayClient([]string{accepting, rejecting, duplicate, silent, "ws://127.0.0.1:1"},
+		WithRelayTimeout(500*time.Millisecond))
+	require.NoError(t, err)
+
+	results := client.Publish(context.Background(), signedEvent(t))
+	require.Len(t, results, 5)
+
+	assert.Equal(t, RelayResult{Relay: accepting, Accepted: true}, results[0])
+	assert.Equal(t, RelayResult{Relay: rejecting, Message: "blocked: pubkey not allowed"}, results[1])
+	assert.True(t, results[2].Accepted, "a duplicate is already published")
+	assert.False(t, results[3].Accepted)
+	assert.Equal(t, "timed out waiting for OK", results[3].Message)
+	assert.False(t, results[4].Accepted)
+	assert.True(t, strings.HasPrefix(results[4].Message, "connect failed: "), results[4].Message)
+}
+
+func TestNewRelayClientValidatesURLs(t *testing.T) {
+	client, err := NewRelayClient([]string{"wss://relay.wavlake.com", "ws://localhost:7777"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"wss://relay.wavlake.com", "ws://localhost:7777"}, client.Relays())
+
+	for _, relay := range []string{"https://relay.wavlake.com", "wss://", "relay.wavlake.com", "://"} {
+		_, err := NewRelayClient([]string{relay})
+		assert.ErrorIs(t, err, ErrInvalidRelayURL, relay)
+	}
+}
+
+func TestParseOK(t *testing.T) {
+	id := strings.Repeat("a", 64)
+	tests := []struct {
+		name     string
+		message  string
+		accepted bool
+		reason   string
+		ok       bool
+	}{
+		{"accepted", `["OK","` + id + `",true,""]`, true, "", true},
+		{"without message", `["OK","` + id + `",true]`, true, "", true},
+		{"rejected", `["OK","` + id + `",false,"invalid: bad signature"]`, false, "invalid: bad signature", true},
+		{"duplicate", `["OK","` + id + `",false,"duplicate: have it"]`, true, "duplicate: have it", true},
+		{"other event", `["OK","` + strings.Repeat("b", 64) + `",true,""]`, false, "", false},
+		{"notice", `["NOTICE","hello"]`, false, "", false},
+		{"malformed", `{"OK":true}`, false, "", false},
+		{"non-boolean", `["OK","` + id + `","yes",""]`, false, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accepted, reason, ok := parseOK([]byte(tt.message), id)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.accepted, accepted)
+			assert.Equal(t, tt.reason, reason)
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package nostr
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	gonostr "github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	// verifiedCacheSize bounds how many verified events are remembered.
+	// Identical events are only accepted within the NIP-98 timestamp window,
+	// so this covers every retry at well over the request rates we see.
+	verifiedCacheSize = 4096
+
+	// verifiedCacheTTL is how long a verified event is remembered: the
+	// default timestamp window either side of the server's clock
+	verifiedCacheTTL = 2 * time.Minute
+)
+
+// verified remembers recently verified events, so a retried identical event
+// skips the Schnorr check. Only valid events are cached.
+var verified = newVerifiedCache(verifiedCacheSize, verifiedCacheTTL)
+
+// serializeBuffers holds buffers for the NIP-01 serialization hashed into an
+// event's ID
+var serializeBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 512)
+		return &buf
+	},
+}
+
+// eventHash returns the SHA-256 of the event's NIP-01 serialization, the
+// bytes its ID is the hex of
+func eventHash(e *gonostr.Event) [32]byte {
+	buf := serializeBuffers.Get().(*[]byte)
+	*buf = appendSerialized((*buf)[:0], e)
+	hash := sha256.Sum256(*buf)
+	serializeBuffers.Put(buf)
+	return hash
+}
+
+// appendSerialized appends the event's NIP-01 serialization to dst. It matches
+// gonostr.Event.Serialize byte for byte, without allocating.
+func appendSerialized(dst []byte, e *gonostr.Event) []byte {
+	dst = append(dst, `[0,"`...)
+	dst = append(dst, e.PubKey...)
+	dst = append(dst, `",`...)
+	dst = strconv.AppendInt(dst, int64(e.CreatedAt), 10)
+	dst = append(dst, ',')
+	dst = strconv.AppendInt(dst, int64(e.Kind), 10)
+	dst = append(dst, ",["...)
+	for i, tag := range e.Tags {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = append(dst, '[')
+		for j, value := range tag {
+			if j > 0 {
+				dst = append(dst, ',')
+			}
+			dst = appendEscaped(dst, value)
+		}
+		dst = append(dst, ']')
+	}
+	dst = append(dst, "],"...)
+	dst = appendEscaped(dst, e.Content)
+	return append(dst, ']')
+}
+
+// appendEscaped appends s as a JSON string escaped the way NIP-01 requires:
+// quote, backslash and the control characters, nothing else
+func appendEscaped(dst []byte, s string) []byte {
+	const hexDigits = "0123456789abcdef"
+	dst = append(dst, '"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"':
+			dst = append(dst, '\\', '"')
+		case c == '\\':
+			dst = append(dst, '\\', '\\')
+		case c >= 0x20:
+			dst = append(dst, c)
+		case c == '\b':
+			dst = append(dst, '\\', 'b')
+		case c == '\t':
+			dst = append(dst, '\\', 't')
+		case c == '\n':
+			dst = append(dst, '\\', 'n')
+		case c == '\f':
+			dst = append(dst, '\\', 'f')
+		case c == '\r':
+			dst = append(dst, '\\', 'r')
+		default:
+			dst = append(dst, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0x0f])
+		}
+	}
+	return append(dst, '"')
+}
+
+// verifySignature checks sig over hash for the x-only pubkey, both hex. The
+// errors wrap ErrMalformedEvent.
+func verifySignature(pubkeyHex, sigHex string, hash [32]byte) (bool, error) {
+	var pubkeyBytes [32]byte
+	if len(pubkeyHex) != 64 {
+		return false, fmt.Errorf("%w: pubkey is %d characters, not 64", ErrMalformedEvent, len(pubkeyHex))
+	}
+	if _, err := hex.Decode(pubkeyBytes[:], []byte(pubkeyHex)); err != nil {
+		return false, fmt.Errorf("%w: pubkey is invalid hex: %v", ErrMalformedEvent, err)
+	}
+	pubkey, err := schnorr.ParsePubKey(pubkeyBytes[:])
+	if err != nil {
+		return false, fmt.Errorf("%w: invalid pubkey: %v", ErrMalformedEvent, err)
+	}
+
+	var sigBytes [64]byte
+	if len(sigHex) != 128 {
+		return false, fmt.Errorf("%w: signature is %d characters, not 128", ErrMalformedEvent, len(sigHex))
+	}
+	if _, err := hex.Decode(sigBytes[:], []byte(sigHex)); err != nil {
+		return false, fmt.Errorf("%w: signature is invalid hex: %v", ErrMalformedEvent, err)
+	}
+	sig, err := schnorr.ParseSignature(sigBytes[:])
+	if err != nil {
+		return false, fmt.Errorf("%w: invalid signature: %v", ErrMalformedEvent, err)
+	}
+
+	return sig.Verify(hash[:], pubkey), nil
+}
+
+// verifiedCache is an LRU of valid events by ID, holding each one's signature
+// for a fixed TTL. The ID covers everything but the signature, so an event
+// whose hash matches a cached ID and whose signature matches the cached one is
+// the event that was verified. A nil cache stores nothing.
+type verifiedCache struct {
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List // Front is most recently used
+	entries map[string]*list.Element
+}
+
+type verifiedEntry struct {
+	id        string
+	sig       string
+	expiresAt time.Time
+}
+
+func newVerifiedCache(size int, ttl time.Duration) *verifiedCache {
+	if size <= 0 || ttl <= 0 {
+		return nil
+	}
+	return &verifiedCache{
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		order:   list.New(),
+		entries: make(map[string]*list.Element, size),
+	}
+}
+
+// contains reports whether the event with id and sig was verified within the TTL
+func (c *verifiedCache) contains(id, sig string) bool {
+	if c == nil {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[id]
+	if !ok {
+		return false
+	}
+	entry := element.Value.(*verifiedEntry)
+	if c.now().After(entry.expiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, id)
+		return false
+	}
+	if entry.sig != sig {
+		return false
+	}
+	c.order.MoveToFront(element)
+	return true
+}
+
+// add records a verified event, evicting the least recently used past size
+func (c *verifiedCache) add(id, sig string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expiresAt := c.now().Add(c.ttl)
+	if element, ok := c.entries[id]; ok {
+		entry := element.Value.(*verifiedEntry)
+		entry.sig, entry.expiresAt = sig, expiresAt
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[id] = c.order.PushFront(&verifiedEntry{id: id, sig: sig, expiresAt: expiresAt})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*verifiedEntry).id)
+	}
+}
+
+func (c *verifiedCache) len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
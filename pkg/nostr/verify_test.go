@@ -0,0 +1,195 @@
+package nostr
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	gonostr "github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// authEvent returns a signed NIP-98 event like the ones clients send
+func authEvent(t testing.TB) *Event {
+	t.Helper()
+	event := &gonostr.Event{
+		Kind:      KindHTTPAuth,
+		CreatedAt: gonostr.Now(),
+		Tags: gonostr.Tags{
+			{"u", "https://api.wavlake.com/v1/tracks/nostr"},
+			{"method", "POST"},
+			{"payload", "a3f1c7e2b9d84f6a0e5c3b1d7f9a2e4c6b8d0f1a3c5e7b9d1f3a5c7e9b1d3f5a"},
+		},
+	}
+	require.NoError(t, event.Sign(gonostr.GeneratePrivateKey()))
+	return &Event{Event: event}
+}
+
+// withVerifiedCache swaps the package cache for the duration of the test
+func withVerifiedCache(t testing.TB, cache *verifiedCache) {
+	previous := verified
+	verified = cache
+	t.Cleanup(func() { verified = previous })
+}
+
+func TestAppendSerializedMatchesGoNostr(t *testing.T) {
+	var control []byte
+	for c := byte(0); c < 0x20; c++ {
+		control = append(control, c)
+	}
+	events := []*gonostr.Event{
+		{},
+		{PubKey: "abc", CreatedAt: 1682327852, Kind: 31337, Tags: gonostr.Tags{{"d", "x"}, {}, {"t", "a", "b"}}, Content: "plain"},
+		{Kind: 1, Content: string(control) + `"quoted" \back\slash </script> 😀 é` + "\x7f"},
+		{Kind: -1, CreatedAt: -5, Tags: gonostr.Tags{{"\n\t", " "}}},
+	}
+
+	for _, event := range events {
+		assert.Equal(t, string(event.Serialize()), string(appendSerialized(nil, event)))
+	}
+}
+
+func FuzzAppendSerialized(f *testing.F) {
+	f.Add("pubkey", int64(1682327852), 27235, "u", "https://api.example.com", "content")
+	f.Add("", int64(0), 0, "\x00\x1f", "\"\\", "\b\f\n\r\t\x0b")
+	f.Fuzz(func(t *testing.T, pubkey string, createdAt int64, kind int, name, value, content string) {
+		event := &gonostr.Event{
+			PubKey:    pubkey,
+			CreatedAt: gonostr.Timestamp(createdAt),
+			Kind:      kind,
+			Tags:      gonostr.Tags{{name, value}, {value}},
+			Content:   content,
+		}
+		if !bytes.Equal(event.Serialize(), appendSerialized(nil, event)) {
+			t.Fatalf("serialization differs for %#v", event)
+		}
+	})
+}
+
+func TestVerifyCachesValidEvents(t *testing.T) {
+	cache := newVerifiedCache(10, time.Minute)
+	withVerifiedCache(t, cache)
+
+	event := authEvent(t)
+	require.NoError(t, event.VerifyWithReason())
+	assert.True(t, cache.contains(event.ID, event.Sig))
+
+	// A cached event is still checked against its ID, and a different
+	// signature is verified again
+	tampered := &Event{Event: &gonostr.Event{}}
+	*tampered.Event = *event.Event
+	tampered.Content = "changed"
+	assert.ErrorIs(t, tampered.VerifyWithReason(), ErrEventIDMismatch)
+
+	wrongSig := &Event{Event: &gonostr.Event{}}
+	*wrongSig.Event = *event.Event
+	wrongSig.Sig = authEvent(t).Sig
+	assert.ErrorIs(t, wrongSig.VerifyWithReason(), ErrInvalidSignature)
+
+	// Invalid events aren't cached
+	assert.Equal(t, 1, cache.len())
+}
+
+func TestVerifyMatchesGoNostr(t *testing.T) {
+	withVerifiedCache(t, nil)
+
+	valid := authEvent(t)
+	badPubkey := authEvent(t)
+	badPubkey.PubKey = "zz" + badPubkey.PubKey[2:]
+	badPubkey.ID = badPubkey.GetID()
+	longPubkey := authEvent(t)
+	longPubkey.PubKey += "00"
+	longPubkey.ID = longPubkey.GetID()
+	shortSig := authEvent(t)
+	shortSig.Sig = shortSig.Sig[:126]
+	otherSig := authEvent(t)
+	otherSig.Sig = authEvent(t).Sig
+	upperID := authEvent(t)
+	upperID.ID = string(bytes.ToUpper([]byte(upperID.ID)))
+
+	for name, event := range map[string]*Event{
+		"valid": valid, "bad pubkey": badPubkey, "long pubkey": longPubkey,
+		"short sig": shortSig, "other sig": otherSig, "uppercase ID": upperID,
+	} {
+		ok, err := event.Event.CheckSignature()
+		want := event.GetID() == event.ID && err == nil && ok
+		assert.Equal(t, want, event.Verify(), name)
+	}
+}
+
+func TestVerifiedCache(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cache := newVerifiedCache(2, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	cache.add("a", "sig-a")
+	cache.add("b", "sig-b")
+	assert.True(t, cache.contains("a", "sig-a"))
+	assert.False(t, cache.contains("a", "sig-b"))
+
+	// "b" is least recently used
+	cache.add("c", "sig-c")
+	assert.False(t, cache.contains("b", "sig-b"))
+	assert.True(t, cache.contains("a", "sig-a"))
+	assert.True(t, cache.contains("c", "sig-c"))
+	assert.Equal(t, 2, cache.len())
+
+	now = now.Add(time.Minute + time.Second)
+	assert.False(t, cache.contains("a", "sig-a"))
+	assert.Equal(t, 1, cache.len())
+
+	var disabled *verifiedCache
+	disabled.add("a", "sig-a")
+	assert.False(t, disabled.contains("a", "sig-a"))
+	assert.Nil(t, newVerifiedCache(0, time.Minute))
+}
+
+// BenchmarkVerifyGoNostr is how events were verified before: go-nostr's
+// GetID and CheckSignature, which serialize and hash the event twice
+func BenchmarkVerifyGoNostr(b *testing.B) {
+	event := authEvent(b)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ok, err := event.Event.CheckSignature()
+		if event.GetID() != event.ID || err != nil || !ok {
+			b.Fatal("event didn't verify")
+		}
+	}
+}
+
+// BenchmarkVerify is a first sight of each event
+func BenchmarkVerify(b *testing.B) {
+	withVerifiedCache(b, nil)
+	event := authEvent(b)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if !event.Verify() {
+			b.Fatal("event didn't verify")
+		}
+	}
+}
+
+// BenchmarkVerifyCached is a retried identical event
+func BenchmarkVerifyCached(b *testing.B) {
+	withVerifiedCache(b, newVerifiedCache(verifiedCacheSize, verifiedCacheTTL))
+	event := authEvent(b)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if !event.Verify() {
+			b.Fatal("event didn't verify")
+		}
+	}
+}
+
+func BenchmarkVerifyInvalidSignature(b *testing.B) {
+	withVerifiedCache(b, newVerifiedCache(verifiedCacheSize, verifiedCacheTTL))
+	event := authEvent(b)
+	event.Sig = authEvent(b).Sig
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if event.Verify() {
+			b.Fatal("event verified")
+		}
+	}
+}
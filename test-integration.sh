@@ -35,8 +35,11 @@ echo ""
 # Test 2: Webhook endpoint structure
 echo -e "${YELLOW}Test 2: Webhook endpoint${NC}"
 WEBHOOK_SECRET="ed6c1d3ab34f6af3cc173236e773565545af308a5a681e8c686664506cbfc0e2"
+WEBHOOK_TIMESTAMP=$(date +%s)
+WEBHOOK_SIGNATURE=$(printf '%s.' "$WEBHOOK_TIMESTAMP" | openssl dgst -sha256 -hmac "$WEBHOOK_SECRET" | awk '{print $NF}')
 response=$(curl -s -w "%{http_code}" -X POST "$API_URL/v1/tracks/webhook/process" \
-  -H "X-Webhook-Secret: $WEBHOOK_SECRET" -o /tmp/webhook_response)
+  -H "X-Webhook-Timestamp: $WEBHOOK_TIMESTAMP" \
+  -H "X-Webhook-Signature: $WEBHOOK_SIGNATURE" -o /tmp/webhook_response)
 http_code="${response: -3}"
 
 if [ "$http_code" = "400" ]; then